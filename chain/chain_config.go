@@ -0,0 +1,292 @@
+/*
+   Copyright 2021 Erigon contributors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package chain
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+
+	"github.com/ledgerwatch/erigon-lib/kv"
+)
+
+// Config - fork schedule of a chain, JSON is compatible with "config" section of genesis files. Forks
+// before the Merge are activated by block number, after it - by block timestamp. Nil - fork is not scheduled
+type Config struct {
+	ChainName string   `json:"chainName,omitempty"`
+	ChainID   *big.Int `json:"chainId"`
+
+	HomesteadBlock        *big.Int `json:"homesteadBlock,omitempty"`
+	DAOForkBlock          *big.Int `json:"daoForkBlock,omitempty"`
+	TangerineWhistleBlock *big.Int `json:"eip150Block,omitempty"`
+	SpuriousDragonBlock   *big.Int `json:"eip155Block,omitempty"`
+	ByzantiumBlock        *big.Int `json:"byzantiumBlock,omitempty"`
+	ConstantinopleBlock   *big.Int `json:"constantinopleBlock,omitempty"`
+	PetersburgBlock       *big.Int `json:"petersburgBlock,omitempty"`
+	IstanbulBlock         *big.Int `json:"istanbulBlock,omitempty"`
+	MuirGlacierBlock      *big.Int `json:"muirGlacierBlock,omitempty"`
+	BerlinBlock           *big.Int `json:"berlinBlock,omitempty"`
+	LondonBlock           *big.Int `json:"londonBlock,omitempty"`
+	ArrowGlacierBlock     *big.Int `json:"arrowGlacierBlock,omitempty"`
+	GrayGlacierBlock      *big.Int `json:"grayGlacierBlock,omitempty"`
+
+	TerminalTotalDifficulty *big.Int `json:"terminalTotalDifficulty,omitempty"` // the Merge
+
+	ShanghaiTime *big.Int `json:"shanghaiTime,omitempty"`
+	CancunTime   *big.Int `json:"cancunTime,omitempty"`
+	PragueTime   *big.Int `json:"pragueTime,omitempty"`
+}
+
+func (c *Config) String() string {
+	return fmt.Sprintf("{ChainID: %v, Homestead: %v, DAO: %v, Tangerine Whistle: %v, Spurious Dragon: %v, Byzantium: %v, Constantinople: %v, Petersburg: %v, Istanbul: %v, Muir Glacier: %v, Berlin: %v, London: %v, Arrow Glacier: %v, Gray Glacier: %v, Terminal Total Difficulty: %v, Shanghai: %v, Cancun: %v, Prague: %v}",
+		c.ChainID, c.HomesteadBlock, c.DAOForkBlock, c.TangerineWhistleBlock, c.SpuriousDragonBlock, c.ByzantiumBlock,
+		c.ConstantinopleBlock, c.PetersburgBlock, c.IstanbulBlock, c.MuirGlacierBlock, c.BerlinBlock, c.LondonBlock,
+		c.ArrowGlacierBlock, c.GrayGlacierBlock, c.TerminalTotalDifficulty, c.ShanghaiTime, c.CancunTime, c.PragueTime)
+}
+
+func isForked(fork *big.Int, v uint64) bool {
+	return fork != nil && fork.IsUint64() && fork.Uint64() <= v
+}
+
+func (c *Config) IsHomestead(num uint64) bool        { return isForked(c.HomesteadBlock, num) }
+func (c *Config) IsDAOFork(num uint64) bool          { return isForked(c.DAOForkBlock, num) }
+func (c *Config) IsTangerineWhistle(num uint64) bool { return isForked(c.TangerineWhistleBlock, num) }
+func (c *Config) IsSpuriousDragon(num uint64) bool   { return isForked(c.SpuriousDragonBlock, num) }
+func (c *Config) IsByzantium(num uint64) bool        { return isForked(c.ByzantiumBlock, num) }
+func (c *Config) IsConstantinople(num uint64) bool   { return isForked(c.ConstantinopleBlock, num) }
+func (c *Config) IsPetersburg(num uint64) bool {
+	// Petersburg is Constantinople without EIP-1283, chains which activated Constantinople without it have no Petersburg block
+	return isForked(c.PetersburgBlock, num) || c.PetersburgBlock == nil && isForked(c.ConstantinopleBlock, num)
+}
+func (c *Config) IsIstanbul(num uint64) bool     { return isForked(c.IstanbulBlock, num) }
+func (c *Config) IsMuirGlacier(num uint64) bool  { return isForked(c.MuirGlacierBlock, num) }
+func (c *Config) IsBerlin(num uint64) bool       { return isForked(c.BerlinBlock, num) }
+func (c *Config) IsLondon(num uint64) bool       { return isForked(c.LondonBlock, num) }
+func (c *Config) IsArrowGlacier(num uint64) bool { return isForked(c.ArrowGlacierBlock, num) }
+func (c *Config) IsGrayGlacier(num uint64) bool  { return isForked(c.GrayGlacierBlock, num) }
+func (c *Config) IsShanghai(time uint64) bool    { return isForked(c.ShanghaiTime, time) }
+func (c *Config) IsCancun(time uint64) bool      { return isForked(c.CancunTime, time) }
+func (c *Config) IsPrague(time uint64) bool      { return isForked(c.PragueTime, time) }
+
+// Rules - forks which are active at given block, to pass them to components instead of separate flags
+type Rules struct {
+	ChainID                                                 *big.Int
+	IsHomestead, IsTangerineWhistle, IsSpuriousDragon       bool
+	IsByzantium, IsConstantinople, IsPetersburg, IsIstanbul bool
+	IsBerlin, IsLondon, IsShanghai, IsCancun, IsPrague      bool
+}
+
+func (c *Config) Rules(num, time uint64) Rules {
+	chainID := c.ChainID
+	if chainID == nil {
+		chainID = new(big.Int)
+	}
+	return Rules{
+		ChainID:            new(big.Int).Set(chainID),
+		IsHomestead:        c.IsHomestead(num),
+		IsTangerineWhistle: c.IsTangerineWhistle(num),
+		IsSpuriousDragon:   c.IsSpuriousDragon(num),
+		IsByzantium:        c.IsByzantium(num),
+		IsConstantinople:   c.IsConstantinople(num),
+		IsPetersburg:       c.IsPetersburg(num),
+		IsIstanbul:         c.IsIstanbul(num),
+		IsBerlin:           c.IsBerlin(num),
+		IsLondon:           c.IsLondon(num),
+		IsShanghai:         c.IsShanghai(time),
+		IsCancun:           c.IsCancun(time),
+		IsPrague:           c.IsPrague(time),
+	}
+}
+
+type fork struct {
+	name     string
+	activate *big.Int
+	optional bool // may be skipped by chains, like DAO and difficulty bomb delays
+}
+
+func (c *Config) blockForks() []fork {
+	return []fork{
+		{name: "homesteadBlock", activate: c.HomesteadBlock},
+		{name: "daoForkBlock", activate: c.DAOForkBlock, optional: true},
+		{name: "eip150Block", activate: c.TangerineWhistleBlock},
+		{name: "eip155Block", activate: c.SpuriousDragonBlock},
+		{name: "byzantiumBlock", activate: c.ByzantiumBlock},
+		{name: "constantinopleBlock", activate: c.ConstantinopleBlock},
+		{name: "petersburgBlock", activate: c.PetersburgBlock},
+		{name: "istanbulBlock", activate: c.IstanbulBlock},
+		{name: "muirGlacierBlock", activate: c.MuirGlacierBlock, optional: true},
+		{name: "berlinBlock", activate: c.BerlinBlock},
+		{name: "londonBlock", activate: c.LondonBlock},
+		{name: "arrowGlacierBlock", activate: c.ArrowGlacierBlock, optional: true},
+		{name: "grayGlacierBlock", activate: c.GrayGlacierBlock, optional: true},
+	}
+}
+
+func (c *Config) timeForks() []fork {
+	return []fork{
+		{name: "shanghaiTime", activate: c.ShanghaiTime},
+		{name: "cancunTime", activate: c.CancunTime},
+		{name: "pragueTime", activate: c.PragueTime},
+	}
+}
+
+// CheckForkOrder - forks must be activated in order, not optional forks can't be skipped
+func (c *Config) CheckForkOrder() error {
+	for _, forks := range [][]fork{c.blockForks(), c.timeForks()} {
+		var last fork
+		for _, cur := range forks {
+			if last.name != "" {
+				if last.activate == nil && cur.activate != nil {
+					return fmt.Errorf("unsupported fork ordering: %v not enabled, but %v enabled at %v", last.name, cur.name, cur.activate)
+				}
+				if last.activate != nil && cur.activate != nil && last.activate.Cmp(cur.activate) > 0 {
+					return fmt.Errorf("unsupported fork ordering: %v enabled at %v, but %v enabled at %v", last.name, last.activate, cur.name, cur.activate)
+				}
+			}
+			if !cur.optional || cur.activate != nil {
+				last = cur
+			}
+		}
+	}
+	return nil
+}
+
+// CompatError - new config changes forks which are already activated by stored chain
+type CompatError struct {
+	What            string
+	Stored, New     *big.Int
+	RewindToBlock   uint64 // chain must be unwound to this block to apply new config, for forks activated by block
+	RewindToTime    uint64 // same, for forks activated by time
+	ActivatedByTime bool
+}
+
+func (e *CompatError) Error() string {
+	if e.ActivatedByTime {
+		return fmt.Sprintf("mismatching %s in database (have timestamp %v, want timestamp %v, rewind to timestamp %d)", e.What, e.Stored, e.New, e.RewindToTime)
+	}
+	return fmt.Sprintf("mismatching %s in database (have block %v, want block %v, rewind to block %d)", e.What, e.Stored, e.New, e.RewindToBlock)
+}
+
+// CheckCompatible - checks that config stored with chain, which head is at given block and time, can be replaced by
+// newCfg: forks which are already activated must stay the same
+func (c *Config) CheckCompatible(newCfg *Config, headNum, headTime uint64) error {
+	if c.ChainID == nil || newCfg.ChainID == nil || c.ChainID.Cmp(newCfg.ChainID) != 0 {
+		return &CompatError{What: "chainId", Stored: c.ChainID, New: newCfg.ChainID}
+	}
+	stored, updated := c.blockForks(), newCfg.blockForks()
+	for i := range stored {
+		if incompatible(stored[i].activate, updated[i].activate, headNum) {
+			return &CompatError{What: stored[i].name, Stored: stored[i].activate, New: updated[i].activate, RewindToBlock: rewindTo(stored[i].activate, updated[i].activate)}
+		}
+	}
+	stored, updated = c.timeForks(), newCfg.timeForks()
+	for i := range stored {
+		if incompatible(stored[i].activate, updated[i].activate, headTime) {
+			return &CompatError{What: stored[i].name, Stored: stored[i].activate, New: updated[i].activate, RewindToTime: rewindTo(stored[i].activate, updated[i].activate), ActivatedByTime: true}
+		}
+	}
+	return nil
+}
+
+// incompatible - fork was or would be activated at head, and its activation changes
+func incompatible(stored, updated *big.Int, head uint64) bool {
+	if (isForked(stored, head) || isForked(updated, head)) && !equal(stored, updated) {
+		return true
+	}
+	return false
+}
+
+func equal(a, b *big.Int) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return a.Cmp(b) == 0
+}
+
+func rewindTo(stored, updated *big.Int) uint64 {
+	first := stored
+	if first == nil || (updated != nil && updated.Cmp(first) < 0) {
+		first = updated
+	}
+	if first.Sign() > 0 {
+		return first.Uint64() - 1
+	}
+	return 0
+}
+
+// FromJSON - parses chain-spec (config object) or genesis file (with "config" field)
+func FromJSON(b []byte) (*Config, error) {
+	var genesis struct {
+		Config *Config `json:"config"`
+	}
+	if err := json.Unmarshal(b, &genesis); err != nil {
+		return nil, fmt.Errorf("chain config: %w", err)
+	}
+	cfg := genesis.Config
+	if cfg == nil {
+		cfg = &Config{}
+		if err := json.Unmarshal(b, cfg); err != nil {
+			return nil, fmt.Errorf("chain config: %w", err)
+		}
+	}
+	if cfg.ChainID == nil {
+		return nil, fmt.Errorf("chain config: chainId is missing")
+	}
+	if err := cfg.CheckForkOrder(); err != nil {
+		return nil, fmt.Errorf("chain config: %w", err)
+	}
+	return cfg, nil
+}
+
+// ReadConfig - config stored for chain of given genesis, nil if not stored
+func ReadConfig(tx kv.Getter, genesisHash []byte) (*Config, error) {
+	v, err := tx.GetOne(kv.ConfigTable, genesisHash)
+	if err != nil {
+		return nil, err
+	}
+	if len(v) == 0 {
+		return nil, nil
+	}
+	cfg := &Config{}
+	if err := json.Unmarshal(v, cfg); err != nil {
+		return nil, fmt.Errorf("invalid chain config JSON in db: %w", err)
+	}
+	return cfg, nil
+}
+
+func WriteConfig(tx kv.Putter, genesisHash []byte, cfg *Config) error {
+	v, err := json.Marshal(cfg)
+	if err != nil {
+		return err
+	}
+	return tx.Put(kv.ConfigTable, genesisHash, v)
+}
+
+// UpdateConfig - stores config at start of the node, if config is already stored - checks that new one is
+// compatible with chain which head is at given block and time
+func UpdateConfig(tx kv.GetPut, genesisHash []byte, newCfg *Config, headNum, headTime uint64) error {
+	stored, err := ReadConfig(tx, genesisHash)
+	if err != nil {
+		return err
+	}
+	if stored != nil {
+		if err := stored.CheckCompatible(newCfg, headNum, headTime); err != nil {
+			return err
+		}
+	}
+	return WriteConfig(tx, genesisHash, newCfg)
+}
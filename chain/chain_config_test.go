@@ -0,0 +1,112 @@
+/*
+   Copyright 2021 Erigon contributors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package chain
+
+import (
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/ledgerwatch/erigon-lib/kv/memdb"
+	"github.com/stretchr/testify/require"
+)
+
+const testGenesis = `{
+  "config": {
+    "chainId": 1,
+    "homesteadBlock": 1150000,
+    "daoForkBlock": 1920000,
+    "eip150Block": 2463000,
+    "eip155Block": 2675000,
+    "byzantiumBlock": 4370000,
+    "constantinopleBlock": 7280000,
+    "petersburgBlock": 7280000,
+    "istanbulBlock": 9069000,
+    "muirGlacierBlock": 9200000,
+    "berlinBlock": 12244000,
+    "londonBlock": 12965000,
+    "arrowGlacierBlock": 13773000,
+    "grayGlacierBlock": 15050000,
+    "terminalTotalDifficulty": 58750000000000000000000,
+    "shanghaiTime": 1681338455,
+    "cancunTime": 1710338135
+  },
+  "nonce": "0x42",
+  "alloc": {}
+}`
+
+func TestConfig(t *testing.T) {
+	require := require.New(t)
+	cfg, err := FromJSON([]byte(testGenesis))
+	require.NoError(err)
+	require.Equal(int64(1), cfg.ChainID.Int64())
+	require.False(cfg.IsLondon(12964999))
+	require.True(cfg.IsLondon(12965000))
+	require.True(cfg.IsShanghai(1681338455))
+	require.False(cfg.IsCancun(1710338134))
+	require.False(cfg.IsPrague(1 << 62))
+	rules := cfg.Rules(15050000, 1681338455)
+	require.True(rules.IsLondon && rules.IsShanghai && rules.IsPetersburg)
+	require.False(rules.IsCancun)
+
+	// chain-spec without genesis
+	spec, err := FromJSON([]byte(`{"chainId": 5, "homesteadBlock": 0, "eip150Block": 0, "eip155Block": 0, "byzantiumBlock": 0, "constantinopleBlock": 0}`))
+	require.NoError(err)
+	require.Equal(int64(5), spec.ChainID.Int64())
+	require.True(spec.IsPetersburg(0)) // Constantinople without separate Petersburg block
+
+	_, err = FromJSON([]byte(`{"chainId": 5, "homesteadBlock": 10, "eip150Block": 5}`))
+	require.Error(err)
+	_, err = FromJSON([]byte(`{"chainId": 5, "homesteadBlock": 0, "byzantiumBlock": 5}`))
+	require.Error(err)
+	_, err = FromJSON([]byte(`{"homesteadBlock": 0}`))
+	require.Error(err)
+}
+
+func TestCheckCompatible(t *testing.T) {
+	require := require.New(t)
+	stored, err := FromJSON([]byte(testGenesis))
+	require.NoError(err)
+	updated, err := FromJSON([]byte(testGenesis))
+	require.NoError(err)
+	updated.PragueTime = big.NewInt(1_800_000_000)
+	require.NoError(stored.CheckCompatible(updated, 20_000_000, 1_750_000_000))
+
+	// scheduled fork is already active
+	var compatErr *CompatError
+	err = stored.CheckCompatible(updated, 20_000_000, 1_800_000_001)
+	require.True(errors.As(err, &compatErr))
+	require.Equal("pragueTime", compatErr.What)
+	require.Equal(uint64(1_799_999_999), compatErr.RewindToTime)
+
+	updated.PragueTime = nil
+	updated.LondonBlock = big.NewInt(12965001)
+	err = stored.CheckCompatible(updated, 12965000, 0)
+	require.True(errors.As(err, &compatErr))
+	require.Equal("londonBlock", compatErr.What)
+	require.Equal(uint64(12964999), compatErr.RewindToBlock)
+	require.NoError(stored.CheckCompatible(updated, 12964000, 0)) // not reached yet
+
+	_, tx := memdb.NewTestTx(t)
+	genesis := []byte{1}
+	require.NoError(UpdateConfig(tx, genesis, stored, 0, 0))
+	require.Error(UpdateConfig(tx, genesis, updated, 13_000_000, 0))
+	read, err := ReadConfig(tx, genesis)
+	require.NoError(err)
+	require.Equal(stored, read)
+	require.NoError(UpdateConfig(tx, genesis, updated, 12_000_000, 0))
+}
@@ -0,0 +1,150 @@
+/*
+   Copyright 2021 Erigon contributors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package chain
+
+import (
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"math"
+	"sort"
+
+	"github.com/ledgerwatch/erigon-lib/common"
+)
+
+var (
+	// ErrRemoteStale - remote peer is on the chain we've passed, but it's not aware of the next fork
+	ErrRemoteStale = errors.New("remote needs update")
+	// ErrLocalIncompatibleOrStale - remote peer is on a different chain, or local node missed a fork
+	ErrLocalIncompatibleOrStale = errors.New("local incompatible or needs update")
+)
+
+// timestampThreshold - forks after this value are activated by time, see EIP-6122
+const timestampThreshold = 1438269973
+
+// ForkID - fork identifier of EIP-2124: CRC32 of genesis hash and passed forks, and the next scheduled fork (0 - none)
+type ForkID struct {
+	Hash [4]byte
+	Next uint64
+}
+
+// Forks - blocks and times (after genesis) of forks for fork id: deduplicated, sorted, without forks of genesis
+func (c *Config) Forks(genesisTime uint64) (heights, times []uint64) {
+	for _, f := range c.blockForks() {
+		if f.activate != nil && f.activate.IsUint64() && f.activate.Uint64() > 0 {
+			heights = append(heights, f.activate.Uint64())
+		}
+	}
+	for _, f := range c.timeForks() {
+		if f.activate != nil && f.activate.IsUint64() && f.activate.Uint64() > genesisTime {
+			times = append(times, f.activate.Uint64())
+		}
+	}
+	return dedup(heights), dedup(times)
+}
+
+func dedup(forks []uint64) []uint64 {
+	sort.Slice(forks, func(i, j int) bool { return forks[i] < forks[j] })
+	res := forks[:0]
+	for i, f := range forks {
+		if i == 0 || forks[i-1] != f {
+			res = append(res, f)
+		}
+	}
+	return res
+}
+
+func checksumUpdate(hash uint32, fork uint64) uint32 {
+	var blob [8]byte
+	binary.BigEndian.PutUint64(blob[:], fork)
+	return crc32.Update(hash, crc32.IEEETable, blob[:])
+}
+
+func checksumToBytes(hash uint32) (b [4]byte) {
+	binary.BigEndian.PutUint32(b[:], hash)
+	return b
+}
+
+// NewForkID - fork id of chain at given head block and time
+func NewForkID(c *Config, genesisHash common.Hash, genesisTime, headNum, headTime uint64) ForkID {
+	heights, times := c.Forks(genesisTime)
+	hash := crc32.ChecksumIEEE(genesisHash[:])
+	for _, fork := range heights {
+		if fork > headNum {
+			return ForkID{Hash: checksumToBytes(hash), Next: fork}
+		}
+		hash = checksumUpdate(hash, fork)
+	}
+	for _, fork := range times {
+		if fork > headTime {
+			return ForkID{Hash: checksumToBytes(hash), Next: fork}
+		}
+		hash = checksumUpdate(hash, fork)
+	}
+	return ForkID{Hash: checksumToBytes(hash)}
+}
+
+// NewForkFilter - validator of fork ids of remote peers by rules of EIP-2124, head returns current head block and time
+func NewForkFilter(c *Config, genesisHash common.Hash, genesisTime uint64, head func() (num, time uint64)) func(ForkID) error {
+	heights, times := c.Forks(genesisTime)
+	forks := append(append([]uint64{}, heights...), times...)
+	sums := make([][4]byte, len(forks)+1) // 0 - genesis
+	hash := crc32.ChecksumIEEE(genesisHash[:])
+	sums[0] = checksumToBytes(hash)
+	for i, fork := range forks {
+		hash = checksumUpdate(hash, fork)
+		sums[i+1] = checksumToBytes(hash)
+	}
+	forks = append(forks, math.MaxUint64) // last fork will never be passed
+
+	return func(id ForkID) error {
+		headNum, headTime := head()
+		for i, fork := range forks {
+			passed := headNum
+			if i >= len(heights) {
+				passed = headTime
+			}
+			if passed >= fork {
+				continue
+			}
+			// first not passed fork: remote is at the same state (rule 1), but must not announce a fork we've passed (1a)
+			if sums[i] == id.Hash {
+				if id.Next > 0 && (headNum >= id.Next || (id.Next > timestampThreshold && headTime >= id.Next)) {
+					return ErrLocalIncompatibleOrStale
+				}
+				return nil
+			}
+			// remote is at one of our past states (rule 2), it must be aware of the fork which followed
+			for j := 0; j < i; j++ {
+				if sums[j] == id.Hash {
+					if forks[j] != id.Next {
+						return ErrRemoteStale
+					}
+					return nil
+				}
+			}
+			// remote is at one of our future states - we are syncing (rule 3)
+			for j := i + 1; j < len(sums); j++ {
+				if sums[j] == id.Hash {
+					return nil
+				}
+			}
+			return ErrLocalIncompatibleOrStale
+		}
+		return nil
+	}
+}
@@ -0,0 +1,87 @@
+/*
+   Copyright 2021 Erigon contributors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package chain
+
+import (
+	"encoding/hex"
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+var mainnetGenesisHash = func() (h [32]byte) {
+	b, _ := hex.DecodeString("d4e56740f876aef8c010b86a40d5f56745a118d0906a34e69aec8c0db1cb8fa3")
+	copy(h[:], b)
+	return h
+}()
+
+func id(hash uint32, next uint64) ForkID { return ForkID{Hash: checksumToBytes(hash), Next: next} }
+
+func TestForkID(t *testing.T) {
+	require := require.New(t)
+	cfg, err := FromJSON([]byte(testGenesis))
+	require.NoError(err)
+	for _, tt := range []struct {
+		num, time uint64
+		want      ForkID
+	}{
+		{0, 0, id(0xfc64ec04, 1150000)},
+		{1149999, 0, id(0xfc64ec04, 1150000)},
+		{1150000, 0, id(0x97c2c34c, 1920000)},
+		{1920000, 0, id(0x91d1f948, 2463000)},
+		{2463000, 0, id(0x7a64da13, 2675000)},
+		{2675000, 0, id(0x3edd5b10, 4370000)},
+		{4370000, 0, id(0xa00bc324, 7280000)},
+		{7280000, 0, id(0x668db0af, 9069000)},
+		{9069000, 0, id(0x879d6e30, 9200000)},
+		{9200000, 0, id(0xe029e991, 12244000)},
+		{12244000, 0, id(0x0eb440f6, 12965000)},
+		{12965000, 0, id(0xb715077d, 13773000)},
+		{13773000, 0, id(0x20c327fc, 15050000)},
+		{15050000, 0, id(0xf0afd0e3, 1681338455)},
+		{20000000, 1681338455, id(0xdce96c2d, 1710338135)},
+		{20000000, 1710338135, id(0x9f3d2254, 0)},
+	} {
+		require.Equal(tt.want, NewForkID(cfg, mainnetGenesisHash, 0, tt.num, tt.time), tt.num)
+	}
+}
+
+func TestForkFilter(t *testing.T) {
+	require := require.New(t)
+	cfg, err := FromJSON([]byte(testGenesis))
+	require.NoError(err)
+	var headNum, headTime uint64
+	filter := NewForkFilter(cfg, mainnetGenesisHash, 0, func() (uint64, uint64) { return headNum, headTime })
+
+	headNum = 7987396 // Petersburg
+
+	require.NoError(filter(id(0x668db0af, 0)))              // same fork, no next fork known
+	require.NoError(filter(id(0x668db0af, math.MaxUint64))) // same fork, next fork in far future
+	require.NoError(filter(id(0xa00bc324, 7280000)))        // remote is at Byzantium and knows about Petersburg
+	require.NoError(filter(id(0x3edd5b10, 4370000)))        // remote is at Spurious Dragon and knows about Byzantium
+	require.NoError(filter(id(0xe029e991, 12244000)))       // remote is ahead of us, we are syncing
+	require.Equal(ErrRemoteStale, filter(id(0xa00bc324, 0)))
+	require.Equal(ErrLocalIncompatibleOrStale, filter(id(0x668db0af, 7279999))) // remote announces fork we've passed
+	require.Equal(ErrLocalIncompatibleOrStale, filter(id(0x5cddc0e1, 0)))       // other chain
+
+	headNum, headTime = 20000000, 1710338135
+	require.NoError(filter(id(0x9f3d2254, 0)))
+	require.NoError(filter(id(0xdce96c2d, 1710338135)))
+	require.Equal(ErrRemoteStale, filter(id(0xdce96c2d, 0)))
+	require.Equal(ErrLocalIncompatibleOrStale, filter(id(0x9f3d2254, 1710338135)))
+}
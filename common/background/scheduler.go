@@ -0,0 +1,302 @@
+/*
+   Copyright 2021 Erigon contributors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+// Package background - scheduler of periodic jobs of a process: flushes, evictions, log rotation, merges, etc...
+// Jobs run in own goroutines with jittered intervals (to not wake up at same moment), report their health and are
+// stopped by one Stop - in dependency order, each job after all jobs which depend on it.
+package background
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/ledgerwatch/erigon-lib/common/clock"
+	"github.com/ledgerwatch/erigon-lib/common/parallel"
+	"github.com/ledgerwatch/log/v3"
+)
+
+var (
+	ErrStarted = errors.New("scheduler already started")
+	ErrStopped = errors.New("scheduler stopped")
+)
+
+// Job - Run is called every Every (+/- Every*Jitter), runs of one job never overlap.
+// After - names of jobs this one depends on: they are started before it and stopped after it.
+// Final - optional, called once by Stop after last Run: to drain state, for example last flush
+type Job struct {
+	Name   string
+	Every  time.Duration
+	Jitter float64 // fraction of Every, [0, 1)
+	After  []string
+	Run    func(ctx context.Context) error
+	Final  func(ctx context.Context) error
+}
+
+// Status - health of job. Healthy: last run succeeded and next one is not late more than by interval
+type Status struct {
+	Name         string
+	Runs         uint64
+	Failures     uint64
+	LastRun      time.Time // start of last run
+	LastDuration time.Duration
+	LastErr      error
+	Running      bool
+	Stopped      bool
+	Healthy      bool
+}
+
+type job struct {
+	Job
+	started time.Time
+	status  Status // guarded by Scheduler.lock
+	stop    chan struct{}
+	done    chan struct{}
+	cancel  context.CancelFunc
+}
+
+type Scheduler struct {
+	log     log.Logger
+	clock   clock.Clock
+	lock    sync.Mutex
+	jobs    []*job // in order of Add
+	byName  map[string]*job
+	order   []*job // dependencies first, set by Start
+	started bool
+	stopped bool
+}
+
+// New - logger may be nil: root logger is used then
+func New(logger log.Logger) *Scheduler {
+	if logger == nil {
+		logger = log.Root()
+	}
+	return &Scheduler{log: logger, clock: clock.Real, byName: map[string]*job{}}
+}
+
+// SetClock - source of time for intervals and statuses of jobs, must be called before Start. nil - clock.Real
+func (s *Scheduler) SetClock(c clock.Clock) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.clock = clock.Or(c)
+}
+
+// Add - registers job, must be called before Start
+func (s *Scheduler) Add(j Job) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	switch {
+	case s.started:
+		return ErrStarted
+	case j.Name == "":
+		return fmt.Errorf("background: job without name")
+	case j.Every <= 0:
+		return fmt.Errorf("background: job %s: interval must be positive, got %s", j.Name, j.Every)
+	case j.Jitter < 0 || j.Jitter >= 1:
+		return fmt.Errorf("background: job %s: jitter must be in [0, 1), got %f", j.Name, j.Jitter)
+	case j.Run == nil:
+		return fmt.Errorf("background: job %s: Run is nil", j.Name)
+	}
+	if _, ok := s.byName[j.Name]; ok {
+		return fmt.Errorf("background: job %s already added", j.Name)
+	}
+	jb := &job{Job: j, status: Status{Name: j.Name}, stop: make(chan struct{}), done: make(chan struct{})}
+	s.jobs = append(s.jobs, jb)
+	s.byName[j.Name] = jb
+	return nil
+}
+
+// Start - checks dependencies and starts jobs, dependencies first. Cancellation of ctx stops runs of jobs,
+// but Stop must be called anyway - it calls Final of jobs
+func (s *Scheduler) Start(ctx context.Context) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.started {
+		return ErrStarted
+	}
+	order, err := s.sort()
+	if err != nil {
+		return err
+	}
+	s.order, s.started = order, true
+	now := s.clock.Now()
+	for _, j := range s.order {
+		var jobCtx context.Context
+		jobCtx, j.cancel = context.WithCancel(ctx)
+		j.started = now
+		go s.loop(jobCtx, j)
+	}
+	return nil
+}
+
+// sort - topological order of jobs: dependencies first, otherwise in order of Add
+func (s *Scheduler) sort() ([]*job, error) {
+	const (
+		visiting = 1
+		visited  = 2
+	)
+	state := map[*job]int{}
+	order := make([]*job, 0, len(s.jobs))
+	var visit func(j *job, path []string) error
+	visit = func(j *job, path []string) error {
+		switch state[j] {
+		case visited:
+			return nil
+		case visiting:
+			return fmt.Errorf("background: dependency cycle: %v", append(path, j.Name))
+		}
+		state[j] = visiting
+		for _, name := range j.After {
+			dep, ok := s.byName[name]
+			if !ok {
+				return fmt.Errorf("background: job %s depends on unknown job %s", j.Name, name)
+			}
+			if err := visit(dep, append(path, j.Name)); err != nil {
+				return err
+			}
+		}
+		state[j] = visited
+		order = append(order, j)
+		return nil
+	}
+	for _, j := range s.jobs {
+		if err := visit(j, nil); err != nil {
+			return nil, err
+		}
+	}
+	return order, nil
+}
+
+func (s *Scheduler) loop(ctx context.Context, j *job) {
+	defer close(j.done)
+	timer := s.clock.NewTimer(j.interval())
+	defer timer.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-j.stop:
+			return
+		case <-timer.C():
+		}
+		s.run(ctx, j)
+		timer.Reset(j.interval())
+	}
+}
+
+func (j *job) interval() time.Duration {
+	if j.Jitter == 0 {
+		return j.Every
+	}
+	spread := int64(float64(j.Every) * j.Jitter)
+	if spread <= 0 {
+		return j.Every
+	}
+	return j.Every - time.Duration(spread) + time.Duration(rand.Int63n(2*spread+1)) // nolint:gosec
+}
+
+func (s *Scheduler) run(ctx context.Context, j *job) {
+	start := s.clock.Now()
+	s.lock.Lock()
+	j.status.Running, j.status.LastRun = true, start
+	s.lock.Unlock()
+
+	err := parallel.Call(ctx, j.Run)
+
+	s.lock.Lock()
+	j.status.Running, j.status.LastDuration, j.status.LastErr = false, s.clock.Now().Sub(start), err
+	j.status.Runs++
+	if err != nil {
+		j.status.Failures++
+	}
+	s.lock.Unlock()
+	if err != nil && ctx.Err() == nil {
+		s.log.Warn("[background] job failed", "job", j.Name, "err", err)
+	}
+}
+
+// Stop - stops jobs in reverse dependency order: waits for current run of job, then calls its Final.
+// If ctx is done before - current run is canceled. Returns first error of Final or of waiting
+func (s *Scheduler) Stop(ctx context.Context) error {
+	s.lock.Lock()
+	if !s.started || s.stopped {
+		s.stopped = true
+		s.lock.Unlock()
+		return nil
+	}
+	s.stopped = true
+	order := s.order
+	s.lock.Unlock()
+
+	var firstErr error
+	for i := len(order) - 1; i >= 0; i-- {
+		j := order[i]
+		close(j.stop)
+		select {
+		case <-j.done:
+		case <-ctx.Done():
+			j.cancel()
+			<-j.done
+			if firstErr == nil {
+				firstErr = fmt.Errorf("background: stop of job %s: %w", j.Name, ctx.Err())
+			}
+		}
+		j.cancel()
+		if j.Final != nil {
+			if err := parallel.Call(ctx, j.Final); err != nil {
+				s.log.Warn("[background] job final run failed", "job", j.Name, "err", err)
+				if firstErr == nil {
+					firstErr = fmt.Errorf("background: final run of job %s: %w", j.Name, err)
+				}
+			}
+		}
+		s.lock.Lock()
+		j.status.Stopped = true
+		s.lock.Unlock()
+	}
+	return firstErr
+}
+
+// Status - health of all jobs, in order of Add
+func (s *Scheduler) Status() []Status {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	now := s.clock.Now()
+	res := make([]Status, len(s.jobs))
+	for i, j := range s.jobs {
+		res[i] = j.status
+		last := j.status.LastRun
+		if last.IsZero() {
+			last = j.started
+		}
+		late := s.started && !j.status.Stopped && !j.status.Running && now.Sub(last) > 2*j.Every
+		res[i].Healthy = j.status.LastErr == nil && !late
+	}
+	return res
+}
+
+// Healthy - all jobs are healthy
+func (s *Scheduler) Healthy() bool {
+	for _, st := range s.Status() {
+		if !st.Healthy {
+			return false
+		}
+	}
+	return true
+}
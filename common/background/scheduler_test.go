@@ -0,0 +1,164 @@
+/*
+   Copyright 2021 Erigon contributors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package background
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ledgerwatch/erigon-lib/common/clock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestScheduler(t *testing.T) {
+	require := require.New(t)
+	s := New(nil)
+	var lock sync.Mutex
+	var events []string
+	event := func(e string) {
+		lock.Lock()
+		defer lock.Unlock()
+		events = append(events, e)
+	}
+	var dbRuns, flushRuns int64
+	require.NoError(s.Add(Job{Name: "flush", Every: time.Millisecond, Jitter: 0.5, After: []string{"db"},
+		Run:   func(ctx context.Context) error { atomic.AddInt64(&flushRuns, 1); return nil },
+		Final: func(ctx context.Context) error { event("flush"); return nil },
+	}))
+	require.NoError(s.Add(Job{Name: "db", Every: time.Millisecond,
+		Run:   func(ctx context.Context) error { atomic.AddInt64(&dbRuns, 1); return nil },
+		Final: func(ctx context.Context) error { event("db"); return nil },
+	}))
+	require.Error(s.Add(Job{Name: "db", Every: time.Second, Run: func(ctx context.Context) error { return nil }}))
+	require.Error(s.Add(Job{Name: "x", Every: time.Second, Jitter: 1, Run: func(ctx context.Context) error { return nil }}))
+	require.NoError(s.Start(context.Background()))
+	require.Equal(ErrStarted, s.Add(Job{Name: "late", Every: time.Second, Run: func(ctx context.Context) error { return nil }}))
+
+	require.Eventually(func() bool { return atomic.LoadInt64(&dbRuns) > 2 && atomic.LoadInt64(&flushRuns) > 2 }, time.Second, time.Millisecond)
+	for _, st := range s.Status() {
+		require.NoError(st.LastErr)
+		require.NotZero(st.Runs)
+	}
+	require.NoError(s.Stop(context.Background()))
+	require.Equal([]string{"flush", "db"}, events) // dependent job is stopped first
+	for _, st := range s.Status() {
+		require.True(st.Stopped)
+		require.False(st.Running)
+	}
+	require.NoError(s.Stop(context.Background()))
+}
+
+func TestSchedulerFailures(t *testing.T) {
+	require := require.New(t)
+	s := New(nil)
+	require.NoError(s.Add(Job{Name: "hourly", Every: time.Hour, Run: func(ctx context.Context) error { return nil }}))
+	require.NoError(s.Start(context.Background()))
+	require.True(s.Healthy()) // not run yet, but not late
+	require.NoError(s.Stop(context.Background()))
+
+	s = New(nil)
+	errTest := errors.New("test")
+	var runs int64
+	require.NoError(s.Add(Job{Name: "a", Every: time.Millisecond, Run: func(ctx context.Context) error {
+		if atomic.AddInt64(&runs, 1) == 1 {
+			panic("boom")
+		}
+		return errTest
+	}}))
+	require.NoError(s.Start(context.Background()))
+	require.Eventually(func() bool { return s.Status()[0].Failures >= 2 }, time.Second, time.Millisecond)
+	require.False(s.Healthy())
+	require.NoError(s.Stop(context.Background()))
+	require.Equal(errTest, s.Status()[0].LastErr)
+
+	// slow run is canceled when stop deadline exceeded
+	s = New(nil)
+	started := make(chan struct{})
+	require.NoError(s.Add(Job{Name: "slow", Every: time.Millisecond, Run: func(ctx context.Context) error {
+		select {
+		case started <- struct{}{}:
+		default:
+		}
+		<-ctx.Done()
+		return ctx.Err()
+	}}))
+	require.NoError(s.Start(context.Background()))
+	<-started
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	require.True(errors.Is(s.Stop(ctx), context.DeadlineExceeded))
+}
+
+func TestSchedulerDependencies(t *testing.T) {
+	run := func(ctx context.Context) error { return nil }
+	s := New(nil)
+	require.NoError(t, s.Add(Job{Name: "a", Every: time.Second, After: []string{"b"}, Run: run}))
+	require.NoError(t, s.Add(Job{Name: "b", Every: time.Second, After: []string{"a"}, Run: run}))
+	require.Error(t, s.Start(context.Background()))
+
+	s = New(nil)
+	require.NoError(t, s.Add(Job{Name: "a", Every: time.Second, After: []string{"unknown"}, Run: run}))
+	require.Error(t, s.Start(context.Background()))
+
+	s = New(nil)
+	for _, j := range []Job{{Name: "c", After: []string{"b", "a"}}, {Name: "b", After: []string{"a"}}, {Name: "a"}} {
+		j.Every, j.Run = time.Second, run
+		require.NoError(t, s.Add(j))
+	}
+	order, err := s.sort()
+	require.NoError(t, err)
+	var names []string
+	for _, j := range order {
+		names = append(names, j.Name)
+	}
+	require.Equal(t, []string{"a", "b", "c"}, names)
+
+	j := &job{Job: Job{Every: 100 * time.Millisecond, Jitter: 0.2}}
+	for i := 0; i < 100; i++ {
+		d := j.interval()
+		require.True(t, d >= 80*time.Millisecond && d <= 120*time.Millisecond, "%s", d)
+	}
+}
+
+func TestSchedulerFakeClock(t *testing.T) {
+	require := require.New(t)
+	start := time.Unix(1_000_000, 0)
+	clk := clock.NewFake(start)
+	s := New(nil)
+	s.SetClock(clk)
+	var runs int64
+	require.NoError(s.Add(Job{Name: "minutely", Every: time.Minute, Run: func(ctx context.Context) error {
+		atomic.AddInt64(&runs, 1)
+		return nil
+	}}))
+	require.NoError(s.Start(context.Background()))
+	for i := 1; i <= 3; i++ {
+		clk.BlockUntil(1) // job waits for its timer
+		clk.Advance(time.Minute)
+		clk.BlockUntil(1) // timer is armed again after run
+		require.Equal(int64(i), atomic.LoadInt64(&runs))
+		require.Equal(start.Add(time.Duration(i)*time.Minute), s.Status()[0].LastRun)
+	}
+	clk.Advance(59 * time.Second)
+	require.Equal(int64(3), atomic.LoadInt64(&runs))
+	require.True(s.Healthy())
+	require.NoError(s.Stop(context.Background()))
+}
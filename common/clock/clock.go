@@ -0,0 +1,196 @@
+/*
+   Copyright 2021 Erigon contributors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+// Package clock - source of time for timers of long-living components (txpool, background jobs).
+// Tests replace Real by Fake and move time by Advance - time-dependent behaviour is tested without sleeps.
+package clock
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+type Clock interface {
+	Now() time.Time
+	NewTimer(d time.Duration) Timer
+	NewTicker(d time.Duration) Ticker // d must be positive, as for time.NewTicker
+}
+
+// Timer - as time.Timer
+type Timer interface {
+	C() <-chan time.Time
+	Stop() bool
+	Reset(d time.Duration) bool
+}
+
+// Ticker - as time.Ticker
+type Ticker interface {
+	C() <-chan time.Time
+	Stop()
+}
+
+// Real - clock of package time
+var Real Clock = realClock{}
+
+// Or - c, or Real if c is nil
+func Or(c Clock) Clock {
+	if c == nil {
+		return Real
+	}
+	return c
+}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time                   { return time.Now() }
+func (realClock) NewTimer(d time.Duration) Timer   { return realTimer{time.NewTimer(d)} }
+func (realClock) NewTicker(d time.Duration) Ticker { return realTicker{time.NewTicker(d)} }
+
+type realTimer struct{ t *time.Timer }
+
+func (t realTimer) C() <-chan time.Time        { return t.t.C }
+func (t realTimer) Stop() bool                 { return t.t.Stop() }
+func (t realTimer) Reset(d time.Duration) bool { return t.t.Reset(d) }
+
+type realTicker struct{ t *time.Ticker }
+
+func (t realTicker) C() <-chan time.Time { return t.t.C }
+func (t realTicker) Stop()               { t.t.Stop() }
+
+// Fake - clock which stands still until Advance. Channels of timers and tickers have buffer of 1 value,
+// as in package time: ticks which are not received are dropped
+type Fake struct {
+	lock    sync.Mutex
+	cond    *sync.Cond
+	now     time.Time
+	waiters []*fakeWaiter // armed timers and tickers
+}
+
+func NewFake(now time.Time) *Fake {
+	f := &Fake{now: now}
+	f.cond = sync.NewCond(&f.lock)
+	return f
+}
+
+func (f *Fake) Now() time.Time {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	return f.now
+}
+
+// Advance - moves time forward by d and fires timers and tickers which are due, in order of their deadlines
+func (f *Fake) Advance(d time.Duration) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	end := f.now.Add(d)
+	for len(f.waiters) > 0 {
+		sort.SliceStable(f.waiters, func(i, j int) bool { return f.waiters[i].at.Before(f.waiters[j].at) })
+		w := f.waiters[0]
+		if w.at.After(end) {
+			break
+		}
+		f.now = w.at
+		select {
+		case w.c <- w.at:
+		default:
+		}
+		if w.period > 0 {
+			w.at = w.at.Add(w.period)
+		} else {
+			f.disarm(w)
+		}
+	}
+	f.now = end
+}
+
+// Waiters - amount of armed timers and tickers
+func (f *Fake) Waiters() int {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	return len(f.waiters)
+}
+
+// BlockUntil - waits till at least n timers and tickers are armed. Synchronizes test with goroutine under test:
+// after it, the goroutine waits for its timer and Advance will fire it
+func (f *Fake) BlockUntil(n int) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	for len(f.waiters) < n {
+		f.cond.Wait()
+	}
+}
+
+func (f *Fake) NewTimer(d time.Duration) Timer {
+	w := &fakeWaiter{f: f, c: make(chan time.Time, 1)}
+	w.Reset(d)
+	return w
+}
+
+func (f *Fake) NewTicker(d time.Duration) Ticker {
+	if d <= 0 {
+		panic("clock: non-positive interval for NewTicker")
+	}
+	w := &fakeWaiter{f: f, c: make(chan time.Time, 1), period: d}
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	f.arm(w, d)
+	return fakeTicker{w}
+}
+
+func (f *Fake) arm(w *fakeWaiter, d time.Duration) (wasArmed bool) {
+	w.at = f.now.Add(d)
+	wasArmed = f.disarm(w)
+	f.waiters = append(f.waiters, w)
+	f.cond.Broadcast()
+	return wasArmed
+}
+
+func (f *Fake) disarm(w *fakeWaiter) (wasArmed bool) {
+	for i := range f.waiters {
+		if f.waiters[i] == w {
+			f.waiters = append(f.waiters[:i], f.waiters[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+type fakeWaiter struct {
+	f      *Fake
+	c      chan time.Time
+	at     time.Time
+	period time.Duration // 0 - timer
+}
+
+func (w *fakeWaiter) C() <-chan time.Time { return w.c }
+
+func (w *fakeWaiter) Stop() bool {
+	w.f.lock.Lock()
+	defer w.f.lock.Unlock()
+	return w.f.disarm(w)
+}
+
+func (w *fakeWaiter) Reset(d time.Duration) bool {
+	w.f.lock.Lock()
+	defer w.f.lock.Unlock()
+	return w.f.arm(w, d)
+}
+
+type fakeTicker struct{ w *fakeWaiter }
+
+func (t fakeTicker) C() <-chan time.Time { return t.w.c }
+func (t fakeTicker) Stop()               { t.w.Stop() }
@@ -0,0 +1,77 @@
+/*
+   Copyright 2021 Erigon contributors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package clock
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func received(c <-chan time.Time) (time.Time, bool) {
+	select {
+	case t := <-c:
+		return t, true
+	default:
+		return time.Time{}, false
+	}
+}
+
+func TestFake(t *testing.T) {
+	require := require.New(t)
+	start := time.Unix(1_000_000, 0)
+	f := NewFake(start)
+	timer := f.NewTimer(time.Minute)
+	ticker := f.NewTicker(10 * time.Second)
+	require.Equal(2, f.Waiters())
+
+	f.Advance(59 * time.Second)
+	require.Equal(start.Add(59*time.Second), f.Now())
+	_, ok := received(timer.C())
+	require.False(ok)
+	// 5 ticks due, only 1 is buffered - as time.Ticker
+	tick, ok := received(ticker.C())
+	require.True(ok)
+	require.Equal(start.Add(10*time.Second), tick)
+	_, ok = received(ticker.C())
+	require.False(ok)
+
+	f.Advance(time.Second)
+	fired, ok := received(timer.C())
+	require.True(ok)
+	require.Equal(start.Add(time.Minute), fired)
+	require.Equal(1, f.Waiters())
+	require.False(timer.Stop())
+
+	require.False(timer.Reset(time.Second))
+	require.True(timer.Stop())
+	ticker.Stop()
+	require.Equal(0, f.Waiters())
+	f.Advance(time.Hour)
+	_, ok = received(timer.C())
+	require.False(ok)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		<-f.NewTimer(time.Second).C()
+	}()
+	f.BlockUntil(1)
+	f.Advance(time.Second)
+	<-done
+}
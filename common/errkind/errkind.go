@@ -0,0 +1,73 @@
+/*
+   Copyright 2021 Erigon contributors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+// Package errkind - kinds of errors returned by packages of the library. Check them by errors.Is(err, errkind.NotFound)
+// instead of matching error messages: messages are for humans and may change.
+package errkind
+
+import (
+	"errors"
+	"fmt"
+)
+
+var (
+	NotFound        = errors.New("not found")        // table, key, position or file doesn't exist
+	Corrupted       = errors.New("corrupted")        // stored data is damaged, retry will not help
+	Canceled        = errors.New("canceled")         // context canceled or deadline exceeded
+	TooBig          = errors.New("too big")          // value, message or database exceeds limit
+	InvalidEncoding = errors.New("invalid encoding") // payload is malformed: rlp, transaction, etc...
+)
+
+var kinds = []error{NotFound, Corrupted, Canceled, TooBig, InvalidEncoding}
+
+// kindError - keeps message of wrapped error as is, only adds kind to it
+type kindError struct {
+	kind error
+	err  error
+}
+
+func (e *kindError) Error() string        { return e.err.Error() }
+func (e *kindError) Unwrap() error        { return e.err }
+func (e *kindError) Is(target error) bool { return target == e.kind }
+
+// Wrap - marks err as error of given kind, message of err is unchanged. Returns nil if err is nil
+func Wrap(kind, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &kindError{kind: kind, err: err}
+}
+
+// New - error of given kind with given message
+func New(kind error, text string) error { return &kindError{kind: kind, err: errors.New(text)} }
+
+// Errorf - like fmt.Errorf (supports %w), result is error of given kind
+func Errorf(kind error, format string, args ...interface{}) error {
+	return &kindError{kind: kind, err: fmt.Errorf(format, args...)}
+}
+
+// Of - kind of err, nil if err has no kind. If kinds are nested, the outermost one is returned
+func Of(err error) error {
+	for ; err != nil; err = errors.Unwrap(err) {
+		x, hasIs := err.(interface{ Is(error) bool })
+		for _, kind := range kinds {
+			if err == kind || (hasIs && x.Is(kind)) {
+				return kind
+			}
+		}
+	}
+	return nil
+}
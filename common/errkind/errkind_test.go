@@ -0,0 +1,52 @@
+/*
+   Copyright 2021 Erigon contributors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package errkind
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestKinds(t *testing.T) {
+	require := require.New(t)
+	require.Nil(Wrap(NotFound, nil))
+	require.Nil(Of(nil))
+	require.Nil(Of(errors.New("no kind")))
+
+	err := Wrap(Canceled, context.Canceled)
+	require.Equal("context canceled", err.Error())
+	require.True(errors.Is(err, Canceled))
+	require.True(errors.Is(err, context.Canceled))
+	require.False(errors.Is(err, NotFound))
+
+	wrapped := fmt.Errorf("table: %s, %w", "X", New(NotFound, "unknown bucket"))
+	require.Equal("table: X, unknown bucket", wrapped.Error())
+	require.True(errors.Is(wrapped, NotFound))
+	require.Equal(NotFound, Of(wrapped))
+
+	inner := Errorf(TooBig, "value len %d", 10)
+	outer := Errorf(InvalidEncoding, "parse: %w", inner)
+	require.Equal("parse: value len 10", outer.Error())
+	require.True(errors.Is(outer, InvalidEncoding))
+	require.True(errors.Is(outer, TooBig))
+	require.Equal(InvalidEncoding, Of(outer))
+	require.Equal(Corrupted, Of(fmt.Errorf("x: %w", Corrupted)))
+}
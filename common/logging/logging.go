@@ -0,0 +1,175 @@
+/*
+   Copyright 2021 Erigon contributors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+// Package logging - logger interface used by packages of the library. Embedder routes logs to its own backend
+// (ledgerwatch/log, slog, zap, ...) and controls levels by passing Logger to constructors or by SetRoot.
+// Context is list of key/value pairs, as in ledgerwatch/log: logger.Info("msg", "key", value).
+package logging
+
+import (
+	"sync/atomic"
+
+	"github.com/ledgerwatch/log/v3"
+)
+
+type Level int
+
+const (
+	LvlError Level = iota + 1
+	LvlWarn
+	LvlInfo
+	LvlDebug
+	LvlTrace
+)
+
+func (l Level) String() string {
+	switch l {
+	case LvlError:
+		return "error"
+	case LvlWarn:
+		return "warn"
+	case LvlInfo:
+		return "info"
+	case LvlDebug:
+		return "debug"
+	case LvlTrace:
+		return "trace"
+	default:
+		return "unknown"
+	}
+}
+
+type Logger interface {
+	New(ctx ...interface{}) Logger // New - logger which adds ctx to every record
+
+	Trace(msg string, ctx ...interface{})
+	Debug(msg string, ctx ...interface{})
+	Info(msg string, ctx ...interface{})
+	Warn(msg string, ctx ...interface{})
+	Error(msg string, ctx ...interface{})
+}
+
+type rootHolder struct{ Logger }
+
+var root atomic.Value
+
+func init() { root.Store(rootHolder{FromLog(log.Root())}) }
+
+// Root - default logger of the library, used when constructor got no logger. Routes to log.Root() of ledgerwatch/log by default
+func Root() Logger { return root.Load().(rootHolder).Logger }
+
+// SetRoot - replaces default logger. Components capture logger when created: call it before creating them
+func SetRoot(l Logger) { root.Store(rootHolder{l}) }
+
+// OrRoot - l, or Root() if l is nil
+func OrRoot(l Logger) Logger {
+	if l == nil {
+		return Root()
+	}
+	return l
+}
+
+// Func - adapter for any backend: every record goes to f. For example logrus:
+//
+//	logging.Func(func(lvl logging.Level, msg string, ctx []interface{}) {
+//		logrus.WithFields(fields(ctx)).Log(logrusLevel(lvl), msg)
+//	})
+type Func func(lvl Level, msg string, ctx []interface{})
+
+func (f Func) New(ctx ...interface{}) Logger {
+	return Func(func(lvl Level, msg string, more []interface{}) {
+		f(lvl, msg, append(append(make([]interface{}, 0, len(ctx)+len(more)), ctx...), more...))
+	})
+}
+func (f Func) Trace(msg string, ctx ...interface{}) { f(LvlTrace, msg, ctx) }
+func (f Func) Debug(msg string, ctx ...interface{}) { f(LvlDebug, msg, ctx) }
+func (f Func) Info(msg string, ctx ...interface{})  { f(LvlInfo, msg, ctx) }
+func (f Func) Warn(msg string, ctx ...interface{})  { f(LvlWarn, msg, ctx) }
+func (f Func) Error(msg string, ctx ...interface{}) { f(LvlError, msg, ctx) }
+
+// Discard - logger which drops everything
+func Discard() Logger { return Func(func(Level, string, []interface{}) {}) }
+
+// WithLevel - l which drops records less important than lvl
+func WithLevel(l Logger, lvl Level) Logger { return &leveled{l: l, lvl: lvl} }
+
+type leveled struct {
+	l   Logger
+	lvl Level
+}
+
+func (l *leveled) New(ctx ...interface{}) Logger { return &leveled{l: l.l.New(ctx...), lvl: l.lvl} }
+func (l *leveled) Trace(msg string, ctx ...interface{}) {
+	if l.lvl >= LvlTrace {
+		l.l.Trace(msg, ctx...)
+	}
+}
+func (l *leveled) Debug(msg string, ctx ...interface{}) {
+	if l.lvl >= LvlDebug {
+		l.l.Debug(msg, ctx...)
+	}
+}
+func (l *leveled) Info(msg string, ctx ...interface{}) {
+	if l.lvl >= LvlInfo {
+		l.l.Info(msg, ctx...)
+	}
+}
+func (l *leveled) Warn(msg string, ctx ...interface{}) {
+	if l.lvl >= LvlWarn {
+		l.l.Warn(msg, ctx...)
+	}
+}
+func (l *leveled) Error(msg string, ctx ...interface{}) {
+	if l.lvl >= LvlError {
+		l.l.Error(msg, ctx...)
+	}
+}
+
+// FromLog - adapter of ledgerwatch/log logger
+func FromLog(l log.Logger) Logger { return logLogger{l} }
+
+type logLogger struct{ l log.Logger }
+
+func (l logLogger) New(ctx ...interface{}) Logger        { return logLogger{l.l.New(ctx...)} }
+func (l logLogger) Trace(msg string, ctx ...interface{}) { l.l.Trace(msg, ctx...) }
+func (l logLogger) Debug(msg string, ctx ...interface{}) { l.l.Debug(msg, ctx...) }
+func (l logLogger) Info(msg string, ctx ...interface{})  { l.l.Info(msg, ctx...) }
+func (l logLogger) Warn(msg string, ctx ...interface{})  { l.l.Warn(msg, ctx...) }
+func (l logLogger) Error(msg string, ctx ...interface{}) { l.l.Error(msg, ctx...) }
+
+// ToLog - ledgerwatch/log logger which writes to l, for APIs which still accept log.Logger. Crit goes to Error
+func ToLog(l Logger) log.Logger {
+	if ll, ok := l.(logLogger); ok {
+		return ll.l
+	}
+	res := log.New()
+	res.SetHandler(log.FuncHandler(func(r *log.Record) error {
+		switch r.Lvl {
+		case log.LvlCrit, log.LvlError:
+			l.Error(r.Msg, r.Ctx...)
+		case log.LvlWarn:
+			l.Warn(r.Msg, r.Ctx...)
+		case log.LvlInfo:
+			l.Info(r.Msg, r.Ctx...)
+		case log.LvlDebug:
+			l.Debug(r.Msg, r.Ctx...)
+		default:
+			l.Trace(r.Msg, r.Ctx...)
+		}
+		return nil
+	}))
+	return res
+}
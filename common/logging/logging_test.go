@@ -0,0 +1,82 @@
+/*
+   Copyright 2021 Erigon contributors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package logging
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+type recorder []string
+
+func (r *recorder) logger() Logger {
+	return Func(func(lvl Level, msg string, ctx []interface{}) {
+		*r = append(*r, fmt.Sprintf("%s %s %v", lvl, msg, ctx))
+	})
+}
+
+func TestLogger(t *testing.T) {
+	require := require.New(t)
+	var r recorder
+	l := WithLevel(r.logger(), LvlInfo).New("id", 1)
+	l.Debug("dropped")
+	l.Info("kept", "k", "v")
+	l.Error("failed")
+	require.Equal([]string{"info kept [id 1 k v]", "error failed [id 1]"}, []string(r))
+
+	// ledgerwatch/log records are routed back, Crit is Error
+	r = nil
+	ll := ToLog(r.logger()).New("id", 2)
+	ll.Warn("warn", "k", "v")
+	ll.Crit("crit")
+	require.Equal([]string{"warn warn [id 2 k v]", "error crit [id 2]"}, []string(r))
+
+	// nil is Root()
+	r = nil
+	prev := Root()
+	defer SetRoot(prev)
+	SetRoot(r.logger())
+	OrRoot(nil).Info("root")
+	require.Equal([]string{"info root []"}, []string(r))
+}
+
+// sugar - methods of *zap.SugaredLogger
+type sugar []string
+
+func (s *sugar) Debugw(msg string, kv ...interface{}) {
+	*s = append(*s, fmt.Sprintf("debug %s %v", msg, kv))
+}
+func (s *sugar) Infow(msg string, kv ...interface{}) {
+	*s = append(*s, fmt.Sprintf("info %s %v", msg, kv))
+}
+func (s *sugar) Warnw(msg string, kv ...interface{}) {
+	*s = append(*s, fmt.Sprintf("warn %s %v", msg, kv))
+}
+func (s *sugar) Errorw(msg string, kv ...interface{}) {
+	*s = append(*s, fmt.Sprintf("error %s %v", msg, kv))
+}
+
+func TestZap(t *testing.T) {
+	var s sugar
+	l := FromZap(&s).New("id", 1)
+	l.Trace("trace")
+	l.New("k", "v").Warn("warn", "n", 2)
+	l.Error("failed")
+	require.Equal(t, []string{"debug trace [id 1]", "warn warn [id 1 k v n 2]", "error failed [id 1]"}, []string(s))
+}
@@ -0,0 +1,42 @@
+//go:build go1.21
+// +build go1.21
+
+/*
+   Copyright 2021 Erigon contributors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package logging
+
+import (
+	"context"
+	"log/slog"
+)
+
+// LevelTrace - slog level of Trace records, slog has no own
+const LevelTrace = slog.LevelDebug - 4
+
+// FromSlog - adapter of log/slog logger
+func FromSlog(l *slog.Logger) Logger { return slogLogger{l} }
+
+type slogLogger struct{ l *slog.Logger }
+
+func (l slogLogger) New(ctx ...interface{}) Logger { return slogLogger{l.l.With(ctx...)} }
+func (l slogLogger) Trace(msg string, ctx ...interface{}) {
+	l.l.Log(context.Background(), LevelTrace, msg, ctx...)
+}
+func (l slogLogger) Debug(msg string, ctx ...interface{}) { l.l.Debug(msg, ctx...) }
+func (l slogLogger) Info(msg string, ctx ...interface{})  { l.l.Info(msg, ctx...) }
+func (l slogLogger) Warn(msg string, ctx ...interface{})  { l.l.Warn(msg, ctx...) }
+func (l slogLogger) Error(msg string, ctx ...interface{}) { l.l.Error(msg, ctx...) }
@@ -0,0 +1,48 @@
+/*
+   Copyright 2021 Erigon contributors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package logging
+
+// ZapSugar - methods of *zap.SugaredLogger used by FromZap: library doesn't depend on zap
+type ZapSugar interface {
+	Debugw(msg string, keysAndValues ...interface{})
+	Infow(msg string, keysAndValues ...interface{})
+	Warnw(msg string, keysAndValues ...interface{})
+	Errorw(msg string, keysAndValues ...interface{})
+}
+
+// FromZap - adapter of zap logger: logging.FromZap(zapLogger.Sugar()). Zap has no Trace level - it goes to Debug
+func FromZap(l ZapSugar) Logger { return zapLogger{l: l} }
+
+type zapLogger struct {
+	l   ZapSugar
+	ctx []interface{} // of New: With of zap returns concrete type, which interface can't declare
+}
+
+func (l zapLogger) New(ctx ...interface{}) Logger {
+	return zapLogger{l: l.l, ctx: append(append(make([]interface{}, 0, len(l.ctx)+len(ctx)), l.ctx...), ctx...)}
+}
+func (l zapLogger) with(ctx []interface{}) []interface{} {
+	if len(l.ctx) == 0 {
+		return ctx
+	}
+	return append(append(make([]interface{}, 0, len(l.ctx)+len(ctx)), l.ctx...), ctx...)
+}
+func (l zapLogger) Trace(msg string, ctx ...interface{}) { l.l.Debugw(msg, l.with(ctx)...) }
+func (l zapLogger) Debug(msg string, ctx ...interface{}) { l.l.Debugw(msg, l.with(ctx)...) }
+func (l zapLogger) Info(msg string, ctx ...interface{})  { l.l.Infow(msg, l.with(ctx)...) }
+func (l zapLogger) Warn(msg string, ctx ...interface{})  { l.l.Warnw(msg, l.with(ctx)...) }
+func (l zapLogger) Error(msg string, ctx ...interface{}) { l.l.Errorw(msg, l.with(ctx)...) }
@@ -0,0 +1,247 @@
+/*
+   Copyright 2021 Erigon contributors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+// Package parallel - goroutine management shared by packages of the library: group of tasks with limit and first error
+// cancellation, parallel loop over indices, fan-in and fan-out of channels. Panics of tasks are recovered and returned
+// as *PanicError, cancellation is returned as error of kind errkind.Canceled.
+package parallel
+
+import (
+	"context"
+	"fmt"
+	"runtime/debug"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/VictoriaMetrics/metrics"
+	"github.com/ledgerwatch/erigon-lib/common/errkind"
+)
+
+// PanicError - panic of task, recovered together with stack of panicked goroutine
+type PanicError struct {
+	Value interface{}
+	Stack []byte
+}
+
+func (e *PanicError) Error() string { return fmt.Sprintf("panic: %v\n%s", e.Value, e.Stack) }
+
+// Group - like errgroup: runs tasks in own goroutines, first error (or panic) cancels context of group and is returned
+// by Wait. Limit > 0 bounds amount of running tasks: Go blocks until one of them finishes.
+// Named group reports duration of tasks to summary parallel_task{group="<name>"} and failed tasks to counter
+// parallel_task_errors{group="<name>"} of default VictoriaMetrics registry.
+type Group struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	sem    chan struct{}
+	wg     sync.WaitGroup
+
+	errOnce sync.Once
+	err     error
+
+	duration *metrics.Summary
+	errors   *metrics.Counter
+}
+
+// NewGroup - name may be empty: no metrics then. Returned context is canceled by first error or by Wait
+func NewGroup(ctx context.Context, name string, limit int) (*Group, context.Context) {
+	ctx, cancel := context.WithCancel(ctx)
+	g := &Group{ctx: ctx, cancel: cancel}
+	if limit > 0 {
+		g.sem = make(chan struct{}, limit)
+	}
+	if name != "" {
+		g.duration = metrics.GetOrCreateSummary(fmt.Sprintf(`parallel_task{group=%q}`, name))
+		g.errors = metrics.GetOrCreateCounter(fmt.Sprintf(`parallel_task_errors{group=%q}`, name))
+	}
+	return g, ctx
+}
+
+// Go - starts f in new goroutine. If group is already canceled - f is not started
+func (g *Group) Go(f func(ctx context.Context) error) {
+	if !g.acquire() {
+		g.fail(errkind.Wrap(errkind.Canceled, g.ctx.Err()))
+		return
+	}
+	g.wg.Add(1)
+	go func() {
+		defer g.wg.Done()
+		if g.sem != nil {
+			defer func() { <-g.sem }()
+		}
+		start := time.Now()
+		err := Call(g.ctx, f)
+		if g.duration != nil {
+			g.duration.UpdateDuration(start)
+		}
+		if err != nil {
+			if g.errors != nil {
+				g.errors.Inc()
+			}
+			g.fail(err)
+		}
+	}()
+}
+
+// acquire - takes slot of limit, false if group is canceled
+func (g *Group) acquire() bool {
+	if g.sem == nil {
+		return g.ctx.Err() == nil
+	}
+	select {
+	case g.sem <- struct{}{}:
+		if g.ctx.Err() != nil {
+			<-g.sem
+			return false
+		}
+		return true
+	case <-g.ctx.Done():
+		return false
+	}
+}
+
+func (g *Group) fail(err error) {
+	g.errOnce.Do(func() {
+		g.err = err
+		g.cancel()
+	})
+}
+
+// Wait - waits for all started tasks, returns first error
+func (g *Group) Wait() error {
+	g.wg.Wait()
+	g.cancel()
+	return g.err
+}
+
+// Call - calls f, recovered panic is returned as *PanicError
+func Call(ctx context.Context, f func(ctx context.Context) error) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = &PanicError{Value: r, Stack: debug.Stack()}
+		}
+	}()
+	return f(ctx)
+}
+
+// ForEach - calls f for every i in [0, n) by min(workers, n) goroutines, order of calls is not defined. Worker is index
+// of goroutine in [0, workers) - for per-worker state. Stops on first error, panic or cancellation of ctx and returns it.
+// With one worker f is called in caller's goroutine
+func ForEach(ctx context.Context, n, workers int, f func(ctx context.Context, worker, i int) error) error {
+	if workers > n {
+		workers = n
+	}
+	if workers <= 1 {
+		for i := 0; i < n; i++ {
+			if ctx.Err() != nil {
+				return errkind.Wrap(errkind.Canceled, ctx.Err())
+			}
+			i := i
+			if err := Call(ctx, func(ctx context.Context) error { return f(ctx, 0, i) }); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	g, ctx := NewGroup(ctx, "", 0)
+	var next int64
+	for w := 0; w < workers; w++ {
+		w := w
+		g.Go(func(ctx context.Context) error {
+			for i := int(atomic.AddInt64(&next, 1) - 1); i < n; i = int(atomic.AddInt64(&next, 1) - 1) {
+				if ctx.Err() != nil {
+					return errkind.Wrap(errkind.Canceled, ctx.Err())
+				}
+				if err := f(ctx, w, i); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+	}
+	return g.Wait()
+}
+
+// FanIn - merges values of ins into one channel, which is closed when all ins are closed or ctx is done
+func FanIn(ctx context.Context, ins ...<-chan interface{}) <-chan interface{} {
+	out := make(chan interface{})
+	var wg sync.WaitGroup
+	for _, in := range ins {
+		wg.Add(1)
+		go func(in <-chan interface{}) {
+			defer wg.Done()
+			for v := range in {
+				select {
+				case out <- v:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}(in)
+	}
+	go func() {
+		wg.Wait()
+		close(out)
+	}()
+	return out
+}
+
+// FanOut - applies f to values of in by workers goroutines and sends results to out, order of results is not kept.
+// Out is closed when in is closed and all results are sent, or after first error, panic or cancellation of ctx.
+// Wait must be called after out is drained: it returns the error
+func FanOut(ctx context.Context, in <-chan interface{}, workers int, f func(ctx context.Context, v interface{}) (interface{}, error)) (out <-chan interface{}, wait func() error) {
+	if workers < 1 {
+		workers = 1
+	}
+	res := make(chan interface{})
+	g, ctx := NewGroup(ctx, "", 0)
+	for w := 0; w < workers; w++ {
+		g.Go(func(ctx context.Context) error {
+			for {
+				var v interface{}
+				var ok bool
+				select {
+				case v, ok = <-in:
+					if !ok {
+						return nil
+					}
+				case <-ctx.Done():
+					return errkind.Wrap(errkind.Canceled, ctx.Err())
+				}
+				r, err := f(ctx, v)
+				if err != nil {
+					return err
+				}
+				select {
+				case res <- r:
+				case <-ctx.Done():
+					return errkind.Wrap(errkind.Canceled, ctx.Err())
+				}
+			}
+		})
+	}
+	var err error
+	done := make(chan struct{})
+	go func() {
+		err = g.Wait()
+		close(res)
+		close(done)
+	}()
+	return res, func() error {
+		<-done
+		return err
+	}
+}
@@ -0,0 +1,150 @@
+/*
+   Copyright 2021 Erigon contributors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package parallel
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ledgerwatch/erigon-lib/common/errkind"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGroup(t *testing.T) {
+	require := require.New(t)
+	g, _ := NewGroup(context.Background(), "test", 2)
+	var running, maxRunning int64
+	for i := 0; i < 10; i++ {
+		g.Go(func(ctx context.Context) error {
+			n := atomic.AddInt64(&running, 1)
+			for m := atomic.LoadInt64(&maxRunning); n > m && !atomic.CompareAndSwapInt64(&maxRunning, m, n); m = atomic.LoadInt64(&maxRunning) {
+			}
+			time.Sleep(time.Millisecond)
+			atomic.AddInt64(&running, -1)
+			return nil
+		})
+	}
+	require.NoError(g.Wait())
+	require.Equal(int64(2), maxRunning)
+
+	// first error cancels others
+	errTest := errors.New("test")
+	g, gctx := NewGroup(context.Background(), "", 0)
+	g.Go(func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	g.Go(func(ctx context.Context) error { return errTest })
+	require.Equal(errTest, g.Wait())
+	require.Error(gctx.Err())
+	called := false
+	g.Go(func(ctx context.Context) error { called = true; return nil })
+	require.False(called)
+
+	// panic
+	g, _ = NewGroup(context.Background(), "", 1)
+	g.Go(func(ctx context.Context) error { panic("boom") })
+	err := g.Wait()
+	var panicErr *PanicError
+	require.True(errors.As(err, &panicErr))
+	require.Equal("boom", panicErr.Value)
+	require.NotEmpty(panicErr.Stack)
+}
+
+func TestForEach(t *testing.T) {
+	require := require.New(t)
+	for _, workers := range []int{1, 3, 100} {
+		res := make([]int, 50)
+		require.NoError(ForEach(context.Background(), len(res), workers, func(ctx context.Context, worker, i int) error {
+			if worker >= workers || worker >= len(res) {
+				return errors.New("worker out of range")
+			}
+			res[i] = i * i
+			return nil
+		}))
+		for i := range res {
+			require.Equal(i*i, res[i])
+		}
+	}
+
+	errTest := errors.New("test")
+	var calls int64
+	err := ForEach(context.Background(), 1000, 4, func(ctx context.Context, worker, i int) error {
+		atomic.AddInt64(&calls, 1)
+		if i == 10 {
+			return errTest
+		}
+		return nil
+	})
+	require.Equal(errTest, err)
+	require.Less(atomic.LoadInt64(&calls), int64(1000))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	for _, workers := range []int{1, 4} {
+		err = ForEach(ctx, 10, workers, func(ctx context.Context, worker, i int) error { return nil })
+		require.True(errors.Is(err, errkind.Canceled), "%v", err)
+		require.True(errors.Is(err, context.Canceled))
+	}
+
+	err = ForEach(context.Background(), 3, 1, func(ctx context.Context, worker, i int) error { panic(i) })
+	var panicErr *PanicError
+	require.True(errors.As(err, &panicErr))
+}
+
+func TestFanOutFanIn(t *testing.T) {
+	require := require.New(t)
+	ctx := context.Background()
+	gen := func(from, to int) <-chan interface{} {
+		ch := make(chan interface{})
+		go func() {
+			defer close(ch)
+			for i := from; i < to; i++ {
+				ch <- i
+			}
+		}()
+		return ch
+	}
+	out, wait := FanOut(ctx, FanIn(ctx, gen(0, 50), gen(50, 100)), 4, func(ctx context.Context, v interface{}) (interface{}, error) {
+		return v.(int) * 2, nil
+	})
+	var res []int
+	for v := range out {
+		res = append(res, v.(int))
+	}
+	require.NoError(wait())
+	sort.Ints(res)
+	require.Equal(100, len(res))
+	for i := range res {
+		require.Equal(i*2, res[i])
+	}
+
+	errTest := errors.New("test")
+	out, wait = FanOut(ctx, gen(0, 100), 2, func(ctx context.Context, v interface{}) (interface{}, error) {
+		if v.(int) == 5 {
+			return nil, errTest
+		}
+		return v, nil
+	})
+	for range out {
+	}
+	require.Equal(errTest, wait())
+}
@@ -0,0 +1,145 @@
+/*
+   Copyright 2021 Erigon contributors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+// Package tracing - optional trace spans around db transactions, cursor scans, txpool batches and gRPC handlers.
+// Library has no dependency on tracing backend: embedder installs Tracer by SetTracer, for example adapter of
+// OpenTelemetry:
+//
+//	type otelTracer struct{ t trace.Tracer }
+//
+//	func (o otelTracer) Start(ctx context.Context, name string, kv ...interface{}) (context.Context, tracing.Span) {
+//		ctx, span := o.t.Start(ctx, name, trace.WithAttributes(toAttributes(kv)...))
+//		return ctx, otelSpan{span}
+//	}
+//
+// Without tracer spans are no-op and cost one atomic load.
+package tracing
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Span - one timed operation. Attributes are key/value pairs, as context of logging.Logger
+type Span interface {
+	SetAttributes(kv ...interface{})
+	RecordError(err error)
+	End()
+}
+
+type Tracer interface {
+	// Start - span which is child of span in ctx (if any), returned ctx carries new span
+	Start(ctx context.Context, name string, kv ...interface{}) (context.Context, Span)
+}
+
+type tracerHolder struct{ Tracer }
+
+var tracer atomic.Value
+
+func init() { tracer.Store(tracerHolder{}) }
+
+// SetTracer - installs tracer for whole library, nil disables tracing
+func SetTracer(t Tracer) { tracer.Store(tracerHolder{t}) }
+
+func Enabled() bool { return tracer.Load().(tracerHolder).Tracer != nil }
+
+// Start - span of installed tracer, or no-op span and unchanged ctx if tracing is disabled
+func Start(ctx context.Context, name string, kv ...interface{}) (context.Context, Span) {
+	t := tracer.Load().(tracerHolder).Tracer
+	if t == nil {
+		return ctx, noop{}
+	}
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	return t.Start(ctx, name, kv...)
+}
+
+// End - records err (if not nil) and ends span. Handy in defer with named error result
+func End(span Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+	}
+	span.End()
+}
+
+type noop struct{}
+
+func (noop) SetAttributes(...interface{}) {}
+func (noop) RecordError(error)            {}
+func (noop) End()                         {}
+
+// Recorder - in-memory tracer, keeps all spans. For tests and debugging
+type Recorder struct {
+	lock  sync.Mutex
+	spans []*RecordedSpan
+}
+
+type RecordedSpan struct {
+	Name   string
+	Parent *RecordedSpan
+	Attrs  []interface{}
+	Err    error
+	Start  time.Time
+	End    time.Time // zero while span is not ended
+
+	r *Recorder
+}
+
+type recordedSpanKey struct{}
+
+func (r *Recorder) Start(ctx context.Context, name string, kv ...interface{}) (context.Context, Span) {
+	s := &recordedSpan{&RecordedSpan{Name: name, Attrs: kv, Start: time.Now(), r: r}}
+	s.Parent, _ = ctx.Value(recordedSpanKey{}).(*RecordedSpan)
+	r.lock.Lock()
+	r.spans = append(r.spans, s.RecordedSpan)
+	r.lock.Unlock()
+	return context.WithValue(ctx, recordedSpanKey{}, s.RecordedSpan), s
+}
+
+// Spans - copies of recorded spans, in order of start
+func (r *Recorder) Spans() []RecordedSpan {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	res := make([]RecordedSpan, len(r.spans))
+	for i, s := range r.spans {
+		res[i] = *s
+	}
+	return res
+}
+
+// recordedSpan - Span methods are not on RecordedSpan: its End field is taken
+type recordedSpan struct{ *RecordedSpan }
+
+func (s recordedSpan) SetAttributes(kv ...interface{}) {
+	s.r.lock.Lock()
+	defer s.r.lock.Unlock()
+	s.Attrs = append(s.Attrs, kv...)
+}
+
+func (s recordedSpan) RecordError(err error) {
+	s.r.lock.Lock()
+	defer s.r.lock.Unlock()
+	s.Err = err
+}
+
+func (s recordedSpan) End() {
+	s.r.lock.Lock()
+	defer s.r.lock.Unlock()
+	s.RecordedSpan.End = time.Now()
+}
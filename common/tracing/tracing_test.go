@@ -0,0 +1,58 @@
+/*
+   Copyright 2021 Erigon contributors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package tracing
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestTracing(t *testing.T) {
+	require := require.New(t)
+	ctx := context.Background()
+	require.False(Enabled())
+	ctx2, s := Start(ctx, "disabled")
+	require.Equal(ctx, ctx2)
+	End(s, errors.New("ignored"))
+
+	r := &Recorder{}
+	SetTracer(r)
+	defer SetTracer(nil)
+	require.True(Enabled())
+	ctx, root := Start(ctx, "root", "k", 1)
+	_, child := Start(ctx, "child")
+	child.SetAttributes("n", 2)
+	End(child, errors.New("fail"))
+	End(root, nil)
+
+	spans := r.Spans()
+	require.Len(spans, 2)
+	require.Equal("root", spans[0].Name)
+	require.Nil(spans[0].Parent)
+	require.Equal([]interface{}{"k", 1}, spans[0].Attrs)
+	require.NoError(spans[0].Err)
+	require.Equal("child", spans[1].Name)
+	require.Equal("root", spans[1].Parent.Name)
+	require.Equal([]interface{}{"n", 2}, spans[1].Attrs)
+	require.EqualError(spans[1].Err, "fail")
+	for _, s := range spans {
+		require.False(s.End.Before(s.Start))
+	}
+}
@@ -0,0 +1,173 @@
+/*
+   Copyright 2021 Erigon contributors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+// Package common contains value types shared by other packages of the library
+package common
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+
+	"github.com/ledgerwatch/erigon-lib/rlp"
+	"golang.org/x/crypto/sha3"
+)
+
+const (
+	HashLength    = 32
+	AddressLength = 20
+)
+
+// Hash - Keccak256 hash, for example of transaction or block. Arrays [32]byte are assignable to it
+type Hash [HashLength]byte
+
+// Address - address of account. Arrays [20]byte are assignable to it
+type Address [AddressLength]byte
+
+// BytesToHash - uses last 32 bytes of b, shorter b is left-padded by zeros
+func BytesToHash(b []byte) (h Hash) {
+	if len(b) > HashLength {
+		b = b[len(b)-HashLength:]
+	}
+	copy(h[HashLength-len(b):], b)
+	return h
+}
+
+// BytesToAddress - uses last 20 bytes of b, shorter b is left-padded by zeros
+func BytesToAddress(b []byte) (a Address) {
+	if len(b) > AddressLength {
+		b = b[len(b)-AddressLength:]
+	}
+	copy(a[AddressLength-len(b):], b)
+	return a
+}
+
+// HexToHash - parses hex with or without 0x prefix, length must be exact
+func HexToHash(s string) (h Hash, err error) {
+	err = decodeHex(h[:], []byte(s))
+	return h, err
+}
+
+// HexToAddress - parses hex with or without 0x prefix, length must be exact. Checksum is not validated
+func HexToAddress(s string) (a Address, err error) {
+	err = decodeHex(a[:], []byte(s))
+	return a, err
+}
+
+func decodeHex(to, s []byte) error {
+	if len(s) >= 2 && s[0] == '0' && (s[1] == 'x' || s[1] == 'X') {
+		s = s[2:]
+	}
+	if len(s) != 2*len(to) {
+		return fmt.Errorf("hex of %d bytes expected, got %d chars", len(to), len(s))
+	}
+	_, err := hex.Decode(to, s)
+	return err
+}
+
+func appendHex(dst, b []byte) []byte {
+	dst = append(dst, '0', 'x')
+	n := len(dst)
+	for i := 0; i < 2*len(b); i++ {
+		dst = append(dst, 0)
+	}
+	hex.Encode(dst[n:], b)
+	return dst
+}
+
+func (h Hash) Bytes() []byte { return h[:] }
+
+// AppendHex - appends 0x-prefixed lower-case hex, doesn't allocate if dst has enough capacity
+func (h Hash) AppendHex(dst []byte) []byte { return appendHex(dst, h[:]) }
+func (h Hash) Hex() string                 { return string(h.AppendHex(make([]byte, 0, 2+2*HashLength))) }
+func (h Hash) String() string              { return h.Hex() }
+func (h Hash) IsZero() bool                { return h == Hash{} }
+func (h Hash) Cmp(other Hash) int          { return bytes.Compare(h[:], other[:]) }
+
+func (h Hash) MarshalText() ([]byte, error) { return h.AppendHex(make([]byte, 0, 2+2*HashLength)), nil }
+func (h *Hash) UnmarshalText(input []byte) error {
+	if err := decodeHex(h[:], input); err != nil {
+		return fmt.Errorf("hash: %w", err)
+	}
+	return nil
+}
+
+// EncodeRLP - writes RLP string of the hash to `to`, which must have at least 33 bytes, returns written amount
+func (h Hash) EncodeRLP(to []byte) int { return rlp.EncodeHash(h[:], to) }
+
+// DecodeRLP - parses RLP string of the hash at given position, returns position after it
+func (h *Hash) DecodeRLP(payload []byte, pos int) (int, error) {
+	return rlp.ParseHash(payload, pos, h[:])
+}
+
+func (a Address) Bytes() []byte { return a[:] }
+
+// AppendHex - appends 0x-prefixed lower-case hex, doesn't allocate if dst has enough capacity
+func (a Address) AppendHex(dst []byte) []byte { return appendHex(dst, a[:]) }
+
+// Hex - EIP-55 mixed-case checksum encoding
+func (a Address) Hex() string {
+	buf := a.AppendHex(make([]byte, 0, 2+2*AddressLength))
+	sha := sha3.NewLegacyKeccak256()
+	sha.Write(buf[2:])
+	var hash [32]byte
+	sha.Sum(hash[:0])
+	for i := 2; i < len(buf); i++ {
+		hashByte := hash[(i-2)/2]
+		if i%2 == 0 {
+			hashByte >>= 4
+		} else {
+			hashByte &= 0xf
+		}
+		if buf[i] > '9' && hashByte > 7 {
+			buf[i] -= 32
+		}
+	}
+	return string(buf)
+}
+func (a Address) String() string        { return a.Hex() }
+func (a Address) IsZero() bool          { return a == Address{} }
+func (a Address) Cmp(other Address) int { return bytes.Compare(a[:], other[:]) }
+
+func (a Address) MarshalText() ([]byte, error) {
+	return a.AppendHex(make([]byte, 0, 2+2*AddressLength)), nil
+}
+func (a *Address) UnmarshalText(input []byte) error {
+	if err := decodeHex(a[:], input); err != nil {
+		return fmt.Errorf("address: %w", err)
+	}
+	return nil
+}
+
+// EncodeRLP - writes RLP string of the address to `to`, which must have at least 21 bytes, returns written amount
+func (a Address) EncodeRLP(to []byte) int {
+	to[0] = 128 + AddressLength
+	copy(to[1:], a[:])
+	return 1 + AddressLength
+}
+
+// DecodeRLP - parses RLP string of the address at given position, returns position after it
+func (a *Address) DecodeRLP(payload []byte, pos int) (int, error) {
+	pos, err := rlp.StringOfLen(payload, pos, AddressLength)
+	if err != nil {
+		return 0, fmt.Errorf("address: %w", err)
+	}
+	if pos+AddressLength > len(payload) {
+		return 0, fmt.Errorf("address: unexpected end of payload")
+	}
+	copy(a[:], payload[pos:pos+AddressLength])
+	return pos + AddressLength, nil
+}
@@ -0,0 +1,87 @@
+/*
+   Copyright 2021 Erigon contributors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package common
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestHash(t *testing.T) {
+	require := require.New(t)
+	s := "0x595e27a835cd79729ff1eeacec3120eeb6ed1464a04ec727aaca734ead961328"
+	h, err := HexToHash(s)
+	require.NoError(err)
+	require.Equal(s, h.Hex())
+	h2, err := HexToHash(s[2:])
+	require.NoError(err)
+	require.Equal(h, h2)
+	_, err = HexToHash(s[:len(s)-2])
+	require.Error(err)
+	_, err = HexToHash(s[:len(s)-2] + "zz")
+	require.Error(err)
+
+	var arr [32]byte = h // arrays are assignable both ways
+	require.Equal(h, Hash(arr))
+	require.Equal(Hash{31: 1}, BytesToHash([]byte{1}))
+	require.Equal(-1, Hash{}.Cmp(h))
+	require.True(Hash{}.IsZero())
+
+	buf := make([]byte, 0, 66)
+	require.Zero(testing.AllocsPerRun(10, func() { buf = h.AppendHex(buf[:0]) }))
+
+	b, err := json.Marshal(map[string]Hash{"h": h})
+	require.NoError(err)
+	require.Equal(`{"h":"`+s+`"}`, string(b))
+	var decoded map[string]Hash
+	require.NoError(json.Unmarshal(b, &decoded))
+	require.Equal(h, decoded["h"])
+
+	enc := make([]byte, 33)
+	require.Equal(33, h.EncodeRLP(enc))
+	var h3 Hash
+	pos, err := h3.DecodeRLP(enc, 0)
+	require.NoError(err)
+	require.Equal(33, pos)
+	require.Equal(h, h3)
+}
+
+func TestAddress(t *testing.T) {
+	require := require.New(t)
+	s := "0x5aAeb6053F3E94C9b9A09f33669435E7Ef1BeAed" // EIP-55 test vector
+	a, err := HexToAddress(s)
+	require.NoError(err)
+	require.Equal(s, a.Hex())
+	require.Equal("0x5aaeb6053f3e94c9b9a09f33669435e7ef1beaed", string(a.AppendHex(nil)))
+	require.Equal(Address{19: 2}, BytesToAddress([]byte{2}))
+
+	enc := make([]byte, 21)
+	require.Equal(21, a.EncodeRLP(enc))
+	var a2 Address
+	pos, err := a2.DecodeRLP(enc, 0)
+	require.NoError(err)
+	require.Equal(21, pos)
+	require.Equal(a, a2)
+	_, err = a2.DecodeRLP(enc[:20], 0)
+	require.Error(err)
+
+	var decoded Address
+	require.NoError(json.Unmarshal([]byte(`"`+s+`"`), &decoded))
+	require.Equal(a, decoded)
+}
@@ -0,0 +1,133 @@
+/*
+   Copyright 2021 Erigon contributors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package direct
+
+import (
+	"context"
+
+	proto_downloader "github.com/ledgerwatch/erigon-lib/gointerfaces/snapshotsync"
+	"github.com/ledgerwatch/erigon-lib/gointerfaces/types"
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/types/known/emptypb"
+)
+
+var _ proto_downloader.DownloaderClient = (*DownloaderClientDirect)(nil) // compile-time interface check
+
+// DownloaderClientDirect implements DownloaderClient interface by calling the instance of DownloaderServer directly
+type DownloaderClientDirect struct {
+	server proto_downloader.DownloaderServer
+
+	unaryInterceptor grpc.UnaryServerInterceptor
+}
+
+func NewDownloaderClientDirect(server proto_downloader.DownloaderServer) *DownloaderClientDirect {
+	return &DownloaderClientDirect{server: server}
+}
+
+// SetInterceptors - wrap all calls of server, same as interceptors of gRPC server. For example grpcutil.CallPolicy
+// Downloader has no streaming methods, stream is accepted for same signature as other direct clients
+func (c *DownloaderClientDirect) SetInterceptors(unary grpc.UnaryServerInterceptor, stream grpc.StreamServerInterceptor) {
+	c.unaryInterceptor = unary
+}
+
+func (c *DownloaderClientDirect) call(ctx context.Context, method string, req interface{}, handler grpc.UnaryHandler) (interface{}, error) {
+	if c.unaryInterceptor == nil {
+		return handler(ctx, req)
+	}
+	info := &grpc.UnaryServerInfo{Server: c.server, FullMethod: "/" + proto_downloader.Downloader_ServiceDesc.ServiceName + "/" + method}
+	return c.unaryInterceptor(ctx, req, info, handler)
+}
+
+func (c *DownloaderClientDirect) Download(ctx context.Context, in *proto_downloader.DownloadSnapshotRequest, opts ...grpc.CallOption) (*emptypb.Empty, error) {
+	reply, err := c.call(ctx, "Download", in, func(ctx context.Context, req interface{}) (interface{}, error) {
+		return c.server.Download(ctx, req.(*proto_downloader.DownloadSnapshotRequest))
+	})
+	if err != nil {
+		return nil, err
+	}
+	return reply.(*emptypb.Empty), nil
+}
+
+func (c *DownloaderClientDirect) Snapshots(ctx context.Context, in *proto_downloader.SnapshotsRequest, opts ...grpc.CallOption) (*proto_downloader.SnapshotsInfoReply, error) {
+	reply, err := c.call(ctx, "Snapshots", in, func(ctx context.Context, req interface{}) (interface{}, error) {
+		return c.server.Snapshots(ctx, req.(*proto_downloader.SnapshotsRequest))
+	})
+	if err != nil {
+		return nil, err
+	}
+	return reply.(*proto_downloader.SnapshotsInfoReply), nil
+}
+
+func (c *DownloaderClientDirect) SetRateLimits(ctx context.Context, in *proto_downloader.SetRateLimitsRequest, opts ...grpc.CallOption) (*emptypb.Empty, error) {
+	reply, err := c.call(ctx, "SetRateLimits", in, func(ctx context.Context, req interface{}) (interface{}, error) {
+		return c.server.SetRateLimits(ctx, req.(*proto_downloader.SetRateLimitsRequest))
+	})
+	if err != nil {
+		return nil, err
+	}
+	return reply.(*emptypb.Empty), nil
+}
+
+func (c *DownloaderClientDirect) SetItemRateLimits(ctx context.Context, in *proto_downloader.SetItemRateLimitsRequest, opts ...grpc.CallOption) (*emptypb.Empty, error) {
+	reply, err := c.call(ctx, "SetItemRateLimits", in, func(ctx context.Context, req interface{}) (interface{}, error) {
+		return c.server.SetItemRateLimits(ctx, req.(*proto_downloader.SetItemRateLimitsRequest))
+	})
+	if err != nil {
+		return nil, err
+	}
+	return reply.(*emptypb.Empty), nil
+}
+
+func (c *DownloaderClientDirect) Pause(ctx context.Context, in *proto_downloader.ItemsRequest, opts ...grpc.CallOption) (*emptypb.Empty, error) {
+	reply, err := c.call(ctx, "Pause", in, func(ctx context.Context, req interface{}) (interface{}, error) {
+		return c.server.Pause(ctx, req.(*proto_downloader.ItemsRequest))
+	})
+	if err != nil {
+		return nil, err
+	}
+	return reply.(*emptypb.Empty), nil
+}
+
+func (c *DownloaderClientDirect) Resume(ctx context.Context, in *proto_downloader.ItemsRequest, opts ...grpc.CallOption) (*emptypb.Empty, error) {
+	reply, err := c.call(ctx, "Resume", in, func(ctx context.Context, req interface{}) (interface{}, error) {
+		return c.server.Resume(ctx, req.(*proto_downloader.ItemsRequest))
+	})
+	if err != nil {
+		return nil, err
+	}
+	return reply.(*emptypb.Empty), nil
+}
+
+func (c *DownloaderClientDirect) Progress(ctx context.Context, in *proto_downloader.ItemsRequest, opts ...grpc.CallOption) (*proto_downloader.ProgressReply, error) {
+	reply, err := c.call(ctx, "Progress", in, func(ctx context.Context, req interface{}) (interface{}, error) {
+		return c.server.Progress(ctx, req.(*proto_downloader.ItemsRequest))
+	})
+	if err != nil {
+		return nil, err
+	}
+	return reply.(*proto_downloader.ProgressReply), nil
+}
+
+func (c *DownloaderClientDirect) Version(ctx context.Context, in *emptypb.Empty, opts ...grpc.CallOption) (*types.VersionReply, error) {
+	reply, err := c.call(ctx, "Version", in, func(ctx context.Context, req interface{}) (interface{}, error) {
+		return c.server.Version(ctx, req.(*emptypb.Empty))
+	})
+	if err != nil {
+		return nil, err
+	}
+	return reply.(*types.VersionReply), nil
+}
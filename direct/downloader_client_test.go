@@ -0,0 +1,66 @@
+/*
+   Copyright 2021 Erigon contributors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package direct_test
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ledgerwatch/erigon-lib/direct"
+	"github.com/ledgerwatch/erigon-lib/gointerfaces/grpcutil"
+	"github.com/ledgerwatch/erigon-lib/gointerfaces/snapshotsync"
+	"github.com/ledgerwatch/erigon-lib/gointerfaces/types"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/emptypb"
+)
+
+// flakyDownloader - Version fails by Unavailable `failures` times, Progress panics
+type flakyDownloader struct {
+	snapshotsync.UnimplementedDownloaderServer
+	failures, calls int32
+}
+
+func (s *flakyDownloader) Version(context.Context, *emptypb.Empty) (*types.VersionReply, error) {
+	if atomic.AddInt32(&s.calls, 1) <= s.failures {
+		return nil, status.Error(codes.Unavailable, "not yet")
+	}
+	return &types.VersionReply{Major: 1}, nil
+}
+
+func (s *flakyDownloader) Progress(context.Context, *snapshotsync.ItemsRequest) (*snapshotsync.ProgressReply, error) {
+	panic("boom")
+}
+
+func TestDownloaderClientCallPolicy(t *testing.T) {
+	require := require.New(t)
+	ctx := context.Background()
+	policy := grpcutil.CallPolicy{Default: grpcutil.MethodPolicy{Retries: 2, Backoff: time.Millisecond}}
+
+	server := &flakyDownloader{failures: 2}
+	client := direct.NewDownloaderClientDirect(server)
+	client.SetInterceptors(policy.UnaryServerInterceptor(), policy.StreamServerInterceptor())
+	v, err := client.Version(ctx, &emptypb.Empty{})
+	require.NoError(err)
+	require.Equal(uint32(1), v.Major)
+	require.Equal(int32(3), atomic.LoadInt32(&server.calls))
+	_, err = client.Progress(ctx, &snapshotsync.ItemsRequest{})
+	require.Equal(codes.Internal, status.Code(err))
+}
@@ -0,0 +1,340 @@
+/*
+   Copyright 2021 Erigon contributors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package direct
+
+import (
+	"context"
+	"io"
+	"sync"
+
+	"github.com/ledgerwatch/erigon-lib/gointerfaces/remote"
+	"github.com/ledgerwatch/erigon-lib/gointerfaces/types"
+	"github.com/ledgerwatch/erigon-lib/kv"
+	"github.com/ledgerwatch/erigon-lib/kv/remotedbserver"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/emptypb"
+)
+
+var _ remote.KVClient = (*KVClient)(nil) // compile-time interface check
+
+// KVClient implements remote.KVClient by calling the instance of KVServer directly: messages are passed in memory,
+// without serialization. Code written against remote interface (for example kv/remotedb) can run embedded.
+// Keys and values sent by server are copied: they reference memory of server's db transaction
+type KVClient struct {
+	server remote.KVServer
+
+	unaryInterceptor  grpc.UnaryServerInterceptor
+	streamInterceptor grpc.StreamServerInterceptor
+}
+
+// NewKVClient - client of local db, served by remotedbserver.KvServer with default settings
+func NewKVClient(db kv.RwDB) *KVClient {
+	return NewKVClientDirect(remotedbserver.NewKvServer(db))
+}
+
+// NewKVClientDirect - client of configured server, for example with state changes or batch limits
+func NewKVClientDirect(server remote.KVServer) *KVClient {
+	return &KVClient{server: server}
+}
+
+// SetInterceptors - wrap all calls of server, same as interceptors of gRPC server. For example grpcutil.CallPolicy
+func (c *KVClient) SetInterceptors(unary grpc.UnaryServerInterceptor, stream grpc.StreamServerInterceptor) {
+	c.unaryInterceptor, c.streamInterceptor = unary, stream
+}
+
+func (c *KVClient) call(ctx context.Context, method string, req interface{}, handler grpc.UnaryHandler) (interface{}, error) {
+	ctx = incoming(ctx)
+	if c.unaryInterceptor == nil {
+		return handler(ctx, req)
+	}
+	info := &grpc.UnaryServerInfo{Server: c.server, FullMethod: "/" + remote.KV_ServiceDesc.ServiceName + "/" + method}
+	return c.unaryInterceptor(ctx, req, info, handler)
+}
+
+func (c *KVClient) stream(method string, ss grpc.ServerStream, clientStream bool, handler grpc.StreamHandler) error {
+	if c.streamInterceptor == nil {
+		return handler(c.server, ss)
+	}
+	info := &grpc.StreamServerInfo{FullMethod: "/" + remote.KV_ServiceDesc.ServiceName + "/" + method, IsClientStream: clientStream, IsServerStream: true}
+	return c.streamInterceptor(c.server, ss, info, handler)
+}
+
+// incoming - metadata of client (for example kv-view-id of pinned view) as server sees it
+func incoming(ctx context.Context) context.Context {
+	if md, ok := metadata.FromOutgoingContext(ctx); ok {
+		return metadata.NewIncomingContext(ctx, md)
+	}
+	return ctx
+}
+
+// ctxErr - context error as gRPC client returns it
+func ctxErr(ctx context.Context) error { return status.FromContextError(ctx.Err()).Err() }
+
+func (c *KVClient) Version(ctx context.Context, in *emptypb.Empty, opts ...grpc.CallOption) (*types.VersionReply, error) {
+	reply, err := c.call(ctx, "Version", in, func(ctx context.Context, req interface{}) (interface{}, error) {
+		return c.server.Version(ctx, req.(*emptypb.Empty))
+	})
+	if err != nil {
+		return nil, err
+	}
+	return reply.(*types.VersionReply), nil
+}
+
+func (c *KVClient) Health(ctx context.Context, in *emptypb.Empty, opts ...grpc.CallOption) (*remote.HealthReply, error) {
+	reply, err := c.call(ctx, "Health", in, func(ctx context.Context, req interface{}) (interface{}, error) {
+		return c.server.Health(ctx, req.(*emptypb.Empty))
+	})
+	if err != nil {
+		return nil, err
+	}
+	return reply.(*remote.HealthReply), nil
+}
+
+func (c *KVClient) StateChangesAck(ctx context.Context, in *remote.StateChangeAck, opts ...grpc.CallOption) (*emptypb.Empty, error) {
+	reply, err := c.call(ctx, "StateChangesAck", in, func(ctx context.Context, req interface{}) (interface{}, error) {
+		return c.server.StateChangesAck(ctx, req.(*remote.StateChangeAck))
+	})
+	if err != nil {
+		return nil, err
+	}
+	return reply.(*emptypb.Empty), nil
+}
+
+func (c *KVClient) Pin(ctx context.Context, in *remote.PinRequest, opts ...grpc.CallOption) (*remote.PinReply, error) {
+	reply, err := c.call(ctx, "Pin", in, func(ctx context.Context, req interface{}) (interface{}, error) {
+		return c.server.Pin(ctx, req.(*remote.PinRequest))
+	})
+	if err != nil {
+		return nil, err
+	}
+	return reply.(*remote.PinReply), nil
+}
+
+func (c *KVClient) Heartbeat(ctx context.Context, in *remote.ViewRequest, opts ...grpc.CallOption) (*emptypb.Empty, error) {
+	reply, err := c.call(ctx, "Heartbeat", in, func(ctx context.Context, req interface{}) (interface{}, error) {
+		return c.server.Heartbeat(ctx, req.(*remote.ViewRequest))
+	})
+	if err != nil {
+		return nil, err
+	}
+	return reply.(*emptypb.Empty), nil
+}
+
+func (c *KVClient) Unpin(ctx context.Context, in *remote.ViewRequest, opts ...grpc.CallOption) (*emptypb.Empty, error) {
+	reply, err := c.call(ctx, "Unpin", in, func(ctx context.Context, req interface{}) (interface{}, error) {
+		return c.server.Unpin(ctx, req.(*remote.ViewRequest))
+	})
+	if err != nil {
+		return nil, err
+	}
+	return reply.(*emptypb.Empty), nil
+}
+
+// streamEnd - result of server's stream handler: io.EOF for client if handler returned nil
+type streamEnd struct {
+	done chan struct{}
+	err  error
+}
+
+func newStreamEnd() *streamEnd { return &streamEnd{done: make(chan struct{})} }
+
+func (e *streamEnd) finish(err error) {
+	if err == nil {
+		err = io.EOF
+	}
+	e.err = err
+	close(e.done)
+}
+
+// Tx - bidirectional stream: server handler runs in own goroutine until client closes send side or cancels ctx
+func (c *KVClient) Tx(ctx context.Context, opts ...grpc.CallOption) (remote.KV_TxClient, error) {
+	s := &kvTxStream{ctx: ctx, reqs: make(chan *remote.Cursor), replies: make(chan *remote.Pair, 16), sendClosed: make(chan struct{}), end: newStreamEnd()}
+	server := &kvTxServerDirect{s: s, ctx: incoming(ctx)}
+	go func() {
+		s.end.finish(c.stream("Tx", server, true, func(srv interface{}, ss grpc.ServerStream) error {
+			return c.server.Tx(server)
+		}))
+	}()
+	return &kvTxClientDirect{s: s}, nil
+}
+
+type kvTxStream struct {
+	ctx        context.Context
+	reqs       chan *remote.Cursor
+	replies    chan *remote.Pair
+	closeOnce  sync.Once
+	sendClosed chan struct{}
+	end        *streamEnd
+}
+
+// kvTxClientDirect implements remote.KV_TxClient
+type kvTxClientDirect struct {
+	s *kvTxStream
+	grpc.ClientStream
+}
+
+// Send - like gRPC stream: returns io.EOF if server ended stream, real error is returned by Recv
+func (c *kvTxClientDirect) Send(m *remote.Cursor) error {
+	select {
+	case c.s.reqs <- m:
+		return nil
+	case <-c.s.end.done:
+		return io.EOF
+	case <-c.s.ctx.Done():
+		return ctxErr(c.s.ctx)
+	}
+}
+
+func (c *kvTxClientDirect) Recv() (*remote.Pair, error) {
+	select {
+	case m := <-c.s.replies:
+		return m, nil
+	case <-c.s.ctx.Done():
+		return nil, ctxErr(c.s.ctx)
+	case <-c.s.end.done:
+		select { // replies sent before end
+		case m := <-c.s.replies:
+			return m, nil
+		default:
+			return nil, c.s.end.err
+		}
+	}
+}
+
+func (c *kvTxClientDirect) CloseSend() error {
+	c.s.closeOnce.Do(func() { close(c.s.sendClosed) })
+	return nil
+}
+func (c *kvTxClientDirect) Context() context.Context     { return c.s.ctx }
+func (c *kvTxClientDirect) Header() (metadata.MD, error) { return nil, nil }
+func (c *kvTxClientDirect) Trailer() metadata.MD         { return nil }
+func (c *kvTxClientDirect) SendMsg(m interface{}) error  { return c.Send(m.(*remote.Cursor)) }
+func (c *kvTxClientDirect) RecvMsg(m interface{}) error  { return recvInto(c.Recv, m.(*remote.Pair)) }
+
+func recvInto(recv func() (*remote.Pair, error), m *remote.Pair) error {
+	reply, err := recv()
+	if err != nil {
+		return err
+	}
+	m.CursorID, m.K, m.V, m.Keys, m.Values = reply.CursorID, reply.K, reply.V, reply.Keys, reply.Values
+	return nil
+}
+
+// kvTxServerDirect implements remote.KV_TxServer
+type kvTxServerDirect struct {
+	s   *kvTxStream
+	ctx context.Context
+	grpc.ServerStream
+}
+
+func (s *kvTxServerDirect) Send(m *remote.Pair) error {
+	select {
+	case s.s.replies <- copyPair(m):
+		return nil
+	case <-s.ctx.Done():
+		return ctxErr(s.ctx)
+	}
+}
+
+func (s *kvTxServerDirect) Recv() (*remote.Cursor, error) {
+	select {
+	case m := <-s.s.reqs:
+		return m, nil
+	case <-s.s.sendClosed:
+		return nil, io.EOF
+	case <-s.ctx.Done():
+		return nil, ctxErr(s.ctx)
+	}
+}
+func (s *kvTxServerDirect) Context() context.Context { return s.ctx }
+
+// copyPair - keys and values of server reference memory of its db transaction, which may end before client reads them
+func copyPair(m *remote.Pair) *remote.Pair {
+	cp := &remote.Pair{CursorID: m.CursorID, K: copyBytes(m.K), V: copyBytes(m.V)}
+	if m.Keys != nil {
+		cp.Keys, cp.Values = make([][]byte, len(m.Keys)), make([][]byte, len(m.Values))
+		for i := range m.Keys {
+			cp.Keys[i] = copyBytes(m.Keys[i])
+		}
+		for i := range m.Values {
+			cp.Values[i] = copyBytes(m.Values[i])
+		}
+	}
+	return cp
+}
+
+func copyBytes(b []byte) []byte {
+	if b == nil {
+		return nil
+	}
+	return append(make([]byte, 0, len(b)), b...)
+}
+
+func (c *KVClient) StateChanges(ctx context.Context, in *remote.StateChangeRequest, opts ...grpc.CallOption) (remote.KV_StateChangesClient, error) {
+	ch, end := make(chan *remote.StateChange, 16), newStreamEnd()
+	server := &kvStateChangesServerDirect{ch: ch, ctx: incoming(ctx)}
+	go func() {
+		end.finish(c.stream("StateChanges", server, false, func(srv interface{}, ss grpc.ServerStream) error {
+			return c.server.StateChanges(in, server)
+		}))
+	}()
+	return &kvStateChangesClientDirect{ch: ch, end: end, ctx: ctx}, nil
+}
+
+// kvStateChangesServerDirect implements remote.KV_StateChangesServer
+type kvStateChangesServerDirect struct {
+	ch  chan *remote.StateChange
+	ctx context.Context
+	grpc.ServerStream
+}
+
+func (s *kvStateChangesServerDirect) Send(m *remote.StateChange) error {
+	select {
+	case s.ch <- m:
+		return nil
+	case <-s.ctx.Done():
+		return ctxErr(s.ctx)
+	}
+}
+func (s *kvStateChangesServerDirect) Context() context.Context { return s.ctx }
+
+// kvStateChangesClientDirect implements remote.KV_StateChangesClient
+type kvStateChangesClientDirect struct {
+	ch  chan *remote.StateChange
+	end *streamEnd
+	ctx context.Context
+	grpc.ClientStream
+}
+
+func (c *kvStateChangesClientDirect) Recv() (*remote.StateChange, error) {
+	select {
+	case m := <-c.ch:
+		return m, nil
+	case <-c.ctx.Done():
+		return nil, ctxErr(c.ctx)
+	case <-c.end.done:
+		select {
+		case m := <-c.ch:
+			return m, nil
+		default:
+			return nil, c.end.err
+		}
+	}
+}
+func (c *kvStateChangesClientDirect) Context() context.Context { return c.ctx }
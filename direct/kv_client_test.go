@@ -0,0 +1,120 @@
+/*
+   Copyright 2021 Erigon contributors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package direct_test
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ledgerwatch/erigon-lib/direct"
+	"github.com/ledgerwatch/erigon-lib/gointerfaces"
+	"github.com/ledgerwatch/erigon-lib/gointerfaces/grpcutil"
+	"github.com/ledgerwatch/erigon-lib/gointerfaces/remote"
+	"github.com/ledgerwatch/erigon-lib/gointerfaces/types"
+	"github.com/ledgerwatch/erigon-lib/kv"
+	"github.com/ledgerwatch/erigon-lib/kv/memdb"
+	"github.com/ledgerwatch/erigon-lib/kv/remotedb"
+	"github.com/ledgerwatch/erigon-lib/kv/remotedbserver"
+	"github.com/ledgerwatch/log/v3"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/emptypb"
+)
+
+func TestKVClient(t *testing.T) {
+	require := require.New(t)
+	ctx := context.Background()
+	db := memdb.NewTestDB(t)
+	require.NoError(db.Update(ctx, func(tx kv.RwTx) error {
+		for i := byte(0); i < 10; i++ {
+			if err := tx.Put(kv.DatabaseInfo, []byte{i}, []byte{i, i}); err != nil {
+				return err
+			}
+		}
+		return nil
+	}))
+
+	client := direct.NewKVClient(db)
+	v, err := client.Version(ctx, &emptypb.Empty{})
+	require.NoError(err)
+	require.Equal(remotedbserver.KvServiceAPIVersion.Major, v.Major)
+	_, err = client.Health(ctx, &emptypb.Empty{})
+	require.NoError(err)
+
+	rdb, err := remotedb.NewRemote(gointerfaces.VersionFromProto(remotedbserver.KvServiceAPIVersion), log.New(), client).Open()
+	require.NoError(err)
+	defer rdb.Close()
+	var keys, values [][]byte
+	require.NoError(rdb.View(ctx, func(tx kv.Tx) error {
+		return tx.ForEach(kv.DatabaseInfo, []byte{3}, func(k, v []byte) error {
+			keys, values = append(keys, k), append(values, v)
+			return nil
+		})
+	}))
+	require.Len(keys, 7)
+	require.Equal([]byte{3}, keys[0])
+	require.Equal([]byte{9, 9}, values[6])
+
+	// keys and values are copied: they stay valid after tx of server is closed
+	require.NoError(db.Update(ctx, func(tx kv.RwTx) error { return tx.ClearBucket(kv.DatabaseInfo) }))
+	require.Equal([]byte{4}, keys[1])
+	require.Equal([]byte{4, 4}, values[1])
+}
+
+// flakyKV - Version fails by Unavailable `failures` times, Health and StateChanges panic
+type flakyKV struct {
+	remote.UnimplementedKVServer
+	failures, calls int32
+}
+
+func (s *flakyKV) Version(context.Context, *emptypb.Empty) (*types.VersionReply, error) {
+	if atomic.AddInt32(&s.calls, 1) <= s.failures {
+		return nil, status.Error(codes.Unavailable, "not yet")
+	}
+	return &types.VersionReply{Major: 3}, nil
+}
+
+func (s *flakyKV) Health(context.Context, *emptypb.Empty) (*remote.HealthReply, error) {
+	panic("boom")
+}
+
+func (s *flakyKV) StateChanges(*remote.StateChangeRequest, remote.KV_StateChangesServer) error {
+	panic("boom")
+}
+
+func TestKVClientCallPolicy(t *testing.T) {
+	require := require.New(t)
+	ctx := context.Background()
+	policy := grpcutil.CallPolicy{Default: grpcutil.MethodPolicy{Retries: 2, Backoff: time.Millisecond}}
+
+	server := &flakyKV{failures: 2}
+	client := direct.NewKVClientDirect(server)
+	client.SetInterceptors(policy.UnaryServerInterceptor(), policy.StreamServerInterceptor())
+	v, err := client.Version(ctx, &emptypb.Empty{})
+	require.NoError(err)
+	require.Equal(uint32(3), v.Major)
+	require.Equal(int32(3), atomic.LoadInt32(&server.calls))
+	_, err = client.Health(ctx, &emptypb.Empty{})
+	require.Equal(codes.Internal, status.Code(err))
+	stream, err := client.StateChanges(ctx, &remote.StateChangeRequest{})
+	require.NoError(err)
+	_, err = stream.Recv()
+	require.Equal(codes.Internal, status.Code(err))
+}
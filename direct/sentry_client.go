@@ -24,6 +24,7 @@ import (
 
 	"github.com/golang/protobuf/ptypes/empty"
 	"github.com/ledgerwatch/erigon-lib/gointerfaces/sentry"
+	"github.com/ledgerwatch/erigon-lib/gointerfaces/types"
 	"google.golang.org/protobuf/types/known/emptypb"
 
 	"google.golang.org/grpc"
@@ -32,6 +33,8 @@ import (
 const (
 	ETH65 = 65
 	ETH66 = 66
+	ETH67 = 67
+	ETH68 = 68
 )
 
 var ProtoIds = map[uint]map[sentry.MessageId]struct{}{
@@ -67,6 +70,34 @@ var ProtoIds = map[uint]map[sentry.MessageId]struct{}{
 		sentry.MessageId_GET_POOLED_TRANSACTIONS_66:       struct{}{},
 		sentry.MessageId_POOLED_TRANSACTIONS_66:           struct{}{},
 	},
+	ETH67: { // same as eth/66, without GetNodeData
+		sentry.MessageId_GET_BLOCK_HEADERS_66:             struct{}{},
+		sentry.MessageId_BLOCK_HEADERS_66:                 struct{}{},
+		sentry.MessageId_GET_BLOCK_BODIES_66:              struct{}{},
+		sentry.MessageId_BLOCK_BODIES_66:                  struct{}{},
+		sentry.MessageId_GET_RECEIPTS_66:                  struct{}{},
+		sentry.MessageId_RECEIPTS_66:                      struct{}{},
+		sentry.MessageId_NEW_BLOCK_HASHES_66:              struct{}{},
+		sentry.MessageId_NEW_BLOCK_66:                     struct{}{},
+		sentry.MessageId_TRANSACTIONS_66:                  struct{}{},
+		sentry.MessageId_NEW_POOLED_TRANSACTION_HASHES_66: struct{}{},
+		sentry.MessageId_GET_POOLED_TRANSACTIONS_66:       struct{}{},
+		sentry.MessageId_POOLED_TRANSACTIONS_66:           struct{}{},
+	},
+	ETH68: { // same as eth/67, announcements with types and sizes of transactions
+		sentry.MessageId_GET_BLOCK_HEADERS_66:             struct{}{},
+		sentry.MessageId_BLOCK_HEADERS_66:                 struct{}{},
+		sentry.MessageId_GET_BLOCK_BODIES_66:              struct{}{},
+		sentry.MessageId_BLOCK_BODIES_66:                  struct{}{},
+		sentry.MessageId_GET_RECEIPTS_66:                  struct{}{},
+		sentry.MessageId_RECEIPTS_66:                      struct{}{},
+		sentry.MessageId_NEW_BLOCK_HASHES_66:              struct{}{},
+		sentry.MessageId_NEW_BLOCK_66:                     struct{}{},
+		sentry.MessageId_TRANSACTIONS_66:                  struct{}{},
+		sentry.MessageId_NEW_POOLED_TRANSACTION_HASHES_68: struct{}{},
+		sentry.MessageId_GET_POOLED_TRANSACTIONS_66:       struct{}{},
+		sentry.MessageId_POOLED_TRANSACTIONS_66:           struct{}{},
+	},
 }
 
 type SentryClient interface {
@@ -123,6 +154,10 @@ func (c *SentryClientRemote) HandShake(ctx context.Context, in *emptypb.Empty, o
 		c.protocol = ETH65
 	case sentry.Protocol_ETH66:
 		c.protocol = ETH66
+	case sentry.Protocol_ETH67:
+		c.protocol = ETH67
+	case sentry.Protocol_ETH68:
+		c.protocol = ETH68
 	default:
 		return nil, fmt.Errorf("unexpected protocol: %d", reply.Protocol)
 	}
@@ -154,6 +189,9 @@ type SentryClientDirect struct {
 	protocol uint
 	server   sentry.SentryServer
 	logger   *log.Logger
+
+	unaryInterceptor  grpc.UnaryServerInterceptor
+	streamInterceptor grpc.StreamServerInterceptor
 }
 
 func NewSentryClientDirect(protocol uint, sentryServer sentry.SentryServer) *SentryClientDirect {
@@ -163,44 +201,129 @@ func NewSentryClientDirect(protocol uint, sentryServer sentry.SentryServer) *Sen
 func (c *SentryClientDirect) SetLogger(logger *log.Logger) {
 	c.logger = logger
 }
+
+// SetInterceptors - wrap all calls of server, same as interceptors of gRPC server. For example grpcutil.CallPolicy
+func (c *SentryClientDirect) SetInterceptors(unary grpc.UnaryServerInterceptor, stream grpc.StreamServerInterceptor) {
+	c.unaryInterceptor, c.streamInterceptor = unary, stream
+}
+
+func (c *SentryClientDirect) call(ctx context.Context, method string, req interface{}, handler grpc.UnaryHandler) (interface{}, error) {
+	if c.unaryInterceptor == nil {
+		return handler(ctx, req)
+	}
+	info := &grpc.UnaryServerInfo{Server: c.server, FullMethod: "/" + sentry.Sentry_ServiceDesc.ServiceName + "/" + method}
+	return c.unaryInterceptor(ctx, req, info, handler)
+}
+
+func (c *SentryClientDirect) stream(method string, ss grpc.ServerStream, handler grpc.StreamHandler) error {
+	if c.streamInterceptor == nil {
+		return handler(c.server, ss)
+	}
+	info := &grpc.StreamServerInfo{FullMethod: "/" + sentry.Sentry_ServiceDesc.ServiceName + "/" + method, IsServerStream: true}
+	return c.streamInterceptor(c.server, ss, info, handler)
+}
 func (c *SentryClientDirect) Protocol() uint    { return c.protocol }
 func (c *SentryClientDirect) Ready() bool       { return true }
 func (c *SentryClientDirect) MarkDisconnected() {}
 
 func (c *SentryClientDirect) PenalizePeer(ctx context.Context, in *sentry.PenalizePeerRequest, opts ...grpc.CallOption) (*empty.Empty, error) {
-	return c.server.PenalizePeer(ctx, in)
+	reply, err := c.call(ctx, "PenalizePeer", in, func(ctx context.Context, req interface{}) (interface{}, error) {
+		return c.server.PenalizePeer(ctx, req.(*sentry.PenalizePeerRequest))
+	})
+	if err != nil {
+		return nil, err
+	}
+	return reply.(*empty.Empty), nil
 }
 
 func (c *SentryClientDirect) PeerMinBlock(ctx context.Context, in *sentry.PeerMinBlockRequest, opts ...grpc.CallOption) (*empty.Empty, error) {
-	return c.server.PeerMinBlock(ctx, in)
+	reply, err := c.call(ctx, "PeerMinBlock", in, func(ctx context.Context, req interface{}) (interface{}, error) {
+		return c.server.PeerMinBlock(ctx, req.(*sentry.PeerMinBlockRequest))
+	})
+	if err != nil {
+		return nil, err
+	}
+	return reply.(*empty.Empty), nil
 }
 
 func (c *SentryClientDirect) SendMessageByMinBlock(ctx context.Context, in *sentry.SendMessageByMinBlockRequest, opts ...grpc.CallOption) (*sentry.SentPeers, error) {
-	return c.server.SendMessageByMinBlock(ctx, in)
+	reply, err := c.call(ctx, "SendMessageByMinBlock", in, func(ctx context.Context, req interface{}) (interface{}, error) {
+		return c.server.SendMessageByMinBlock(ctx, req.(*sentry.SendMessageByMinBlockRequest))
+	})
+	if err != nil {
+		return nil, err
+	}
+	return reply.(*sentry.SentPeers), nil
 }
 
 func (c *SentryClientDirect) SendMessageById(ctx context.Context, in *sentry.SendMessageByIdRequest, opts ...grpc.CallOption) (*sentry.SentPeers, error) {
-	return c.server.SendMessageById(ctx, in)
+	reply, err := c.call(ctx, "SendMessageById", in, func(ctx context.Context, req interface{}) (interface{}, error) {
+		return c.server.SendMessageById(ctx, req.(*sentry.SendMessageByIdRequest))
+	})
+	if err != nil {
+		return nil, err
+	}
+	return reply.(*sentry.SentPeers), nil
 }
 
 func (c *SentryClientDirect) SendMessageToRandomPeers(ctx context.Context, in *sentry.SendMessageToRandomPeersRequest, opts ...grpc.CallOption) (*sentry.SentPeers, error) {
-	return c.server.SendMessageToRandomPeers(ctx, in)
+	reply, err := c.call(ctx, "SendMessageToRandomPeers", in, func(ctx context.Context, req interface{}) (interface{}, error) {
+		return c.server.SendMessageToRandomPeers(ctx, req.(*sentry.SendMessageToRandomPeersRequest))
+	})
+	if err != nil {
+		return nil, err
+	}
+	return reply.(*sentry.SentPeers), nil
 }
 
 func (c *SentryClientDirect) SendMessageToAll(ctx context.Context, in *sentry.OutboundMessageData, opts ...grpc.CallOption) (*sentry.SentPeers, error) {
-	return c.server.SendMessageToAll(ctx, in)
+	reply, err := c.call(ctx, "SendMessageToAll", in, func(ctx context.Context, req interface{}) (interface{}, error) {
+		return c.server.SendMessageToAll(ctx, req.(*sentry.OutboundMessageData))
+	})
+	if err != nil {
+		return nil, err
+	}
+	return reply.(*sentry.SentPeers), nil
 }
 
 func (c *SentryClientDirect) HandShake(ctx context.Context, in *emptypb.Empty, opts ...grpc.CallOption) (*sentry.HandShakeReply, error) {
-	return c.server.HandShake(ctx, in)
+	reply, err := c.call(ctx, "HandShake", in, func(ctx context.Context, req interface{}) (interface{}, error) {
+		return c.server.HandShake(ctx, req.(*emptypb.Empty))
+	})
+	if err != nil {
+		return nil, err
+	}
+	return reply.(*sentry.HandShakeReply), nil
 }
 
 func (c *SentryClientDirect) SetStatus(ctx context.Context, in *sentry.StatusData, opts ...grpc.CallOption) (*sentry.SetStatusReply, error) {
-	return c.server.SetStatus(ctx, in)
+	reply, err := c.call(ctx, "SetStatus", in, func(ctx context.Context, req interface{}) (interface{}, error) {
+		return c.server.SetStatus(ctx, req.(*sentry.StatusData))
+	})
+	if err != nil {
+		return nil, err
+	}
+	return reply.(*sentry.SetStatusReply), nil
 }
 
 func (c *SentryClientDirect) PeerCount(ctx context.Context, in *sentry.PeerCountRequest, opts ...grpc.CallOption) (*sentry.PeerCountReply, error) {
-	return c.server.PeerCount(ctx, in)
+	reply, err := c.call(ctx, "PeerCount", in, func(ctx context.Context, req interface{}) (interface{}, error) {
+		return c.server.PeerCount(ctx, req.(*sentry.PeerCountRequest))
+	})
+	if err != nil {
+		return nil, err
+	}
+	return reply.(*sentry.PeerCountReply), nil
+}
+
+func (c *SentryClientDirect) Version(ctx context.Context, in *emptypb.Empty, opts ...grpc.CallOption) (*types.VersionReply, error) {
+	reply, err := c.call(ctx, "Version", in, func(ctx context.Context, req interface{}) (interface{}, error) {
+		return c.server.Version(ctx, req.(*emptypb.Empty))
+	})
+	if err != nil {
+		return nil, err
+	}
+	return reply.(*types.VersionReply), nil
 }
 
 // SentryReceiveServerDirect implements proto_sentry.Sentry_ReceiveMessagesServer
@@ -217,6 +340,22 @@ func (s *SentryReceiveServerDirect) Send(m *sentry.InboundMessage) error {
 func (s *SentryReceiveServerDirect) Context() context.Context {
 	return s.ctx
 }
+func (s *SentryReceiveServerDirect) SendMsg(m interface{}) error {
+	msg, ok := m.(*sentry.InboundMessage)
+	if !ok {
+		return fmt.Errorf("unexpected message type: %T", m)
+	}
+	return s.Send(msg)
+}
+
+// sentryMessagesServer - Sentry_MessagesServer over stream wrapped by interceptor, for example by grpc_middleware.WrapServerStream
+type sentryMessagesServer struct {
+	grpc.ServerStream
+}
+
+func (s *sentryMessagesServer) Send(m *sentry.InboundMessage) error {
+	return s.SendMsg(m)
+}
 
 type SentryReceiveClientDirect struct {
 	messageCh chan *sentry.InboundMessage
@@ -246,6 +385,22 @@ func (s *SentryReceivePeersServerDirect) Send(m *sentry.PeersReply) error {
 func (s *SentryReceivePeersServerDirect) Context() context.Context {
 	return s.ctx
 }
+func (s *SentryReceivePeersServerDirect) SendMsg(m interface{}) error {
+	msg, ok := m.(*sentry.PeersReply)
+	if !ok {
+		return fmt.Errorf("unexpected message type: %T", m)
+	}
+	return s.Send(msg)
+}
+
+// sentryPeersServer - Sentry_PeersServer over stream wrapped by interceptor
+type sentryPeersServer struct {
+	grpc.ServerStream
+}
+
+func (s *sentryPeersServer) Send(m *sentry.PeersReply) error {
+	return s.SendMsg(m)
+}
 
 type SentryReceivePeersClientDirect struct {
 	ch  chan *sentry.PeersReply
@@ -266,7 +421,14 @@ func (c *SentryClientDirect) Messages(ctx context.Context, in *sentry.MessagesRe
 	messageCh := make(chan *sentry.InboundMessage, 16384)
 	streamServer := &SentryReceiveServerDirect{messageCh: messageCh, ctx: ctx}
 	go func() {
-		if err := c.server.Messages(in, streamServer); err != nil {
+		if err := c.stream("Messages", streamServer, func(srv interface{}, ss grpc.ServerStream) error {
+			// interceptors may wrap stream, for example MessageTracer
+			messagesServer, ok := ss.(sentry.Sentry_MessagesServer)
+			if !ok {
+				messagesServer = &sentryMessagesServer{ss}
+			}
+			return c.server.Messages(in, messagesServer)
+		}); err != nil {
 			c.logger.Printf("Messages returned: %v\n", err)
 		}
 		close(messageCh)
@@ -278,7 +440,13 @@ func (c *SentryClientDirect) Peers(ctx context.Context, in *sentry.PeersRequest,
 	messageCh := make(chan *sentry.PeersReply, 16384)
 	streamServer := &SentryReceivePeersServerDirect{ch: messageCh, ctx: ctx}
 	go func() {
-		if err := c.server.Peers(in, streamServer); err != nil {
+		if err := c.stream("Peers", streamServer, func(srv interface{}, ss grpc.ServerStream) error {
+			peersServer, ok := ss.(sentry.Sentry_PeersServer)
+			if !ok {
+				peersServer = &sentryPeersServer{ss}
+			}
+			return c.server.Peers(in, peersServer)
+		}); err != nil {
 			c.logger.Printf("Peers returned: %v\n", err)
 		}
 		close(messageCh)
@@ -0,0 +1,687 @@
+/*
+   Copyright 2021 Erigon contributors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package direct
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ledgerwatch/erigon-lib/gointerfaces"
+	"github.com/ledgerwatch/erigon-lib/gointerfaces/sentry"
+	"github.com/ledgerwatch/erigon-lib/gointerfaces/types"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/emptypb"
+)
+
+// MaxMultiplexedSentries - sentries of one multiplexer are tracked by bitmask
+const MaxMultiplexedSentries = 64
+
+// maxRoutes - peers learned from inbound messages only (no Peers stream), forgotten when limit reached
+const maxRoutes = 4096
+
+var _ SentryClient = (*SentryMultiplexer)(nil) // compile-time interface check
+
+// SentryMultiplexer - SentryClient over many sentries, so app code can work with them as with one:
+//   - inbound Messages and Peers streams of all ready sentries are merged into one stream, sentries which become ready later are added to it
+//   - peer connected to several sentries reported once: Connect on first sentry, Disconnect after last one
+//   - messages to peer sent via sentry which has this peer, other messages are spread over sentries
+//
+// All sentries must speak same protocol - HandShake fails otherwise.
+type SentryMultiplexer struct {
+	clients []SentryClient
+	next    uint64 // round-robin position, atomic
+
+	lock    sync.RWMutex
+	peers   map[[64]byte]uint64 // peer -> bitmask of sentries, from Peers streams
+	routes  map[[64]byte]uint64 // peer -> bitmask of sentries, from inbound messages
+	tracked int                 // amount of running Peers streams
+
+	readyCheckInterval time.Duration
+}
+
+// DefaultReadyCheckInterval - how often merged streams check readiness of sentries without running stream
+const DefaultReadyCheckInterval = time.Second
+
+func NewSentryMultiplexer(clients []SentryClient) *SentryMultiplexer {
+	if len(clients) > MaxMultiplexedSentries {
+		panic(fmt.Sprintf("sentry multiplexer: too many sentries %d, max %d", len(clients), MaxMultiplexedSentries))
+	}
+	return &SentryMultiplexer{clients: clients, peers: map[[64]byte]uint64{}, routes: map[[64]byte]uint64{}, readyCheckInterval: DefaultReadyCheckInterval}
+}
+
+// SetReadyCheckInterval - must be called before Messages and Peers
+func (m *SentryMultiplexer) SetReadyCheckInterval(d time.Duration) *SentryMultiplexer {
+	if d <= 0 {
+		panic(fmt.Sprintf("sentry multiplexer: non-positive ready check interval %s", d))
+	}
+	m.readyCheckInterval = d
+	return m
+}
+
+func (m *SentryMultiplexer) Clients() []SentryClient { return m.clients }
+
+// Protocol - protocol of first ready sentry, 0 if there are no ready sentries
+func (m *SentryMultiplexer) Protocol() uint {
+	for _, c := range m.clients {
+		if c.Ready() {
+			return c.Protocol()
+		}
+	}
+	return 0
+}
+
+func (m *SentryMultiplexer) Ready() bool {
+	for _, c := range m.clients {
+		if c.Ready() {
+			return true
+		}
+	}
+	return false
+}
+
+func (m *SentryMultiplexer) MarkDisconnected() {
+	for _, c := range m.clients {
+		c.MarkDisconnected()
+	}
+}
+
+// ready - indices of ready sentries, rotated by one on each call
+func (m *SentryMultiplexer) ready() ([]int, error) {
+	if len(m.clients) == 0 {
+		return nil, status.Error(codes.Unavailable, "sentry multiplexer: no sentries")
+	}
+	start := int(atomic.AddUint64(&m.next, 1) % uint64(len(m.clients)))
+	var res []int
+	for j := range m.clients {
+		i := (start + j) % len(m.clients)
+		if m.clients[i].Ready() {
+			res = append(res, i)
+		}
+	}
+	if len(res) == 0 {
+		return nil, status.Error(codes.Unavailable, "sentry multiplexer: no ready sentries")
+	}
+	return res, nil
+}
+
+// owners - indices of ready sentries connected to peer, all ready sentries if peer is unknown
+func (m *SentryMultiplexer) owners(peerID *types.H512) ([]int, error) {
+	ready, err := m.ready()
+	if err != nil {
+		return nil, err
+	}
+	if peerID == nil {
+		return ready, nil
+	}
+	k := peerKey(peerID)
+	m.lock.RLock()
+	mask := m.peers[k] | m.routes[k]
+	m.lock.RUnlock()
+	if mask == 0 {
+		return ready, nil
+	}
+	var res []int
+	for _, i := range ready {
+		if mask&(1<<uint(i)) != 0 {
+			res = append(res, i)
+		}
+	}
+	if len(res) == 0 {
+		return ready, nil
+	}
+	return res, nil
+}
+
+func peerKey(peerID *types.H512) [64]byte {
+	return gointerfaces.ConvertH512ToArray(peerID)
+}
+
+// HandShake - handshakes all sentries, succeeds if at least one of them succeeded
+func (m *SentryMultiplexer) HandShake(ctx context.Context, in *emptypb.Empty, opts ...grpc.CallOption) (*sentry.HandShakeReply, error) {
+	var reply *sentry.HandShakeReply
+	var protocol uint
+	var firstErr error
+	for _, c := range m.clients {
+		r, err := c.HandShake(ctx, in, opts...)
+		if err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		if reply == nil {
+			reply, protocol = r, c.Protocol()
+			continue
+		}
+		if c.Protocol() != protocol {
+			return nil, fmt.Errorf("sentry multiplexer: sentries speak different protocols: %d and %d", protocol, c.Protocol())
+		}
+	}
+	if reply == nil {
+		return nil, firstErr
+	}
+	return reply, nil
+}
+
+// SetStatus - sends status to all sentries, ready or not
+func (m *SentryMultiplexer) SetStatus(ctx context.Context, in *sentry.StatusData, opts ...grpc.CallOption) (*sentry.SetStatusReply, error) {
+	var reply *sentry.SetStatusReply
+	var firstErr error
+	for _, c := range m.clients {
+		r, err := c.SetStatus(ctx, in, opts...)
+		if err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		if reply == nil {
+			reply = r
+		}
+	}
+	if firstErr != nil {
+		return nil, firstErr
+	}
+	return reply, nil
+}
+
+func (m *SentryMultiplexer) PenalizePeer(ctx context.Context, in *sentry.PenalizePeerRequest, opts ...grpc.CallOption) (*emptypb.Empty, error) {
+	owners, err := m.owners(in.PeerId)
+	if err != nil {
+		return nil, err
+	}
+	for _, i := range owners {
+		if _, err := m.clients[i].PenalizePeer(ctx, in, opts...); err != nil {
+			return nil, err
+		}
+	}
+	return &emptypb.Empty{}, nil
+}
+
+func (m *SentryMultiplexer) PeerMinBlock(ctx context.Context, in *sentry.PeerMinBlockRequest, opts ...grpc.CallOption) (*emptypb.Empty, error) {
+	owners, err := m.owners(in.PeerId)
+	if err != nil {
+		return nil, err
+	}
+	for _, i := range owners {
+		if _, err := m.clients[i].PeerMinBlock(ctx, in, opts...); err != nil {
+			return nil, err
+		}
+	}
+	return &emptypb.Empty{}, nil
+}
+
+// SendMessageById - sends via sentries connected to peer until one of them reports sent message
+func (m *SentryMultiplexer) SendMessageById(ctx context.Context, in *sentry.SendMessageByIdRequest, opts ...grpc.CallOption) (*sentry.SentPeers, error) {
+	owners, err := m.owners(in.PeerId)
+	if err != nil {
+		return nil, err
+	}
+	return m.sendToFirst(owners, func(c SentryClient) (*sentry.SentPeers, error) {
+		return c.SendMessageById(ctx, in, opts...)
+	})
+}
+
+// SendMessageByMinBlock - sends via sentries in round-robin order until one of them reports sent message
+func (m *SentryMultiplexer) SendMessageByMinBlock(ctx context.Context, in *sentry.SendMessageByMinBlockRequest, opts ...grpc.CallOption) (*sentry.SentPeers, error) {
+	ready, err := m.ready()
+	if err != nil {
+		return nil, err
+	}
+	return m.sendToFirst(ready, func(c SentryClient) (*sentry.SentPeers, error) {
+		return c.SendMessageByMinBlock(ctx, in, opts...)
+	})
+}
+
+func (m *SentryMultiplexer) sendToFirst(indices []int, send func(c SentryClient) (*sentry.SentPeers, error)) (*sentry.SentPeers, error) {
+	var lastErr error
+	for _, i := range indices {
+		reply, err := send(m.clients[i])
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		if len(reply.GetPeers()) > 0 {
+			return reply, nil
+		}
+	}
+	if lastErr != nil {
+		return nil, lastErr
+	}
+	return &sentry.SentPeers{}, nil
+}
+
+// SendMessageToRandomPeers - splits MaxPeers between ready sentries, remainder goes to sentries in round-robin order
+func (m *SentryMultiplexer) SendMessageToRandomPeers(ctx context.Context, in *sentry.SendMessageToRandomPeersRequest, opts ...grpc.CallOption) (*sentry.SentPeers, error) {
+	ready, err := m.ready()
+	if err != nil {
+		return nil, err
+	}
+	share, rest := in.MaxPeers/uint64(len(ready)), in.MaxPeers%uint64(len(ready))
+	replies := make([]*sentry.SentPeers, 0, len(ready))
+	for j, i := range ready {
+		maxPeers := share
+		if uint64(j) < rest {
+			maxPeers++
+		}
+		if maxPeers == 0 {
+			break
+		}
+		reply, err := m.clients[i].SendMessageToRandomPeers(ctx, &sentry.SendMessageToRandomPeersRequest{Data: in.Data, MaxPeers: maxPeers}, opts...)
+		if err != nil {
+			return nil, err
+		}
+		replies = append(replies, reply)
+	}
+	return mergeSentPeers(replies), nil
+}
+
+// SendMessageToAll - sends via all ready sentries, peer connected to several sentries will receive message from each
+func (m *SentryMultiplexer) SendMessageToAll(ctx context.Context, in *sentry.OutboundMessageData, opts ...grpc.CallOption) (*sentry.SentPeers, error) {
+	ready, err := m.ready()
+	if err != nil {
+		return nil, err
+	}
+	replies := make([]*sentry.SentPeers, 0, len(ready))
+	for _, i := range ready {
+		reply, err := m.clients[i].SendMessageToAll(ctx, in, opts...)
+		if err != nil {
+			return nil, err
+		}
+		replies = append(replies, reply)
+	}
+	return mergeSentPeers(replies), nil
+}
+
+// Version - lowest version of ready sentries: interface supported by all of them
+func (m *SentryMultiplexer) Version(ctx context.Context, in *emptypb.Empty, opts ...grpc.CallOption) (*types.VersionReply, error) {
+	ready, err := m.ready()
+	if err != nil {
+		return nil, err
+	}
+	var lowest *types.VersionReply
+	for _, i := range ready {
+		reply, err := m.clients[i].Version(ctx, in, opts...)
+		if err != nil {
+			return nil, err
+		}
+		if lowest == nil || gointerfaces.VersionFromProto(reply).Less(gointerfaces.VersionFromProto(lowest)) {
+			lowest = reply
+		}
+	}
+	return lowest, nil
+}
+
+// mergeSentPeers - union of peers, without duplicates
+func mergeSentPeers(replies []*sentry.SentPeers) *sentry.SentPeers {
+	res := &sentry.SentPeers{}
+	seen := map[[64]byte]struct{}{}
+	for _, reply := range replies {
+		for _, peerID := range reply.GetPeers() {
+			if peerID == nil {
+				res.Peers = append(res.Peers, peerID)
+				continue
+			}
+			k := peerKey(peerID)
+			if _, ok := seen[k]; ok {
+				continue
+			}
+			seen[k] = struct{}{}
+			res.Peers = append(res.Peers, peerID)
+		}
+	}
+	return res
+}
+
+// PeerCount - amount of unique peers while Peers stream is running, sum of sentries counts otherwise
+func (m *SentryMultiplexer) PeerCount(ctx context.Context, in *sentry.PeerCountRequest, opts ...grpc.CallOption) (*sentry.PeerCountReply, error) {
+	m.lock.RLock()
+	tracked, count := m.tracked > 0, len(m.peers)
+	m.lock.RUnlock()
+	if tracked {
+		return &sentry.PeerCountReply{Count: uint64(count)}, nil
+	}
+	ready, err := m.ready()
+	if err != nil {
+		return nil, err
+	}
+	var sum uint64
+	for _, i := range ready {
+		reply, err := m.clients[i].PeerCount(ctx, in, opts...)
+		if err != nil {
+			return nil, err
+		}
+		sum += reply.GetCount()
+	}
+	return &sentry.PeerCountReply{Count: sum}, nil
+}
+
+// route - remembers sentry which delivered message from peer
+func (m *SentryMultiplexer) route(peerID *types.H512, i int) {
+	if peerID == nil {
+		return
+	}
+	k := peerKey(peerID)
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if m.routes[k]&(1<<uint(i)) != 0 {
+		return
+	}
+	if len(m.routes) >= maxRoutes {
+		m.routes = map[[64]byte]uint64{}
+	}
+	m.routes[k] |= 1 << uint(i)
+}
+
+// peerEvent - applies event of i-th sentry, returns false if event must not be forwarded:
+// peer already connected via other sentry, or still connected via other sentry
+func (m *SentryMultiplexer) peerEvent(event *sentry.PeersReply, i int) bool {
+	if event.PeerId == nil {
+		return true
+	}
+	k := peerKey(event.PeerId)
+	bit := uint64(1) << uint(i)
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	switch event.Event {
+	case sentry.PeersReply_Connect:
+		was := m.peers[k]
+		m.peers[k] = was | bit
+		return was == 0
+	case sentry.PeersReply_Disconnect:
+		was, ok := m.peers[k]
+		if routes := m.routes[k] &^ bit; routes == 0 {
+			delete(m.routes, k)
+		} else {
+			m.routes[k] = routes
+		}
+		if !ok || was&bit == 0 {
+			return false
+		}
+		if was &^= bit; was != 0 {
+			m.peers[k] = was
+			return false
+		}
+		delete(m.peers, k)
+		return true
+	}
+	return true
+}
+
+// fanIn - state of merged stream: streams of sentries which become ready later are added to it,
+// stopped stream of one sentry doesn't stop others and is opened again when sentry is ready.
+// Merged stream ends when ctx is done or when streams of all sentries stopped.
+type fanIn struct {
+	ctx     context.Context
+	cancel  context.CancelFunc
+	wg      sync.WaitGroup
+	lock    sync.Mutex
+	running uint64 // bitmask of sentries with running stream
+	err     error  // error of last stopped stream
+	open    func(i int) (run func() error, err error)
+}
+
+func newFanIn(ctx context.Context, open func(i int) (run func() error, err error)) *fanIn {
+	f := &fanIn{open: open}
+	f.ctx, f.cancel = context.WithCancel(ctx)
+	return f
+}
+
+func (f *fanIn) isRunning(i int) bool {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	return f.running&(1<<uint(i)) != 0
+}
+
+// start - opens stream of i-th sentry and runs it until it stops
+func (f *fanIn) start(i int) error {
+	run, err := f.open(i)
+	if err != nil {
+		return err
+	}
+	f.lock.Lock()
+	f.running |= 1 << uint(i)
+	f.lock.Unlock()
+	f.wg.Add(1)
+	go func() {
+		defer f.wg.Done()
+		f.stopped(i, run())
+	}()
+	return nil
+}
+
+func (f *fanIn) stopped(i int, err error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	f.running &^= 1 << uint(i)
+	f.err = err
+	if f.running == 0 {
+		f.cancel()
+	}
+}
+
+func (f *fanIn) Err() error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	return f.err
+}
+
+// run - starts streams of ready sentries, then watches readiness of other sentries until merged stream ends.
+// done is called after all streams stopped.
+func (m *SentryMultiplexer) run(f *fanIn, ready []int, done func()) error {
+	for _, i := range ready {
+		if err := f.start(i); err != nil {
+			f.cancel()
+			f.wg.Wait()
+			return err
+		}
+	}
+	go func() {
+		ticker := time.NewTicker(m.readyCheckInterval)
+		defer ticker.Stop()
+	loop:
+		for {
+			select {
+			case <-f.ctx.Done():
+				break loop
+			case <-ticker.C:
+			}
+			for i, c := range m.clients {
+				if f.isRunning(i) || !c.Ready() {
+					continue
+				}
+				if err := f.start(i); err != nil {
+					continue // will try again on next check
+				}
+			}
+		}
+		f.wg.Wait()
+		done()
+	}()
+	return nil
+}
+
+// Messages - merged stream of inbound messages of all ready sentries, see fanIn
+func (m *SentryMultiplexer) Messages(ctx context.Context, in *sentry.MessagesRequest, opts ...grpc.CallOption) (sentry.Sentry_MessagesClient, error) {
+	ready, err := m.ready()
+	if err != nil {
+		return nil, err
+	}
+	ch := make(chan *sentry.InboundMessage, 16384)
+	var f *fanIn
+	f = newFanIn(ctx, func(i int) (func() error, error) {
+		// sentry clients filter ids of request in-place
+		req := &sentry.MessagesRequest{Ids: append([]sentry.MessageId(nil), in.Ids...)}
+		stream, err := m.clients[i].Messages(f.ctx, req, opts...)
+		if err != nil {
+			return nil, err
+		}
+		return func() error {
+			for {
+				msg, err := stream.Recv()
+				if err != nil {
+					return err
+				}
+				if msg == nil {
+					return nil
+				}
+				m.route(msg.PeerId, i)
+				select {
+				case ch <- msg:
+				case <-f.ctx.Done():
+					return nil
+				}
+			}
+		}, nil
+	})
+	if err := m.run(f, ready, func() { close(ch) }); err != nil {
+		return nil, err
+	}
+	return &SentryMessagesClientMultiplexer{ch: ch, f: f, ctx: ctx}, nil
+}
+
+// Peers - merged stream of peer events of all ready sentries, see peerEvent.
+// When stream of sentry stops, its peers are forgotten: Disconnect sent for peers not connected via other sentries.
+func (m *SentryMultiplexer) Peers(ctx context.Context, in *sentry.PeersRequest, opts ...grpc.CallOption) (sentry.Sentry_PeersClient, error) {
+	ready, err := m.ready()
+	if err != nil {
+		return nil, err
+	}
+	ch := make(chan *sentry.PeersReply, 16384)
+	var f *fanIn
+	f = newFanIn(ctx, func(i int) (func() error, error) {
+		stream, err := m.clients[i].Peers(f.ctx, in, opts...)
+		if err != nil {
+			return nil, err
+		}
+		return func() error {
+			err := m.recvPeers(f.ctx, stream, i, ch)
+			events := m.dropSentry(i)
+			if f.ctx.Err() != nil { // merged stream ends, nobody to notify
+				return err
+			}
+			for _, event := range events {
+				select {
+				case ch <- event:
+				case <-f.ctx.Done():
+					return err
+				}
+			}
+			return err
+		}, nil
+	})
+	m.lock.Lock()
+	m.tracked++
+	m.lock.Unlock()
+	if err := m.run(f, ready, func() {
+		m.lock.Lock()
+		if m.tracked--; m.tracked == 0 {
+			m.peers = map[[64]byte]uint64{}
+		}
+		m.lock.Unlock()
+		close(ch)
+	}); err != nil {
+		m.lock.Lock()
+		m.tracked--
+		m.lock.Unlock()
+		return nil, err
+	}
+	return &SentryPeersClientMultiplexer{ch: ch, f: f, ctx: ctx}, nil
+}
+
+func (m *SentryMultiplexer) recvPeers(ctx context.Context, stream sentry.Sentry_PeersClient, i int, ch chan *sentry.PeersReply) error {
+	for {
+		event, err := stream.Recv()
+		if err != nil {
+			return err
+		}
+		if event == nil {
+			return nil
+		}
+		if !m.peerEvent(event, i) {
+			continue
+		}
+		select {
+		case ch <- event:
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+// dropSentry - forgets peers of i-th sentry, returns Disconnect events for peers not connected via other sentries
+func (m *SentryMultiplexer) dropSentry(i int) (events []*sentry.PeersReply) {
+	bit := uint64(1) << uint(i)
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	for k, mask := range m.peers {
+		if mask&bit == 0 {
+			continue
+		}
+		if mask &^= bit; mask != 0 {
+			m.peers[k] = mask
+			continue
+		}
+		delete(m.peers, k)
+		events = append(events, &sentry.PeersReply{PeerId: gointerfaces.ConvertBytesToH512(k[:]), Event: sentry.PeersReply_Disconnect})
+	}
+	return events
+}
+
+// SentryMessagesClientMultiplexer implements sentry.Sentry_MessagesClient
+type SentryMessagesClientMultiplexer struct {
+	ch  chan *sentry.InboundMessage
+	f   *fanIn
+	ctx context.Context
+	grpc.ClientStream
+}
+
+// Recv - returns error of last stopped sentry stream after streams of all sentries stopped
+func (c *SentryMessagesClientMultiplexer) Recv() (*sentry.InboundMessage, error) {
+	m, ok := <-c.ch
+	if !ok {
+		return nil, c.f.Err()
+	}
+	return m, nil
+}
+func (c *SentryMessagesClientMultiplexer) Context() context.Context {
+	return c.ctx
+}
+
+// SentryPeersClientMultiplexer implements sentry.Sentry_PeersClient
+type SentryPeersClientMultiplexer struct {
+	ch  chan *sentry.PeersReply
+	f   *fanIn
+	ctx context.Context
+	grpc.ClientStream
+}
+
+func (c *SentryPeersClientMultiplexer) Recv() (*sentry.PeersReply, error) {
+	m, ok := <-c.ch
+	if !ok {
+		return nil, c.f.Err()
+	}
+	return m, nil
+}
+func (c *SentryPeersClientMultiplexer) Context() context.Context {
+	return c.ctx
+}
@@ -0,0 +1,219 @@
+/*
+   Copyright 2021 Erigon contributors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package direct_test
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ledgerwatch/erigon-lib/direct"
+	"github.com/ledgerwatch/erigon-lib/gointerfaces"
+	"github.com/ledgerwatch/erigon-lib/gointerfaces/sentry"
+	"github.com/ledgerwatch/erigon-lib/gointerfaces/types"
+	"github.com/ledgerwatch/erigon-lib/txpool"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+)
+
+func toPeerIDs(h ...int) (out []*types.H512) {
+	for i := range h {
+		out = append(out, gointerfaces.ConvertBytesToH512([]byte(fmt.Sprintf("%x", h[i]))))
+	}
+	return out
+}
+
+func TestSentryMultiplexer(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	require := require.New(t)
+
+	m1, m2 := txpool.NewMockSentry(ctx), txpool.NewMockSentry(ctx)
+	for _, m := range []*txpool.MockSentry{m1, m2} {
+		m.PeerCountFunc = func(context.Context, *sentry.PeerCountRequest) (*sentry.PeerCountReply, error) {
+			return &sentry.PeerCountReply{Count: 2}, nil
+		}
+	}
+	mux := direct.NewSentryMultiplexer([]direct.SentryClient{direct.NewSentryClientDirect(direct.ETH66, m1), direct.NewSentryClientDirect(direct.ETH66, m2)})
+
+	// without Peers stream counts of sentries are summed
+	count, err := mux.PeerCount(ctx, &sentry.PeerCountRequest{})
+	require.NoError(err)
+	require.Equal(uint64(4), count.Count)
+
+	m1.StreamWg.Add(1)
+	m2.StreamWg.Add(1)
+	stream, err := mux.Peers(ctx, &sentry.PeersRequest{})
+	require.NoError(err)
+	m1.StreamWg.Wait()
+	m2.StreamWg.Wait()
+
+	// peer connected to both sentries is reported once
+	peers := toPeerIDs(1, 2)
+	for _, m := range []*txpool.MockSentry{m1, m2} {
+		for _, err := range m.SendPeerEvent(&sentry.PeersReply{PeerId: peers[0], Event: sentry.PeersReply_Connect}) {
+			require.NoError(err)
+		}
+	}
+	for _, err := range m2.SendPeerEvent(&sentry.PeersReply{PeerId: peers[1], Event: sentry.PeersReply_Connect}) {
+		require.NoError(err)
+	}
+	for _, id := range peers {
+		event, err := stream.Recv()
+		require.NoError(err)
+		require.Equal(gointerfaces.ConvertH512ToArray(id), gointerfaces.ConvertH512ToArray(event.PeerId))
+	}
+	count, err = mux.PeerCount(ctx, &sentry.PeerCountRequest{})
+	require.NoError(err)
+	require.Equal(uint64(2), count.Count)
+
+	// message goes to the only sentry which has the peer
+	_, err = mux.SendMessageById(ctx, &sentry.SendMessageByIdRequest{PeerId: peers[1], Data: &sentry.OutboundMessageData{Id: sentry.MessageId_GET_POOLED_TRANSACTIONS_66}})
+	require.NoError(err)
+	require.Equal(0, len(m1.SendMessageByIdCalls()))
+	require.Equal(1, len(m2.SendMessageByIdCalls()))
+	require.Equal(sentry.MessageId_GET_POOLED_TRANSACTIONS_66, m2.SendMessageByIdCalls()[0].SendMessageByIdRequest.Data.Id)
+
+	// random peers are spread over sentries
+	_, err = mux.SendMessageToRandomPeers(ctx, &sentry.SendMessageToRandomPeersRequest{Data: &sentry.OutboundMessageData{}, MaxPeers: 3})
+	require.NoError(err)
+	total := uint64(0)
+	for _, m := range []*txpool.MockSentry{m1, m2} {
+		calls := m.SendMessageToRandomPeersCalls()
+		require.Equal(1, len(calls))
+		total += calls[0].SendMessageToRandomPeersRequest.MaxPeers
+	}
+	require.Equal(uint64(3), total)
+}
+
+// switchableSentry - sentry client with controlled readiness, stop ends its running streams
+type switchableSentry struct {
+	direct.SentryClient
+	ready   int32
+	lock    sync.Mutex
+	cancels []context.CancelFunc
+}
+
+func (s *switchableSentry) Ready() bool { return atomic.LoadInt32(&s.ready) == 1 }
+func (s *switchableSentry) setReady(ready bool) {
+	var v int32
+	if ready {
+		v = 1
+	}
+	atomic.StoreInt32(&s.ready, v)
+}
+func (s *switchableSentry) withCancel(ctx context.Context) context.Context {
+	ctx, cancel := context.WithCancel(ctx)
+	s.lock.Lock()
+	s.cancels = append(s.cancels, cancel)
+	s.lock.Unlock()
+	return ctx
+}
+func (s *switchableSentry) stop() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	for _, cancel := range s.cancels {
+		cancel()
+	}
+	s.cancels = nil
+}
+func (s *switchableSentry) Messages(ctx context.Context, in *sentry.MessagesRequest, opts ...grpc.CallOption) (sentry.Sentry_MessagesClient, error) {
+	return s.SentryClient.Messages(s.withCancel(ctx), in, opts...)
+}
+func (s *switchableSentry) Peers(ctx context.Context, in *sentry.PeersRequest, opts ...grpc.CallOption) (sentry.Sentry_PeersClient, error) {
+	return s.SentryClient.Peers(s.withCancel(ctx), in, opts...)
+}
+
+func TestSentryMultiplexerStreams(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	require := require.New(t)
+
+	m1, m2 := txpool.NewMockSentry(ctx), txpool.NewMockSentry(ctx)
+	s1 := &switchableSentry{SentryClient: direct.NewSentryClientDirect(direct.ETH66, m1), ready: 1}
+	s2 := &switchableSentry{SentryClient: direct.NewSentryClientDirect(direct.ETH66, m2)}
+	mux := direct.NewSentryMultiplexer([]direct.SentryClient{s1, s2}).SetReadyCheckInterval(time.Millisecond)
+
+	m1.StreamWg.Add(2)
+	messages, err := mux.Messages(ctx, &sentry.MessagesRequest{Ids: []sentry.MessageId{sentry.MessageId_NEW_POOLED_TRANSACTION_HASHES_66}})
+	require.NoError(err)
+	peers, err := mux.Peers(ctx, &sentry.PeersRequest{})
+	require.NoError(err)
+	m1.StreamWg.Wait()
+
+	// sentry which became ready later is added to running streams
+	m2.StreamWg.Add(2)
+	s2.setReady(true)
+	m2.StreamWg.Wait()
+	msg := &sentry.InboundMessage{Id: sentry.MessageId_NEW_POOLED_TRANSACTION_HASHES_66, PeerId: txpool.PeerId}
+	for _, err := range m2.Send(msg) {
+		require.NoError(err)
+	}
+	got, err := messages.Recv()
+	require.NoError(err)
+	require.Equal(msg.Id, got.Id)
+
+	ids := toPeerIDs(1, 2)
+	for _, err := range m2.SendPeerEvent(&sentry.PeersReply{PeerId: ids[0], Event: sentry.PeersReply_Connect}) {
+		require.NoError(err)
+	}
+	event, err := peers.Recv()
+	require.NoError(err)
+	require.Equal(sentry.PeersReply_Connect, event.Event)
+	for _, id := range ids {
+		for _, err := range m1.SendPeerEvent(&sentry.PeersReply{PeerId: id, Event: sentry.PeersReply_Connect}) {
+			require.NoError(err)
+		}
+	}
+	event, err = peers.Recv() // ids[0] already connected via s2
+	require.NoError(err)
+	require.Equal(gointerfaces.ConvertH512ToArray(ids[1]), gointerfaces.ConvertH512ToArray(event.PeerId))
+
+	// failed sentry doesn't stop others, its peers are disconnected unless connected via other sentry
+	s1.setReady(false)
+	s1.stop()
+	event, err = peers.Recv()
+	require.NoError(err)
+	require.Equal(sentry.PeersReply_Disconnect, event.Event)
+	require.Equal(gointerfaces.ConvertH512ToArray(ids[1]), gointerfaces.ConvertH512ToArray(event.PeerId))
+	for _, err := range m2.Send(msg) {
+		require.NoError(err)
+	}
+	got, err = messages.Recv()
+	require.NoError(err)
+	require.Equal(msg.Id, got.Id)
+	count, err := mux.PeerCount(ctx, &sentry.PeerCountRequest{})
+	require.NoError(err)
+	require.Equal(uint64(1), count.Count)
+
+	// failed sentry is added back when ready again
+	m1.StreamWg.Add(2)
+	s1.setReady(true)
+	m1.StreamWg.Wait()
+
+	// merged stream ends after streams of all sentries stopped
+	s1.setReady(false)
+	s2.setReady(false)
+	s1.stop()
+	s2.stop()
+	got, err = messages.Recv()
+	require.NoError(err)
+	require.Nil(got)
+}
@@ -0,0 +1,220 @@
+/*
+   Copyright 2021 Erigon contributors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package direct
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ledgerwatch/erigon-lib/gointerfaces/sentry"
+	"google.golang.org/grpc"
+)
+
+type MessageDirection uint8
+
+const (
+	Inbound MessageDirection = iota
+	Outbound
+)
+
+func (d MessageDirection) String() string {
+	if d == Inbound {
+		return "in"
+	}
+	return "out"
+}
+
+// MessageRecord - one traced devp2p message
+type MessageRecord struct {
+	Time      time.Time
+	Direction MessageDirection
+	Method    string   // Messages for inbound, Send* for outbound
+	Peer      [64]byte // zero if message sent not to one peer
+	Id        sentry.MessageId
+	Size      int
+	Peers     int           // outbound only: amount of peers message was sent to
+	Latency   time.Duration // outbound only: duration of call
+	Err       error
+}
+
+func (r MessageRecord) String() string {
+	return fmt.Sprintf("%s %s %s peer=%x id=%s size=%d peers=%d latency=%s err=%v",
+		r.Time.UTC().Format(time.RFC3339Nano), r.Direction, r.Method, r.Peer[:], r.Id, r.Size, r.Peers, r.Latency, r.Err)
+}
+
+// MessageTracer - records inbound and outbound sentry messages into ring buffer and optional output (one line per message).
+// Works as interceptors of SentryClientDirect (see SetInterceptors) or of sentry gRPC server.
+// Disabled tracer costs one atomic load per call, so it can stay installed in production and be enabled when needed.
+type MessageTracer struct {
+	enabled int32
+
+	lock      sync.Mutex
+	records   []MessageRecord
+	next      int
+	full      bool
+	out       io.Writer
+	outputErr error
+}
+
+func NewMessageTracer(capacity int) *MessageTracer {
+	if capacity < 1 {
+		capacity = 1
+	}
+	return &MessageTracer{records: make([]MessageRecord, capacity)}
+}
+
+func (t *MessageTracer) SetEnabled(enabled bool) {
+	var v int32
+	if enabled {
+		v = 1
+	}
+	atomic.StoreInt32(&t.enabled, v)
+}
+
+func (t *MessageTracer) Enabled() bool { return atomic.LoadInt32(&t.enabled) == 1 }
+
+// SetOutput - w receives every record as text line, nil - ring buffer only.
+// After first write error output is dropped, error available by OutputErr
+func (t *MessageTracer) SetOutput(w io.Writer) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	t.out, t.outputErr = w, nil
+}
+
+func (t *MessageTracer) OutputErr() error {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	return t.outputErr
+}
+
+// Records - content of ring buffer, oldest first
+func (t *MessageTracer) Records() []MessageRecord {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	if !t.full {
+		return append([]MessageRecord(nil), t.records[:t.next]...)
+	}
+	res := make([]MessageRecord, 0, len(t.records))
+	res = append(res, t.records[t.next:]...)
+	return append(res, t.records[:t.next]...)
+}
+
+func (t *MessageTracer) Reset() {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	t.next, t.full = 0, false
+}
+
+func (t *MessageTracer) record(r MessageRecord) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	t.records[t.next] = r
+	if t.next++; t.next == len(t.records) {
+		t.next, t.full = 0, true
+	}
+	if t.out == nil {
+		return
+	}
+	if _, err := io.WriteString(t.out, r.String()+"\n"); err != nil {
+		t.out, t.outputErr = nil, err
+	}
+}
+
+func methodName(fullMethod string) string {
+	return fullMethod[strings.LastIndex(fullMethod, "/")+1:]
+}
+
+// UnaryServerInterceptor - traces outbound messages: Send* methods of sentry
+func (t *MessageTracer) UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if !t.Enabled() {
+			return handler(ctx, req)
+		}
+		r := MessageRecord{Time: time.Now(), Direction: Outbound, Method: methodName(info.FullMethod)}
+		var data *sentry.OutboundMessageData
+		switch req := req.(type) {
+		case *sentry.SendMessageByIdRequest:
+			data = req.Data
+			if req.PeerId != nil {
+				r.Peer = peerKey(req.PeerId)
+			}
+		case *sentry.SendMessageByMinBlockRequest:
+			data = req.Data
+		case *sentry.SendMessageToRandomPeersRequest:
+			data = req.Data
+		case *sentry.OutboundMessageData:
+			data = req
+		default:
+			return handler(ctx, req)
+		}
+		r.Id, r.Size = data.GetId(), len(data.GetData())
+		reply, err := handler(ctx, req)
+		r.Latency, r.Err = time.Since(r.Time), err
+		if sent, ok := reply.(*sentry.SentPeers); ok {
+			r.Peers = len(sent.GetPeers())
+		}
+		t.record(r)
+		return reply, err
+	}
+}
+
+// StreamServerInterceptor - traces inbound messages: Messages stream of sentry
+func (t *MessageTracer) StreamServerInterceptor() grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if methodName(info.FullMethod) != "Messages" {
+			return handler(srv, ss)
+		}
+		return handler(srv, &tracedMessagesServer{ServerStream: ss, t: t})
+	}
+}
+
+// tracedMessagesServer - gRPC server stream calls SendMsg, direct stream calls Send
+type tracedMessagesServer struct {
+	grpc.ServerStream
+	t *MessageTracer
+}
+
+func (s *tracedMessagesServer) trace(m *sentry.InboundMessage) {
+	if !s.t.Enabled() {
+		return
+	}
+	r := MessageRecord{Time: time.Now(), Direction: Inbound, Method: "Messages", Id: m.Id, Size: len(m.Data)}
+	if m.PeerId != nil {
+		r.Peer = peerKey(m.PeerId)
+	}
+	s.t.record(r)
+}
+
+func (s *tracedMessagesServer) Send(m *sentry.InboundMessage) error {
+	s.trace(m)
+	if ms, ok := s.ServerStream.(sentry.Sentry_MessagesServer); ok {
+		return ms.Send(m)
+	}
+	return s.ServerStream.SendMsg(m)
+}
+
+func (s *tracedMessagesServer) SendMsg(m interface{}) error {
+	if msg, ok := m.(*sentry.InboundMessage); ok {
+		s.trace(msg)
+	}
+	return s.ServerStream.SendMsg(m)
+}
@@ -0,0 +1,87 @@
+/*
+   Copyright 2021 Erigon contributors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package direct_test
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/ledgerwatch/erigon-lib/direct"
+	"github.com/ledgerwatch/erigon-lib/gointerfaces"
+	"github.com/ledgerwatch/erigon-lib/gointerfaces/sentry"
+	"github.com/ledgerwatch/erigon-lib/txpool"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMessageTracer(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	require := require.New(t)
+
+	m := txpool.NewMockSentry(ctx)
+	sentryClient := direct.NewSentryClientDirect(direct.ETH66, m)
+	tracer := direct.NewMessageTracer(2)
+	sentryClient.SetInterceptors(tracer.UnaryServerInterceptor(), tracer.StreamServerInterceptor())
+	var out bytes.Buffer
+	tracer.SetOutput(&out)
+
+	m.StreamWg.Add(1)
+	stream, err := sentryClient.Messages(ctx, &sentry.MessagesRequest{Ids: []sentry.MessageId{sentry.MessageId_NEW_POOLED_TRANSACTION_HASHES_66}})
+	require.NoError(err)
+	m.StreamWg.Wait()
+
+	// inbound message from peer is answered by request to the same peer
+	exchange := func() {
+		for _, err := range m.Send(&sentry.InboundMessage{Id: sentry.MessageId_NEW_POOLED_TRANSACTION_HASHES_66, Data: make([]byte, 34), PeerId: txpool.PeerId}) {
+			require.NoError(err)
+		}
+		msg, err := stream.Recv()
+		require.NoError(err)
+		_, err = sentryClient.SendMessageById(ctx, &sentry.SendMessageByIdRequest{PeerId: msg.PeerId, Data: &sentry.OutboundMessageData{Id: sentry.MessageId_GET_POOLED_TRANSACTIONS_66, Data: make([]byte, 3)}})
+		require.NoError(err)
+	}
+	exchange()
+	require.Equal(0, len(tracer.Records()))
+
+	tracer.SetEnabled(true)
+	exchange()
+	records := tracer.Records()
+	require.Equal(2, len(records))
+	require.Equal(direct.Inbound, records[0].Direction)
+	require.Equal("Messages", records[0].Method)
+	require.Equal(sentry.MessageId_NEW_POOLED_TRANSACTION_HASHES_66, records[0].Id)
+	require.Equal(34, records[0].Size)
+	require.Equal(gointerfaces.ConvertH512ToArray(txpool.PeerId), records[0].Peer)
+	require.Equal(direct.Outbound, records[1].Direction)
+	require.Equal("SendMessageById", records[1].Method)
+	require.Equal(sentry.MessageId_GET_POOLED_TRANSACTIONS_66, records[1].Id)
+	require.Equal(3, records[1].Size)
+	require.Equal(records[0].Peer, records[1].Peer)
+	require.Equal(2, strings.Count(out.String(), "\n"))
+	require.NoError(tracer.OutputErr())
+
+	// ring buffer keeps last records
+	exchange()
+	require.Equal(2, len(tracer.Records()))
+	require.True(tracer.Records()[0].Time.After(records[1].Time))
+	require.Equal(4, strings.Count(out.String(), "\n"))
+
+	tracer.Reset()
+	require.Equal(0, len(tracer.Records()))
+}
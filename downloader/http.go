@@ -0,0 +1,214 @@
+/*
+   Copyright 2021 Erigon contributors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package downloader
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/ledgerwatch/erigon-lib/common/parallel"
+)
+
+// HTTPConfig - HTTPFetcher downloads files from BaseURL + "/" + name, including ManifestFileName
+type HTTPConfig struct {
+	BaseURL   string
+	Dir       string
+	Client    *http.Client
+	ChunkSize int64 // size of Range request, unit of resume
+	Workers   int   // parallel Range requests of one file
+}
+
+var DefaultHTTPConfig = HTTPConfig{
+	Client:    http.DefaultClient,
+	ChunkSize: 64 * 1024 * 1024,
+	Workers:   4,
+}
+
+// HTTPFetcher - downloads segment files over plain HTTP(S), for environments where BitTorrent is blocked.
+// File is downloaded by parallel Range requests into name+".part" file, finished chunks are remembered in
+// name+".chunks" file - interrupted download is resumed from them. File gets its name only after
+// verification against manifest
+type HTTPFetcher struct {
+	cfg HTTPConfig
+}
+
+func NewHTTPFetcher(cfg HTTPConfig) *HTTPFetcher {
+	if cfg.Client == nil {
+		cfg.Client = DefaultHTTPConfig.Client
+	}
+	if cfg.ChunkSize <= 0 {
+		cfg.ChunkSize = DefaultHTTPConfig.ChunkSize
+	}
+	if cfg.Workers <= 0 {
+		cfg.Workers = DefaultHTTPConfig.Workers
+	}
+	return &HTTPFetcher{cfg: cfg}
+}
+
+func (f *HTTPFetcher) url(name string) string { return f.cfg.BaseURL + "/" + name }
+
+// Manifest - fetches manifest of remote directory
+func (f *HTTPFetcher) Manifest(ctx context.Context) (*Manifest, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, f.url(ManifestFileName), nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := f.cfg.Client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("fetch manifest: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("fetch manifest: %s", resp.Status)
+	}
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("fetch manifest: %w", err)
+	}
+	return parseManifest(b)
+}
+
+// FetchAll - fetches all files of manifest, which are missing or don't match it, and writes manifest to Dir
+func (f *HTTPFetcher) FetchAll(ctx context.Context, m *Manifest) error {
+	for _, e := range m.Files {
+		if err := f.Fetch(ctx, e); err != nil {
+			return err
+		}
+	}
+	return WriteManifest(f.cfg.Dir, m)
+}
+
+// Fetch - downloads file of the entry, does nothing if file already matches it
+func (f *HTTPFetcher) Fetch(ctx context.Context, e ManifestEntry) error {
+	if e.Name == "" || filepath.Base(e.Name) != e.Name {
+		return fmt.Errorf("fetch: file name must not be a path: %q", e.Name)
+	}
+	path := filepath.Join(f.cfg.Dir, e.Name)
+	if err := VerifyFile(ctx, path, e); err == nil {
+		return nil
+	} else if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	partPath, chunksPath := path+".part", path+".chunks"
+
+	chunksAmount := int((e.Size + f.cfg.ChunkSize - 1) / f.cfg.ChunkSize)
+	done, err := ioutil.ReadFile(chunksPath)
+	if err != nil || len(done) != chunksAmount {
+		done = make([]byte, chunksAmount) // no or foreign progress - start from scratch
+	}
+	part, err := os.OpenFile(partPath, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return fmt.Errorf("fetch %s: %w", e.Name, err)
+	}
+	defer part.Close()
+	if err = part.Truncate(e.Size); err != nil {
+		return fmt.Errorf("fetch %s: %w", e.Name, err)
+	}
+
+	if err = f.fetchChunks(ctx, e.Name, part, done, chunksPath); err != nil {
+		return fmt.Errorf("fetch %s: %w", e.Name, err)
+	}
+	if err = part.Sync(); err != nil {
+		return fmt.Errorf("fetch %s: %w", e.Name, err)
+	}
+	if err = VerifyFile(ctx, partPath, e); err != nil {
+		_ = os.Remove(partPath)
+		_ = os.Remove(chunksPath)
+		return fmt.Errorf("fetch: %w", err)
+	}
+	if err = os.Rename(partPath, path); err != nil {
+		return fmt.Errorf("fetch %s: %w", e.Name, err)
+	}
+	_ = os.Remove(chunksPath)
+	return nil
+}
+
+func (f *HTTPFetcher) fetchChunks(ctx context.Context, name string, part *os.File, done []byte, chunksPath string) error {
+	size, err := part.Seek(0, io.SeekEnd)
+	if err != nil {
+		return err
+	}
+	var lock sync.Mutex // guards done and chunks file
+	return parallel.ForEach(ctx, len(done), f.cfg.Workers, func(ctx context.Context, _, i int) error {
+		if done[i] == 1 {
+			return nil
+		}
+		from := int64(i) * f.cfg.ChunkSize
+		to := from + f.cfg.ChunkSize
+		if to > size {
+			to = size
+		}
+		if err := f.fetchRange(ctx, name, part, from, to); err != nil {
+			return err
+		}
+		lock.Lock()
+		defer lock.Unlock()
+		done[i] = 1
+		return ioutil.WriteFile(chunksPath, done, 0644)
+	})
+}
+
+var errRangeNotSupported = errors.New("server doesn't support Range requests")
+
+// fetchRange - downloads [from, to) bytes of file into same position of part
+func (f *HTTPFetcher) fetchRange(ctx context.Context, name string, part *os.File, from, to int64) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, f.url(name), nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", from, to-1))
+	resp, err := f.cfg.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusPartialContent:
+	case http.StatusOK: // whole file: acceptable only if it's the only chunk
+		if from != 0 || resp.ContentLength != to {
+			return errRangeNotSupported
+		}
+	default:
+		return fmt.Errorf("%s", resp.Status)
+	}
+	n, err := io.Copy(&offsetWriter{w: part, off: from}, io.LimitReader(resp.Body, to-from))
+	if err != nil {
+		return err
+	}
+	if n != to-from {
+		return fmt.Errorf("unexpected end of response: %d of %d bytes", n, to-from)
+	}
+	return nil
+}
+
+type offsetWriter struct {
+	w   io.WriterAt
+	off int64
+}
+
+func (w *offsetWriter) Write(p []byte) (int, error) {
+	n, err := w.w.WriteAt(p, w.off)
+	w.off += int64(n)
+	return n, err
+}
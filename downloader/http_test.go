@@ -0,0 +1,102 @@
+/*
+   Copyright 2021 Erigon contributors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package downloader
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestHTTPFetcher(t *testing.T) {
+	require, ctx := require.New(t), context.Background()
+	remote := t.TempDir()
+	segment := bytes.Repeat([]byte("0123456789"), 100)
+	require.NoError(ioutil.WriteFile(filepath.Join(remote, "v1-000000-000500-headers.seg"), segment, 0644))
+	require.NoError(ioutil.WriteFile(filepath.Join(remote, "v1-000000-000500-headers.idx"), []byte("idx"), 0644))
+	m, err := BuildManifest(ctx, remote, nil)
+	require.NoError(err)
+	require.NoError(WriteManifest(remote, m))
+
+	var requests int32
+	corrupt := false
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		name := strings.TrimPrefix(r.URL.Path, "/")
+		b, err := ioutil.ReadFile(filepath.Join(remote, name))
+		if err != nil {
+			http.NotFound(w, r)
+			return
+		}
+		if corrupt && name != ManifestFileName {
+			b = bytes.ToUpper(append([]byte{}, b...))
+			b[0] = 'X'
+		}
+		http.ServeContent(w, r, name, time.Time{}, bytes.NewReader(b))
+	}))
+	defer srv.Close()
+
+	local := t.TempDir()
+	f := NewHTTPFetcher(HTTPConfig{BaseURL: srv.URL, Dir: local, ChunkSize: 64, Workers: 3})
+	fetched, err := f.Manifest(ctx)
+	require.NoError(err)
+	require.Equal(m, fetched)
+
+	// resume: first chunks are already downloaded
+	e, _ := m.Get("v1-000000-000500-headers.seg")
+	part := make([]byte, len(segment))
+	copy(part, segment[:128])
+	require.NoError(ioutil.WriteFile(filepath.Join(local, e.Name+".part"), part, 0644))
+	done := make([]byte, (len(segment)+63)/64)
+	done[0], done[1] = 1, 1
+	require.NoError(ioutil.WriteFile(filepath.Join(local, e.Name+".chunks"), done, 0644))
+
+	atomic.StoreInt32(&requests, 0)
+	require.NoError(f.FetchAll(ctx, fetched))
+	require.Equal(int32(len(done)-2+1), atomic.LoadInt32(&requests))
+	problems, err := Verify(ctx, local)
+	require.NoError(err)
+	require.Empty(problems)
+	_, err = ioutil.ReadFile(filepath.Join(local, e.Name+".chunks"))
+	require.Error(err)
+
+	// already downloaded files are not fetched again
+	atomic.StoreInt32(&requests, 0)
+	require.NoError(f.FetchAll(ctx, fetched))
+	require.Zero(atomic.LoadInt32(&requests))
+
+	// corrupted download doesn't get the name of file
+	corrupt = true
+	require.NoError(ioutil.WriteFile(filepath.Join(local, e.Name), []byte("truncated"), 0644))
+	err = f.Fetch(ctx, e)
+	require.True(errors.Is(err, ErrChecksumMismatch))
+	b, err := ioutil.ReadFile(filepath.Join(local, e.Name))
+	require.NoError(err)
+	require.Equal([]byte("truncated"), b)
+
+	require.Error(f.Fetch(ctx, ManifestEntry{Name: "../x", Size: 1}))
+}
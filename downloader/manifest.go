@@ -0,0 +1,248 @@
+/*
+   Copyright 2021 Erigon contributors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package downloader
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+)
+
+// ManifestFileName - name of manifest file in directory of segments
+const ManifestFileName = "manifest.json"
+
+var (
+	ErrMissing          = errors.New("file is missing")
+	ErrSizeMismatch     = errors.New("size mismatch, file may be truncated")
+	ErrChecksumMismatch = errors.New("sha256 mismatch, file is corrupted")
+)
+
+// ManifestEntry - description of one segment or index file. Version and range are taken from name of file
+// (like v1-000000-000500-headers.seg), they are zero for files named differently
+type ManifestEntry struct {
+	Name    string `json:"name"`
+	Size    int64  `json:"size"`
+	Sha256  string `json:"sha256"`
+	Version uint64 `json:"version,omitempty"`
+	From    uint64 `json:"from,omitempty"` // first block of the range
+	To      uint64 `json:"to,omitempty"`   // first block after the range
+}
+
+// Manifest - checksums of files of a directory, producers of segments and indices add files by Add
+type Manifest struct {
+	Files []ManifestEntry `json:"files"`
+}
+
+var segmentNameRe = regexp.MustCompile(`^v(\d+)-(\d+)-(\d+)-[a-z0-9_]+\.[a-z]+$`)
+
+// ParseFileName - version and blocks range of segment file name, range in name is in thousands of blocks
+func ParseFileName(name string) (version, from, to uint64, ok bool) {
+	m := segmentNameRe.FindStringSubmatch(name)
+	if m == nil {
+		return 0, 0, 0, false
+	}
+	var err error
+	if version, err = strconv.ParseUint(m[1], 10, 64); err != nil {
+		return 0, 0, 0, false
+	}
+	if from, err = strconv.ParseUint(m[2], 10, 64); err != nil {
+		return 0, 0, 0, false
+	}
+	if to, err = strconv.ParseUint(m[3], 10, 64); err != nil {
+		return 0, 0, 0, false
+	}
+	return version, from * 1_000, to * 1_000, true
+}
+
+func fileEntry(ctx context.Context, path string) (ManifestEntry, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return ManifestEntry{}, err
+	}
+	defer f.Close()
+	h := sha256.New()
+	size, err := io.Copy(h, &ctxReader{ctx: ctx, r: f})
+	if err != nil {
+		return ManifestEntry{}, err
+	}
+	e := ManifestEntry{Name: filepath.Base(path), Size: size, Sha256: hex.EncodeToString(h.Sum(nil))}
+	e.Version, e.From, e.To, _ = ParseFileName(e.Name)
+	return e, nil
+}
+
+// ctxReader - stops long hashing of big files on cancellation of context
+type ctxReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (r *ctxReader) Read(p []byte) (int, error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return r.r.Read(p)
+}
+
+// Add - adds (or replaces) entry of just produced file
+func (m *Manifest) Add(ctx context.Context, path string) error {
+	e, err := fileEntry(ctx, path)
+	if err != nil {
+		return fmt.Errorf("manifest: %w", err)
+	}
+	i := sort.Search(len(m.Files), func(i int) bool { return m.Files[i].Name >= e.Name })
+	if i < len(m.Files) && m.Files[i].Name == e.Name {
+		m.Files[i] = e
+		return nil
+	}
+	m.Files = append(m.Files, ManifestEntry{})
+	copy(m.Files[i+1:], m.Files[i:])
+	m.Files[i] = e
+	return nil
+}
+
+// Get - entry of file by name
+func (m *Manifest) Get(name string) (ManifestEntry, bool) {
+	i := sort.Search(len(m.Files), func(i int) bool { return m.Files[i].Name >= name })
+	if i < len(m.Files) && m.Files[i].Name == name {
+		return m.Files[i], true
+	}
+	return ManifestEntry{}, false
+}
+
+// BuildManifest - manifest of all files of directory (except manifest itself), which satisfy match (nil matches all)
+func BuildManifest(ctx context.Context, dir string, match func(name string) bool) (*Manifest, error) {
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("manifest: %w", err)
+	}
+	m := &Manifest{}
+	for _, f := range files {
+		if f.IsDir() || f.Name() == ManifestFileName || (match != nil && !match(f.Name())) {
+			continue
+		}
+		if err := m.Add(ctx, filepath.Join(dir, f.Name())); err != nil {
+			return nil, err
+		}
+	}
+	return m, nil
+}
+
+// WriteManifest - atomically replaces manifest of directory
+func WriteManifest(dir string, m *Manifest) error {
+	b, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := filepath.Join(dir, ManifestFileName+".tmp")
+	if err := ioutil.WriteFile(tmp, b, 0644); err != nil {
+		return fmt.Errorf("manifest: %w", err)
+	}
+	if err := os.Rename(tmp, filepath.Join(dir, ManifestFileName)); err != nil {
+		return fmt.Errorf("manifest: %w", err)
+	}
+	return nil
+}
+
+func ReadManifest(dir string) (*Manifest, error) {
+	b, err := ioutil.ReadFile(filepath.Join(dir, ManifestFileName))
+	if err != nil {
+		return nil, fmt.Errorf("manifest: %w", err)
+	}
+	return parseManifest(b)
+}
+
+func parseManifest(b []byte) (*Manifest, error) {
+	m := &Manifest{}
+	if err := json.Unmarshal(b, m); err != nil {
+		return nil, fmt.Errorf("manifest: %w", err)
+	}
+	for _, e := range m.Files {
+		if e.Name == "" || e.Name == "." || e.Name == ".." || filepath.Base(e.Name) != e.Name {
+			return nil, fmt.Errorf("manifest: file name must not be a path: %q", e.Name)
+		}
+	}
+	sort.Slice(m.Files, func(i, j int) bool { return m.Files[i].Name < m.Files[j].Name })
+	return m, nil
+}
+
+// FileError - problem of one file found by Verify, Err is one of ErrMissing, ErrSizeMismatch, ErrChecksumMismatch
+// or error of reading the file
+type FileError struct {
+	Name string
+	Err  error
+}
+
+func (e *FileError) Error() string { return fmt.Sprintf("%s: %s", e.Name, e.Err) }
+func (e *FileError) Unwrap() error { return e.Err }
+
+// VerifyFile - checks that file at path has size and checksum of the entry. Size is checked first: truncated
+// files (e.g. of interrupted downloads) are detected without hashing
+func VerifyFile(ctx context.Context, path string, e ManifestEntry) error {
+	st, err := os.Stat(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return &FileError{Name: e.Name, Err: ErrMissing}
+	}
+	if err != nil {
+		return &FileError{Name: e.Name, Err: err}
+	}
+	if st.Size() != e.Size {
+		return &FileError{Name: e.Name, Err: fmt.Errorf("%w: %d, expected %d", ErrSizeMismatch, st.Size(), e.Size)}
+	}
+	actual, err := fileEntry(ctx, path)
+	if err != nil {
+		if ctx.Err() != nil {
+			return err
+		}
+		return &FileError{Name: e.Name, Err: err}
+	}
+	if actual.Sha256 != e.Sha256 {
+		return &FileError{Name: e.Name, Err: ErrChecksumMismatch}
+	}
+	return nil
+}
+
+// Verify - validates files of directory against its manifest, returns problems of all files. Files which are
+// not in manifest are not checked. Error is returned only if manifest can't be read or context is cancelled
+func Verify(ctx context.Context, dir string) ([]*FileError, error) {
+	m, err := ReadManifest(dir)
+	if err != nil {
+		return nil, err
+	}
+	var problems []*FileError
+	for _, e := range m.Files {
+		err := VerifyFile(ctx, filepath.Join(dir, e.Name), e)
+		var fileErr *FileError
+		switch {
+		case err == nil:
+		case errors.As(err, &fileErr):
+			problems = append(problems, fileErr)
+		default:
+			return nil, err
+		}
+	}
+	return problems, nil
+}
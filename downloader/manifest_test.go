@@ -0,0 +1,80 @@
+/*
+   Copyright 2021 Erigon contributors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package downloader
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestManifest(t *testing.T) {
+	require, ctx := require.New(t), context.Background()
+	dir := t.TempDir()
+	segment, idx := "v1-000000-000500-headers.seg", "v1-000000-000500-headers.idx"
+	require.NoError(ioutil.WriteFile(filepath.Join(dir, segment), []byte("segment data"), 0644))
+	require.NoError(ioutil.WriteFile(filepath.Join(dir, idx), []byte("index"), 0644))
+	require.NoError(ioutil.WriteFile(filepath.Join(dir, "notes.txt"), []byte("notes"), 0644))
+
+	m, err := BuildManifest(ctx, dir, func(name string) bool { return filepath.Ext(name) != ".txt" })
+	require.NoError(err)
+	require.Len(m.Files, 2)
+	e, ok := m.Get(segment)
+	require.True(ok)
+	sum := sha256.Sum256([]byte("segment data"))
+	require.Equal(ManifestEntry{Name: segment, Size: 12, Sha256: hex.EncodeToString(sum[:]), Version: 1, From: 0, To: 500_000}, e)
+	require.NoError(WriteManifest(dir, m))
+
+	problems, err := Verify(ctx, dir)
+	require.NoError(err)
+	require.Empty(problems)
+
+	// producer replaces file, manifest follows
+	require.NoError(ioutil.WriteFile(filepath.Join(dir, idx), []byte("index2"), 0644))
+	problems, err = Verify(ctx, dir)
+	require.NoError(err)
+	require.Len(problems, 1)
+	require.True(errors.Is(problems[0], ErrSizeMismatch))
+	require.NoError(m.Add(ctx, filepath.Join(dir, idx)))
+	require.Len(m.Files, 2)
+	require.NoError(WriteManifest(dir, m))
+
+	// corrupted and missing files
+	require.NoError(ioutil.WriteFile(filepath.Join(dir, segment), []byte("segment dat4"), 0644))
+	require.NoError(os.Remove(filepath.Join(dir, idx)))
+	problems, err = Verify(ctx, dir)
+	require.NoError(err)
+	require.Len(problems, 2)
+	require.Equal(idx, problems[0].Name)
+	require.True(errors.Is(problems[0], ErrMissing))
+	require.Equal(segment, problems[1].Name)
+	require.True(errors.Is(problems[1], ErrChecksumMismatch))
+
+	require.NoError(ioutil.WriteFile(filepath.Join(dir, ManifestFileName), []byte(`{"files":[{"name":"../x"}]}`), 0644))
+	_, err = Verify(ctx, dir)
+	require.Error(err)
+
+	_, _, _, ok = ParseFileName("notes.txt")
+	require.False(ok)
+}
@@ -0,0 +1,92 @@
+/*
+   Copyright 2021 Erigon contributors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package gointerfaces
+
+import (
+	"encoding/binary"
+
+	"github.com/holiman/uint256"
+	"github.com/ledgerwatch/erigon-lib/gointerfaces/types"
+)
+
+const arenaChunk = 128
+
+// Arena - allocates H128/H160/H256 messages by chunks: one allocation per chunk instead of 2-3 per converted value.
+// For big replies, like txpool Content. Chunk stays alive while any of its messages is referenced. Not thread-safe
+type Arena struct {
+	h128       []types.H128
+	h160       []types.H160
+	h256       []types.H256
+	i128, i160 int
+	i256       int
+}
+
+// Reset - messages of current chunks will be reused, previously allocated messages of them must not be used anymore
+func (a *Arena) Reset() {
+	for i := 0; i < a.i128; i++ {
+		a.h128[i].Reset()
+	}
+	for i := 0; i < a.i160; i++ {
+		a.h160[i].Reset()
+	}
+	for i := 0; i < a.i256; i++ {
+		a.h256[i].Reset()
+	}
+	a.i128, a.i160, a.i256 = 0, 0, 0
+}
+
+func (a *Arena) newH128(hi, lo uint64) *types.H128 {
+	if a.i128 == len(a.h128) {
+		a.h128, a.i128 = make([]types.H128, arenaChunk), 0
+	}
+	h := &a.h128[a.i128]
+	a.i128++
+	h.Hi, h.Lo = hi, lo
+	return h
+}
+
+func (a *Arena) newH256(hi, lo *types.H128) *types.H256 {
+	if a.i256 == len(a.h256) {
+		a.h256, a.i256 = make([]types.H256, arenaChunk), 0
+	}
+	h := &a.h256[a.i256]
+	a.i256++
+	h.Hi, h.Lo = hi, lo
+	return h
+}
+
+// H256 - same as ConvertHashToH256
+func (a *Arena) H256(hash [32]byte) *types.H256 {
+	return a.newH256(a.newH128(binary.BigEndian.Uint64(hash[0:]), binary.BigEndian.Uint64(hash[8:])),
+		a.newH128(binary.BigEndian.Uint64(hash[16:]), binary.BigEndian.Uint64(hash[24:])))
+}
+
+// Uint256 - same as ConvertUint256IntToH256
+func (a *Arena) Uint256(i *uint256.Int) *types.H256 {
+	return a.newH256(a.newH128(i[3], i[2]), a.newH128(i[1], i[0]))
+}
+
+// H160 - same as ConvertAddressToH160
+func (a *Arena) H160(addr [20]byte) *types.H160 {
+	if a.i160 == len(a.h160) {
+		a.h160, a.i160 = make([]types.H160, arenaChunk), 0
+	}
+	h := &a.h160[a.i160]
+	a.i160++
+	h.Hi, h.Lo = a.newH128(binary.BigEndian.Uint64(addr[0:]), binary.BigEndian.Uint64(addr[8:])), binary.BigEndian.Uint32(addr[16:])
+	return h
+}
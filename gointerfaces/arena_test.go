@@ -0,0 +1,78 @@
+/*
+   Copyright 2021 Erigon contributors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package gointerfaces
+
+import (
+	"testing"
+
+	"github.com/holiman/uint256"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBatchConversions(t *testing.T) {
+	require := require.New(t)
+	var hashes []byte
+	for i := 0; i < 3; i++ {
+		var h [32]byte
+		for j := range h {
+			h[j] = byte(i*32 + j)
+		}
+		hashes = append(hashes, h[:]...)
+	}
+	h256s := ConvertHashesToH256s(hashes)
+	require.Equal(3, len(h256s))
+	for i, h := range h256s {
+		b := ConvertH256ToHash(h)
+		require.Equal(hashes[i*32:i*32+32], b[:])
+	}
+	require.Equal(hashes, AppendH256s(nil, h256s))
+
+	var h [32]byte
+	copy(h[:], hashes[32:])
+	reused := ConvertHashToH256([32]byte{})
+	hi := reused.Hi
+	require.Equal(h, ConvertH256ToHash(SetH256(reused, h)))
+	require.True(hi == reused.Hi)
+
+	peer := ConvertBytesToH512(hashes[:64])
+	peerKey := ConvertH512ToArray(peer)
+	require.Equal(hashes[:64], peerKey[:])
+	require.Equal(0.0, testing.AllocsPerRun(10, func() { _ = ConvertH512ToArray(peer) }))
+}
+
+func TestArena(t *testing.T) {
+	require := require.New(t)
+	a := &Arena{}
+
+	hash := [32]byte{1, 2, 3, 31: 4}
+	addr := [20]byte{5, 6, 19: 7}
+	value := uint256.NewInt(1 << 40)
+	for i := 0; i < arenaChunk*2+1; i++ { // crosses chunks
+		require.Equal(hash, ConvertH256ToHash(a.H256(hash)))
+		require.Equal(addr, ConvertH160toAddress(a.H160(addr)))
+		require.Equal(value, ConvertH256ToUint256Int(a.Uint256(value)))
+	}
+
+	// after Reset messages of current chunks are reused
+	require.Equal(0.0, testing.AllocsPerRun(10, func() {
+		a.Reset()
+		for i := 0; i < 10; i++ {
+			a.H256(hash)
+			a.H160(addr)
+		}
+	}))
+}
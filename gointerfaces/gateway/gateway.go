@@ -0,0 +1,236 @@
+//go:build gateway
+// +build gateway
+
+/*
+   Copyright 2021 Erigon contributors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+// Package gateway - HTTP/JSON access to gRPC services, for scripts and dashboards which have no gRPC client.
+// It's compiled only with build tag "gateway".
+package gateway
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	_ "github.com/ledgerwatch/erigon-lib/gointerfaces/remote" // register descriptors of services
+	_ "github.com/ledgerwatch/erigon-lib/gointerfaces/sentry"
+	_ "github.com/ledgerwatch/erigon-lib/gointerfaces/txpool"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+)
+
+const maxRequestSize = 1 << 20
+
+// Route - methods of gRPC service exposed by gateway. Empty Methods - all unary and server-streaming methods.
+// Client-streaming methods (like KV.Tx) can't be exposed. Gateway has no auth: default routes are read-only,
+// methods which change state of server (KV.Pin, KV.StateChangesAck, Txpool.Add) must be routed explicitly.
+type Route struct {
+	Service string   // full name: "remote.KV"
+	Methods []string // "Version", "Health"
+}
+
+var (
+	KV     = Route{Service: "remote.KV", Methods: []string{"Version", "Health", "StateChanges"}}
+	Txpool = Route{Service: "txpool.Txpool", Methods: []string{"Version", "FindUnknown", "Transactions", "All", "Status", "OnAdd", "Content", "Inspect", "Events", "Digest"}}
+	Sentry = Route{Service: "sentry.Sentry", Methods: []string{"HandShake", "PeerCount"}}
+
+	DefaultRoutes = []Route{KV, Txpool, Sentry}
+)
+
+type method struct {
+	fullName string // "/remote.KV/Version"
+	desc     protoreflect.MethodDescriptor
+	in, out  protoreflect.MessageType
+}
+
+type Gateway struct {
+	conn    grpc.ClientConnInterface
+	methods map[string]*method
+}
+
+// New - http handler of requests "POST /<Service>/<Method>" with JSON (protojson) of request message as body.
+// Unary methods reply by JSON of reply message, server-streaming methods - by newline-delimited JSON messages
+// (response starts with first message: if stream fails before it - status of response reflects the error).
+// GET - same as POST with empty body.
+func New(conn grpc.ClientConnInterface, routes ...Route) (*Gateway, error) {
+	g := &Gateway{conn: conn, methods: map[string]*method{}}
+	for _, r := range routes {
+		d, err := protoregistry.GlobalFiles.FindDescriptorByName(protoreflect.FullName(r.Service))
+		if err != nil {
+			return nil, fmt.Errorf("gateway, service %s: %w", r.Service, err)
+		}
+		sd, ok := d.(protoreflect.ServiceDescriptor)
+		if !ok {
+			return nil, fmt.Errorf("gateway: %s is not a service", r.Service)
+		}
+		names := r.Methods
+		if len(names) == 0 {
+			for i := 0; i < sd.Methods().Len(); i++ {
+				if md := sd.Methods().Get(i); !md.IsStreamingClient() {
+					names = append(names, string(md.Name()))
+				}
+			}
+		}
+		for _, name := range names {
+			md := sd.Methods().ByName(protoreflect.Name(name))
+			if md == nil {
+				return nil, fmt.Errorf("gateway: service %s has no method %s", r.Service, name)
+			}
+			if md.IsStreamingClient() {
+				return nil, fmt.Errorf("gateway: client-streaming method %s.%s is not supported", r.Service, name)
+			}
+			in, err := protoregistry.GlobalTypes.FindMessageByName(md.Input().FullName())
+			if err != nil {
+				return nil, fmt.Errorf("gateway, method %s.%s: %w", r.Service, name, err)
+			}
+			out, err := protoregistry.GlobalTypes.FindMessageByName(md.Output().FullName())
+			if err != nil {
+				return nil, fmt.Errorf("gateway, method %s.%s: %w", r.Service, name, err)
+			}
+			fullName := "/" + r.Service + "/" + name
+			g.methods[fullName] = &method{fullName: fullName, desc: md, in: in, out: out}
+		}
+	}
+	return g, nil
+}
+
+func (g *Gateway) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	m, ok := g.methods[strings.TrimSuffix(r.URL.Path, "/")]
+	if !ok {
+		writeError(w, status.Errorf(codes.Unimplemented, "unknown method: %s", r.URL.Path))
+		return
+	}
+	if r.Method != http.MethodPost && r.Method != http.MethodGet {
+		writeError(w, status.Errorf(codes.InvalidArgument, "method %s is not allowed", r.Method))
+		return
+	}
+	body, err := ioutil.ReadAll(io.LimitReader(r.Body, maxRequestSize))
+	if err != nil {
+		writeError(w, status.Errorf(codes.InvalidArgument, "read body: %s", err))
+		return
+	}
+	in := m.in.New().Interface()
+	if len(body) > 0 {
+		if err := protojson.Unmarshal(body, in); err != nil {
+			writeError(w, status.Errorf(codes.InvalidArgument, "parse request: %s", err))
+			return
+		}
+	}
+
+	if !m.desc.IsStreamingServer() {
+		out := m.out.New().Interface()
+		if err := g.conn.Invoke(r.Context(), m.fullName, in, out); err != nil {
+			writeError(w, err)
+			return
+		}
+		writeJSON(w, out)
+		return
+	}
+
+	stream, err := g.conn.NewStream(r.Context(), &grpc.StreamDesc{ServerStreams: true}, m.fullName)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	if err := stream.SendMsg(in); err != nil {
+		writeError(w, err)
+		return
+	}
+	if err := stream.CloseSend(); err != nil {
+		writeError(w, err)
+		return
+	}
+	flusher, _ := w.(http.Flusher)
+	for first := true; ; first = false {
+		out := m.out.New().Interface()
+		err := stream.RecvMsg(out)
+		if err == io.EOF {
+			return
+		}
+		if err != nil {
+			if first {
+				writeError(w, err)
+			} else { // status is already sent - error is the last message of stream
+				_, _ = w.Write(errorJSON(err))
+			}
+			return
+		}
+		if first {
+			w.Header().Set("Content-Type", "application/x-ndjson")
+		}
+		writeJSON(w, out)
+		if flusher != nil {
+			flusher.Flush()
+		}
+	}
+}
+
+func writeJSON(w http.ResponseWriter, msg proto.Message) {
+	b, err := protojson.Marshal(msg)
+	if err != nil {
+		writeError(w, status.Errorf(codes.Internal, "marshal reply: %s", err))
+		return
+	}
+	if w.Header().Get("Content-Type") == "" {
+		w.Header().Set("Content-Type", "application/json")
+	}
+	_, _ = w.Write(append(b, '\n'))
+}
+
+func writeError(w http.ResponseWriter, err error) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(httpStatus(status.Code(err)))
+	_, _ = w.Write(errorJSON(err))
+}
+
+func errorJSON(err error) []byte {
+	s := status.Convert(err)
+	b, _ := protojson.Marshal(s.Proto())
+	return append(b, '\n')
+}
+
+func httpStatus(code codes.Code) int {
+	switch code {
+	case codes.OK:
+		return http.StatusOK
+	case codes.InvalidArgument, codes.OutOfRange, codes.FailedPrecondition:
+		return http.StatusBadRequest
+	case codes.Unauthenticated:
+		return http.StatusUnauthorized
+	case codes.PermissionDenied:
+		return http.StatusForbidden
+	case codes.NotFound, codes.Unimplemented:
+		return http.StatusNotFound
+	case codes.AlreadyExists, codes.Aborted:
+		return http.StatusConflict
+	case codes.ResourceExhausted:
+		return http.StatusTooManyRequests
+	case codes.Canceled, codes.DeadlineExceeded:
+		return http.StatusGatewayTimeout
+	case codes.Unavailable:
+		return http.StatusServiceUnavailable
+	default:
+		return http.StatusInternalServerError
+	}
+}
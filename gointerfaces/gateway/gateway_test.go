@@ -0,0 +1,114 @@
+//go:build gateway
+// +build gateway
+
+/*
+   Copyright 2021 Erigon contributors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package gateway_test
+
+import (
+	"bufio"
+	"context"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ledgerwatch/erigon-lib/gointerfaces/gateway"
+	"github.com/ledgerwatch/erigon-lib/gointerfaces/grpcutil"
+	"github.com/ledgerwatch/erigon-lib/gointerfaces/remote"
+	"github.com/ledgerwatch/erigon-lib/kv/memdb"
+	"github.com/ledgerwatch/erigon-lib/kv/remotedbserver"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/encoding/protojson"
+)
+
+func TestGateway(t *testing.T) {
+	db := memdb.NewTestDB(t)
+	ps := remotedbserver.NewStateChangePubSub()
+	conn := bufconn.Listen(1024 * 1024)
+	grpcServer := grpcutil.NewServer(32, nil)
+	remote.RegisterKVServer(grpcServer, remotedbserver.NewKvServer(db).SetStateChanges(ps))
+	go func() { _ = grpcServer.Serve(conn) }()
+	defer grpcServer.Stop()
+	cc, err := grpc.Dial("", grpc.WithInsecure(), grpc.WithContextDialer(func(ctx context.Context, url string) (net.Conn, error) { return conn.Dial() }))
+	require.NoError(t, err)
+	defer cc.Close()
+
+	_, err = gateway.New(cc, gateway.Route{Service: "remote.KV", Methods: []string{"Tx"}})
+	require.Error(t, err)
+	g, err := gateway.New(cc, gateway.DefaultRoutes...)
+	require.NoError(t, err)
+	srv := httptest.NewServer(g)
+	defer srv.Close()
+
+	call := func(method, path, body string) (int, string) {
+		req, err := http.NewRequest(method, srv.URL+path, strings.NewReader(body))
+		require.NoError(t, err)
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		b, err := ioutil.ReadAll(resp.Body)
+		require.NoError(t, err)
+		return resp.StatusCode, string(b)
+	}
+
+	code, body := call(http.MethodGet, "/remote.KV/Version", "")
+	require.Equal(t, http.StatusOK, code, body)
+	reply := &remote.HealthReply{}
+	code, body = call(http.MethodPost, "/remote.KV/Health", "{}")
+	require.Equal(t, http.StatusOK, code, body)
+	require.NoError(t, protojson.Unmarshal([]byte(body), reply))
+	require.True(t, reply.DbOpen)
+	require.Equal(t, remotedbserver.KvServiceAPIVersion.Minor, reply.KvApiVersion.Minor)
+
+	code, _ = call(http.MethodPost, "/remote.KV/Tx", "")
+	require.Equal(t, http.StatusNotFound, code)
+	code, _ = call(http.MethodPost, "/remote.KV/Pin", "{}") // default routes are read-only
+	require.Equal(t, http.StatusNotFound, code)
+	code, _ = call(http.MethodPost, "/remote.KV/Health", "{bad")
+	require.Equal(t, http.StatusBadRequest, code)
+	code, body = call(http.MethodPost, "/remote.KV/StateChanges", `{"fromBlock": "10"}`)
+	require.Equal(t, http.StatusBadRequest, code, body) // OutOfRange
+	// sentry is not connected
+	code, _ = call(http.MethodPost, "/sentry.Sentry/PeerCount", "")
+	require.Equal(t, http.StatusNotFound, code)
+
+	// server-streaming: newline-delimited JSON, response starts with first message
+	go func() {
+		for ps.Len() == 0 {
+			time.Sleep(time.Millisecond)
+		}
+		ps.Pub(&remote.StateChange{BlockHeight: 1, Txs: [][]byte{{1}}})
+		ps.Pub(&remote.StateChange{BlockHeight: 2})
+	}()
+	resp, err := http.Post(srv.URL+"/remote.KV/StateChanges", "application/json", strings.NewReader(`{"withTransactions": true}`))
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, "application/x-ndjson", resp.Header.Get("Content-Type"))
+	lines := bufio.NewScanner(resp.Body)
+	for i := uint64(1); i <= 2; i++ {
+		require.True(t, lines.Scan())
+		sc := &remote.StateChange{}
+		require.NoError(t, protojson.Unmarshal(lines.Bytes(), sc))
+		require.Equal(t, i, sc.BlockHeight)
+	}
+}
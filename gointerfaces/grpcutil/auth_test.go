@@ -0,0 +1,162 @@
+/*
+   Copyright 2021 Erigon contributors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package grpcutil_test
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ledgerwatch/erigon-lib/gointerfaces/grpcutil"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/health"
+	"google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+}
+
+func newTestCA(t *testing.T) *testCA {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	return &testCA{cert: cert, key: key}
+}
+
+func (ca *testCA) writeCA(t *testing.T, file string) {
+	require.NoError(t, ioutil.WriteFile(file, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ca.cert.Raw}), 0600))
+}
+
+// writeCert - writes new cert/key pair signed by ca
+func (ca *testCA) writeCert(t *testing.T, serial int64, certFile, keyFile string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: "test"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca.cert, &key.PublicKey, ca.key)
+	require.NoError(t, err)
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+	require.NoError(t, ioutil.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600))
+	require.NoError(t, ioutil.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0600))
+}
+
+// check - calls server by new connection, returns serial number of server's certificate
+func check(t *testing.T, addr string, creds credentials.TransportCredentials, opts ...grpc.DialOption) (int64, error) {
+	conn, err := grpcutil.Connect(creds, addr, opts...)
+	require.NoError(t, err)
+	defer conn.Close()
+	var p peer.Peer
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	_, err = grpc_health_v1.NewHealthClient(conn).Check(ctx, &grpc_health_v1.HealthCheckRequest{}, grpc.Peer(&p))
+	if err != nil {
+		return 0, err
+	}
+	return p.AuthInfo.(credentials.TLSInfo).State.PeerCertificates[0].SerialNumber.Int64(), nil
+}
+
+func TestMutualTLSAndToken(t *testing.T) {
+	dir := t.TempDir()
+	f := func(name string) string { return filepath.Join(dir, name) }
+	ca := newTestCA(t)
+	ca.writeCA(t, f("ca.pem"))
+	ca.writeCert(t, 10, f("server.pem"), f("server.key"))
+	ca.writeCert(t, 20, f("client.pem"), f("client.key"))
+
+	serverCreds, err := grpcutil.ReloadableServerTLS(f("ca.pem"), f("server.pem"), f("server.key"))
+	require.NoError(t, err)
+	srv := grpcutil.NewServer(32, serverCreds, grpcutil.TokenAuth("secret")...)
+	grpc_health_v1.RegisterHealthServer(srv, health.NewServer())
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	go func() { _ = srv.Serve(lis) }()
+	defer srv.Stop()
+	addr := lis.Addr().String()
+
+	clientCreds, err := grpcutil.ReloadableClientTLS(f("ca.pem"), f("client.pem"), f("client.key"))
+	require.NoError(t, err)
+	serial, err := check(t, addr, clientCreds, grpcutil.WithToken("secret"))
+	require.NoError(t, err)
+	require.Equal(t, int64(10), serial)
+
+	_, err = check(t, addr, clientCreds, grpcutil.WithToken("wrong"))
+	require.Equal(t, codes.Unauthenticated, status.Code(err))
+	_, err = check(t, addr, clientCreds)
+	require.Equal(t, codes.Unauthenticated, status.Code(err))
+
+	// client without certificate is rejected
+	noCert, err := grpcutil.ReloadableClientTLS(f("ca.pem"), "", "")
+	require.NoError(t, err)
+	_, err = check(t, addr, noCert, grpcutil.WithToken("secret"))
+	require.Error(t, err)
+
+	// rotation without restart: new server cert is used by new connections
+	ca.writeCert(t, 11, f("server.pem"), f("server.key"))
+	serial, err = check(t, addr, clientCreds, grpcutil.WithToken("secret"))
+	require.NoError(t, err)
+	require.Equal(t, int64(11), serial)
+
+	// rotation of CA: clients with certs of old CA are rejected
+	ca2 := newTestCA(t)
+	ca2.writeCA(t, f("ca.pem"))
+	ca2.writeCert(t, 12, f("server.pem"), f("server.key"))
+	ca.writeCert(t, 21, f("old_client.pem"), f("old_client.key"))
+	oldClient, err := grpcutil.ReloadableClientTLS(f("ca.pem"), f("old_client.pem"), f("old_client.key"))
+	require.NoError(t, err)
+	_, err = check(t, addr, oldClient, grpcutil.WithToken("secret"))
+	require.Error(t, err)
+	ca2.writeCert(t, 22, f("client.pem"), f("client.key"))
+	serial, err = check(t, addr, clientCreds, grpcutil.WithToken("secret"))
+	require.NoError(t, err)
+	require.Equal(t, int64(12), serial)
+}
@@ -0,0 +1,149 @@
+/*
+   Copyright 2021 Erigon contributors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package grpcutil
+
+import (
+	"context"
+	"math/rand"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// MethodPolicy - how to call one method
+type MethodPolicy struct {
+	Timeout    time.Duration // of each attempt, 0 - no timeout
+	Retries    int           // amount of repeated attempts after failures with RetryCodes
+	Backoff    time.Duration // delay before first retry, doubled for each next retry, with jitter ±50%
+	RetryCodes []codes.Code  // default: codes.Unavailable
+}
+
+// CallPolicy - per-method timeouts and retries, panics converted to errors with codes.Internal.
+// Keys of Methods are full names of gRPC methods: "/sentry.Sentry/PeerCount", other methods use Default.
+// Timeouts and retries are applied only to unary methods: streams are long-lived.
+// Retries are safe only for idempotent methods - that's why Default has no retries unless embedder sets them.
+type CallPolicy struct {
+	Default MethodPolicy
+	Methods map[string]MethodPolicy
+}
+
+func (p CallPolicy) method(fullMethod string) MethodPolicy {
+	if m, ok := p.Methods[fullMethod]; ok {
+		return m
+	}
+	return p.Default
+}
+
+func (m MethodPolicy) retriable(err error) bool {
+	code := status.Code(err)
+	if len(m.RetryCodes) == 0 {
+		return code == codes.Unavailable
+	}
+	for _, c := range m.RetryCodes {
+		if c == code {
+			return true
+		}
+	}
+	return false
+}
+
+// jitter - random delay in [d/2, d*3/2), to not retry by all clients at once
+func jitter(d time.Duration) time.Duration {
+	if d <= 0 {
+		return 0
+	}
+	return d/2 + time.Duration(rand.Int63n(int64(d))) // nolint:gosec
+}
+
+// call - calls f by policy of method
+func (p CallPolicy) call(ctx context.Context, fullMethod string, f func(ctx context.Context) error) error {
+	m := p.method(fullMethod)
+	backoff := m.Backoff
+	for attempt := 0; ; attempt++ {
+		err := recoverCall(ctx, fullMethod, m.Timeout, f)
+		if err == nil || attempt >= m.Retries || !m.retriable(err) || ctx.Err() != nil {
+			return err
+		}
+		timer := time.NewTimer(jitter(backoff))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+		backoff *= 2
+	}
+}
+
+func recoverCall(ctx context.Context, fullMethod string, timeout time.Duration, f func(ctx context.Context) error) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = status.Errorf(codes.Internal, "panic in %s: %v", fullMethod, r)
+		}
+	}()
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	return f(ctx)
+}
+
+// WithCallPolicy - dial options to apply policy to calls of remote services
+func WithCallPolicy(p CallPolicy) []grpc.DialOption {
+	return []grpc.DialOption{
+		grpc.WithChainUnaryInterceptor(func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+			return p.call(ctx, method, func(ctx context.Context) error {
+				return invoker(ctx, method, req, reply, cc, opts...)
+			})
+		}),
+		grpc.WithChainStreamInterceptor(func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (stream grpc.ClientStream, err error) {
+			defer func() {
+				if r := recover(); r != nil {
+					err = status.Errorf(codes.Internal, "panic in %s: %v", method, r)
+				}
+			}()
+			return streamer(ctx, desc, cc, method, opts...)
+		}),
+	}
+}
+
+// UnaryServerInterceptor - applies policy to in-process calls of server, for example by direct clients.
+// Can also be passed to NewServer by grpc.ChainUnaryInterceptor - to limit time of handlers
+func (p CallPolicy) UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (reply interface{}, err error) {
+		err = p.call(ctx, info.FullMethod, func(ctx context.Context) (err error) {
+			reply, err = handler(ctx, req)
+			return err
+		})
+		return reply, err
+	}
+}
+
+// StreamServerInterceptor - converts panics of stream handlers to errors
+func (p CallPolicy) StreamServerInterceptor() grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) (err error) {
+		defer func() {
+			if r := recover(); r != nil {
+				err = status.Errorf(codes.Internal, "panic in %s: %v", info.FullMethod, r)
+			}
+		}()
+		return handler(srv, ss)
+	}
+}
@@ -0,0 +1,130 @@
+/*
+   Copyright 2021 Erigon contributors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package grpcutil_test
+
+import (
+	"context"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ledgerwatch/erigon-lib/common/tracing"
+	"github.com/ledgerwatch/erigon-lib/direct"
+	"github.com/ledgerwatch/erigon-lib/gointerfaces/grpcutil"
+	"github.com/ledgerwatch/erigon-lib/gointerfaces/sentry"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/types/known/emptypb"
+)
+
+// flakySentry - PeerCount fails by Unavailable `failures` times, HandShake hangs until ctx is done, SetStatus panics
+type flakySentry struct {
+	sentry.UnimplementedSentryServer
+	failures int32
+	calls    int32
+}
+
+func (s *flakySentry) PeerCount(ctx context.Context, _ *sentry.PeerCountRequest) (*sentry.PeerCountReply, error) {
+	if atomic.AddInt32(&s.calls, 1) <= atomic.LoadInt32(&s.failures) {
+		return nil, status.Error(codes.Unavailable, "not yet")
+	}
+	return &sentry.PeerCountReply{Count: 42}, nil
+}
+
+func (s *flakySentry) HandShake(ctx context.Context, _ *emptypb.Empty) (*sentry.HandShakeReply, error) {
+	<-ctx.Done()
+	return nil, status.FromContextError(ctx.Err()).Err()
+}
+
+func (s *flakySentry) SetStatus(context.Context, *sentry.StatusData) (*sentry.SetStatusReply, error) {
+	panic("boom")
+}
+
+func TestCallPolicy(t *testing.T) {
+	policy := grpcutil.CallPolicy{
+		Default: grpcutil.MethodPolicy{Timeout: time.Second},
+		Methods: map[string]grpcutil.MethodPolicy{
+			"/sentry.Sentry/PeerCount": {Retries: 2, Backoff: time.Millisecond},
+			"/sentry.Sentry/HandShake": {Timeout: 10 * time.Millisecond},
+		},
+	}
+	server := &flakySentry{}
+
+	directClient := direct.NewSentryClientDirect(direct.ETH66, server)
+	directClient.SetInterceptors(policy.UnaryServerInterceptor(), policy.StreamServerInterceptor())
+
+	conn := bufconn.Listen(1024 * 1024)
+	grpcServer := grpcutil.NewServer(32, nil)
+	sentry.RegisterSentryServer(grpcServer, server)
+	go func() { _ = grpcServer.Serve(conn) }()
+	defer grpcServer.Stop()
+	opts := append(grpcutil.WithCallPolicy(policy), grpc.WithInsecure(), grpc.WithContextDialer(func(ctx context.Context, url string) (net.Conn, error) { return conn.Dial() }))
+	cc, err := grpc.Dial("", opts...)
+	require.NoError(t, err)
+	defer cc.Close()
+
+	for name, client := range map[string]sentry.SentryClient{"direct": directClient, "grpc": sentry.NewSentryClient(cc)} {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			atomic.StoreInt32(&server.calls, 0)
+			atomic.StoreInt32(&server.failures, 2)
+			reply, err := client.PeerCount(ctx, &sentry.PeerCountRequest{})
+			require.NoError(t, err)
+			require.Equal(t, uint64(42), reply.Count)
+			require.Equal(t, int32(3), atomic.LoadInt32(&server.calls))
+
+			atomic.StoreInt32(&server.calls, 0)
+			atomic.StoreInt32(&server.failures, 3)
+			_, err = client.PeerCount(ctx, &sentry.PeerCountRequest{})
+			require.Equal(t, codes.Unavailable, status.Code(err))
+
+			start := time.Now()
+			_, err = client.HandShake(ctx, &emptypb.Empty{})
+			require.Equal(t, codes.DeadlineExceeded, status.Code(err))
+			require.Less(t, int64(time.Since(start)), int64(time.Second))
+
+			_, err = client.SetStatus(ctx, &sentry.StatusData{})
+			require.Equal(t, codes.Internal, status.Code(err))
+		})
+	}
+}
+
+func TestTracingInterceptors(t *testing.T) {
+	require := require.New(t)
+	r := &tracing.Recorder{}
+	tracing.SetTracer(r)
+	defer tracing.SetTracer(nil)
+
+	info := &grpc.UnaryServerInfo{FullMethod: "/sentry.Sentry/PeerCount"}
+	_, err := grpcutil.TracingUnaryServerInterceptor()(context.Background(), nil, info, func(ctx context.Context, req interface{}) (interface{}, error) {
+		_, span := tracing.Start(ctx, "kv.RoTx")
+		span.End()
+		return nil, status.Error(codes.NotFound, "no peer")
+	})
+	require.Equal(codes.NotFound, status.Code(err))
+
+	spans := r.Spans()
+	require.Len(spans, 2)
+	require.Equal(info.FullMethod, spans[0].Name)
+	require.Equal([]interface{}{"rpc.kind", "unary", "rpc.code", "NotFound"}, spans[0].Attrs)
+	require.Equal(err, spans[0].Err)
+	require.Equal(info.FullMethod, spans[1].Parent.Name)
+}
@@ -0,0 +1,167 @@
+/*
+   Copyright 2021 Erigon contributors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package grpcutil
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc/credentials"
+)
+
+// certsReloader - keeps cert/key pair and CA pool, re-reads files on handshake if any of them was modified.
+// It allows rotate certificates without restart: just replace files.
+type certsReloader struct {
+	caFile, certFile, keyFile string
+
+	lock     sync.Mutex
+	modTimes [3]time.Time
+	cert     *tls.Certificate // nil if no certFile
+	pool     *x509.CertPool   // nil if no caFile
+}
+
+func (r *certsReloader) get() (*tls.Certificate, *x509.CertPool, error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	var modTimes [3]time.Time
+	for i, f := range []string{r.caFile, r.certFile, r.keyFile} {
+		if f == "" {
+			continue
+		}
+		st, err := os.Stat(f)
+		if err != nil {
+			return r.loaded(err)
+		}
+		modTimes[i] = st.ModTime()
+	}
+	if r.cert != nil || r.pool != nil {
+		if modTimes == r.modTimes {
+			return r.cert, r.pool, nil
+		}
+	}
+
+	var cert *tls.Certificate
+	if r.certFile != "" || r.keyFile != "" {
+		c, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+		if err != nil {
+			return r.loaded(fmt.Errorf("load peer cert/key error:%w", err))
+		}
+		cert = &c
+	}
+	var pool *x509.CertPool
+	if r.caFile != "" {
+		caCert, err := ioutil.ReadFile(r.caFile)
+		if err != nil {
+			return r.loaded(fmt.Errorf("read ca cert file error:%w", err))
+		}
+		pool = x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(caCert) {
+			return r.loaded(fmt.Errorf("no certificates in ca cert file: %s", r.caFile))
+		}
+	}
+	r.cert, r.pool, r.modTimes = cert, pool, modTimes
+	return r.cert, r.pool, nil
+}
+
+// loaded - if files are broken in the middle of rotation, continue using previously loaded certs
+func (r *certsReloader) loaded(err error) (*tls.Certificate, *x509.CertPool, error) {
+	if r.cert == nil && r.pool == nil {
+		return nil, nil, err
+	}
+	return r.cert, r.pool, nil
+}
+
+// ReloadableServerTLS - same as TLS, but certificates are re-read from files when they modified.
+// If caFile is set - clients must present certificate signed by it (mutual TLS).
+func ReloadableServerTLS(caFile, certFile, keyFile string) (credentials.TransportCredentials, error) {
+	r := &certsReloader{caFile: caFile, certFile: certFile, keyFile: keyFile}
+	cert, _, err := r.get()
+	if err != nil {
+		return nil, err
+	}
+	if cert == nil {
+		return nil, fmt.Errorf("server cert/key files are required")
+	}
+	return credentials.NewTLS(&tls.Config{
+		MinVersion: tls.VersionTLS12,
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			cert, pool, err := r.get()
+			if err != nil {
+				return nil, err
+			}
+			cfg := &tls.Config{
+				Certificates: []tls.Certificate{*cert},
+				MinVersion:   tls.VersionTLS12,
+			}
+			if pool != nil {
+				cfg.ClientCAs = pool
+				cfg.ClientAuth = tls.RequireAndVerifyClientCert
+			}
+			return cfg, nil
+		},
+	}), nil
+}
+
+// ReloadableClientTLS - client side of ReloadableServerTLS. certFile/keyFile can be empty if server doesn't require client certificate.
+// Server certificate is verified by caFile (or by system roots if empty), but Common Name is not checked - same as TLS does.
+func ReloadableClientTLS(caFile, certFile, keyFile string) (credentials.TransportCredentials, error) {
+	r := &certsReloader{caFile: caFile, certFile: certFile, keyFile: keyFile}
+	if _, _, err := r.get(); err != nil && (caFile != "" || certFile != "") {
+		return nil, err
+	}
+	return credentials.NewTLS(&tls.Config{
+		MinVersion: tls.VersionTLS12,
+		GetClientCertificate: func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			cert, _, err := r.get()
+			if err != nil {
+				return nil, err
+			}
+			if cert == nil {
+				return &tls.Certificate{}, nil
+			}
+			return cert, nil
+		},
+		//nolint:gosec
+		InsecureSkipVerify: true, // verification is done by VerifyPeerCertificate with current CA
+		VerifyPeerCertificate: func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+			_, pool, err := r.get()
+			if err != nil {
+				return err
+			}
+			if len(rawCerts) == 0 {
+				return fmt.Errorf("server didn't present certificate")
+			}
+			certs := make([]*x509.Certificate, len(rawCerts))
+			for i, raw := range rawCerts {
+				if certs[i], err = x509.ParseCertificate(raw); err != nil {
+					return fmt.Errorf("parse server cert: %w", err)
+				}
+			}
+			opts := x509.VerifyOptions{Roots: pool, Intermediates: x509.NewCertPool()}
+			for _, c := range certs[1:] {
+				opts.Intermediates.AddCert(c)
+			}
+			_, err = certs[0].Verify(opts)
+			return err
+		},
+	}), nil
+}
@@ -0,0 +1,58 @@
+/*
+   Copyright 2021 Erigon contributors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package grpcutil
+
+import (
+	"context"
+
+	grpc_middleware "github.com/grpc-ecosystem/go-grpc-middleware"
+	"github.com/ledgerwatch/erigon-lib/common/tracing"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+)
+
+// TracingUnaryServerInterceptor - span per call, ctx of handler carries it: spans of db transactions opened by
+// handler are its children. No-op while tracing is disabled
+func TracingUnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (reply interface{}, err error) {
+		if !tracing.Enabled() {
+			return handler(ctx, req)
+		}
+		ctx, span := tracing.Start(ctx, info.FullMethod, "rpc.kind", "unary")
+		defer func() { endCallSpan(span, err) }()
+		return handler(ctx, req)
+	}
+}
+
+// TracingStreamServerInterceptor - span per stream, from open till handler returns
+func TracingStreamServerInterceptor() grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) (err error) {
+		if !tracing.Enabled() {
+			return handler(srv, ss)
+		}
+		ctx, span := tracing.Start(ss.Context(), info.FullMethod, "rpc.kind", "stream")
+		defer func() { endCallSpan(span, err) }()
+		wrapped := grpc_middleware.WrapServerStream(ss)
+		wrapped.WrappedContext = ctx
+		return handler(srv, wrapped)
+	}
+}
+
+func endCallSpan(span tracing.Span, err error) {
+	span.SetAttributes("rpc.code", status.Code(err).String())
+	tracing.End(span, err)
+}
@@ -14,6 +14,7 @@ import (
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/backoff"
 	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/encoding/gzip"
 	"google.golang.org/grpc/keepalive"
 )
 
@@ -46,13 +47,16 @@ func TLS(tlsCACert, tlsCertFile, tlsKeyFile string) (credentials.TransportCreden
 	}), nil
 }
 
-func NewServer(rateLimit uint32, creds credentials.TransportCredentials) *grpc.Server {
+// NewServer - extra options are applied after default ones, for example TokenAuth
+func NewServer(rateLimit uint32, creds credentials.TransportCredentials, extra ...grpc.ServerOption) *grpc.Server {
 	var (
 		streamInterceptors []grpc.StreamServerInterceptor
 		unaryInterceptors  []grpc.UnaryServerInterceptor
 	)
 	streamInterceptors = append(streamInterceptors, grpc_recovery.StreamServerInterceptor())
 	unaryInterceptors = append(unaryInterceptors, grpc_recovery.UnaryServerInterceptor())
+	streamInterceptors = append(streamInterceptors, TracingStreamServerInterceptor())
+	unaryInterceptors = append(unaryInterceptors, TracingUnaryServerInterceptor())
 
 	//if metrics.Enabled {
 	//	streamInterceptors = append(streamInterceptors, grpc_prometheus.StreamServerInterceptor)
@@ -76,6 +80,7 @@ func NewServer(rateLimit uint32, creds credentials.TransportCredentials) *grpc.S
 		grpc.UnaryInterceptor(grpc_middleware.ChainUnaryServer(unaryInterceptors...)),
 		grpc.Creds(creds),
 	}
+	opts = append(opts, extra...)
 	grpcServer = grpc.NewServer(opts...)
 
 	//if metrics.Enabled {
@@ -85,7 +90,14 @@ func NewServer(rateLimit uint32, creds credentials.TransportCredentials) *grpc.S
 	return grpcServer
 }
 
-func Connect(creds credentials.TransportCredentials, dialAddress string) (*grpc.ClientConn, error) {
+// WithCompression - dial option to compress requests by gzip, server replies compressed by same compressor.
+// Servers created by NewServer support it (gzip compressor registered by this package)
+func WithCompression() grpc.DialOption {
+	return grpc.WithDefaultCallOptions(grpc.UseCompressor(gzip.Name))
+}
+
+// Connect - extra options are applied after default ones, for example WithToken
+func Connect(creds credentials.TransportCredentials, dialAddress string, extra ...grpc.DialOption) (*grpc.ClientConn, error) {
 	var dialOpts []grpc.DialOption
 
 	backoffCfg := backoff.DefaultConfig
@@ -101,6 +113,7 @@ func Connect(creds credentials.TransportCredentials, dialAddress string) (*grpc.
 	} else {
 		dialOpts = append(dialOpts, grpc.WithTransportCredentials(creds))
 	}
+	dialOpts = append(dialOpts, extra...)
 
 	//if opts.inMemConn != nil {
 	//	dialOpts = append(dialOpts, grpc.WithContextDialer(func(ctx context.Context, url string) (net.Conn, error) {
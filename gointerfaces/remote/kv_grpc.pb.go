@@ -22,9 +22,22 @@ const _ = grpc.SupportPackageIsVersion7
 type KVClient interface {
 	// Version returns the service version number
 	Version(ctx context.Context, in *emptypb.Empty, opts ...grpc.CallOption) (*types.VersionReply, error)
+	// Health - readiness of server: is db open and readable, versions of db schema and of this service
+	Health(ctx context.Context, in *emptypb.Empty, opts ...grpc.CallOption) (*HealthReply, error)
 	// Tx exposes read-only transactions for the key-value store
 	Tx(ctx context.Context, opts ...grpc.CallOption) (KV_TxClient, error)
+	// StateChanges - stream of state changes of new blocks. If consumer is slow and server's buffer is full -
+	// stream ends with status RESOURCE_EXHAUSTED, then consumer can re-subscribe with fromBlock
 	StateChanges(ctx context.Context, in *StateChangeRequest, opts ...grpc.CallOption) (KV_StateChangesClient, error)
+	// StateChangesAck - confirms processing of state changes up to given sequence, see StateChangeRequest.window
+	StateChangesAck(ctx context.Context, in *StateChangeAck, opts ...grpc.CallOption) (*emptypb.Empty, error)
+	// Pin - keeps read-only transaction (view of db) on server until Unpin or until ttl expiration.
+	// Tx stream opened with metadata "kv-view-id: <viewId>" reads from pinned view - it gives
+	// consistent view of db across many requests.
+	Pin(ctx context.Context, in *PinRequest, opts ...grpc.CallOption) (*PinReply, error)
+	// Heartbeat - extends ttl of pinned view
+	Heartbeat(ctx context.Context, in *ViewRequest, opts ...grpc.CallOption) (*emptypb.Empty, error)
+	Unpin(ctx context.Context, in *ViewRequest, opts ...grpc.CallOption) (*emptypb.Empty, error)
 }
 
 type kVClient struct {
@@ -44,6 +57,15 @@ func (c *kVClient) Version(ctx context.Context, in *emptypb.Empty, opts ...grpc.
 	return out, nil
 }
 
+func (c *kVClient) Health(ctx context.Context, in *emptypb.Empty, opts ...grpc.CallOption) (*HealthReply, error) {
+	out := new(HealthReply)
+	err := c.cc.Invoke(ctx, "/remote.KV/Health", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 func (c *kVClient) Tx(ctx context.Context, opts ...grpc.CallOption) (KV_TxClient, error) {
 	stream, err := c.cc.NewStream(ctx, &KV_ServiceDesc.Streams[0], "/remote.KV/Tx", opts...)
 	if err != nil {
@@ -107,15 +129,64 @@ func (x *kVStateChangesClient) Recv() (*StateChange, error) {
 	return m, nil
 }
 
+func (c *kVClient) StateChangesAck(ctx context.Context, in *StateChangeAck, opts ...grpc.CallOption) (*emptypb.Empty, error) {
+	out := new(emptypb.Empty)
+	err := c.cc.Invoke(ctx, "/remote.KV/StateChangesAck", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *kVClient) Pin(ctx context.Context, in *PinRequest, opts ...grpc.CallOption) (*PinReply, error) {
+	out := new(PinReply)
+	err := c.cc.Invoke(ctx, "/remote.KV/Pin", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *kVClient) Heartbeat(ctx context.Context, in *ViewRequest, opts ...grpc.CallOption) (*emptypb.Empty, error) {
+	out := new(emptypb.Empty)
+	err := c.cc.Invoke(ctx, "/remote.KV/Heartbeat", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *kVClient) Unpin(ctx context.Context, in *ViewRequest, opts ...grpc.CallOption) (*emptypb.Empty, error) {
+	out := new(emptypb.Empty)
+	err := c.cc.Invoke(ctx, "/remote.KV/Unpin", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 // KVServer is the server API for KV service.
 // All implementations must embed UnimplementedKVServer
 // for forward compatibility
 type KVServer interface {
 	// Version returns the service version number
 	Version(context.Context, *emptypb.Empty) (*types.VersionReply, error)
+	// Health - readiness of server: is db open and readable, versions of db schema and of this service
+	Health(context.Context, *emptypb.Empty) (*HealthReply, error)
 	// Tx exposes read-only transactions for the key-value store
 	Tx(KV_TxServer) error
+	// StateChanges - stream of state changes of new blocks. If consumer is slow and server's buffer is full -
+	// stream ends with status RESOURCE_EXHAUSTED, then consumer can re-subscribe with fromBlock
 	StateChanges(*StateChangeRequest, KV_StateChangesServer) error
+	// StateChangesAck - confirms processing of state changes up to given sequence, see StateChangeRequest.window
+	StateChangesAck(context.Context, *StateChangeAck) (*emptypb.Empty, error)
+	// Pin - keeps read-only transaction (view of db) on server until Unpin or until ttl expiration.
+	// Tx stream opened with metadata "kv-view-id: <viewId>" reads from pinned view - it gives
+	// consistent view of db across many requests.
+	Pin(context.Context, *PinRequest) (*PinReply, error)
+	// Heartbeat - extends ttl of pinned view
+	Heartbeat(context.Context, *ViewRequest) (*emptypb.Empty, error)
+	Unpin(context.Context, *ViewRequest) (*emptypb.Empty, error)
 	mustEmbedUnimplementedKVServer()
 }
 
@@ -126,12 +197,27 @@ type UnimplementedKVServer struct {
 func (UnimplementedKVServer) Version(context.Context, *emptypb.Empty) (*types.VersionReply, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method Version not implemented")
 }
+func (UnimplementedKVServer) Health(context.Context, *emptypb.Empty) (*HealthReply, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Health not implemented")
+}
 func (UnimplementedKVServer) Tx(KV_TxServer) error {
 	return status.Errorf(codes.Unimplemented, "method Tx not implemented")
 }
 func (UnimplementedKVServer) StateChanges(*StateChangeRequest, KV_StateChangesServer) error {
 	return status.Errorf(codes.Unimplemented, "method StateChanges not implemented")
 }
+func (UnimplementedKVServer) StateChangesAck(context.Context, *StateChangeAck) (*emptypb.Empty, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method StateChangesAck not implemented")
+}
+func (UnimplementedKVServer) Pin(context.Context, *PinRequest) (*PinReply, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Pin not implemented")
+}
+func (UnimplementedKVServer) Heartbeat(context.Context, *ViewRequest) (*emptypb.Empty, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Heartbeat not implemented")
+}
+func (UnimplementedKVServer) Unpin(context.Context, *ViewRequest) (*emptypb.Empty, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Unpin not implemented")
+}
 func (UnimplementedKVServer) mustEmbedUnimplementedKVServer() {}
 
 // UnsafeKVServer may be embedded to opt out of forward compatibility for this service.
@@ -163,6 +249,24 @@ func _KV_Version_Handler(srv interface{}, ctx context.Context, dec func(interfac
 	return interceptor(ctx, in, info, handler)
 }
 
+func _KV_Health_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(emptypb.Empty)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(KVServer).Health(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/remote.KV/Health",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(KVServer).Health(ctx, req.(*emptypb.Empty))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 func _KV_Tx_Handler(srv interface{}, stream grpc.ServerStream) error {
 	return srv.(KVServer).Tx(&kVTxServer{stream})
 }
@@ -210,6 +314,78 @@ func (x *kVStateChangesServer) Send(m *StateChange) error {
 	return x.ServerStream.SendMsg(m)
 }
 
+func _KV_StateChangesAck_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(StateChangeAck)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(KVServer).StateChangesAck(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/remote.KV/StateChangesAck",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(KVServer).StateChangesAck(ctx, req.(*StateChangeAck))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _KV_Pin_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(PinRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(KVServer).Pin(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/remote.KV/Pin",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(KVServer).Pin(ctx, req.(*PinRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _KV_Heartbeat_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ViewRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(KVServer).Heartbeat(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/remote.KV/Heartbeat",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(KVServer).Heartbeat(ctx, req.(*ViewRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _KV_Unpin_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ViewRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(KVServer).Unpin(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/remote.KV/Unpin",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(KVServer).Unpin(ctx, req.(*ViewRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 // KV_ServiceDesc is the grpc.ServiceDesc for KV service.
 // It's only intended for direct use with grpc.RegisterService,
 // and not to be introspected or modified (even as a copy)
@@ -221,6 +397,26 @@ var KV_ServiceDesc = grpc.ServiceDesc{
 			MethodName: "Version",
 			Handler:    _KV_Version_Handler,
 		},
+		{
+			MethodName: "Health",
+			Handler:    _KV_Health_Handler,
+		},
+		{
+			MethodName: "StateChangesAck",
+			Handler:    _KV_StateChangesAck_Handler,
+		},
+		{
+			MethodName: "Pin",
+			Handler:    _KV_Pin_Handler,
+		},
+		{
+			MethodName: "Heartbeat",
+			Handler:    _KV_Heartbeat_Handler,
+		},
+		{
+			MethodName: "Unpin",
+			Handler:    _KV_Unpin_Handler,
+		},
 	},
 	Streams: []grpc.StreamDesc{
 		{
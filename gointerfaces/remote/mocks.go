@@ -22,12 +22,27 @@ var _ KVClient = &KVClientMock{}
 //
 // 		// make and configure a mocked KVClient
 // 		mockedKVClient := &KVClientMock{
+// 			HealthFunc: func(ctx context.Context, in *emptypb.Empty, opts ...grpc.CallOption) (*HealthReply, error) {
+// 				panic("mock out the Health method")
+// 			},
+// 			HeartbeatFunc: func(ctx context.Context, in *ViewRequest, opts ...grpc.CallOption) (*emptypb.Empty, error) {
+// 				panic("mock out the Heartbeat method")
+// 			},
+// 			PinFunc: func(ctx context.Context, in *PinRequest, opts ...grpc.CallOption) (*PinReply, error) {
+// 				panic("mock out the Pin method")
+// 			},
 // 			StateChangesFunc: func(ctx context.Context, in *StateChangeRequest, opts ...grpc.CallOption) (KV_StateChangesClient, error) {
 // 				panic("mock out the StateChanges method")
 // 			},
+// 			StateChangesAckFunc: func(ctx context.Context, in *StateChangeAck, opts ...grpc.CallOption) (*emptypb.Empty, error) {
+// 				panic("mock out the StateChangesAck method")
+// 			},
 // 			TxFunc: func(ctx context.Context, opts ...grpc.CallOption) (KV_TxClient, error) {
 // 				panic("mock out the Tx method")
 // 			},
+// 			UnpinFunc: func(ctx context.Context, in *ViewRequest, opts ...grpc.CallOption) (*emptypb.Empty, error) {
+// 				panic("mock out the Unpin method")
+// 			},
 // 			VersionFunc: func(ctx context.Context, in *emptypb.Empty, opts ...grpc.CallOption) (*types.VersionReply, error) {
 // 				panic("mock out the Version method")
 // 			},
@@ -38,17 +53,59 @@ var _ KVClient = &KVClientMock{}
 //
 // 	}
 type KVClientMock struct {
+	// HealthFunc mocks the Health method.
+	HealthFunc func(ctx context.Context, in *emptypb.Empty, opts ...grpc.CallOption) (*HealthReply, error)
+
+	// HeartbeatFunc mocks the Heartbeat method.
+	HeartbeatFunc func(ctx context.Context, in *ViewRequest, opts ...grpc.CallOption) (*emptypb.Empty, error)
+
+	// PinFunc mocks the Pin method.
+	PinFunc func(ctx context.Context, in *PinRequest, opts ...grpc.CallOption) (*PinReply, error)
+
 	// StateChangesFunc mocks the StateChanges method.
 	StateChangesFunc func(ctx context.Context, in *StateChangeRequest, opts ...grpc.CallOption) (KV_StateChangesClient, error)
 
+	// StateChangesAckFunc mocks the StateChangesAck method.
+	StateChangesAckFunc func(ctx context.Context, in *StateChangeAck, opts ...grpc.CallOption) (*emptypb.Empty, error)
+
 	// TxFunc mocks the Tx method.
 	TxFunc func(ctx context.Context, opts ...grpc.CallOption) (KV_TxClient, error)
 
+	// UnpinFunc mocks the Unpin method.
+	UnpinFunc func(ctx context.Context, in *ViewRequest, opts ...grpc.CallOption) (*emptypb.Empty, error)
+
 	// VersionFunc mocks the Version method.
 	VersionFunc func(ctx context.Context, in *emptypb.Empty, opts ...grpc.CallOption) (*types.VersionReply, error)
 
 	// calls tracks calls to the methods.
 	calls struct {
+		// Health holds details about calls to the Health method.
+		Health []struct {
+			// Ctx is the ctx argument value.
+			Ctx context.Context
+			// In is the in argument value.
+			In *emptypb.Empty
+			// Opts is the opts argument value.
+			Opts []grpc.CallOption
+		}
+		// Heartbeat holds details about calls to the Heartbeat method.
+		Heartbeat []struct {
+			// Ctx is the ctx argument value.
+			Ctx context.Context
+			// In is the in argument value.
+			In *ViewRequest
+			// Opts is the opts argument value.
+			Opts []grpc.CallOption
+		}
+		// Pin holds details about calls to the Pin method.
+		Pin []struct {
+			// Ctx is the ctx argument value.
+			Ctx context.Context
+			// In is the in argument value.
+			In *PinRequest
+			// Opts is the opts argument value.
+			Opts []grpc.CallOption
+		}
 		// StateChanges holds details about calls to the StateChanges method.
 		StateChanges []struct {
 			// Ctx is the ctx argument value.
@@ -58,6 +115,15 @@ type KVClientMock struct {
 			// Opts is the opts argument value.
 			Opts []grpc.CallOption
 		}
+		// StateChangesAck holds details about calls to the StateChangesAck method.
+		StateChangesAck []struct {
+			// Ctx is the ctx argument value.
+			Ctx context.Context
+			// In is the in argument value.
+			In *StateChangeAck
+			// Opts is the opts argument value.
+			Opts []grpc.CallOption
+		}
 		// Tx holds details about calls to the Tx method.
 		Tx []struct {
 			// Ctx is the ctx argument value.
@@ -65,6 +131,15 @@ type KVClientMock struct {
 			// Opts is the opts argument value.
 			Opts []grpc.CallOption
 		}
+		// Unpin holds details about calls to the Unpin method.
+		Unpin []struct {
+			// Ctx is the ctx argument value.
+			Ctx context.Context
+			// In is the in argument value.
+			In *ViewRequest
+			// Opts is the opts argument value.
+			Opts []grpc.CallOption
+		}
 		// Version holds details about calls to the Version method.
 		Version []struct {
 			// Ctx is the ctx argument value.
@@ -75,9 +150,143 @@ type KVClientMock struct {
 			Opts []grpc.CallOption
 		}
 	}
-	lockStateChanges sync.RWMutex
-	lockTx           sync.RWMutex
-	lockVersion      sync.RWMutex
+	lockHealth          sync.RWMutex
+	lockHeartbeat       sync.RWMutex
+	lockPin             sync.RWMutex
+	lockStateChanges    sync.RWMutex
+	lockStateChangesAck sync.RWMutex
+	lockTx              sync.RWMutex
+	lockUnpin           sync.RWMutex
+	lockVersion         sync.RWMutex
+}
+
+// Health calls HealthFunc.
+func (mock *KVClientMock) Health(ctx context.Context, in *emptypb.Empty, opts ...grpc.CallOption) (*HealthReply, error) {
+	callInfo := struct {
+		Ctx  context.Context
+		In   *emptypb.Empty
+		Opts []grpc.CallOption
+	}{
+		Ctx:  ctx,
+		In:   in,
+		Opts: opts,
+	}
+	mock.lockHealth.Lock()
+	mock.calls.Health = append(mock.calls.Health, callInfo)
+	mock.lockHealth.Unlock()
+	if mock.HealthFunc == nil {
+		var (
+			healthReplyOut *HealthReply
+			errOut         error
+		)
+		return healthReplyOut, errOut
+	}
+	return mock.HealthFunc(ctx, in, opts...)
+}
+
+// HealthCalls gets all the calls that were made to Health.
+// Check the length with:
+//     len(mockedKVClient.HealthCalls())
+func (mock *KVClientMock) HealthCalls() []struct {
+	Ctx  context.Context
+	In   *emptypb.Empty
+	Opts []grpc.CallOption
+} {
+	var calls []struct {
+		Ctx  context.Context
+		In   *emptypb.Empty
+		Opts []grpc.CallOption
+	}
+	mock.lockHealth.RLock()
+	calls = mock.calls.Health
+	mock.lockHealth.RUnlock()
+	return calls
+}
+
+// Heartbeat calls HeartbeatFunc.
+func (mock *KVClientMock) Heartbeat(ctx context.Context, in *ViewRequest, opts ...grpc.CallOption) (*emptypb.Empty, error) {
+	callInfo := struct {
+		Ctx  context.Context
+		In   *ViewRequest
+		Opts []grpc.CallOption
+	}{
+		Ctx:  ctx,
+		In:   in,
+		Opts: opts,
+	}
+	mock.lockHeartbeat.Lock()
+	mock.calls.Heartbeat = append(mock.calls.Heartbeat, callInfo)
+	mock.lockHeartbeat.Unlock()
+	if mock.HeartbeatFunc == nil {
+		var (
+			emptyOut *emptypb.Empty
+			errOut   error
+		)
+		return emptyOut, errOut
+	}
+	return mock.HeartbeatFunc(ctx, in, opts...)
+}
+
+// HeartbeatCalls gets all the calls that were made to Heartbeat.
+// Check the length with:
+//     len(mockedKVClient.HeartbeatCalls())
+func (mock *KVClientMock) HeartbeatCalls() []struct {
+	Ctx  context.Context
+	In   *ViewRequest
+	Opts []grpc.CallOption
+} {
+	var calls []struct {
+		Ctx  context.Context
+		In   *ViewRequest
+		Opts []grpc.CallOption
+	}
+	mock.lockHeartbeat.RLock()
+	calls = mock.calls.Heartbeat
+	mock.lockHeartbeat.RUnlock()
+	return calls
+}
+
+// Pin calls PinFunc.
+func (mock *KVClientMock) Pin(ctx context.Context, in *PinRequest, opts ...grpc.CallOption) (*PinReply, error) {
+	callInfo := struct {
+		Ctx  context.Context
+		In   *PinRequest
+		Opts []grpc.CallOption
+	}{
+		Ctx:  ctx,
+		In:   in,
+		Opts: opts,
+	}
+	mock.lockPin.Lock()
+	mock.calls.Pin = append(mock.calls.Pin, callInfo)
+	mock.lockPin.Unlock()
+	if mock.PinFunc == nil {
+		var (
+			pinReplyOut *PinReply
+			errOut      error
+		)
+		return pinReplyOut, errOut
+	}
+	return mock.PinFunc(ctx, in, opts...)
+}
+
+// PinCalls gets all the calls that were made to Pin.
+// Check the length with:
+//     len(mockedKVClient.PinCalls())
+func (mock *KVClientMock) PinCalls() []struct {
+	Ctx  context.Context
+	In   *PinRequest
+	Opts []grpc.CallOption
+} {
+	var calls []struct {
+		Ctx  context.Context
+		In   *PinRequest
+		Opts []grpc.CallOption
+	}
+	mock.lockPin.RLock()
+	calls = mock.calls.Pin
+	mock.lockPin.RUnlock()
+	return calls
 }
 
 // StateChanges calls StateChangesFunc.
@@ -123,6 +332,49 @@ func (mock *KVClientMock) StateChangesCalls() []struct {
 	return calls
 }
 
+// StateChangesAck calls StateChangesAckFunc.
+func (mock *KVClientMock) StateChangesAck(ctx context.Context, in *StateChangeAck, opts ...grpc.CallOption) (*emptypb.Empty, error) {
+	callInfo := struct {
+		Ctx  context.Context
+		In   *StateChangeAck
+		Opts []grpc.CallOption
+	}{
+		Ctx:  ctx,
+		In:   in,
+		Opts: opts,
+	}
+	mock.lockStateChangesAck.Lock()
+	mock.calls.StateChangesAck = append(mock.calls.StateChangesAck, callInfo)
+	mock.lockStateChangesAck.Unlock()
+	if mock.StateChangesAckFunc == nil {
+		var (
+			emptyOut *emptypb.Empty
+			errOut   error
+		)
+		return emptyOut, errOut
+	}
+	return mock.StateChangesAckFunc(ctx, in, opts...)
+}
+
+// StateChangesAckCalls gets all the calls that were made to StateChangesAck.
+// Check the length with:
+//     len(mockedKVClient.StateChangesAckCalls())
+func (mock *KVClientMock) StateChangesAckCalls() []struct {
+	Ctx  context.Context
+	In   *StateChangeAck
+	Opts []grpc.CallOption
+} {
+	var calls []struct {
+		Ctx  context.Context
+		In   *StateChangeAck
+		Opts []grpc.CallOption
+	}
+	mock.lockStateChangesAck.RLock()
+	calls = mock.calls.StateChangesAck
+	mock.lockStateChangesAck.RUnlock()
+	return calls
+}
+
 // Tx calls TxFunc.
 func (mock *KVClientMock) Tx(ctx context.Context, opts ...grpc.CallOption) (KV_TxClient, error) {
 	callInfo := struct {
@@ -162,6 +414,49 @@ func (mock *KVClientMock) TxCalls() []struct {
 	return calls
 }
 
+// Unpin calls UnpinFunc.
+func (mock *KVClientMock) Unpin(ctx context.Context, in *ViewRequest, opts ...grpc.CallOption) (*emptypb.Empty, error) {
+	callInfo := struct {
+		Ctx  context.Context
+		In   *ViewRequest
+		Opts []grpc.CallOption
+	}{
+		Ctx:  ctx,
+		In:   in,
+		Opts: opts,
+	}
+	mock.lockUnpin.Lock()
+	mock.calls.Unpin = append(mock.calls.Unpin, callInfo)
+	mock.lockUnpin.Unlock()
+	if mock.UnpinFunc == nil {
+		var (
+			emptyOut *emptypb.Empty
+			errOut   error
+		)
+		return emptyOut, errOut
+	}
+	return mock.UnpinFunc(ctx, in, opts...)
+}
+
+// UnpinCalls gets all the calls that were made to Unpin.
+// Check the length with:
+//     len(mockedKVClient.UnpinCalls())
+func (mock *KVClientMock) UnpinCalls() []struct {
+	Ctx  context.Context
+	In   *ViewRequest
+	Opts []grpc.CallOption
+} {
+	var calls []struct {
+		Ctx  context.Context
+		In   *ViewRequest
+		Opts []grpc.CallOption
+	}
+	mock.lockUnpin.RLock()
+	calls = mock.calls.Unpin
+	mock.lockUnpin.RUnlock()
+	return calls
+}
+
 // Version calls VersionFunc.
 func (mock *KVClientMock) Version(ctx context.Context, in *emptypb.Empty, opts ...grpc.CallOption) (*types.VersionReply, error) {
 	callInfo := struct {
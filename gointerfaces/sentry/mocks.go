@@ -5,6 +5,7 @@ package sentry
 
 import (
 	context "context"
+	types "github.com/ledgerwatch/erigon-lib/gointerfaces/types"
 	grpc "google.golang.org/grpc"
 	emptypb "google.golang.org/protobuf/types/known/emptypb"
 	sync "sync"
@@ -53,6 +54,9 @@ var _ SentryServer = &SentryServerMock{}
 // 			SetStatusFunc: func(contextMoqParam context.Context, statusData *StatusData) (*SetStatusReply, error) {
 // 				panic("mock out the SetStatus method")
 // 			},
+// 			VersionFunc: func(contextMoqParam context.Context, empty *emptypb.Empty) (*types.VersionReply, error) {
+// 				panic("mock out the Version method")
+// 			},
 // 			mustEmbedUnimplementedSentryServerFunc: func()  {
 // 				panic("mock out the mustEmbedUnimplementedSentryServer method")
 // 			},
@@ -96,6 +100,9 @@ type SentryServerMock struct {
 	// SetStatusFunc mocks the SetStatus method.
 	SetStatusFunc func(contextMoqParam context.Context, statusData *StatusData) (*SetStatusReply, error)
 
+	// VersionFunc mocks the Version method.
+	VersionFunc func(contextMoqParam context.Context, empty *emptypb.Empty) (*types.VersionReply, error)
+
 	// mustEmbedUnimplementedSentryServerFunc mocks the mustEmbedUnimplementedSentryServer method.
 	mustEmbedUnimplementedSentryServerFunc func()
 
@@ -178,6 +185,13 @@ type SentryServerMock struct {
 			// StatusData is the statusData argument value.
 			StatusData *StatusData
 		}
+		// Version holds details about calls to the Version method.
+		Version []struct {
+			// ContextMoqParam is the contextMoqParam argument value.
+			ContextMoqParam context.Context
+			// Empty is the empty argument value.
+			Empty *emptypb.Empty
+		}
 		// mustEmbedUnimplementedSentryServer holds details about calls to the mustEmbedUnimplementedSentryServer method.
 		mustEmbedUnimplementedSentryServer []struct {
 		}
@@ -193,6 +207,7 @@ type SentryServerMock struct {
 	lockSendMessageToAll                   sync.RWMutex
 	lockSendMessageToRandomPeers           sync.RWMutex
 	lockSetStatus                          sync.RWMutex
+	lockVersion                            sync.RWMutex
 	lockmustEmbedUnimplementedSentryServer sync.RWMutex
 }
 
@@ -623,6 +638,45 @@ func (mock *SentryServerMock) SetStatusCalls() []struct {
 	return calls
 }
 
+// Version calls VersionFunc.
+func (mock *SentryServerMock) Version(contextMoqParam context.Context, empty *emptypb.Empty) (*types.VersionReply, error) {
+	callInfo := struct {
+		ContextMoqParam context.Context
+		Empty           *emptypb.Empty
+	}{
+		ContextMoqParam: contextMoqParam,
+		Empty:           empty,
+	}
+	mock.lockVersion.Lock()
+	mock.calls.Version = append(mock.calls.Version, callInfo)
+	mock.lockVersion.Unlock()
+	if mock.VersionFunc == nil {
+		var (
+			versionReplyOut *types.VersionReply
+			errOut          error
+		)
+		return versionReplyOut, errOut
+	}
+	return mock.VersionFunc(contextMoqParam, empty)
+}
+
+// VersionCalls gets all the calls that were made to Version.
+// Check the length with:
+//     len(mockedSentryServer.VersionCalls())
+func (mock *SentryServerMock) VersionCalls() []struct {
+	ContextMoqParam context.Context
+	Empty           *emptypb.Empty
+} {
+	var calls []struct {
+		ContextMoqParam context.Context
+		Empty           *emptypb.Empty
+	}
+	mock.lockVersion.RLock()
+	calls = mock.calls.Version
+	mock.lockVersion.RUnlock()
+	return calls
+}
+
 // mustEmbedUnimplementedSentryServer calls mustEmbedUnimplementedSentryServerFunc.
 func (mock *SentryServerMock) mustEmbedUnimplementedSentryServer() {
 	callInfo := struct {
@@ -692,6 +746,9 @@ var _ SentryClient = &SentryClientMock{}
 // 			SetStatusFunc: func(ctx context.Context, in *StatusData, opts ...grpc.CallOption) (*SetStatusReply, error) {
 // 				panic("mock out the SetStatus method")
 // 			},
+// 			VersionFunc: func(ctx context.Context, in *emptypb.Empty, opts ...grpc.CallOption) (*types.VersionReply, error) {
+// 				panic("mock out the Version method")
+// 			},
 // 		}
 //
 // 		// use mockedSentryClient in code that requires SentryClient
@@ -732,6 +789,9 @@ type SentryClientMock struct {
 	// SetStatusFunc mocks the SetStatus method.
 	SetStatusFunc func(ctx context.Context, in *StatusData, opts ...grpc.CallOption) (*SetStatusReply, error)
 
+	// VersionFunc mocks the Version method.
+	VersionFunc func(ctx context.Context, in *emptypb.Empty, opts ...grpc.CallOption) (*types.VersionReply, error)
+
 	// calls tracks calls to the methods.
 	calls struct {
 		// HandShake holds details about calls to the HandShake method.
@@ -833,6 +893,15 @@ type SentryClientMock struct {
 			// Opts is the opts argument value.
 			Opts []grpc.CallOption
 		}
+		// Version holds details about calls to the Version method.
+		Version []struct {
+			// Ctx is the ctx argument value.
+			Ctx context.Context
+			// In is the in argument value.
+			In *emptypb.Empty
+			// Opts is the opts argument value.
+			Opts []grpc.CallOption
+		}
 	}
 	lockHandShake                sync.RWMutex
 	lockMessages                 sync.RWMutex
@@ -845,6 +914,7 @@ type SentryClientMock struct {
 	lockSendMessageToAll         sync.RWMutex
 	lockSendMessageToRandomPeers sync.RWMutex
 	lockSetStatus                sync.RWMutex
+	lockVersion                  sync.RWMutex
 }
 
 // HandShake calls HandShakeFunc.
@@ -1319,3 +1389,46 @@ func (mock *SentryClientMock) SetStatusCalls() []struct {
 	mock.lockSetStatus.RUnlock()
 	return calls
 }
+
+// Version calls VersionFunc.
+func (mock *SentryClientMock) Version(ctx context.Context, in *emptypb.Empty, opts ...grpc.CallOption) (*types.VersionReply, error) {
+	callInfo := struct {
+		Ctx  context.Context
+		In   *emptypb.Empty
+		Opts []grpc.CallOption
+	}{
+		Ctx:  ctx,
+		In:   in,
+		Opts: opts,
+	}
+	mock.lockVersion.Lock()
+	mock.calls.Version = append(mock.calls.Version, callInfo)
+	mock.lockVersion.Unlock()
+	if mock.VersionFunc == nil {
+		var (
+			versionReplyOut *types.VersionReply
+			errOut          error
+		)
+		return versionReplyOut, errOut
+	}
+	return mock.VersionFunc(ctx, in, opts...)
+}
+
+// VersionCalls gets all the calls that were made to Version.
+// Check the length with:
+//     len(mockedSentryClient.VersionCalls())
+func (mock *SentryClientMock) VersionCalls() []struct {
+	Ctx  context.Context
+	In   *emptypb.Empty
+	Opts []grpc.CallOption
+} {
+	var calls []struct {
+		Ctx  context.Context
+		In   *emptypb.Empty
+		Opts []grpc.CallOption
+	}
+	mock.lockVersion.RLock()
+	calls = mock.calls.Version
+	mock.lockVersion.RUnlock()
+	return calls
+}
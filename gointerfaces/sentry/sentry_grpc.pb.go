@@ -4,6 +4,7 @@ package sentry
 
 import (
 	context "context"
+	types "github.com/ledgerwatch/erigon-lib/gointerfaces/types"
 	grpc "google.golang.org/grpc"
 	codes "google.golang.org/grpc/codes"
 	status "google.golang.org/grpc/status"
@@ -37,6 +38,8 @@ type SentryClient interface {
 	PeerCount(ctx context.Context, in *PeerCountRequest, opts ...grpc.CallOption) (*PeerCountReply, error)
 	// Notifications about connected (after sub-protocol handshake) or lost peer
 	Peers(ctx context.Context, in *PeersRequest, opts ...grpc.CallOption) (Sentry_PeersClient, error)
+	// Version returns the service version number
+	Version(ctx context.Context, in *emptypb.Empty, opts ...grpc.CallOption) (*types.VersionReply, error)
 }
 
 type sentryClient struct {
@@ -192,6 +195,15 @@ func (x *sentryPeersClient) Recv() (*PeersReply, error) {
 	return m, nil
 }
 
+func (c *sentryClient) Version(ctx context.Context, in *emptypb.Empty, opts ...grpc.CallOption) (*types.VersionReply, error) {
+	out := new(types.VersionReply)
+	err := c.cc.Invoke(ctx, "/sentry.Sentry/Version", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 // SentryServer is the server API for Sentry service.
 // All implementations must embed UnimplementedSentryServer
 // for forward compatibility
@@ -214,6 +226,8 @@ type SentryServer interface {
 	PeerCount(context.Context, *PeerCountRequest) (*PeerCountReply, error)
 	// Notifications about connected (after sub-protocol handshake) or lost peer
 	Peers(*PeersRequest, Sentry_PeersServer) error
+	// Version returns the service version number
+	Version(context.Context, *emptypb.Empty) (*types.VersionReply, error)
 	mustEmbedUnimplementedSentryServer()
 }
 
@@ -254,6 +268,9 @@ func (UnimplementedSentryServer) PeerCount(context.Context, *PeerCountRequest) (
 func (UnimplementedSentryServer) Peers(*PeersRequest, Sentry_PeersServer) error {
 	return status.Errorf(codes.Unimplemented, "method Peers not implemented")
 }
+func (UnimplementedSentryServer) Version(context.Context, *emptypb.Empty) (*types.VersionReply, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Version not implemented")
+}
 func (UnimplementedSentryServer) mustEmbedUnimplementedSentryServer() {}
 
 // UnsafeSentryServer may be embedded to opt out of forward compatibility for this service.
@@ -471,6 +488,24 @@ func (x *sentryPeersServer) Send(m *PeersReply) error {
 	return x.ServerStream.SendMsg(m)
 }
 
+func _Sentry_Version_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(emptypb.Empty)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(SentryServer).Version(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/sentry.Sentry/Version",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(SentryServer).Version(ctx, req.(*emptypb.Empty))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 // Sentry_ServiceDesc is the grpc.ServiceDesc for Sentry service.
 // It's only intended for direct use with grpc.RegisterService,
 // and not to be introspected or modified (even as a copy)
@@ -514,6 +549,10 @@ var Sentry_ServiceDesc = grpc.ServiceDesc{
 			MethodName: "PeerCount",
 			Handler:    _Sentry_PeerCount_Handler,
 		},
+		{
+			MethodName: "Version",
+			Handler:    _Sentry_Version_Handler,
+		},
 	},
 	Streams: []grpc.StreamDesc{
 		{
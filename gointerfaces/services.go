@@ -0,0 +1,72 @@
+/*
+   Copyright 2021 Erigon contributors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package gointerfaces
+
+// Features of services, see Negotiated.Supports
+const (
+	KVRange           = "range"
+	KVBatchedNext     = "batched_next"
+	KVPin             = "pin"
+	KVHealth          = "health"
+	KVStateChangesAck = "state_changes_ack"
+	KVPendingBlobFee  = "pending_blob_fee"
+	KVTemporal        = "temporal"
+
+	TxPoolContent        = "content"
+	TxPoolEvents         = "events"
+	TxPoolPrivate        = "private"
+	TxPoolDigest         = "digest"
+	TxPoolUnknown        = "find_unknown"
+	TxPoolEventsSequence = "events_sequence"
+
+	DownloaderRateLimits = "rate_limits"
+	DownloaderPause      = "pause"
+	DownloaderProgress   = "progress"
+)
+
+// KVService - remote.KV, served by remotedbserver.KvServer
+var KVService = Service{Name: "KV", Version: Version{3, 7, 0}, Features: []Feature{
+	{KVRange, Version{3, 1, 0}},
+	{KVBatchedNext, Version{3, 2, 0}},
+	{KVPin, Version{3, 3, 0}},
+	{KVHealth, Version{3, 4, 0}},
+	{KVStateChangesAck, Version{3, 5, 0}},
+	{KVPendingBlobFee, Version{3, 6, 0}},
+	{KVTemporal, Version{3, 7, 0}},
+}}
+
+// TxPoolService - txpool.Txpool, served by txpool.GrpcServer
+var TxPoolService = Service{Name: "txpool", Version: Version{1, 6, 0}, Features: []Feature{
+	{TxPoolContent, Version{1, 1, 0}},
+	{TxPoolEvents, Version{1, 2, 0}},
+	{TxPoolPrivate, Version{1, 3, 0}},
+	{TxPoolDigest, Version{1, 4, 0}},
+	{TxPoolUnknown, Version{1, 5, 0}},
+	{TxPoolEventsSequence, Version{1, 6, 0}},
+}}
+
+// SentryService - sentry.Sentry. ETH protocol of sentry is negotiated separately, by HandShake
+// 1.1.0 - Added Version
+var SentryService = Service{Name: "sentry", Version: Version{1, 1, 0}}
+
+// DownloaderService - snapshotsync.Downloader
+// 1.2.0 - Added Version
+var DownloaderService = Service{Name: "downloader", Version: Version{1, 2, 0}, Features: []Feature{
+	{DownloaderRateLimits, Version{1, 1, 0}},
+	{DownloaderPause, Version{1, 1, 0}},
+	{DownloaderProgress, Version{1, 1, 0}},
+}}
@@ -4,6 +4,7 @@ package snapshotsync
 
 import (
 	context "context"
+	types "github.com/ledgerwatch/erigon-lib/gointerfaces/types"
 	grpc "google.golang.org/grpc"
 	codes "google.golang.org/grpc/codes"
 	status "google.golang.org/grpc/status"
@@ -21,6 +22,17 @@ const _ = grpc.SupportPackageIsVersion7
 type DownloaderClient interface {
 	Download(ctx context.Context, in *DownloadSnapshotRequest, opts ...grpc.CallOption) (*emptypb.Empty, error)
 	Snapshots(ctx context.Context, in *SnapshotsRequest, opts ...grpc.CallOption) (*SnapshotsInfoReply, error)
+	// SetRateLimits - limits of all items together, zero values mean no limit
+	SetRateLimits(ctx context.Context, in *SetRateLimitsRequest, opts ...grpc.CallOption) (*emptypb.Empty, error)
+	// SetItemRateLimits - limits of one item, on top of global ones. Zero limits remove limits of item
+	SetItemRateLimits(ctx context.Context, in *SetItemRateLimitsRequest, opts ...grpc.CallOption) (*emptypb.Empty, error)
+	// Pause - stops download and seeding of items, empty names mean all items
+	Pause(ctx context.Context, in *ItemsRequest, opts ...grpc.CallOption) (*emptypb.Empty, error)
+	Resume(ctx context.Context, in *ItemsRequest, opts ...grpc.CallOption) (*emptypb.Empty, error)
+	// Progress - per-file progress, empty names mean all items
+	Progress(ctx context.Context, in *ItemsRequest, opts ...grpc.CallOption) (*ProgressReply, error)
+	// Version returns the service version number
+	Version(ctx context.Context, in *emptypb.Empty, opts ...grpc.CallOption) (*types.VersionReply, error)
 }
 
 type downloaderClient struct {
@@ -49,12 +61,77 @@ func (c *downloaderClient) Snapshots(ctx context.Context, in *SnapshotsRequest,
 	return out, nil
 }
 
+func (c *downloaderClient) SetRateLimits(ctx context.Context, in *SetRateLimitsRequest, opts ...grpc.CallOption) (*emptypb.Empty, error) {
+	out := new(emptypb.Empty)
+	err := c.cc.Invoke(ctx, "/snapshotsync.Downloader/SetRateLimits", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *downloaderClient) SetItemRateLimits(ctx context.Context, in *SetItemRateLimitsRequest, opts ...grpc.CallOption) (*emptypb.Empty, error) {
+	out := new(emptypb.Empty)
+	err := c.cc.Invoke(ctx, "/snapshotsync.Downloader/SetItemRateLimits", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *downloaderClient) Pause(ctx context.Context, in *ItemsRequest, opts ...grpc.CallOption) (*emptypb.Empty, error) {
+	out := new(emptypb.Empty)
+	err := c.cc.Invoke(ctx, "/snapshotsync.Downloader/Pause", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *downloaderClient) Resume(ctx context.Context, in *ItemsRequest, opts ...grpc.CallOption) (*emptypb.Empty, error) {
+	out := new(emptypb.Empty)
+	err := c.cc.Invoke(ctx, "/snapshotsync.Downloader/Resume", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *downloaderClient) Progress(ctx context.Context, in *ItemsRequest, opts ...grpc.CallOption) (*ProgressReply, error) {
+	out := new(ProgressReply)
+	err := c.cc.Invoke(ctx, "/snapshotsync.Downloader/Progress", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *downloaderClient) Version(ctx context.Context, in *emptypb.Empty, opts ...grpc.CallOption) (*types.VersionReply, error) {
+	out := new(types.VersionReply)
+	err := c.cc.Invoke(ctx, "/snapshotsync.Downloader/Version", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 // DownloaderServer is the server API for Downloader service.
 // All implementations must embed UnimplementedDownloaderServer
 // for forward compatibility
 type DownloaderServer interface {
 	Download(context.Context, *DownloadSnapshotRequest) (*emptypb.Empty, error)
 	Snapshots(context.Context, *SnapshotsRequest) (*SnapshotsInfoReply, error)
+	// SetRateLimits - limits of all items together, zero values mean no limit
+	SetRateLimits(context.Context, *SetRateLimitsRequest) (*emptypb.Empty, error)
+	// SetItemRateLimits - limits of one item, on top of global ones. Zero limits remove limits of item
+	SetItemRateLimits(context.Context, *SetItemRateLimitsRequest) (*emptypb.Empty, error)
+	// Pause - stops download and seeding of items, empty names mean all items
+	Pause(context.Context, *ItemsRequest) (*emptypb.Empty, error)
+	Resume(context.Context, *ItemsRequest) (*emptypb.Empty, error)
+	// Progress - per-file progress, empty names mean all items
+	Progress(context.Context, *ItemsRequest) (*ProgressReply, error)
+	// Version returns the service version number
+	Version(context.Context, *emptypb.Empty) (*types.VersionReply, error)
 	mustEmbedUnimplementedDownloaderServer()
 }
 
@@ -68,6 +145,24 @@ func (UnimplementedDownloaderServer) Download(context.Context, *DownloadSnapshot
 func (UnimplementedDownloaderServer) Snapshots(context.Context, *SnapshotsRequest) (*SnapshotsInfoReply, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method Snapshots not implemented")
 }
+func (UnimplementedDownloaderServer) SetRateLimits(context.Context, *SetRateLimitsRequest) (*emptypb.Empty, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method SetRateLimits not implemented")
+}
+func (UnimplementedDownloaderServer) SetItemRateLimits(context.Context, *SetItemRateLimitsRequest) (*emptypb.Empty, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method SetItemRateLimits not implemented")
+}
+func (UnimplementedDownloaderServer) Pause(context.Context, *ItemsRequest) (*emptypb.Empty, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Pause not implemented")
+}
+func (UnimplementedDownloaderServer) Resume(context.Context, *ItemsRequest) (*emptypb.Empty, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Resume not implemented")
+}
+func (UnimplementedDownloaderServer) Progress(context.Context, *ItemsRequest) (*ProgressReply, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Progress not implemented")
+}
+func (UnimplementedDownloaderServer) Version(context.Context, *emptypb.Empty) (*types.VersionReply, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Version not implemented")
+}
 func (UnimplementedDownloaderServer) mustEmbedUnimplementedDownloaderServer() {}
 
 // UnsafeDownloaderServer may be embedded to opt out of forward compatibility for this service.
@@ -117,6 +212,114 @@ func _Downloader_Snapshots_Handler(srv interface{}, ctx context.Context, dec fun
 	return interceptor(ctx, in, info, handler)
 }
 
+func _Downloader_SetRateLimits_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SetRateLimitsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(DownloaderServer).SetRateLimits(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/snapshotsync.Downloader/SetRateLimits",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(DownloaderServer).SetRateLimits(ctx, req.(*SetRateLimitsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Downloader_SetItemRateLimits_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SetItemRateLimitsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(DownloaderServer).SetItemRateLimits(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/snapshotsync.Downloader/SetItemRateLimits",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(DownloaderServer).SetItemRateLimits(ctx, req.(*SetItemRateLimitsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Downloader_Pause_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ItemsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(DownloaderServer).Pause(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/snapshotsync.Downloader/Pause",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(DownloaderServer).Pause(ctx, req.(*ItemsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Downloader_Resume_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ItemsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(DownloaderServer).Resume(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/snapshotsync.Downloader/Resume",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(DownloaderServer).Resume(ctx, req.(*ItemsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Downloader_Progress_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ItemsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(DownloaderServer).Progress(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/snapshotsync.Downloader/Progress",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(DownloaderServer).Progress(ctx, req.(*ItemsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Downloader_Version_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(emptypb.Empty)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(DownloaderServer).Version(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/snapshotsync.Downloader/Version",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(DownloaderServer).Version(ctx, req.(*emptypb.Empty))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 // Downloader_ServiceDesc is the grpc.ServiceDesc for Downloader service.
 // It's only intended for direct use with grpc.RegisterService,
 // and not to be introspected or modified (even as a copy)
@@ -132,6 +335,30 @@ var Downloader_ServiceDesc = grpc.ServiceDesc{
 			MethodName: "Snapshots",
 			Handler:    _Downloader_Snapshots_Handler,
 		},
+		{
+			MethodName: "SetRateLimits",
+			Handler:    _Downloader_SetRateLimits_Handler,
+		},
+		{
+			MethodName: "SetItemRateLimits",
+			Handler:    _Downloader_SetItemRateLimits_Handler,
+		},
+		{
+			MethodName: "Pause",
+			Handler:    _Downloader_Pause_Handler,
+		},
+		{
+			MethodName: "Resume",
+			Handler:    _Downloader_Resume_Handler,
+		},
+		{
+			MethodName: "Progress",
+			Handler:    _Downloader_Progress_Handler,
+		},
+		{
+			MethodName: "Version",
+			Handler:    _Downloader_Version_Handler,
+		},
 	},
 	Streams:  []grpc.StreamDesc{},
 	Metadata: "snapshot_downloader/external_downloader.proto",
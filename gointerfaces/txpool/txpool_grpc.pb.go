@@ -26,7 +26,7 @@ type TxpoolClient interface {
 	// preserves incoming order, changes amount, unknown hashes will be omitted
 	FindUnknown(ctx context.Context, in *TxHashes, opts ...grpc.CallOption) (*TxHashes, error)
 	// Expecting signed transactions. Preserves incoming order and amount
-	// Adding txs as local (use P2P to add remote txs)
+	// Adding txs as local (use P2P to add remote txs), or as private
 	Add(ctx context.Context, in *AddRequest, opts ...grpc.CallOption) (*AddReply, error)
 	// preserves incoming order and amount, if some transaction doesn't exists in pool - returns nil in this slot
 	Transactions(ctx context.Context, in *TransactionsRequest, opts ...grpc.CallOption) (*TransactionsReply, error)
@@ -36,6 +36,14 @@ type TxpoolClient interface {
 	OnAdd(ctx context.Context, in *OnAddRequest, opts ...grpc.CallOption) (Txpool_OnAddClient, error)
 	// returns high level status
 	Status(ctx context.Context, in *StatusRequest, opts ...grpc.CallOption) (*StatusReply, error)
+	// returns pending and queued transactions grouped by sender - for txpool_content
+	Content(ctx context.Context, in *ContentRequest, opts ...grpc.CallOption) (*ContentReply, error)
+	// same as Content, but without rlp of transactions - for txpool_inspect
+	Inspect(ctx context.Context, in *InspectRequest, opts ...grpc.CallOption) (*InspectReply, error)
+	// subscribe to lifecycle events of pooled transactions. Events are dropped if subscriber is too slow
+	Events(ctx context.Context, in *EventsRequest, opts ...grpc.CallOption) (Txpool_EventsClient, error)
+	// canonical digest of pooled transactions - to compare pools of nodes
+	Digest(ctx context.Context, in *DigestRequest, opts ...grpc.CallOption) (*DigestReply, error)
 }
 
 type txpoolClient struct {
@@ -132,6 +140,65 @@ func (c *txpoolClient) Status(ctx context.Context, in *StatusRequest, opts ...gr
 	return out, nil
 }
 
+func (c *txpoolClient) Content(ctx context.Context, in *ContentRequest, opts ...grpc.CallOption) (*ContentReply, error) {
+	out := new(ContentReply)
+	err := c.cc.Invoke(ctx, "/txpool.Txpool/Content", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *txpoolClient) Inspect(ctx context.Context, in *InspectRequest, opts ...grpc.CallOption) (*InspectReply, error) {
+	out := new(InspectReply)
+	err := c.cc.Invoke(ctx, "/txpool.Txpool/Inspect", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *txpoolClient) Events(ctx context.Context, in *EventsRequest, opts ...grpc.CallOption) (Txpool_EventsClient, error) {
+	stream, err := c.cc.NewStream(ctx, &Txpool_ServiceDesc.Streams[1], "/txpool.Txpool/Events", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &txpoolEventsClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type Txpool_EventsClient interface {
+	Recv() (*EventsReply, error)
+	grpc.ClientStream
+}
+
+type txpoolEventsClient struct {
+	grpc.ClientStream
+}
+
+func (x *txpoolEventsClient) Recv() (*EventsReply, error) {
+	m := new(EventsReply)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *txpoolClient) Digest(ctx context.Context, in *DigestRequest, opts ...grpc.CallOption) (*DigestReply, error) {
+	out := new(DigestReply)
+	err := c.cc.Invoke(ctx, "/txpool.Txpool/Digest", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 // TxpoolServer is the server API for Txpool service.
 // All implementations must embed UnimplementedTxpoolServer
 // for forward compatibility
@@ -141,7 +208,7 @@ type TxpoolServer interface {
 	// preserves incoming order, changes amount, unknown hashes will be omitted
 	FindUnknown(context.Context, *TxHashes) (*TxHashes, error)
 	// Expecting signed transactions. Preserves incoming order and amount
-	// Adding txs as local (use P2P to add remote txs)
+	// Adding txs as local (use P2P to add remote txs), or as private
 	Add(context.Context, *AddRequest) (*AddReply, error)
 	// preserves incoming order and amount, if some transaction doesn't exists in pool - returns nil in this slot
 	Transactions(context.Context, *TransactionsRequest) (*TransactionsReply, error)
@@ -151,6 +218,14 @@ type TxpoolServer interface {
 	OnAdd(*OnAddRequest, Txpool_OnAddServer) error
 	// returns high level status
 	Status(context.Context, *StatusRequest) (*StatusReply, error)
+	// returns pending and queued transactions grouped by sender - for txpool_content
+	Content(context.Context, *ContentRequest) (*ContentReply, error)
+	// same as Content, but without rlp of transactions - for txpool_inspect
+	Inspect(context.Context, *InspectRequest) (*InspectReply, error)
+	// subscribe to lifecycle events of pooled transactions. Events are dropped if subscriber is too slow
+	Events(*EventsRequest, Txpool_EventsServer) error
+	// canonical digest of pooled transactions - to compare pools of nodes
+	Digest(context.Context, *DigestRequest) (*DigestReply, error)
 	mustEmbedUnimplementedTxpoolServer()
 }
 
@@ -179,6 +254,18 @@ func (UnimplementedTxpoolServer) OnAdd(*OnAddRequest, Txpool_OnAddServer) error
 func (UnimplementedTxpoolServer) Status(context.Context, *StatusRequest) (*StatusReply, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method Status not implemented")
 }
+func (UnimplementedTxpoolServer) Content(context.Context, *ContentRequest) (*ContentReply, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Content not implemented")
+}
+func (UnimplementedTxpoolServer) Inspect(context.Context, *InspectRequest) (*InspectReply, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Inspect not implemented")
+}
+func (UnimplementedTxpoolServer) Events(*EventsRequest, Txpool_EventsServer) error {
+	return status.Errorf(codes.Unimplemented, "method Events not implemented")
+}
+func (UnimplementedTxpoolServer) Digest(context.Context, *DigestRequest) (*DigestReply, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Digest not implemented")
+}
 func (UnimplementedTxpoolServer) mustEmbedUnimplementedTxpoolServer() {}
 
 // UnsafeTxpoolServer may be embedded to opt out of forward compatibility for this service.
@@ -321,6 +408,81 @@ func _Txpool_Status_Handler(srv interface{}, ctx context.Context, dec func(inter
 	return interceptor(ctx, in, info, handler)
 }
 
+func _Txpool_Content_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ContentRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TxpoolServer).Content(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/txpool.Txpool/Content",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TxpoolServer).Content(ctx, req.(*ContentRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Txpool_Inspect_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(InspectRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TxpoolServer).Inspect(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/txpool.Txpool/Inspect",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TxpoolServer).Inspect(ctx, req.(*InspectRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Txpool_Events_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(EventsRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(TxpoolServer).Events(m, &txpoolEventsServer{stream})
+}
+
+type Txpool_EventsServer interface {
+	Send(*EventsReply) error
+	grpc.ServerStream
+}
+
+type txpoolEventsServer struct {
+	grpc.ServerStream
+}
+
+func (x *txpoolEventsServer) Send(m *EventsReply) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func _Txpool_Digest_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DigestRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TxpoolServer).Digest(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/txpool.Txpool/Digest",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TxpoolServer).Digest(ctx, req.(*DigestRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 // Txpool_ServiceDesc is the grpc.ServiceDesc for Txpool service.
 // It's only intended for direct use with grpc.RegisterService,
 // and not to be introspected or modified (even as a copy)
@@ -352,6 +514,18 @@ var Txpool_ServiceDesc = grpc.ServiceDesc{
 			MethodName: "Status",
 			Handler:    _Txpool_Status_Handler,
 		},
+		{
+			MethodName: "Content",
+			Handler:    _Txpool_Content_Handler,
+		},
+		{
+			MethodName: "Inspect",
+			Handler:    _Txpool_Inspect_Handler,
+		},
+		{
+			MethodName: "Digest",
+			Handler:    _Txpool_Digest_Handler,
+		},
 	},
 	Streams: []grpc.StreamDesc{
 		{
@@ -359,6 +533,11 @@ var Txpool_ServiceDesc = grpc.ServiceDesc{
 			Handler:       _Txpool_OnAdd_Handler,
 			ServerStreams: true,
 		},
+		{
+			StreamName:    "Events",
+			Handler:       _Txpool_Events_Handler,
+			ServerStreams: true,
+		},
 	},
 	Metadata: "txpool/txpool.proto",
 }
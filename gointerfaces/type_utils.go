@@ -44,6 +44,50 @@ func ConvertHashToH256(hash [32]byte) *types.H256 {
 	}
 }
 
+// SetH256 - writes hash into existing message, allocates only missing halves. For messages reused between stream sends
+func SetH256(dst *types.H256, hash [32]byte) *types.H256 {
+	if dst.Hi == nil {
+		dst.Hi = &types.H128{}
+	}
+	if dst.Lo == nil {
+		dst.Lo = &types.H128{}
+	}
+	dst.Hi.Hi, dst.Hi.Lo = binary.BigEndian.Uint64(hash[0:]), binary.BigEndian.Uint64(hash[8:])
+	dst.Lo.Hi, dst.Lo.Lo = binary.BigEndian.Uint64(hash[16:]), binary.BigEndian.Uint64(hash[24:])
+	return dst
+}
+
+// AppendH256s - appends hashes to dst as 32-byte items, same layout as txpool.Hashes
+func AppendH256s(dst []byte, hashes []*types.H256) []byte {
+	for _, h := range hashes {
+		var b [32]byte
+		binary.BigEndian.PutUint64(b[0:], h.Hi.Hi)
+		binary.BigEndian.PutUint64(b[8:], h.Hi.Lo)
+		binary.BigEndian.PutUint64(b[16:], h.Lo.Hi)
+		binary.BigEndian.PutUint64(b[24:], h.Lo.Lo)
+		dst = append(dst, b[:]...)
+	}
+	return dst
+}
+
+// ConvertHashesToH256s - hashes are 32-byte items, same layout as txpool.Hashes.
+// Makes 3 allocations for whole list instead of 3 per hash
+func ConvertHashesToH256s(hashes []byte) []*types.H256 {
+	n := len(hashes) / 32
+	res := make([]*types.H256, n)
+	h256 := make([]types.H256, n)
+	h128 := make([]types.H128, 2*n)
+	for i := 0; i < n; i++ {
+		h := hashes[i*32:]
+		hi, lo := &h128[2*i], &h128[2*i+1]
+		hi.Hi, hi.Lo = binary.BigEndian.Uint64(h[0:]), binary.BigEndian.Uint64(h[8:])
+		lo.Hi, lo.Lo = binary.BigEndian.Uint64(h[16:]), binary.BigEndian.Uint64(h[24:])
+		h256[i].Hi, h256[i].Lo = hi, lo
+		res[i] = &h256[i]
+	}
+	return res
+}
+
 func ConvertH160toAddress(h160 *types.H160) [20]byte {
 	var addr [20]byte
 	binary.BigEndian.PutUint64(addr[0:], h160.Hi.Hi)
@@ -78,6 +122,12 @@ func ConvertUint256IntToH256(i *uint256.Int) *types.H256 {
 }
 
 func ConvertH512ToBytes(h512 *types.H512) []byte {
+	b := ConvertH512ToArray(h512)
+	return b[:]
+}
+
+// ConvertH512ToArray - same as ConvertH512ToBytes, without allocation. For map keys of peers on hot paths
+func ConvertH512ToArray(h512 *types.H512) [64]byte {
 	var b [64]byte
 	binary.BigEndian.PutUint64(b[0:], h512.Hi.Hi.Hi)
 	binary.BigEndian.PutUint64(b[8:], h512.Hi.Hi.Lo)
@@ -87,7 +137,7 @@ func ConvertH512ToBytes(h512 *types.H512) []byte {
 	binary.BigEndian.PutUint64(b[40:], h512.Lo.Hi.Lo)
 	binary.BigEndian.PutUint64(b[48:], h512.Lo.Lo.Hi)
 	binary.BigEndian.PutUint64(b[56:], h512.Lo.Lo.Lo)
-	return b[:]
+	return b
 }
 
 func ConvertBytesToH512(b []byte) *types.H512 {
@@ -17,9 +17,14 @@
 package gointerfaces
 
 import (
+	"context"
 	"fmt"
 
 	"github.com/ledgerwatch/erigon-lib/gointerfaces/types"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/emptypb"
 )
 
 type Version struct {
@@ -44,3 +49,116 @@ func EnsureVersion(local Version, remote *types.VersionReply) bool {
 func (v Version) String() string {
 	return fmt.Sprintf("%d.%d.%d", v.Major, v.Minor, v.Patch)
 }
+
+func (v Version) Less(o Version) bool {
+	if v.Major != o.Major {
+		return v.Major < o.Major
+	}
+	if v.Minor != o.Minor {
+		return v.Minor < o.Minor
+	}
+	return v.Patch < o.Patch
+}
+
+func (v Version) Proto() *types.VersionReply {
+	return &types.VersionReply{Major: v.Major, Minor: v.Minor, Patch: v.Patch}
+}
+
+// Feature - part of service interface, available since minor version
+type Feature struct {
+	Name  string
+	Since Version
+}
+
+// Service - semver of gRPC service interface: major - incompatible changes, minor - new features, patch - fixes
+type Service struct {
+	Name     string
+	Version  Version
+	Features []Feature
+}
+
+// VersionError - client and server interfaces are incompatible
+type VersionError struct {
+	Service        string
+	Client, Server Version
+}
+
+func (e *VersionError) Error() string {
+	return fmt.Sprintf("incompatible remote %s interface versions: client %s, server %s", e.Service, e.Client, e.Server)
+}
+
+// FeatureError - feature is not supported by negotiated version of interface
+type FeatureError struct {
+	Service, Feature string
+	Negotiated       Version
+}
+
+func (e *FeatureError) Error() string {
+	return fmt.Sprintf("%s interface %s doesn't support %s", e.Service, e.Negotiated, e.Feature)
+}
+
+// Negotiated - lower of client and server versions, its features are supported by both sides
+type Negotiated struct {
+	Service        Service
+	Version        Version
+	Client, Server Version
+}
+
+// Negotiate - client and server are compatible if their major versions are equal
+func (s Service) Negotiate(server Version) (Negotiated, error) {
+	if server.Major != s.Version.Major {
+		return Negotiated{}, &VersionError{Service: s.Name, Client: s.Version, Server: server}
+	}
+	n := Negotiated{Service: s, Version: s.Version, Client: s.Version, Server: server}
+	if server.Less(s.Version) {
+		n.Version = server
+	}
+	return n, nil
+}
+
+// VersionFunc - Version method of service client
+type VersionFunc func(ctx context.Context, in *emptypb.Empty, opts ...grpc.CallOption) (*types.VersionReply, error)
+
+// NegotiateWith - asks server for version and negotiates. Server without Version method (codes.Unimplemented)
+// is treated as <major>.0.0 - it has none of features added by minor versions
+func (s Service) NegotiateWith(ctx context.Context, version VersionFunc, opts ...grpc.CallOption) (Negotiated, error) {
+	reply, err := version(ctx, &emptypb.Empty{}, opts...)
+	if status.Code(err) == codes.Unimplemented {
+		return s.Negotiate(Version{Major: s.Version.Major})
+	}
+	if err != nil {
+		return Negotiated{}, fmt.Errorf("getting remote %s version: %w", s.Name, err)
+	}
+	return s.Negotiate(Version{Major: reply.GetMajor(), Minor: reply.GetMinor(), Patch: reply.GetPatch()})
+}
+
+// Supports - feature is known and available in negotiated version
+func (n Negotiated) Supports(feature string) bool {
+	for _, f := range n.Service.Features {
+		if f.Name == feature {
+			return !n.Version.Less(f.Since)
+		}
+	}
+	return false
+}
+
+// Require - returns *FeatureError for first unsupported feature
+func (n Negotiated) Require(features ...string) error {
+	for _, f := range features {
+		if !n.Supports(f) {
+			return &FeatureError{Service: n.Service.Name, Feature: f, Negotiated: n.Version}
+		}
+	}
+	return nil
+}
+
+// Features - names of features supported by both sides
+func (n Negotiated) Features() []string {
+	var res []string
+	for _, f := range n.Service.Features {
+		if !n.Version.Less(f.Since) {
+			res = append(res, f.Name)
+		}
+	}
+	return res
+}
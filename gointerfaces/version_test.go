@@ -0,0 +1,82 @@
+/*
+   Copyright 2021 Erigon contributors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package gointerfaces
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/ledgerwatch/erigon-lib/gointerfaces/types"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/emptypb"
+)
+
+func TestNegotiate(t *testing.T) {
+	require := require.New(t)
+
+	// older server: features of its version only
+	n, err := KVService.Negotiate(Version{3, 3, 5})
+	require.NoError(err)
+	require.Equal(Version{3, 3, 5}, n.Version)
+	require.Equal([]string{KVRange, KVBatchedNext, KVPin}, n.Features())
+	require.True(n.Supports(KVPin))
+	require.False(n.Supports(KVHealth))
+	require.False(n.Supports("unknown"))
+	var featureErr *FeatureError
+	require.True(errors.As(n.Require(KVPin, KVHealth), &featureErr))
+	require.Equal(KVHealth, featureErr.Feature)
+
+	// newer server: features of client
+	n, err = TxPoolService.Negotiate(Version{1, 9, 0})
+	require.NoError(err)
+	require.Equal(TxPoolService.Version, n.Version)
+	require.NoError(n.Require(TxPoolContent, TxPoolEvents, TxPoolPrivate, TxPoolDigest))
+
+	var versionErr *VersionError
+	_, err = KVService.Negotiate(Version{2, 9, 0})
+	require.True(errors.As(err, &versionErr))
+	require.Equal(Version{2, 9, 0}, versionErr.Server)
+	require.Equal("incompatible remote KV interface versions: client 3.7.0, server 2.9.0", err.Error())
+}
+
+func TestNegotiateWith(t *testing.T) {
+	require := require.New(t)
+	ctx := context.Background()
+
+	n, err := DownloaderService.NegotiateWith(ctx, func(context.Context, *emptypb.Empty, ...grpc.CallOption) (*types.VersionReply, error) {
+		return &types.VersionReply{Major: 1, Minor: 2, Patch: 0}, nil
+	})
+	require.NoError(err)
+	require.True(n.Supports(DownloaderProgress))
+
+	// server without Version method
+	n, err = DownloaderService.NegotiateWith(ctx, func(context.Context, *emptypb.Empty, ...grpc.CallOption) (*types.VersionReply, error) {
+		return nil, status.Error(codes.Unimplemented, "unknown method Version")
+	})
+	require.NoError(err)
+	require.Equal(Version{1, 0, 0}, n.Version)
+	require.False(n.Supports(DownloaderProgress))
+
+	_, err = SentryService.NegotiateWith(ctx, func(context.Context, *emptypb.Empty, ...grpc.CallOption) (*types.VersionReply, error) {
+		return nil, status.Error(codes.Unavailable, "connection refused")
+	})
+	require.Equal(codes.Unavailable, status.Code(errors.Unwrap(err)))
+}
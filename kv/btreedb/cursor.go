@@ -0,0 +1,368 @@
+/*
+   Copyright 2021 Erigon contributors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package btreedb
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/google/btree"
+)
+
+// item - key/value pair. In DupSort tables pairs ordered by key and then by value, otherwise only by key.
+type item struct {
+	k, v []byte
+	dup  bool
+}
+
+func (a *item) Less(than btree.Item) bool {
+	b := than.(*item)
+	c := bytes.Compare(a.k, b.k)
+	if c != 0 || !a.dup {
+		return c < 0
+	}
+	return bytes.Compare(a.v, b.v) < 0
+}
+
+func seekGE(t *btree.BTree, pivot *item) (res *item) {
+	t.AscendGreaterOrEqual(pivot, func(i btree.Item) bool {
+		res = i.(*item)
+		return false
+	})
+	return res
+}
+
+func seekGT(t *btree.BTree, pivot *item) (res *item) {
+	t.AscendGreaterOrEqual(pivot, func(i btree.Item) bool {
+		if !pivot.Less(i) {
+			return true
+		}
+		res = i.(*item)
+		return false
+	})
+	return res
+}
+
+func seekLT(t *btree.BTree, pivot *item) (res *item) {
+	t.DescendLessOrEqual(pivot, func(i btree.Item) bool {
+		if !i.(*item).Less(pivot) {
+			return true
+		}
+		res = i.(*item)
+		return false
+	})
+	return res
+}
+
+// nextKey - smallest key which is greater than k
+func nextKey(k []byte) []byte {
+	return append(append(make([]byte, 0, len(k)+1), k...), 0)
+}
+
+type BtreeCursor struct {
+	tx         *BtreeTx
+	bucketName string
+	dupSort    bool
+	cur        *item // nil - cursor not positioned
+	deleted    *item // item removed by DeleteCurrent, cursor already moved to next one - Next must return it
+}
+
+func (c *BtreeCursor) pivot(k, v []byte) *item { return &item{k: k, v: v, dup: c.dupSort} }
+
+func (c *BtreeCursor) table() (*btree.BTree, error) {
+	return c.tx.table(c.bucketName)
+}
+
+func (c *BtreeCursor) set(i *item) ([]byte, []byte, error) {
+	c.deleted = nil
+	c.cur = i
+	if i == nil {
+		return nil, nil, nil
+	}
+	return i.k, i.v, nil
+}
+
+func (c *BtreeCursor) First() ([]byte, []byte, error) {
+	t, err := c.table()
+	if err != nil {
+		return []byte{}, nil, err
+	}
+	i, _ := t.Min().(*item)
+	return c.set(i)
+}
+
+func (c *BtreeCursor) Last() ([]byte, []byte, error) {
+	t, err := c.table()
+	if err != nil {
+		return []byte{}, nil, err
+	}
+	i, _ := t.Max().(*item)
+	return c.set(i)
+}
+
+func (c *BtreeCursor) Seek(seek []byte) ([]byte, []byte, error) {
+	t, err := c.table()
+	if err != nil {
+		return []byte{}, nil, err
+	}
+	return c.set(seekGE(t, c.pivot(seek, nil)))
+}
+
+func (c *BtreeCursor) SeekExact(key []byte) ([]byte, []byte, error) {
+	t, err := c.table()
+	if err != nil {
+		return []byte{}, nil, err
+	}
+	i := seekGE(t, c.pivot(key, nil))
+	if i == nil || !bytes.Equal(i.k, key) {
+		return nil, nil, nil
+	}
+	return c.set(i)
+}
+
+func (c *BtreeCursor) Next() ([]byte, []byte, error) {
+	if c.deleted != nil {
+		return c.set(c.cur)
+	}
+	if c.cur == nil {
+		return c.First()
+	}
+	t, err := c.table()
+	if err != nil {
+		return []byte{}, nil, err
+	}
+	return c.set(seekGT(t, c.cur))
+}
+
+func (c *BtreeCursor) Prev() ([]byte, []byte, error) {
+	if c.cur == nil {
+		return c.Last()
+	}
+	t, err := c.table()
+	if err != nil {
+		return []byte{}, nil, err
+	}
+	return c.set(seekLT(t, c.cur))
+}
+
+func (c *BtreeCursor) Current() ([]byte, []byte, error) {
+	if c.cur == nil {
+		return nil, nil, nil
+	}
+	return c.cur.k, c.cur.v, nil
+}
+
+func (c *BtreeCursor) Count() (uint64, error) {
+	t, err := c.table()
+	if err != nil {
+		return 0, err
+	}
+	return uint64(t.Len()), nil
+}
+
+func (c *BtreeCursor) Close() {
+	c.cur = nil
+}
+
+func (c *BtreeCursor) Put(k, v []byte) error {
+	if len(k) == 0 {
+		return fmt.Errorf("empty keys are not supported. bucket: %s", c.bucketName)
+	}
+	t, err := c.tx.rwTable(c.bucketName)
+	if err != nil {
+		return err
+	}
+	i := c.pivot(copyBytes(k), copyBytes(v))
+	t.ReplaceOrInsert(i)
+	c.set(i)
+	return nil
+}
+
+func (c *BtreeCursor) Append(k []byte, v []byte) error {
+	if len(k) == 0 {
+		return fmt.Errorf("empty keys are not supported. bucket: %s", c.bucketName)
+	}
+	t, err := c.tx.rwTable(c.bucketName)
+	if err != nil {
+		return err
+	}
+	i := c.pivot(copyBytes(k), copyBytes(v))
+	if last, ok := t.Max().(*item); ok && !last.Less(i) {
+		return fmt.Errorf("bucket: %s, append: key/value is not greater than last one", c.bucketName)
+	}
+	t.ReplaceOrInsert(i)
+	c.set(i)
+	return nil
+}
+
+func (c *BtreeCursor) AppendDup(k []byte, v []byte) error {
+	return c.Append(k, v)
+}
+
+func (c *BtreeCursor) Delete(k, v []byte) error {
+	t, err := c.tx.rwTable(c.bucketName)
+	if err != nil {
+		return err
+	}
+	t.Delete(c.pivot(k, v))
+	return nil
+}
+
+// DeleteCurrent This function deletes the key/data pair to which the cursor refers.
+// This does not invalidate the cursor, so operations such as MDB_NEXT
+// can still be used on it.
+// Both MDB_NEXT and MDB_GET_CURRENT will return the same record after
+// this operation.
+func (c *BtreeCursor) DeleteCurrent() error {
+	if c.cur == nil {
+		return fmt.Errorf("bucket: %s, cursor not positioned", c.bucketName)
+	}
+	t, err := c.tx.rwTable(c.bucketName)
+	if err != nil {
+		return err
+	}
+	t.Delete(c.cur)
+	c.deleted = c.cur
+	c.cur = seekGE(t, c.cur)
+	return nil
+}
+
+func (c *BtreeCursor) DeleteCurrentDuplicates() error {
+	if c.cur == nil {
+		return fmt.Errorf("bucket: %s, cursor not positioned", c.bucketName)
+	}
+	t, err := c.tx.rwTable(c.bucketName)
+	if err != nil {
+		return err
+	}
+	k := c.cur.k
+	for i := seekGE(t, c.pivot(k, nil)); i != nil && bytes.Equal(i.k, k); i = seekGE(t, c.pivot(k, nil)) {
+		t.Delete(i)
+	}
+	c.deleted = c.cur
+	c.cur = seekGE(t, c.pivot(nextKey(k), nil))
+	return nil
+}
+
+func (c *BtreeCursor) SeekBothExact(key, value []byte) ([]byte, []byte, error) {
+	t, err := c.table()
+	if err != nil {
+		return []byte{}, nil, err
+	}
+	i, _ := t.Get(c.pivot(key, value)).(*item)
+	if i == nil || !bytes.Equal(i.v, value) {
+		return nil, nil, nil
+	}
+	return c.set(i)
+}
+
+func (c *BtreeCursor) SeekBothRange(key, value []byte) ([]byte, error) {
+	t, err := c.table()
+	if err != nil {
+		return nil, err
+	}
+	i := seekGE(t, c.pivot(key, value))
+	if i == nil || !bytes.Equal(i.k, key) || (!c.dupSort && bytes.Compare(i.v, value) < 0) {
+		return nil, nil
+	}
+	_, v, err := c.set(i)
+	return v, err
+}
+
+func (c *BtreeCursor) FirstDup() ([]byte, error) {
+	if c.cur == nil {
+		return nil, nil
+	}
+	t, err := c.table()
+	if err != nil {
+		return nil, err
+	}
+	_, v, err := c.set(seekGE(t, c.pivot(c.cur.k, nil)))
+	return v, err
+}
+
+func (c *BtreeCursor) NextDup() ([]byte, []byte, error) {
+	if c.cur == nil {
+		return nil, nil, nil
+	}
+	t, err := c.table()
+	if err != nil {
+		return []byte{}, nil, err
+	}
+	i, base := c.cur, c.deleted
+	if base == nil {
+		i, base = seekGT(t, c.cur), c.cur
+	}
+	if i == nil || !bytes.Equal(i.k, base.k) {
+		return nil, nil, nil
+	}
+	return c.set(i)
+}
+
+func (c *BtreeCursor) NextNoDup() ([]byte, []byte, error) {
+	if c.cur == nil && c.deleted == nil {
+		return c.First()
+	}
+	t, err := c.table()
+	if err != nil {
+		return []byte{}, nil, err
+	}
+	base := c.cur
+	if c.deleted != nil {
+		base = c.deleted
+		if c.cur == nil || !bytes.Equal(c.cur.k, base.k) {
+			return c.set(c.cur)
+		}
+	}
+	return c.set(seekGE(t, c.pivot(nextKey(base.k), nil)))
+}
+
+func (c *BtreeCursor) LastDup() ([]byte, error) {
+	if c.cur == nil {
+		return nil, nil
+	}
+	t, err := c.table()
+	if err != nil {
+		return nil, err
+	}
+	_, v, err := c.set(seekLT(t, c.pivot(nextKey(c.cur.k), nil)))
+	return v, err
+}
+
+func (c *BtreeCursor) CountDuplicates() (uint64, error) {
+	if c.cur == nil {
+		return 0, nil
+	}
+	t, err := c.table()
+	if err != nil {
+		return 0, err
+	}
+	var res uint64
+	t.AscendGreaterOrEqual(c.pivot(c.cur.k, nil), func(i btree.Item) bool {
+		if !bytes.Equal(i.(*item).k, c.cur.k) {
+			return false
+		}
+		res++
+		return true
+	})
+	return res, nil
+}
+
+// copyBytes - copy of given slice, because caller can re-use his buffers after Put
+func copyBytes(b []byte) []byte {
+	return append(make([]byte, 0, len(b)), b...)
+}
@@ -0,0 +1,518 @@
+/*
+   Copyright 2021 Erigon contributors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+// Package btreedb - pure-Go (cgo-free) in-memory implementation of kv.RwDB.
+// For tests and small utilities which can't depend on MDBX C toolchain.
+//
+// Every table is copy-on-write B-tree: write transaction clones table on first modification,
+// commit publishes new roots. Read transactions see state of last commit and never block.
+// Only one write transaction at a time.
+//
+// Registered as kv driver "btree", path must be empty.
+//
+// Differences with MDBX:
+//   - no persistence, all data lost on Close
+//   - tables with AutoDupSortKeysConversion stored in logical (not converted) form
+package btreedb
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/google/btree"
+	"github.com/ledgerwatch/erigon-lib/common/errkind"
+	"github.com/ledgerwatch/erigon-lib/common/logging"
+	"github.com/ledgerwatch/erigon-lib/kv"
+	"github.com/ledgerwatch/log/v3"
+)
+
+const degree = 32
+
+type BtreeOpts struct {
+	bucketsCfg func(defaultBuckets kv.TableCfg) kv.TableCfg
+	label      kv.Label
+	log        log.Logger
+}
+
+func NewBtreeDB(log log.Logger) BtreeOpts {
+	return BtreeOpts{
+		bucketsCfg: func(defaultBuckets kv.TableCfg) kv.TableCfg { return defaultBuckets },
+		log:        log,
+	}
+}
+
+func (opts BtreeOpts) Label(label kv.Label) BtreeOpts {
+	opts.label = label
+	return opts
+}
+
+func (opts BtreeOpts) WithTablessCfg(f func(defaultBuckets kv.TableCfg) kv.TableCfg) BtreeOpts {
+	opts.bucketsCfg = f
+	return opts
+}
+
+func (opts BtreeOpts) Open() (kv.RwDB, error) {
+	db := &BtreeKV{
+		opts:    opts,
+		log:     opts.log,
+		buckets: kv.TableCfg{},
+		tables:  map[string]*btree.BTree{},
+	}
+	customBuckets := opts.bucketsCfg(kv.ChaindataTablesCfg)
+	for name, cfg := range customBuckets { // copy map to avoid changing global variable
+		db.buckets[name] = cfg
+	}
+	for name, cfg := range db.buckets {
+		if cfg.IsDeprecated {
+			continue
+		}
+		db.tables[name] = btree.New(degree)
+	}
+	return db, nil
+}
+
+func init() {
+	kv.RegisterDriver("btree", func(cfg kv.DriverCfg) (kv.RwDB, error) {
+		if cfg.Path != "" {
+			return nil, fmt.Errorf("btreedb: in-memory only, but path given: %s", cfg.Path)
+		}
+		return NewBtreeDB(logging.ToLog(cfg.Log)).Label(cfg.Label).
+			WithTablessCfg(func(kv.TableCfg) kv.TableCfg { return cfg.Tables }).Open()
+	})
+}
+
+func (opts BtreeOpts) MustOpen() kv.RwDB {
+	db, err := opts.Open()
+	if err != nil {
+		panic(fmt.Errorf("fail to open btreedb: %w", err))
+	}
+	return db
+}
+
+type BtreeKV struct {
+	opts    BtreeOpts
+	log     log.Logger
+	buckets kv.TableCfg
+
+	lock   sync.RWMutex            // guards tables and closed
+	tables map[string]*btree.BTree // state of last commit. trees are never modified in-place
+	closed bool
+
+	writeLock sync.Mutex // only 1 write transaction at a time
+	wg        sync.WaitGroup
+}
+
+// Close closes db
+// All transactions must be closed before closing the database.
+func (db *BtreeKV) Close() {
+	db.lock.Lock()
+	if db.closed {
+		db.lock.Unlock()
+		return
+	}
+	db.closed = true
+	db.lock.Unlock()
+
+	db.wg.Wait()
+	db.lock.Lock()
+	db.tables = nil
+	db.lock.Unlock()
+}
+
+func (db *BtreeKV) AllBuckets() kv.TableCfg {
+	return db.buckets
+}
+
+func (db *BtreeKV) BeginRo(ctx context.Context) (kv.Tx, error) {
+	select {
+	case <-ctx.Done():
+		return nil, errkind.Wrap(errkind.Canceled, ctx.Err())
+	default:
+	}
+	db.lock.RLock()
+	defer db.lock.RUnlock()
+	if db.closed {
+		return nil, fmt.Errorf("db closed")
+	}
+	db.wg.Add(1)
+	return &BtreeTx{db: db, tables: db.tables, readOnly: true}, nil
+}
+
+func (db *BtreeKV) BeginRw(ctx context.Context) (kv.RwTx, error) {
+	select {
+	case <-ctx.Done():
+		return nil, errkind.Wrap(errkind.Canceled, ctx.Err())
+	default:
+	}
+	db.writeLock.Lock()
+	db.lock.RLock()
+	defer db.lock.RUnlock()
+	if db.closed {
+		db.writeLock.Unlock()
+		return nil, fmt.Errorf("db closed")
+	}
+	db.wg.Add(1)
+	return &BtreeTx{db: db, tables: copyTables(db.tables), cloned: map[string]bool{}}, nil
+}
+
+func (db *BtreeKV) View(ctx context.Context, f func(tx kv.Tx) error) error {
+	tx, err := db.BeginRo(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	return f(tx)
+}
+
+func (db *BtreeKV) Update(ctx context.Context, f func(tx kv.RwTx) error) error {
+	tx, err := db.BeginRw(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if err = f(tx); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func copyTables(tables map[string]*btree.BTree) map[string]*btree.BTree {
+	res := make(map[string]*btree.BTree, len(tables))
+	for name, t := range tables {
+		res[name] = t
+	}
+	return res
+}
+
+type BtreeTx struct {
+	db       *BtreeKV
+	parent   *BtreeTx // not nil for nested transactions
+	tables   map[string]*btree.BTree
+	cloned   map[string]bool // tables already owned by this transaction - can be modified in-place
+	readOnly bool
+	closed   bool
+}
+
+// BeginChild - starts nested write transaction on top of current one.
+func (tx *BtreeTx) BeginChild() (kv.RwTx, error) {
+	if tx.readOnly {
+		return nil, fmt.Errorf("nested transactions are not supported for read-only transactions")
+	}
+	if tx.closed {
+		return nil, fmt.Errorf("parent transaction already closed")
+	}
+	return &BtreeTx{db: tx.db, parent: tx, tables: copyTables(tx.tables), cloned: map[string]bool{}}, nil
+}
+
+func (tx *BtreeTx) Commit() error {
+	if tx.closed {
+		return nil
+	}
+	tx.closed = true
+	if tx.readOnly {
+		tx.db.wg.Done()
+		return nil
+	}
+	if tx.parent != nil {
+		tx.parent.tables = tx.tables
+		for name := range tx.cloned {
+			tx.parent.cloned[name] = true
+		}
+		return nil
+	}
+	tx.db.lock.Lock()
+	tx.db.tables = tx.tables
+	tx.db.lock.Unlock()
+	tx.db.writeLock.Unlock()
+	tx.db.wg.Done()
+	return nil
+}
+
+func (tx *BtreeTx) Rollback() {
+	if tx.closed {
+		return
+	}
+	tx.closed = true
+	if tx.parent != nil {
+		return
+	}
+	if !tx.readOnly {
+		tx.db.writeLock.Unlock()
+	}
+	tx.db.wg.Done()
+}
+
+func (tx *BtreeTx) table(name string) (*btree.BTree, error) {
+	if tx.closed {
+		return nil, fmt.Errorf("transaction closed")
+	}
+	t, ok := tx.tables[name]
+	if !ok {
+		return nil, fmt.Errorf("table: %s, %w", name, kv.ErrUnknownBucket)
+	}
+	return t, nil
+}
+
+// rwTable - returns table which can be modified, clones it on first modification in current transaction
+func (tx *BtreeTx) rwTable(name string) (*btree.BTree, error) {
+	if tx.readOnly {
+		return nil, fmt.Errorf("table: %s, write in read-only transaction", name)
+	}
+	t, err := tx.table(name)
+	if err != nil {
+		return nil, err
+	}
+	if !tx.cloned[name] {
+		t = t.Clone()
+		tx.tables[name] = t
+		tx.cloned[name] = true
+	}
+	return t, nil
+}
+
+func (tx *BtreeTx) isDupSort(name string) bool {
+	cfg := tx.db.buckets[name]
+	return cfg.Flags&kv.DupSort != 0 && !cfg.AutoDupSortKeysConversion
+}
+
+func (tx *BtreeTx) CollectMetrics() {}
+
+func (tx *BtreeTx) GetOne(bucket string, k []byte) ([]byte, error) {
+	c, err := tx.stdCursor(bucket)
+	if err != nil {
+		return nil, err
+	}
+	_, v, err := c.SeekExact(k)
+	return v, err
+}
+
+func (tx *BtreeTx) Has(bucket string, key []byte) (bool, error) {
+	c, err := tx.stdCursor(bucket)
+	if err != nil {
+		return false, err
+	}
+	k, _, err := c.Seek(key)
+	if err != nil {
+		return false, err
+	}
+	return bytes.Equal(key, k), nil
+}
+
+func (tx *BtreeTx) ForEach(bucket string, fromPrefix []byte, walker func(k, v []byte) error) error {
+	c, err := tx.stdCursor(bucket)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+
+	for k, v, err := c.Seek(fromPrefix); k != nil; k, v, err = c.Next() {
+		if err != nil {
+			return err
+		}
+		if err := walker(k, v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (tx *BtreeTx) ForPrefix(bucket string, prefix []byte, walker func(k, v []byte) error) error {
+	c, err := tx.stdCursor(bucket)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+
+	for k, v, err := c.Seek(prefix); k != nil; k, v, err = c.Next() {
+		if err != nil {
+			return err
+		}
+		if !bytes.HasPrefix(k, prefix) {
+			break
+		}
+		if err := walker(k, v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (tx *BtreeTx) ForAmount(bucket string, fromPrefix []byte, amount uint32, walker func(k, v []byte) error) error {
+	c, err := tx.stdCursor(bucket)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+
+	for k, v, err := c.Seek(fromPrefix); k != nil && amount > 0; k, v, err = c.Next() {
+		if err != nil {
+			return err
+		}
+		if err := walker(k, v); err != nil {
+			return err
+		}
+		amount--
+	}
+	return nil
+}
+
+func (tx *BtreeTx) Put(bucket string, k, v []byte) error {
+	c, err := tx.stdCursor(bucket)
+	if err != nil {
+		return err
+	}
+	return c.Put(k, v)
+}
+
+func (tx *BtreeTx) Delete(bucket string, k, v []byte) error {
+	c, err := tx.stdCursor(bucket)
+	if err != nil {
+		return err
+	}
+	return c.Delete(k, v)
+}
+
+func (tx *BtreeTx) Append(bucket string, k, v []byte) error {
+	c, err := tx.stdCursor(bucket)
+	if err != nil {
+		return err
+	}
+	return c.Append(k, v)
+}
+
+func (tx *BtreeTx) AppendDup(bucket string, k, v []byte) error {
+	c, err := tx.stdCursor(bucket)
+	if err != nil {
+		return err
+	}
+	return c.AppendDup(k, v)
+}
+
+func (tx *BtreeTx) IncrementSequence(bucket string, amount uint64) (uint64, error) {
+	currentV, err := tx.ReadSequence(bucket)
+	if err != nil {
+		return 0, err
+	}
+	newVBytes := make([]byte, 8)
+	binary.BigEndian.PutUint64(newVBytes, currentV+amount)
+	if err = tx.Put(kv.Sequence, []byte(bucket), newVBytes); err != nil {
+		return 0, err
+	}
+	return currentV, nil
+}
+
+func (tx *BtreeTx) ReadSequence(bucket string) (uint64, error) {
+	v, err := tx.GetOne(kv.Sequence, []byte(bucket))
+	if err != nil {
+		return 0, err
+	}
+	var currentV uint64 = 0
+	if len(v) > 0 {
+		currentV = binary.BigEndian.Uint64(v)
+	}
+	return currentV, nil
+}
+
+// BucketSize - size of keys and values, without any overhead
+func (tx *BtreeTx) BucketSize(name string) (uint64, error) {
+	t, err := tx.table(name)
+	if err != nil {
+		return 0, err
+	}
+	var size uint64
+	t.Ascend(func(i btree.Item) bool {
+		size += uint64(len(i.(*item).k) + len(i.(*item).v))
+		return true
+	})
+	return size, nil
+}
+
+func (tx *BtreeTx) ListBuckets() ([]string, error) {
+	res := make([]string, 0, len(tx.tables))
+	for name := range tx.tables {
+		res = append(res, name)
+	}
+	sort.Strings(res)
+	return res, nil
+}
+
+func (tx *BtreeTx) CreateBucket(name string) error {
+	if tx.readOnly {
+		return fmt.Errorf("create bucket: %s, read-only transaction", name)
+	}
+	if _, ok := tx.tables[name]; ok {
+		return nil
+	}
+	tx.tables[name] = btree.New(degree)
+	tx.cloned[name] = true
+	return nil
+}
+
+func (tx *BtreeTx) DropBucket(bucket string) error {
+	if cfg, ok := tx.db.buckets[bucket]; !(ok && cfg.IsDeprecated) {
+		return fmt.Errorf("%w, bucket: %s", kv.ErrAttemptToDeleteNonDeprecatedBucket, bucket)
+	}
+	if tx.readOnly {
+		return fmt.Errorf("drop bucket: %s, read-only transaction", bucket)
+	}
+	delete(tx.tables, bucket)
+	delete(tx.cloned, bucket)
+	return nil
+}
+
+func (tx *BtreeTx) ClearBucket(bucket string) error {
+	if tx.readOnly {
+		return fmt.Errorf("clear bucket: %s, read-only transaction", bucket)
+	}
+	if _, ok := tx.tables[bucket]; !ok {
+		return nil
+	}
+	tx.tables[bucket] = btree.New(degree)
+	tx.cloned[bucket] = true
+	return nil
+}
+
+func (tx *BtreeTx) ExistsBucket(bucket string) (bool, error) {
+	_, ok := tx.tables[bucket]
+	return ok, nil
+}
+
+func (tx *BtreeTx) Cursor(bucket string) (kv.Cursor, error) {
+	return tx.stdCursor(bucket)
+}
+
+func (tx *BtreeTx) CursorDupSort(bucket string) (kv.CursorDupSort, error) {
+	return tx.stdCursor(bucket)
+}
+
+func (tx *BtreeTx) RwCursor(bucket string) (kv.RwCursor, error) {
+	return tx.stdCursor(bucket)
+}
+
+func (tx *BtreeTx) RwCursorDupSort(bucket string) (kv.RwCursorDupSort, error) {
+	return tx.stdCursor(bucket)
+}
+
+func (tx *BtreeTx) stdCursor(bucket string) (*BtreeCursor, error) {
+	if _, err := tx.table(bucket); err != nil {
+		return nil, err
+	}
+	return &BtreeCursor{tx: tx, bucketName: bucket, dupSort: tx.isDupSort(bucket)}, nil
+}
@@ -0,0 +1,85 @@
+/*
+   Copyright 2021 Erigon contributors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package kv
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/ledgerwatch/erigon-lib/common/errkind"
+	"github.com/ledgerwatch/erigon-lib/common/logging"
+)
+
+// Driver - opens database of one backend.
+// Backends register themselves in init(), so tool selects backend by blank import of its package
+// and name passed to OpenDriver: cgo-free builds import only cgo-free backends.
+type Driver func(cfg DriverCfg) (RwDB, error)
+
+type DriverCfg struct {
+	Path   string         // empty - in-memory database
+	Label  Label          // marker of db instance, see MdbxOpts.Label
+	Tables TableCfg       // nil - ChaindataTablesCfg
+	Log    logging.Logger // nil - logging.Root()
+}
+
+var ErrUnknownDriver = errkind.New(errkind.NotFound, "unknown kv driver")
+
+var (
+	driversLock sync.RWMutex
+	drivers     = map[string]Driver{}
+)
+
+// RegisterDriver - panics if name is already registered
+func RegisterDriver(name string, d Driver) {
+	driversLock.Lock()
+	defer driversLock.Unlock()
+	if d == nil {
+		panic("kv: RegisterDriver driver is nil")
+	}
+	if _, ok := drivers[name]; ok {
+		panic("kv: RegisterDriver called twice for driver " + name)
+	}
+	drivers[name] = d
+}
+
+// Drivers - sorted names of registered drivers
+func Drivers() []string {
+	driversLock.RLock()
+	defer driversLock.RUnlock()
+	names := make([]string, 0, len(drivers))
+	for name := range drivers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// OpenDriver - opens database by name of registered driver
+func OpenDriver(name string, cfg DriverCfg) (RwDB, error) {
+	driversLock.RLock()
+	d, ok := drivers[name]
+	driversLock.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("%w: %q, registered: %v", ErrUnknownDriver, name, Drivers())
+	}
+	if cfg.Tables == nil {
+		cfg.Tables = ChaindataTablesCfg
+	}
+	cfg.Log = logging.OrRoot(cfg.Log)
+	return d(cfg)
+}
@@ -0,0 +1,278 @@
+/*
+   Copyright 2021 Erigon contributors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+// Package encrypted - kv.RwDB wrapper which encrypts values of chosen tables by AES-GCM before they reach
+// underlying db (MDBX or any other). For sensitive data at rest: private transactions, node keys.
+//
+// Only values are encrypted: keys stay plain, so cursors, prefixes and order of records work as before.
+// Value is bound to its table and key: moved to other place it fails authentication.
+// DupSort tables are not supported - order of encrypted duplicates has no meaning.
+// Tables must be empty or already encrypted when wrapper is enabled: plain values are reported as corrupted.
+//
+// Every value stores id of its key, so keys can be rotated: add new key to KeyProvider - new values use it,
+// old values stay readable; Reencrypt moves old values to current key, after that old key can be removed.
+package encrypted
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/ledgerwatch/erigon-lib/common/errkind"
+	"github.com/ledgerwatch/erigon-lib/kv"
+)
+
+// KeyProvider - source of AES keys (16, 24 or 32 bytes). Id of key must never be reused for other key
+type KeyProvider interface {
+	Current() (id uint32, key []byte, err error) // Current - key for new values
+	Key(id uint32) ([]byte, error)               // Key - key for reading values written by key id
+}
+
+// StaticKeys - KeyProvider over fixed set of keys, key with biggest id is current
+type StaticKeys map[uint32][]byte
+
+func (s StaticKeys) Current() (uint32, []byte, error) {
+	var id uint32
+	var key []byte
+	for i, k := range s {
+		if key == nil || i > id {
+			id, key = i, k
+		}
+	}
+	if key == nil {
+		return 0, nil, ErrNoKey
+	}
+	return id, key, nil
+}
+
+func (s StaticKeys) Key(id uint32) ([]byte, error) {
+	key, ok := s[id]
+	if !ok {
+		return nil, fmt.Errorf("key %d: %w", id, ErrNoKey)
+	}
+	return key, nil
+}
+
+var ErrNoKey = errors.New("encryption key not found")
+
+// value layout: version(1) + key id(4) + nonce + sealed value
+const (
+	formatVersion = 1
+	headerLen     = 1 + 4
+)
+
+type DB struct {
+	kv.RwDB
+	keys   KeyProvider
+	tables map[string]struct{}
+
+	lock  sync.RWMutex
+	aeads map[uint32]cipher.AEAD
+}
+
+// New - db with encrypted values of tables. Tables must be known to db and must not be DupSort
+func New(db kv.RwDB, keys KeyProvider, tables ...string) (*DB, error) {
+	cfg := db.AllBuckets()
+	res := &DB{RwDB: db, keys: keys, tables: map[string]struct{}{}, aeads: map[uint32]cipher.AEAD{}}
+	for _, name := range tables {
+		item, ok := cfg[name]
+		if !ok {
+			return nil, fmt.Errorf("encrypted table %s: %w", name, kv.ErrUnknownBucket)
+		}
+		if item.Flags&kv.DupSort != 0 {
+			return nil, fmt.Errorf("encrypted table %s: DupSort tables are %w", name, kv.ErrNotSupported)
+		}
+		res.tables[name] = struct{}{}
+	}
+	if _, _, err := keys.Current(); err != nil {
+		return nil, fmt.Errorf("encrypted db: %w", err)
+	}
+	return res, nil
+}
+
+func (db *DB) Encrypted(table string) bool {
+	_, ok := db.tables[table]
+	return ok
+}
+
+func (db *DB) aead(id uint32, key []byte) (cipher.AEAD, error) {
+	db.lock.RLock()
+	aead, ok := db.aeads[id]
+	db.lock.RUnlock()
+	if ok {
+		return aead, nil
+	}
+	if key == nil {
+		var err error
+		if key, err = db.keys.Key(id); err != nil {
+			return nil, err
+		}
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("key %d: %w", id, err)
+	}
+	if aead, err = cipher.NewGCM(block); err != nil {
+		return nil, fmt.Errorf("key %d: %w", id, err)
+	}
+	db.lock.Lock()
+	db.aeads[id] = aead
+	db.lock.Unlock()
+	return aead, nil
+}
+
+// additionalData - binds value to its place
+func additionalData(table string, k []byte) []byte {
+	ad := make([]byte, 0, len(table)+1+len(k))
+	ad = append(ad, table...)
+	ad = append(ad, 0)
+	return append(ad, k...)
+}
+
+func (db *DB) seal(table string, k, v []byte) ([]byte, error) {
+	id, key, err := db.keys.Current()
+	if err != nil {
+		return nil, err
+	}
+	aead, err := db.aead(id, key)
+	if err != nil {
+		return nil, err
+	}
+	res := make([]byte, headerLen+aead.NonceSize(), headerLen+aead.NonceSize()+len(v)+aead.Overhead())
+	res[0] = formatVersion
+	binary.BigEndian.PutUint32(res[1:], id)
+	if _, err := rand.Read(res[headerLen:]); err != nil {
+		return nil, err
+	}
+	return aead.Seal(res, res[headerLen:], v, additionalData(table, k)), nil
+}
+
+// keyID - id of key which encrypted value
+func keyID(table string, v []byte) (uint32, error) {
+	if len(v) < headerLen || v[0] != formatVersion {
+		return 0, errkind.Errorf(errkind.Corrupted, "encrypted table %s: unknown value format", table)
+	}
+	return binary.BigEndian.Uint32(v[1:]), nil
+}
+
+func (db *DB) open(table string, k, v []byte) ([]byte, error) {
+	id, err := keyID(table, v)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := db.aead(id, nil)
+	if err != nil {
+		return nil, fmt.Errorf("encrypted table %s: %w", table, err)
+	}
+	if len(v) < headerLen+aead.NonceSize() {
+		return nil, errkind.Errorf(errkind.Corrupted, "encrypted table %s: value too short", table)
+	}
+	res, err := aead.Open(nil, v[headerLen:headerLen+aead.NonceSize()], v[headerLen+aead.NonceSize():], additionalData(table, k))
+	if err != nil {
+		return nil, errkind.Errorf(errkind.Corrupted, "encrypted table %s: %w", table, err)
+	}
+	return res, nil
+}
+
+func (db *DB) BeginRo(ctx context.Context) (kv.Tx, error) {
+	tx, err := db.RwDB.BeginRo(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &roTx{Tx: tx, db: db}, nil
+}
+
+func (db *DB) BeginRw(ctx context.Context) (kv.RwTx, error) {
+	tx, err := db.RwDB.BeginRw(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &rwTx{RwTx: tx, ro: roTx{Tx: tx, db: db}}, nil
+}
+
+func (db *DB) View(ctx context.Context, f func(tx kv.Tx) error) error {
+	return db.RwDB.View(ctx, func(tx kv.Tx) error { return f(&roTx{Tx: tx, db: db}) })
+}
+
+func (db *DB) Update(ctx context.Context, f func(tx kv.RwTx) error) error {
+	return db.RwDB.Update(ctx, func(tx kv.RwTx) error { return f(&rwTx{RwTx: tx, ro: roTx{Tx: tx, db: db}}) })
+}
+
+// Reencrypt - rewrites values which are not encrypted by current key, in batches of one write transaction each.
+// After it keys other than current can be removed from KeyProvider
+func (db *DB) Reencrypt(ctx context.Context) (rewritten int, err error) {
+	const batchSize = 10_000
+	id, _, err := db.keys.Current()
+	if err != nil {
+		return 0, err
+	}
+	for table := range db.tables {
+		var from []byte
+		for done := false; !done; {
+			if err := db.RwDB.Update(ctx, func(tx kv.RwTx) error {
+				var batch []kv.KV
+				c, err := tx.Cursor(table)
+				if err != nil {
+					return err
+				}
+				defer c.Close()
+				k, v, err := c.Seek(from)
+				for ; k != nil && len(batch) < batchSize; k, v, err = c.Next() {
+					if err != nil {
+						return err
+					}
+					vID, err := keyID(table, v)
+					if err != nil {
+						return err
+					}
+					if vID == id {
+						continue
+					}
+					plain, err := db.open(table, k, v)
+					if err != nil {
+						return err
+					}
+					batch = append(batch, kv.KV{K: append([]byte{}, k...), V: plain})
+				}
+				if err != nil {
+					return err
+				}
+				if done = k == nil; !done {
+					from = append(from[:0], k...)
+				}
+				for _, pair := range batch {
+					sealed, err := db.seal(table, pair.K, pair.V)
+					if err != nil {
+						return err
+					}
+					if err := tx.Put(table, pair.K, sealed); err != nil {
+						return err
+					}
+				}
+				rewritten += len(batch)
+				return nil
+			}); err != nil {
+				return rewritten, fmt.Errorf("reencrypt %s: %w", table, err)
+			}
+		}
+	}
+	return rewritten, nil
+}
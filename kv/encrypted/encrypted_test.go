@@ -0,0 +1,157 @@
+/*
+   Copyright 2021 Erigon contributors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package encrypted
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/ledgerwatch/erigon-lib/common/errkind"
+	"github.com/ledgerwatch/erigon-lib/kv"
+	"github.com/ledgerwatch/erigon-lib/kv/memdb"
+	"github.com/stretchr/testify/require"
+)
+
+var _ kv.RwDB = &DB{}
+
+func testDB(t *testing.T, keys KeyProvider) (kv.RwDB, *DB) {
+	raw := memdb.NewWithCfg(kv.TableCfg{"Secret": {}, "Plain": {}, "Dupped": {Flags: kv.DupSort}})
+	t.Cleanup(raw.Close)
+	db, err := New(raw, keys, "Secret")
+	require.NoError(t, err)
+	return raw, db
+}
+
+func TestEncrypted(t *testing.T) {
+	require, ctx := require.New(t), context.Background()
+	raw, db := testDB(t, StaticKeys{1: bytes.Repeat([]byte{1}, 32)})
+
+	require.NoError(db.Update(ctx, func(tx kv.RwTx) error {
+		require.NoError(tx.Put("Secret", []byte("a"), []byte("value a")))
+		require.NoError(tx.Put("Plain", []byte("a"), []byte("value a")))
+		c, err := tx.RwCursor("Secret")
+		require.NoError(err)
+		defer c.Close()
+		require.NoError(c.Append([]byte("b"), []byte("value b")))
+		return nil
+	}))
+
+	require.NoError(raw.View(ctx, func(tx kv.Tx) error {
+		v, err := tx.GetOne("Secret", []byte("a"))
+		require.NoError(err)
+		require.False(bytes.Contains(v, []byte("value a")))
+		v, err = tx.GetOne("Plain", []byte("a"))
+		require.NoError(err)
+		require.Equal([]byte("value a"), v)
+		return nil
+	}))
+
+	require.NoError(db.View(ctx, func(tx kv.Tx) error {
+		v, err := tx.GetOne("Secret", []byte("a"))
+		require.NoError(err)
+		require.Equal([]byte("value a"), v)
+		var got []kv.KV
+		require.NoError(tx.ForEach("Secret", nil, func(k, v []byte) error {
+			got = append(got, kv.KV{K: k, V: v})
+			return nil
+		}))
+		require.Equal([]kv.KV{{K: []byte("a"), V: []byte("value a")}, {K: []byte("b"), V: []byte("value b")}}, got)
+		c, err := tx.Cursor("Secret")
+		require.NoError(err)
+		defer c.Close()
+		k, v, err := c.Last()
+		require.NoError(err)
+		require.Equal("b", string(k))
+		require.Equal("value b", string(v))
+		_, err = tx.CursorDupSort("Secret")
+		require.ErrorIs(err, kv.ErrNotSupported)
+		return nil
+	}))
+
+	require.NoError(db.Update(ctx, func(tx kv.RwTx) error {
+		require.NoError(tx.Delete("Secret", []byte("a"), []byte("value a")))
+		v, err := tx.GetOne("Secret", []byte("a"))
+		require.NoError(err)
+		require.Nil(v)
+		return nil
+	}))
+}
+
+func TestEncryptedTampering(t *testing.T) {
+	require, ctx := require.New(t), context.Background()
+	raw, db := testDB(t, StaticKeys{1: bytes.Repeat([]byte{1}, 16)})
+	require.NoError(db.Update(ctx, func(tx kv.RwTx) error {
+		return tx.Put("Secret", []byte("a"), []byte("value a"))
+	}))
+	require.NoError(raw.Update(ctx, func(tx kv.RwTx) error {
+		v, err := tx.GetOne("Secret", []byte("a"))
+		require.NoError(err)
+		require.NoError(tx.Put("Secret", []byte("b"), v))
+		return tx.Put("Secret", []byte("c"), []byte("plain"))
+	}))
+	require.NoError(db.View(ctx, func(tx kv.Tx) error {
+		for _, k := range []string{"b", "c"} {
+			_, err := tx.GetOne("Secret", []byte(k))
+			require.True(errors.Is(err, errkind.Corrupted), k)
+		}
+		return nil
+	}))
+}
+
+func TestEncryptedRotation(t *testing.T) {
+	require, ctx := require.New(t), context.Background()
+	keys := StaticKeys{1: bytes.Repeat([]byte{1}, 32)}
+	raw, db := testDB(t, keys)
+	require.NoError(db.Update(ctx, func(tx kv.RwTx) error {
+		require.NoError(tx.Put("Secret", []byte("a"), []byte("value a")))
+		return tx.Put("Secret", []byte("b"), []byte("value b"))
+	}))
+
+	keys[2] = bytes.Repeat([]byte{2}, 32)
+	require.NoError(db.Update(ctx, func(tx kv.RwTx) error {
+		return tx.Put("Secret", []byte("c"), []byte("value c"))
+	}))
+	n, err := db.Reencrypt(ctx)
+	require.NoError(err)
+	require.Equal(2, n)
+	n, err = db.Reencrypt(ctx)
+	require.NoError(err)
+	require.Equal(0, n)
+
+	delete(keys, 1)
+	db, err = New(raw, keys, "Secret")
+	require.NoError(err)
+	require.NoError(db.View(ctx, func(tx kv.Tx) error {
+		return tx.ForEach("Secret", nil, func(k, v []byte) error {
+			require.Equal("value "+string(k), string(v))
+			return nil
+		})
+	}))
+}
+
+func TestEncryptedNew(t *testing.T) {
+	require := require.New(t)
+	raw, _ := testDB(t, StaticKeys{1: bytes.Repeat([]byte{1}, 32)})
+	_, err := New(raw, StaticKeys{1: bytes.Repeat([]byte{1}, 32)}, "Dupped")
+	require.ErrorIs(err, kv.ErrNotSupported)
+	_, err = New(raw, StaticKeys{1: bytes.Repeat([]byte{1}, 32)}, "Unknown")
+	require.ErrorIs(err, kv.ErrUnknownBucket)
+	_, err = New(raw, StaticKeys{}, "Secret")
+	require.ErrorIs(err, ErrNoKey)
+}
@@ -0,0 +1,216 @@
+/*
+   Copyright 2021 Erigon contributors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package encrypted
+
+import (
+	"fmt"
+
+	"github.com/ledgerwatch/erigon-lib/kv"
+)
+
+type roTx struct {
+	kv.Tx
+	db *DB
+}
+
+func (tx *roTx) GetOne(table string, k []byte) ([]byte, error) {
+	v, err := tx.Tx.GetOne(table, k)
+	if err != nil || v == nil || !tx.db.Encrypted(table) {
+		return v, err
+	}
+	return tx.db.open(table, k, v)
+}
+
+func (tx *roTx) walker(table string, walker func(k, v []byte) error) func(k, v []byte) error {
+	if !tx.db.Encrypted(table) {
+		return walker
+	}
+	return func(k, v []byte) error {
+		plain, err := tx.db.open(table, k, v)
+		if err != nil {
+			return err
+		}
+		return walker(k, plain)
+	}
+}
+
+func (tx *roTx) ForEach(table string, fromPrefix []byte, walker func(k, v []byte) error) error {
+	return tx.Tx.ForEach(table, fromPrefix, tx.walker(table, walker))
+}
+
+func (tx *roTx) ForPrefix(table string, prefix []byte, walker func(k, v []byte) error) error {
+	return tx.Tx.ForPrefix(table, prefix, tx.walker(table, walker))
+}
+
+func (tx *roTx) ForAmount(table string, prefix []byte, amount uint32, walker func(k, v []byte) error) error {
+	return tx.Tx.ForAmount(table, prefix, amount, tx.walker(table, walker))
+}
+
+func (tx *roTx) Cursor(table string) (kv.Cursor, error) {
+	c, err := tx.Tx.Cursor(table)
+	if err != nil || !tx.db.Encrypted(table) {
+		return c, err
+	}
+	return &cursor{Cursor: c, db: tx.db, table: table}, nil
+}
+
+func (tx *roTx) CursorDupSort(table string) (kv.CursorDupSort, error) {
+	if tx.db.Encrypted(table) {
+		return nil, fmt.Errorf("encrypted table %s: DupSort cursor %w", table, kv.ErrNotSupported)
+	}
+	return tx.Tx.CursorDupSort(table)
+}
+
+type rwTx struct {
+	kv.RwTx
+	ro roTx
+}
+
+func (tx *rwTx) GetOne(table string, k []byte) ([]byte, error) { return tx.ro.GetOne(table, k) }
+func (tx *rwTx) ForEach(table string, fromPrefix []byte, walker func(k, v []byte) error) error {
+	return tx.ro.ForEach(table, fromPrefix, walker)
+}
+func (tx *rwTx) ForPrefix(table string, prefix []byte, walker func(k, v []byte) error) error {
+	return tx.ro.ForPrefix(table, prefix, walker)
+}
+func (tx *rwTx) ForAmount(table string, prefix []byte, amount uint32, walker func(k, v []byte) error) error {
+	return tx.ro.ForAmount(table, prefix, amount, walker)
+}
+func (tx *rwTx) Cursor(table string) (kv.Cursor, error) { return tx.ro.Cursor(table) }
+func (tx *rwTx) CursorDupSort(table string) (kv.CursorDupSort, error) {
+	return tx.ro.CursorDupSort(table)
+}
+
+func (tx *rwTx) Put(table string, k, v []byte) error {
+	if !tx.ro.db.Encrypted(table) {
+		return tx.RwTx.Put(table, k, v)
+	}
+	sealed, err := tx.ro.db.seal(table, k, v)
+	if err != nil {
+		return err
+	}
+	return tx.RwTx.Put(table, k, sealed)
+}
+
+func (tx *rwTx) Append(table string, k, v []byte) error {
+	if !tx.ro.db.Encrypted(table) {
+		return tx.RwTx.Append(table, k, v)
+	}
+	sealed, err := tx.ro.db.seal(table, k, v)
+	if err != nil {
+		return err
+	}
+	return tx.RwTx.Append(table, k, sealed)
+}
+
+func (tx *rwTx) AppendDup(table string, k, v []byte) error {
+	if tx.ro.db.Encrypted(table) {
+		return fmt.Errorf("encrypted table %s: AppendDup %w", table, kv.ErrNotSupported)
+	}
+	return tx.RwTx.AppendDup(table, k, v)
+}
+
+// Delete - value of encrypted table can't be matched, key is enough: tables are not DupSort
+func (tx *rwTx) Delete(table string, k, v []byte) error {
+	if tx.ro.db.Encrypted(table) {
+		v = nil
+	}
+	return tx.RwTx.Delete(table, k, v)
+}
+
+func (tx *rwTx) RwCursor(table string) (kv.RwCursor, error) {
+	c, err := tx.RwTx.RwCursor(table)
+	if err != nil || !tx.ro.db.Encrypted(table) {
+		return c, err
+	}
+	return &rwCursor{RwCursor: c, cursor: cursor{Cursor: c, db: tx.ro.db, table: table}}, nil
+}
+
+func (tx *rwTx) RwCursorDupSort(table string) (kv.RwCursorDupSort, error) {
+	if tx.ro.db.Encrypted(table) {
+		return nil, fmt.Errorf("encrypted table %s: DupSort cursor %w", table, kv.ErrNotSupported)
+	}
+	return tx.RwTx.RwCursorDupSort(table)
+}
+
+func (tx *rwTx) BeginChild() (kv.RwTx, error) {
+	child, err := tx.RwTx.BeginChild()
+	if err != nil {
+		return nil, err
+	}
+	return &rwTx{RwTx: child, ro: roTx{Tx: child, db: tx.ro.db}}, nil
+}
+
+type cursor struct {
+	kv.Cursor
+	db    *DB
+	table string
+}
+
+func (c *cursor) open(k, v []byte, err error) ([]byte, []byte, error) {
+	if err != nil || k == nil {
+		return k, v, err
+	}
+	plain, err := c.db.open(c.table, k, v)
+	if err != nil {
+		return []byte{}, nil, err
+	}
+	return k, plain, nil
+}
+
+func (c *cursor) First() ([]byte, []byte, error)           { return c.open(c.Cursor.First()) }
+func (c *cursor) Seek(seek []byte) ([]byte, []byte, error) { return c.open(c.Cursor.Seek(seek)) }
+func (c *cursor) SeekExact(key []byte) ([]byte, []byte, error) {
+	return c.open(c.Cursor.SeekExact(key))
+}
+func (c *cursor) Next() ([]byte, []byte, error)    { return c.open(c.Cursor.Next()) }
+func (c *cursor) Prev() ([]byte, []byte, error)    { return c.open(c.Cursor.Prev()) }
+func (c *cursor) Last() ([]byte, []byte, error)    { return c.open(c.Cursor.Last()) }
+func (c *cursor) Current() ([]byte, []byte, error) { return c.open(c.Cursor.Current()) }
+
+type rwCursor struct {
+	kv.RwCursor
+	cursor
+}
+
+func (c *rwCursor) First() ([]byte, []byte, error)               { return c.cursor.First() }
+func (c *rwCursor) Seek(seek []byte) ([]byte, []byte, error)     { return c.cursor.Seek(seek) }
+func (c *rwCursor) SeekExact(key []byte) ([]byte, []byte, error) { return c.cursor.SeekExact(key) }
+func (c *rwCursor) Next() ([]byte, []byte, error)                { return c.cursor.Next() }
+func (c *rwCursor) Prev() ([]byte, []byte, error)                { return c.cursor.Prev() }
+func (c *rwCursor) Last() ([]byte, []byte, error)                { return c.cursor.Last() }
+func (c *rwCursor) Current() ([]byte, []byte, error)             { return c.cursor.Current() }
+func (c *rwCursor) Count() (uint64, error)                       { return c.RwCursor.Count() }
+func (c *rwCursor) Close()                                       { c.RwCursor.Close() }
+
+func (c *rwCursor) Put(k, v []byte) error {
+	sealed, err := c.db.seal(c.table, k, v)
+	if err != nil {
+		return err
+	}
+	return c.RwCursor.Put(k, sealed)
+}
+
+func (c *rwCursor) Append(k, v []byte) error {
+	sealed, err := c.db.seal(c.table, k, v)
+	if err != nil {
+		return err
+	}
+	return c.RwCursor.Append(k, sealed)
+}
+
+func (c *rwCursor) Delete(k, _ []byte) error { return c.RwCursor.Delete(k, nil) }
@@ -21,13 +21,15 @@ import (
 	"errors"
 
 	"github.com/VictoriaMetrics/metrics"
+	"github.com/ledgerwatch/erigon-lib/common/errkind"
 )
 
 const ReadersLimit = 32000 // MDBX_READERS_LIMIT=32767
 
 var (
 	ErrAttemptToDeleteNonDeprecatedBucket = errors.New("only buckets from dbutils.ChaindataDeprecatedTables can be deleted")
-	ErrUnknownBucket                      = errors.New("unknown bucket. add it to dbutils.ChaindataTables")
+	ErrUnknownBucket                      = errkind.New(errkind.NotFound, "unknown bucket. add it to dbutils.ChaindataTables")
+	ErrMapFull                            = errkind.New(errkind.TooBig, "database map is full, increase map size")
 
 	DbSize    = metrics.NewCounter(`db_size`)    //nolint
 	TxLimit   = metrics.NewCounter(`tx_limit`)   //nolint
@@ -250,6 +252,12 @@ type RwTx interface {
 	// CollectMetrics - does collect all DB-related and Tx-related metrics
 	// this method exists only in RwTx to avoid concurrency
 	CollectMetrics()
+
+	// BeginChild - creates nested transaction. Commit of child makes its changes visible in parent,
+	// Rollback of child discards only changes made by child - parent stays untouched and usable.
+	// A parent transaction and its cursors may not issue any other operations than
+	// Commit and Rollback while it has active child transactions.
+	BeginChild() (RwTx, error)
 }
 
 // BucketMigrator used for buckets migration, don't use it in usual app code
@@ -326,3 +334,8 @@ type RwCursorDupSort interface {
 }
 
 var ErrNotSupported = errors.New("not supported")
+
+// KV - key/value pair, used to describe table content as data (fixtures, dumps, diffs)
+type KV struct {
+	K, V []byte
+}
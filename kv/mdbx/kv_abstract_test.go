@@ -18,11 +18,14 @@ package mdbx_test
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"net"
 	"runtime"
 	"testing"
 
+	"github.com/ledgerwatch/erigon-lib/common/errkind"
+	"github.com/ledgerwatch/erigon-lib/direct"
 	"github.com/ledgerwatch/erigon-lib/gointerfaces"
 	"github.com/ledgerwatch/erigon-lib/gointerfaces/remote"
 	"github.com/ledgerwatch/erigon-lib/kv"
@@ -33,7 +36,10 @@ import (
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/types/known/emptypb"
 )
 
 func TestSequence(t *testing.T) {
@@ -157,6 +163,109 @@ func TestManagedTx(t *testing.T) {
 	}
 }
 
+func TestRemoteRange(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("fix me on win please")
+	}
+
+	writeDBs, readDBs := setupDatabases(t, log.New(), func(defaultBuckets kv.TableCfg) kv.TableCfg {
+		return defaultBuckets
+	})
+	ctx := context.Background()
+	table := kv.HeaderNumber
+	for _, db := range writeDBs {
+		require.NoError(t, db.Update(ctx, func(tx kv.RwTx) error {
+			for i := 0; i < 3_000; i++ { // few batches
+				if err := tx.Put(table, []byte{byte(i >> 8), byte(i)}, make([]byte, i%300)); err != nil {
+					return err
+				}
+			}
+			return tx.Put(table, []byte{0xFF, 0xFF, 1}, []byte{1})
+		}))
+	}
+
+	type result struct{ forEach, forPrefix, forPrefixFF, forAmount int }
+	var results []result
+	for _, db := range readDBs {
+		var res result
+		require.NoError(t, db.View(ctx, func(tx kv.Tx) error {
+			require.NoError(t, tx.ForEach(table, []byte{1}, func(k, v []byte) error {
+				res.forEach += 1 + len(v)
+				return nil
+			}))
+			require.NoError(t, tx.ForPrefix(table, []byte{2}, func(k, v []byte) error {
+				require.Equal(t, byte(2), k[0])
+				res.forPrefix += 1 + len(v)
+				return nil
+			}))
+			require.NoError(t, tx.ForPrefix(table, []byte{0xFF, 0xFF}, func(k, v []byte) error {
+				res.forPrefixFF++
+				return nil
+			}))
+			require.NoError(t, tx.ForAmount(table, []byte{3}, 1_500, func(k, v []byte) error {
+				res.forAmount++
+				return nil
+			}))
+
+			// walker error stops iteration, but tx is still usable
+			stop := fmt.Errorf("stop")
+			cnt := 0
+			require.Equal(t, stop, tx.ForEach(table, nil, func(k, v []byte) error {
+				cnt++
+				if cnt == 2_000 {
+					return stop
+				}
+				return nil
+			}))
+			require.Equal(t, 2_000, cnt)
+			v, err := tx.GetOne(table, []byte{0xFF, 0xFF, 1})
+			require.NoError(t, err)
+			require.Equal(t, []byte{1}, v)
+			return nil
+		}))
+		results = append(results, res)
+	}
+	require.Equal(t, 1_500, results[0].forAmount)
+	require.Equal(t, 1, results[0].forPrefixFF)
+	for i := range results {
+		require.Equal(t, results[0], results[i], "%T", readDBs[i])
+	}
+}
+
+func TestErrorKinds(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("fix me on win please")
+	}
+
+	writeDBs, readDBs := setupDatabases(t, log.New(), func(defaultBuckets kv.TableCfg) kv.TableCfg {
+		return defaultBuckets
+	})
+	for _, db := range writeDBs {
+		require.NoError(t, db.Update(context.Background(), func(tx kv.RwTx) error {
+			return tx.Put(kv.HeaderNumber, []byte{1}, []byte{1})
+		}))
+	}
+	for _, db := range readDBs {
+		canceled, cancel := context.WithCancel(context.Background())
+		cancel()
+		_, err := db.BeginRo(canceled)
+		require.True(t, errors.Is(err, errkind.Canceled), "%T: %v", db, err)
+		require.True(t, errors.Is(err, context.Canceled), "%T: %v", db, err)
+	}
+
+	// remote (grpc and direct client): tx canceled after begin
+	for _, db := range []kv.RwDB{readDBs[2], readDBs[4]} {
+		ctx, cancel := context.WithCancel(context.Background())
+		tx, err := db.BeginRo(ctx)
+		require.NoError(t, err)
+		cancel()
+		_, err = tx.GetOne(kv.HeaderNumber, []byte{1})
+		tx.Rollback()
+		require.True(t, errors.Is(err, errkind.Canceled), "%v", err)
+		require.Equal(t, codes.Canceled, status.Code(err), "%v", err)
+	}
+}
+
 func TestRemoteKvVersion(t *testing.T) {
 	if runtime.GOOS == "windows" {
 		t.Skip("fix me on win please")
@@ -188,6 +297,11 @@ func TestRemoteKvVersion(t *testing.T) {
 		t.Fatalf("%v", err)
 	}
 	require.False(t, a.EnsureVersionCompatibility())
+	_, err = a.BeginRo(context.Background())
+	var versionErr *remotedb.VersionError
+	require.True(t, errors.As(err, &versionErr), "%v", err)
+	require.Equal(t, v1, versionErr.Client)
+	require.Equal(t, v, versionErr.Server)
 	// Different Minor versions
 	v2 := v
 	v2.Minor++
@@ -204,12 +318,27 @@ func TestRemoteKvVersion(t *testing.T) {
 		t.Fatalf("%v", err)
 	}
 	require.True(t, a.EnsureVersionCompatibility())
+	tx, err := a.BeginRo(context.Background())
+	require.NoError(t, err)
+	tx.Rollback()
+
+	health, err := remote.NewKVClient(cc).Health(context.Background(), &emptypb.Empty{})
+	require.NoError(t, err)
+	require.True(t, health.DbOpen)
+	require.Equal(t, kv.DBSchemaVersion.String(), health.DbSchemaVersion.String())
+	require.Equal(t, v, gointerfaces.VersionFromProto(health.KvApiVersion))
+	writeDb.Close()
+	health, err = remote.NewKVClient(cc).Health(context.Background(), &emptypb.Empty{})
+	require.NoError(t, err)
+	require.False(t, health.DbOpen)
+	require.NotEmpty(t, health.Error)
 }
 
 func setupDatabases(t *testing.T, logger log.Logger, f mdbx.TableCfgFunc) (writeDBs []kv.RwDB, readDBs []kv.RwDB) {
 	writeDBs = []kv.RwDB{
 		mdbx.NewMDBX(logger).InMem().WithTablessCfg(f).MustOpen(),
 		mdbx.NewMDBX(logger).InMem().WithTablessCfg(f).MustOpen(), // for remote db
+		mdbx.NewMDBX(logger).InMem().WithTablessCfg(f).MustOpen(), // for remote db over direct client
 	}
 
 	conn := bufconn.Listen(1024 * 1024)
@@ -227,10 +356,14 @@ func setupDatabases(t *testing.T, logger log.Logger, f mdbx.TableCfgFunc) (write
 	assert.NoError(t, err)
 	rdb, err := remotedb.NewRemote(v, logger, remote.NewKVClient(cc)).Open()
 	assert.NoError(t, err)
+	directRdb, err := remotedb.NewRemote(v, logger, direct.NewKVClient(writeDBs[2])).Open()
+	assert.NoError(t, err)
 	readDBs = []kv.RwDB{
 		writeDBs[0],
 		writeDBs[1],
 		rdb,
+		writeDBs[2],
+		directRdb,
 	}
 
 	t.Cleanup(func() {
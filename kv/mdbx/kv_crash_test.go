@@ -0,0 +1,336 @@
+/*
+   Copyright 2021 Erigon contributors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package mdbx_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ledgerwatch/erigon-lib/kv"
+	"github.com/ledgerwatch/erigon-lib/kv/mdbx"
+	"github.com/ledgerwatch/log/v3"
+	"github.com/stretchr/testify/require"
+	mdbx2 "github.com/torquem-ch/mdbx-go/mdbx"
+)
+
+// Crash-safety harness:
+//  - crashDB wraps kv.RwDB and calls hook before, during and after every commit
+//  - hook can abort commit (commit returns error, changes discarded) or kill the process
+//  - kill during commit is sent by other goroutine while mdbx writes pages: it lands inside of commit
+//  - process kill is real: workload runs in child process (this test binary re-executed), parent waits for its death
+//  - verifier re-opens environment in parent process and checks invariants of workload
+
+type crashPoint uint8
+
+const (
+	beforeCommit crashPoint = iota
+	afterCommit
+	duringCommit
+)
+
+type crashAction uint8
+
+const (
+	noCrash crashAction = iota
+	abortCommit
+	killProcess
+)
+
+var errInjectedAbort = errors.New("injected commit failure")
+
+// markers written by child process to stdout - parent knows if kill landed inside of commit
+const (
+	commitStartedMarker  = "crash: commit started\n"
+	commitFinishedMarker = "crash: commit finished\n"
+)
+
+type crashHook func(commitNum int, point crashPoint) crashAction
+
+type crashDB struct {
+	kv.RwDB
+	hook      crashHook
+	commits   int           // amount of commit attempts
+	killDelay time.Duration // of kill during commit
+}
+
+type crashTx struct {
+	kv.RwTx
+	db *crashDB
+}
+
+func (db *crashDB) BeginRw(ctx context.Context) (kv.RwTx, error) {
+	tx, err := db.RwDB.BeginRw(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &crashTx{RwTx: tx, db: db}, nil
+}
+
+func (db *crashDB) Update(ctx context.Context, f func(tx kv.RwTx) error) error {
+	tx, err := db.BeginRw(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if err = f(tx); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (tx *crashTx) Commit() error {
+	tx.db.commits++
+	n := tx.db.commits
+	if err := tx.crash(n, beforeCommit); err != nil {
+		return err
+	}
+	if tx.db.hook(n, duringCommit) == killProcess {
+		_, _ = os.Stdout.WriteString(commitStartedMarker)
+		go func() {
+			time.Sleep(tx.db.killDelay)
+			kill()
+		}()
+		if err := tx.RwTx.Commit(); err != nil {
+			return err
+		}
+		_, _ = os.Stdout.WriteString(commitFinishedMarker)
+		select {} // kill was late
+	}
+	if err := tx.RwTx.Commit(); err != nil {
+		return err
+	}
+	return tx.crash(n, afterCommit)
+}
+
+func (tx *crashTx) crash(n int, point crashPoint) error {
+	switch tx.db.hook(n, point) {
+	case abortCommit:
+		tx.RwTx.Rollback()
+		return fmt.Errorf("commit %d: %w", n, errInjectedAbort)
+	case killProcess:
+		kill()
+	}
+	return nil
+}
+
+func kill() {
+	p, _ := os.FindProcess(os.Getpid())
+	_ = p.Kill()
+	select {} // wait for death
+}
+
+// workload: commit i writes key i and sets counter to i+1.
+// invariant: counter == amount of keys and keys are 0..counter-1
+var (
+	crashTable   = kv.HeaderNumber
+	crashCounter = []byte("counter")
+)
+
+func crashWorkload(db kv.RwDB, commits int) error {
+	return crashWorkloadFrom(db, 0, commits)
+}
+
+func crashWorkloadFrom(db kv.RwDB, from, to int) error {
+	return crashWorkloadSized(db, from, to, 1024)
+}
+
+// verifyCrashInvariants - returns amount of durable commits
+func verifyCrashInvariants(t *testing.T, path string) uint64 {
+	t.Helper()
+	db, err := mdbx.NewMDBX(log.New()).Path(path).Open()
+	require.NoError(t, err)
+	defer db.Close()
+
+	var counter uint64
+	require.NoError(t, db.View(context.Background(), func(tx kv.Tx) error {
+		v, err := tx.GetOne(crashTable, crashCounter)
+		if err != nil {
+			return err
+		}
+		if v != nil {
+			counter = binary.BigEndian.Uint64(v)
+		}
+		var keys uint64
+		if err := tx.ForEach(crashTable, nil, func(k, v []byte) error {
+			if len(k) != 8 {
+				return nil
+			}
+			require.Equal(t, keys, binary.BigEndian.Uint64(k), "keys must be continuous")
+			keys++
+			return nil
+		}); err != nil {
+			return err
+		}
+		require.Equal(t, counter, keys, "counter must match amount of keys")
+		return nil
+	}))
+	return counter
+}
+
+const crashHelperEnv = "MDBX_CRASH_HELPER"
+
+// TestCrashHelperProcess - not a real test, it's workload executed in child process by runCrashingProcess
+func TestCrashHelperProcess(t *testing.T) {
+	args := os.Getenv(crashHelperEnv)
+	if args == "" {
+		return
+	}
+	parts := strings.Split(args, ",")
+	path, flags := parts[0], parts[1]
+	killAt, _ := strconv.Atoi(parts[2])
+	point, _ := strconv.Atoi(parts[3])
+	delay, _ := time.ParseDuration(parts[4])
+	valueSize, _ := strconv.Atoi(parts[5])
+	f, _ := strconv.ParseUint(flags, 10, 64)
+
+	db := mdbx.NewMDBX(log.New()).Path(path).Flags(func(uint) uint { return uint(f) }).MustOpen()
+	cdb := &crashDB{RwDB: db, killDelay: delay, hook: func(n int, p crashPoint) crashAction {
+		if n == killAt && p == crashPoint(point) {
+			return killProcess
+		}
+		return noCrash
+	}}
+	_ = crashWorkloadSized(cdb, 0, killAt+1, valueSize)
+	t.Fatal("process must be killed before this line")
+}
+
+// runCrashingProcess - returns true if process was killed inside of commit
+func runCrashingProcess(t *testing.T, path string, flags uint, killAt int, point crashPoint, delay time.Duration, valueSize int) bool {
+	t.Helper()
+	cmd := exec.Command(os.Args[0], "-test.run=^TestCrashHelperProcess$")
+	cmd.Env = append(os.Environ(), fmt.Sprintf("%s=%s,%d,%d,%d,%s,%d", crashHelperEnv, path, flags, killAt, point, delay, valueSize))
+	var out bytes.Buffer
+	cmd.Stdout = &out
+	err := cmd.Run()
+	var exitErr *exec.ExitError
+	require.True(t, errors.As(err, &exitErr), "child process must be killed, got: %v", err)
+	return strings.Contains(out.String(), commitStartedMarker) && !strings.Contains(out.String(), commitFinishedMarker)
+}
+
+var crashSyncModes = map[string]uint{
+	"durable":     mdbx2.NoReadahead | mdbx2.Coalesce | mdbx2.Durable,
+	"safe_nosync": mdbx2.NoReadahead | mdbx2.Coalesce | mdbx2.SafeNoSync,
+}
+
+func TestCrashKill(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("fix me on win please")
+	}
+	if testing.Short() {
+		t.Skip()
+	}
+	for name, flags := range crashSyncModes {
+		for _, point := range []crashPoint{beforeCommit, afterCommit} {
+			flags, point := flags, point
+			t.Run(fmt.Sprintf("%s_%d", name, point), func(t *testing.T) {
+				path := t.TempDir()
+				runCrashingProcess(t, path, flags, 5, point, 0, 1024)
+				durable := verifyCrashInvariants(t, path)
+				// process kill (not OS crash) must not lose committed data in any mode - page cache survives
+				if point == beforeCommit {
+					require.Equal(t, uint64(4), durable)
+				} else {
+					require.Equal(t, uint64(5), durable)
+				}
+			})
+		}
+	}
+}
+
+// TestCrashKillDuringCommit - kill lands while mdbx writes pages of big commit: after restart db has state of
+// previous or of killed commit, never partial one
+func TestCrashKillDuringCommit(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("fix me on win please")
+	}
+	if testing.Short() {
+		t.Skip()
+	}
+	const killAt, valueSize = 3, 16 << 20
+	for name, flags := range crashSyncModes {
+		flags := flags
+		t.Run(name, func(t *testing.T) {
+			inside := 0
+			for _, delay := range []time.Duration{0, 100 * time.Microsecond, time.Millisecond, 3 * time.Millisecond, 10 * time.Millisecond} {
+				path := t.TempDir()
+				if runCrashingProcess(t, path, flags, killAt, duringCommit, delay, valueSize) {
+					inside++
+				}
+				durable := verifyCrashInvariants(t, path)
+				require.True(t, durable == killAt-1 || durable == killAt, "durable commits: %d", durable)
+
+				// db is usable after restart
+				db := mdbx.NewMDBX(log.New()).Path(path).MustOpen()
+				require.NoError(t, crashWorkloadFrom(db, int(durable), killAt+2))
+				db.Close()
+				require.Equal(t, uint64(killAt+2), verifyCrashInvariants(t, path))
+			}
+			require.Greater(t, inside, 0, "no kill landed inside of commit")
+		})
+	}
+}
+
+func TestCrashCommitAborted(t *testing.T) {
+	path := t.TempDir()
+	db := mdbx.NewMDBX(log.New()).Path(path).MustOpen()
+	cdb := &crashDB{RwDB: db, hook: func(n int, p crashPoint) crashAction {
+		if n == 3 && p == beforeCommit {
+			return abortCommit
+		}
+		return noCrash
+	}}
+	err := crashWorkload(cdb, 5)
+	require.True(t, errors.Is(err, errInjectedAbort))
+	db.Close()
+
+	// failed commit must not be visible, previous ones must be
+	require.Equal(t, uint64(2), verifyCrashInvariants(t, path))
+
+	// db is still usable after failure
+	db = mdbx.NewMDBX(log.New()).Path(path).MustOpen()
+	require.NoError(t, crashWorkloadFrom(db, 2, 5))
+	db.Close()
+	require.Equal(t, uint64(5), verifyCrashInvariants(t, path))
+}
+
+func crashWorkloadSized(db kv.RwDB, from, to, valueSize int) error {
+	for i := from; i < to; i++ {
+		if err := db.Update(context.Background(), func(tx kv.RwTx) error {
+			k := make([]byte, 8)
+			binary.BigEndian.PutUint64(k, uint64(i))
+			if err := tx.Put(crashTable, k, make([]byte, valueSize)); err != nil {
+				return err
+			}
+			v := make([]byte, 8)
+			binary.BigEndian.PutUint64(v, uint64(i+1))
+			return tx.Put(crashTable, crashCounter, v)
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -29,6 +29,9 @@ import (
 	"sync"
 
 	"github.com/c2h5oh/datasize"
+	"github.com/ledgerwatch/erigon-lib/common/errkind"
+	"github.com/ledgerwatch/erigon-lib/common/logging"
+	"github.com/ledgerwatch/erigon-lib/common/tracing"
 	"github.com/ledgerwatch/erigon-lib/kv"
 	"github.com/ledgerwatch/log/v3"
 	"github.com/torquem-ch/mdbx-go/mdbx"
@@ -53,8 +56,10 @@ type MdbxOpts struct {
 	label      kv.Label // marker to distinct db instances - one process may open many databases. for example to collect metrics of only 1 database
 	verbosity  kv.DBVerbosityLvl
 	mapSize    datasize.ByteSize
+	pageSize   uint64
 	flags      uint
-	log        log.Logger
+	log        logging.Logger
+	onMapFull  func(label kv.Label) // called when write fails because map reached it's upper bound
 }
 
 func testKVPath() string {
@@ -66,11 +71,21 @@ func testKVPath() string {
 }
 
 func NewMDBX(log log.Logger) MdbxOpts {
-	return MdbxOpts{
+	opts := MdbxOpts{
 		bucketsCfg: WithChaindataTables,
 		flags:      mdbx.NoReadahead | mdbx.Coalesce | mdbx.Durable,
-		log:        log,
+		log:        logging.Root(),
 	}
+	if log != nil {
+		opts.log = logging.FromLog(log)
+	}
+	return opts
+}
+
+// Logger - routes logs of db to l instead of ledgerwatch/log logger given to NewMDBX
+func (opts MdbxOpts) Logger(l logging.Logger) MdbxOpts {
+	opts.log = logging.OrRoot(l)
+	return opts
 }
 
 func (opts MdbxOpts) Label(label kv.Label) MdbxOpts {
@@ -117,6 +132,17 @@ func (opts MdbxOpts) MapSize(sz datasize.ByteSize) MdbxOpts {
 	return opts
 }
 
+func (opts MdbxOpts) PageSize(sz uint64) MdbxOpts {
+	opts.pageSize = sz
+	return opts
+}
+
+// OnMapFull - f is called every time write fails with kv.ErrMapFull, for example to evict data or to alert
+func (opts MdbxOpts) OnMapFull(f func(label kv.Label)) MdbxOpts {
+	opts.onMapFull = f
+	return opts
+}
+
 func (opts MdbxOpts) WithTablessCfg(f TableCfgFunc) MdbxOpts {
 	opts.bucketsCfg = f
 	return opts
@@ -156,13 +182,16 @@ func (opts MdbxOpts) Open() (kv.RwDB, error) {
 			opts.mapSize = 2 * datasize.TB
 		}
 	}
+	if opts.pageSize == 0 {
+		opts.pageSize = pageSize
+	}
 	if opts.flags&mdbx.Accede == 0 {
 		if opts.inMem {
-			if err = env.SetGeometry(-1, -1, int(opts.mapSize), int(2*datasize.MB), 0, 4*1024); err != nil {
+			if err = env.SetGeometry(-1, -1, int(opts.mapSize), int(2*datasize.MB), 0, int(opts.pageSize)); err != nil {
 				return nil, err
 			}
 		} else {
-			if err = env.SetGeometry(-1, -1, int(opts.mapSize), int(2*datasize.GB), -1, pageSize); err != nil {
+			if err = env.SetGeometry(-1, -1, int(opts.mapSize), int(2*datasize.GB), -1, int(opts.pageSize)); err != nil {
 				return nil, err
 			}
 		}
@@ -218,7 +247,7 @@ func (opts MdbxOpts) Open() (kv.RwDB, error) {
 		log:     opts.log,
 		wg:      &sync.WaitGroup{},
 		buckets: kv.TableCfg{},
-		txSize:  dirtyPagesLimit * pageSize,
+		txSize:  dirtyPagesLimit * opts.pageSize,
 	}
 	customBuckets := opts.bucketsCfg(kv.ChaindataTablesCfg)
 	for name, cfg := range customBuckets { // copy map to avoid changing global variable
@@ -306,7 +335,7 @@ func (opts MdbxOpts) MustOpen() kv.RwDB {
 
 type MdbxKV struct {
 	env     *mdbx.Env
-	log     log.Logger
+	log     logging.Logger
 	wg      *sync.WaitGroup
 	buckets kv.TableCfg
 	opts    MdbxOpts
@@ -336,7 +365,7 @@ func (db *MdbxKV) Close() {
 func (db *MdbxKV) BeginRo(ctx context.Context) (txn kv.Tx, err error) {
 	select {
 	case <-ctx.Done():
-		return nil, ctx.Err()
+		return nil, errkind.Wrap(errkind.Canceled, ctx.Err())
 	default:
 	}
 	if db.env == nil {
@@ -354,14 +383,17 @@ func (db *MdbxKV) BeginRo(ctx context.Context) (txn kv.Tx, err error) {
 		return nil, fmt.Errorf("%w, label: %s, trace: %s", err, db.opts.label.String(), callers(10))
 	}
 	tx.RawRead = true
+	ctx, span := tracing.Start(ctx, "kv.RoTx", "label", db.opts.label.String())
 	return &MdbxTx{
 		db:       db,
 		tx:       tx,
 		readOnly: true,
+		ctx:      ctx,
+		span:     span,
 	}, nil
 }
 
-func (db *MdbxKV) BeginRw(_ context.Context) (txn kv.RwTx, err error) {
+func (db *MdbxKV) BeginRw(ctx context.Context) (txn kv.RwTx, err error) {
 	if db.env == nil {
 		return nil, fmt.Errorf("db closed")
 	}
@@ -378,19 +410,50 @@ func (db *MdbxKV) BeginRw(_ context.Context) (txn kv.RwTx, err error) {
 		return nil, fmt.Errorf("%w, lable: %s, trace: %s", err, db.opts.label.String(), callers(10))
 	}
 	tx.RawRead = true
+	ctx, span := tracing.Start(ctx, "kv.RwTx", "label", db.opts.label.String())
 	return &MdbxTx{
-		db: db,
-		tx: tx,
+		db:   db,
+		tx:   tx,
+		ctx:  ctx,
+		span: span,
 	}, nil
 }
 
 type MdbxTx struct {
 	tx               *mdbx.Txn
 	db               *MdbxKV
+	parent           *MdbxTx // not nil for nested transactions
 	cursors          map[uint64]*mdbx.Cursor
 	statelessCursors map[string]kv.Cursor
 	readOnly         bool
 	cursorID         uint64
+
+	ctx  context.Context // of Begin, carries span of transaction
+	span tracing.Span    // from Begin till Commit/Rollback
+}
+
+// BeginChild - starts nested write transaction on top of current one.
+// Child doesn't hold OS thread and db.wg - parent does it.
+func (tx *MdbxTx) BeginChild() (kv.RwTx, error) {
+	if tx.readOnly {
+		return nil, fmt.Errorf("nested transactions are not supported for read-only transactions")
+	}
+	if tx.tx == nil {
+		return nil, fmt.Errorf("parent transaction already closed")
+	}
+	child, err := tx.db.env.BeginTxn(tx.tx, 0)
+	if err != nil {
+		return nil, fmt.Errorf("%w, label: %s, trace: %s", err, tx.db.opts.label.String(), callers(10))
+	}
+	child.RawRead = true
+	ctx, span := tracing.Start(tx.ctx, "kv.ChildTx", "label", tx.db.opts.label.String())
+	return &MdbxTx{
+		db:     tx.db,
+		tx:     child,
+		parent: tx,
+		ctx:    ctx,
+		span:   span,
+	}, nil
 }
 
 type MdbxCursor struct {
@@ -418,7 +481,9 @@ func (db *MdbxKV) AllBuckets() kv.TableCfg {
 	return db.buckets
 }
 
-func (tx *MdbxTx) ForEach(bucket string, fromPrefix []byte, walker func(k, v []byte) error) error {
+func (tx *MdbxTx) ForEach(bucket string, fromPrefix []byte, walker func(k, v []byte) error) (err error) {
+	_, span := tracing.Start(tx.ctx, "kv.ForEach", "table", bucket)
+	defer func() { tracing.End(span, err) }()
 	c, err := tx.Cursor(bucket)
 	if err != nil {
 		return err
@@ -436,7 +501,9 @@ func (tx *MdbxTx) ForEach(bucket string, fromPrefix []byte, walker func(k, v []b
 	return nil
 }
 
-func (tx *MdbxTx) ForPrefix(bucket string, prefix []byte, walker func(k, v []byte) error) error {
+func (tx *MdbxTx) ForPrefix(bucket string, prefix []byte, walker func(k, v []byte) error) (err error) {
+	_, span := tracing.Start(tx.ctx, "kv.ForPrefix", "table", bucket)
+	defer func() { tracing.End(span, err) }()
 	c, err := tx.Cursor(bucket)
 	if err != nil {
 		return err
@@ -456,7 +523,9 @@ func (tx *MdbxTx) ForPrefix(bucket string, prefix []byte, walker func(k, v []byt
 	}
 	return nil
 }
-func (tx *MdbxTx) ForAmount(bucket string, fromPrefix []byte, amount uint32, walker func(k, v []byte) error) error {
+func (tx *MdbxTx) ForAmount(bucket string, fromPrefix []byte, amount uint32, walker func(k, v []byte) error) (err error) {
+	_, span := tracing.Start(tx.ctx, "kv.ForAmount", "table", bucket, "amount", amount)
+	defer func() { tracing.End(span, err) }()
 	c, err := tx.Cursor(bucket)
 	if err != nil {
 		return err
@@ -709,12 +778,22 @@ func (tx *MdbxTx) Commit() error {
 	if tx.tx == nil {
 		return nil
 	}
+	if tx.parent != nil {
+		defer func() {
+			tx.tx = nil
+			tx.span.End()
+		}()
+		tx.closeCursors()
+		_, err := tx.tx.Commit()
+		return tx.mapFull(err)
+	}
 	defer func() {
 		tx.tx = nil
 		tx.db.wg.Done()
 		if !tx.readOnly {
 			runtime.UnlockOSThread()
 		}
+		tx.span.End()
 	}()
 	tx.closeCursors()
 
@@ -728,9 +807,11 @@ func (tx *MdbxTx) Commit() error {
 	//}
 	tx.CollectMetrics()
 
+	_, span := tracing.Start(tx.ctx, "kv.Commit", "label", tx.db.opts.label.String())
 	latency, err := tx.tx.Commit()
+	tracing.End(span, err)
 	if err != nil {
-		return err
+		return tx.mapFull(err)
 	}
 
 	if tx.db.opts.label == kv.ChainDB {
@@ -765,18 +846,31 @@ func (tx *MdbxTx) Rollback() {
 	if tx.tx == nil {
 		return
 	}
+	if tx.parent != nil {
+		defer func() {
+			tx.tx = nil
+			tx.span.End()
+		}()
+		tx.closeCursors()
+		tx.tx.Abort()
+		return
+	}
 	defer func() {
 		tx.tx = nil
 		tx.db.wg.Done()
 		if !tx.readOnly {
 			runtime.UnlockOSThread()
 		}
+		tx.span.End()
 	}()
 	tx.closeCursors()
 	//tx.printDebugInfo()
 	tx.tx.Abort()
 }
 
+// ID - id of db state visible by transaction (incremented by each commit)
+func (tx *MdbxTx) ID() uint64 { return uint64(tx.tx.ID()) }
+
 func (tx *MdbxTx) SpaceDirty() (uint64, uint64, error) {
 	txInfo, err := tx.tx.Info(true)
 	if err != nil {
@@ -810,6 +904,30 @@ func (tx *MdbxTx) PrintDebugInfo() {
 	*/
 }
 
+// mapFull - converts MDBX_MAP_FULL to kv.ErrMapFull and notifies OnMapFull callback
+func (tx *MdbxTx) mapFull(err error) error {
+	if err == nil || !mdbx.IsMapFull(err) {
+		return withKind(err)
+	}
+	if tx.db.opts.onMapFull != nil {
+		tx.db.opts.onMapFull(tx.db.opts.label)
+	}
+	return fmt.Errorf("%w, label: %s, map size: %s", kv.ErrMapFull, tx.db.opts.label.String(), tx.db.opts.mapSize.HR())
+}
+
+// withKind - marks mdbx errors by errkind, to let callers check them by errors.Is
+func withKind(err error) error {
+	switch {
+	case err == nil:
+		return nil
+	case mdbx.IsErrno(err, mdbx.Corrupted), mdbx.IsErrno(err, mdbx.PageNotFound), mdbx.IsErrno(err, mdbx.Panic):
+		return errkind.Wrap(errkind.Corrupted, err)
+	case mdbx.IsErrno(err, mdbx.BadValSize), mdbx.IsErrno(err, mdbx.TxnFull):
+		return errkind.Wrap(errkind.TooBig, err)
+	}
+	return err
+}
+
 func (tx *MdbxTx) closeCursors() {
 	for _, c := range tx.cursors {
 		if c != nil {
@@ -935,7 +1053,7 @@ func (tx *MdbxTx) BucketSize(name string) (uint64, error) {
 	if err != nil {
 		return 0, err
 	}
-	return (st.LeafPages + st.BranchPages + st.OverflowPages) * pageSize, nil
+	return (st.LeafPages + st.BranchPages + st.OverflowPages) * uint64(st.PSize), nil
 }
 
 func (tx *MdbxTx) BucketStat(name string) (*mdbx.Stat, error) {
@@ -1000,42 +1118,52 @@ func (tx *MdbxTx) CursorDupSort(bucket string) (kv.CursorDupSort, error) {
 	return tx.RwCursorDupSort(bucket)
 }
 
+// get - cursor read. mdbx.NotFound is returned as is: callers check it by mdbx.IsNotFound
+func (c *MdbxCursor) get(k, v []byte, op uint) ([]byte, []byte, error) {
+	k, v, err := c.c.Get(k, v, op)
+	return k, v, withKind(err)
+}
+
 // methods here help to see better pprof picture
-func (c *MdbxCursor) set(k []byte) ([]byte, []byte, error) { return c.c.Get(k, nil, mdbx.Set) }
-func (c *MdbxCursor) getCurrent() ([]byte, []byte, error)  { return c.c.Get(nil, nil, mdbx.GetCurrent) }
-func (c *MdbxCursor) first() ([]byte, []byte, error)       { return c.c.Get(nil, nil, mdbx.First) }
-func (c *MdbxCursor) next() ([]byte, []byte, error)        { return c.c.Get(nil, nil, mdbx.Next) }
-func (c *MdbxCursor) nextDup() ([]byte, []byte, error)     { return c.c.Get(nil, nil, mdbx.NextDup) }
-func (c *MdbxCursor) nextNoDup() ([]byte, []byte, error)   { return c.c.Get(nil, nil, mdbx.NextNoDup) }
-func (c *MdbxCursor) prev() ([]byte, []byte, error)        { return c.c.Get(nil, nil, mdbx.Prev) }
-func (c *MdbxCursor) prevDup() ([]byte, []byte, error)     { return c.c.Get(nil, nil, mdbx.PrevDup) }
-func (c *MdbxCursor) prevNoDup() ([]byte, []byte, error)   { return c.c.Get(nil, nil, mdbx.PrevNoDup) }
-func (c *MdbxCursor) last() ([]byte, []byte, error)        { return c.c.Get(nil, nil, mdbx.Last) }
-func (c *MdbxCursor) delCurrent() error                    { return c.c.Del(mdbx.Current) }
-func (c *MdbxCursor) delNoDupData() error                  { return c.c.Del(mdbx.NoDupData) }
-func (c *MdbxCursor) put(k, v []byte) error                { return c.c.Put(k, v, 0) }
-func (c *MdbxCursor) putCurrent(k, v []byte) error         { return c.c.Put(k, v, mdbx.Current) }
-func (c *MdbxCursor) putNoOverwrite(k, v []byte) error     { return c.c.Put(k, v, mdbx.NoOverwrite) }
-func (c *MdbxCursor) putNoDupData(k, v []byte) error       { return c.c.Put(k, v, mdbx.NoDupData) }
-func (c *MdbxCursor) append(k, v []byte) error             { return c.c.Put(k, v, mdbx.Append) }
-func (c *MdbxCursor) appendDup(k, v []byte) error          { return c.c.Put(k, v, mdbx.AppendDup) }
+func (c *MdbxCursor) set(k []byte) ([]byte, []byte, error) { return c.get(k, nil, mdbx.Set) }
+func (c *MdbxCursor) getCurrent() ([]byte, []byte, error)  { return c.get(nil, nil, mdbx.GetCurrent) }
+func (c *MdbxCursor) first() ([]byte, []byte, error)       { return c.get(nil, nil, mdbx.First) }
+func (c *MdbxCursor) next() ([]byte, []byte, error)        { return c.get(nil, nil, mdbx.Next) }
+func (c *MdbxCursor) nextDup() ([]byte, []byte, error)     { return c.get(nil, nil, mdbx.NextDup) }
+func (c *MdbxCursor) nextNoDup() ([]byte, []byte, error)   { return c.get(nil, nil, mdbx.NextNoDup) }
+func (c *MdbxCursor) prev() ([]byte, []byte, error)        { return c.get(nil, nil, mdbx.Prev) }
+func (c *MdbxCursor) prevDup() ([]byte, []byte, error)     { return c.get(nil, nil, mdbx.PrevDup) }
+func (c *MdbxCursor) prevNoDup() ([]byte, []byte, error)   { return c.get(nil, nil, mdbx.PrevNoDup) }
+func (c *MdbxCursor) last() ([]byte, []byte, error)        { return c.get(nil, nil, mdbx.Last) }
+func (c *MdbxCursor) delCurrent() error                    { return c.tx.mapFull(c.c.Del(mdbx.Current)) }
+func (c *MdbxCursor) delNoDupData() error                  { return c.tx.mapFull(c.c.Del(mdbx.NoDupData)) }
+func (c *MdbxCursor) put(k, v []byte) error                { return c.tx.mapFull(c.c.Put(k, v, 0)) }
+func (c *MdbxCursor) putCurrent(k, v []byte) error         { return c.tx.mapFull(c.c.Put(k, v, mdbx.Current)) }
+func (c *MdbxCursor) putNoOverwrite(k, v []byte) error {
+	return c.tx.mapFull(c.c.Put(k, v, mdbx.NoOverwrite))
+}
+func (c *MdbxCursor) putNoDupData(k, v []byte) error {
+	return c.tx.mapFull(c.c.Put(k, v, mdbx.NoDupData))
+}
+func (c *MdbxCursor) append(k, v []byte) error    { return c.tx.mapFull(c.c.Put(k, v, mdbx.Append)) }
+func (c *MdbxCursor) appendDup(k, v []byte) error { return c.tx.mapFull(c.c.Put(k, v, mdbx.AppendDup)) }
 func (c *MdbxCursor) getBoth(k, v []byte) ([]byte, error) {
-	_, v, err := c.c.Get(k, v, mdbx.GetBoth)
+	_, v, err := c.get(k, v, mdbx.GetBoth)
 	return v, err
 }
 func (c *MdbxCursor) setRange(k []byte) ([]byte, []byte, error) {
-	return c.c.Get(k, nil, mdbx.SetRange)
+	return c.get(k, nil, mdbx.SetRange)
 }
 func (c *MdbxCursor) getBothRange(k, v []byte) ([]byte, error) {
-	_, v, err := c.c.Get(k, v, mdbx.GetBothRange)
+	_, v, err := c.get(k, v, mdbx.GetBothRange)
 	return v, err
 }
 func (c *MdbxCursor) firstDup() ([]byte, error) {
-	_, v, err := c.c.Get(nil, nil, mdbx.FirstDup)
+	_, v, err := c.get(nil, nil, mdbx.FirstDup)
 	return v, err
 }
 func (c *MdbxCursor) lastDup() ([]byte, error) {
-	_, v, err := c.c.Get(nil, nil, mdbx.LastDup)
+	_, v, err := c.get(nil, nil, mdbx.LastDup)
 	return v, err
 }
 
@@ -1526,7 +1654,7 @@ func (c *MdbxDupSortCursor) LastDup() ([]byte, error) {
 }
 
 func (c *MdbxDupSortCursor) Append(k []byte, v []byte) error {
-	if err := c.c.Put(k, v, mdbx.Append|mdbx.AppendDup); err != nil {
+	if err := c.tx.mapFull(c.c.Put(k, v, mdbx.Append|mdbx.AppendDup)); err != nil {
 		return fmt.Errorf("in Append: bucket=%s, %w", c.bucketName, err)
 	}
 	return nil
@@ -0,0 +1,168 @@
+/*
+   Copyright 2021 Erigon contributors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package mdbx_test
+
+import (
+	"context"
+	"encoding/binary"
+	"testing"
+
+	"github.com/ledgerwatch/erigon-lib/common/logging"
+	"github.com/ledgerwatch/erigon-lib/common/tracing"
+	"github.com/ledgerwatch/erigon-lib/kv"
+	"github.com/ledgerwatch/erigon-lib/kv/mdbx"
+	"github.com/ledgerwatch/erigon-lib/kv/memdb"
+	"github.com/ledgerwatch/log/v3"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNestedTx(t *testing.T) {
+	require := require.New(t)
+	_, tx := memdb.NewTestTx(t)
+	table := kv.ChaindataTables[0]
+
+	require.NoError(tx.Put(table, []byte("a"), []byte("1")))
+
+	// aborted child must not affect parent
+	child, err := tx.BeginChild()
+	require.NoError(err)
+	require.NoError(child.Put(table, []byte("b"), []byte("2")))
+	require.NoError(child.Delete(table, []byte("a"), nil))
+	v, err := child.GetOne(table, []byte("b"))
+	require.NoError(err)
+	require.Equal([]byte("2"), v)
+	child.Rollback()
+
+	v, err = tx.GetOne(table, []byte("a"))
+	require.NoError(err)
+	require.Equal([]byte("1"), v)
+	has, err := tx.Has(table, []byte("b"))
+	require.NoError(err)
+	require.False(has)
+
+	// committed child changes visible in parent
+	child, err = tx.BeginChild()
+	require.NoError(err)
+	require.NoError(child.Put(table, []byte("c"), []byte("3")))
+	grandChild, err := child.BeginChild()
+	require.NoError(err)
+	require.NoError(grandChild.Put(table, []byte("d"), []byte("4")))
+	require.NoError(grandChild.Commit())
+	require.NoError(child.Commit())
+
+	var keys []string
+	require.NoError(tx.ForEach(table, nil, func(k, v []byte) error {
+		keys = append(keys, string(k))
+		return nil
+	}))
+	require.Equal([]string{"a", "c", "d"}, keys)
+}
+
+func TestPagesStatAndCompaction(t *testing.T) {
+	require := require.New(t)
+	db := memdb.NewTestDB(t)
+	table := kv.HeaderNumber
+	ctx := context.Background()
+
+	require.NoError(db.Update(ctx, func(tx kv.RwTx) error {
+		for i := uint64(0); i < 10_000; i++ {
+			k := make([]byte, 8)
+			binary.BigEndian.PutUint64(k, i)
+			if err := tx.Put(table, k, make([]byte, 64)); err != nil {
+				return err
+			}
+		}
+		return nil
+	}))
+	require.NoError(db.Update(ctx, func(tx kv.RwTx) error {
+		for i := uint64(0); i < 10_000; i += 2 {
+			k := make([]byte, 8)
+			binary.BigEndian.PutUint64(k, i)
+			if err := tx.Delete(table, k, nil); err != nil {
+				return err
+			}
+		}
+		return nil
+	}))
+
+	st, err := db.(*mdbx.MdbxKV).PagesStat()
+	require.NoError(err)
+	require.NotZero(st.LeafPages)
+	require.NotZero(st.FreelistLen)
+	require.Greater(st.Fragmentation(), 0.0)
+
+	path := t.TempDir()
+	compacted, err := db.(*mdbx.MdbxKV).CompactIfFragmented(ctx, path, 1.1)
+	require.NoError(err)
+	require.False(compacted)
+	compacted, err = db.(*mdbx.MdbxKV).CompactIfFragmented(ctx, path, 0)
+	require.NoError(err)
+	require.True(compacted)
+
+	copyDB := mdbx.NewMDBX(log.New()).Path(path).MustOpen()
+	defer copyDB.Close()
+	require.NoError(copyDB.View(ctx, func(tx kv.Tx) error {
+		cnt := 0
+		if err := tx.ForEach(table, nil, func(k, v []byte) error {
+			require.Equal(uint64(1), binary.BigEndian.Uint64(k)%2)
+			cnt++
+			return nil
+		}); err != nil {
+			return err
+		}
+		require.Equal(5_000, cnt)
+		return nil
+	}))
+	copySt, err := copyDB.(*mdbx.MdbxKV).PagesStat()
+	require.NoError(err)
+	require.Less(copySt.LeafPages, st.LeafPages)
+}
+
+func TestLogger(t *testing.T) {
+	var msgs []string
+	db := mdbx.NewMDBX(nil).Path(t.TempDir()).Logger(logging.Func(func(_ logging.Level, msg string, _ []interface{}) {
+		msgs = append(msgs, msg)
+	})).MustOpen()
+	db.Close()
+	require.Contains(t, msgs, "database closed")
+}
+
+func TestTracing(t *testing.T) {
+	require := require.New(t)
+	db := memdb.NewTestDB(t)
+	r := &tracing.Recorder{}
+	tracing.SetTracer(r)
+	defer tracing.SetTracer(nil)
+
+	ctx, span := tracing.Start(context.Background(), "caller")
+	require.NoError(db.Update(ctx, func(tx kv.RwTx) error {
+		if err := tx.Put(kv.HeaderNumber, []byte{1}, []byte{1}); err != nil {
+			return err
+		}
+		return tx.ForEach(kv.HeaderNumber, nil, func(k, v []byte) error { return nil })
+	}))
+	span.End()
+
+	var got []string
+	for _, s := range r.Spans() {
+		require.False(s.End.IsZero(), s.Name)
+		if s.Parent != nil {
+			got = append(got, s.Parent.Name+"/"+s.Name)
+		}
+	}
+	require.Equal([]string{"caller/kv.RwTx", "kv.RwTx/kv.ForEach", "kv.RwTx/kv.Commit"}, got)
+}
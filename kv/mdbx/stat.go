@@ -0,0 +1,245 @@
+/*
+   Copyright 2021 Erigon contributors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package mdbx
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/ledgerwatch/erigon-lib/common/errkind"
+	"github.com/ledgerwatch/erigon-lib/kv"
+	"github.com/torquem-ch/mdbx-go/mdbx"
+)
+
+// PagesStat - page utilization of whole environment
+type PagesStat struct {
+	PageSize      uint64
+	TotalPages    uint64 // pages allocated in data file
+	BranchPages   uint64 // sum of all tables
+	LeafPages     uint64 // sum of all tables
+	OverflowPages uint64 // sum of all tables
+	GcPages       uint64 // pages occupied by GC (freelist) table itself
+	FreelistLen   uint64 // amount of free pages stored in GC - they will be re-used by next write transactions
+	GcBacklog     uint64 // amount of GC records: transactions whose retired pages are not recycled yet
+}
+
+// Fragmentation - share of allocated pages which are not used by tables data
+func (s PagesStat) Fragmentation() float64 {
+	if s.TotalPages == 0 {
+		return 0
+	}
+	return float64(s.FreelistLen+s.GcPages) / float64(s.TotalPages)
+}
+
+// PagesStat - walks over GC table, can take time on big databases
+func (db *MdbxKV) PagesStat() (PagesStat, error) {
+	if db.env == nil {
+		return PagesStat{}, fmt.Errorf("db closed")
+	}
+	txn, err := db.env.BeginTxn(nil, mdbx.Readonly)
+	if err != nil {
+		return PagesStat{}, err
+	}
+	defer txn.Abort()
+
+	info, err := db.env.Info(txn)
+	if err != nil {
+		return PagesStat{}, fmt.Errorf("env info: %w", err)
+	}
+	st, err := db.env.Stat()
+	if err != nil {
+		return PagesStat{}, fmt.Errorf("env stat: %w", err)
+	}
+	gc, err := txn.StatDBI(mdbx.DBI(0))
+	if err != nil {
+		return PagesStat{}, fmt.Errorf("gc stat: %w", err)
+	}
+	res := PagesStat{
+		PageSize:      uint64(info.PageSize),
+		TotalPages:    uint64(info.LastPNO) + 1,
+		BranchPages:   st.BranchPages,
+		LeafPages:     st.LeafPages,
+		OverflowPages: st.OverflowPages,
+		GcPages:       gc.BranchPages + gc.LeafPages + gc.OverflowPages,
+		GcBacklog:     gc.Entries,
+	}
+
+	c, err := txn.OpenCursor(mdbx.DBI(0))
+	if err != nil {
+		return PagesStat{}, fmt.Errorf("gc cursor: %w", err)
+	}
+	defer c.Close()
+	// every GC record is list of page numbers (uint32), first element is length of list
+	for _, v, err := c.Get(nil, nil, mdbx.First); ; _, v, err = c.Get(nil, nil, mdbx.Next) {
+		if err != nil {
+			if mdbx.IsNotFound(err) {
+				break
+			}
+			return PagesStat{}, fmt.Errorf("gc walk: %w", err)
+		}
+		if len(v) >= 4 {
+			res.FreelistLen += uint64(len(v)/4 - 1)
+		}
+	}
+	return res, nil
+}
+
+// CompactTo - creates compacted copy of db in new environment at given path.
+// Data copied table by table in sorted order - so pages of result are dense and there is no freelist.
+// Only tables known by current TablesCfg are copied.
+func (db *MdbxKV) CompactTo(ctx context.Context, path string) error {
+	opts := db.opts
+	opts.path = path
+	opts.inMem = false
+	opts.flags = opts.flags &^ mdbx.Readonly &^ mdbx.Accede
+	dst, err := opts.Open()
+	if err != nil {
+		return fmt.Errorf("open compaction target: %w", err)
+	}
+	defer dst.Close()
+	return db.copyTo(ctx, dst.(*MdbxKV))
+}
+
+// Clone - in-memory copy of db with same tables and options
+func (db *MdbxKV) Clone(ctx context.Context) (kv.RwDB, error) {
+	opts := db.opts
+	opts.path = ""
+	opts.inMem = true
+	opts.flags = opts.flags &^ mdbx.Readonly &^ mdbx.Accede
+	dst, err := opts.Open()
+	if err != nil {
+		return nil, fmt.Errorf("open clone: %w", err)
+	}
+	if err := db.copyTo(ctx, dst.(*MdbxKV)); err != nil {
+		dst.Close()
+		return nil, err
+	}
+	return dst, nil
+}
+
+// CompactIfFragmented - does CompactTo only if fragmentation is above threshold (0..1)
+func (db *MdbxKV) CompactIfFragmented(ctx context.Context, path string, threshold float64) (bool, error) {
+	st, err := db.PagesStat()
+	if err != nil {
+		return false, err
+	}
+	if st.Fragmentation() < threshold {
+		return false, nil
+	}
+	db.log.Info("[db] compacting", "label", db.opts.label, "fragmentation", fmt.Sprintf("%.2f", st.Fragmentation()), "to", path)
+	if err := db.CompactTo(ctx, path); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// copyTo - copies raw key-values of all tables, write transactions of dst are committed when it's dirty space reach half of limit
+func (db *MdbxKV) copyTo(ctx context.Context, dst *MdbxKV) error {
+	srcTx, err := db.BeginRo(ctx)
+	if err != nil {
+		return err
+	}
+	defer srcTx.Rollback()
+	src := srcTx.(*MdbxTx)
+
+	for _, name := range bucketSlice(db.buckets) {
+		cfg := db.buckets[name]
+		if cfg.DBI == NonExistingDBI {
+			continue
+		}
+		if err := copyTable(ctx, src, dst, name, cfg); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func copyTable(ctx context.Context, src *MdbxTx, dst *MdbxKV, name string, cfg kv.TableCfgItem) error {
+	flag := uint(mdbx.Append)
+	if cfg.Flags&kv.DupSort != 0 {
+		flag = mdbx.AppendDup
+	}
+
+	from, err := src.tx.OpenCursor(mdbx.DBI(cfg.DBI))
+	if err != nil {
+		return fmt.Errorf("table: %s, %w", name, err)
+	}
+	defer from.Close()
+
+	tx, err := dst.BeginRw(ctx)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if tx != nil {
+			tx.Rollback()
+		}
+	}()
+	var to *mdbx.Cursor
+	defer func() {
+		if to != nil {
+			to.Close()
+		}
+	}()
+	if to, err = tx.(*MdbxTx).tx.OpenCursor(mdbx.DBI(dst.buckets[name].DBI)); err != nil {
+		return fmt.Errorf("table: %s, %w", name, err)
+	}
+
+	i := 0
+	for k, v, err := from.Get(nil, nil, mdbx.First); ; k, v, err = from.Get(nil, nil, mdbx.Next) {
+		if err != nil {
+			if mdbx.IsNotFound(err) {
+				break
+			}
+			return fmt.Errorf("table: %s, %w", name, err)
+		}
+		if err = to.Put(k, v, flag); err != nil {
+			return fmt.Errorf("table: %s, %w", name, err)
+		}
+		i++
+		if i%10_000 != 0 {
+			continue
+		}
+		select {
+		case <-ctx.Done():
+			return errkind.Wrap(errkind.Canceled, ctx.Err())
+		default:
+		}
+		dirty, limit, err := tx.(*MdbxTx).SpaceDirty()
+		if err != nil {
+			return err
+		}
+		if dirty < limit/2 {
+			continue
+		}
+		to.Close()
+		to = nil
+		if err = tx.Commit(); err != nil {
+			return err
+		}
+		if tx, err = dst.BeginRw(ctx); err != nil {
+			tx = nil
+			return err
+		}
+		if to, err = tx.(*MdbxTx).tx.OpenCursor(mdbx.DBI(dst.buckets[name].DBI)); err != nil {
+			return fmt.Errorf("table: %s, %w", name, err)
+		}
+	}
+	to.Close()
+	to = nil
+	return tx.Commit()
+}
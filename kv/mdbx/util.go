@@ -22,15 +22,26 @@ import (
 	mdbxbind "github.com/torquem-ch/mdbx-go/mdbx"
 )
 
+func init() {
+	kv.RegisterDriver("mdbx", func(cfg kv.DriverCfg) (kv.RwDB, error) {
+		opts := NewMDBX(nil).Logger(cfg.Log).Label(cfg.Label).Path(cfg.Path).
+			WithTablessCfg(func(kv.TableCfg) kv.TableCfg { return cfg.Tables })
+		if cfg.Path == "" {
+			opts = opts.InMem()
+		}
+		return opts.Open()
+	})
+}
+
 func MustOpen(path string) kv.RwDB {
-	db, err := Open(path, log.New(), false)
+	db, err := Open(path, nil, false)
 	if err != nil {
 		panic(err)
 	}
 	return db
 }
 
-// Open - main method to open database.
+// Open - main method to open database. Nil logger - logging.Root()
 func Open(path string, logger log.Logger, readOnly bool) (kv.RwDB, error) {
 	var db kv.RwDB
 	var err error
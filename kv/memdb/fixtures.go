@@ -0,0 +1,230 @@
+/*
+   Copyright 2021 Erigon contributors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package memdb
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/ledgerwatch/erigon-lib/kv"
+)
+
+// Load - seeds tables of db by given literal data in one write transaction
+func Load(t testing.TB, db kv.RwDB, fixtures map[string][]kv.KV) {
+	t.Helper()
+	if err := db.Update(context.Background(), func(tx kv.RwTx) error {
+		for _, table := range sortedTables(fixtures) {
+			for _, p := range fixtures[table] {
+				if err := tx.Put(table, p.K, p.V); err != nil {
+					return fmt.Errorf("table: %s, %w", table, err)
+				}
+			}
+		}
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// Dump - content of given tables, result can be used as fixture by Load
+func Dump(t testing.TB, tx kv.Tx, tables ...string) map[string][]kv.KV {
+	t.Helper()
+	res := make(map[string][]kv.KV, len(tables))
+	for _, table := range tables {
+		pairs, err := dumpTable(tx, table)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res[table] = pairs
+	}
+	return res
+}
+
+// AssertContent - fails test if content of tables listed in expected is different from expected.
+// Failure message has one line per difference, see TableDiff.String
+func AssertContent(t testing.TB, db kv.RoDB, expected map[string][]kv.KV) {
+	t.Helper()
+	var actual map[string][]kv.KV
+	if err := db.View(context.Background(), func(tx kv.Tx) error {
+		actual = Dump(t, tx, sortedTables(expected)...)
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	var lines []string
+	for _, table := range sortedTables(expected) {
+		d := diffPairs(sortedPairs(expected[table]), actual[table])
+		if d.Empty() {
+			continue
+		}
+		for _, l := range strings.Split(d.String(), "\n") {
+			lines = append(lines, table+": "+l)
+		}
+	}
+	if len(lines) > 0 {
+		t.Errorf("unexpected db content:\n%s", strings.Join(lines, "\n"))
+	}
+}
+
+// Change - value of key replaced
+type Change struct {
+	K, Old, New []byte
+}
+
+// TableDiff - what must be applied to one table content to get another one.
+// Key which has exactly 1 value on both sides is reported as Changed, otherwise
+// (for example DupSort tables with many values per key) values are reported as Removed/Added.
+type TableDiff struct {
+	Added   []kv.KV
+	Removed []kv.KV
+	Changed []Change
+}
+
+func (d TableDiff) Empty() bool {
+	return len(d.Added) == 0 && len(d.Removed) == 0 && len(d.Changed) == 0
+}
+
+// String - one line per entry: "- k: v" removed, "+ k: v" added, "~ k: old -> new" changed
+func (d TableDiff) String() string {
+	var lines []string
+	for _, p := range d.Removed {
+		lines = append(lines, fmt.Sprintf("- %x: %x", p.K, p.V))
+	}
+	for _, p := range d.Added {
+		lines = append(lines, fmt.Sprintf("+ %x: %x", p.K, p.V))
+	}
+	for _, c := range d.Changed {
+		lines = append(lines, fmt.Sprintf("~ %x: %x -> %x", c.K, c.Old, c.New))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// Diff - difference of given tables between a and b. Tables without difference are not in result,
+// so empty result means equal content. Useful to assert exactly what some function wrote:
+// fork db by Snapshot before call and compare it with db after call.
+func Diff(a, b kv.Tx, tables ...string) (map[string]TableDiff, error) {
+	res := map[string]TableDiff{}
+	for _, table := range tables {
+		aPairs, err := dumpTable(a, table)
+		if err != nil {
+			return nil, err
+		}
+		bPairs, err := dumpTable(b, table)
+		if err != nil {
+			return nil, err
+		}
+		if d := diffPairs(aPairs, bPairs); !d.Empty() {
+			res[table] = d
+		}
+	}
+	return res, nil
+}
+
+func dumpTable(tx kv.Tx, table string) (res []kv.KV, err error) {
+	if err := tx.ForEach(table, nil, func(k, v []byte) error {
+		res = append(res, kv.KV{K: copyBytes(k), V: copyBytes(v)})
+		return nil
+	}); err != nil {
+		return nil, fmt.Errorf("table: %s, %w", table, err)
+	}
+	return res, nil
+}
+
+// diffPairs - merge-join of 2 sorted lists, key by key
+func diffPairs(a, b []kv.KV) (res TableDiff) {
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		var c int
+		switch {
+		case i == len(a):
+			c = 1
+		case j == len(b):
+			c = -1
+		default:
+			c = bytes.Compare(a[i].K, b[j].K)
+		}
+		if c < 0 {
+			res.Removed = append(res.Removed, a[i])
+			i++
+			continue
+		}
+		if c > 0 {
+			res.Added = append(res.Added, b[j])
+			j++
+			continue
+		}
+		iTo, jTo := sameKey(a, i), sameKey(b, j)
+		if iTo-i == 1 && jTo-j == 1 {
+			if !bytes.Equal(a[i].V, b[j].V) {
+				res.Changed = append(res.Changed, Change{K: a[i].K, Old: a[i].V, New: b[j].V})
+			}
+			i, j = iTo, jTo
+			continue
+		}
+		for i < iTo || j < jTo { // values of same key are sorted
+			switch {
+			case j == jTo || (i < iTo && bytes.Compare(a[i].V, b[j].V) < 0):
+				res.Removed = append(res.Removed, a[i])
+				i++
+			case i == iTo || bytes.Compare(a[i].V, b[j].V) > 0:
+				res.Added = append(res.Added, b[j])
+				j++
+			default:
+				i++
+				j++
+			}
+		}
+	}
+	return res
+}
+
+// sameKey - end of range of pairs with same key as pairs[from]
+func sameKey(pairs []kv.KV, from int) int {
+	to := from + 1
+	for to < len(pairs) && bytes.Equal(pairs[to].K, pairs[from].K) {
+		to++
+	}
+	return to
+}
+
+func sortedPairs(pairs []kv.KV) []kv.KV {
+	res := append([]kv.KV{}, pairs...)
+	sort.SliceStable(res, func(i, j int) bool {
+		if c := bytes.Compare(res[i].K, res[j].K); c != 0 {
+			return c < 0
+		}
+		return bytes.Compare(res[i].V, res[j].V) < 0
+	})
+	return res
+}
+
+func sortedTables(m map[string][]kv.KV) []string {
+	res := make([]string, 0, len(m))
+	for table := range m {
+		res = append(res, table)
+	}
+	sort.Strings(res)
+	return res
+}
+
+func copyBytes(b []byte) []byte {
+	return append(make([]byte, 0, len(b)), b...)
+}
@@ -0,0 +1,104 @@
+/*
+   Copyright 2021 Erigon contributors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package memdb_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/ledgerwatch/erigon-lib/kv"
+	"github.com/ledgerwatch/erigon-lib/kv/memdb"
+	"github.com/stretchr/testify/require"
+)
+
+type recordingT struct {
+	testing.TB
+	errors []string
+}
+
+func (t *recordingT) Errorf(format string, args ...interface{}) {
+	t.errors = append(t.errors, fmt.Sprintf(format, args...))
+}
+
+func TestLoadAndAssertContent(t *testing.T) {
+	db := memdb.NewTestDB(t)
+	fixtures := map[string][]kv.KV{
+		kv.HeaderNumber:     {{K: []byte{2}, V: []byte{20}}, {K: []byte{1}, V: []byte{10}}},
+		kv.AccountChangeSet: {{K: []byte{1}, V: []byte{2}}, {K: []byte{1}, V: []byte{1}}},
+	}
+	memdb.Load(t, db, fixtures)
+	memdb.AssertContent(t, db, fixtures)
+
+	require.NoError(t, db.View(context.Background(), func(tx kv.Tx) error {
+		dump := memdb.Dump(t, tx, kv.HeaderNumber)
+		require.Equal(t, []kv.KV{{K: []byte{1}, V: []byte{10}}, {K: []byte{2}, V: []byte{20}}}, dump[kv.HeaderNumber])
+		return nil
+	}))
+
+	rec := &recordingT{TB: t}
+	memdb.AssertContent(rec, db, map[string][]kv.KV{
+		kv.HeaderNumber: {{K: []byte{1}, V: []byte{11}}, {K: []byte{3}, V: []byte{30}}},
+	})
+	require.Equal(t, []string{"unexpected db content:\n" +
+		kv.HeaderNumber + ": - 03: 1e\n" +
+		kv.HeaderNumber + ": + 02: 14\n" +
+		kv.HeaderNumber + ": ~ 01: 0b -> 0a"}, rec.errors)
+}
+
+func TestDiff(t *testing.T) {
+	ctx := context.Background()
+	before := memdb.NewTestDB(t)
+	memdb.Load(t, before, map[string][]kv.KV{
+		kv.HeaderNumber:     {{K: []byte{1}, V: []byte{10}}, {K: []byte{2}, V: []byte{20}}},
+		kv.AccountChangeSet: {{K: []byte{1}, V: []byte{1}}, {K: []byte{1}, V: []byte{2}}},
+	})
+	after := memdb.Snapshot(t, before)
+	require.NoError(t, after.Update(ctx, func(tx kv.RwTx) error {
+		require.NoError(t, tx.Put(kv.HeaderNumber, []byte{1}, []byte{11}))
+		require.NoError(t, tx.Delete(kv.HeaderNumber, []byte{2}, nil))
+		require.NoError(t, tx.Put(kv.HeaderNumber, []byte{3}, []byte{30}))
+		require.NoError(t, tx.Delete(kv.AccountChangeSet, []byte{1}, []byte{1}))
+		require.NoError(t, tx.Put(kv.AccountChangeSet, []byte{1}, []byte{3}))
+		return nil
+	}))
+
+	aTx, err := before.BeginRo(ctx)
+	require.NoError(t, err)
+	defer aTx.Rollback()
+	bTx, err := after.BeginRo(ctx)
+	require.NoError(t, err)
+	defer bTx.Rollback()
+
+	d, err := memdb.Diff(aTx, bTx, kv.HeaderNumber, kv.AccountChangeSet, kv.Code)
+	require.NoError(t, err)
+	require.Equal(t, map[string]memdb.TableDiff{
+		kv.HeaderNumber: {
+			Added:   []kv.KV{{K: []byte{3}, V: []byte{30}}},
+			Removed: []kv.KV{{K: []byte{2}, V: []byte{20}}},
+			Changed: []memdb.Change{{K: []byte{1}, Old: []byte{10}, New: []byte{11}}},
+		},
+		kv.AccountChangeSet: {
+			Added:   []kv.KV{{K: []byte{1}, V: []byte{3}}},
+			Removed: []kv.KV{{K: []byte{1}, V: []byte{1}}},
+		},
+	}, d)
+
+	d, err = memdb.Diff(aTx, aTx, kv.HeaderNumber, kv.AccountChangeSet)
+	require.NoError(t, err)
+	require.Empty(t, d)
+}
@@ -18,16 +18,72 @@ package memdb
 
 import (
 	"context"
+	"fmt"
 	"testing"
 
+	"github.com/c2h5oh/datasize"
+	"github.com/ledgerwatch/erigon-lib/common/logging"
 	"github.com/ledgerwatch/erigon-lib/kv"
 	"github.com/ledgerwatch/erigon-lib/kv/mdbx"
-	"github.com/ledgerwatch/log/v3"
 )
 
-func New() kv.RwDB {
-	logger := log.New() //TODO: move higher
-	return mdbx.NewMDBX(logger).InMem().MustOpen()
+// Option - customizes in-memory db, applied on top of defaults
+type Option func(opts mdbx.MdbxOpts) mdbx.MdbxOpts
+
+func WithPageSize(sz uint64) Option {
+	return func(opts mdbx.MdbxOpts) mdbx.MdbxOpts { return opts.PageSize(sz) }
+}
+
+func WithMapSize(sz datasize.ByteSize) Option {
+	return func(opts mdbx.MdbxOpts) mdbx.MdbxOpts { return opts.MapSize(sz) }
+}
+
+func WithLabel(label kv.Label) Option {
+	return func(opts mdbx.MdbxOpts) mdbx.MdbxOpts { return opts.Label(label) }
+}
+
+// WithOnMapFull - f is called when write fails with kv.ErrMapFull, together with WithMapSize
+// it makes size-bounded db which fails predictably under memory pressure
+func WithOnMapFull(f func(label kv.Label)) Option {
+	return func(opts mdbx.MdbxOpts) mdbx.MdbxOpts { return opts.OnMapFull(f) }
+}
+
+// WithLogger - logs of db go to logger instead of logging.Root()
+func WithLogger(logger logging.Logger) Option {
+	return func(opts mdbx.MdbxOpts) mdbx.MdbxOpts { return opts.Logger(logger) }
+}
+
+func New(options ...Option) kv.RwDB {
+	return NewWithCfg(kv.ChaindataTablesCfg, options...)
+}
+
+// NewWithCfg - in-memory db with given tables instead of default ones
+func NewWithCfg(cfg kv.TableCfg, options ...Option) kv.RwDB {
+	opts := mdbx.NewMDBX(nil).InMem().WithTablessCfg(func(defaultBuckets kv.TableCfg) kv.TableCfg { return cfg })
+	for _, o := range options {
+		opts = o(opts)
+	}
+	return opts.MustOpen()
+}
+
+// Clone - independent copy of db: tables, options and all committed data
+func Clone(db kv.RwDB) (kv.RwDB, error) {
+	mdb, ok := db.(*mdbx.MdbxKV)
+	if !ok {
+		return nil, fmt.Errorf("memdb.Clone: unsupported db type %T", db)
+	}
+	return mdb.Clone(context.Background())
+}
+
+// Snapshot - clone of prepared fixture db, closed at the end of test.
+// Use it to fork one fixture per subtest instead of re-building it.
+func Snapshot(t testing.TB, db kv.RwDB) kv.RwDB {
+	clone, err := Clone(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(clone.Close)
+	return clone
 }
 
 func NewTestDB(t testing.TB) kv.RwDB {
@@ -36,8 +92,7 @@ func NewTestDB(t testing.TB) kv.RwDB {
 	return db
 }
 func NewTestPoolDB(t testing.TB) kv.RwDB {
-	logger := log.New() //TODO: move higher
-	db := mdbx.NewMDBX(logger).InMem().WithTablessCfg(func(defaultBuckets kv.TableCfg) kv.TableCfg { return kv.TxpoolTablesCfg }).MustOpen()
+	db := NewWithCfg(kv.TxpoolTablesCfg)
 	t.Cleanup(db.Close)
 	return db
 }
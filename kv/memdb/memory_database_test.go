@@ -0,0 +1,123 @@
+/*
+   Copyright 2021 Erigon contributors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package memdb_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/c2h5oh/datasize"
+	"github.com/ledgerwatch/erigon-lib/common/errkind"
+	"github.com/ledgerwatch/erigon-lib/kv"
+	"github.com/ledgerwatch/erigon-lib/kv/mdbx"
+	"github.com/ledgerwatch/erigon-lib/kv/memdb"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewWithCfg(t *testing.T) {
+	require := require.New(t)
+	cfg := kv.TableCfg{
+		"Plain":  {},
+		"Dupped": {Flags: kv.DupSort},
+	}
+	db := memdb.NewWithCfg(cfg, memdb.WithPageSize(8*1024), memdb.WithMapSize(32*datasize.MB), memdb.WithLabel(kv.SentryDB))
+	defer db.Close()
+
+	require.NoError(db.Update(context.Background(), func(tx kv.RwTx) error {
+		buckets, err := tx.ListBuckets()
+		require.NoError(err)
+		require.ElementsMatch([]string{"Plain", "Dupped"}, buckets)
+
+		require.NoError(tx.Put("Dupped", []byte("k"), []byte("1")))
+		require.NoError(tx.Put("Dupped", []byte("k"), []byte("2")))
+		c, err := tx.CursorDupSort("Dupped")
+		require.NoError(err)
+		defer c.Close()
+		_, _, err = c.SeekExact([]byte("k"))
+		require.NoError(err)
+		cnt, err := c.CountDuplicates()
+		require.NoError(err)
+		require.Equal(uint64(2), cnt)
+
+		st, err := tx.(*mdbx.MdbxTx).BucketStat("Dupped")
+		require.NoError(err)
+		require.Equal(uint(8*1024), st.PSize)
+		return nil
+	}))
+}
+
+func TestSnapshot(t *testing.T) {
+	ctx := context.Background()
+	fixture := memdb.NewTestDB(t)
+	require.NoError(t, fixture.Update(ctx, func(tx kv.RwTx) error {
+		if err := tx.Put(kv.HeaderNumber, []byte("a"), []byte("1")); err != nil {
+			return err
+		}
+		return tx.Put(kv.AccountChangeSet, []byte("b"), []byte("2"))
+	}))
+
+	for _, name := range []string{"first", "second"} {
+		t.Run(name, func(t *testing.T) {
+			db := memdb.Snapshot(t, fixture)
+			require.NoError(t, db.Update(ctx, func(tx kv.RwTx) error {
+				v, err := tx.GetOne(kv.HeaderNumber, []byte("a"))
+				require.NoError(t, err)
+				require.Equal(t, []byte("1"), v)
+				v, err = tx.GetOne(kv.AccountChangeSet, []byte("b"))
+				require.NoError(t, err)
+				require.Equal(t, []byte("2"), v)
+				// changes of one subtest must not leak into fixture and other subtests
+				has, err := tx.Has(kv.HeaderNumber, []byte(name))
+				require.NoError(t, err)
+				require.False(t, has)
+				return tx.Put(kv.HeaderNumber, []byte(name), []byte("x"))
+			}))
+		})
+	}
+	require.NoError(t, fixture.View(ctx, func(tx kv.Tx) error {
+		has, err := tx.Has(kv.HeaderNumber, []byte("first"))
+		require.NoError(t, err)
+		require.False(t, has)
+		return nil
+	}))
+}
+
+func TestMapFull(t *testing.T) {
+	var notified []kv.Label
+	db := memdb.New(memdb.WithMapSize(2*datasize.MB), memdb.WithLabel(kv.TxPoolDB), memdb.WithOnMapFull(func(label kv.Label) {
+		notified = append(notified, label)
+	}))
+	defer db.Close()
+
+	err := db.Update(context.Background(), func(tx kv.RwTx) error {
+		for i := 0; i < 1_000; i++ {
+			if err := tx.Put(kv.HeaderNumber, []byte{byte(i >> 8), byte(i)}, make([]byte, 4*1024)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	require.True(t, errors.Is(err, kv.ErrMapFull), "%v", err)
+	require.True(t, errors.Is(err, errkind.TooBig), "%v", err)
+	require.Equal(t, []kv.Label{kv.TxPoolDB}, notified)
+
+	// db still usable after failure
+	require.NoError(t, db.Update(context.Background(), func(tx kv.RwTx) error {
+		return tx.Put(kv.HeaderNumber, []byte{1}, []byte{1})
+	}))
+}
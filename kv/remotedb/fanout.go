@@ -0,0 +1,423 @@
+/*
+   Copyright 2021 Erigon contributors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package remotedb
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/ledgerwatch/erigon-lib/gointerfaces/remote"
+	"github.com/ledgerwatch/erigon-lib/gointerfaces/types"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/emptypb"
+)
+
+const (
+	DefaultHedgeDelay = 50 * time.Millisecond
+	maxUpstreams      = 1 << upstreamBits
+	upstreamBits      = 8 // ids of server-side objects (views, subscriptions) carry index of upstream in low bits
+)
+
+// FanOut - remote.KVClient over several KV servers: primary and replicas. Use it as client of NewRemote.
+// Stateful calls (Tx, StateChanges, pinned views) stick to one server: primary if it's healthy,
+// otherwise healthy replica with lowest latency. Tx stream fails over to next server if its server is
+// unavailable before first reply. Unary reads are hedged: if server doesn't reply during hedge delay -
+// same request is sent to next one, first reply wins.
+type FanOut struct {
+	upstreams  []*upstream
+	hedgeDelay time.Duration
+
+	stopChecks context.CancelFunc
+	wg         sync.WaitGroup
+}
+
+type upstream struct {
+	idx    int
+	client remote.KVClient
+
+	lock    sync.Mutex
+	healthy bool
+	latency time.Duration // moving average of health check latency
+}
+
+var _ remote.KVClient = &FanOut{}
+
+func NewFanOut(primary remote.KVClient, replicas ...remote.KVClient) *FanOut {
+	if len(replicas)+1 > maxUpstreams {
+		panic(fmt.Sprintf("fan-out supports up to %d upstreams", maxUpstreams))
+	}
+	f := &FanOut{hedgeDelay: DefaultHedgeDelay}
+	for i, c := range append([]remote.KVClient{primary}, replicas...) {
+		f.upstreams = append(f.upstreams, &upstream{idx: i, client: c, healthy: true})
+	}
+	return f
+}
+
+// SetHedgeDelay - how long to wait reply of one server before sending same request to next one
+func (f *FanOut) SetHedgeDelay(d time.Duration) *FanOut {
+	f.hedgeDelay = d
+	return f
+}
+
+// StartHealthChecks - checks all servers by Health method in background, until Close
+func (f *FanOut) StartHealthChecks(every time.Duration) *FanOut {
+	ctx, cancel := context.WithCancel(context.Background())
+	f.stopChecks = cancel
+	for _, u := range f.upstreams {
+		f.wg.Add(1)
+		go func(u *upstream) {
+			defer f.wg.Done()
+			ticker := time.NewTicker(every)
+			defer ticker.Stop()
+			for {
+				u.check(ctx, every)
+				select {
+				case <-ctx.Done():
+					return
+				case <-ticker.C:
+				}
+			}
+		}(u)
+	}
+	return f
+}
+
+func (f *FanOut) Close() {
+	if f.stopChecks != nil {
+		f.stopChecks()
+	}
+	f.wg.Wait()
+}
+
+func (u *upstream) check(parent context.Context, timeout time.Duration) {
+	ctx, cancel := context.WithTimeout(parent, timeout)
+	defer cancel()
+	start := time.Now()
+	reply, err := u.client.Health(ctx, &emptypb.Empty{})
+	if status.Code(err) == codes.Unimplemented { // older server
+		_, err = u.client.Version(ctx, &emptypb.Empty{})
+		reply = &remote.HealthReply{DbOpen: err == nil}
+	}
+	took := time.Since(start)
+	if parent.Err() != nil {
+		return // stopped, not a failure of server
+	}
+	u.lock.Lock()
+	defer u.lock.Unlock()
+	u.healthy = err == nil && reply.DbOpen
+	if u.latency == 0 {
+		u.latency = took
+	} else {
+		u.latency = (4*u.latency + took) / 5
+	}
+}
+
+// failed - passive health check: server is unavailable until next successful check
+func (u *upstream) failed(err error) {
+	if status.Code(err) != codes.Unavailable {
+		return
+	}
+	u.lock.Lock()
+	defer u.lock.Unlock()
+	u.healthy = false
+}
+
+// ordered - upstreams in order of preference: healthy first (primary, then by latency), unhealthy are last resort
+func (f *FanOut) ordered() []*upstream {
+	type state struct {
+		u       *upstream
+		healthy bool
+		latency time.Duration
+	}
+	states := make([]state, len(f.upstreams))
+	for i, u := range f.upstreams {
+		u.lock.Lock()
+		states[i] = state{u: u, healthy: u.healthy, latency: u.latency}
+		u.lock.Unlock()
+	}
+	sort.SliceStable(states, func(i, j int) bool {
+		a, b := states[i], states[j]
+		if a.healthy != b.healthy {
+			return a.healthy
+		}
+		if a.u.idx == 0 || b.u.idx == 0 {
+			return a.u.idx == 0
+		}
+		return a.latency < b.latency
+	})
+	res := make([]*upstream, len(states))
+	for i := range states {
+		res[i] = states[i].u
+	}
+	return res
+}
+
+// hedge - calls upstreams one by one, next one is called after hedge delay or after failure of previous one
+func (f *FanOut) hedge(ctx context.Context, call func(ctx context.Context, c remote.KVClient) (interface{}, error)) (interface{}, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel() // cancels slower calls
+	type result struct {
+		reply interface{}
+		err   error
+	}
+	ups := f.ordered()
+	results := make(chan result, len(ups))
+	sent := 0
+	launch := func() {
+		u := ups[sent]
+		sent++
+		go func() {
+			reply, err := call(ctx, u.client)
+			if err != nil {
+				u.failed(err)
+			}
+			results <- result{reply, err}
+		}()
+	}
+	timer := time.NewTimer(f.hedgeDelay)
+	defer timer.Stop()
+	launch()
+	var lastErr error
+	for received := 0; received < len(ups); {
+		select {
+		case r := <-results:
+			received++
+			if r.err == nil {
+				return r.reply, nil
+			}
+			lastErr = r.err
+			if sent < len(ups) {
+				launch()
+				timer.Reset(f.hedgeDelay)
+			}
+		case <-timer.C:
+			if sent < len(ups) {
+				launch()
+				timer.Reset(f.hedgeDelay)
+			}
+		}
+	}
+	return nil, lastErr
+}
+
+// sticky - calls upstreams in order of preference until one doesn't fail with codes.Unavailable
+func (f *FanOut) sticky(call func(u *upstream) error) error {
+	var err error
+	for _, u := range f.ordered() {
+		if err = call(u); err == nil || status.Code(err) != codes.Unavailable {
+			return err
+		}
+		u.failed(err)
+	}
+	return err
+}
+
+func (f *FanOut) byID(id uint64) (*upstream, uint64, error) {
+	idx := int(id % maxUpstreams)
+	if idx >= len(f.upstreams) {
+		return nil, 0, status.Errorf(codes.NotFound, "unknown id: %d", id)
+	}
+	return f.upstreams[idx], id >> upstreamBits, nil
+}
+
+func globalID(u *upstream, id uint64) uint64 { return id<<upstreamBits | uint64(u.idx) }
+
+func (f *FanOut) Version(ctx context.Context, in *emptypb.Empty, opts ...grpc.CallOption) (*types.VersionReply, error) {
+	reply, err := f.hedge(ctx, func(ctx context.Context, c remote.KVClient) (interface{}, error) { return c.Version(ctx, in, opts...) })
+	if err != nil {
+		return nil, err
+	}
+	return reply.(*types.VersionReply), nil
+}
+
+func (f *FanOut) Health(ctx context.Context, in *emptypb.Empty, opts ...grpc.CallOption) (*remote.HealthReply, error) {
+	reply, err := f.hedge(ctx, func(ctx context.Context, c remote.KVClient) (interface{}, error) { return c.Health(ctx, in, opts...) })
+	if err != nil {
+		return nil, err
+	}
+	return reply.(*remote.HealthReply), nil
+}
+
+// Tx - if stream reads pinned view - it goes to server of view, otherwise - to preferred server
+func (f *FanOut) Tx(ctx context.Context, opts ...grpc.CallOption) (remote.KV_TxClient, error) {
+	if md, ok := metadata.FromOutgoingContext(ctx); ok && len(md.Get(remote.ViewIDMetadataKey)) > 0 {
+		id, err := strconv.ParseUint(md.Get(remote.ViewIDMetadataKey)[0], 10, 64)
+		if err != nil {
+			return nil, status.Errorf(codes.InvalidArgument, "bad %s: %s", remote.ViewIDMetadataKey, err)
+		}
+		u, viewID, err := f.byID(id)
+		if err != nil {
+			return nil, err
+		}
+		u.lock.Lock()
+		healthy := u.healthy
+		u.lock.Unlock()
+		if !healthy { // views don't move between servers - no reason to wait for reconnect
+			return nil, status.Errorf(codes.FailedPrecondition, "server of view %d is unavailable", id)
+		}
+		md = md.Copy()
+		md.Set(remote.ViewIDMetadataKey, strconv.FormatUint(viewID, 10))
+		s, err := u.client.Tx(metadata.NewOutgoingContext(ctx, md), opts...)
+		if err != nil {
+			u.failed(err)
+			return nil, err
+		}
+		return &fanOutTx{KV_TxClient: s, u: u}, nil // view is on one server, no failover
+	}
+	ups := f.ordered()
+	stream := &fanOutTx{u: ups[0], next: ups[1:], replay: true, ctx: ctx, opts: opts}
+	if err := stream.failover(stream.open()); err != nil {
+		return nil, err
+	}
+	return stream, nil
+}
+
+// fanOutTx - until first reply stream has no state on server (snapshot, cursors): if server is unavailable -
+// stream is re-opened on next server and sent requests are repeated. After first reply failure marks
+// server unavailable, then reconnect of remoteTx goes to other server.
+type fanOutTx struct {
+	remote.KV_TxClient
+	u *upstream
+
+	next   []*upstream // servers to fail over
+	replay bool        // no reply received yet
+	sent   []*remote.Cursor
+	ctx    context.Context
+	opts   []grpc.CallOption
+}
+
+func (s *fanOutTx) open() error {
+	stream, err := s.u.client.Tx(s.ctx, s.opts...)
+	if err != nil {
+		return err
+	}
+	s.KV_TxClient = stream
+	for _, c := range s.sent {
+		if err := stream.Send(c); err != nil {
+			break // broken stream, error is returned by Recv
+		}
+	}
+	return nil
+}
+
+// failover - while server is unavailable and stream has no state on it - re-opens stream on next server
+func (s *fanOutTx) failover(err error) error {
+	for status.Code(err) == codes.Unavailable {
+		s.u.failed(err)
+		if !s.replay || len(s.next) == 0 {
+			return err
+		}
+		s.u, s.next = s.next[0], s.next[1:]
+		err = s.open()
+	}
+	return err
+}
+
+func (s *fanOutTx) Send(c *remote.Cursor) error {
+	if s.replay {
+		s.sent = append(s.sent, c)
+	}
+	return s.KV_TxClient.Send(c)
+}
+
+func (s *fanOutTx) Recv() (*remote.Pair, error) {
+	for {
+		pair, err := s.KV_TxClient.Recv()
+		if err == nil {
+			s.replay, s.sent, s.next = false, nil, nil
+			return pair, nil
+		}
+		if err = s.failover(err); err != nil {
+			return nil, err
+		}
+	}
+}
+
+func (f *FanOut) StateChanges(ctx context.Context, in *remote.StateChangeRequest, opts ...grpc.CallOption) (remote.KV_StateChangesClient, error) {
+	var stream remote.KV_StateChangesClient
+	err := f.sticky(func(u *upstream) error {
+		s, err := u.client.StateChanges(ctx, in, opts...)
+		if err != nil {
+			return err
+		}
+		stream = &fanOutStateChanges{KV_StateChangesClient: s, u: u}
+		return nil
+	})
+	return stream, err
+}
+
+type fanOutStateChanges struct {
+	remote.KV_StateChangesClient
+	u *upstream
+}
+
+func (s *fanOutStateChanges) Recv() (*remote.StateChange, error) {
+	sc, err := s.KV_StateChangesClient.Recv()
+	if err != nil {
+		return nil, err
+	}
+	sc.SubscriptionId = globalID(s.u, sc.SubscriptionId)
+	return sc, nil
+}
+
+func (f *FanOut) StateChangesAck(ctx context.Context, in *remote.StateChangeAck, opts ...grpc.CallOption) (*emptypb.Empty, error) {
+	u, id, err := f.byID(in.SubscriptionId)
+	if err != nil {
+		return nil, err
+	}
+	return u.client.StateChangesAck(ctx, &remote.StateChangeAck{SubscriptionId: id, Sequence: in.Sequence}, opts...)
+}
+
+// Pin - new view is pinned on preferred server. Attach to existing view (in.TxId != 0) is tried on all servers -
+// they have different state versions.
+func (f *FanOut) Pin(ctx context.Context, in *remote.PinRequest, opts ...grpc.CallOption) (*remote.PinReply, error) {
+	var reply *remote.PinReply
+	var err error
+	for _, u := range f.ordered() {
+		if reply, err = u.client.Pin(ctx, in, opts...); err == nil {
+			return &remote.PinReply{ViewId: globalID(u, reply.ViewId), TxId: reply.TxId}, nil
+		}
+		if c := status.Code(err); c != codes.Unavailable && !(c == codes.NotFound && in.TxId != 0) {
+			return nil, err
+		}
+		u.failed(err)
+	}
+	return nil, err
+}
+
+func (f *FanOut) Heartbeat(ctx context.Context, in *remote.ViewRequest, opts ...grpc.CallOption) (*emptypb.Empty, error) {
+	u, id, err := f.byID(in.ViewId)
+	if err != nil {
+		return nil, err
+	}
+	return u.client.Heartbeat(ctx, &remote.ViewRequest{ViewId: id}, opts...)
+}
+
+func (f *FanOut) Unpin(ctx context.Context, in *remote.ViewRequest, opts ...grpc.CallOption) (*emptypb.Empty, error) {
+	u, id, err := f.byID(in.ViewId)
+	if err != nil {
+		return nil, err
+	}
+	return u.client.Unpin(ctx, &remote.ViewRequest{ViewId: id}, opts...)
+}
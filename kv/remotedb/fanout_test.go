@@ -0,0 +1,122 @@
+/*
+   Copyright 2021 Erigon contributors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package remotedb_test
+
+import (
+	"context"
+	"io"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/ledgerwatch/erigon-lib/gointerfaces"
+	"github.com/ledgerwatch/erigon-lib/gointerfaces/remote"
+	"github.com/ledgerwatch/erigon-lib/gointerfaces/types"
+	"github.com/ledgerwatch/erigon-lib/kv"
+	"github.com/ledgerwatch/erigon-lib/kv/mdbx"
+	"github.com/ledgerwatch/erigon-lib/kv/remotedb"
+	"github.com/ledgerwatch/erigon-lib/kv/remotedbserver"
+	"github.com/ledgerwatch/log/v3"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/emptypb"
+)
+
+func TestFanOut(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("fix me on win please")
+	}
+
+	logger := log.New()
+	ctx := context.Background()
+	v := gointerfaces.VersionFromProto(remotedbserver.KvServiceAPIVersion)
+	var servers []*grpc.Server
+	var clients []remote.KVClient
+	for _, val := range []string{"primary", "replica"} {
+		db := mdbx.NewMDBX(logger).InMem().MustOpen()
+		defer db.Close()
+		require.NoError(t, db.Update(ctx, func(tx kv.RwTx) error { return tx.Put(kv.HeaderNumber, []byte("k"), []byte(val)) }))
+		client, grpcServer := serve(t, remotedbserver.NewKvServer(db))
+		servers, clients = append(servers, grpcServer), append(clients, client)
+	}
+
+	fanOut := remotedb.NewFanOut(clients[0], clients[1]).StartHealthChecks(20 * time.Millisecond)
+	defer fanOut.Close()
+	rdb, err := remotedb.NewRemote(v, logger, fanOut).Open()
+	require.NoError(t, err)
+	get := func(view func(context.Context, func(kv.Tx) error) error) (string, error) {
+		var res []byte
+		err := view(ctx, func(tx kv.Tx) error {
+			v, err := tx.GetOne(kv.HeaderNumber, []byte("k"))
+			res = v
+			return err
+		})
+		return string(res), err
+	}
+	res, err := get(rdb.View)
+	require.NoError(t, err)
+	require.Equal(t, "primary", res)
+	pinned, err := rdb.Pin(ctx, 0, 300*time.Millisecond) // short ttl: view of stopped server must not block db.Close
+	require.NoError(t, err)
+	res, err = get(pinned.View)
+	require.NoError(t, err)
+	require.Equal(t, "primary", res)
+
+	// primary is down: reads go to replica, views of primary are lost
+	servers[0].Stop()
+	res, err = get(rdb.View)
+	require.NoError(t, err)
+	require.Equal(t, "replica", res)
+	_, err = get(pinned.View)
+	require.Error(t, err)
+	_ = pinned.Unpin(ctx)
+
+	// failover of Tx stream: server fails before first reply, transaction doesn't reconnect
+	restarting := &remote.KVClientMock{
+		VersionFunc: func(ctx context.Context, in *emptypb.Empty, opts ...grpc.CallOption) (*types.VersionReply, error) {
+			return clients[1].Version(ctx, in, opts...)
+		},
+		TxFunc: func(ctx context.Context, opts ...grpc.CallOption) (remote.KV_TxClient, error) { return brokenTx{}, nil },
+	}
+	noChecks := remotedb.NewFanOut(restarting, clients[1])
+	noReconnect, err := remotedb.NewRemote(v, logger, noChecks).Open()
+	require.NoError(t, err)
+	res, err = get(noReconnect.View)
+	require.NoError(t, err)
+	require.Equal(t, "replica", res)
+
+	// hedging: slow server doesn't slow down reads
+	slow := &remote.KVClientMock{VersionFunc: func(ctx context.Context, in *emptypb.Empty, opts ...grpc.CallOption) (*types.VersionReply, error) {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}}
+	hedged := remotedb.NewFanOut(slow, clients[1]).SetHedgeDelay(10 * time.Millisecond)
+	reply, err := hedged.Version(ctx, &emptypb.Empty{})
+	require.NoError(t, err)
+	require.Equal(t, v, gointerfaces.VersionFromProto(reply))
+	require.Equal(t, 1, len(slow.VersionCalls()))
+}
+
+// brokenTx - stream of server which is unavailable
+type brokenTx struct{ remote.KV_TxClient }
+
+func (brokenTx) Send(*remote.Cursor) error { return io.EOF }
+func (brokenTx) Recv() (*remote.Pair, error) {
+	return nil, status.Error(codes.Unavailable, "server is restarting")
+}
@@ -6,7 +6,10 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"sync"
 
+	"github.com/ledgerwatch/erigon-lib/common/errkind"
+	"github.com/ledgerwatch/erigon-lib/common/logging"
 	"github.com/ledgerwatch/erigon-lib/gointerfaces"
 	"github.com/ledgerwatch/erigon-lib/gointerfaces/remote"
 	"github.com/ledgerwatch/erigon-lib/kv"
@@ -25,13 +28,23 @@ type remoteOpts struct {
 	version     gointerfaces.Version
 	remoteKV    remote.KVClient
 	log         log.Logger
+	nextBatch   uint32
+
+	reconnectAttempts int
 }
 
+// RemoteKV - kv.RoDB over KV gRPC service.
+// Transactions survive transient failures of server by reconnect (see ReconnectAttempts), but reconnected
+// transaction reads newer snapshot of db than before failure.
 type RemoteKV struct {
 	remoteKV remote.KVClient
-	log      log.Logger
+	log      logging.Logger
 	buckets  kv.TableCfg
 	opts     remoteOpts
+
+	versionLock    sync.Mutex
+	versionChecked bool
+	server         gointerfaces.Version // version reported by server, known after version check
 }
 
 type remoteTx struct {
@@ -39,6 +52,7 @@ type remoteTx struct {
 	ctx                context.Context
 	streamCancelFn     context.CancelFunc
 	db                 *RemoteKV
+	nextBatch          uint32 // 0 - server doesn't support batched NEXT
 	cursors            []*remoteCursor
 	statelessCursors   map[string]kv.Cursor
 	streamingRequested bool
@@ -51,6 +65,15 @@ type remoteCursor struct {
 	bucketName string
 	bucketCfg  kv.TableCfgItem
 	id         uint32
+
+	// batched Next: pairs received from server but not returned yet. Server cursor is ahead of client -
+	// it's on last pair of batch (or after end of table if eof)
+	bufK, bufV   [][]byte
+	eof          bool
+	lastK, lastV []byte // last pair returned by batched Next
+
+	posK, posV []byte // confirmed position of server's cursor - to restore it after reconnect
+	lost       error  // position can't be restored after reconnect - relative operations fail until cursor re-positioned
 }
 
 type remoteCursorDupSort struct {
@@ -66,11 +89,31 @@ func (opts remoteOpts) WithBucketsConfig(f mdbx.TableCfgFunc) remoteOpts {
 	return opts
 }
 
+// NextBatch - cursor.Next requests n pairs per round-trip and returns them from buffer.
+// Other cursor operations re-position server's cursor if it's ahead of client.
+// Ignored if server's version doesn't support batched NEXT.
+func (opts remoteOpts) NextBatch(n uint32) remoteOpts {
+	opts.nextBatch = n
+	return opts
+}
+
+// ReconnectAttempts - after transient failure of server (restart, network) transaction re-opens stream and cursors
+// at their last positions. Default: DefaultReconnectAttempts. 0 - disables reconnect: for readers which need
+// consistent snapshot, see RemoteKV.
+func (opts remoteOpts) ReconnectAttempts(n int) remoteOpts {
+	opts.reconnectAttempts = n
+	return opts
+}
+
 func (opts remoteOpts) Open() (*RemoteKV, error) {
+	logger := logging.Root()
+	if opts.log != nil {
+		logger = logging.FromLog(opts.log)
+	}
 	db := &RemoteKV{
 		opts:     opts,
 		remoteKV: opts.remoteKV,
-		log:      log.New("remote_db", opts.DialAddress),
+		log:      logger.New("remote_db", opts.DialAddress),
 		buckets:  kv.TableCfg{},
 	}
 	customBuckets := opts.bucketsCfg(kv.ChaindataTablesCfg)
@@ -93,38 +136,100 @@ func (opts remoteOpts) MustOpen() kv.RwDB {
 // version parameters represent the version the KV client is expecting,
 // compatibility check will be performed when the KV connection opens
 func NewRemote(v gointerfaces.Version, logger log.Logger, remoteKV remote.KVClient) remoteOpts {
-	return remoteOpts{bucketsCfg: mdbx.WithChaindataTables, version: v, log: logger, remoteKV: remoteKV}
+	return remoteOpts{bucketsCfg: mdbx.WithChaindataTables, version: v, log: logger, remoteKV: remoteKV, reconnectAttempts: DefaultReconnectAttempts}
 }
 
 func (db *RemoteKV) AllBuckets() kv.TableCfg {
 	return db.buckets
 }
 
-func (db *RemoteKV) EnsureVersionCompatibility() bool {
-	versionReply, err := db.remoteKV.Version(context.Background(), &emptypb.Empty{}, grpc.WaitForReady(true))
+// VersionError - client and server interfaces are incompatible, see gointerfaces.EnsureVersion
+type VersionError = gointerfaces.VersionError
+
+// CheckVersion - returns *VersionError if server's interface is incompatible with client's one
+func (db *RemoteKV) CheckVersion(ctx context.Context, opts ...grpc.CallOption) error {
+	_, err := db.checkVersion(ctx, opts...)
+	return err
+}
+
+func (db *RemoteKV) checkVersion(ctx context.Context, opts ...grpc.CallOption) (gointerfaces.Version, error) {
+	versionReply, err := db.remoteKV.Version(ctx, &emptypb.Empty{}, opts...)
 	if err != nil {
-		db.log.Error("getting Version", "error", err)
-		return false
+		return gointerfaces.Version{}, fmt.Errorf("getting remote KV version: %w", err)
 	}
+	server := gointerfaces.VersionFromProto(versionReply)
 	if !gointerfaces.EnsureVersion(db.opts.version, versionReply) {
-		db.log.Error("incompatible interface versions", "client", db.opts.version.String(),
-			"server", fmt.Sprintf("%d.%d.%d", versionReply.Major, versionReply.Minor, versionReply.Patch))
+		return server, &VersionError{Service: gointerfaces.KVService.Name, Client: db.opts.version, Server: server}
+	}
+	return server, nil
+}
+
+func (db *RemoteKV) EnsureVersionCompatibility() bool {
+	server, err := db.checkVersion(context.Background(), grpc.WaitForReady(true))
+	var versionErr *VersionError
+	if errors.As(err, &versionErr) {
+		db.log.Error("incompatible interface versions", "client", versionErr.Client.String(), "server", versionErr.Server.String())
+		return false
+	}
+	if err != nil {
+		db.log.Error("getting Version", "error", err)
 		return false
 	}
-	db.log.Info("interfaces compatible", "client", db.opts.version.String(),
-		"server", fmt.Sprintf("%d.%d.%d", versionReply.Major, versionReply.Minor, versionReply.Patch))
+	db.log.Info("interfaces compatible", "client", db.opts.version.String())
+	db.setVersionChecked(server)
 	return true
 }
 
+// ensureVersion - checks version once, before first transaction: to fail early with clear error instead of failing in the middle of request
+func (db *RemoteKV) ensureVersion(ctx context.Context) error {
+	db.versionLock.Lock()
+	defer db.versionLock.Unlock()
+	if db.versionChecked {
+		return nil
+	}
+	server, err := db.checkVersion(ctx)
+	if err != nil {
+		return err
+	}
+	db.versionChecked, db.server = true, server
+	return nil
+}
+
+func (db *RemoteKV) setVersionChecked(server gointerfaces.Version) {
+	db.versionLock.Lock()
+	defer db.versionLock.Unlock()
+	db.versionChecked, db.server = true, server
+}
+
+// nextBatch - size of batched NEXT, 0 if it's disabled or not supported by server
+func (db *RemoteKV) nextBatch() uint32 {
+	if db.opts.nextBatch <= 1 || !db.supports(gointerfaces.KVBatchedNext) {
+		return 0
+	}
+	return db.opts.nextBatch
+}
+
+// supports - feature is supported by both client and server, known after version check
+func (db *RemoteKV) supports(feature string) bool {
+	db.versionLock.Lock()
+	defer db.versionLock.Unlock()
+	client := gointerfaces.Service{Name: gointerfaces.KVService.Name, Version: db.opts.version, Features: gointerfaces.KVService.Features}
+	negotiated, err := client.Negotiate(db.server)
+	return err == nil && negotiated.Supports(feature)
+}
+
 func (db *RemoteKV) Close() {
 }
 
 func (db *RemoteKV) BeginRo(ctx context.Context) (kv.Tx, error) {
 	select {
 	case <-ctx.Done():
-		return nil, ctx.Err()
+		return nil, errkind.Wrap(errkind.Canceled, ctx.Err())
 	default:
 	}
+	if err := db.ensureVersion(ctx); err != nil {
+		return nil, err
+	}
 
 	streamCtx, streamCancelFn := context.WithCancel(ctx) // We create child context for the stream so we can cancel it to prevent leak
 	stream, err := db.remoteKV.Tx(streamCtx)
@@ -132,7 +237,24 @@ func (db *RemoteKV) BeginRo(ctx context.Context) (kv.Tx, error) {
 		streamCancelFn()
 		return nil, err
 	}
-	return &remoteTx{ctx: ctx, db: db, stream: stream, streamCancelFn: streamCancelFn}, nil
+	return &remoteTx{ctx: ctx, db: db, nextBatch: db.nextBatch(), stream: stream, streamCancelFn: streamCancelFn}, nil
+}
+
+func (db *RemoteKV) BeginTemporalRo(ctx context.Context) (kv.TemporalTx, error) {
+	tx, err := db.BeginRo(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return tx.(*remoteTx), nil
+}
+
+func (db *RemoteKV) ViewTemporal(ctx context.Context, f func(tx kv.TemporalTx) error) error {
+	tx, err := db.BeginTemporalRo(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	return f(tx)
 }
 
 func (db *RemoteKV) BeginRw(ctx context.Context) (kv.RwTx, error) {
@@ -192,64 +314,99 @@ func (tx *remoteTx) statelessCursor(bucket string) (kv.Cursor, error) {
 
 func (tx *remoteTx) BucketSize(name string) (uint64, error) { panic("not implemented") }
 
-// TODO: this must be optimized - and implemented as single command on server, with server-side buffered streaming
 func (tx *remoteTx) ForEach(bucket string, fromPrefix []byte, walker func(k, v []byte) error) error {
-	c, err := tx.Cursor(bucket)
+	return tx.streamRange(bucket, fromPrefix, nil, 0, walker)
+}
+
+func (tx *remoteTx) ForPrefix(bucket string, prefix []byte, walker func(k, v []byte) error) error {
+	to, ok := nextPrefix(prefix)
+	if !ok {
+		to = nil // prefix is empty or all 0xFF - till the end of table
+	}
+	return tx.streamRange(bucket, prefix, to, 0, walker)
+}
+
+func (tx *remoteTx) ForAmount(bucket string, fromPrefix []byte, amount uint32, walker func(k, v []byte) error) error {
+	if amount == 0 {
+		return nil
+	}
+	return tx.streamRange(bucket, fromPrefix, nil, amount, walker)
+}
+
+// streamRange - one RANGE request instead of round-trip per key: server streams batches of pairs until empty batch.
+// If walker returns error, rest of stream is still read - to keep tx usable.
+// After reconnect range is resumed from next key - if it's unambiguous: keys are unique or nothing received yet.
+func (tx *remoteTx) streamRange(bucket string, from, to []byte, limit uint32, walker func(k, v []byte) error) error {
+	cur, err := tx.Cursor(bucket)
 	if err != nil {
 		return err
 	}
-	defer c.Close()
+	defer cur.Close()
+	c := cur.(*remoteCursor)
 
-	for k, v, err := c.Seek(fromPrefix); k != nil; k, v, err = c.Next() {
-		if err != nil {
-			return err
-		}
-		if err := walker(k, v); err != nil {
-			return err
+	var walkErr, lastErr error
+	var lastK []byte
+	var received uint32
+	err = tx.retry(func() error {
+		if lastErr != nil && lastK != nil { // resume
+			if walkErr != nil || c.bucketCfg.Flags&kv.DupSort != 0 {
+				return noReconnect{lastErr}
+			}
+			from = append(append([]byte{}, lastK...), 0)
+			if limit > 0 {
+				if received >= limit {
+					return nil
+				}
+				limit -= received
+			}
+			received = 0
 		}
+		lastErr = c.rangeOnce(from, to, limit, func(k, v []byte) {
+			if walkErr == nil {
+				walkErr = walker(k, v)
+			}
+			lastK = k
+			received++
+		})
+		return lastErr
+	})
+	if err != nil {
+		return err
 	}
-	return nil
+	return walkErr
 }
 
-// TODO: this must be optimized - and implemented as single command on server, with server-side buffered streaming
-func (tx *remoteTx) ForPrefix(bucket string, prefix []byte, walker func(k, v []byte) error) error {
-	c, err := tx.Cursor(bucket)
-	if err != nil {
+func (c *remoteCursor) rangeOnce(from, to []byte, limit uint32, f func(k, v []byte)) error {
+	if err := c.stream.Send(&remote.Cursor{Cursor: c.id, Op: remote.Op_RANGE, K: from, ToK: to, Limit: limit}); err != nil && err != io.EOF {
 		return err
 	}
-	defer c.Close()
-
-	for k, v, err := c.Seek(prefix); k != nil; k, v, err = c.Next() {
+	c.tx.streamingRequested = true
+	for {
+		batch, err := c.stream.Recv()
 		if err != nil {
 			return err
 		}
-		if !bytes.HasPrefix(k, prefix) {
+		if len(batch.Keys) == 0 {
 			break
 		}
-		if err := walker(k, v); err != nil {
-			return err
+		for i := range batch.Keys {
+			f(batch.Keys[i], batch.Values[i])
 		}
 	}
+	c.tx.streamingRequested = false
 	return nil
 }
 
-func (tx *remoteTx) ForAmount(bucket string, fromPrefix []byte, amount uint32, walker func(k, v []byte) error) error {
-	c, err := tx.Cursor(bucket)
-	if err != nil {
-		return err
-	}
-	defer c.Close()
-
-	for k, v, err := c.Seek(fromPrefix); k != nil && amount > 0; k, v, err = c.Next() {
-		if err != nil {
-			return err
-		}
-		if err := walker(k, v); err != nil {
-			return err
+// nextPrefix - smallest key which is greater than all keys with given prefix
+func nextPrefix(prefix []byte) ([]byte, bool) {
+	next := append([]byte{}, prefix...)
+	for i := len(next) - 1; i >= 0; i-- {
+		if next[i] != 0xFF {
+			next[i]++
+			return next[:i+1], true
 		}
-		amount--
 	}
-	return nil
+	return nil, false
 }
 
 func (tx *remoteTx) GetOne(bucket string, key []byte) (val []byte, err error) {
@@ -284,16 +441,21 @@ func (c *remoteCursor) Prev() ([]byte, []byte, error) {
 func (tx *remoteTx) Cursor(bucket string) (kv.Cursor, error) {
 	b := tx.db.buckets[bucket]
 	c := &remoteCursor{tx: tx, ctx: tx.ctx, bucketName: bucket, bucketCfg: b, stream: tx.stream}
-	tx.cursors = append(tx.cursors, c)
-	if err := c.stream.Send(&remote.Cursor{Op: remote.Op_OPEN, BucketName: c.bucketName}); err != nil {
+	if err := tx.retry(c.open); err != nil {
 		return nil, err
 	}
-	msg, err := c.stream.Recv()
+	tx.cursors = append(tx.cursors, c)
+	return c, nil
+}
+
+func (c *remoteCursor) open() error {
+	c.stream = c.tx.stream
+	msg, err := c.sendRecv(&remote.Cursor{Op: remote.Op_OPEN, BucketName: c.bucketName})
 	if err != nil {
-		return nil, err
+		return err
 	}
 	c.id = msg.CursorID
-	return c, nil
+	return nil
 }
 
 func (c *remoteCursor) Put(key []byte, value []byte) error            { panic("not supported") }
@@ -304,10 +466,8 @@ func (c *remoteCursor) DeleteCurrent() error                          { panic("n
 func (c *remoteCursor) Count() (uint64, error)                        { panic("not supported") }
 
 func (c *remoteCursor) first() ([]byte, []byte, error) {
-	if err := c.stream.Send(&remote.Cursor{Cursor: c.id, Op: remote.Op_FIRST}); err != nil {
-		return []byte{}, nil, err
-	}
-	pair, err := c.stream.Recv()
+	c.dropBatch()
+	pair, err := c.roundTrip(&remote.Cursor{Op: remote.Op_FIRST})
 	if err != nil {
 		return []byte{}, nil, err
 	}
@@ -315,140 +475,180 @@ func (c *remoteCursor) first() ([]byte, []byte, error) {
 }
 
 func (c *remoteCursor) next() ([]byte, []byte, error) {
-	if err := c.stream.Send(&remote.Cursor{Cursor: c.id, Op: remote.Op_NEXT}); err != nil {
-		return []byte{}, nil, err
+	if n := c.tx.nextBatch; n > 1 {
+		return c.nextBatched(n)
 	}
-	pair, err := c.stream.Recv()
+	pair, err := c.roundTrip(&remote.Cursor{Op: remote.Op_NEXT})
 	if err != nil {
 		return []byte{}, nil, err
 	}
 	return pair.K, pair.V, nil
 }
+func (c *remoteCursor) nextBatched(n uint32) ([]byte, []byte, error) {
+	if len(c.bufK) == 0 {
+		if c.eof {
+			return nil, nil, nil
+		}
+		batch, err := c.roundTrip(&remote.Cursor{Op: remote.Op_NEXT, Limit: n})
+		if err != nil {
+			return []byte{}, nil, err
+		}
+		if len(batch.Keys) == 0 { // server handled it as single NEXT
+			return batch.K, batch.V, nil
+		}
+		c.bufK, c.bufV = batch.Keys, batch.Values
+	}
+	k, v := c.bufK[0], c.bufV[0]
+	c.bufK, c.bufV = c.bufK[1:], c.bufV[1:]
+	if len(k) == 0 {
+		c.eof = true
+		return nil, nil, nil
+	}
+	c.lastK, c.lastV = k, v
+	return k, v, nil
+}
+
+// resync - moves server's cursor back to last pair returned by batched Next
+func (c *remoteCursor) resync() error {
+	if len(c.bufK) == 0 && !c.eof {
+		return nil
+	}
+	k, v := c.lastK, c.lastV
+	c.dropBatch()
+	if k == nil {
+		return nil
+	}
+	_, err := c.roundTrip(&remote.Cursor{Op: c.seekExactOp(), K: k, V: v})
+	return err
+}
+
+// seekExactOp - operation which positions cursor exactly at given pair
+func (c *remoteCursor) seekExactOp() remote.Op {
+	if c.bucketCfg.Flags&kv.DupSort != 0 && !c.bucketCfg.AutoDupSortKeysConversion {
+		return remote.Op_SEEK_BOTH_EXACT
+	}
+	return remote.Op_SEEK_EXACT
+}
+
+func (c *remoteCursor) dropBatch() {
+	c.bufK, c.bufV, c.eof, c.lastK, c.lastV = nil, nil, false, nil, nil
+}
+
 func (c *remoteCursor) nextDup() ([]byte, []byte, error) {
-	if err := c.stream.Send(&remote.Cursor{Cursor: c.id, Op: remote.Op_NEXT_DUP}); err != nil {
+	if err := c.resync(); err != nil {
 		return []byte{}, nil, err
 	}
-	pair, err := c.stream.Recv()
+	pair, err := c.roundTrip(&remote.Cursor{Op: remote.Op_NEXT_DUP})
 	if err != nil {
 		return []byte{}, nil, err
 	}
 	return pair.K, pair.V, nil
 }
 func (c *remoteCursor) nextNoDup() ([]byte, []byte, error) {
-	if err := c.stream.Send(&remote.Cursor{Cursor: c.id, Op: remote.Op_NEXT_NO_DUP}); err != nil {
+	if err := c.resync(); err != nil {
 		return []byte{}, nil, err
 	}
-	pair, err := c.stream.Recv()
+	pair, err := c.roundTrip(&remote.Cursor{Op: remote.Op_NEXT_NO_DUP})
 	if err != nil {
 		return []byte{}, nil, err
 	}
 	return pair.K, pair.V, nil
 }
 func (c *remoteCursor) prev() ([]byte, []byte, error) {
-	if err := c.stream.Send(&remote.Cursor{Cursor: c.id, Op: remote.Op_PREV}); err != nil {
+	if err := c.resync(); err != nil {
 		return []byte{}, nil, err
 	}
-	pair, err := c.stream.Recv()
+	pair, err := c.roundTrip(&remote.Cursor{Op: remote.Op_PREV})
 	if err != nil {
 		return []byte{}, nil, err
 	}
 	return pair.K, pair.V, nil
 }
 func (c *remoteCursor) prevDup() ([]byte, []byte, error) {
-	if err := c.stream.Send(&remote.Cursor{Cursor: c.id, Op: remote.Op_PREV_DUP}); err != nil {
+	if err := c.resync(); err != nil {
 		return []byte{}, nil, err
 	}
-	pair, err := c.stream.Recv()
+	pair, err := c.roundTrip(&remote.Cursor{Op: remote.Op_PREV_DUP})
 	if err != nil {
 		return []byte{}, nil, err
 	}
 	return pair.K, pair.V, nil
 }
 func (c *remoteCursor) prevNoDup() ([]byte, []byte, error) {
-	if err := c.stream.Send(&remote.Cursor{Cursor: c.id, Op: remote.Op_PREV_NO_DUP}); err != nil {
+	if err := c.resync(); err != nil {
 		return []byte{}, nil, err
 	}
-	pair, err := c.stream.Recv()
+	pair, err := c.roundTrip(&remote.Cursor{Op: remote.Op_PREV_NO_DUP})
 	if err != nil {
 		return []byte{}, nil, err
 	}
 	return pair.K, pair.V, nil
 }
 func (c *remoteCursor) last() ([]byte, []byte, error) {
-	if err := c.stream.Send(&remote.Cursor{Cursor: c.id, Op: remote.Op_LAST}); err != nil {
-		return []byte{}, nil, err
-	}
-	pair, err := c.stream.Recv()
+	c.dropBatch()
+	pair, err := c.roundTrip(&remote.Cursor{Op: remote.Op_LAST})
 	if err != nil {
 		return []byte{}, nil, err
 	}
 	return pair.K, pair.V, nil
 }
 func (c *remoteCursor) setRange(k []byte) ([]byte, []byte, error) {
-	if err := c.stream.Send(&remote.Cursor{Cursor: c.id, Op: remote.Op_SEEK, K: k}); err != nil {
-		return []byte{}, nil, err
-	}
-	pair, err := c.stream.Recv()
+	c.dropBatch()
+	pair, err := c.roundTrip(&remote.Cursor{Op: remote.Op_SEEK, K: k})
 	if err != nil {
 		return []byte{}, nil, err
 	}
 	return pair.K, pair.V, nil
 }
 func (c *remoteCursor) seekExact(k []byte) ([]byte, []byte, error) {
-	if err := c.stream.Send(&remote.Cursor{Cursor: c.id, Op: remote.Op_SEEK_EXACT, K: k}); err != nil {
-		return []byte{}, nil, err
-	}
-	pair, err := c.stream.Recv()
+	c.dropBatch()
+	pair, err := c.roundTrip(&remote.Cursor{Op: remote.Op_SEEK_EXACT, K: k})
 	if err != nil {
 		return []byte{}, nil, err
 	}
 	return pair.K, pair.V, nil
 }
 func (c *remoteCursor) getBothRange(k, v []byte) ([]byte, error) {
-	if err := c.stream.Send(&remote.Cursor{Cursor: c.id, Op: remote.Op_SEEK_BOTH, K: k, V: v}); err != nil {
-		return nil, err
-	}
-	pair, err := c.stream.Recv()
+	c.dropBatch()
+	pair, err := c.roundTrip(&remote.Cursor{Op: remote.Op_SEEK_BOTH, K: k, V: v})
 	if err != nil {
 		return nil, err
 	}
 	return pair.V, nil
 }
 func (c *remoteCursor) seekBothExact(k, v []byte) ([]byte, []byte, error) {
-	if err := c.stream.Send(&remote.Cursor{Cursor: c.id, Op: remote.Op_SEEK_BOTH_EXACT, K: k, V: v}); err != nil {
-		return []byte{}, nil, err
-	}
-	pair, err := c.stream.Recv()
+	c.dropBatch()
+	pair, err := c.roundTrip(&remote.Cursor{Op: remote.Op_SEEK_BOTH_EXACT, K: k, V: v})
 	if err != nil {
 		return []byte{}, nil, err
 	}
 	return pair.K, pair.V, nil
 }
 func (c *remoteCursor) firstDup() ([]byte, error) {
-	if err := c.stream.Send(&remote.Cursor{Cursor: c.id, Op: remote.Op_FIRST_DUP}); err != nil {
+	if err := c.resync(); err != nil {
 		return nil, err
 	}
-	pair, err := c.stream.Recv()
+	pair, err := c.roundTrip(&remote.Cursor{Op: remote.Op_FIRST_DUP})
 	if err != nil {
 		return nil, err
 	}
 	return pair.V, nil
 }
 func (c *remoteCursor) lastDup() ([]byte, error) {
-	if err := c.stream.Send(&remote.Cursor{Cursor: c.id, Op: remote.Op_LAST_DUP}); err != nil {
+	if err := c.resync(); err != nil {
 		return nil, err
 	}
-	pair, err := c.stream.Recv()
+	pair, err := c.roundTrip(&remote.Cursor{Op: remote.Op_LAST_DUP})
 	if err != nil {
 		return nil, err
 	}
 	return pair.V, nil
 }
 func (c *remoteCursor) getCurrent() ([]byte, []byte, error) {
-	if err := c.stream.Send(&remote.Cursor{Cursor: c.id, Op: remote.Op_CURRENT}); err != nil {
+	if err := c.resync(); err != nil {
 		return []byte{}, nil, err
 	}
-	pair, err := c.stream.Recv()
+	pair, err := c.roundTrip(&remote.Cursor{Op: remote.Op_CURRENT})
 	if err != nil {
 		return []byte{}, nil, err
 	}
@@ -0,0 +1,236 @@
+/*
+   Copyright 2021 Erigon contributors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package remotedb_test
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"net"
+	"runtime"
+	"testing"
+
+	"github.com/ledgerwatch/erigon-lib/gointerfaces"
+	"github.com/ledgerwatch/erigon-lib/gointerfaces/grpcutil"
+	"github.com/ledgerwatch/erigon-lib/gointerfaces/remote"
+	"github.com/ledgerwatch/erigon-lib/gointerfaces/types"
+	"github.com/ledgerwatch/erigon-lib/kv"
+	"github.com/ledgerwatch/erigon-lib/kv/mdbx"
+	"github.com/ledgerwatch/erigon-lib/kv/remotedb"
+	"github.com/ledgerwatch/erigon-lib/kv/remotedbserver"
+	"github.com/ledgerwatch/log/v3"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/types/known/emptypb"
+)
+
+// serve - client of server over in-memory connection, server and connection are stopped at the end of test
+func serve(t *testing.T, server remote.KVServer, opts ...grpc.DialOption) (remote.KVClient, *grpc.Server) {
+	conn := bufconn.Listen(1024 * 1024)
+	grpcServer := grpcutil.NewServer(32, nil)
+	remote.RegisterKVServer(grpcServer, server)
+	go func() { _ = grpcServer.Serve(conn) }()
+	t.Cleanup(grpcServer.Stop)
+	opts = append(opts, grpc.WithInsecure(), grpc.WithContextDialer(func(ctx context.Context, url string) (net.Conn, error) { return conn.Dial() }))
+	cc, err := grpc.Dial("", opts...)
+	require.NoError(t, err)
+	t.Cleanup(func() { cc.Close() })
+	return remote.NewKVClient(cc), grpcServer
+}
+
+func TestNextBatch(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("fix me on win please")
+	}
+
+	logger := log.New()
+	db := mdbx.NewMDBX(logger).InMem().MustOpen()
+	defer db.Close()
+	ctx := context.Background()
+	require.NoError(t, db.Update(ctx, func(tx kv.RwTx) error {
+		for i := 0; i < 200; i++ {
+			if err := tx.Put(kv.HeaderNumber, []byte{byte(i), 1}, make([]byte, i%40)); err != nil {
+				return err
+			}
+			for j := 0; j <= i%3; j++ {
+				if err := tx.Put(kv.AccountChangeSet, []byte{byte(i), 1}, []byte{byte(j), byte(i)}); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}))
+
+	client, _ := serve(t, remotedbserver.NewKvServer(db).SetBatchLimits(5, 64), grpcutil.WithCompression())
+	v := gointerfaces.VersionFromProto(remotedbserver.KvServiceAPIVersion)
+	rdb, err := remotedb.NewRemote(v, logger, client).NextBatch(7).Open()
+	require.NoError(t, err)
+
+	tx, err := db.BeginRo(ctx)
+	require.NoError(t, err)
+	defer tx.Rollback()
+	rtx, err := rdb.BeginRo(ctx)
+	require.NoError(t, err)
+	defer rtx.Rollback()
+
+	for _, table := range []string{kv.HeaderNumber, kv.AccountChangeSet} {
+		c, err := tx.CursorDupSort(table)
+		require.NoError(t, err)
+		rc, err := rtx.CursorDupSort(table)
+		require.NoError(t, err)
+		dupSort := table == kv.AccountChangeSet
+
+		rnd := rand.New(rand.NewSource(42))
+		k, v, err := c.First()
+		require.NoError(t, err)
+		rk, rv, err := rc.First()
+		require.NoError(t, err)
+		for i := 0; i < 3_000; i++ {
+			// mostly Next - to make batches, mixed with ops which depend on position of server's cursor.
+			// FirstDup/LastDup are not here: mdbx-go v0.16 reads not-initialized key for them
+			op := rnd.Intn(14)
+			if !dupSort && op >= 12 {
+				op = 0
+			}
+			switch op {
+			case 8:
+				k, v, err = c.Current()
+				require.NoError(t, err)
+				rk, rv, err = rc.Current()
+			case 9:
+				k, v, err = c.Prev()
+				require.NoError(t, err)
+				rk, rv, err = rc.Prev()
+			case 10:
+				seek := []byte{byte(rnd.Intn(256))}
+				k, v, err = c.Seek(seek)
+				require.NoError(t, err)
+				rk, rv, err = rc.Seek(seek)
+			case 11:
+				k, v, err = c.First()
+				require.NoError(t, err)
+				rk, rv, err = rc.First()
+			case 12:
+				k, v, err = c.NextDup()
+				require.NoError(t, err)
+				rk, rv, err = rc.NextDup()
+			case 13:
+				k, v, err = c.NextNoDup()
+				require.NoError(t, err)
+				rk, rv, err = rc.NextNoDup()
+			default:
+				k, v, err = c.Next()
+				require.NoError(t, err)
+				rk, rv, err = rc.Next()
+			}
+			require.NoError(t, err)
+			require.Equal(t, k, rk, "step %d, op %d", i, op)
+			require.Equal(t, len(v), len(rv), "step %d, op %d", i, op)
+			require.Equal(t, fmt.Sprintf("%x", v), fmt.Sprintf("%x", rv), "step %d, op %d", i, op)
+			if v == nil { // position after end of table is not defined
+				_, _, err = c.First()
+				require.NoError(t, err)
+				_, _, err = rc.First()
+				require.NoError(t, err)
+			}
+		}
+	}
+}
+
+// oldKVClient - reports given version and, if stripLimit, hides Limit of requests from server as server without batched NEXT
+type oldKVClient struct {
+	remote.KVClient
+	version    *types.VersionReply
+	stripLimit bool
+	limits     []uint32
+}
+
+func (c *oldKVClient) Version(context.Context, *emptypb.Empty, ...grpc.CallOption) (*types.VersionReply, error) {
+	return c.version, nil
+}
+
+func (c *oldKVClient) Tx(ctx context.Context, opts ...grpc.CallOption) (remote.KV_TxClient, error) {
+	stream, err := c.KVClient.Tx(ctx, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return &oldKVStream{KV_TxClient: stream, c: c}, nil
+}
+
+type oldKVStream struct {
+	remote.KV_TxClient
+	c *oldKVClient
+}
+
+func (s *oldKVStream) Send(in *remote.Cursor) error {
+	s.c.limits = append(s.c.limits, in.Limit)
+	if s.c.stripLimit {
+		in = &remote.Cursor{Op: in.Op, BucketName: in.BucketName, Cursor: in.Cursor, K: in.K, V: in.V}
+	}
+	return s.KV_TxClient.Send(in)
+}
+
+func TestNextBatchOldServer(t *testing.T) {
+	logger := log.New()
+	db := mdbx.NewMDBX(logger).InMem().MustOpen()
+	defer db.Close()
+	ctx := context.Background()
+	require.NoError(t, db.Update(ctx, func(tx kv.RwTx) error {
+		for i := 0; i < 20; i++ {
+			if err := tx.Put(kv.HeaderNumber, []byte{byte(i)}, []byte{byte(i)}); err != nil {
+				return err
+			}
+		}
+		return nil
+	}))
+
+	kvClient, _ := serve(t, remotedbserver.NewKvServer(db))
+
+	count := func(client *oldKVClient, v gointerfaces.Version) int {
+		rdb, err := remotedb.NewRemote(v, logger, client).NextBatch(7).Open()
+		require.NoError(t, err)
+		tx, err := rdb.BeginRo(ctx)
+		require.NoError(t, err)
+		defer tx.Rollback()
+		c, err := tx.Cursor(kv.HeaderNumber)
+		require.NoError(t, err)
+		n := 0
+		for k, _, err := c.First(); k != nil; k, _, err = c.Next() {
+			require.NoError(t, err)
+			require.Equal(t, byte(n), k[0])
+			n++
+		}
+		return n
+	}
+
+	// version without batched NEXT: client doesn't ask for batches
+	old := gointerfaces.Version{Major: 3, Minor: 1}
+	client := &oldKVClient{KVClient: kvClient, version: old.Proto()}
+	require.Equal(t, 20, count(client, old))
+	for _, limit := range client.limits {
+		require.Zero(t, limit)
+	}
+
+	// server ignores Limit and replies by single pair
+	v := gointerfaces.VersionFromProto(remotedbserver.KvServiceAPIVersion)
+	client = &oldKVClient{KVClient: kvClient, version: remotedbserver.KvServiceAPIVersion, stripLimit: true}
+	require.Equal(t, 20, count(client, v))
+	require.Contains(t, client.limits, uint32(7))
+
+	require.Panics(t, func() { remotedbserver.NewKvServer(db).SetBatchLimits(0, 64) })
+}
@@ -0,0 +1,102 @@
+/*
+   Copyright 2021 Erigon contributors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package remotedb
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/ledgerwatch/erigon-lib/gointerfaces/remote"
+	"github.com/ledgerwatch/erigon-lib/kv"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+const defaultViewTTL = 30 * time.Second // same as server's default
+
+// PinnedView - read-only view of server's db which is kept by server until Unpin.
+// All transactions of view see same state of db - even if they are opened by different clients.
+type PinnedView struct {
+	db     *RemoteKV
+	ViewID uint64
+	TxID   uint64 // state version of view, other clients can attach to same view by Pin(ctx, TxID, ttl)
+
+	stopHeartbeats context.CancelFunc
+	heartbeatsDone chan struct{}
+}
+
+// Pin - asks server to keep current state of db (or already pinned state, if txID != 0) and starts sending
+// heartbeats every ttl/3 in background - until Unpin. ttl == 0 means server's default.
+func (db *RemoteKV) Pin(ctx context.Context, txID uint64, ttl time.Duration) (*PinnedView, error) {
+	reply, err := db.remoteKV.Pin(ctx, &remote.PinRequest{TxId: txID, TtlMs: uint32(ttl / time.Millisecond)})
+	if err != nil {
+		return nil, err
+	}
+	if ttl == 0 {
+		ttl = defaultViewTTL
+	}
+	hbCtx, stop := context.WithCancel(context.Background())
+	v := &PinnedView{db: db, ViewID: reply.ViewId, TxID: reply.TxId, stopHeartbeats: stop, heartbeatsDone: make(chan struct{})}
+	go v.heartbeats(hbCtx, ttl/3)
+	return v, nil
+}
+
+func (v *PinnedView) heartbeats(ctx context.Context, every time.Duration) {
+	defer close(v.heartbeatsDone)
+	ticker := time.NewTicker(every)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if _, err := v.db.remoteKV.Heartbeat(ctx, &remote.ViewRequest{ViewId: v.ViewID}); err != nil {
+			if status.Code(err) == codes.NotFound { // expired - nothing to keep alive
+				v.db.log.Warn("pinned view expired", "viewID", v.ViewID, "txID", v.TxID)
+				return
+			}
+			if ctx.Err() == nil {
+				v.db.log.Warn("pinned view heartbeat", "viewID", v.ViewID, "error", err)
+			}
+		}
+	}
+}
+
+// BeginRo - opens transaction reading pinned view. It doesn't hold view alive: after Unpin or expiration it returns errors.
+func (v *PinnedView) BeginRo(ctx context.Context) (kv.Tx, error) {
+	return v.db.BeginRo(metadata.AppendToOutgoingContext(ctx, remote.ViewIDMetadataKey, strconv.FormatUint(v.ViewID, 10)))
+}
+
+func (v *PinnedView) View(ctx context.Context, f func(tx kv.Tx) error) error {
+	tx, err := v.BeginRo(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	return f(tx)
+}
+
+// Unpin - stops heartbeats and releases view on server
+func (v *PinnedView) Unpin(ctx context.Context) error {
+	v.stopHeartbeats()
+	<-v.heartbeatsDone
+	_, err := v.db.remoteKV.Unpin(ctx, &remote.ViewRequest{ViewId: v.ViewID})
+	return err
+}
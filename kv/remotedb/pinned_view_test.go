@@ -0,0 +1,93 @@
+/*
+   Copyright 2021 Erigon contributors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package remotedb_test
+
+import (
+	"context"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/ledgerwatch/erigon-lib/gointerfaces"
+	"github.com/ledgerwatch/erigon-lib/kv"
+	"github.com/ledgerwatch/erigon-lib/kv/mdbx"
+	"github.com/ledgerwatch/erigon-lib/kv/remotedb"
+	"github.com/ledgerwatch/erigon-lib/kv/remotedbserver"
+	"github.com/ledgerwatch/log/v3"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRemotePinnedView(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("fix me on win please")
+	}
+
+	logger := log.New()
+	db := mdbx.NewMDBX(logger).InMem().MustOpen()
+	defer db.Close()
+	ctx := context.Background()
+	put := func(v string) {
+		require.NoError(t, db.Update(ctx, func(tx kv.RwTx) error {
+			return tx.Put(kv.HeaderNumber, []byte("k"), []byte(v))
+		}))
+	}
+	put("old")
+
+	client, _ := serve(t, remotedbserver.NewKvServer(db))
+	v := gointerfaces.VersionFromProto(remotedbserver.KvServiceAPIVersion)
+	rdb, err := remotedb.NewRemote(v, logger, client).Open()
+	require.NoError(t, err)
+
+	get := func(view func(context.Context, func(kv.Tx) error) error) (string, error) {
+		var res []byte
+		err := view(ctx, func(tx kv.Tx) error {
+			v, err := tx.GetOne(kv.HeaderNumber, []byte("k"))
+			res = v
+			return err
+		})
+		return string(res), err
+	}
+
+	pinned, err := rdb.Pin(ctx, 0, 300*time.Millisecond)
+	require.NoError(t, err)
+	put("new")
+	attached, err := rdb.Pin(ctx, pinned.TxID, 0)
+	require.NoError(t, err)
+	require.Equal(t, pinned.ViewID, attached.ViewID)
+
+	time.Sleep(time.Second) // heartbeats keep view alive longer than ttl
+	for _, view := range []*remotedb.PinnedView{pinned, attached} {
+		res, err := get(view.View)
+		require.NoError(t, err)
+		require.Equal(t, "old", res)
+	}
+	res, err := get(rdb.View)
+	require.NoError(t, err)
+	require.Equal(t, "new", res)
+
+	// view is shared - released only by last Unpin
+	require.NoError(t, pinned.Unpin(ctx))
+	res, err = get(attached.View)
+	require.NoError(t, err)
+	require.Equal(t, "old", res)
+	require.NoError(t, attached.Unpin(ctx))
+	_, err = get(attached.View)
+	require.Error(t, err)
+
+	_, err = rdb.Pin(ctx, pinned.TxID, 0)
+	require.Error(t, err)
+}
@@ -0,0 +1,217 @@
+/*
+   Copyright 2021 Erigon contributors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package remotedb
+
+import (
+	"context"
+	"errors"
+	"io"
+	"time"
+
+	"github.com/ledgerwatch/erigon-lib/common/errkind"
+	"github.com/ledgerwatch/erigon-lib/gointerfaces/remote"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	DefaultReconnectAttempts = 10 // default of ReconnectAttempts
+	reconnectBaseDelay       = 100 * time.Millisecond
+	reconnectMaxDelay        = 5 * time.Second
+)
+
+// relativeOps - operations which depend on current position of cursor
+var relativeOps = map[remote.Op]bool{
+	remote.Op_NEXT:        true,
+	remote.Op_NEXT_DUP:    true,
+	remote.Op_NEXT_NO_DUP: true,
+	remote.Op_PREV:        true,
+	remote.Op_PREV_DUP:    true,
+	remote.Op_PREV_NO_DUP: true,
+	remote.Op_CURRENT:     true,
+	remote.Op_FIRST_DUP:   true,
+	remote.Op_LAST_DUP:    true,
+}
+
+// noReconnect - error which must be returned to caller as is, even if original failure was transient
+type noReconnect struct{ error }
+
+func unwrapNoReconnect(err error) error {
+	if e, ok := err.(noReconnect); ok {
+		return e.error
+	}
+	return err
+}
+
+// retry - calls f, after transient failures reconnects tx and calls f again - up to opts.reconnectAttempts times
+func (tx *remoteTx) retry(f func() error) error {
+	err := f()
+	for attempt := 1; err != nil && attempt <= tx.db.opts.reconnectAttempts && tx.retriable(err); attempt++ {
+		tx.db.log.Warn("[remote kv] reconnecting", "attempt", attempt, "err", err)
+		if err = tx.reconnect(attempt); err == nil {
+			err = f()
+		}
+	}
+	return withKind(unwrapNoReconnect(err))
+}
+
+// statusKinds - errkind of gRPC codes, server sends errors with errkind by these codes
+var statusKinds = map[codes.Code]error{
+	codes.Canceled:          errkind.Canceled,
+	codes.DeadlineExceeded:  errkind.Canceled,
+	codes.NotFound:          errkind.NotFound,
+	codes.DataLoss:          errkind.Corrupted,
+	codes.ResourceExhausted: errkind.TooBig,
+}
+
+// statusError - error with errkind, which keeps gRPC status of wrapped error for status.Code and status.FromError
+type statusError struct {
+	error
+	kind error
+}
+
+func (e statusError) Unwrap() error              { return e.error }
+func (e statusError) Is(target error) bool       { return target == e.kind }
+func (e statusError) GRPCStatus() *status.Status { s, _ := status.FromError(e.error); return s }
+
+// withKind - marks context errors and gRPC errors of server by errkind
+func withKind(err error) error {
+	if err == nil || errkind.Of(err) != nil {
+		return err
+	}
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return errkind.Wrap(errkind.Canceled, err)
+	}
+	if s, ok := status.FromError(err); ok {
+		if kind, ok := statusKinds[s.Code()]; ok {
+			return statusError{error: err, kind: kind}
+		}
+	}
+	return err
+}
+
+func (tx *remoteTx) retriable(err error) bool {
+	if tx.ctx.Err() != nil {
+		return false
+	}
+	return status.Code(err) == codes.Unavailable
+}
+
+// reconnect - opens new stream, re-opens all cursors of tx and moves them to their last confirmed positions
+func (tx *remoteTx) reconnect(attempt int) error {
+	delay := reconnectBaseDelay << uint(attempt-1)
+	if delay > reconnectMaxDelay || delay <= 0 {
+		delay = reconnectMaxDelay
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-tx.ctx.Done():
+		return tx.ctx.Err()
+	case <-timer.C:
+	}
+
+	if tx.streamCancelFn != nil {
+		tx.streamCancelFn()
+	}
+	streamCtx, streamCancelFn := context.WithCancel(tx.ctx)
+	stream, err := tx.db.remoteKV.Tx(streamCtx)
+	if err != nil {
+		streamCancelFn()
+		return err
+	}
+	tx.stream, tx.streamCancelFn, tx.streamingRequested = stream, streamCancelFn, false
+	for _, c := range tx.cursors {
+		if c.stream == nil { // closed
+			continue
+		}
+		if err := c.open(); err != nil {
+			return err
+		}
+		if err := c.restore(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// restore - moves server's cursor to confirmed position. If position disappeared - relative operations will fail.
+func (c *remoteCursor) restore() error {
+	c.lost = nil
+	if c.posK == nil {
+		return nil
+	}
+	pair, err := c.sendRecv(&remote.Cursor{Cursor: c.id, Op: c.seekExactOp(), K: c.posK, V: c.posV})
+	if err != nil {
+		return err
+	}
+	if pair.K == nil {
+		c.lost = errkind.Errorf(errkind.NotFound, "remote cursor of table %s: position %x lost after reconnect", c.bucketName, c.posK)
+	}
+	return nil
+}
+
+// roundTrip - sends cursor operation and receives reply, reconnects after transient failures
+func (c *remoteCursor) roundTrip(req *remote.Cursor) (pair *remote.Pair, err error) {
+	if err = c.tx.retry(func() error {
+		if c.lost != nil && relativeOps[req.Op] {
+			return noReconnect{c.lost}
+		}
+		req.Cursor = c.id
+		pair, err = c.sendRecv(req)
+		return err
+	}); err != nil {
+		return nil, err
+	}
+	c.confirm(req, pair)
+	return pair, nil
+}
+
+// sendRecv - one request/reply, without reconnect. If stream is broken - Send returns io.EOF and real error is returned by Recv
+func (c *remoteCursor) sendRecv(req *remote.Cursor) (*remote.Pair, error) {
+	if err := c.stream.Send(req); err != nil && err != io.EOF {
+		return nil, err
+	}
+	return c.stream.Recv()
+}
+
+// confirm - remembers position of server's cursor after successful operation
+func (c *remoteCursor) confirm(req *remote.Cursor, pair *remote.Pair) {
+	if !relativeOps[req.Op] {
+		c.lost = nil
+	}
+	switch {
+	case req.Op == remote.Op_FIRST_DUP || req.Op == remote.Op_LAST_DUP:
+		if pair.V != nil {
+			c.posV = pair.V
+		}
+	case req.Op == remote.Op_SEEK_BOTH:
+		c.posK, c.posV = req.K, pair.V
+		if pair.V == nil {
+			c.posK = nil
+		}
+	case req.Op == remote.Op_NEXT && req.Limit > 1: // batch - cursor is on last pair, end of table marked by empty key
+		for i := len(pair.Keys) - 1; i >= 0; i-- {
+			if len(pair.Keys[i]) > 0 {
+				c.posK, c.posV = pair.Keys[i], pair.Values[i]
+				break
+			}
+		}
+	default:
+		c.posK, c.posV = pair.K, pair.V
+	}
+}
@@ -0,0 +1,152 @@
+/*
+   Copyright 2021 Erigon contributors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package remotedb_test
+
+import (
+	"context"
+	"net"
+	"runtime"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ledgerwatch/erigon-lib/gointerfaces"
+	"github.com/ledgerwatch/erigon-lib/gointerfaces/grpcutil"
+	"github.com/ledgerwatch/erigon-lib/gointerfaces/remote"
+	"github.com/ledgerwatch/erigon-lib/kv"
+	"github.com/ledgerwatch/erigon-lib/kv/mdbx"
+	"github.com/ledgerwatch/erigon-lib/kv/remotedb"
+	"github.com/ledgerwatch/erigon-lib/kv/remotedbserver"
+	"github.com/ledgerwatch/log/v3"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/backoff"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+func TestRemoteReconnect(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("fix me on win please")
+	}
+
+	logger := log.New()
+	db := mdbx.NewMDBX(logger).InMem().MustOpen()
+	defer db.Close()
+	ctx := context.Background()
+	require.NoError(t, db.Update(ctx, func(tx kv.RwTx) error {
+		for i := 0; i < 100; i++ {
+			if err := tx.Put(kv.HeaderNumber, []byte{byte(i)}, []byte{byte(i)}); err != nil {
+				return err
+			}
+		}
+		return nil
+	}))
+
+	var lock sync.Mutex
+	var conn *bufconn.Listener
+	var grpcServer *grpc.Server
+	start := func() {
+		lock.Lock()
+		defer lock.Unlock()
+		conn = bufconn.Listen(1024 * 1024)
+		grpcServer = grpcutil.NewServer(32, nil)
+		remote.RegisterKVServer(grpcServer, remotedbserver.NewKvServer(db))
+		go func(s *grpc.Server, l *bufconn.Listener) { _ = s.Serve(l) }(grpcServer, conn)
+	}
+	restart := func(during func()) {
+		grpcServer.Stop()
+		if during != nil {
+			during()
+		}
+		start()
+	}
+	start()
+	defer func() { grpcServer.Stop() }()
+	cc, err := grpc.Dial("", grpc.WithInsecure(),
+		grpc.WithConnectParams(grpc.ConnectParams{Backoff: backoff.Config{BaseDelay: 10 * time.Millisecond, Multiplier: 1.6, MaxDelay: 50 * time.Millisecond}}),
+		grpc.WithContextDialer(func(ctx context.Context, url string) (net.Conn, error) {
+			lock.Lock()
+			defer lock.Unlock()
+			return conn.Dial()
+		}))
+	require.NoError(t, err)
+	defer cc.Close()
+	v := gointerfaces.VersionFromProto(remotedbserver.KvServiceAPIVersion)
+
+	for _, nextBatch := range []uint32{1, 7} {
+		rdb, err := remotedb.NewRemote(v, logger, remote.NewKVClient(cc)).NextBatch(nextBatch).Open()
+		require.NoError(t, err)
+		tx, err := rdb.BeginRo(ctx)
+		require.NoError(t, err)
+		c, err := tx.Cursor(kv.HeaderNumber)
+		require.NoError(t, err)
+		var keys []byte
+		for k, _, err := c.First(); k != nil; k, _, err = c.Next() {
+			require.NoError(t, err)
+			keys = append(keys, k[0])
+			if k[0]%30 == 10 {
+				restart(nil)
+			}
+		}
+		require.Equal(t, 100, len(keys))
+		for i, k := range keys {
+			require.Equal(t, byte(i), k)
+		}
+
+		n := 0
+		require.NoError(t, tx.ForEach(kv.HeaderNumber, nil, func(k, v []byte) error {
+			n++
+			return nil
+		}))
+		require.Equal(t, 100, n)
+		tx.Rollback()
+	}
+
+	// position of cursor disappeared while server was down
+	rdb, err := remotedb.NewRemote(v, logger, remote.NewKVClient(cc)).Open()
+	require.NoError(t, err)
+	tx, err := rdb.BeginRo(ctx)
+	require.NoError(t, err)
+	defer tx.Rollback()
+	c, err := tx.Cursor(kv.HeaderNumber)
+	require.NoError(t, err)
+	_, _, err = c.SeekExact([]byte{50})
+	require.NoError(t, err)
+	restart(func() {
+		require.NoError(t, db.Update(ctx, func(tx kv.RwTx) error { return tx.Delete(kv.HeaderNumber, []byte{50}, nil) }))
+	})
+	_, _, err = c.Next()
+	require.Error(t, err)
+	k, _, err := c.Seek([]byte{50})
+	require.NoError(t, err)
+	require.Equal(t, []byte{51}, k)
+	k, _, err = c.Next()
+	require.NoError(t, err)
+	require.Equal(t, []byte{52}, k)
+
+	// opt-out: transaction doesn't move to new state of db silently
+	rdb, err = remotedb.NewRemote(v, logger, remote.NewKVClient(cc)).ReconnectAttempts(0).Open()
+	require.NoError(t, err)
+	tx2, err := rdb.BeginRo(ctx)
+	require.NoError(t, err)
+	defer tx2.Rollback()
+	_, err = tx2.GetOne(kv.HeaderNumber, []byte{1})
+	require.NoError(t, err)
+	restart(nil)
+	_, err = tx2.GetOne(kv.HeaderNumber, []byte{1})
+	require.Error(t, err)
+}
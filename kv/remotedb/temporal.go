@@ -0,0 +1,101 @@
+/*
+   Copyright 2021 Erigon contributors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package remotedb
+
+import (
+	"fmt"
+	"io"
+	"math"
+
+	"github.com/ledgerwatch/erigon-lib/gointerfaces"
+	"github.com/ledgerwatch/erigon-lib/gointerfaces/remote"
+	"github.com/ledgerwatch/erigon-lib/kv"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+var _ kv.TemporalRoDB = (*RemoteKV)(nil) // compile-time interface check
+var _ kv.TemporalTx = (*remoteTx)(nil)   // compile-time interface check
+
+func (tx *remoteTx) DomainGet(name kv.Domain, k, k2 []byte) (v []byte, ok bool, err error) {
+	err = tx.temporal(&remote.Cursor{Op: remote.Op_DOMAIN_GET, BucketName: string(name), K: k, V: k2}, func(pair *remote.Pair, _ bool) bool {
+		v, ok = pair.V, pair.Ok
+		return false
+	})
+	return v, ok, err
+}
+
+func (tx *remoteTx) HistoryGet(name kv.History, k []byte, asOfTxNum uint64) (v []byte, ok bool, err error) {
+	err = tx.temporal(&remote.Cursor{Op: remote.Op_HISTORY_GET, BucketName: string(name), K: k, TxNum: asOfTxNum}, func(pair *remote.Pair, _ bool) bool {
+		v, ok = pair.V, pair.Ok
+		return false
+	})
+	return v, ok, err
+}
+
+// IndexRange - server streams txNums by batches, all of them are received before iterator is returned
+func (tx *remoteTx) IndexRange(name kv.InvertedIdx, k []byte, fromTxNum, toTxNum int, asc bool, limit int) (kv.U64Iter, error) {
+	req := &remote.Cursor{Op: remote.Op_INDEX_RANGE, BucketName: string(name), K: k, FromTxNum: int64(fromTxNum), ToTxNum: int64(toTxNum), OrderAscend: asc}
+	if limit > 0 && limit <= math.MaxUint32 {
+		req.Limit = uint32(limit)
+	}
+	var txNums []uint64
+	err := tx.temporal(req, func(batch *remote.Pair, first bool) bool {
+		if first { // range is requested again after reconnect
+			txNums = txNums[:0]
+		}
+		if len(batch.TxNums) == 0 {
+			return false
+		}
+		txNums = append(txNums, batch.TxNums...)
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	return kv.U64Slice(txNums), nil
+}
+
+// temporal - sends temporal op and passes replies to f while it returns true, first - first reply to this request.
+// Ops don't depend on cursors - so after reconnect op is just requested again.
+// kv.ErrNotSupported if server or its db has no history.
+func (tx *remoteTx) temporal(req *remote.Cursor, f func(pair *remote.Pair, first bool) bool) error {
+	if !tx.db.supports(gointerfaces.KVTemporal) {
+		return fmt.Errorf("remote temporal tx: server version %s: %w", tx.db.server, kv.ErrNotSupported)
+	}
+	err := tx.retry(func() error {
+		if err := tx.stream.Send(req); err != nil && err != io.EOF {
+			return err
+		}
+		tx.streamingRequested = req.Op == remote.Op_INDEX_RANGE
+		for first := true; ; first = false {
+			pair, err := tx.stream.Recv()
+			if err != nil {
+				return err
+			}
+			if !f(pair, first) {
+				break
+			}
+		}
+		tx.streamingRequested = false
+		return nil
+	})
+	if status.Code(err) == codes.Unimplemented {
+		return fmt.Errorf("remote temporal tx: %s: %w", status.Convert(err).Message(), kv.ErrNotSupported)
+	}
+	return err
+}
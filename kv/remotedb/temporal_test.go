@@ -0,0 +1,157 @@
+/*
+   Copyright 2021 Erigon contributors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package remotedb_test
+
+import (
+	"context"
+	"errors"
+	"runtime"
+	"testing"
+
+	"github.com/ledgerwatch/erigon-lib/gointerfaces"
+	"github.com/ledgerwatch/erigon-lib/kv"
+	"github.com/ledgerwatch/erigon-lib/kv/mdbx"
+	"github.com/ledgerwatch/erigon-lib/kv/remotedb"
+	"github.com/ledgerwatch/erigon-lib/kv/remotedbserver"
+	"github.com/ledgerwatch/log/v3"
+	"github.com/stretchr/testify/require"
+)
+
+// testTemporalDB - db with history: value of key "k" is "new" since txNum 10, "old" before, key changed by every 3rd txNum
+type testTemporalDB struct{ kv.RwDB }
+
+func (db testTemporalDB) BeginTemporalRo(ctx context.Context) (kv.TemporalTx, error) {
+	tx, err := db.BeginRo(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return testTemporalTx{tx}, nil
+}
+func (db testTemporalDB) ViewTemporal(ctx context.Context, f func(tx kv.TemporalTx) error) error {
+	tx, err := db.BeginTemporalRo(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	return f(tx)
+}
+
+type testTemporalTx struct{ kv.Tx }
+
+func (tx testTemporalTx) DomainGet(name kv.Domain, k, k2 []byte) ([]byte, bool, error) {
+	v, err := tx.GetOne(kv.HeaderNumber, append(append([]byte{}, k...), k2...))
+	return v, v != nil, err
+}
+func (tx testTemporalTx) HistoryGet(name kv.History, k []byte, asOfTxNum uint64) ([]byte, bool, error) {
+	if asOfTxNum >= 10 {
+		return nil, false, nil
+	}
+	return []byte("old"), true, nil
+}
+func (tx testTemporalTx) IndexRange(name kv.InvertedIdx, k []byte, fromTxNum, toTxNum int, asc bool, limit int) (kv.U64Iter, error) {
+	var res []uint64
+	for i := 0; i < 100 && (limit < 0 || len(res) < limit); i++ {
+		txNum := i * 3
+		if !asc {
+			txNum = 297 - i*3
+		}
+		if asc && (txNum < fromTxNum || (toTxNum >= 0 && txNum >= toTxNum)) || !asc && (fromTxNum >= 0 && txNum > fromTxNum || txNum <= toTxNum) {
+			continue
+		}
+		res = append(res, uint64(txNum))
+	}
+	return kv.U64Slice(res), nil
+}
+
+func TestTemporal(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("fix me on win please")
+	}
+
+	logger := log.New()
+	db := mdbx.NewMDBX(logger).InMem().MustOpen()
+	defer db.Close()
+	ctx := context.Background()
+	require.NoError(t, db.Update(ctx, func(tx kv.RwTx) error {
+		return tx.Put(kv.HeaderNumber, []byte("k"), []byte("new"))
+	}))
+
+	open := func(db kv.RwDB) *remotedb.RemoteKV {
+		client, _ := serve(t, remotedbserver.NewKvServer(db).SetBatchLimits(5, 64))
+		v := gointerfaces.VersionFromProto(remotedbserver.KvServiceAPIVersion)
+		rdb, err := remotedb.NewRemote(v, logger, client).Open()
+		require.NoError(t, err)
+		return rdb
+	}
+
+	rdb := open(testTemporalDB{db})
+	require.NoError(t, rdb.ViewTemporal(ctx, func(tx kv.TemporalTx) error {
+		v, ok, err := tx.DomainGet(kv.AccountsDomain, []byte("k"), nil)
+		require.NoError(t, err)
+		require.True(t, ok)
+		require.Equal(t, "new", string(v))
+		_, ok, err = tx.DomainGet(kv.AccountsDomain, []byte("k"), []byte("2"))
+		require.NoError(t, err)
+		require.False(t, ok)
+
+		v, ok, err = tx.HistoryGet(kv.AccountsDomainHistory, []byte("k"), 5)
+		require.NoError(t, err)
+		require.True(t, ok)
+		require.Equal(t, "old", string(v))
+		_, ok, err = tx.HistoryGet(kv.AccountsDomainHistory, []byte("k"), 10)
+		require.NoError(t, err)
+		require.False(t, ok)
+
+		// more txNums than in one batch
+		for _, tc := range []struct {
+			from, to int
+			asc      bool
+			limit    int
+			want     []uint64
+		}{
+			{from: 0, to: 20, asc: true, limit: -1, want: []uint64{0, 3, 6, 9, 12, 15, 18}},
+			{from: 10, to: -1, asc: true, limit: 3, want: []uint64{12, 15, 18}},
+			{from: 20, to: 5, asc: false, limit: -1, want: []uint64{18, 15, 12, 9, 6}},
+			{from: -1, to: -1, asc: false, limit: 2, want: []uint64{297, 294}},
+		} {
+			it, err := tx.IndexRange(kv.LogAddrIdx, []byte("k"), tc.from, tc.to, tc.asc, tc.limit)
+			require.NoError(t, err)
+			var got []uint64
+			for it.HasNext() {
+				txNum, err := it.Next()
+				require.NoError(t, err)
+				got = append(got, txNum)
+			}
+			it.Close()
+			require.Equal(t, tc.want, got)
+		}
+
+		// plain ops work on same tx
+		v, err = tx.GetOne(kv.HeaderNumber, []byte("k"))
+		require.NoError(t, err)
+		require.Equal(t, "new", string(v))
+		return nil
+	}))
+
+	// db without history
+	rdb = open(db)
+	require.NoError(t, rdb.ViewTemporal(ctx, func(tx kv.TemporalTx) error {
+		_, _, err := tx.DomainGet(kv.AccountsDomain, []byte("k"), nil)
+		require.True(t, errors.Is(err, kv.ErrNotSupported))
+		return nil
+	}))
+}
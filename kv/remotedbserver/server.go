@@ -17,14 +17,19 @@
 package remotedbserver
 
 import (
+	"bytes"
 	"context"
 	"fmt"
 	"io"
 	"time"
 
+	"github.com/ledgerwatch/erigon-lib/common/errkind"
+	"github.com/ledgerwatch/erigon-lib/gointerfaces"
 	"github.com/ledgerwatch/erigon-lib/gointerfaces/remote"
 	"github.com/ledgerwatch/erigon-lib/gointerfaces/types"
 	"github.com/ledgerwatch/erigon-lib/kv"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 	"google.golang.org/protobuf/types/known/emptypb"
 )
 
@@ -34,16 +39,45 @@ const MaxTxTTL = 30 * time.Second
 // 1.1.0 - added pending transactions, add methods eth_getRawTransactionByHash, eth_retRawTransactionByBlockHashAndIndex, eth_retRawTransactionByBlockNumberAndIndex| Yes     |                                            |
 // 1.2.0 - Added separated services for mining and txpool methods
 // 2.0.0 - Rename all buckets
-var KvServiceAPIVersion = &types.VersionReply{Major: 3, Minor: 0, Patch: 0}
+// 3.1.0 - Added RANGE op: server-side streaming of table ranges by batches
+// 3.2.0 - Added batched NEXT op (Cursor.limit > 1)
+// 3.3.0 - Added Pin/Heartbeat/Unpin methods: Tx streams reading same pinned view
+// 3.4.0 - Added Health method
+// 3.5.0 - Added StateChanges acknowledgements, overflow signalling and catch-up from block
+// 3.6.0 - Added StateChange.pendingBlobFeePerGas
+// 3.6.1 - Tx errors of common/errkind are sent with gRPC codes: NotFound, DataLoss, ResourceExhausted, Canceled
+// 3.7.0 - Added temporal ops: DOMAIN_GET, HISTORY_GET, INDEX_RANGE
+// Bump it in gointerfaces.KVService, together with features
+var KvServiceAPIVersion = gointerfaces.KVService.Version.Proto()
+
+const (
+	DefaultBatchPairs = 1024      // max amount of pairs in one message of RANGE or batched NEXT reply
+	DefaultBatchBytes = 256 << 10 // max size of keys and values in one message of RANGE or batched NEXT reply
+)
 
 type KvServer struct {
 	remote.UnimplementedKVServer // must be embedded to have forward compatible implementations.
 
-	kv kv.RwDB
+	kv         kv.RwDB
+	batchPairs int
+	batchBytes int
+	views      views
+
+	stateChanges *StateChangePubSub
 }
 
 func NewKvServer(kv kv.RwDB) *KvServer {
-	return &KvServer{kv: kv}
+	return &KvServer{kv: kv, batchPairs: DefaultBatchPairs, batchBytes: DefaultBatchBytes}
+}
+
+// SetBatchLimits - limits of one message of RANGE and batched NEXT replies. Message is sent when any of limits reached.
+// Panics on non-positive limits: with them replies would be empty.
+func (s *KvServer) SetBatchLimits(pairs, bytes int) *KvServer {
+	if pairs <= 0 || bytes <= 0 {
+		panic(fmt.Sprintf("non-positive batch limits: pairs=%d, bytes=%d", pairs, bytes))
+	}
+	s.batchPairs, s.batchBytes = pairs, bytes
+	return s
 }
 
 // Version returns the service-side interface version number
@@ -64,15 +98,61 @@ func (s *KvServer) Version(context.Context, *emptypb.Empty) (*types.VersionReply
 	return dbSchemaVersion, nil
 }
 
+// SetStateChanges - source of StateChanges streams, without it method is not implemented
+func (s *KvServer) SetStateChanges(ps *StateChangePubSub) *KvServer {
+	s.stateChanges = ps
+	return s
+}
+
+// Health - reports if db is open and readable, and versions of db schema and of KV service
+func (s *KvServer) Health(ctx context.Context, _ *emptypb.Empty) (*remote.HealthReply, error) {
+	reply := &remote.HealthReply{DbSchemaVersion: &kv.DBSchemaVersion, KvApiVersion: KvServiceAPIVersion}
+	tx, err := s.kv.BeginRo(ctx)
+	if err != nil {
+		reply.Error = err.Error()
+		return reply, nil
+	}
+	tx.Rollback()
+	reply.DbOpen = true
+	return reply, nil
+}
+
 func (s *KvServer) Tx(stream remote.KV_TxServer) error {
-	tx, errBegin := s.kv.BeginRo(stream.Context())
-	if errBegin != nil {
-		return fmt.Errorf("server-side error: %w", errBegin)
+	return withCode(s.tx(stream))
+}
+
+// kindCodes - gRPC codes of errors with errkind, remotedb client converts them back to errkind
+var kindCodes = map[error]codes.Code{
+	errkind.Canceled:  codes.Canceled,
+	errkind.NotFound:  codes.NotFound,
+	errkind.Corrupted: codes.DataLoss,
+	errkind.TooBig:    codes.ResourceExhausted,
+}
+
+// withCode - errors which have errkind, but no gRPC status, are sent with status code of their kind
+func withCode(err error) error {
+	if _, ok := status.FromError(err); ok {
+		return err
 	}
-	rollback := func() {
-		tx.Rollback()
+	if code, ok := kindCodes[errkind.Of(err)]; ok {
+		return status.Error(code, err.Error())
+	}
+	return err
+}
+
+func (s *KvServer) tx(stream remote.KV_TxServer) error {
+	view, err := s.pinnedView(stream.Context())
+	if err != nil {
+		return err
+	}
+	var tx kv.Tx
+	if view == nil {
+		var errBegin error
+		tx, errBegin = s.beginRo(stream.Context())
+		if errBegin != nil {
+			return fmt.Errorf("server-side error: %w", errBegin)
+		}
 	}
-	defer rollback()
 
 	var CursorID uint32
 	type CursorInfo struct {
@@ -81,6 +161,15 @@ func (s *KvServer) Tx(stream remote.KV_TxServer) error {
 		k, v   []byte //fields to save current position of cursor - used when Tx reopen
 	}
 	cursors := map[uint32]*CursorInfo{}
+	defer func() {
+		if view != nil { // view's tx stays open for other streams
+			for _, c := range cursors {
+				c.c.Close()
+			}
+			return
+		}
+		tx.Rollback()
+	}()
 
 	txTicker := time.NewTicker(MaxTxTTL)
 	defer txTicker.Stop()
@@ -99,6 +188,9 @@ func (s *KvServer) Tx(stream remote.KV_TxServer) error {
 		select {
 		default:
 		case <-txTicker.C:
+			if view != nil { // pinned view lives until Unpin or expiration
+				break
+			}
 			for _, c := range cursors { // save positions of cursor, will restore after Tx reopening
 				k, v, err := c.c.Current()
 				if err != nil {
@@ -109,7 +201,8 @@ func (s *KvServer) Tx(stream remote.KV_TxServer) error {
 			}
 
 			tx.Rollback()
-			tx, errBegin = s.kv.BeginRo(stream.Context())
+			var errBegin error
+			tx, errBegin = s.beginRo(stream.Context())
 			if errBegin != nil {
 				return fmt.Errorf("server-side error, BeginRo: %w", errBegin)
 			}
@@ -140,6 +233,20 @@ func (s *KvServer) Tx(stream remote.KV_TxServer) error {
 			}
 		}
 
+		switch in.Op {
+		case remote.Op_DOMAIN_GET, remote.Op_HISTORY_GET, remote.Op_INDEX_RANGE:
+			var err error
+			if view != nil {
+				err = view.do(func(tx kv.Tx) error { return s.handleTemporal(tx, stream, in) })
+			} else {
+				err = s.handleTemporal(tx, stream, in)
+			}
+			if err != nil {
+				return err
+			}
+			continue
+		}
+
 		var c kv.Cursor
 		if in.BucketName == "" {
 			cInfo, ok := cursors[in.Cursor]
@@ -153,7 +260,11 @@ func (s *KvServer) Tx(stream remote.KV_TxServer) error {
 		case remote.Op_OPEN:
 			CursorID++
 			var err error
-			c, err = tx.Cursor(in.BucketName)
+			if view != nil {
+				c, err = view.cursor(in.BucketName)
+			} else {
+				c, err = tx.Cursor(in.BucketName)
+			}
 			if err != nil {
 				return err
 			}
@@ -176,6 +287,18 @@ func (s *KvServer) Tx(stream remote.KV_TxServer) error {
 				return fmt.Errorf("server-side error: %w", err)
 			}
 			continue
+		case remote.Op_RANGE:
+			if err := s.handleRange(c, stream, in); err != nil {
+				return fmt.Errorf("server-side error: %w", err)
+			}
+			continue
+		case remote.Op_NEXT:
+			if in.Limit > 1 {
+				if err := s.handleNextBatch(c, stream, in); err != nil {
+					return fmt.Errorf("server-side error: %w", err)
+				}
+				continue
+			}
 		default:
 		}
 
@@ -185,6 +308,73 @@ func (s *KvServer) Tx(stream remote.KV_TxServer) error {
 	}
 }
 
+// beginRo - temporal tx if db has history, see handleTemporal
+func (s *KvServer) beginRo(ctx context.Context) (kv.Tx, error) {
+	if db, ok := s.kv.(kv.TemporalRoDB); ok {
+		return db.BeginTemporalRo(ctx)
+	}
+	return s.kv.BeginRo(ctx)
+}
+
+// handleTemporal - DOMAIN_GET, HISTORY_GET and INDEX_RANGE ops. If tx has no history - fails with codes.Unimplemented
+func (s *KvServer) handleTemporal(tx kv.Tx, stream remote.KV_TxServer, in *remote.Cursor) error {
+	ttx, err := kv.AsTemporal(tx)
+	if err != nil {
+		return status.Error(codes.Unimplemented, err.Error())
+	}
+	if err := s.temporalOp(ttx, stream, in); err != nil {
+		return fmt.Errorf("server-side error: %w", err)
+	}
+	return nil
+}
+
+func (s *KvServer) temporalOp(tx kv.TemporalTx, stream remote.KV_TxServer, in *remote.Cursor) error {
+	switch in.Op {
+	case remote.Op_DOMAIN_GET:
+		v, ok, err := tx.DomainGet(kv.Domain(in.BucketName), in.K, in.V)
+		if err != nil {
+			return err
+		}
+		return stream.Send(&remote.Pair{V: v, Ok: ok})
+	case remote.Op_HISTORY_GET:
+		v, ok, err := tx.HistoryGet(kv.History(in.BucketName), in.K, in.TxNum)
+		if err != nil {
+			return err
+		}
+		return stream.Send(&remote.Pair{V: v, Ok: ok})
+	}
+
+	limit := -1
+	if in.Limit > 0 {
+		limit = int(in.Limit)
+	}
+	it, err := tx.IndexRange(kv.InvertedIdx(in.BucketName), in.K, int(in.FromTxNum), int(in.ToTxNum), in.OrderAscend, limit)
+	if err != nil {
+		return err
+	}
+	defer it.Close()
+	batch := &remote.Pair{}
+	for it.HasNext() {
+		txNum, err := it.Next()
+		if err != nil {
+			return err
+		}
+		batch.TxNums = append(batch.TxNums, txNum)
+		if len(batch.TxNums) >= s.batchPairs || len(batch.TxNums)*8 >= s.batchBytes {
+			if err := stream.Send(batch); err != nil {
+				return err
+			}
+			batch = &remote.Pair{}
+		}
+	}
+	if len(batch.TxNums) > 0 {
+		if err := stream.Send(batch); err != nil {
+			return err
+		}
+	}
+	return stream.Send(&remote.Pair{})
+}
+
 func handleOp(c kv.Cursor, stream remote.KV_TxServer, in *remote.Cursor) error {
 	var k, v []byte
 	var err error
@@ -239,6 +429,60 @@ func handleOp(c kv.Cursor, stream remote.KV_TxServer, in *remote.Cursor) error {
 	return nil
 }
 
+// handleRange - sends pairs of range by batches, then empty batch as terminator.
+// Doesn't wait for client between batches - relies on flow control of grpc stream.
+func (s *KvServer) handleRange(c kv.Cursor, stream remote.KV_TxServer, in *remote.Cursor) error {
+	batch, size, n := &remote.Pair{}, 0, uint32(0)
+	for k, v, err := c.Seek(in.K); k != nil; k, v, err = c.Next() {
+		if err != nil {
+			return err
+		}
+		if len(in.ToK) > 0 && bytes.Compare(k, in.ToK) >= 0 {
+			break
+		}
+		batch.Keys = append(batch.Keys, k)
+		batch.Values = append(batch.Values, v)
+		size += len(k) + len(v)
+		n++
+		if len(batch.Keys) >= s.batchPairs || size >= s.batchBytes {
+			if err := stream.Send(batch); err != nil {
+				return err
+			}
+			batch, size = &remote.Pair{}, 0
+		}
+		if in.Limit > 0 && n >= in.Limit {
+			break
+		}
+	}
+	if len(batch.Keys) > 0 {
+		if err := stream.Send(batch); err != nil {
+			return err
+		}
+	}
+	return stream.Send(&remote.Pair{})
+}
+
+// handleNextBatch - replies by up to in.Limit next pairs in one message, cursor stays on last of them.
+// If end of table reached - last key in batch is empty.
+func (s *KvServer) handleNextBatch(c kv.Cursor, stream remote.KV_TxServer, in *remote.Cursor) error {
+	batch, size := &remote.Pair{}, 0
+	for len(batch.Keys) < int(in.Limit) && len(batch.Keys) < s.batchPairs && size < s.batchBytes {
+		k, v, err := c.Next()
+		if err != nil {
+			return err
+		}
+		if k == nil {
+			batch.Keys = append(batch.Keys, nil)
+			batch.Values = append(batch.Values, nil)
+			break
+		}
+		batch.Keys = append(batch.Keys, k)
+		batch.Values = append(batch.Values, v)
+		size += len(k) + len(v)
+	}
+	return stream.Send(batch)
+}
+
 func bytesCopy(b []byte) []byte {
 	if b == nil {
 		return nil
@@ -0,0 +1,259 @@
+/*
+   Copyright 2021 Erigon contributors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package remotedbserver
+
+import (
+	"context"
+	"sync"
+
+	"github.com/ledgerwatch/erigon-lib/gointerfaces/remote"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/emptypb"
+)
+
+const (
+	DefaultStateChangesBuffer  = 1024 // max amount of changes waiting for sending to one subscriber
+	DefaultStateChangesHistory = 256  // amount of last changes retained for catch-up
+)
+
+// StateChangePubSub - delivers published state changes to all StateChanges streams.
+// Every subscriber has bounded buffer: if subscriber is too slow (or doesn't send acks) and buffer is full -
+// its stream is closed with codes.ResourceExhausted, instead of silent drop of changes or blocking of publisher.
+type StateChangePubSub struct {
+	lock         sync.Mutex
+	subs         map[uint64]*stateChangeSub
+	lastID       uint64
+	bufferLimit  int
+	history      []*remote.StateChange
+	historyLimit int
+}
+
+type stateChangeSub struct {
+	id       uint64
+	ch       chan *remote.StateChange
+	overflow chan struct{} // closed when buffer overflowed
+	stopped  bool          // buffer overflowed: no new changes, but acks are accepted until buffered changes are sent
+
+	ackLock sync.Mutex
+	acked   uint64
+	ackCh   chan struct{} // notifies sender about new acks
+}
+
+func NewStateChangePubSub() *StateChangePubSub {
+	return &StateChangePubSub{
+		subs:         map[uint64]*stateChangeSub{},
+		bufferLimit:  DefaultStateChangesBuffer,
+		historyLimit: DefaultStateChangesHistory,
+	}
+}
+
+// SetLimits - size of buffer of each subscriber and amount of retained changes for catch-up
+func (ps *StateChangePubSub) SetLimits(buffer, history int) *StateChangePubSub {
+	ps.bufferLimit, ps.historyLimit = buffer, history
+	return ps
+}
+
+// Pub - never blocks: subscribers which can't accept change are stopped, they get buffered changes and error
+func (ps *StateChangePubSub) Pub(sc *remote.StateChange) {
+	ps.lock.Lock()
+	defer ps.lock.Unlock()
+	ps.history = append(ps.history, sc)
+	if len(ps.history) > ps.historyLimit {
+		ps.history = append(ps.history[:0], ps.history[len(ps.history)-ps.historyLimit:]...)
+	}
+	for _, sub := range ps.subs {
+		if sub.stopped {
+			continue
+		}
+		select {
+		case sub.ch <- sc:
+		default:
+			sub.stopped = true
+			close(sub.overflow)
+		}
+	}
+}
+
+// Len - amount of subscribers which receive new changes
+func (ps *StateChangePubSub) Len() int {
+	ps.lock.Lock()
+	defer ps.lock.Unlock()
+	n := 0
+	for _, sub := range ps.subs {
+		if !sub.stopped {
+			n++
+		}
+	}
+	return n
+}
+
+// sub - registers subscriber. If fromBlock > 0 - returns retained changes starting from this block,
+// they must be sent before changes from sub.ch
+func (ps *StateChangePubSub) sub(fromBlock uint64) (*stateChangeSub, []*remote.StateChange, error) {
+	ps.lock.Lock()
+	defer ps.lock.Unlock()
+	var catchUp []*remote.StateChange
+	if fromBlock > 0 {
+		if len(ps.history) == 0 || ps.history[0].BlockHeight > fromBlock {
+			return nil, nil, status.Errorf(codes.OutOfRange, "state changes of block %d are not retained", fromBlock)
+		}
+		for i, sc := range ps.history {
+			if sc.BlockHeight >= fromBlock {
+				catchUp = append(catchUp, ps.history[i:]...)
+				break
+			}
+		}
+	}
+	ps.lastID++
+	sub := &stateChangeSub{
+		id:       ps.lastID,
+		ch:       make(chan *remote.StateChange, ps.bufferLimit),
+		overflow: make(chan struct{}),
+		ackCh:    make(chan struct{}, 1),
+	}
+	ps.subs[sub.id] = sub
+	return sub, catchUp, nil
+}
+
+func (ps *StateChangePubSub) unsub(id uint64) {
+	ps.lock.Lock()
+	defer ps.lock.Unlock()
+	delete(ps.subs, id)
+}
+
+func (ps *StateChangePubSub) ack(id, sequence uint64) error {
+	ps.lock.Lock()
+	sub, ok := ps.subs[id]
+	ps.lock.Unlock()
+	if !ok {
+		return status.Errorf(codes.NotFound, "no state changes subscription %d", id)
+	}
+	sub.ackLock.Lock()
+	if sequence > sub.acked {
+		sub.acked = sequence
+	}
+	sub.ackLock.Unlock()
+	select {
+	case sub.ackCh <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// waitAck - waits until less than window of sent changes is not acked. After overflow too: buffered changes
+// are delivered before error
+func (sub *stateChangeSub) waitAck(ctx context.Context, sent uint64, window uint32) error {
+	for {
+		sub.ackLock.Lock()
+		acked := sub.acked
+		sub.ackLock.Unlock()
+		if sent-acked < uint64(window) {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-sub.ackCh:
+		}
+	}
+}
+
+var errStateChangesOverflow = status.Error(codes.ResourceExhausted, "state changes buffer overflow: consumer is too slow, re-subscribe with fromBlock")
+
+func (s *KvServer) StateChanges(req *remote.StateChangeRequest, server remote.KV_StateChangesServer) error {
+	if s.stateChanges == nil {
+		return status.Errorf(codes.Unimplemented, "method StateChanges not implemented")
+	}
+	ctx := server.Context()
+	sub, catchUp, err := s.stateChanges.sub(req.FromBlock)
+	if err != nil {
+		return err
+	}
+	defer s.stateChanges.unsub(sub.id)
+
+	var sent uint64
+	send := func(sc *remote.StateChange) error {
+		if req.Window > 0 {
+			if err := sub.waitAck(ctx, sent, req.Window); err != nil {
+				return err
+			}
+		}
+		sent++
+		return server.Send(filterStateChange(req, sc, sub.id, sent))
+	}
+	for _, sc := range catchUp {
+		if err := send(sc); err != nil {
+			return err
+		}
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-sub.overflow:
+			// buffered changes are still delivered - then consumer can continue from next block
+			for {
+				select {
+				case sc := <-sub.ch:
+					if err := send(sc); err != nil {
+						return err
+					}
+					continue
+				default:
+				}
+				return errStateChangesOverflow
+			}
+		case sc := <-sub.ch:
+			if err := send(sc); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func (s *KvServer) StateChangesAck(_ context.Context, req *remote.StateChangeAck) (*emptypb.Empty, error) {
+	if s.stateChanges == nil {
+		return nil, status.Errorf(codes.Unimplemented, "method StateChangesAck not implemented")
+	}
+	if err := s.stateChanges.ack(req.SubscriptionId, req.Sequence); err != nil {
+		return nil, err
+	}
+	return &emptypb.Empty{}, nil
+}
+
+// filterStateChange - copy of published change with fields requested by subscriber
+func filterStateChange(req *remote.StateChangeRequest, sc *remote.StateChange, subID, sequence uint64) *remote.StateChange {
+	res := proto.Clone(sc).(*remote.StateChange)
+	res.SubscriptionId, res.Sequence = subID, sequence
+	if !req.WithTransactions {
+		res.Txs, res.ProtocolBaseFee, res.PendingBlobFeePerGas = nil, 0, 0
+	}
+	if !req.WithStorage {
+		changes := res.Changes[:0]
+		for _, c := range res.Changes {
+			if c.Action == remote.Action_STORAGE {
+				continue
+			}
+			c.StorageChanges = nil
+			changes = append(changes, c)
+		}
+		res.Changes = changes
+	}
+	return res
+}
@@ -0,0 +1,116 @@
+/*
+   Copyright 2021 Erigon contributors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package remotedbserver_test
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/ledgerwatch/erigon-lib/gointerfaces/grpcutil"
+	"github.com/ledgerwatch/erigon-lib/gointerfaces/remote"
+	"github.com/ledgerwatch/erigon-lib/kv/mdbx"
+	"github.com/ledgerwatch/erigon-lib/kv/remotedbserver"
+	"github.com/ledgerwatch/log/v3"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+func TestStateChanges(t *testing.T) {
+	logger := log.New()
+	db := mdbx.NewMDBX(logger).InMem().MustOpen()
+	defer db.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	ps := remotedbserver.NewStateChangePubSub().SetLimits(4, 3)
+	conn := bufconn.Listen(1024 * 1024)
+	grpcServer := grpcutil.NewServer(32, nil)
+	remote.RegisterKVServer(grpcServer, remotedbserver.NewKvServer(db).SetStateChanges(ps))
+	go func() { _ = grpcServer.Serve(conn) }()
+	defer grpcServer.Stop()
+	cc, err := grpc.Dial("", grpc.WithInsecure(), grpc.WithContextDialer(func(ctx context.Context, url string) (net.Conn, error) { return conn.Dial() }))
+	require.NoError(t, err)
+	defer cc.Close()
+	client := remote.NewKVClient(cc)
+
+	pub := func(from, to uint64) {
+		for i := from; i <= to; i++ {
+			ps.Pub(&remote.StateChange{BlockHeight: i, Txs: [][]byte{{1}}})
+		}
+	}
+	subscribe := func(req *remote.StateChangeRequest) remote.KV_StateChangesClient {
+		n := ps.Len()
+		stream, err := client.StateChanges(ctx, req)
+		require.NoError(t, err)
+		for ps.Len() == n { // wait until subscribed
+			time.Sleep(time.Millisecond)
+		}
+		return stream
+	}
+	recv := func(stream remote.KV_StateChangesClient, block, sequence uint64) *remote.StateChange {
+		sc, err := stream.Recv()
+		require.NoError(t, err)
+		require.Equal(t, block, sc.BlockHeight)
+		require.Equal(t, sequence, sc.Sequence)
+		return sc
+	}
+	pub(1, 4)
+
+	// catch-up from retained changes, then new changes - only after ack
+	stream := subscribe(&remote.StateChangeRequest{FromBlock: 3, Window: 2})
+	recv(stream, 3, 1)
+	sc := recv(stream, 4, 2)
+	require.Nil(t, sc.Txs)
+	pub(5, 5)
+	_, err = client.StateChangesAck(ctx, &remote.StateChangeAck{SubscriptionId: sc.SubscriptionId, Sequence: 1})
+	require.NoError(t, err)
+	recv(stream, 5, 3)
+
+	// slow consumer: buffered changes are delivered after acks, then overflow is reported, not silently dropped
+	pub(6, 11)
+	_, err = client.StateChangesAck(ctx, &remote.StateChangeAck{SubscriptionId: sc.SubscriptionId, Sequence: 3})
+	require.NoError(t, err)
+	block := uint64(6)
+	for ; ; block++ {
+		if sc, err = stream.Recv(); err != nil {
+			break
+		}
+		require.Equal(t, block, sc.BlockHeight)
+		// subscription ends after last buffered change, its ack may be late
+		_, err = client.StateChangesAck(ctx, &remote.StateChangeAck{SubscriptionId: sc.SubscriptionId, Sequence: sc.Sequence})
+		require.True(t, err == nil || status.Code(err) == codes.NotFound, "%v", err)
+	}
+	require.Equal(t, codes.ResourceExhausted, status.Code(err), "%v", err)
+	require.GreaterOrEqual(t, block, uint64(10), "whole buffer is delivered")
+
+	// too old
+	stream, err = client.StateChanges(ctx, &remote.StateChangeRequest{FromBlock: 2})
+	require.NoError(t, err)
+	_, err = stream.Recv()
+	require.Equal(t, codes.OutOfRange, status.Code(err), "%v", err)
+
+	// without acks
+	stream = subscribe(&remote.StateChangeRequest{WithTransactions: true})
+	pub(12, 13)
+	recv(stream, 12, 1)
+	require.Equal(t, [][]byte{{1}}, recv(stream, 13, 2).Txs)
+}
@@ -0,0 +1,292 @@
+/*
+   Copyright 2021 Erigon contributors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package remotedbserver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/ledgerwatch/erigon-lib/gointerfaces/remote"
+	"github.com/ledgerwatch/erigon-lib/kv"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/emptypb"
+)
+
+const (
+	DefaultViewTTL = MaxTxTTL
+	MaxViewTTL     = 10 * time.Minute
+)
+
+var ErrViewExpired = errors.New("pinned view expired or unpinned")
+
+// view - read transaction pinned by client. It's shared by all Tx streams of this view,
+// read transactions are not thread-safe - so every cursor operation holds view.lock
+type view struct {
+	lock   sync.Mutex
+	tx     kv.Tx
+	id     uint64
+	txID   uint64
+	refs   int
+	ttl    time.Duration
+	timer  *time.Timer
+	closed bool
+}
+
+type views struct {
+	lock   sync.Mutex
+	lastID uint64
+	byID   map[uint64]*view
+}
+
+func (vs *views) get(id uint64) (*view, error) {
+	v, ok := vs.byID[id]
+	if !ok {
+		return nil, status.Errorf(codes.NotFound, "view %d: %s", id, ErrViewExpired)
+	}
+	return v, nil
+}
+
+func (vs *views) byTxID(txID uint64) *view {
+	for _, v := range vs.byID {
+		if v.txID == txID {
+			return v
+		}
+	}
+	return nil
+}
+
+// close - releases view's transaction. Caller must hold vs.lock
+func (vs *views) close(v *view) {
+	delete(vs.byID, v.id)
+	v.timer.Stop()
+	v.lock.Lock()
+	defer v.lock.Unlock()
+	v.closed = true
+	v.tx.Rollback()
+}
+
+func (vs *views) expire(v *view) {
+	vs.lock.Lock()
+	defer vs.lock.Unlock()
+	if vs.byID[v.id] == v {
+		vs.close(v)
+	}
+}
+
+func viewTTL(ms uint32) time.Duration {
+	if ms == 0 {
+		return DefaultViewTTL
+	}
+	if ttl := time.Duration(ms) * time.Millisecond; ttl < MaxViewTTL {
+		return ttl
+	}
+	return MaxViewTTL
+}
+
+// Pin - opens read transaction and keeps it until Unpin or ttl expiration. If req.TxId is set - attaches
+// to already pinned view of this state version, then each Pin requires own Unpin.
+func (s *KvServer) Pin(ctx context.Context, req *remote.PinRequest) (*remote.PinReply, error) {
+	s.views.lock.Lock()
+	defer s.views.lock.Unlock()
+	if s.views.byID == nil {
+		s.views.byID = map[uint64]*view{}
+	}
+	ttl := viewTTL(req.TtlMs)
+	if req.TxId != 0 {
+		v := s.views.byTxID(req.TxId)
+		if v == nil {
+			return nil, status.Errorf(codes.NotFound, "no pinned view of txId=%d", req.TxId)
+		}
+		v.refs++
+		if ttl > v.ttl {
+			v.ttl = ttl
+		}
+		v.timer.Reset(v.ttl)
+		return &remote.PinReply{ViewId: v.id, TxId: v.txID}, nil
+	}
+
+	tx, err := s.beginRo(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("server-side error: %w", err)
+	}
+	withID, ok := tx.(interface{ ID() uint64 })
+	if !ok {
+		tx.Rollback()
+		return nil, status.Errorf(codes.Unimplemented, "db doesn't support pinned views")
+	}
+	s.views.lastID++
+	v := &view{tx: tx, id: s.views.lastID, txID: withID.ID(), refs: 1, ttl: ttl}
+	v.timer = time.AfterFunc(ttl, func() { s.views.expire(v) })
+	s.views.byID[v.id] = v
+	return &remote.PinReply{ViewId: v.id, TxId: v.txID}, nil
+}
+
+// Heartbeat - extends life of view for one more ttl
+func (s *KvServer) Heartbeat(_ context.Context, req *remote.ViewRequest) (*emptypb.Empty, error) {
+	s.views.lock.Lock()
+	defer s.views.lock.Unlock()
+	v, err := s.views.get(req.ViewId)
+	if err != nil {
+		return nil, err
+	}
+	v.timer.Reset(v.ttl)
+	return &emptypb.Empty{}, nil
+}
+
+func (s *KvServer) Unpin(_ context.Context, req *remote.ViewRequest) (*emptypb.Empty, error) {
+	s.views.lock.Lock()
+	defer s.views.lock.Unlock()
+	v, ok := s.views.byID[req.ViewId]
+	if !ok {
+		return &emptypb.Empty{}, nil
+	}
+	v.refs--
+	if v.refs <= 0 {
+		s.views.close(v)
+	}
+	return &emptypb.Empty{}, nil
+}
+
+// pinnedView - view requested by metadata of Tx stream, nil if stream reads latest state
+func (s *KvServer) pinnedView(ctx context.Context) (*view, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	ids := md.Get(remote.ViewIDMetadataKey)
+	if len(ids) == 0 {
+		return nil, nil
+	}
+	id, err := strconv.ParseUint(ids[0], 10, 64)
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "bad %s: %s", remote.ViewIDMetadataKey, ids[0])
+	}
+	s.views.lock.Lock()
+	defer s.views.lock.Unlock()
+	return s.views.get(id)
+}
+
+func (v *view) cursor(bucket string) (kv.Cursor, error) {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+	if v.closed {
+		return nil, ErrViewExpired
+	}
+	c, err := v.tx.Cursor(bucket)
+	if err != nil {
+		return nil, err
+	}
+	return &viewCursor{view: v, c: c}, nil
+}
+
+// do - runs f on view's transaction, f must not keep read values after return
+func (v *view) do(f func(tx kv.Tx) error) error {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+	if v.closed {
+		return ErrViewExpired
+	}
+	return f(v.tx)
+}
+
+// viewCursor - cursor of pinned view, serializes access to view's transaction
+type viewCursor struct {
+	view *view
+	c    kv.Cursor
+}
+
+var _ kv.CursorDupSort = &viewCursor{}
+
+func (c *viewCursor) do(f func() ([]byte, []byte, error)) ([]byte, []byte, error) {
+	c.view.lock.Lock()
+	defer c.view.lock.Unlock()
+	if c.view.closed {
+		return nil, nil, ErrViewExpired
+	}
+	// copy because view can be closed by other goroutine right after unlock
+	k, v, err := f()
+	return bytesCopy(k), bytesCopy(v), err
+}
+
+func (c *viewCursor) dupSort() kv.CursorDupSort { return c.c.(kv.CursorDupSort) }
+
+func (c *viewCursor) First() ([]byte, []byte, error) { return c.do(c.c.First) }
+func (c *viewCursor) Next() ([]byte, []byte, error)  { return c.do(c.c.Next) }
+func (c *viewCursor) Prev() ([]byte, []byte, error)  { return c.do(c.c.Prev) }
+func (c *viewCursor) Last() ([]byte, []byte, error)  { return c.do(c.c.Last) }
+func (c *viewCursor) Current() ([]byte, []byte, error) {
+	return c.do(c.c.Current)
+}
+func (c *viewCursor) Seek(seek []byte) ([]byte, []byte, error) {
+	return c.do(func() ([]byte, []byte, error) { return c.c.Seek(seek) })
+}
+func (c *viewCursor) SeekExact(key []byte) ([]byte, []byte, error) {
+	return c.do(func() ([]byte, []byte, error) { return c.c.SeekExact(key) })
+}
+func (c *viewCursor) Count() (cnt uint64, err error) {
+	_, _, err = c.do(func() ([]byte, []byte, error) {
+		cnt, err = c.c.Count()
+		return nil, nil, err
+	})
+	return cnt, err
+}
+func (c *viewCursor) Close() {
+	c.view.lock.Lock()
+	defer c.view.lock.Unlock()
+	if !c.view.closed { // cursors are already closed by tx.Rollback
+		c.c.Close()
+	}
+}
+
+func (c *viewCursor) SeekBothExact(key, value []byte) ([]byte, []byte, error) {
+	return c.do(func() ([]byte, []byte, error) { return c.dupSort().SeekBothExact(key, value) })
+}
+func (c *viewCursor) SeekBothRange(key, value []byte) ([]byte, error) {
+	_, v, err := c.do(func() ([]byte, []byte, error) {
+		v, err := c.dupSort().SeekBothRange(key, value)
+		return nil, v, err
+	})
+	return v, err
+}
+func (c *viewCursor) FirstDup() ([]byte, error) {
+	_, v, err := c.do(func() ([]byte, []byte, error) {
+		v, err := c.dupSort().FirstDup()
+		return nil, v, err
+	})
+	return v, err
+}
+func (c *viewCursor) NextDup() ([]byte, []byte, error) { return c.do(c.dupSort().NextDup) }
+func (c *viewCursor) NextNoDup() ([]byte, []byte, error) {
+	return c.do(c.dupSort().NextNoDup)
+}
+func (c *viewCursor) LastDup() ([]byte, error) {
+	_, v, err := c.do(func() ([]byte, []byte, error) {
+		v, err := c.dupSort().LastDup()
+		return nil, v, err
+	})
+	return v, err
+}
+func (c *viewCursor) CountDuplicates() (cnt uint64, err error) {
+	_, _, err = c.do(func() ([]byte, []byte, error) {
+		cnt, err = c.dupSort().CountDuplicates()
+		return nil, nil, err
+	})
+	return cnt, err
+}
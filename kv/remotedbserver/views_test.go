@@ -0,0 +1,70 @@
+/*
+   Copyright 2021 Erigon contributors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package remotedbserver_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/ledgerwatch/erigon-lib/gointerfaces/remote"
+	"github.com/ledgerwatch/erigon-lib/kv/memdb"
+	"github.com/ledgerwatch/erigon-lib/kv/remotedbserver"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestViews(t *testing.T) {
+	require := require.New(t)
+	ctx := context.Background()
+	s := remotedbserver.NewKvServer(memdb.NewTestDB(t))
+
+	// heartbeats keep view alive longer than ttl
+	pinned, err := s.Pin(ctx, &remote.PinRequest{TtlMs: 50})
+	require.NoError(err)
+	for i := 0; i < 5; i++ {
+		time.Sleep(20 * time.Millisecond)
+		_, err = s.Heartbeat(ctx, &remote.ViewRequest{ViewId: pinned.ViewId})
+		require.NoError(err)
+	}
+
+	// view is shared - released only by last Unpin
+	attached, err := s.Pin(ctx, &remote.PinRequest{TxId: pinned.TxId})
+	require.NoError(err)
+	require.Equal(pinned.ViewId, attached.ViewId)
+	_, err = s.Unpin(ctx, &remote.ViewRequest{ViewId: pinned.ViewId})
+	require.NoError(err)
+	_, err = s.Heartbeat(ctx, &remote.ViewRequest{ViewId: pinned.ViewId})
+	require.NoError(err)
+	_, err = s.Unpin(ctx, &remote.ViewRequest{ViewId: attached.ViewId})
+	require.NoError(err)
+	_, err = s.Heartbeat(ctx, &remote.ViewRequest{ViewId: pinned.ViewId})
+	require.Equal(codes.NotFound, status.Code(err))
+	_, err = s.Unpin(ctx, &remote.ViewRequest{ViewId: pinned.ViewId})
+	require.NoError(err)
+
+	// view without heartbeats expires
+	expiring, err := s.Pin(ctx, &remote.PinRequest{TtlMs: 10})
+	require.NoError(err)
+	require.NotEqual(pinned.ViewId, expiring.ViewId)
+	time.Sleep(100 * time.Millisecond)
+	_, err = s.Heartbeat(ctx, &remote.ViewRequest{ViewId: expiring.ViewId})
+	require.Equal(codes.NotFound, status.Code(err))
+	_, err = s.Pin(ctx, &remote.PinRequest{TxId: expiring.TxId})
+	require.Equal(codes.NotFound, status.Code(err))
+}
@@ -346,6 +346,7 @@ var ChaindataTables = []string{
 
 const (
 	RecentLocalTransaction = "RecentLocalTransaction" // sequence_u64 -> tx_hash
+	PoolPrivateTransaction = "PoolPrivateTransaction" // sequence_u64 -> tx_hash, private transactions are not propagated
 	PoolSenderID           = "PoolSenderID"           // sender_20bytes -> sender_id_u64
 	PoolSenderIDToAdress   = "PoolSenderIDToAddress"  // sender_id_u64 -> sender_20bytes
 	PoolSender             = "PoolSender"             // sender_id_u64 -> nonce, balance
@@ -356,6 +357,7 @@ const (
 
 var TxPoolTables = []string{
 	RecentLocalTransaction,
+	PoolPrivateTransaction,
 	PoolSenderID,
 	PoolSenderIDToAdress,
 	PoolSender,
@@ -0,0 +1,107 @@
+/*
+   Copyright 2021 Erigon contributors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package kv
+
+import (
+	"context"
+	"fmt"
+)
+
+// Domain - latest state of keys, with History of previous values and InvertedIdx of txNums when keys were changed.
+// Storage of domains (state aggregator) is not part of this module yet: TemporalTx declares API which RPC code
+// can be written against. remotedb.RemoteKV implements it over KV service, remotedbserver serves it if its db is TemporalRoDB.
+type Domain string
+type History string
+type InvertedIdx string
+
+const (
+	AccountsDomain Domain = "AccountsDomain"
+	StorageDomain  Domain = "StorageDomain"
+	CodeDomain     Domain = "CodeDomain"
+)
+
+const (
+	AccountsDomainHistory History = "AccountsHistory"
+	StorageDomainHistory  History = "StorageHistory"
+	CodeDomainHistory     History = "CodeHistory"
+)
+
+const (
+	LogAddrIdx    InvertedIdx = "LogAddrIdx"
+	LogTopicIdx   InvertedIdx = "LogTopicIdx"
+	TracesFromIdx InvertedIdx = "TracesFromIdx"
+	TracesToIdx   InvertedIdx = "TracesToIdx"
+)
+
+// U64Iter - txNums of IndexRange, in requested order
+//
+//	for it.HasNext() {
+//	    txNum, err := it.Next()
+//	    ...
+//	}
+type U64Iter interface {
+	HasNext() bool
+	Next() (uint64, error)
+	Close()
+}
+
+// TemporalTx - Tx which also reads state as of any transaction number (txNum - sequential number of transaction in chain)
+type TemporalTx interface {
+	Tx
+
+	// DomainGet - latest value of key. k2 - second part of key (storage location for StorageDomain), nil for other domains
+	DomainGet(name Domain, k, k2 []byte) (v []byte, ok bool, err error)
+
+	// HistoryGet - value of key before txNum asOfTxNum changed it.
+	// ok=false: key wasn't changed since asOfTxNum - its value is DomainGet's one
+	HistoryGet(name History, k []byte, asOfTxNum uint64) (v []byte, ok bool, err error)
+
+	// IndexRange - txNums which touched key: [fromTxNum, toTxNum) if asc, (toTxNum, fromTxNum] otherwise.
+	// -1 means unbounded for fromTxNum, toTxNum and limit
+	IndexRange(name InvertedIdx, k []byte, fromTxNum, toTxNum int, asc bool, limit int) (U64Iter, error)
+}
+
+// U64Slice - U64Iter over txNums which are already in memory
+func U64Slice(txNums []uint64) U64Iter { return &u64Slice{txNums: txNums} }
+
+type u64Slice struct{ txNums []uint64 }
+
+func (it *u64Slice) HasNext() bool { return len(it.txNums) > 0 }
+func (it *u64Slice) Next() (uint64, error) {
+	if len(it.txNums) == 0 {
+		return 0, fmt.Errorf("U64Slice: no more txNums")
+	}
+	txNum := it.txNums[0]
+	it.txNums = it.txNums[1:]
+	return txNum, nil
+}
+func (it *u64Slice) Close() {}
+
+type TemporalRoDB interface {
+	RoDB
+	ViewTemporal(ctx context.Context, f func(tx TemporalTx) error) error
+	BeginTemporalRo(ctx context.Context) (TemporalTx, error)
+}
+
+// AsTemporal - tx as TemporalTx, ErrNotSupported if its DB has no history (for example, db without state aggregator)
+func AsTemporal(tx Tx) (TemporalTx, error) {
+	ttx, ok := tx.(TemporalTx)
+	if !ok {
+		return nil, fmt.Errorf("temporal tx on %T: %w", tx, ErrNotSupported)
+	}
+	return ttx, nil
+}
@@ -55,14 +55,14 @@ func EncodeListPrefix(dataLen int, to []byte) int {
 	return 1
 }
 func U64Len(i uint64) int {
-	if i > 128 {
+	if i >= 128 {
 		return 1 + (bits.Len64(i)+7)/8
 	}
 	return 1
 }
 
 func EncodeU64(i uint64, to []byte) int {
-	if i > 128 {
+	if i >= 128 {
 		beLen := (bits.Len64(i) + 7) / 8
 		to[0] = 128 + byte(beLen)
 		binary.BigEndian.PutUint64(to[1:], i)
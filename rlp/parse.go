@@ -14,19 +14,19 @@
    limitations under the License.
 */
 
+// Package rlp - parsing and encoding of RLP without allocations. Parse errors are of kind errkind.InvalidEncoding
 package rlp
 
 import (
-	"fmt"
-
 	"github.com/holiman/uint256"
+	"github.com/ledgerwatch/erigon-lib/common/errkind"
 )
 
 // BeInt parses Big Endian representation of an integer from given payload at given position
 func BeInt(payload []byte, pos, length int) (int, error) {
 	var r int
 	if length > 0 && payload[pos] == 0 {
-		return 0, fmt.Errorf("integer encoding for RLP must not have leading zeros: %x", payload[pos:pos+length])
+		return 0, errkind.Errorf(errkind.InvalidEncoding, "integer encoding for RLP must not have leading zeros: %x", payload[pos:pos+length])
 	}
 	for _, b := range payload[pos : pos+length] {
 		r = (r << 8) | int(b)
@@ -67,7 +67,7 @@ func Prefix(payload []byte, pos int) (dataPos int, dataLen int, isList bool, err
 	}
 	if err != nil {
 		if dataPos+dataLen >= len(payload) {
-			err = fmt.Errorf("unexpected end of payload")
+			err = errkind.Errorf(errkind.InvalidEncoding, "unexpected end of payload")
 		}
 	}
 	return
@@ -79,7 +79,7 @@ func List(payload []byte, pos int) (dataPos int, dataLen int, err error) {
 		return 0, 0, err
 	}
 	if !isList {
-		return 0, 0, fmt.Errorf("must be a list")
+		return 0, 0, errkind.Errorf(errkind.InvalidEncoding, "must be a list")
 	}
 	return
 }
@@ -90,7 +90,7 @@ func String(payload []byte, pos int) (dataPos int, dataLen int, err error) {
 		return 0, 0, err
 	}
 	if isList {
-		return 0, 0, fmt.Errorf("must be a string, instead of a list")
+		return 0, 0, errkind.Errorf(errkind.InvalidEncoding, "must be a string, instead of a list")
 	}
 	return
 }
@@ -100,7 +100,7 @@ func StringOfLen(payload []byte, pos, expectedLen int) (dataPos int, err error)
 		return 0, err
 	}
 	if dataLen != expectedLen {
-		return 0, fmt.Errorf("expected string of len %d, got %d", expectedLen, dataLen)
+		return 0, errkind.Errorf(errkind.InvalidEncoding, "expected string of len %d, got %d", expectedLen, dataLen)
 	}
 	return
 }
@@ -112,13 +112,13 @@ func U64(payload []byte, pos int) (int, uint64, error) {
 		return 0, 0, err
 	}
 	if isList {
-		return 0, 0, fmt.Errorf("uint64 must be a string, not isList")
+		return 0, 0, errkind.Errorf(errkind.InvalidEncoding, "uint64 must be a string, not isList")
 	}
 	if dataLen > 8 {
-		return 0, 0, fmt.Errorf("uint64 must not be more than 8 bytes long, got %d", dataLen)
+		return 0, 0, errkind.Errorf(errkind.InvalidEncoding, "uint64 must not be more than 8 bytes long, got %d", dataLen)
 	}
 	if dataLen > 0 && payload[dataPos] == 0 {
-		return 0, 0, fmt.Errorf("integer encoding for RLP must not have leading zeros: %x", payload[dataPos:dataPos+dataLen])
+		return 0, 0, errkind.Errorf(errkind.InvalidEncoding, "integer encoding for RLP must not have leading zeros: %x", payload[dataPos:dataPos+dataLen])
 	}
 	var r uint64
 	for _, b := range payload[dataPos : dataPos+dataLen] {
@@ -134,13 +134,13 @@ func U32(payload []byte, pos int) (int, uint32, error) {
 		return 0, 0, err
 	}
 	if isList {
-		return 0, 0, fmt.Errorf("uint32 must be a string, not isList")
+		return 0, 0, errkind.Errorf(errkind.InvalidEncoding, "uint32 must be a string, not isList")
 	}
 	if dataLen > 4 {
-		return 0, 0, fmt.Errorf("uint32 must not be more than 4 bytes long, got %d", dataLen)
+		return 0, 0, errkind.Errorf(errkind.InvalidEncoding, "uint32 must not be more than 4 bytes long, got %d", dataLen)
 	}
 	if dataLen > 0 && payload[dataPos] == 0 {
-		return 0, 0, fmt.Errorf("integer encoding for RLP must not have leading zeros: %x", payload[dataPos:dataPos+dataLen])
+		return 0, 0, errkind.Errorf(errkind.InvalidEncoding, "integer encoding for RLP must not have leading zeros: %x", payload[dataPos:dataPos+dataLen])
 	}
 	var r uint32
 	for _, b := range payload[dataPos : dataPos+dataLen] {
@@ -156,10 +156,10 @@ func U256(payload []byte, pos int, x *uint256.Int) (int, error) {
 		return 0, err
 	}
 	if dataLen > 32 {
-		return 0, fmt.Errorf("uint256 must not be more than 8 bytes long, got %d", dataLen)
+		return 0, errkind.Errorf(errkind.InvalidEncoding, "uint256 must not be more than 8 bytes long, got %d", dataLen)
 	}
 	if dataLen > 0 && payload[dataPos] == 0 {
-		return 0, fmt.Errorf("integer encoding for RLP must not have leading zeros: %x", payload[dataPos:dataPos+dataLen])
+		return 0, errkind.Errorf(errkind.InvalidEncoding, "integer encoding for RLP must not have leading zeros: %x", payload[dataPos:dataPos+dataLen])
 	}
 	x.SetBytes(payload[dataPos : dataPos+dataLen])
 	return dataPos + dataLen, nil
@@ -181,7 +181,7 @@ func U256Len(z *uint256.Int) int {
 func ParseHash(payload []byte, pos int, hashbuf []byte) (int, error) {
 	pos, err := StringOfLen(payload, pos, 32)
 	if err != nil {
-		return 0, fmt.Errorf("%s: hash len: %w", ParseHashErrorPrefix, err)
+		return 0, errkind.Errorf(errkind.InvalidEncoding, "%s: hash len: %w", ParseHashErrorPrefix, err)
 	}
 	copy(hashbuf, payload[pos:pos+32])
 	return pos + 32, nil
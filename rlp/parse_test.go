@@ -2,10 +2,13 @@ package rlp
 
 import (
 	"encoding/hex"
+	"errors"
 	"fmt"
 	"testing"
 
+	"github.com/ledgerwatch/erigon-lib/common/errkind"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func decodeHex(in string) []byte {
@@ -56,3 +59,29 @@ func TestPrimitives(t *testing.T) {
 		})
 	}
 }
+
+func TestErrorKind(t *testing.T) {
+	for _, payload := range []string{"c0", "890102030405060708", "8200ff"} {
+		_, _, err := U64(decodeHex(payload), 0)
+		require.True(t, errors.Is(err, errkind.InvalidEncoding), "%s: %v", payload, err)
+	}
+	_, err := ParseHash(decodeHex("820102"), 0, make([]byte, 32))
+	require.True(t, errors.Is(err, errkind.InvalidEncoding), "%v", err)
+}
+
+func TestEncodeU64(t *testing.T) {
+	// 128 is the first value which doesn't fit single byte: 0x80 is prefix of empty string
+	for _, tt := range []struct {
+		i       uint64
+		encoded string
+	}{{0, "80"}, {127, "7f"}, {128, "8180"}, {255, "81ff"}, {1024, "820400"}} {
+		to := make([]byte, 9)
+		n := EncodeU64(tt.i, to)
+		require.Equal(t, tt.encoded, fmt.Sprintf("%x", to[:n]), "%d", tt.i)
+		require.Equal(t, n, U64Len(tt.i), "%d", tt.i)
+		pos, res, err := U64(to[:n], 0)
+		require.NoError(t, err)
+		require.Equal(t, n, pos)
+		require.Equal(t, tt.i, res)
+	}
+}
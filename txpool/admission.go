@@ -0,0 +1,122 @@
+/*
+   Copyright 2021 Erigon contributors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package txpool
+
+import (
+	"github.com/VictoriaMetrics/metrics"
+	"github.com/holiman/uint256"
+	"github.com/ledgerwatch/erigon-lib/common"
+	"github.com/ledgerwatch/erigon-lib/kv"
+)
+
+var admissionRejected = metrics.GetOrCreateCounter(`pool_admission_rejected`)
+
+// Decision - result of Admission
+type Decision uint8
+
+const (
+	Admit  Decision = iota
+	Reject          // transaction is discarded with NotAdmitted reason
+)
+
+// SenderState - sender's account in state of latest block
+type SenderState struct {
+	Nonce   uint64
+	Balance uint256.Int
+}
+
+// Admission - embedder's policy of which transactions pool accepts: deny lists, chain-specific rules, etc.
+// Called for new local and remote transactions which passed pool's own checks, before insertion. Called under pool's lock -
+// must be fast and must not call pool
+type Admission func(tx *TxSlot, sender common.Address, state SenderState) Decision
+
+// AllOf - admits transaction if all policies admit it
+func AllOf(policies ...Admission) Admission {
+	return func(tx *TxSlot, sender common.Address, state SenderState) Decision {
+		for _, policy := range policies {
+			if policy(tx, sender, state) != Admit {
+				return Reject
+			}
+		}
+		return Admit
+	}
+}
+
+// DenySenders - rejects transactions of given senders
+func DenySenders(senders ...common.Address) Admission {
+	denied := make(map[common.Address]struct{}, len(senders))
+	for _, s := range senders {
+		denied[s] = struct{}{}
+	}
+	return func(tx *TxSlot, sender common.Address, state SenderState) Decision {
+		if _, ok := denied[sender]; ok {
+			return Reject
+		}
+		return Admit
+	}
+}
+
+// MaxDataLen - rejects transactions with bigger calldata
+func MaxDataLen(n int) Admission {
+	return func(tx *TxSlot, sender common.Address, state SenderState) Decision {
+		if tx.dataLen > n {
+			return Reject
+		}
+		return Admit
+	}
+}
+
+// Read-only access to fields of transaction, for Admission policies of embedders
+
+func (tx *TxSlot) Nonce() uint64        { return tx.nonce }
+func (tx *TxSlot) Tip() uint64          { return tx.tip }
+func (tx *TxSlot) FeeCap() uint64       { return tx.feeCap }
+func (tx *TxSlot) Gas() uint64          { return tx.gas }
+func (tx *TxSlot) Value() uint256.Int   { return tx.value }
+func (tx *TxSlot) IDHash() common.Hash  { return tx.idHash }
+func (tx *TxSlot) DataLen() int         { return tx.dataLen }
+func (tx *TxSlot) Type() byte           { return tx.txType }
+func (tx *TxSlot) BlobCount() int       { return tx.blobHashes.Len() }
+func (tx *TxSlot) Size() uint32         { return tx.size }
+func (tx *TxSlot) IsCreation() bool     { return tx.creation }
+func (tx *TxSlot) To() common.Address   { return tx.to } // zero for contract creation
+func (tx *TxSlot) AccessListLen() int   { return tx.alAddrCount + tx.alStorCount }
+func (tx *TxSlot) IntrinsicGas() uint64 { return tx.intrinsic }
+func (tx *TxSlot) BlobFeeCap() uint64   { return tx.blobFeeCap }
+
+// checkAdmission - sets NotAdmitted reason for transactions rejected by Config.Admission
+func (p *TxPool) checkAdmission(tx kv.Tx, txs TxSlots, reasons []DiscardReason) error {
+	if p.cfg.Admission == nil {
+		return nil
+	}
+	for i, txn := range txs.txs {
+		if reasons[i] != 0 {
+			continue
+		}
+		info, err := p.senders.info(txn.senderID, tx, false)
+		if err != nil {
+			return err
+		}
+		var sender common.Address
+		copy(sender[:], txs.senders.At(i))
+		if p.cfg.Admission(txn, sender, SenderState{Nonce: info.nonce, Balance: info.balance}) != Admit {
+			reasons[i] = NotAdmitted
+			admissionRejected.Inc()
+		}
+	}
+	return nil
+}
@@ -0,0 +1,71 @@
+/*
+   Copyright 2021 Erigon contributors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package txpool
+
+import (
+	"sort"
+
+	"github.com/ledgerwatch/erigon-lib/common"
+	"golang.org/x/crypto/sha3"
+)
+
+// Digest - canonical digest of pooled transactions, to compare pools of nodes. Pools with same transactions
+// have same digests if nodes agree about state and base fee. Private transactions are skipped
+type Digest struct {
+	Pending, BaseFee, Queued common.Hash // keccak256 of sorted hashes of transactions of sub-pool
+	All                      common.Hash // keccak256(Pending, BaseFee, Queued)
+
+	PendingCount, BaseFeeCount, QueuedCount int
+}
+
+func (p *TxPool) Digest() Digest {
+	p.lock.RLock()
+	pending := p.publicHashes(p.pending.best)
+	baseFee := p.publicHashes(*p.baseFee.best)
+	queued := p.publicHashes(*p.queued.best)
+	p.lock.RUnlock()
+
+	d := Digest{PendingCount: len(pending), BaseFeeCount: len(baseFee), QueuedCount: len(queued)}
+	d.Pending, d.BaseFee, d.Queued = sortedHash(pending), sortedHash(baseFee), sortedHash(queued)
+	h := sha3.NewLegacyKeccak256()
+	h.Write(d.Pending[:])
+	h.Write(d.BaseFee[:])
+	h.Write(d.Queued[:])
+	h.Sum(d.All[:0])
+	return d
+}
+
+func (p *TxPool) publicHashes(txs []*metaTx) []string {
+	res := make([]string, 0, len(txs))
+	for _, mt := range txs {
+		if _, ok := p.private[string(mt.Tx.idHash[:])]; ok {
+			continue
+		}
+		res = append(res, string(mt.Tx.idHash[:]))
+	}
+	return res
+}
+
+func sortedHash(hashes []string) (res [32]byte) {
+	sort.Strings(hashes)
+	h := sha3.NewLegacyKeccak256()
+	for _, hash := range hashes {
+		h.Write([]byte(hash))
+	}
+	h.Sum(res[:0])
+	return res
+}
@@ -0,0 +1,155 @@
+/*
+   Copyright 2021 Erigon contributors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package txpool
+
+import (
+	"sync"
+	"sync/atomic"
+
+	"github.com/VictoriaMetrics/metrics"
+	"github.com/ledgerwatch/erigon-lib/common"
+)
+
+var eventsDroppedCounter = metrics.GetOrCreateCounter(`pool_events_dropped`)
+
+// EventType - values are same as of txpool.EventsReply_Type
+type EventType uint8
+
+const (
+	EventAdded    EventType = 0 // new transaction added to pool
+	EventReplaced EventType = 1 // transaction replaced by transaction with same sender and nonce
+	EventPromoted EventType = 2 // transaction moved to pending sub-pool from queued or base fee sub-pools
+	EventDropped  EventType = 3 // transaction removed from pool, see Reason
+	EventMined    EventType = 4 // transaction removed from pool because it (or next transaction of sender) is mined
+	EventReorged  EventType = 5 // transaction returned to pool from unwinded block
+)
+
+func (t EventType) String() string {
+	switch t {
+	case EventAdded:
+		return "added"
+	case EventReplaced:
+		return "replaced"
+	case EventPromoted:
+		return "promoted"
+	case EventDropped:
+		return "dropped"
+	case EventMined:
+		return "mined"
+	case EventReorged:
+		return "reorged"
+	default:
+		return "unknown"
+	}
+}
+
+// Event - lifecycle event of pooled transaction
+type Event struct {
+	Type   EventType
+	IdHash common.Hash
+	Reason DiscardReason // for EventDropped, EventReplaced and EventMined
+	Seq    uint64        // of event for subscriber, starting from 1: gap - events were dropped
+}
+
+// poolEvents - delivers events to subscribers. Pool emits events under its lock - so delivery never blocks:
+// events are dropped for subscribers which don't read them fast enough, they see gap in Event.Seq
+type poolEvents struct {
+	lock        sync.Mutex
+	subscribers map[uint]*eventsSub
+	id          uint
+	count       int32 // amount of subscribers - to not build events if nobody listens
+
+	private func(idHash []byte) bool // events of private transactions are not sent, see AddPrivate. Called under pool lock
+}
+
+type eventsSub struct {
+	ch  chan<- Event
+	seq uint64 // of last event, sent or dropped
+}
+
+func (e *poolEvents) subscribe(ch chan<- Event) (unsubscribe func()) {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	if e.subscribers == nil {
+		e.subscribers = map[uint]*eventsSub{}
+	}
+	e.id++
+	id := e.id
+	e.subscribers[id] = &eventsSub{ch: ch}
+	atomic.AddInt32(&e.count, 1)
+	return func() {
+		e.lock.Lock()
+		defer e.lock.Unlock()
+		if _, ok := e.subscribers[id]; ok {
+			delete(e.subscribers, id)
+			atomic.AddInt32(&e.count, -1)
+		}
+	}
+}
+
+func (e *poolEvents) enabled() bool { return atomic.LoadInt32(&e.count) > 0 }
+
+func (e *poolEvents) send(ev Event) {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	for _, sub := range e.subscribers {
+		sub.seq++
+		ev.Seq = sub.seq
+		select {
+		case sub.ch <- ev:
+		default:
+			eventsDroppedCounter.Inc()
+		}
+	}
+}
+
+func (e *poolEvents) added(idHash []byte, reorged bool) {
+	if !e.enabled() {
+		return
+	}
+	ev := Event{Type: EventAdded}
+	if reorged {
+		ev.Type = EventReorged
+	}
+	copy(ev.IdHash[:], idHash)
+	e.send(ev)
+}
+
+func (e *poolEvents) promoted(mt *metaTx) {
+	if !e.enabled() || e.private(mt.Tx.idHash[:]) {
+		return
+	}
+	e.send(Event{Type: EventPromoted, IdHash: mt.Tx.idHash})
+}
+
+func (e *poolEvents) discarded(mt *metaTx, reason DiscardReason) {
+	if !e.enabled() || e.private(mt.Tx.idHash[:]) {
+		return
+	}
+	ev := Event{Type: EventDropped, IdHash: mt.Tx.idHash, Reason: reason}
+	switch reason {
+	case Mined:
+		ev.Type = EventMined
+	case ReplacedByHigherTip:
+		ev.Type = EventReplaced
+	}
+	e.send(ev)
+}
+
+// SubscribeEvents - lifecycle events of pooled transactions are sent to ch, without blocking: if ch is full - events
+// are dropped, gap in Event.Seq shows it. Call unsubscribe to stop
+func (p *TxPool) SubscribeEvents(ch chan<- Event) (unsubscribe func()) { return p.events.subscribe(ch) }
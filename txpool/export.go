@@ -0,0 +1,167 @@
+/*
+   Copyright 2021 Erigon contributors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package txpool
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ledgerwatch/erigon-lib/kv"
+)
+
+// Export file format - text, one transaction per line, fields are labeled: "label=value", separated by spaces.
+// Lines starting with "#" are comments, first line is exportHeader. Unknown labels are ignored - to add fields later.
+//
+//	# erigon txpool export v1
+//	sender=0x<20 bytes> local=true private=false seen=<RFC3339Nano> rlp=0x<transaction as in p2p messages>
+const exportHeader = "# erigon txpool export v1"
+
+// Export - writes all pooled transactions with their metadata, to move pool to other node by Import.
+// Transactions of each sender are ordered by nonce
+func (p *TxPool) Export(tx kv.Tx, w io.Writer) (exported int, err error) {
+	content, err := p.Content(tx, true)
+	if err != nil {
+		return 0, err
+	}
+	bw := bufio.NewWriter(w)
+	if _, err := fmt.Fprintln(bw, exportHeader); err != nil {
+		return 0, err
+	}
+	for _, sender := range content {
+		for _, txs := range [][]ContentTx{sender.Pending, sender.Queued} {
+			for _, t := range txs {
+				if _, err := fmt.Fprintf(bw, "sender=0x%x local=%t private=%t seen=%s rlp=0x%x\n", sender.Sender[:], t.Local, t.Private, t.Added.UTC().Format(time.RFC3339Nano), t.Rlp); err != nil {
+					return exported, err
+				}
+				exported++
+			}
+		}
+	}
+	return exported, bw.Flush()
+}
+
+// Import - adds transactions written by Export. Transactions are validated as new ones, senders are recovered and
+// compared with exported. Local and private flags and time of first seen (if earlier than now) are kept
+func (p *TxPool) Import(ctx context.Context, r io.Reader, tx kv.Tx) (imported int, err error) {
+	txs, private, seen, err := readExport(r)
+	if err != nil {
+		return 0, err
+	}
+
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	marked := p.markPrivate(txs, private)
+	defer p.unmarkNotAdded(marked)
+	reasons, err := p.addTxsLocked(ctx, txs, tx)
+	if err != nil {
+		return 0, err
+	}
+	for i := range txs.txs {
+		if reasons[i] != Success {
+			continue
+		}
+		mt, ok := p.byHash[string(txs.txs[i].idHash[:])]
+		if !ok {
+			continue
+		}
+		if !seen[i].IsZero() && seen[i].Before(mt.added) {
+			mt.added = seen[i]
+		}
+		imported++
+	}
+	return imported, nil
+}
+
+func readExport(r io.Reader) (txs TxSlots, private []bool, seen []time.Time, err error) {
+	parseCtx := NewTxParseContext()
+	br := bufio.NewReader(r)
+	for lineNum := 1; ; lineNum++ {
+		line, err := br.ReadString('\n')
+		if err != nil && err != io.EOF {
+			return txs, nil, nil, err
+		}
+		if lineNum == 1 && strings.TrimSpace(line) != exportHeader {
+			return txs, nil, nil, fmt.Errorf("import: unknown format, expected header %q", exportHeader)
+		}
+		if line = strings.TrimSpace(line); line != "" && !strings.HasPrefix(line, "#") {
+			txn, sender, flags, t, err := parseExportLine(parseCtx, line)
+			if err != nil {
+				return txs, nil, nil, fmt.Errorf("import, line %d: %w", lineNum, err)
+			}
+			txs.Append(txn, sender, flags.local)
+			private = append(private, flags.private)
+			seen = append(seen, t)
+		}
+		if err == io.EOF {
+			return txs, private, seen, nil
+		}
+	}
+}
+
+func parseExportLine(parseCtx *TxParseContext, line string) (txn *TxSlot, sender []byte, flags exportFlags, seen time.Time, err error) {
+	var exportedSender, rlpTx []byte
+	for _, field := range strings.Fields(line) {
+		label := strings.SplitN(field, "=", 2)
+		if len(label) != 2 {
+			return nil, nil, flags, seen, fmt.Errorf("field without label: %q", field)
+		}
+		switch label[0] {
+		case "sender":
+			if exportedSender, err = hex.DecodeString(strings.TrimPrefix(label[1], "0x")); err != nil {
+				return nil, nil, flags, seen, fmt.Errorf("sender: %w", err)
+			}
+		case "local":
+			if flags.local, err = strconv.ParseBool(label[1]); err != nil {
+				return nil, nil, flags, seen, fmt.Errorf("local: %w", err)
+			}
+		case "private":
+			if flags.private, err = strconv.ParseBool(label[1]); err != nil {
+				return nil, nil, flags, seen, fmt.Errorf("private: %w", err)
+			}
+		case "seen":
+			if seen, err = time.Parse(time.RFC3339Nano, label[1]); err != nil {
+				return nil, nil, flags, seen, fmt.Errorf("seen: %w", err)
+			}
+		case "rlp":
+			if rlpTx, err = hex.DecodeString(strings.TrimPrefix(label[1], "0x")); err != nil {
+				return nil, nil, flags, seen, fmt.Errorf("rlp: %w", err)
+			}
+		}
+	}
+	if len(rlpTx) == 0 {
+		return nil, nil, flags, seen, fmt.Errorf("no rlp")
+	}
+	txn, sender = &TxSlot{}, make([]byte, 20)
+	if _, err = parseCtx.ParseTransaction(rlpTx, 0, txn, sender); err != nil {
+		return nil, nil, flags, seen, err
+	}
+	if exportedSender != nil && !bytes.Equal(exportedSender, sender) {
+		return nil, nil, flags, seen, fmt.Errorf("sender mismatch: exported %x, recovered %x", exportedSender, sender)
+	}
+	return txn, sender, flags, seen, nil
+}
+
+type exportFlags struct {
+	local, private bool
+}
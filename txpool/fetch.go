@@ -21,14 +21,18 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"runtime"
 	"sync"
 	"time"
 
+	"github.com/ledgerwatch/erigon-lib/common"
+	"github.com/ledgerwatch/erigon-lib/common/clock"
+	"github.com/ledgerwatch/erigon-lib/common/logging"
 	"github.com/ledgerwatch/erigon-lib/gointerfaces"
 	"github.com/ledgerwatch/erigon-lib/gointerfaces/remote"
 	"github.com/ledgerwatch/erigon-lib/gointerfaces/sentry"
 	"github.com/ledgerwatch/erigon-lib/kv"
-	"github.com/ledgerwatch/log/v3"
+	"go.uber.org/atomic"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
@@ -48,7 +52,11 @@ type Fetch struct {
 	wg                   *sync.WaitGroup // used for synchronisation in the tests (nil when not in tests)
 	stateChangesClient   remote.KVClient
 	stateChangesParseCtx *TxParseContext
-	pooledTxsParseCtx    *TxParseContext
+	pooledTxsParser      *ParallelParser // recovers senders of batches by workers
+	peerScores           *peerScores
+	pendingBaseFee       atomic.Uint64 // of pending block from last state changes, 0 - not seen yet
+	logger               logging.Logger
+	clock                clock.Clock
 }
 
 // NewFetch creates a new fetch object that will work with given sentry clients. Since the
@@ -63,7 +71,10 @@ func NewFetch(ctx context.Context, sentryClients []sentry.SentryClient, pool Poo
 		db:                   db,
 		stateChangesClient:   stateChangesClient,
 		stateChangesParseCtx: NewTxParseContext(),
-		pooledTxsParseCtx:    NewTxParseContext(),
+		pooledTxsParser:      NewParallelParser(runtime.GOMAXPROCS(0)),
+		peerScores:           newPeerScores(DefaultPeerScoreConfig),
+		logger:               logging.Root(),
+		clock:                clock.Real,
 	}
 }
 
@@ -71,6 +82,33 @@ func (f *Fetch) SetWaitGroup(wg *sync.WaitGroup) {
 	f.wg = wg
 }
 
+// SetLogger - nil is logging.Root()
+func (f *Fetch) SetLogger(logger logging.Logger) {
+	f.logger = logging.OrRoot(logger)
+}
+
+// SetClock - time of peer scores, must be called before ConnectSentries
+func (f *Fetch) SetClock(c clock.Clock) {
+	f.clock = clock.Or(c)
+}
+
+// SetPeerScoreConfig - must be called before ConnectSentries
+func (f *Fetch) SetPeerScoreConfig(cfg PeerScoreConfig) {
+	f.peerScores = newPeerScores(cfg)
+}
+
+// misbehave - counts misbehaviour of peer and asks sentry to disconnect peer if it reached limit
+func (f *Fetch) misbehave(ctx context.Context, sentryClient sentry.SentryClient, peerID PeerID, invalid, underpriced, duplicate int) error {
+	if !f.peerScores.misbehave(peerID, invalid, underpriced, duplicate, f.clock.Now()) {
+		return nil
+	}
+	f.logger.Debug("[txpool] kick peer", "invalid", invalid, "underpriced", underpriced, "duplicate", duplicate)
+	if _, err := sentryClient.PenalizePeer(ctx, &sentry.PenalizePeerRequest{PeerId: peerID, Penalty: sentry.PenaltyKind_Kick}); err != nil {
+		return fmt.Errorf("penalize peer: %w", err)
+	}
+	return nil
+}
+
 // ConnectSentries initialises connection to the sentry
 func (f *Fetch) ConnectSentries() {
 	for i := range f.sentryClients {
@@ -98,7 +136,7 @@ func (f *Fetch) ConnectCore() {
 				if errors.Is(err, io.EOF) || errors.Is(err, context.Canceled) {
 					continue
 				}
-				log.Warn("[txpool.handleStateChanges]", "err", err)
+				f.logger.Warn("[txpool.handleStateChanges]", "err", err)
 			}
 		}
 	}()
@@ -120,7 +158,7 @@ func (f *Fetch) receiveMessageLoop(sentryClient sentry.SentryClient) {
 				continue
 			}
 			// Report error and wait more
-			log.Warn("[txpool.recvMessage] sentry not ready yet", "err", err)
+			f.logger.Warn("[txpool.recvMessage] sentry not ready yet", "err", err)
 			continue
 		}
 
@@ -132,7 +170,7 @@ func (f *Fetch) receiveMessageLoop(sentryClient sentry.SentryClient) {
 			if errors.Is(err, io.EOF) || errors.Is(err, context.Canceled) {
 				continue
 			}
-			log.Warn("[txpool.recvMessage]", "err", err)
+			f.logger.Warn("[txpool.recvMessage]", "err", err)
 		}
 	}
 }
@@ -149,6 +187,7 @@ func (f *Fetch) receiveMessage(ctx context.Context, sentryClient sentry.SentryCl
 		sentry.MessageId_GET_POOLED_TRANSACTIONS_66,
 		sentry.MessageId_TRANSACTIONS_66,
 		sentry.MessageId_POOLED_TRANSACTIONS_66,
+		sentry.MessageId_NEW_POOLED_TRANSACTION_HASHES_68,
 	}}, grpc.WaitForReady(true))
 	if err != nil {
 		select {
@@ -180,7 +219,7 @@ func (f *Fetch) receiveMessage(ctx context.Context, sentryClient sentry.SentryCl
 			if errors.Is(err, io.EOF) || errors.Is(err, context.Canceled) {
 				continue
 			}
-			log.Warn("Handling incoming message", "err", err)
+			f.logger.Warn("Handling incoming message", "err", err)
 		}
 		if f.wg != nil {
 			f.wg.Done()
@@ -202,16 +241,19 @@ func (f *Fetch) handleInboundMessage(ctx context.Context, req *sentry.InboundMes
 	case sentry.MessageId_NEW_POOLED_TRANSACTION_HASHES_66, sentry.MessageId_NEW_POOLED_TRANSACTION_HASHES_65:
 		hashCount, pos, err := ParseHashesCount(req.Data, 0)
 		if err != nil {
+			_ = f.misbehave(ctx, sentryClient, req.PeerId, 1, 0, 0)
 			return fmt.Errorf("parsing NewPooledTransactionHashes: %w", err)
 		}
+		hashCount = f.peerScores.announce(req.PeerId, hashCount, f.clock.Now())
 		var hashbuf [32]byte
 		var unknownHashes Hashes
 		for i := 0; i < hashCount; i++ {
 			_, pos, err = ParseHash(req.Data, pos, hashbuf[:0])
 			if err != nil {
+				_ = f.misbehave(ctx, sentryClient, req.PeerId, 1, 0, 0)
 				return fmt.Errorf("parsing NewPooledTransactionHashes: %w", err)
 			}
-			known, err := f.pool.IdHashKnown(tx, hashbuf[:])
+			known, err := f.pool.IdHashKnown(tx, hashbuf)
 			if err != nil {
 				return err
 			}
@@ -220,21 +262,39 @@ func (f *Fetch) handleInboundMessage(ctx context.Context, req *sentry.InboundMes
 			}
 		}
 		if len(unknownHashes) > 0 {
-			var encodedRequest []byte
-			var messageId sentry.MessageId
-			if req.Id == sentry.MessageId_NEW_POOLED_TRANSACTION_HASHES_66 {
-				if encodedRequest, err = EncodeGetPooledTransactions66(unknownHashes, uint64(1), nil); err != nil {
+			if err := f.requestPooledTxs(sentryClient, req.PeerId, unknownHashes, req.Id == sentry.MessageId_NEW_POOLED_TRANSACTION_HASHES_65); err != nil {
+				return err
+			}
+		}
+	case sentry.MessageId_NEW_POOLED_TRANSACTION_HASHES_68:
+		_, sizes, hashes, _, err := ParseAnnouncements68(req.Data, 0)
+		if err != nil {
+			_ = f.misbehave(ctx, sentryClient, req.PeerId, 1, 0, 0)
+			return fmt.Errorf("parsing NewPooledTransactionHashes68: %w", err)
+		}
+		// request unknown transactions by batches: sum of announced sizes in batch doesn't exceed p2pTxPacketLimit
+		var unknownHashes Hashes
+		var batchSize uint64
+		for i, n := 0, f.peerScores.announce(req.PeerId, len(sizes), f.clock.Now()); i < n; i++ {
+			hash := hashes[i*32 : (i+1)*32]
+			known, err := f.pool.IdHashKnown(tx, common.BytesToHash(hash))
+			if err != nil {
+				return err
+			}
+			if known {
+				continue
+			}
+			if len(unknownHashes) > 0 && batchSize+uint64(sizes[i]) > p2pTxPacketLimit {
+				if err := f.requestPooledTxs(sentryClient, req.PeerId, unknownHashes, false); err != nil {
 					return err
 				}
-				messageId = sentry.MessageId_GET_POOLED_TRANSACTIONS_66
-			} else {
-				encodedRequest = EncodeHashes(unknownHashes, nil)
-				messageId = sentry.MessageId_GET_POOLED_TRANSACTIONS_65
+				unknownHashes, batchSize = unknownHashes[:0], 0
 			}
-			if _, err = sentryClient.SendMessageById(f.ctx, &sentry.SendMessageByIdRequest{
-				Data:   &sentry.OutboundMessageData{Id: messageId, Data: encodedRequest},
-				PeerId: req.PeerId,
-			}, &grpc.EmptyCallOption{}); err != nil {
+			unknownHashes = append(unknownHashes, hash...)
+			batchSize += uint64(sizes[i])
+		}
+		if len(unknownHashes) > 0 {
+			if err := f.requestPooledTxs(sentryClient, req.PeerId, unknownHashes, false); err != nil {
 				return err
 			}
 		}
@@ -253,7 +313,11 @@ func (f *Fetch) handleInboundMessage(ctx context.Context, req *sentry.InboundMes
 			_ = requestID
 			var txs [][]byte
 			for i := 0; i < len(hashes); i += 32 {
-				txn, err := f.pool.GetRlp(tx, hashes[i:i+32])
+				hash := common.BytesToHash(hashes[i : i+32])
+				if f.pool.IsPrivate(hash) {
+					continue
+				}
+				txn, err := f.pool.GetRlp(tx, hash)
 				if err != nil {
 					return err
 				}
@@ -271,7 +335,11 @@ func (f *Fetch) handleInboundMessage(ctx context.Context, req *sentry.InboundMes
 			}
 			var txs [][]byte
 			for i := 0; i < len(hashes); i += 32 {
-				txn, err := f.pool.GetRlp(tx, hashes[i:i+32])
+				hash := common.BytesToHash(hashes[i : i+32])
+				if f.pool.IsPrivate(hash) {
+					continue
+				}
+				txn, err := f.pool.GetRlp(tx, hash)
 				if err != nil {
 					return err
 				}
@@ -290,20 +358,44 @@ func (f *Fetch) handleInboundMessage(ctx context.Context, req *sentry.InboundMes
 		}
 	case sentry.MessageId_POOLED_TRANSACTIONS_65, sentry.MessageId_POOLED_TRANSACTIONS_66:
 		txs := TxSlots{}
-		f.pooledTxsParseCtx.Reject(func(hash []byte) bool {
-			known, _ := f.pool.IdHashKnown(tx, hash)
+		var duplicates atomic.Int32 // Reject is called by workers of parser
+		f.pooledTxsParser.Reject(func(hash []byte) bool {
+			known, _ := f.pool.IdHashKnown(tx, common.BytesToHash(hash))
+			if known && !f.peerScores.wasRequested(hash) {
+				duplicates.Inc()
+			}
 			return known
 		})
 
-		if req.Id == sentry.MessageId_GET_POOLED_TRANSACTIONS_66 {
-			if _, err := ParsePooledTransactions65(req.Data, 0, f.pooledTxsParseCtx, &txs); err != nil {
-				return err
-			}
+		if req.Id == sentry.MessageId_POOLED_TRANSACTIONS_65 {
+			_, err = ParsePooledTransactions65(req.Data, 0, f.pooledTxsParser, &txs)
 		} else {
-			if _, _, err := ParsePooledTransactions66(req.Data, 0, f.pooledTxsParseCtx, &txs); err != nil {
-				return err
+			_, _, err = ParsePooledTransactions66(req.Data, 0, f.pooledTxsParser, &txs)
+		}
+		if err != nil {
+			_ = f.misbehave(ctx, sentryClient, req.PeerId, 1, 0, int(duplicates.Load()))
+			return err
+		}
+		reasons := make([]DiscardReason, len(txs.txs))
+		var invalid, underpriced int
+		for i := range txs.txs {
+			if txs.txs[i].blobHashes.Len() > 0 && !txs.txs[i].withSidecar { // pooled blob transactions are sent with sidecar
+				reasons[i] = BlobsRejected
+				invalid++
+			}
+		}
+		// underpriced are still added: pool keeps them in base fee sub-pool, but they are spam while base fee is high
+		if pendingBaseFee := f.pendingBaseFee.Load(); pendingBaseFee > 0 {
+			for i := range txs.txs {
+				if reasons[i] == 0 && txs.txs[i].feeCap < pendingBaseFee {
+					underpriced++
+				}
 			}
 		}
+		if err := f.misbehave(ctx, sentryClient, req.PeerId, invalid, underpriced, int(duplicates.Load())); err != nil {
+			return err
+		}
+		txs = filterTxs(txs, reasons)
 		if len(txs.txs) == 0 {
 			return nil
 		}
@@ -315,6 +407,27 @@ func (f *Fetch) handleInboundMessage(ctx context.Context, req *sentry.InboundMes
 	return nil
 }
 
+// requestPooledTxs - sends GetPooledTransactions request to peer
+func (f *Fetch) requestPooledTxs(sentryClient sentry.SentryClient, peerID PeerID, hashes Hashes, eth65 bool) error {
+	f.peerScores.requesting(hashes)
+	var encodedRequest []byte
+	messageId := sentry.MessageId_GET_POOLED_TRANSACTIONS_66
+	if eth65 {
+		encodedRequest = EncodeHashes(hashes, nil)
+		messageId = sentry.MessageId_GET_POOLED_TRANSACTIONS_65
+	} else {
+		var err error
+		if encodedRequest, err = EncodeGetPooledTransactions66(hashes, uint64(1), nil); err != nil {
+			return err
+		}
+	}
+	_, err := sentryClient.SendMessageById(f.ctx, &sentry.SendMessageByIdRequest{
+		Data:   &sentry.OutboundMessageData{Id: messageId, Data: encodedRequest},
+		PeerId: peerID,
+	}, &grpc.EmptyCallOption{})
+	return err
+}
+
 func retryLater(code codes.Code) bool {
 	return code == codes.Unavailable || code == codes.Canceled || code == codes.ResourceExhausted
 }
@@ -335,7 +448,7 @@ func (f *Fetch) receivePeerLoop(sentryClient sentry.SentryClient) {
 				continue
 			}
 			// Report error and wait more
-			log.Warn("[txpool.recvPeers] sentry not ready yet", "err", err)
+			f.logger.Warn("[txpool.recvPeers] sentry not ready yet", "err", err)
 			time.Sleep(time.Second)
 			continue
 		}
@@ -348,7 +461,7 @@ func (f *Fetch) receivePeerLoop(sentryClient sentry.SentryClient) {
 				continue
 			}
 
-			log.Warn("[txpool.recvPeers]", "err", err)
+			f.logger.Warn("[txpool.recvPeers]", "err", err)
 		}
 	}
 }
@@ -391,6 +504,8 @@ func (f *Fetch) handleNewPeer(req *sentry.PeersReply) error {
 	switch req.Event {
 	case sentry.PeersReply_Connect:
 		f.pool.AddNewGoodPeer(req.PeerId)
+	case sentry.PeersReply_Disconnect:
+		f.peerScores.disconnected(req.PeerId)
 	}
 
 	return nil
@@ -417,7 +532,7 @@ func (f *Fetch) handleStateChanges(ctx context.Context, client remote.KVClient)
 			for i := range req.Txs {
 				minedTxs.txs[i] = &TxSlot{}
 				if _, err := f.stateChangesParseCtx.ParseTransaction(req.Txs[i], 0, minedTxs.txs[i], minedTxs.senders.At(i)); err != nil {
-					log.Warn("stream.Recv", "err", err)
+					f.logger.Warn("stream.Recv", "err", err)
 					continue
 				}
 			}
@@ -427,23 +542,26 @@ func (f *Fetch) handleStateChanges(ctx context.Context, client remote.KVClient)
 			for i := range req.Txs {
 				unwindTxs.txs[i] = &TxSlot{}
 				if _, err := f.stateChangesParseCtx.ParseTransaction(req.Txs[i], 0, unwindTxs.txs[i], unwindTxs.senders.At(i)); err != nil {
-					log.Warn("stream.Recv", "err", err)
+					f.logger.Warn("stream.Recv", "err", err)
 					continue
 				}
 			}
 		}
+		if req.ProtocolBaseFee > 0 { // it's base fee of pending block, see OnNewBlock
+			f.pendingBaseFee.Store(req.ProtocolBaseFee)
+		}
 		diff := map[string]senderInfo{}
 		for _, change := range req.Changes {
 			nonce, balance, err := DecodeSender(change.Data)
 			if err != nil {
-				log.Warn("stateChanges.decodeSender", "err", err)
+				f.logger.Warn("stateChanges.decodeSender", "err", err)
 				continue
 			}
 			addr := gointerfaces.ConvertH160toAddress(change.Address)
 			diff[string(addr[:])] = senderInfo{nonce: nonce, balance: balance}
 		}
-		if err := f.pool.OnNewBlock(diff, unwindTxs, minedTxs, req.ProtocolBaseFee, req.BlockHeight, gointerfaces.ConvertH256ToHash(req.BlockHash)); err != nil {
-			log.Warn("onNewBlock", "err", err)
+		if err := f.pool.OnNewBlock(diff, unwindTxs, minedTxs, req.ProtocolBaseFee, req.PendingBlobFeePerGas, req.BlockHeight, gointerfaces.ConvertH256ToHash(req.BlockHash)); err != nil {
+			f.logger.Warn("onNewBlock", "err", err)
 		}
 		if f.wg != nil {
 			f.wg.Done()
@@ -22,12 +22,16 @@ import (
 	"io"
 	"sync"
 	"testing"
+	"time"
 
+	grpc_middleware "github.com/grpc-ecosystem/go-grpc-middleware"
+	"github.com/ledgerwatch/erigon-lib/common"
 	"github.com/ledgerwatch/erigon-lib/direct"
 	"github.com/ledgerwatch/erigon-lib/gointerfaces"
 	"github.com/ledgerwatch/erigon-lib/gointerfaces/remote"
 	"github.com/ledgerwatch/erigon-lib/gointerfaces/sentry"
 	"github.com/ledgerwatch/erigon-lib/gointerfaces/types"
+	"github.com/ledgerwatch/erigon-lib/kv"
 	"github.com/ledgerwatch/erigon-lib/kv/memdb"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -64,6 +68,234 @@ func TestFetch(t *testing.T) {
 
 }
 
+func TestFetchPeerScores(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	require := require.New(t)
+
+	m := NewMockSentry(ctx)
+	sentryClient := direct.NewSentryClientDirect(direct.ETH66, m)
+	known := false
+	pool := &PoolMock{
+		StartedFunc:     func() bool { return true },
+		IdHashKnownFunc: func(tx kv.Tx, hash common.Hash) (bool, error) { return known, nil },
+	}
+	fetch := NewFetch(ctx, []sentry.SentryClient{sentryClient}, pool, &remote.KVClientMock{}, nil, memdb.NewTestPoolDB(t))
+	fetch.SetPeerScoreConfig(PeerScoreConfig{Window: time.Hour, MaxAnnounce: 2, KickScore: 100, Invalid: 100, Underpriced: 10, Duplicate: 40})
+	var wg sync.WaitGroup
+	fetch.SetWaitGroup(&wg)
+	m.StreamWg.Add(2)
+	fetch.ConnectSentries()
+	m.StreamWg.Wait()
+	send := func(id sentry.MessageId, data []byte) {
+		wg.Add(1)
+		for _, err := range m.Send(&sentry.InboundMessage{Id: id, Data: data, PeerId: PeerId}) {
+			require.NoError(err)
+		}
+		wg.Wait()
+	}
+
+	// announces above limit are ignored
+	send(sentry.MessageId_NEW_POOLED_TRANSACTION_HASHES_66, EncodeHashes(toHashes([32]byte{1}, [32]byte{2}, [32]byte{3}), nil))
+	require.Equal(1, len(m.SendMessageByIdCalls()))
+	expectRequest, err := EncodeGetPooledTransactions66(toHashes([32]byte{1}, [32]byte{2}), 1, nil)
+	require.NoError(err)
+	require.Equal(expectRequest, m.SendMessageByIdCalls()[0].SendMessageByIdRequest.Data.Data)
+
+	txs := EncodePooledTransactions66(ptp66EncodeTests[0].txs, 1, nil)
+	known = true
+	send(sentry.MessageId_POOLED_TRANSACTIONS_66, txs) // 2 duplicates
+	require.Equal(0, len(m.PenalizePeerCalls()))
+
+	known = false
+	fetch.pendingBaseFee.Store(1 << 40)
+	send(sentry.MessageId_POOLED_TRANSACTIONS_66, txs) // 2 underpriced
+	require.Equal(1, len(m.PenalizePeerCalls()))
+	require.Equal(sentry.PenaltyKind_Kick, m.PenalizePeerCalls()[0].PenalizePeerRequest.Penalty)
+	require.Equal(1, len(pool.AddRemoteTxsCalls())) // pool decides where underpriced go
+
+	send(sentry.MessageId_POOLED_TRANSACTIONS_66, []byte{1, 2, 3}) // kicked peer is forgotten, invalid message - kick again
+	require.Equal(2, len(m.PenalizePeerCalls()))
+
+	fetch.pendingBaseFee.Store(1)
+	send(sentry.MessageId_POOLED_TRANSACTIONS_66, txs)
+	require.Equal(2, len(pool.AddRemoteTxsCalls()))
+	require.Equal(2, len(m.PenalizePeerCalls()))
+}
+
+func TestFetchPooledTransactions65(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	require := require.New(t)
+
+	m := NewMockSentry(ctx)
+	pool := &PoolMock{
+		StartedFunc:     func() bool { return true },
+		IdHashKnownFunc: func(tx kv.Tx, hash common.Hash) (bool, error) { return false, nil },
+	}
+	fetch := NewFetch(ctx, []sentry.SentryClient{direct.NewSentryClientDirect(direct.ETH65, m)}, pool, &remote.KVClientMock{}, nil, memdb.NewTestPoolDB(t))
+	var wg sync.WaitGroup
+	fetch.SetWaitGroup(&wg)
+	m.StreamWg.Add(2)
+	fetch.ConnectSentries()
+	m.StreamWg.Wait()
+
+	// eth/65 reply has no request id: it must be parsed by its own message id, not as eth/66
+	wg.Add(1)
+	for _, err := range m.Send(&sentry.InboundMessage{Id: sentry.MessageId_POOLED_TRANSACTIONS_65, Data: EncodePooledTransactions65(ptp66EncodeTests[0].txs, nil), PeerId: PeerId}) {
+		require.NoError(err)
+	}
+	wg.Wait()
+	require.Equal(1, len(pool.AddRemoteTxsCalls()))
+	require.Equal(len(ptp66EncodeTests[0].txs), len(pool.AddRemoteTxsCalls()[0].NewTxs.txs))
+	require.Equal(0, len(m.PenalizePeerCalls()))
+}
+
+func TestFetchPooledBlobTxs(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	require := require.New(t)
+
+	m := NewMockSentry(ctx)
+	pool := &PoolMock{
+		StartedFunc:     func() bool { return true },
+		IdHashKnownFunc: func(tx kv.Tx, hash common.Hash) (bool, error) { return false, nil },
+	}
+	fetch := NewFetch(ctx, []sentry.SentryClient{direct.NewSentryClientDirect(direct.ETH68, m)}, pool, &remote.KVClientMock{}, nil, memdb.NewTestPoolDB(t))
+	var wg sync.WaitGroup
+	fetch.SetWaitGroup(&wg)
+	m.StreamWg.Add(2)
+	fetch.ConnectSentries()
+	m.StreamWg.Wait()
+
+	// blob transaction without sidecar can't be served to other peers: peer sent invalid reply
+	wg.Add(1)
+	for _, err := range m.Send(&sentry.InboundMessage{Id: sentry.MessageId_POOLED_TRANSACTIONS_66, Data: EncodePooledTransactions66([][]byte{blobTx(t, 1, 1, false), blobTx(t, 2, 1, true)}, 1, nil), PeerId: PeerId}) {
+		require.NoError(err)
+	}
+	wg.Wait()
+	require.Equal(1, len(m.PenalizePeerCalls()))
+	require.Equal(1, len(pool.AddRemoteTxsCalls()))
+	require.Equal(1, len(pool.AddRemoteTxsCalls()[0].NewTxs.txs))
+	require.True(pool.AddRemoteTxsCalls()[0].NewTxs.txs[0].withSidecar)
+}
+
+func TestDefaultPeerScores(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	require := require.New(t)
+
+	m := NewMockSentry(ctx)
+	pool := &PoolMock{
+		StartedFunc:     func() bool { return true },
+		IdHashKnownFunc: func(tx kv.Tx, hash common.Hash) (bool, error) { return true, nil },
+	}
+	fetch := NewFetch(ctx, []sentry.SentryClient{direct.NewSentryClientDirect(direct.ETH66, m)}, pool, &remote.KVClientMock{}, nil, memdb.NewTestPoolDB(t))
+	var wg sync.WaitGroup
+	fetch.SetWaitGroup(&wg)
+	m.StreamWg.Add(2)
+	fetch.ConnectSentries()
+	m.StreamWg.Wait()
+	flood := func(data []byte, n int) {
+		for i := 0; i < n; i++ {
+			wg.Add(1)
+			for _, err := range m.Send(&sentry.InboundMessage{Id: sentry.MessageId_POOLED_TRANSACTIONS_66, Data: data, PeerId: PeerId}) {
+				require.NoError(err)
+			}
+			wg.Wait()
+		}
+	}
+	txs := ptp66EncodeTests[0].txs
+	data := EncodePooledTransactions66(txs, 1, nil)
+
+	// busy honest peer: requested transactions arrived from other peers before its reply
+	var requested Hashes
+	for i := range txs {
+		txn := &TxSlot{}
+		_, err := NewTxParseContext().ParseTransaction(txs[i], 0, txn, make([]byte, 20))
+		require.NoError(err)
+		requested = append(requested, txn.idHash[:]...)
+	}
+	fetch.peerScores.requesting(requested)
+	flood(data, 100)
+	require.Equal(0, len(m.PenalizePeerCalls()))
+
+	// known transactions which nobody requested
+	fetch.SetPeerScoreConfig(DefaultPeerScoreConfig)
+	flood(data, DefaultPeerScoreConfig.KickScore/len(txs)/DefaultPeerScoreConfig.Duplicate)
+	require.Equal(1, len(m.PenalizePeerCalls()))
+
+	// transactions which can't be included while base fee is high
+	pool.IdHashKnownFunc = func(tx kv.Tx, hash common.Hash) (bool, error) { return false, nil }
+	fetch.pendingBaseFee.Store(1 << 40)
+	flood(data, DefaultPeerScoreConfig.KickScore/len(txs)/DefaultPeerScoreConfig.Underpriced)
+	require.Equal(2, len(m.PenalizePeerCalls()))
+}
+
+func TestFetchAnnouncements68(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	require := require.New(t)
+
+	m := NewMockSentry(ctx)
+	pool := &PoolMock{
+		StartedFunc:     func() bool { return true },
+		IdHashKnownFunc: func(tx kv.Tx, hash common.Hash) (bool, error) { return hash[0] == 3, nil },
+	}
+	fetch := NewFetch(ctx, []sentry.SentryClient{direct.NewSentryClientDirect(direct.ETH68, m)}, pool, &remote.KVClientMock{}, nil, memdb.NewTestPoolDB(t))
+	var wg sync.WaitGroup
+	fetch.SetWaitGroup(&wg)
+	m.StreamWg.Add(2)
+	fetch.ConnectSentries()
+	m.StreamWg.Wait()
+
+	// unknown transactions are requested by batches of limited size
+	wg.Add(1)
+	hashes := toHashes([32]byte{1}, [32]byte{2}, [32]byte{3}, [32]byte{4})
+	data := EncodeAnnouncements68([]byte{2, 2, 2, 3}, []uint32{60 * 1024, 30 * 1024, 1, 50 * 1024}, hashes, nil)
+	for _, err := range m.Send(&sentry.InboundMessage{Id: sentry.MessageId_NEW_POOLED_TRANSACTION_HASHES_68, Data: data, PeerId: PeerId}) {
+		require.NoError(err)
+	}
+	wg.Wait()
+	calls := m.SendMessageByIdCalls()
+	require.Equal(2, len(calls))
+	for i, expect := range []Hashes{toHashes([32]byte{1}, [32]byte{2}), toHashes([32]byte{4})} {
+		require.Equal(sentry.MessageId_GET_POOLED_TRANSACTIONS_66, calls[i].SendMessageByIdRequest.Data.Id)
+		request, err := EncodeGetPooledTransactions66(expect, 1, nil)
+		require.NoError(err)
+		require.Equal(request, calls[i].SendMessageByIdRequest.Data.Data)
+	}
+}
+
+func TestFetchWrappedStreams(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	require := require.New(t)
+
+	m := NewMockSentry(ctx)
+	sentryClient := direct.NewSentryClientDirect(direct.ETH66, m)
+	sentryClient.SetInterceptors(nil, func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		return handler(srv, grpc_middleware.WrapServerStream(ss))
+	})
+	pool := &PoolMock{
+		StartedFunc:     func() bool { return true },
+		IdHashKnownFunc: func(tx kv.Tx, hash common.Hash) (bool, error) { return true, nil },
+	}
+	fetch := NewFetch(ctx, []sentry.SentryClient{sentryClient}, pool, &remote.KVClientMock{}, nil, memdb.NewTestPoolDB(t))
+	var wg sync.WaitGroup
+	fetch.SetWaitGroup(&wg)
+	m.StreamWg.Add(2)
+	fetch.ConnectSentries()
+	m.StreamWg.Wait()
+
+	wg.Add(1)
+	for _, err := range m.Send(&sentry.InboundMessage{Id: sentry.MessageId_NEW_POOLED_TRANSACTION_HASHES_66, Data: EncodeHashes(toHashes([32]byte{1}), nil), PeerId: PeerId}) {
+		require.NoError(err)
+	}
+	wg.Wait()
+	require.Equal(1, len(pool.IdHashKnownCalls()))
+}
+
 func TestSendTxPropagate(t *testing.T) {
 	ctx, cancelFn := context.WithCancel(context.Background())
 	defer cancelFn()
@@ -109,6 +341,61 @@ func TestSendTxPropagate(t *testing.T) {
 		assert.Equal(t, sentry.MessageId_NEW_POOLED_TRANSACTION_HASHES_66, first.Id)
 		assert.Equal(t, 68, len(first.Data))
 	})
+	t.Run("eth/68 announces types and sizes", func(t *testing.T) {
+		m := NewMockSentry(ctx)
+		pool := &PoolMock{AnnouncementsFunc: func(hashes Hashes) ([]byte, []uint32, Hashes) {
+			return []byte{2}, []uint32{100}, hashes[32:]
+		}}
+		send := NewSend(ctx, []SentryClient{direct.NewSentryClientDirect(direct.ETH68, m)}, pool)
+		send.BroadcastRemotePooledTxs(toHashes([32]byte{1}, [32]byte{42}))
+
+		calls := m.SendMessageToRandomPeersCalls()
+		require.Equal(t, 1, len(calls))
+		first := calls[0].SendMessageToRandomPeersRequest.Data
+		assert.Equal(t, sentry.MessageId_NEW_POOLED_TRANSACTION_HASHES_68, first.Id)
+		assert.Equal(t, EncodeAnnouncements68([]byte{2}, []uint32{100}, toHashes([32]byte{42}), nil), first.Data)
+	})
+	t.Run("eth/68 local byHash, one sentry fails", func(t *testing.T) {
+		failing, working := NewMockSentry(ctx), NewMockSentry(ctx)
+		failing.SendMessageToAllFunc = func(context.Context, *sentry.OutboundMessageData) (*sentry.SentPeers, error) {
+			return nil, fmt.Errorf("sentry is down")
+		}
+		working.SendMessageToAllFunc = func(context.Context, *sentry.OutboundMessageData) (*sentry.SentPeers, error) {
+			return &sentry.SentPeers{Peers: make([]*types.H512, 3)}, nil
+		}
+		pool := &PoolMock{AnnouncementsFunc: func(hashes Hashes) ([]byte, []uint32, Hashes) {
+			return []byte{2, 2}, []uint32{100, 100}, hashes
+		}}
+		send := NewSend(ctx, []SentryClient{direct.NewSentryClientDirect(direct.ETH68, failing), direct.NewSentryClientDirect(direct.ETH68, working)}, pool)
+		require.Equal(t, 3, send.BroadcastLocalPooledTxs(toHashes([32]byte{1}, [32]byte{42})))
+		require.Equal(t, 1, len(working.SendMessageToAllCalls()))
+	})
+	t.Run("blob transactions are announced to eth/68 peers only", func(t *testing.T) {
+		m66, m68 := NewMockSentry(ctx), NewMockSentry(ctx)
+		pool := &PoolMock{AnnouncementsFunc: func(hashes Hashes) (types []byte, sizes []uint32, known Hashes) {
+			for i := 0; i < len(hashes); i += 32 {
+				if hashes[i] == 42 {
+					types, sizes = append(types, byte(BlobTxType)), append(sizes, 200_000)
+				} else {
+					types, sizes = append(types, 2), append(sizes, 100)
+				}
+			}
+			return types, sizes, hashes
+		}}
+		send := NewSend(ctx, []SentryClient{direct.NewSentryClientDirect(direct.ETH66, m66), direct.NewSentryClientDirect(direct.ETH68, m68)}, pool)
+		send.BroadcastRemotePooledTxs(toHashes([32]byte{1}, [32]byte{42}))
+
+		calls := m66.SendMessageToRandomPeersCalls()
+		require.Equal(t, 1, len(calls))
+		assert.Equal(t, EncodeHashes(toHashes([32]byte{1}), nil), calls[0].SendMessageToRandomPeersRequest.Data.Data)
+		calls = m68.SendMessageToRandomPeersCalls()
+		require.Equal(t, 1, len(calls))
+		assert.Equal(t, EncodeAnnouncements68([]byte{2, byte(BlobTxType)}, []uint32{100, 200_000}, toHashes([32]byte{1}, [32]byte{42}), nil), calls[0].SendMessageToRandomPeersRequest.Data.Data)
+
+		// nothing to announce to eth/66 peers
+		send.BroadcastRemotePooledTxs(toHashes([32]byte{42}))
+		require.Equal(t, 1, len(m66.SendMessageToRandomPeersCalls()))
+	})
 	t.Run("sync with new peer", func(t *testing.T) {
 		m := NewMockSentry(ctx)
 
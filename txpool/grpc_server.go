@@ -2,6 +2,7 @@ package txpool
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"net"
 	"sync"
@@ -9,11 +10,13 @@ import (
 
 	grpc_middleware "github.com/grpc-ecosystem/go-grpc-middleware"
 	grpc_recovery "github.com/grpc-ecosystem/go-grpc-middleware/recovery"
+	"github.com/ledgerwatch/erigon-lib/common"
+	"github.com/ledgerwatch/erigon-lib/common/logging"
 	"github.com/ledgerwatch/erigon-lib/gointerfaces"
+	"github.com/ledgerwatch/erigon-lib/gointerfaces/grpcutil"
 	txpool_proto "github.com/ledgerwatch/erigon-lib/gointerfaces/txpool"
 	types2 "github.com/ledgerwatch/erigon-lib/gointerfaces/types"
 	"github.com/ledgerwatch/erigon-lib/kv"
-	"github.com/ledgerwatch/log/v3"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/credentials"
 	"google.golang.org/grpc/keepalive"
@@ -21,14 +24,27 @@ import (
 )
 
 // TxPoolAPIVersion
-var TxPoolAPIVersion = &types2.VersionReply{Major: 1, Minor: 0, Patch: 0}
+// 1.1.0 - Added Content and Inspect
+// 1.2.0 - Added Events
+// 1.3.0 - Added AddRequest.private
+// 1.4.0 - Added Digest
+// 1.5.0 - Implemented FindUnknown
+// 1.6.0 - Added EventsReply.sequence
+// Bump it in gointerfaces.TxPoolService, together with features
+var TxPoolAPIVersion = gointerfaces.TxPoolService.Version.Proto()
 
 type txPool interface {
-	GetRlp(tx kv.Tx, hash []byte) ([]byte, error)
+	GetRlp(tx kv.Tx, hash common.Hash) ([]byte, error)
 	AddLocals(ctx context.Context, newTxs TxSlots, tx kv.Tx) ([]DiscardReason, error)
+	AddPrivate(ctx context.Context, newTxs TxSlots, tx kv.Tx) ([]DiscardReason, error)
 	DeprecatedForEach(_ context.Context, f func(rlp, sender []byte, t SubPoolType), tx kv.Tx) error
 	CountContent() (int, int, int)
-	IdHashKnown(tx kv.Tx, hash []byte) (bool, error)
+	Content(tx kv.Tx, withRlp bool) ([]SenderContent, error)
+	Digest() Digest
+	SubscribeEvents(ch chan<- Event) (unsubscribe func())
+	IdHashKnown(tx kv.Tx, hash common.Hash) (bool, error)
+	IdHashPooled(tx kv.Tx, hash common.Hash) (bool, error)
+	IsPrivate(idHash common.Hash) bool
 }
 
 type GrpcServer struct {
@@ -78,25 +94,26 @@ func (s *GrpcServer) All(ctx context.Context, _ *txpool_proto.AllRequest) (*txpo
 	return reply, nil
 }
 
+// FindUnknown - hashes which are not known to pool: neither pooled, nor recently rejected
 func (s *GrpcServer) FindUnknown(ctx context.Context, in *txpool_proto.TxHashes) (*txpool_proto.TxHashes, error) {
-	return nil, fmt.Errorf("unimplemented")
-	/*
-		var underpriced int
-		for i := range in.Hashes {
-			h := gointerfaces.ConvertH256ToHash(in.Hashes[i])
-			if s.txPool.Has(h) {
-				continue
-			}
-			if s.underpriced.Contains(h) {
-				underpriced++
-				continue
-			}
-			reply.Hashes = append(reply.Hashes, in.Hashes[i])
+	tx, err := s.db.BeginRo(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	hashes := Hashes(gointerfaces.AppendH256s(make([]byte, 0, 32*len(in.Hashes)), in.Hashes))
+	var unknown Hashes
+	for i := 0; i < hashes.Len(); i++ {
+		known, err := s.txPool.IdHashKnown(tx, hashes.Hash(i))
+		if err != nil {
+			return nil, err
+		}
+		if !known {
+			unknown = append(unknown, hashes.At(i)...)
 		}
-		txAnnounceInMeter.Mark(int64(len(in.Hashes)))
-		txAnnounceKnownMeter.Mark(int64(len(in.Hashes) - len(reply.Hashes)))
-		txAnnounceUnderpricedMeter.Mark(int64(underpriced))
-	*/
+	}
+	return &txpool_proto.TxHashes{Hashes: gointerfaces.ConvertHashesToH256s(unknown)}, nil
 }
 
 func (s *GrpcServer) Add(ctx context.Context, in *txpool_proto.AddRequest) (*txpool_proto.AddReply, error) {
@@ -106,52 +123,57 @@ func (s *GrpcServer) Add(ctx context.Context, in *txpool_proto.AddRequest) (*txp
 	}
 	defer tx.Rollback()
 
+	reply := &txpool_proto.AddReply{Imported: make([]txpool_proto.ImportResult, len(in.RlpTxs)), Errors: make([]string, len(in.RlpTxs))}
 	var slots TxSlots
-	slots.Resize(uint(len(in.RlpTxs)))
+	var slotIdx []int // index of slot in request
 	parseCtx := NewTxParseContext()
 	parseCtx.Reject(func(hash []byte) bool {
-		known, _ := s.txPool.IdHashKnown(tx, hash)
+		known, _ := s.txPool.IdHashPooled(tx, common.BytesToHash(hash))
 		return known
 	})
 	for i := range in.RlpTxs {
-		slots.txs[i] = &TxSlot{}
-		slots.isLocal[i] = true
-		if _, err := parseCtx.ParseTransaction(in.RlpTxs[i], 0, slots.txs[i], slots.senders.At(i)); err != nil {
-			log.Warn("stream.Recv", "err", err)
+		j := len(slots.txs)
+		slots.Resize(uint(j + 1))
+		slots.txs[j] = &TxSlot{}
+		slots.isLocal[j] = true
+		if _, err := parseCtx.ParseTransaction(in.RlpTxs[i], 0, slots.txs[j], slots.senders.At(j)); err != nil {
+			slots.Resize(uint(j))
+			if errors.Is(err, ErrRejected) {
+				reply.Imported[i] = txpool_proto.ImportResult_ALREADY_EXISTS
+				reply.Errors[i] = AlreadyKnown.String()
+				continue
+			}
+			reply.Imported[i] = txpool_proto.ImportResult_INVALID
+			reply.Errors[i] = err.Error()
 			continue
 		}
+		slotIdx = append(slotIdx, i)
 	}
 
-	reply := &txpool_proto.AddReply{Imported: make([]txpool_proto.ImportResult, len(in.RlpTxs)), Errors: make([]string, len(in.RlpTxs))}
-	discardReasons, err := s.txPool.AddLocals(ctx, slots, tx)
+	add := s.txPool.AddLocals
+	if in.Private {
+		add = s.txPool.AddPrivate
+	}
+	discardReasons, err := add(ctx, slots, tx)
 	if err != nil {
 		return nil, err
 	}
-	//TODO: concept of discardReasons not really implemented yet
-	_ = discardReasons
-	/*
-		for i, err := range discardReasons {
-			if err == nil {
-				continue
-			}
-
-			reply.Errors[i] = err.Error()
-
-			// Track a few interesting failure types
-			switch err {
-			case Success: // Noop, but need to handle to not count these
-
-			//case core.ErrAlreadyKnown:
-			//	reply.Imported[i] = txpool_proto.ImportResult_ALREADY_EXISTS
-			//case core.ErrUnderpriced, core.ErrReplaceUnderpriced:
-			//	reply.Imported[i] = txpool_proto.ImportResult_FEE_TOO_LOW
-			//case core.ErrInvalidSender, core.ErrGasLimit, core.ErrNegativeValue, core.ErrOversizedData:
-			//	reply.Imported[i] = txpool_proto.ImportResult_INVALID
-			default:
-				reply.Imported[i] = txpool_proto.ImportResult_INTERNAL_ERROR
-			}
+	for j, reason := range discardReasons {
+		i := slotIdx[j]
+		if reason == Success {
+			reply.Imported[i] = txpool_proto.ImportResult_SUCCESS
+			continue
+		}
+		reply.Errors[i] = reason.String()
+		switch reason {
+		case AlreadyKnown:
+			reply.Imported[i] = txpool_proto.ImportResult_ALREADY_EXISTS
+		case UnderPriced, ReplaceUnderpriced, FeeTooLow:
+			reply.Imported[i] = txpool_proto.ImportResult_FEE_TOO_LOW
+		default:
+			reply.Imported[i] = txpool_proto.ImportResult_INVALID
 		}
-	*/
+	}
 	return reply, nil
 }
 
@@ -167,6 +189,31 @@ func (s *GrpcServer) OnAdd(req *txpool_proto.OnAddRequest, stream txpool_proto.T
 	}
 }
 
+func (s *GrpcServer) Events(req *txpool_proto.EventsRequest, stream txpool_proto.Txpool_EventsServer) error {
+	events := make(chan Event, 1024)
+	unsubscribe := s.txPool.SubscribeEvents(events)
+	defer unsubscribe()
+	reply := &txpool_proto.EventsReply{Hash: &types2.H256{}}
+	for {
+		select {
+		case <-stream.Context().Done():
+			return stream.Context().Err()
+		case <-s.ctx.Done():
+			return s.ctx.Err()
+		case ev := <-events:
+			// Send marshals reply before return, so it's reused for all events of stream
+			reply.Type, reply.Reason, reply.Sequence = txpool_proto.EventsReply_Type(ev.Type), "", ev.Seq
+			gointerfaces.SetH256(reply.Hash, ev.IdHash)
+			if ev.Reason != 0 {
+				reply.Reason = ev.Reason.String()
+			}
+			if err := stream.Send(reply); err != nil {
+				return err
+			}
+		}
+	}
+}
+
 func (s *GrpcServer) Transactions(ctx context.Context, in *txpool_proto.TransactionsRequest) (*txpool_proto.TransactionsReply, error) {
 	tx, err := s.db.BeginRo(ctx)
 	if err != nil {
@@ -177,7 +224,10 @@ func (s *GrpcServer) Transactions(ctx context.Context, in *txpool_proto.Transact
 	reply := &txpool_proto.TransactionsReply{RlpTxs: make([][]byte, len(in.Hashes))}
 	for i := range in.Hashes {
 		h := gointerfaces.ConvertH256ToHash(in.Hashes[i])
-		txnRlp, err := s.txPool.GetRlp(tx, h[:])
+		if s.txPool.IsPrivate(h) { // replied as unknown
+			continue
+		}
+		txnRlp, err := s.txPool.GetRlp(tx, h)
 		if err != nil {
 			return nil, err
 		}
@@ -196,6 +246,108 @@ func (s *GrpcServer) Status(_ context.Context, _ *txpool_proto.StatusRequest) (*
 	}, nil
 }
 
+func (s *GrpcServer) Digest(_ context.Context, _ *txpool_proto.DigestRequest) (*txpool_proto.DigestReply, error) {
+	d := s.txPool.Digest()
+	return &txpool_proto.DigestReply{
+		Pending:      gointerfaces.ConvertHashToH256(d.Pending),
+		BaseFee:      gointerfaces.ConvertHashToH256(d.BaseFee),
+		Queued:       gointerfaces.ConvertHashToH256(d.Queued),
+		All:          gointerfaces.ConvertHashToH256(d.All),
+		PendingCount: uint32(d.PendingCount),
+		BaseFeeCount: uint32(d.BaseFeeCount),
+		QueuedCount:  uint32(d.QueuedCount),
+	}, nil
+}
+
+// publicContent - content without private transactions, senders without transactions are skipped
+func publicContent(content []SenderContent) []SenderContent {
+	public := func(txs []ContentTx) []ContentTx {
+		res := txs[:0]
+		for i := range txs {
+			if !txs[i].Private {
+				res = append(res, txs[i])
+			}
+		}
+		return res
+	}
+	res := content[:0]
+	for _, sender := range content {
+		sender.Pending, sender.Queued = public(sender.Pending), public(sender.Queued)
+		if len(sender.Pending)+len(sender.Queued) > 0 {
+			res = append(res, sender)
+		}
+	}
+	return res
+}
+
+func (s *GrpcServer) Content(ctx context.Context, _ *txpool_proto.ContentRequest) (*txpool_proto.ContentReply, error) {
+	tx, err := s.db.BeginRo(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+	content, err := s.txPool.Content(tx, true)
+	if err != nil {
+		return nil, err
+	}
+	content = publicContent(content)
+	var arena gointerfaces.Arena
+	convert := func(txs []ContentTx) []*txpool_proto.ContentReply_Tx {
+		res := make([]*txpool_proto.ContentReply_Tx, len(txs))
+		for i := range txs {
+			res[i] = &txpool_proto.ContentReply_Tx{Nonce: txs[i].Nonce, RlpTx: copyBytes(txs[i].Rlp)}
+		}
+		return res
+	}
+	reply := &txpool_proto.ContentReply{Senders: make([]*txpool_proto.ContentReply_Sender, len(content))}
+	for i := range content {
+		reply.Senders[i] = &txpool_proto.ContentReply_Sender{
+			Address: arena.H160(content[i].Sender),
+			Pending: convert(content[i].Pending),
+			Queued:  convert(content[i].Queued),
+		}
+	}
+	return reply, nil
+}
+
+func (s *GrpcServer) Inspect(ctx context.Context, _ *txpool_proto.InspectRequest) (*txpool_proto.InspectReply, error) {
+	tx, err := s.db.BeginRo(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+	content, err := s.txPool.Content(tx, false)
+	if err != nil {
+		return nil, err
+	}
+	content = publicContent(content)
+	var arena gointerfaces.Arena // reply can be large: hashes and values allocated by chunks
+	convert := func(txs []ContentTx) []*txpool_proto.InspectReply_Tx {
+		res := make([]*txpool_proto.InspectReply_Tx, len(txs))
+		for i := range txs {
+			res[i] = &txpool_proto.InspectReply_Tx{
+				Nonce:    txs[i].Nonce,
+				Hash:     arena.H256(txs[i].IdHash),
+				Value:    arena.Uint256(&txs[i].Value),
+				Gas:      txs[i].Gas,
+				FeeCap:   txs[i].FeeCap,
+				Tip:      txs[i].Tip,
+				Creation: txs[i].Creation,
+			}
+		}
+		return res
+	}
+	reply := &txpool_proto.InspectReply{Senders: make([]*txpool_proto.InspectReply_Sender, len(content))}
+	for i := range content {
+		reply.Senders[i] = &txpool_proto.InspectReply_Sender{
+			Address: arena.H160(content[i].Sender),
+			Pending: convert(content[i].Pending),
+			Queued:  convert(content[i].Queued),
+		}
+	}
+	return reply, nil
+}
+
 // NewSlotsStreams - it's safe to use this class as non-pointer
 type NewSlotsStreams struct {
 	chans map[uint]txpool_proto.Txpool_OnAddServer
@@ -221,7 +373,7 @@ func (s *NewSlotsStreams) Broadcast(reply *txpool_proto.OnAddReply) {
 	for id, stream := range s.chans {
 		err := stream.Send(reply)
 		if err != nil {
-			log.Debug("failed send to mined block stream", "err", err)
+			logging.Root().Debug("failed send to mined block stream", "err", err)
 			select {
 			case <-stream.Context().Done():
 				delete(s.chans, id)
@@ -253,6 +405,8 @@ func StartGrpc(txPoolServer txpool_proto.TxpoolServer, miningServer txpool_proto
 	)
 	streamInterceptors = append(streamInterceptors, grpc_recovery.StreamServerInterceptor())
 	unaryInterceptors = append(unaryInterceptors, grpc_recovery.UnaryServerInterceptor())
+	streamInterceptors = append(streamInterceptors, grpcutil.TracingStreamServerInterceptor())
+	unaryInterceptors = append(unaryInterceptors, grpcutil.TracingUnaryServerInterceptor())
 
 	//if metrics.Enabled {
 	//	streamInterceptors = append(streamInterceptors, grpc_prometheus.StreamServerInterceptor)
@@ -294,9 +448,9 @@ func StartGrpc(txPoolServer txpool_proto.TxpoolServer, miningServer txpool_proto
 
 	go func() {
 		if err := grpcServer.Serve(lis); err != nil {
-			log.Error("private RPC server fail", "err", err)
+			logging.Root().Error("private RPC server fail", "err", err)
 		}
 	}()
-	log.Info("Started gRPC server", "on", addr)
+	logging.Root().Info("Started gRPC server", "on", addr)
 	return grpcServer, nil
 }
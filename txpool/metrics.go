@@ -0,0 +1,148 @@
+/*
+   Copyright 2021 Erigon contributors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package txpool
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/VictoriaMetrics/metrics"
+	"go.uber.org/atomic"
+)
+
+// Metrics - embedder's sink of pool metrics, to wire them to its monitoring (e.g. registry of Prometheus client).
+// Metrics of pool are registered in default registry of VictoriaMetrics anyway: embedder may expose them
+// (together with other metrics of the process) in Prometheus text format by metrics.WritePrometheus
+type Metrics interface {
+	Added(local bool)
+	Rejected(reason DiscardReason)  // new transaction, which was not added
+	Discarded(reason DiscardReason) // transaction, which left the pool
+	SubPoolSizes(pending, baseFee, queued int)
+	Validated(took time.Duration)        // validation of batch of new transactions
+	Propagated(took time.Duration)       // from adding to pool to broadcast
+	Flushed(write, commit time.Duration) // write of pool to db and commit of db transaction
+}
+
+var (
+	pendingSizeGauge    = newGauge(`pool_subpool_size{subpool="pending"}`)
+	baseFeeSizeGauge    = newGauge(`pool_subpool_size{subpool="base_fee"}`)
+	queuedSizeGauge     = newGauge(`pool_subpool_size{subpool="queued"}`)
+	slotsGauge          = newGauge(`pool_slots`) // see GlobalSlots
+	addedLocalCounter   = metrics.GetOrCreateCounter(`pool_added{kind="local"}`)
+	addedRemoteCounter  = metrics.GetOrCreateCounter(`pool_added{kind="remote"}`)
+	validationTimer     = metrics.GetOrCreateSummary(`pool_validation`)
+	propagationTimer    = metrics.GetOrCreateSummary(`pool_propagation`) // from adding to pool to broadcast
+	flushWriteTimer     = metrics.GetOrCreateSummary(`pool_flush_seconds{phase="write"}`)
+	flushCommitTimer    = metrics.GetOrCreateSummary(`pool_flush_seconds{phase="commit"}`)
+	rejectedByReason    [256]*metrics.Counter // new transactions, which were not added
+	discardedByReason   [256]*metrics.Counter // transactions, which left the pool: mined, replaced, evicted
+	reasonLabelReplacer = strings.NewReplacer(" ", "_")
+)
+
+func init() {
+	for r := Success + 1; r != 0; r++ {
+		if strings.HasPrefix(r.String(), "unknown") {
+			continue
+		}
+		label := reasonLabelReplacer.Replace(r.String())
+		rejectedByReason[r] = metrics.GetOrCreateCounter(fmt.Sprintf(`pool_rejected{reason=%q}`, label))
+		discardedByReason[r] = metrics.GetOrCreateCounter(fmt.Sprintf(`pool_evicted{reason=%q}`, label))
+	}
+}
+
+// gauge - value which goes up and down. VictoriaMetrics gauge is callback, Counter.Set would expose it as counter
+type gauge struct{ v atomic.Uint64 }
+
+func newGauge(name string) *gauge {
+	g := &gauge{}
+	metrics.GetOrCreateGauge(name, func() float64 { return float64(g.v.Load()) })
+	return g
+}
+
+func (g *gauge) Set(v uint64) { g.v.Store(v) }
+func (g *gauge) Get() uint64  { return g.v.Load() }
+
+func (p *TxPool) countRejected(reason DiscardReason) {
+	if c := rejectedByReason[reason]; c != nil {
+		c.Inc()
+		if p.cfg.Metrics != nil {
+			p.cfg.Metrics.Rejected(reason)
+		}
+	}
+}
+
+func (p *TxPool) countDiscarded(reason DiscardReason) {
+	if c := discardedByReason[reason]; c != nil {
+		c.Inc()
+		if p.cfg.Metrics != nil {
+			p.cfg.Metrics.Discarded(reason)
+		}
+	}
+}
+
+func (p *TxPool) countAdded(isLocal bool) {
+	if isLocal {
+		addedLocalCounter.Inc()
+	} else {
+		addedRemoteCounter.Inc()
+	}
+	if p.cfg.Metrics != nil {
+		p.cfg.Metrics.Added(isLocal)
+	}
+}
+
+func (p *TxPool) observeValidation(start time.Time) {
+	validationTimer.UpdateDuration(start)
+	if p.cfg.Metrics != nil {
+		p.cfg.Metrics.Validated(time.Since(start))
+	}
+}
+
+func (p *TxPool) observeFlush(write, commit time.Duration) {
+	flushWriteTimer.Update(write.Seconds())
+	flushCommitTimer.Update(commit.Seconds())
+	if p.cfg.Metrics != nil {
+		p.cfg.Metrics.Flushed(write, commit)
+	}
+}
+
+func (p *TxPool) updateSizeMetrics() {
+	pendingSizeGauge.Set(uint64(p.pending.Len()))
+	baseFeeSizeGauge.Set(uint64(p.baseFee.Len()))
+	queuedSizeGauge.Set(uint64(p.queued.Len()))
+	slotsGauge.Set(p.txNonce2Tx.slots)
+	if p.cfg.Metrics != nil {
+		p.cfg.Metrics.SubPoolSizes(p.pending.Len(), p.baseFee.Len(), p.queued.Len())
+	}
+}
+
+// observePropagation - time between adding of transactions and their broadcast
+func (p *TxPool) observePropagation(hashes Hashes) {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+	now := p.clock.Now()
+	for i := 0; i < hashes.Len(); i++ {
+		if mt, ok := p.byHash[string(hashes.At(i))]; ok {
+			took := now.Sub(mt.added)
+			propagationTimer.Update(took.Seconds())
+			if p.cfg.Metrics != nil {
+				p.cfg.Metrics.Propagated(took)
+			}
+		}
+	}
+}
@@ -0,0 +1,119 @@
+/*
+   Copyright 2021 Erigon contributors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package txpool
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	"github.com/ledgerwatch/erigon-lib/common/logging"
+	"github.com/ledgerwatch/erigon-lib/kv"
+)
+
+// PoolFormatVersionKey - version of layout of txpool tables, stored in kv.PoolInfo
+var PoolFormatVersionKey = []byte("pool_format_version")
+
+// poolMigrations[i] - converts txpool tables from format version i to i+1. On any incompatible change of layout
+// append the migration: PoolFormatVersion follows it
+var poolMigrations = []func(tx kv.RwTx, logger logging.Logger) error{
+	migrateUnversioned,
+}
+
+// PoolFormatVersion - format version of txpool tables written by this version of the library
+var PoolFormatVersion = uint64(len(poolMigrations))
+
+var ErrPoolFormatTooNew = errors.New("txpool db is written by newer version, which format is not supported")
+
+// migratePoolDB - checks format version of txpool tables and applies migrations which are required to reach
+// version len(migrations). Empty db is just marked by current version
+func migratePoolDB(tx kv.RwTx, logger logging.Logger, migrations []func(tx kv.RwTx, logger logging.Logger) error) error {
+	target := uint64(len(migrations))
+	v, err := tx.GetOne(kv.PoolInfo, PoolFormatVersionKey)
+	if err != nil {
+		return err
+	}
+	var version uint64
+	if len(v) == 8 {
+		version = binary.BigEndian.Uint64(v)
+	} else {
+		empty, err := isPoolDBEmpty(tx)
+		if err != nil {
+			return err
+		}
+		if empty {
+			version = target
+		}
+	}
+	if version > target {
+		return fmt.Errorf("%w: version %d, supported %d", ErrPoolFormatTooNew, version, target)
+	}
+	for ; version < target; version++ {
+		logger.Info("[txpool] migrating db", "from", version, "to", version+1)
+		if err = migrations[version](tx, logger); err != nil {
+			return fmt.Errorf("txpool db migration from version %d: %w", version, err)
+		}
+	}
+	encVersion := make([]byte, 8)
+	binary.BigEndian.PutUint64(encVersion, version)
+	return tx.Put(kv.PoolInfo, PoolFormatVersionKey, encVersion)
+}
+
+func isPoolDBEmpty(tx kv.Tx) (bool, error) {
+	for _, table := range []string{kv.PoolInfo, kv.PoolTransaction} {
+		c, err := tx.Cursor(table)
+		if err != nil {
+			return false, err
+		}
+		k, _, err := c.First()
+		c.Close()
+		if err != nil {
+			return false, err
+		}
+		if k != nil {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// migrateUnversioned - pools written before format versioning may have transactions, which current parser doesn't
+// accept (e.g. blob transactions of earlier forks): they are dropped one by one, instead of failing load of the whole pool
+func migrateUnversioned(tx kv.RwTx, logger logging.Logger) error {
+	parseCtx := NewTxParseContext()
+	parseCtx.WithSender(false)
+	var broken [][]byte
+	if err := tx.ForEach(kv.PoolTransaction, nil, func(k, v []byte) error {
+		if len(v) < 8 {
+			broken = append(broken, copyBytes(k))
+			return nil
+		}
+		if _, err := parseCtx.ParseTransaction(v[8:], 0, &TxSlot{}, nil); err != nil {
+			logger.Warn("[txpool] dropping unsupported transaction", "hash", fmt.Sprintf("%x", k), "err", err)
+			broken = append(broken, copyBytes(k))
+		}
+		return nil
+	}); err != nil {
+		return err
+	}
+	for _, k := range broken {
+		if err := tx.Delete(kv.PoolTransaction, k, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
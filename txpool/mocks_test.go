@@ -5,6 +5,7 @@ package txpool
 
 import (
 	"context"
+	"github.com/ledgerwatch/erigon-lib/common"
 	"github.com/ledgerwatch/erigon-lib/kv"
 	"sync"
 )
@@ -15,34 +16,40 @@ var _ Pool = &PoolMock{}
 
 // PoolMock is a mock implementation of Pool.
 //
-// 	func TestSomethingThatUsesPool(t *testing.T) {
+//	func TestSomethingThatUsesPool(t *testing.T) {
 //
-// 		// make and configure a mocked Pool
-// 		mockedPool := &PoolMock{
-// 			AddNewGoodPeerFunc: func(peerID PeerID)  {
-// 				panic("mock out the AddNewGoodPeer method")
-// 			},
-// 			AddRemoteTxsFunc: func(ctx context.Context, newTxs TxSlots)  {
-// 				panic("mock out the AddRemoteTxs method")
-// 			},
-// 			GetRlpFunc: func(tx kv.Tx, hash []byte) ([]byte, error) {
-// 				panic("mock out the GetRlp method")
-// 			},
-// 			IdHashKnownFunc: func(tx kv.Tx, hash []byte) (bool, error) {
-// 				panic("mock out the IdHashKnown method")
-// 			},
-// 			OnNewBlockFunc: func(stateChanges map[string]senderInfo, unwindTxs TxSlots, minedTxs TxSlots, baseFee uint64, blockHeight uint64, blockHash [32]byte) error {
-// 				panic("mock out the OnNewBlock method")
-// 			},
-// 			StartedFunc: func() bool {
-// 				panic("mock out the Started method")
-// 			},
-// 		}
+//		// make and configure a mocked Pool
+//		mockedPool := &PoolMock{
+//			AddNewGoodPeerFunc: func(peerID PeerID)  {
+//				panic("mock out the AddNewGoodPeer method")
+//			},
+//			AddRemoteTxsFunc: func(ctx context.Context, newTxs TxSlots)  {
+//				panic("mock out the AddRemoteTxs method")
+//			},
+//			AnnouncementsFunc: func(hashes Hashes) ([]byte, []uint32, Hashes) {
+//				panic("mock out the Announcements method")
+//			},
+//			GetRlpFunc: func(tx kv.Tx, hash common.Hash) ([]byte, error) {
+//				panic("mock out the GetRlp method")
+//			},
+//			IdHashKnownFunc: func(tx kv.Tx, hash common.Hash) (bool, error) {
+//				panic("mock out the IdHashKnown method")
+//			},
+//			IsPrivateFunc: func(idHash common.Hash) bool {
+//				panic("mock out the IsPrivate method")
+//			},
+//			OnNewBlockFunc: func(stateChanges map[string]senderInfo, unwindTxs TxSlots, minedTxs TxSlots, baseFee uint64, blobFee uint64, blockHeight uint64, blockHash common.Hash) error {
+//				panic("mock out the OnNewBlock method")
+//			},
+//			StartedFunc: func() bool {
+//				panic("mock out the Started method")
+//			},
+//		}
 //
-// 		// use mockedPool in code that requires Pool
-// 		// and then make assertions.
+//		// use mockedPool in code that requires Pool
+//		// and then make assertions.
 //
-// 	}
+//	}
 type PoolMock struct {
 	// AddNewGoodPeerFunc mocks the AddNewGoodPeer method.
 	AddNewGoodPeerFunc func(peerID PeerID)
@@ -50,14 +57,20 @@ type PoolMock struct {
 	// AddRemoteTxsFunc mocks the AddRemoteTxs method.
 	AddRemoteTxsFunc func(ctx context.Context, newTxs TxSlots)
 
+	// AnnouncementsFunc mocks the Announcements method.
+	AnnouncementsFunc func(hashes Hashes) ([]byte, []uint32, Hashes)
+
 	// GetRlpFunc mocks the GetRlp method.
-	GetRlpFunc func(tx kv.Tx, hash []byte) ([]byte, error)
+	GetRlpFunc func(tx kv.Tx, hash common.Hash) ([]byte, error)
 
 	// IdHashKnownFunc mocks the IdHashKnown method.
-	IdHashKnownFunc func(tx kv.Tx, hash []byte) (bool, error)
+	IdHashKnownFunc func(tx kv.Tx, hash common.Hash) (bool, error)
+
+	// IsPrivateFunc mocks the IsPrivate method.
+	IsPrivateFunc func(idHash common.Hash) bool
 
 	// OnNewBlockFunc mocks the OnNewBlock method.
-	OnNewBlockFunc func(stateChanges map[string]senderInfo, unwindTxs TxSlots, minedTxs TxSlots, baseFee uint64, blockHeight uint64, blockHash [32]byte) error
+	OnNewBlockFunc func(stateChanges map[string]senderInfo, unwindTxs TxSlots, minedTxs TxSlots, baseFee uint64, blobFee uint64, blockHeight uint64, blockHash common.Hash) error
 
 	// StartedFunc mocks the Started method.
 	StartedFunc func() bool
@@ -76,19 +89,29 @@ type PoolMock struct {
 			// NewTxs is the newTxs argument value.
 			NewTxs TxSlots
 		}
+		// Announcements holds details about calls to the Announcements method.
+		Announcements []struct {
+			// Hashes is the hashes argument value.
+			Hashes Hashes
+		}
 		// GetRlp holds details about calls to the GetRlp method.
 		GetRlp []struct {
 			// Tx is the tx argument value.
 			Tx kv.Tx
 			// Hash is the hash argument value.
-			Hash []byte
+			Hash common.Hash
 		}
 		// IdHashKnown holds details about calls to the IdHashKnown method.
 		IdHashKnown []struct {
 			// Tx is the tx argument value.
 			Tx kv.Tx
 			// Hash is the hash argument value.
-			Hash []byte
+			Hash common.Hash
+		}
+		// IsPrivate holds details about calls to the IsPrivate method.
+		IsPrivate []struct {
+			// IdHash is the idHash argument value.
+			IdHash common.Hash
 		}
 		// OnNewBlock holds details about calls to the OnNewBlock method.
 		OnNewBlock []struct {
@@ -100,10 +123,12 @@ type PoolMock struct {
 			MinedTxs TxSlots
 			// BaseFee is the baseFee argument value.
 			BaseFee uint64
+			// BlobFee is the blobFee argument value.
+			BlobFee uint64
 			// BlockHeight is the blockHeight argument value.
 			BlockHeight uint64
 			// BlockHash is the blockHash argument value.
-			BlockHash [32]byte
+			BlockHash common.Hash
 		}
 		// Started holds details about calls to the Started method.
 		Started []struct {
@@ -111,8 +136,10 @@ type PoolMock struct {
 	}
 	lockAddNewGoodPeer sync.RWMutex
 	lockAddRemoteTxs   sync.RWMutex
+	lockAnnouncements  sync.RWMutex
 	lockGetRlp         sync.RWMutex
 	lockIdHashKnown    sync.RWMutex
+	lockIsPrivate      sync.RWMutex
 	lockOnNewBlock     sync.RWMutex
 	lockStarted        sync.RWMutex
 }
@@ -135,7 +162,8 @@ func (mock *PoolMock) AddNewGoodPeer(peerID PeerID) {
 
 // AddNewGoodPeerCalls gets all the calls that were made to AddNewGoodPeer.
 // Check the length with:
-//     len(mockedPool.AddNewGoodPeerCalls())
+//
+//	len(mockedPool.AddNewGoodPeerCalls())
 func (mock *PoolMock) AddNewGoodPeerCalls() []struct {
 	PeerID PeerID
 } {
@@ -168,7 +196,8 @@ func (mock *PoolMock) AddRemoteTxs(ctx context.Context, newTxs TxSlots) {
 
 // AddRemoteTxsCalls gets all the calls that were made to AddRemoteTxs.
 // Check the length with:
-//     len(mockedPool.AddRemoteTxsCalls())
+//
+//	len(mockedPool.AddRemoteTxsCalls())
 func (mock *PoolMock) AddRemoteTxsCalls() []struct {
 	Ctx    context.Context
 	NewTxs TxSlots
@@ -183,11 +212,48 @@ func (mock *PoolMock) AddRemoteTxsCalls() []struct {
 	return calls
 }
 
+// Announcements calls AnnouncementsFunc.
+func (mock *PoolMock) Announcements(hashes Hashes) ([]byte, []uint32, Hashes) {
+	callInfo := struct {
+		Hashes Hashes
+	}{
+		Hashes: hashes,
+	}
+	mock.lockAnnouncements.Lock()
+	mock.calls.Announcements = append(mock.calls.Announcements, callInfo)
+	mock.lockAnnouncements.Unlock()
+	if mock.AnnouncementsFunc == nil {
+		var (
+			typesOut []byte
+			sizesOut []uint32
+			knownOut Hashes
+		)
+		return typesOut, sizesOut, knownOut
+	}
+	return mock.AnnouncementsFunc(hashes)
+}
+
+// AnnouncementsCalls gets all the calls that were made to Announcements.
+// Check the length with:
+//
+//	len(mockedPool.AnnouncementsCalls())
+func (mock *PoolMock) AnnouncementsCalls() []struct {
+	Hashes Hashes
+} {
+	var calls []struct {
+		Hashes Hashes
+	}
+	mock.lockAnnouncements.RLock()
+	calls = mock.calls.Announcements
+	mock.lockAnnouncements.RUnlock()
+	return calls
+}
+
 // GetRlp calls GetRlpFunc.
-func (mock *PoolMock) GetRlp(tx kv.Tx, hash []byte) ([]byte, error) {
+func (mock *PoolMock) GetRlp(tx kv.Tx, hash common.Hash) ([]byte, error) {
 	callInfo := struct {
 		Tx   kv.Tx
-		Hash []byte
+		Hash common.Hash
 	}{
 		Tx:   tx,
 		Hash: hash,
@@ -207,14 +273,15 @@ func (mock *PoolMock) GetRlp(tx kv.Tx, hash []byte) ([]byte, error) {
 
 // GetRlpCalls gets all the calls that were made to GetRlp.
 // Check the length with:
-//     len(mockedPool.GetRlpCalls())
+//
+//	len(mockedPool.GetRlpCalls())
 func (mock *PoolMock) GetRlpCalls() []struct {
 	Tx   kv.Tx
-	Hash []byte
+	Hash common.Hash
 } {
 	var calls []struct {
 		Tx   kv.Tx
-		Hash []byte
+		Hash common.Hash
 	}
 	mock.lockGetRlp.RLock()
 	calls = mock.calls.GetRlp
@@ -223,10 +290,10 @@ func (mock *PoolMock) GetRlpCalls() []struct {
 }
 
 // IdHashKnown calls IdHashKnownFunc.
-func (mock *PoolMock) IdHashKnown(tx kv.Tx, hash []byte) (bool, error) {
+func (mock *PoolMock) IdHashKnown(tx kv.Tx, hash common.Hash) (bool, error) {
 	callInfo := struct {
 		Tx   kv.Tx
-		Hash []byte
+		Hash common.Hash
 	}{
 		Tx:   tx,
 		Hash: hash,
@@ -246,14 +313,15 @@ func (mock *PoolMock) IdHashKnown(tx kv.Tx, hash []byte) (bool, error) {
 
 // IdHashKnownCalls gets all the calls that were made to IdHashKnown.
 // Check the length with:
-//     len(mockedPool.IdHashKnownCalls())
+//
+//	len(mockedPool.IdHashKnownCalls())
 func (mock *PoolMock) IdHashKnownCalls() []struct {
 	Tx   kv.Tx
-	Hash []byte
+	Hash common.Hash
 } {
 	var calls []struct {
 		Tx   kv.Tx
-		Hash []byte
+		Hash common.Hash
 	}
 	mock.lockIdHashKnown.RLock()
 	calls = mock.calls.IdHashKnown
@@ -261,20 +329,57 @@ func (mock *PoolMock) IdHashKnownCalls() []struct {
 	return calls
 }
 
+// IsPrivate calls IsPrivateFunc.
+func (mock *PoolMock) IsPrivate(idHash common.Hash) bool {
+	callInfo := struct {
+		IdHash common.Hash
+	}{
+		IdHash: idHash,
+	}
+	mock.lockIsPrivate.Lock()
+	mock.calls.IsPrivate = append(mock.calls.IsPrivate, callInfo)
+	mock.lockIsPrivate.Unlock()
+	if mock.IsPrivateFunc == nil {
+		var (
+			bOut bool
+		)
+		return bOut
+	}
+	return mock.IsPrivateFunc(idHash)
+}
+
+// IsPrivateCalls gets all the calls that were made to IsPrivate.
+// Check the length with:
+//
+//	len(mockedPool.IsPrivateCalls())
+func (mock *PoolMock) IsPrivateCalls() []struct {
+	IdHash common.Hash
+} {
+	var calls []struct {
+		IdHash common.Hash
+	}
+	mock.lockIsPrivate.RLock()
+	calls = mock.calls.IsPrivate
+	mock.lockIsPrivate.RUnlock()
+	return calls
+}
+
 // OnNewBlock calls OnNewBlockFunc.
-func (mock *PoolMock) OnNewBlock(stateChanges map[string]senderInfo, unwindTxs TxSlots, minedTxs TxSlots, baseFee uint64, blockHeight uint64, blockHash [32]byte) error {
+func (mock *PoolMock) OnNewBlock(stateChanges map[string]senderInfo, unwindTxs TxSlots, minedTxs TxSlots, baseFee uint64, blobFee uint64, blockHeight uint64, blockHash common.Hash) error {
 	callInfo := struct {
 		StateChanges map[string]senderInfo
 		UnwindTxs    TxSlots
 		MinedTxs     TxSlots
 		BaseFee      uint64
+		BlobFee      uint64
 		BlockHeight  uint64
-		BlockHash    [32]byte
+		BlockHash    common.Hash
 	}{
 		StateChanges: stateChanges,
 		UnwindTxs:    unwindTxs,
 		MinedTxs:     minedTxs,
 		BaseFee:      baseFee,
+		BlobFee:      blobFee,
 		BlockHeight:  blockHeight,
 		BlockHash:    blockHash,
 	}
@@ -287,27 +392,30 @@ func (mock *PoolMock) OnNewBlock(stateChanges map[string]senderInfo, unwindTxs T
 		)
 		return errOut
 	}
-	return mock.OnNewBlockFunc(stateChanges, unwindTxs, minedTxs, baseFee, blockHeight, blockHash)
+	return mock.OnNewBlockFunc(stateChanges, unwindTxs, minedTxs, baseFee, blobFee, blockHeight, blockHash)
 }
 
 // OnNewBlockCalls gets all the calls that were made to OnNewBlock.
 // Check the length with:
-//     len(mockedPool.OnNewBlockCalls())
+//
+//	len(mockedPool.OnNewBlockCalls())
 func (mock *PoolMock) OnNewBlockCalls() []struct {
 	StateChanges map[string]senderInfo
 	UnwindTxs    TxSlots
 	MinedTxs     TxSlots
 	BaseFee      uint64
+	BlobFee      uint64
 	BlockHeight  uint64
-	BlockHash    [32]byte
+	BlockHash    common.Hash
 } {
 	var calls []struct {
 		StateChanges map[string]senderInfo
 		UnwindTxs    TxSlots
 		MinedTxs     TxSlots
 		BaseFee      uint64
+		BlobFee      uint64
 		BlockHeight  uint64
-		BlockHash    [32]byte
+		BlockHash    common.Hash
 	}
 	mock.lockOnNewBlock.RLock()
 	calls = mock.calls.OnNewBlock
@@ -333,7 +441,8 @@ func (mock *PoolMock) Started() bool {
 
 // StartedCalls gets all the calls that were made to Started.
 // Check the length with:
-//     len(mockedPool.StartedCalls())
+//
+//	len(mockedPool.StartedCalls())
 func (mock *PoolMock) StartedCalls() []struct {
 } {
 	var calls []struct {
@@ -19,6 +19,7 @@ package txpool
 import (
 	"errors"
 	"fmt"
+	"math/bits"
 
 	"github.com/ledgerwatch/erigon-lib/rlp"
 )
@@ -73,6 +74,97 @@ func ensureEnoughSize(in []byte, size int) []byte {
 	return in[:size] // Reuse the space if it has enough capacity
 }
 
+// EncodeAnnouncements68 produces encoding of eth/68 NewPooledTransactionHashes packet:
+// [types: B, [size: P, ...], [hash: B_32, ...]] - types and sizes of transactions are announced along with hashes
+func EncodeAnnouncements68(types []byte, sizes []uint32, hashes []byte, encodeBuf []byte) []byte {
+	typesLen := len(types) + 1
+	if len(types) == 1 && types[0] < 128 {
+		typesLen = 1
+	} else if len(types) >= 56 {
+		typesLen += (bits.Len(uint(len(types))) + 7) / 8
+	}
+	sizesLen := 0
+	for _, size := range sizes {
+		sizesLen += rlp.U64Len(uint64(size))
+	}
+	hashesLen := len(hashes) / 32 * 33
+	dataLen := typesLen + rlp.ListPrefixLen(sizesLen) + sizesLen + rlp.ListPrefixLen(hashesLen) + hashesLen
+	encodeBuf = ensureEnoughSize(encodeBuf, rlp.ListPrefixLen(dataLen)+dataLen)
+
+	pos := rlp.EncodeListPrefix(dataLen, encodeBuf)
+	switch {
+	case len(types) == 1 && types[0] < 128:
+		encodeBuf[pos] = types[0]
+		pos++
+	case len(types) < 56:
+		encodeBuf[pos] = 128 + byte(len(types))
+		pos++
+		pos += copy(encodeBuf[pos:], types)
+	default:
+		beLen := typesLen - len(types) - 1
+		encodeBuf[pos] = 183 + byte(beLen)
+		for i := 0; i < beLen; i++ {
+			encodeBuf[pos+beLen-i] = byte(len(types) >> (8 * i))
+		}
+		pos += 1 + beLen
+		pos += copy(encodeBuf[pos:], types)
+	}
+	pos += rlp.EncodeListPrefix(sizesLen, encodeBuf[pos:])
+	for _, size := range sizes {
+		pos += rlp.EncodeU64(uint64(size), encodeBuf[pos:])
+	}
+	pos += rlp.EncodeHashes(hashes, encodeBuf[pos:])
+	_ = pos
+	return encodeBuf
+}
+
+// ParseAnnouncements68 - parses eth/68 NewPooledTransactionHashes packet, see EncodeAnnouncements68
+func ParseAnnouncements68(payload []byte, pos int) (types []byte, sizes []uint32, hashes []byte, newPos int, err error) {
+	pos, _, err = rlp.List(payload, pos)
+	if err != nil {
+		return nil, nil, nil, 0, fmt.Errorf("%s: announcements: %w", rlp.ParseHashErrorPrefix, err)
+	}
+	var typesPos, typesLen int
+	typesPos, typesLen, err = rlp.String(payload, pos)
+	if err != nil {
+		return nil, nil, nil, 0, fmt.Errorf("%s: announcements types: %w", rlp.ParseHashErrorPrefix, err)
+	}
+	if typesPos+typesLen > len(payload) {
+		return nil, nil, nil, 0, fmt.Errorf("%s: announcements types: unexpected end of payload", rlp.ParseHashErrorPrefix)
+	}
+	types = payload[typesPos : typesPos+typesLen]
+	pos = typesPos + typesLen
+
+	var sizesLen int
+	pos, sizesLen, err = rlp.List(payload, pos)
+	if err != nil {
+		return nil, nil, nil, 0, fmt.Errorf("%s: announcements sizes: %w", rlp.ParseHashErrorPrefix, err)
+	}
+	sizes = make([]uint32, 0, len(types))
+	for sizesEnd := pos + sizesLen; pos < sizesEnd; {
+		var size uint32
+		if pos, size, err = rlp.U32(payload, pos); err != nil {
+			return nil, nil, nil, 0, fmt.Errorf("%s: announcements sizes: %w", rlp.ParseHashErrorPrefix, err)
+		}
+		sizes = append(sizes, size)
+	}
+
+	hashesCount, pos, err := ParseHashesCount(payload, pos)
+	if err != nil {
+		return nil, nil, nil, 0, err
+	}
+	if hashesCount != len(types) || hashesCount != len(sizes) {
+		return nil, nil, nil, 0, fmt.Errorf("%s: announcements: %d types, %d sizes, %d hashes", rlp.ParseHashErrorPrefix, len(types), len(sizes), hashesCount)
+	}
+	hashes = make([]byte, 32*hashesCount)
+	for i := 0; i < hashesCount; i++ {
+		if pos, err = rlp.ParseHash(payload, pos, hashes[i*32:]); err != nil {
+			return nil, nil, nil, 0, fmt.Errorf("%s: announcements hash: %w", rlp.ParseHashErrorPrefix, err)
+		}
+	}
+	return types, sizes, hashes, pos, nil
+}
+
 // EncodeGetPooledTransactions66 produces encoding of GetPooledTransactions66 packet
 func EncodeGetPooledTransactions66(hashes []byte, requestId uint64, encodeBuf []byte) ([]byte, error) {
 	pos := 0
@@ -176,12 +268,22 @@ func EncodePooledTransactions65(txsRlp [][]byte, encodeBuf []byte) []byte {
 	return encodeBuf
 }
 
-func ParsePooledTransactions65(payload []byte, pos int, ctx *TxParseContext, txSlots *TxSlots) (newPos int, err error) {
+func ParsePooledTransactions65(payload []byte, pos int, ctx TxsParser, txSlots *TxSlots) (newPos int, err error) {
 	pos, _, err = rlp.List(payload, pos)
 	if err != nil {
 		return 0, err
 	}
 
+	return ctx.ParseTransactions(payload, pos, txSlots)
+}
+
+// TxsParser - parses transactions which are items of rlp list, from pos to end of payload. Transactions rejected by
+// Reject callback are skipped. *TxParseContext parses them one by one, *ParallelParser - by workers
+type TxsParser interface {
+	ParseTransactions(payload []byte, pos int, txSlots *TxSlots) (newPos int, err error)
+}
+
+func (ctx *TxParseContext) ParseTransactions(payload []byte, pos int, txSlots *TxSlots) (newPos int, err error) {
 	for i := 0; pos < len(payload); i++ {
 		txSlots.Resize(uint(i + 1))
 		txSlots.txs[i] = &TxSlot{}
@@ -198,7 +300,7 @@ func ParsePooledTransactions65(payload []byte, pos int, ctx *TxParseContext, txS
 	return pos, nil
 }
 
-func ParsePooledTransactions66(payload []byte, pos int, ctx *TxParseContext, txSlots *TxSlots) (requestID uint64, newPos int, err error) {
+func ParsePooledTransactions66(payload []byte, pos int, ctx TxsParser, txSlots *TxSlots) (requestID uint64, newPos int, err error) {
 	pos, _, err = rlp.List(payload, pos)
 	if err != nil {
 		return requestID, 0, err
@@ -212,18 +314,9 @@ func ParsePooledTransactions66(payload []byte, pos int, ctx *TxParseContext, txS
 		return requestID, 0, err
 	}
 
-	for i := 0; pos < len(payload); i++ {
-		txSlots.Resize(uint(i + 1))
-		txSlots.txs[i] = &TxSlot{}
-		pos, err = ctx.ParseTransaction(payload, pos, txSlots.txs[i], txSlots.senders.At(i))
-		if err != nil {
-			if errors.Is(err, ErrRejected) {
-				txSlots.Resize(uint(i))
-				i--
-				continue
-			}
-			return requestID, 0, err
-		}
+	pos, err = ctx.ParseTransactions(payload, pos, txSlots)
+	if err != nil {
+		return requestID, 0, err
 	}
 	return requestID, pos, nil
 }
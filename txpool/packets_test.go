@@ -78,6 +78,32 @@ func TestEncodeHash(t *testing.T) {
 	}
 }
 
+func TestAnnouncements68(t *testing.T) {
+	require := require.New(t)
+	encoded := EncodeAnnouncements68([]byte{2}, []uint32{128}, toHashes([32]byte{1}), nil)
+	require.Equal("e602c28180e1a00100000000000000000000000000000000000000000000000000000000000000", fmt.Sprintf("%x", encoded))
+
+	for _, n := range []int{0, 1, 2, 55, 56, 300} {
+		types, sizes, hashes := make([]byte, n), make([]uint32, n), make(Hashes, 32*n)
+		for i := 0; i < n; i++ {
+			types[i] = byte(i % 4)
+			sizes[i] = uint32(i * 1000)
+			hashes[i*32] = byte(i)
+		}
+		encoded := EncodeAnnouncements68(types, sizes, hashes, nil)
+		parsedTypes, parsedSizes, parsedHashes, pos, err := ParseAnnouncements68(encoded, 0)
+		require.NoError(err, n)
+		require.Equal(len(encoded), pos)
+		require.Equal(types, parsedTypes)
+		require.Equal(sizes, parsedSizes)
+		require.Equal(hashes, Hashes(parsedHashes))
+	}
+
+	// amounts of types, sizes and hashes must be equal
+	_, _, _, _, err := ParseAnnouncements68(EncodeAnnouncements68([]byte{2, 2}, []uint32{1}, toHashes([32]byte{1}), nil), 0)
+	require.Error(err)
+}
+
 var gpt66EncodeTests = []struct {
 	payloadStr  string
 	hashesStr   string
@@ -162,3 +188,46 @@ func TestPooledTransactionsPacket66(t *testing.T) {
 	}
 
 }
+
+func TestParallelParser(t *testing.T) {
+	require := require.New(t)
+	var txsRlp [][]byte
+	for i := 0; i < 3; i++ {
+		for _, tt := range txParseTests {
+			txsRlp = append(txsRlp, decodeHex(tt.payloadStr))
+		}
+	}
+	payload := EncodePooledTransactions66(txsRlp, 7, nil)
+
+	var expected TxSlots
+	requestID, _, err := ParsePooledTransactions66(payload, 0, NewTxParseContext(), &expected)
+	require.NoError(err)
+	require.Equal(uint64(7), requestID)
+	require.Equal(len(txsRlp), len(expected.txs))
+
+	pp := NewParallelParser(4)
+	var txs TxSlots
+	_, pos, err := ParsePooledTransactions66(payload, 0, pp, &txs)
+	require.NoError(err)
+	require.Equal(len(payload), pos)
+	require.Equal(expected.senders, txs.senders)
+	for i := range expected.txs {
+		require.Equal(expected.txs[i].idHash, txs.txs[i].idHash)
+	}
+
+	// rejected transactions are skipped, order is kept
+	rejected := expected.txs[1].idHash
+	pp.Reject(func(hash []byte) bool { return string(hash) == string(rejected[:]) })
+	_, _, err = ParsePooledTransactions66(payload, 0, pp, &txs)
+	require.NoError(err)
+	require.Equal(len(expected.txs)-3, len(txs.txs))
+	require.Equal(expected.txs[0].idHash, txs.txs[0].idHash)
+	require.Equal(expected.txs[2].idHash, txs.txs[1].idHash)
+	require.Equal(expected.senders.At(2), txs.senders.At(1))
+	pp.Reject(nil)
+
+	broken := append([][]byte{}, txsRlp...)
+	broken[5] = []byte{0xc1, 0x80}
+	_, _, err = ParsePooledTransactions66(EncodePooledTransactions66(broken, 7, nil), 0, pp, &txs)
+	require.Error(err)
+}
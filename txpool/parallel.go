@@ -0,0 +1,131 @@
+/*
+   Copyright 2021 Erigon contributors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package txpool
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/holiman/uint256"
+	"github.com/ledgerwatch/erigon-lib/common/parallel"
+	"github.com/ledgerwatch/erigon-lib/rlp"
+)
+
+// ParallelParser - parses batches of transactions by bounded amount of workers, each with own TxParseContext:
+// recovery of senders (secp256k1) is the most expensive part of parsing. Workers live only during
+// ParseTransactions. Reject, BlobProofs and ValidateChainID callbacks are called by workers concurrently.
+// Not safe for concurrent use
+type ParallelParser struct {
+	ctxs   []*TxParseContext // one per worker
+	starts []int             // positions of transactions in payload
+	errs   []error
+}
+
+func NewParallelParser(workers int) *ParallelParser {
+	if workers < 1 {
+		workers = 1
+	}
+	pp := &ParallelParser{ctxs: make([]*TxParseContext, workers)}
+	for i := range pp.ctxs {
+		pp.ctxs[i] = NewTxParseContext()
+	}
+	return pp
+}
+
+func (pp *ParallelParser) Reject(f func(hash []byte) bool) {
+	for _, ctx := range pp.ctxs {
+		ctx.Reject(f)
+	}
+}
+func (pp *ParallelParser) WithSender(v bool) {
+	for _, ctx := range pp.ctxs {
+		ctx.WithSender(v)
+	}
+}
+func (pp *ParallelParser) BlobProofs(f func(blobs, commitments, proofs [][]byte) error) {
+	for _, ctx := range pp.ctxs {
+		ctx.BlobProofs(f)
+	}
+}
+
+func (pp *ParallelParser) ChainIDs(ids ...uint64) {
+	for _, ctx := range pp.ctxs {
+		ctx.ChainIDs(ids...)
+	}
+}
+func (pp *ParallelParser) ValidateChainID(f func(chainID *uint256.Int) bool) {
+	for _, ctx := range pp.ctxs {
+		ctx.ValidateChainID(f)
+	}
+}
+
+func (pp *ParallelParser) ParseTransactions(payload []byte, pos int, txSlots *TxSlots) (newPos int, err error) {
+	start := pos
+	pp.starts = pp.starts[:0]
+	for pos < len(payload) {
+		dataPos, dataLen, _, err := rlp.Prefix(payload, pos)
+		if err != nil {
+			return 0, fmt.Errorf("%s: size Prefix: %w", ParseTransactionErrorPrefix, err)
+		}
+		if dataPos+dataLen > len(payload) {
+			return 0, fmt.Errorf("%s: unexpected end of payload", ParseTransactionErrorPrefix)
+		}
+		pp.starts = append(pp.starts, pos)
+		pos = dataPos + dataLen
+	}
+	n := len(pp.starts)
+	workers := len(pp.ctxs)
+	if workers > n {
+		workers = n
+	}
+	if workers <= 1 {
+		return pp.ctxs[0].ParseTransactions(payload, start, txSlots)
+	}
+
+	txSlots.Resize(uint(n))
+	if cap(pp.errs) < n {
+		pp.errs = make([]error, n)
+	}
+	errs := pp.errs[:n]
+	for i := range errs {
+		errs[i] = nil
+	}
+	if err = parallel.ForEach(context.Background(), n, workers, func(_ context.Context, worker, i int) error {
+		txSlots.txs[i] = &TxSlot{}
+		_, errs[i] = pp.ctxs[worker].ParseTransaction(payload, pp.starts[i], txSlots.txs[i], txSlots.senders.At(i))
+		return nil
+	}); err != nil {
+		return 0, err
+	}
+
+	// drop rejected transactions, keeping order
+	j := 0
+	for i := 0; i < n; i++ {
+		if errs[i] != nil {
+			if errors.Is(errs[i], ErrRejected) {
+				continue
+			}
+			return 0, errs[i]
+		}
+		txSlots.txs[j] = txSlots.txs[i]
+		copy(txSlots.senders.At(j), txSlots.senders.At(i))
+		j++
+	}
+	txSlots.Resize(uint(j))
+	return pos, nil
+}
@@ -35,10 +35,16 @@ import (
 	"github.com/google/btree"
 	"github.com/hashicorp/golang-lru/simplelru"
 	"github.com/holiman/uint256"
+	"github.com/ledgerwatch/erigon-lib/chain"
+	"github.com/ledgerwatch/erigon-lib/common"
+	"github.com/ledgerwatch/erigon-lib/common/background"
+	"github.com/ledgerwatch/erigon-lib/common/clock"
+	"github.com/ledgerwatch/erigon-lib/common/errkind"
+	"github.com/ledgerwatch/erigon-lib/common/logging"
+	"github.com/ledgerwatch/erigon-lib/common/tracing"
 	proto_txpool "github.com/ledgerwatch/erigon-lib/gointerfaces/txpool"
 	"github.com/ledgerwatch/erigon-lib/kv"
 	"github.com/ledgerwatch/erigon-lib/kv/mdbx"
-	"github.com/ledgerwatch/log/v3"
 	"go.uber.org/atomic"
 	"google.golang.org/grpc/status"
 )
@@ -52,6 +58,7 @@ var (
 	cacheHitCounter       = metrics.GetOrCreateCounter(`pool_cache_total{result="hit"}`)
 	writeToDbBytesCounter = metrics.GetOrCreateCounter(`pool_write_to_db_bytes`)
 	sendersEvictedCounter = metrics.GetOrCreateCounter(`pool_senders_evicted`)
+	rejectedCacheHits     = metrics.GetOrCreateCounter(`pool_rejected_cache_hits`)
 )
 
 const ASSERT = false
@@ -61,7 +68,55 @@ type Config struct {
 	processRemoteTxsEvery   time.Duration
 	commitEvery             time.Duration
 	logEvery                time.Duration
+	rebroadcastLocalsEvery  time.Duration // local pending transactions are broadcasted again until mined or discarded
 	evictSendersAfterRounds uint64
+
+	// blob transactions (EIP-4844)
+	MaxBlobsPerBlock uint64 // transactions with more blobs are rejected, Best returns no more blobs
+	BlobSlots        uint64 // max amount of blobs of all transactions in pool
+
+	// Transaction occupies 1 slot per started 32Kb of rlp. Local transactions are not limited and not evicted
+	AccountSlots   uint64        // max slots of one sender, more transactions are rejected
+	GlobalSlots    uint64        // max slots of all transactions, worst transactions are evicted (queued first)
+	QueuedLifetime time.Duration // queued transactions are evicted after this time in pool
+
+	PriceBump       PriceBump            // to replace transaction with same sender and nonce
+	LocalPriceBumps map[string]PriceBump // overrides PriceBump for local transactions of given senders (key - address)
+
+	// Hashes of recently rejected transactions (with too low nonce, invalid) - to not fetch and
+	// validate them again when other peers announce them. 0 size - disabled
+	RejectedCacheSize int
+	RejectedLifetime  time.Duration
+
+	Admission Admission // embedder's policy of accepted transactions, nil - no extra rules
+	Metrics   Metrics   // embedder's sink of pool metrics, nil - only default registry of VictoriaMetrics
+
+	Chain *chain.Config // fork schedule, for intrinsic gas of transactions in pending block. Nil - all forks are active
+
+	Logger logging.Logger // nil - logging.Root()
+	Clock  clock.Clock    // time of timers, evictions and cache aging, nil - clock.Real
+}
+
+// PriceBump - minimal increase (in percents) of tip and feeCap of transaction which replaces pooled transaction
+// with same sender and nonce
+type PriceBump struct {
+	Tip    uint64
+	FeeCap uint64
+}
+
+// enough - new transaction pays enough more than old one. Tip must grow anyway - even if bump is 0%
+func (b PriceBump) enough(old, new *TxSlot) bool {
+	return new.tip > old.tip && bumped(old.tip, b.Tip) <= new.tip && bumped(old.feeCap, b.FeeCap) <= new.feeCap
+}
+
+func bumped(v, percent uint64) uint64 {
+	res := uint256.NewInt(v)
+	res.Mul(res, uint256.NewInt(100+percent))
+	res.Div(res, uint256.NewInt(100))
+	if !res.IsUint64() {
+		return math.MaxUint64
+	}
+	return res.Uint64()
 }
 
 var DefaultConfig = Config{
@@ -69,7 +124,20 @@ var DefaultConfig = Config{
 	processRemoteTxsEvery:   100 * time.Millisecond,
 	commitEvery:             15 * time.Second,
 	logEvery:                30 * time.Second,
+	rebroadcastLocalsEvery:  5 * time.Minute,
 	evictSendersAfterRounds: 20,
+
+	MaxBlobsPerBlock: 6,
+	BlobSlots:        96, // 12Mb of blobs
+
+	AccountSlots:   16,
+	GlobalSlots:    PendingSubPoolLimit + BaseFeeSubPoolLimit + QueuedSubPoolLimit,
+	QueuedLifetime: 3 * time.Hour,
+
+	PriceBump: PriceBump{Tip: 10, FeeCap: 10},
+
+	RejectedCacheSize: 16 * 1024,
+	RejectedLifetime:  10 * time.Minute,
 }
 
 // Pool is interface for the transaction pool
@@ -77,11 +145,15 @@ var DefaultConfig = Config{
 // there are multiple implementations
 type Pool interface {
 	// IdHashKnown check whether transaction with given Id hash is known to the pool
-	IdHashKnown(tx kv.Tx, hash []byte) (bool, error)
+	IdHashKnown(tx kv.Tx, hash common.Hash) (bool, error)
 	Started() bool
-	GetRlp(tx kv.Tx, hash []byte) ([]byte, error)
+	GetRlp(tx kv.Tx, hash common.Hash) ([]byte, error)
 	AddRemoteTxs(ctx context.Context, newTxs TxSlots)
-	OnNewBlock(stateChanges map[string]senderInfo, unwindTxs, minedTxs TxSlots, baseFee, blockHeight uint64, blockHash [32]byte) error
+	// IsPrivate - private transactions must not be sent to peers, see AddPrivate
+	IsPrivate(idHash common.Hash) bool
+	// Announcements - types and sizes of pooled transactions, for eth/68 announcements. Unknown hashes are skipped
+	Announcements(hashes Hashes) (types []byte, sizes []uint32, known Hashes)
+	OnNewBlock(stateChanges map[string]senderInfo, unwindTxs, minedTxs TxSlots, baseFee, blobFee, blockHeight uint64, blockHash common.Hash) error
 
 	AddNewGoodPeer(peerID PeerID)
 }
@@ -108,15 +180,77 @@ type DiscardReason uint8
 
 const (
 	//TODO: all below codes are not fixed yet. Need add them to discardLocked func. Need save discard reasons to LRU or DB.
-	Success       DiscardReason = 1
-	AlreadyKnown  DiscardReason = 2
-	UnderPriced   DiscardReason = 3
-	FeeTooLow     DiscardReason = 4
-	OversizedData DiscardReason = 5
-	InvalidSender DiscardReason = 6
-	NegativeValue DiscardReason = 7
+	Success             DiscardReason = 1
+	AlreadyKnown        DiscardReason = 2
+	UnderPriced         DiscardReason = 3
+	FeeTooLow           DiscardReason = 4
+	OversizedData       DiscardReason = 5
+	InvalidSender       DiscardReason = 6
+	NegativeValue       DiscardReason = 7
+	ReplaceUnderpriced  DiscardReason = 8  // pool has transaction with same sender and nonce, new one doesn't pay enough more - see PriceBump
+	BlobsRejected       DiscardReason = 9  // blob transaction without sidecar, with too many blobs, or pool has no room for blobs
+	Spammer             DiscardReason = 10 // sender has no free slots - see AccountSlots
+	Mined               DiscardReason = 11 // transaction or other transaction of sender with same or bigger nonce is mined
+	ReplacedByHigherTip DiscardReason = 12
+	PoolOverflow        DiscardReason = 13 // worst transaction of full pool - see GlobalSlots and sub-pools limits
+	QueuedTooLong       DiscardReason = 14 // see QueuedLifetime
+	NonceTooLow         DiscardReason = 15 // sender's nonce in state is same or bigger
+	NotAdmitted         DiscardReason = 16 // rejected by Config.Admission
+	IntrinsicGasTooLow  DiscardReason = 17 // gas limit doesn't cover intrinsic gas, see IntrinsicGas
 )
 
+func (r DiscardReason) String() string {
+	switch r {
+	case Success:
+		return "success"
+	case AlreadyKnown:
+		return "already known"
+	case UnderPriced:
+		return "underpriced"
+	case FeeTooLow:
+		return "fee too low"
+	case OversizedData:
+		return "oversized data"
+	case InvalidSender:
+		return "invalid sender"
+	case NegativeValue:
+		return "negative value"
+	case ReplaceUnderpriced:
+		return "replacement transaction underpriced"
+	case BlobsRejected:
+		return "blobs rejected"
+	case Spammer:
+		return "too many transactions of sender"
+	case Mined:
+		return "mined"
+	case ReplacedByHigherTip:
+		return "replaced by transaction with higher tip"
+	case PoolOverflow:
+		return "pool overflow"
+	case QueuedTooLong:
+		return "queued too long"
+	case NonceTooLow:
+		return "nonce too low"
+	case NotAdmitted:
+		return "not admitted by policy"
+	case IntrinsicGasTooLow:
+		return "intrinsic gas too low"
+	default:
+		return fmt.Sprintf("unknown discard reason: %d", r)
+	}
+}
+
+// permanent - same transaction will be rejected again, no reason to validate it soon
+func (r DiscardReason) permanent() bool {
+	switch r {
+	// not fee-related reasons: they depend on base fee and pool content, which change
+	case OversizedData, InvalidSender, NegativeValue, Mined, NonceTooLow, IntrinsicGasTooLow:
+		return true
+	default:
+		return false
+	}
+}
+
 // metaTx holds transaction and some metadata
 type metaTx struct {
 	subPool        SubPoolMarker
@@ -125,10 +259,11 @@ type metaTx struct {
 	bestIndex      int
 	worstIndex     int
 	currentSubPool SubPoolType
+	added          time.Time // when transaction was added to pool (or restored from db)
 }
 
-func newMetaTx(slot *TxSlot, isLocal bool) *metaTx {
-	mt := &metaTx{Tx: slot, worstIndex: -1, bestIndex: -1}
+func newMetaTx(slot *TxSlot, isLocal bool, added time.Time) *metaTx {
+	mt := &metaTx{Tx: slot, worstIndex: -1, bestIndex: -1, added: added}
 	if isLocal {
 		mt.subPool = IsLocal
 	}
@@ -176,10 +311,11 @@ type sendersBatch struct {
 	commitID    uint64
 	senderIDs   map[string]uint64
 	senderInfo  map[uint64]*senderInfo
+	clock       clock.Clock
 }
 
-func newSendersCache() *sendersBatch {
-	return &sendersBatch{senderIDs: map[string]uint64{}, senderInfo: map[uint64]*senderInfo{}}
+func newSendersCache(clk clock.Clock) *sendersBatch {
+	return &sendersBatch{senderIDs: map[string]uint64{}, senderInfo: map[uint64]*senderInfo{}, clock: clk}
 }
 
 //nolint
@@ -268,7 +404,7 @@ func (sc *sendersBatch) onNewTxs(tx kv.Tx, newTxs TxSlots) (cacheMisses map[uint
 func (sc *sendersBatch) loadFromCore(coreTx kv.Tx, toLoad map[uint64]string) error {
 	diff := make(map[uint64]*senderInfo, len(toLoad))
 	for id := range toLoad {
-		info, err := loadSender(coreTx, []byte(toLoad[id]))
+		info, err := loadSender(coreTx, common.BytesToAddress([]byte(toLoad[id])))
 		if err != nil {
 			return err
 		}
@@ -281,7 +417,7 @@ func (sc *sendersBatch) loadFromCore(coreTx kv.Tx, toLoad map[uint64]string) err
 	return nil
 }
 
-func (sc *sendersBatch) onNewBlock(tx kv.Tx, stateChanges map[string]senderInfo, unwindTxs, minedTxs TxSlots, blockHeight uint64, blockHash [32]byte) error {
+func (sc *sendersBatch) onNewBlock(tx kv.Tx, stateChanges map[string]senderInfo, unwindTxs, minedTxs TxSlots, blockHeight uint64, blockHash common.Hash) error {
 	//TODO: if see non-continuous block heigh - load gap from changesets
 	sc.blockHeight.Store(blockHeight)
 	sc.blockHash.Store(string(blockHash[:]))
@@ -394,7 +530,7 @@ func (sc *sendersBatch) setTxSenderID(tx kv.Tx, txs TxSlots) (map[uint64]string,
 	}
 	return toLoad, nil
 }
-func (sc *sendersBatch) syncMissedStateDiff(ctx context.Context, tx kv.RwTx, coreTx kv.Tx, missedTo uint64) error {
+func (sc *sendersBatch) syncMissedStateDiff(ctx context.Context, logger logging.Logger, tx kv.RwTx, coreTx kv.Tx, missedTo uint64) error {
 	dropLocalSendersCache := false
 	if missedTo > 0 && missedTo-sc.blockHeight.Load() > 1024 {
 		dropLocalSendersCache = true
@@ -408,7 +544,7 @@ func (sc *sendersBatch) syncMissedStateDiff(ctx context.Context, tx kv.RwTx, cor
 		if err := lastCommitTime.UnmarshalBinary(lastCommitTimeV); err != nil {
 			return err
 		}
-		if time.Since(lastCommitTime) > 3*24*time.Hour {
+		if sc.clock.Now().Sub(lastCommitTime) > 3*24*time.Hour {
 			dropLocalSendersCache = true
 		}
 	}
@@ -439,7 +575,7 @@ func (sc *sendersBatch) syncMissedStateDiff(ctx context.Context, tx kv.RwTx, cor
 	if coreTx == nil {
 		return nil
 	}
-	diff, err := changesets(ctx, sc.blockHeight.Load(), coreTx)
+	diff, err := changesets(ctx, logger, sc.blockHeight.Load(), coreTx)
 	if err != nil {
 		return err
 	}
@@ -454,7 +590,9 @@ func calcProtocolBaseFee(baseFee uint64) uint64 {
 }
 
 type ByNonce struct {
-	tree *btree.BTree
+	tree  *btree.BTree
+	blobs uint64 // amount of blobs of indexed transactions, see BlobSlots
+	slots uint64 // slots of indexed transactions, see GlobalSlots
 }
 
 func (b *ByNonce) ascend(senderID uint64, f func(*metaTx) bool) {
@@ -485,11 +623,21 @@ func (b *ByNonce) has(mt *metaTx) bool {
 	found := b.tree.Get(&sortByNonce{mt})
 	return found != nil
 }
-func (b *ByNonce) delete(mt *metaTx) { b.tree.Delete(&sortByNonce{mt}) }
+func (b *ByNonce) delete(mt *metaTx) {
+	if it := b.tree.Delete(&sortByNonce{mt}); it != nil {
+		b.blobs -= uint64(it.(*sortByNonce).metaTx.Tx.blobHashes.Len())
+		b.slots -= it.(*sortByNonce).metaTx.Tx.slots()
+	}
+}
 func (b *ByNonce) replaceOrInsert(mt *metaTx) *metaTx {
+	b.blobs += uint64(mt.Tx.blobHashes.Len())
+	b.slots += mt.Tx.slots()
 	it := b.tree.ReplaceOrInsert(&sortByNonce{mt})
 	if it != nil {
-		return it.(*sortByNonce).metaTx
+		replaced := it.(*sortByNonce).metaTx
+		b.blobs -= uint64(replaced.Tx.blobHashes.Len())
+		b.slots -= replaced.Tx.slots()
+		return replaced
 	}
 	return nil
 }
@@ -501,6 +649,7 @@ type TxPool struct {
 
 	protocolBaseFee atomic.Uint64
 	currentBaseFee  atomic.Uint64
+	currentBlobFee  atomic.Uint64 // EIP-4844: blob base fee of pending block
 
 	senderID        uint64
 	byHash          map[string]*metaTx // tx_hash => tx
@@ -509,14 +658,19 @@ type TxPool struct {
 
 	// track isLocal flag of already mined transactions. used at unwind.
 	localsHistory *simplelru.LRU
+	rejected      *simplelru.LRU // hash of recently rejected transaction => time.Time when it's forgotten, see RejectedCacheSize
 	db            kv.RwDB
 	coreDB        kv.RoDB
 
+	private        map[string]struct{} // hashes of pooled private transactions, see AddPrivate
+	privateHistory *simplelru.LRU      // hashes of mined private transactions, to keep them private at unwind
+
+	batchDiscards map[string]DiscardReason // transactions discarded while batch is added by addTxsLocked, nil otherwise
+
 	// fields for transaction propagation
 	recentlyConnectedPeers *recentlyConnectedPeers
 	newTxs                 chan Hashes
 	deletedTxs             []*metaTx
-	discardReasons         []DiscardReason
 	senders                *sendersBatch
 	txNonce2Tx             *ByNonce // senderID => (sorted map of tx nonce => *metaTx)
 
@@ -528,7 +682,13 @@ type TxPool struct {
 	unprocessedRemoteTxs    *TxSlots
 	unprocessedRemoteByHash map[string]int // to reject duplicates
 
-	cfg Config
+	events   poolEvents
+	tips     tipStats // see SuggestTip
+	dbFormat error    // incompatible format of db: pool must not be flushed over it, see migratePoolDB
+
+	cfg    Config
+	logger logging.Logger
+	clock  clock.Clock
 }
 
 func New(newTxs chan Hashes, db kv.RwDB, coreDB kv.RoDB, cfg Config) (*TxPool, error) {
@@ -536,24 +696,45 @@ func New(newTxs chan Hashes, db kv.RwDB, coreDB kv.RoDB, cfg Config) (*TxPool, e
 	if err != nil {
 		return nil, err
 	}
-	return &TxPool{
+	privateHistory, err := simplelru.NewLRU(1024, nil)
+	if err != nil {
+		return nil, err
+	}
+	var rejected *simplelru.LRU
+	if cfg.RejectedCacheSize > 0 {
+		if rejected, err = simplelru.NewLRU(cfg.RejectedCacheSize, nil); err != nil {
+			return nil, err
+		}
+	}
+	p := &TxPool{
 		lock:                    &sync.RWMutex{},
 		byHash:                  map[string]*metaTx{},
-		txNonce2Tx:              &ByNonce{btree.New(32)},
+		txNonce2Tx:              &ByNonce{tree: btree.New(32)},
 		localsHistory:           localsHistory,
+		private:                 map[string]struct{}{},
+		privateHistory:          privateHistory,
+		rejected:                rejected,
 		recentlyConnectedPeers:  &recentlyConnectedPeers{},
 		pending:                 NewPendingSubPool(PendingSubPool),
 		baseFee:                 NewSubPool(BaseFeeSubPool),
 		queued:                  NewSubPool(QueuedSubPool),
 		newTxs:                  newTxs,
-		senders:                 newSendersCache(),
+		senders:                 newSendersCache(clock.Or(cfg.Clock)),
 		db:                      db,
 		coreDB:                  coreDB,
 		cfg:                     cfg,
 		senderID:                1,
 		unprocessedRemoteTxs:    &TxSlots{},
 		unprocessedRemoteByHash: map[string]int{},
-	}, nil
+		logger:                  logging.OrRoot(cfg.Logger),
+		clock:                   clock.Or(cfg.Clock),
+	}
+	p.pending.promoted = p.events.promoted
+	p.events.private = func(idHash []byte) bool {
+		_, ok := p.private[string(idHash)]
+		return ok
+	}
+	return p, nil
 }
 
 //nolint
@@ -586,7 +767,7 @@ func (p *TxPool) logStats(tx kv.Tx) error {
 	var m runtime.MemStats
 	runtime.ReadMemStats(&m)
 
-	log.Info(fmt.Sprintf("baseFee: %d, %dm; queuesSize: pending=%d/%d, baseFee=%d/%d, queued=%d/%d; sendersBatch: id=%d+%d,info=%d+%d, alloc=%dMb, sys=%dMb\n",
+	p.logger.Info(fmt.Sprintf("baseFee: %d, %dm; queuesSize: pending=%d/%d, baseFee=%d/%d, queued=%d/%d; sendersBatch: id=%d+%d,info=%d+%d, alloc=%dMb, sys=%dMb\n",
 		protocolBaseFee, currentBaseFee/1_000_000,
 		p.pending.Len(), PendingSubPoolLimit, p.baseFee.Len(), BaseFeeSubPoolLimit, p.queued.Len(), QueuedSubPoolLimit,
 		idsInMem, idsInDb, infoInMem, infoInDb,
@@ -594,13 +775,13 @@ func (p *TxPool) logStats(tx kv.Tx) error {
 	))
 	return nil
 }
-func (p *TxPool) GetRlp(tx kv.Tx, hash []byte) ([]byte, error) {
+func (p *TxPool) GetRlp(tx kv.Tx, hash common.Hash) ([]byte, error) {
 	p.lock.RLock()
 	defer p.lock.RUnlock()
 
-	txn, ok := p.byHash[string(hash)]
+	txn, ok := p.byHash[string(hash[:])]
 	if !ok || txn.Tx.rlp == nil {
-		v, err := tx.GetOne(kv.PoolTransaction, hash)
+		v, err := tx.GetOne(kv.PoolTransaction, hash[:])
 		if err != nil {
 			return nil, err
 		}
@@ -618,10 +799,28 @@ func (p *TxPool) AppendLocalHashes(buf []byte) []byte {
 		if txn.subPool&IsLocal == 0 {
 			continue
 		}
+		if _, ok := p.private[hash]; ok {
+			continue
+		}
 		buf = append(buf, hash...)
 	}
 	return buf
 }
+// appendPendingLocalHashes - local transactions which can be mined right now, to rebroadcast them
+func (p *TxPool) appendPendingLocalHashes(buf []byte) []byte {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+	for _, mt := range p.pending.best {
+		if mt.subPool&IsLocal == 0 {
+			continue
+		}
+		if _, ok := p.private[string(mt.Tx.idHash[:])]; ok {
+			continue
+		}
+		buf = append(buf, mt.Tx.idHash[:]...)
+	}
+	return buf
+}
 func (p *TxPool) AppendRemoteHashes(buf []byte) []byte {
 	p.lock.RLock()
 	defer p.lock.RUnlock()
@@ -642,42 +841,89 @@ func (p *TxPool) AppendAllHashes(buf []byte) []byte {
 	buf = p.AppendRemoteHashes(buf)
 	return buf
 }
-func (p *TxPool) IdHashKnown(tx kv.Tx, hash []byte) (bool, error) {
+func (p *TxPool) IdHashKnown(tx kv.Tx, hash common.Hash) (bool, error) {
+	return p.idHashKnown(tx, hash, true)
+}
+
+// IdHashPooled - same as IdHashKnown, but ignores recently rejected transactions: local transactions are validated again
+func (p *TxPool) IdHashPooled(tx kv.Tx, hash common.Hash) (bool, error) {
+	return p.idHashKnown(tx, hash, false)
+}
+
+func (p *TxPool) idHashKnown(tx kv.Tx, hash common.Hash, withRejected bool) (bool, error) {
 	p.lock.RLock()
 	defer p.lock.RUnlock()
-	if _, ok := p.unprocessedRemoteByHash[string(hash)]; ok {
+	if _, ok := p.unprocessedRemoteByHash[string(hash[:])]; ok {
+		return true, nil
+	}
+	if _, ok := p.byHash[string(hash[:])]; ok {
 		return true, nil
 	}
-	if _, ok := p.byHash[string(hash)]; ok {
+	if withRejected && p.isRejected(hash[:]) {
+		rejectedCacheHits.Inc()
 		return true, nil
 	}
-	return tx.Has(kv.PoolTransaction, hash)
+	return tx.Has(kv.PoolTransaction, hash[:])
 }
-func (p *TxPool) IsLocal(idHash []byte) bool {
+
+// reject - remembers hash of transaction which will be rejected again for permanent reason
+func (p *TxPool) reject(hash []byte, reason DiscardReason) {
+	if p.rejected == nil || !reason.permanent() {
+		return
+	}
+	p.rejected.Add(string(hash), p.clock.Now().Add(p.cfg.RejectedLifetime))
+}
+
+// isRejected - Peek doesn't change order of LRU, so it's safe under read lock
+func (p *TxPool) isRejected(hash []byte) bool {
+	if p.rejected == nil {
+		return false
+	}
+	until, ok := p.rejected.Peek(string(hash))
+	return ok && p.clock.Now().Before(until.(time.Time))
+}
+func (p *TxPool) IsLocal(idHash common.Hash) bool {
 	p.lock.RLock()
 	defer p.lock.RUnlock()
 
-	txn, ok := p.byHash[string(idHash)]
+	txn, ok := p.byHash[string(idHash[:])]
 	if ok && txn.subPool&IsLocal != 0 {
 		return true
 	}
-	_, ok = p.localsHistory.Get(string(idHash))
+	_, ok = p.localsHistory.Get(string(idHash[:]))
 	return ok
 }
 func (p *TxPool) AddNewGoodPeer(peerID PeerID) { p.recentlyConnectedPeers.AddPeer(peerID) }
 func (p *TxPool) Started() bool                { return p.protocolBaseFee.Load() > 0 }
 
+func (p *TxPool) Announcements(hashes Hashes) (types []byte, sizes []uint32, known Hashes) {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+	for i := 0; i < len(hashes); i += 32 {
+		mt, ok := p.byHash[string(hashes[i:i+32])]
+		if !ok {
+			continue
+		}
+		if _, ok := p.private[string(hashes[i:i+32])]; ok {
+			continue
+		}
+		types = append(types, mt.Tx.txType)
+		sizes = append(sizes, mt.Tx.netSize)
+		known = append(known, hashes[i:i+32]...)
+	}
+	return types, sizes, known
+}
+
 // Best - returns top `n` elements of pending queue
 // id doesn't perform full copy of txs, hovewer underlying elements are immutable
 func (p *TxPool) Best(n uint16, txs *TxSlots, tx kv.Tx) error {
 	p.lock.RLock()
 	defer p.lock.RUnlock()
 
-	txs.Resize(uint(min(uint64(n), uint64(len(p.pending.best)))))
-
-	best := p.pending.best
+	best := p.bestWithinBlobsLimit(n)
+	txs.Resize(uint(len(best)))
 	encID := make([]byte, 8)
-	for i := 0; i < int(n) && i < len(best); i++ {
+	for i := range best {
 		txs.txs[i] = best[i].Tx
 		txs.isLocal[i] = best[i].subPool&IsLocal > 0
 
@@ -706,12 +952,181 @@ func (p *TxPool) Best(n uint16, txs *TxSlots, tx kv.Tx) error {
 	return nil
 }
 
+// bestWithinBlobsLimit - top `n` elements of pending queue, but no more blobs than block can hold.
+// If blob transaction doesn't fit - next transactions of same sender are skipped too (they need its nonce).
+func (p *TxPool) bestWithinBlobsLimit(n uint16) []*metaTx {
+	res := make([]*metaTx, 0, min(uint64(n), uint64(len(p.pending.best))))
+	var blobs uint64
+	var skipSenders map[uint64]struct{}
+	for _, mt := range p.pending.best {
+		if len(res) == int(n) {
+			break
+		}
+		if _, ok := skipSenders[mt.Tx.senderID]; ok {
+			continue
+		}
+		if b := uint64(mt.Tx.blobHashes.Len()); b > 0 {
+			if blobs+b > p.cfg.MaxBlobsPerBlock {
+				if skipSenders == nil {
+					skipSenders = map[uint64]struct{}{}
+				}
+				skipSenders[mt.Tx.senderID] = struct{}{}
+				continue
+			}
+			blobs += b
+		}
+		res = append(res, mt)
+	}
+	return res
+}
+
 func (p *TxPool) CountContent() (int, int, int) {
 	p.lock.RLock()
 	defer p.lock.RUnlock()
 	return p.pending.Len(), p.baseFee.Len(), p.queued.Len()
 }
 
+// NonceFromPool - nonce of next transaction of sender, counting pooled transactions without nonce gaps -
+// for eth_getTransactionCount("pending"). inPool is false if pool has no transactions of sender: use nonce from state
+func (p *TxPool) NonceFromPool(tx kv.Tx, addr common.Address) (nonce uint64, inPool bool, err error) {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+	id, ok, err := p.senders.id(string(addr[:]), tx)
+	if err != nil || !ok {
+		return 0, false, err
+	}
+	info, err := p.senders.info(id, tx, true)
+	if err != nil || info == nil {
+		return 0, false, err
+	}
+	nonce = info.nonce + 1 // same as noGapsNonce of onSenderChange
+	p.txNonce2Tx.ascend(id, func(mt *metaTx) bool {
+		inPool = true
+		if mt.Tx.nonce == nonce {
+			nonce++
+		}
+		return true
+	})
+	return nonce, inPool, nil
+}
+
+// SenderStats - pooled transactions of one sender
+type SenderStats struct {
+	Pending int
+	BaseFee int
+	Queued  int
+	Cost    uint256.Int // sum of gasLimit x feeCap + value (+ blobGas x blobFeeCap) of all pooled transactions
+}
+
+func (p *TxPool) SenderStats(tx kv.Tx, addr common.Address) (stats SenderStats, err error) {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+	id, ok, err := p.senders.id(string(addr[:]), tx)
+	if err != nil || !ok {
+		return stats, err
+	}
+	p.txNonce2Tx.ascend(id, func(mt *metaTx) bool {
+		switch mt.currentSubPool {
+		case PendingSubPool:
+			stats.Pending++
+		case BaseFeeSubPool:
+			stats.BaseFee++
+		case QueuedSubPool:
+			stats.Queued++
+		}
+		stats.Cost.Add(&stats.Cost, mt.Tx.cost())
+		return true
+	})
+	return stats, nil
+}
+
+// SenderContent - transactions of one sender, ordered by nonce. Pending includes transactions of base fee sub-pool:
+// they have no nonce gaps and enough balance, but wait for lower baseFee
+type SenderContent struct {
+	Sender  common.Address
+	Pending []ContentTx
+	Queued  []ContentTx
+}
+
+// ContentTx - pooled transaction. Rlp is set only if requested, it's valid only until end of db transaction
+type ContentTx struct {
+	IdHash   common.Hash
+	Nonce    uint64
+	Tip      uint64
+	FeeCap   uint64
+	Gas      uint64
+	Value    uint256.Int
+	Creation bool
+	Local    bool
+	Private  bool      // see AddPrivate
+	Added    time.Time // when transaction was added to pool (or restored from db)
+	Rlp      []byte
+}
+
+// Content - pooled transactions grouped by sender, for txpool_content and txpool_inspect
+func (p *TxPool) Content(tx kv.Tx, withRlp bool) ([]SenderContent, error) {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+
+	addrs := make(map[uint64]string, len(p.senders.senderIDs))
+	for addr, id := range p.senders.senderIDs {
+		addrs[id] = addr
+	}
+	var res []SenderContent
+	var err error
+	lastSenderID := uint64(0)
+	encID := make([]byte, 8)
+	p.txNonce2Tx.tree.Ascend(func(i btree.Item) bool {
+		mt := i.(*sortByNonce).metaTx
+		if len(res) == 0 || lastSenderID != mt.Tx.senderID {
+			lastSenderID = mt.Tx.senderID
+			res = append(res, SenderContent{})
+			if addr, ok := addrs[lastSenderID]; ok {
+				copy(res[len(res)-1].Sender[:], addr)
+			} else {
+				binary.BigEndian.PutUint64(encID, lastSenderID)
+				var v []byte
+				if v, err = tx.GetOne(kv.PoolSenderIDToAdress, encID); err != nil {
+					return false
+				}
+				if v == nil {
+					err = fmt.Errorf("tx sender not found: %d", lastSenderID)
+					return false
+				}
+				copy(res[len(res)-1].Sender[:], v)
+			}
+		}
+		ctx := ContentTx{IdHash: mt.Tx.idHash, Nonce: mt.Tx.nonce, Tip: mt.Tx.tip, FeeCap: mt.Tx.feeCap, Gas: mt.Tx.gas, Value: mt.Tx.value, Creation: mt.Tx.creation,
+			Local: mt.subPool&IsLocal != 0, Added: mt.added}
+		_, ctx.Private = p.private[string(mt.Tx.idHash[:])]
+		if withRlp {
+			ctx.Rlp = mt.Tx.rlp
+			if ctx.Rlp == nil {
+				var v []byte
+				if v, err = tx.GetOne(kv.PoolTransaction, mt.Tx.idHash[:]); err != nil {
+					return false
+				}
+				if v == nil {
+					err = errkind.Errorf(errkind.NotFound, "tx not found in db: %x", mt.Tx.idHash)
+					return false
+				}
+				ctx.Rlp = v[8:]
+			}
+		}
+		sender := &res[len(res)-1]
+		if mt.currentSubPool == QueuedSubPool {
+			sender.Queued = append(sender.Queued, ctx)
+		} else {
+			sender.Pending = append(sender.Pending, ctx)
+		}
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
 //Deprecated need switch to streaming-like
 func (p *TxPool) DeprecatedForEach(_ context.Context, f func(rlp, sender []byte, t SubPoolType), tx kv.Tx) error {
 	p.lock.RLock()
@@ -725,11 +1140,11 @@ func (p *TxPool) DeprecatedForEach(_ context.Context, f func(rlp, sender []byte,
 		if slot.rlp == nil {
 			v, err := tx.GetOne(kv.PoolTransaction, slot.idHash[:])
 			if err != nil {
-				log.Error("get tx from db", "err", err)
+				p.logger.Error("get tx from db", "err", err)
 				return false
 			}
 			if v == nil {
-				log.Error("tx not found in db")
+				p.logger.Error("tx not found in db")
 				return false
 			}
 			slotRlp = v[8:]
@@ -748,11 +1163,11 @@ func (p *TxPool) DeprecatedForEach(_ context.Context, f func(rlp, sender []byte,
 			binary.BigEndian.PutUint64(encID, slot.senderID)
 			v, err := tx.GetOne(kv.PoolSenderIDToAdress, encID)
 			if err != nil {
-				log.Error("get sender from db", "err", err)
+				p.logger.Error("get sender from db", "err", err)
 				return false
 			}
 			if v == nil {
-				log.Error("sender not found in db")
+				p.logger.Error("sender not found in db")
 				return false
 			}
 		}
@@ -761,8 +1176,10 @@ func (p *TxPool) DeprecatedForEach(_ context.Context, f func(rlp, sender []byte,
 	})
 	return nil
 }
-func (p *TxPool) AddRemoteTxs(_ context.Context, newTxs TxSlots) {
+func (p *TxPool) AddRemoteTxs(ctx context.Context, newTxs TxSlots) {
 	defer addRemoteTxsTimer.UpdateDuration(time.Now())
+	_, span := tracing.Start(ctx, "txpool.AddRemoteTxs", "txs", len(newTxs.txs))
+	defer span.End()
 	p.lock.Lock()
 	defer p.lock.Unlock()
 	for i := range newTxs.txs {
@@ -770,18 +1187,28 @@ func (p *TxPool) AddRemoteTxs(_ context.Context, newTxs TxSlots) {
 		if ok {
 			continue
 		}
+		if p.isRejected(newTxs.txs[i].idHash[:]) {
+			rejectedCacheHits.Inc()
+			continue
+		}
 		p.unprocessedRemoteTxs.Append(newTxs.txs[i], newTxs.senders.At(i), newTxs.isLocal[i])
 	}
 }
-func (p *TxPool) AddLocals(ctx context.Context, newTxs TxSlots, tx kv.Tx) ([]DiscardReason, error) {
+func (p *TxPool) AddLocals(ctx context.Context, newTxs TxSlots, tx kv.Tx) (reasons []DiscardReason, err error) {
+	ctx, span := tracing.Start(ctx, "txpool.AddLocals", "txs", len(newTxs.txs))
+	defer func() { tracing.End(span, err) }()
 	p.lock.Lock()
 	defer p.lock.Unlock()
-	discardReasonsIndex := len(p.discardReasons)
 
 	for i := range newTxs.isLocal {
 		newTxs.isLocal[i] = true
 	}
+	return p.addTxsLocked(ctx, newTxs, tx)
+}
 
+// addTxsLocked - validates and adds transactions with already set isLocal flags, returns reason for each of them
+func (p *TxPool) addTxsLocked(ctx context.Context, newTxs TxSlots, tx kv.Tx) ([]DiscardReason, error) {
+	validationStart := time.Now()
 	cacheMisses, err := p.senders.onNewTxs(tx, newTxs)
 	if err != nil {
 		return nil, err
@@ -794,14 +1221,43 @@ func (p *TxPool) AddLocals(ctx context.Context, newTxs TxSlots, tx kv.Tx) ([]Dis
 	if err := newTxs.Valid(); err != nil {
 		return nil, err
 	}
+	reasons := make([]DiscardReason, len(newTxs.txs))
+	rules := p.rules()
+	checkIntrinsicGas(newTxs, reasons, &rules)
+	p.checkBlobs(newTxs, reasons)
+	p.checkReplacements(newTxs, reasons)
+	p.checkAccountSlots(newTxs, reasons)
+	if err := p.checkNonces(tx, newTxs, reasons); err != nil {
+		return nil, err
+	}
+	if err := p.checkAdmission(tx, newTxs, reasons); err != nil {
+		return nil, err
+	}
+	for i := range newTxs.txs {
+		p.reject(newTxs.txs[i].idHash[:], reasons[i])
+		p.countRejected(reasons[i])
+	}
+	allTxs := newTxs
+	newTxs = filterTxs(newTxs, reasons)
+	p.observeValidation(validationStart)
 
 	protocolBaseFee, currentBaseFee := p.protocolBaseFee.Load(), p.currentBaseFee.Load()
 	if protocolBaseFee == 0 || currentBaseFee == 0 {
 		return nil, fmt.Errorf("non-zero base fee: %d,%d", protocolBaseFee, currentBaseFee)
 	}
-	if err := onNewTxs(tx, p.senders, newTxs, protocolBaseFee, currentBaseFee, p.pending, p.baseFee, p.queued, p.txNonce2Tx, p.byHash, p.discardLocked); err != nil {
+	p.batchDiscards = map[string]DiscardReason{}
+	defer func() { p.batchDiscards = nil }()
+	if err := onNewTxs(tx, p.senders, newTxs, protocolBaseFee, currentBaseFee, p.currentBlobFee.Load(), p.pending, p.baseFee, p.queued, p.txNonce2Tx, p.byHash, p.clock.Now(), p.discardLocked); err != nil {
 		return nil, err
 	}
+	p.enforceGlobalSlots()
+	p.tips.refresh(p.pending, currentBaseFee)
+	p.updateSizeMetrics()
+	for i := range allTxs.txs { // valid, but dropped by promote or slots limit
+		if reason, ok := p.batchDiscards[string(allTxs.txs[i].idHash[:])]; ok && reasons[i] == Success {
+			reasons[i] = reason
+		}
+	}
 
 	// notify about all non-dropped txs
 	notifyNewTxs := make(Hashes, 0, 32*len(newTxs.txs))
@@ -810,6 +1266,11 @@ func (p *TxPool) AddLocals(ctx context.Context, newTxs TxSlots, tx kv.Tx) ([]Dis
 		if !ok {
 			continue
 		}
+		p.countAdded(newTxs.isLocal[i])
+		if _, ok := p.private[string(newTxs.txs[i].idHash[:])]; ok {
+			continue
+		}
+		p.events.added(newTxs.txs[i].idHash[:], false)
 		notifyNewTxs = append(notifyNewTxs, newTxs.txs[i].idHash[:]...)
 	}
 	if len(notifyNewTxs) > 0 {
@@ -818,20 +1279,17 @@ func (p *TxPool) AddLocals(ctx context.Context, newTxs TxSlots, tx kv.Tx) ([]Dis
 		default:
 		}
 	}
-	return p.copyDiscardReasons(discardReasonsIndex), nil
-}
-func (p *TxPool) copyDiscardReasons(from int) []DiscardReason {
-	cpy := make([]DiscardReason, len(p.discardReasons)-from)
-	copy(cpy, p.discardReasons[from:])
-	return cpy
+	return reasons, nil
 }
-func (p *TxPool) processRemoteTxs(ctx context.Context) error {
+func (p *TxPool) processRemoteTxs(ctx context.Context) (err error) {
 	p.lock.RLock()
 	l := len(p.unprocessedRemoteTxs.txs)
 	p.lock.RUnlock()
 	if l == 0 {
 		return nil
 	}
+	ctx, span := tracing.Start(ctx, "txpool.processRemoteTxs", "txs", l)
+	defer func() { tracing.End(span, err) }()
 
 	defer processBatchTxsTimer.UpdateDuration(time.Now())
 	//t := time.Now()
@@ -844,6 +1302,7 @@ func (p *TxPool) processRemoteTxs(ctx context.Context) error {
 		return err
 	}
 	defer tx.Rollback()
+	validationStart := time.Now()
 	cacheMisses, err := p.senders.onNewTxs(tx, newTxs)
 	if err != nil {
 		return err
@@ -856,14 +1315,35 @@ func (p *TxPool) processRemoteTxs(ctx context.Context) error {
 	if err := newTxs.Valid(); err != nil {
 		return err
 	}
+	reasons := make([]DiscardReason, len(newTxs.txs))
+	rules := p.rules()
+	checkIntrinsicGas(newTxs, reasons, &rules)
+	p.checkBlobs(newTxs, reasons)
+	p.checkReplacements(newTxs, reasons)
+	p.checkAccountSlots(newTxs, reasons)
+	if err := p.checkNonces(tx, newTxs, reasons); err != nil {
+		return err
+	}
+	if err := p.checkAdmission(tx, newTxs, reasons); err != nil {
+		return err
+	}
+	for i := range newTxs.txs {
+		p.reject(newTxs.txs[i].idHash[:], reasons[i])
+		p.countRejected(reasons[i])
+	}
+	newTxs = filterTxs(newTxs, reasons)
+	p.observeValidation(validationStart)
 
 	protocolBaseFee, currentBaseFee := p.protocolBaseFee.Load(), p.currentBaseFee.Load()
 	if protocolBaseFee == 0 || currentBaseFee == 0 {
 		return fmt.Errorf("non-zero base fee: %d,%d", protocolBaseFee, currentBaseFee)
 	}
-	if err := onNewTxs(tx, p.senders, newTxs, protocolBaseFee, currentBaseFee, p.pending, p.baseFee, p.queued, p.txNonce2Tx, p.byHash, p.discardLocked); err != nil {
+	if err := onNewTxs(tx, p.senders, newTxs, protocolBaseFee, currentBaseFee, p.currentBlobFee.Load(), p.pending, p.baseFee, p.queued, p.txNonce2Tx, p.byHash, p.clock.Now(), p.discardLocked); err != nil {
 		return err
 	}
+	p.enforceGlobalSlots()
+	p.tips.refresh(p.pending, currentBaseFee)
+	p.updateSizeMetrics()
 
 	// notify about all non-dropped txs
 	notifyNewTxs := make(Hashes, 0, 32*len(newTxs.txs))
@@ -873,6 +1353,8 @@ func (p *TxPool) processRemoteTxs(ctx context.Context) error {
 			continue
 		}
 		notifyNewTxs = append(notifyNewTxs, newTxs.txs[i].idHash[:]...)
+		p.events.added(newTxs.txs[i].idHash[:], false)
+		p.countAdded(newTxs.isLocal[i])
 	}
 	if len(notifyNewTxs) > 0 {
 		select {
@@ -887,20 +1369,242 @@ func (p *TxPool) processRemoteTxs(ctx context.Context) error {
 	//log.Info("on new txs", "amount", len(newTxs.txs), "in", time.Since(t))
 	return nil
 }
-func onNewTxs(tx kv.Tx, senders *sendersBatch, newTxs TxSlots, protocolBaseFee, currentBaseFee uint64, pending *PendingPool, baseFee, queued *SubPool, byNonce *ByNonce, byHash map[string]*metaTx, discard func(*metaTx)) error {
+// filterBlobTxs - drops blob transactions which can't be accepted, see checkBlobs
+func (p *TxPool) filterBlobTxs(txs TxSlots) TxSlots {
+	reasons := make([]DiscardReason, len(txs.txs))
+	p.checkBlobs(txs, reasons)
+	return filterTxs(txs, reasons)
+}
+
+// rules - forks of pending block: next after last seen one, by current time
+func (p *TxPool) rules() chain.Rules {
+	if p.cfg.Chain == nil {
+		return latestRules
+	}
+	return p.cfg.Chain.Rules(p.senders.blockHeight.Load()+1, uint64(p.clock.Now().Unix()))
+}
+
+// checkIntrinsicGas - calculates intrinsic gas of transactions by given rules and sets IntrinsicGasTooLow
+// reason for transactions which are invalid in any state
+func checkIntrinsicGas(txs TxSlots, reasons []DiscardReason, rules *chain.Rules) {
+	for i, txn := range txs.txs {
+		txn.intrinsic = IntrinsicGas(txn.dataLen, txn.dataNonZero, txn.alAddrCount, txn.alStorCount, txn.creation, rules)
+		if reasons[i] == 0 && txn.gas < txn.intrinsic {
+			reasons[i] = IntrinsicGasTooLow
+		}
+	}
+}
+
+// checkBlobs - sets BlobsRejected reason for blob transactions which can't be accepted: without sidecar (pool must
+// be able to serve blobs to peers, so mined and then unwinded blob transactions are not returned to pool), with more
+// blobs than block can hold, or if pool has no room for their blobs
+func (p *TxPool) checkBlobs(txs TxSlots, reasons []DiscardReason) {
+	blobs := p.txNonce2Tx.blobs
+	for i, txn := range txs.txs {
+		b := uint64(txn.blobHashes.Len())
+		if b == 0 || reasons[i] != 0 {
+			continue
+		}
+		if !txn.withSidecar || b > p.cfg.MaxBlobsPerBlock || blobs+b > p.cfg.BlobSlots {
+			reasons[i] = BlobsRejected
+			continue
+		}
+		blobs += b
+	}
+}
+
+// checkReplacements - sets AlreadyKnown and ReplaceUnderpriced reasons. senderID of transactions must be set
+func (p *TxPool) checkReplacements(txs TxSlots, reasons []DiscardReason) {
+	for i, txn := range txs.txs {
+		if reasons[i] != 0 {
+			continue
+		}
+		if _, ok := p.byHash[string(txn.idHash[:])]; ok {
+			reasons[i] = AlreadyKnown
+			continue
+		}
+		found := p.txNonce2Tx.get(txn.senderID, txn.nonce)
+		if found == nil {
+			continue
+		}
+		bump := p.cfg.PriceBump
+		if txs.isLocal[i] {
+			if b, ok := p.cfg.LocalPriceBumps[string(txs.senders.At(i))]; ok {
+				bump = b
+			}
+		}
+		if !bump.enough(found.Tx, txn) {
+			reasons[i] = ReplaceUnderpriced
+		}
+	}
+}
+
+// checkNonces - sets NonceTooLow reason for transactions with nonce which sender already used, same as onSenderChange
+func (p *TxPool) checkNonces(tx kv.Tx, txs TxSlots, reasons []DiscardReason) error {
+	for i, txn := range txs.txs {
+		if reasons[i] != 0 {
+			continue
+		}
+		sender, err := p.senders.info(txn.senderID, tx, false)
+		if err != nil {
+			return err
+		}
+		if txn.nonce <= sender.nonce {
+			reasons[i] = NonceTooLow
+		}
+	}
+	return nil
+}
+
+// checkAccountSlots - sets Spammer reason for remote transactions of senders which have no free slots.
+// Replacements don't need free slots
+func (p *TxPool) checkAccountSlots(txs TxSlots, reasons []DiscardReason) {
+	if p.cfg.AccountSlots == 0 {
+		return
+	}
+	var used map[uint64]uint64 // by senderID
+	for i, txn := range txs.txs {
+		if reasons[i] != 0 || txs.isLocal[i] || p.txNonce2Tx.get(txn.senderID, txn.nonce) != nil {
+			continue
+		}
+		if used == nil {
+			used = map[uint64]uint64{}
+		}
+		slots, ok := used[txn.senderID]
+		if !ok {
+			p.txNonce2Tx.ascend(txn.senderID, func(mt *metaTx) bool {
+				slots += mt.Tx.slots()
+				return true
+			})
+		}
+		if slots+txn.slots() > p.cfg.AccountSlots {
+			reasons[i] = Spammer
+			used[txn.senderID] = slots
+			continue
+		}
+		used[txn.senderID] = slots + txn.slots()
+	}
+}
+
+// enforceGlobalSlots - evicts worst remote transactions (queued first, then base fee, then pending) while pool
+// has more than GlobalSlots. Evicted transaction takes with it next transactions of same sender - they can't be
+// mined without it anyway
+func (p *TxPool) enforceGlobalSlots() {
+	if p.cfg.GlobalSlots == 0 || p.txNonce2Tx.slots <= p.cfg.GlobalSlots {
+		return
+	}
+	candidates := make([]*metaTx, 0, len(p.byHash))
+	for _, sub := range [][]*metaTx{*p.queued.worst, *p.baseFee.worst, *p.pending.worst} {
+		from := len(candidates)
+		candidates = append(candidates, sub...)
+		part := candidates[from:]
+		sort.Slice(part, func(i, j int) bool { return part[i].Less(part[j]) })
+	}
+	for _, mt := range candidates {
+		if p.txNonce2Tx.slots <= p.cfg.GlobalSlots {
+			break
+		}
+		if mt.subPool&IsLocal != 0 {
+			continue
+		}
+		if _, ok := p.byHash[string(mt.Tx.idHash[:])]; !ok { // already evicted
+			continue
+		}
+		p.evictWithNextNonces(mt, PoolOverflow)
+	}
+	p.pending.EnforceInvariants()
+	p.baseFee.EnforceInvariants()
+	p.queued.EnforceInvariants()
+}
+
+// evictStaleQueued - evicts remote transactions which are queued longer than QueuedLifetime
+func (p *TxPool) evictStaleQueued(now time.Time) {
+	if p.cfg.QueuedLifetime == 0 {
+		return
+	}
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	var stale []*metaTx
+	for _, mt := range *p.queued.best {
+		if mt.subPool&IsLocal == 0 && now.Sub(mt.added) > p.cfg.QueuedLifetime {
+			stale = append(stale, mt)
+		}
+	}
+	if len(stale) == 0 {
+		return
+	}
+	for _, mt := range stale {
+		if _, ok := p.byHash[string(mt.Tx.idHash[:])]; !ok { // already evicted
+			continue
+		}
+		p.evictWithNextNonces(mt, QueuedTooLong)
+	}
+	p.pending.EnforceInvariants()
+	p.baseFee.EnforceInvariants()
+	p.queued.EnforceInvariants()
+}
+
+// evictWithNextNonces - removes transaction and next transactions of same sender, without restoring sub-pools
+// invariants
+func (p *TxPool) evictWithNextNonces(mt *metaTx, reason DiscardReason) {
+	var toEvict []*metaTx
+	p.txNonce2Tx.ascend(mt.Tx.senderID, func(other *metaTx) bool {
+		if other.Tx.nonce >= mt.Tx.nonce {
+			toEvict = append(toEvict, other)
+		}
+		return true
+	})
+	for _, other := range toEvict {
+		switch other.currentSubPool {
+		case PendingSubPool:
+			p.pending.UnsafeRemove(other)
+		case BaseFeeSubPool:
+			p.baseFee.UnsafeRemove(other)
+		case QueuedSubPool:
+			p.queued.UnsafeRemove(other)
+		}
+		p.discardLocked(other, reason)
+	}
+}
+
+// filterTxs - sets Success reason for all transactions without reason, drops others
+func filterTxs(txs TxSlots, reasons []DiscardReason) TxSlots {
+	var res *TxSlots
+	for i, txn := range txs.txs {
+		ok := reasons[i] == 0 || reasons[i] == Success
+		if ok {
+			reasons[i] = Success
+		}
+		if !ok && res == nil { // copy on first drop
+			res = &TxSlots{}
+			for j := 0; j < i; j++ {
+				res.Append(txs.txs[j], txs.senders.At(j), txs.isLocal[j])
+			}
+		}
+		if ok && res != nil {
+			res.Append(txn, txs.senders.At(i), txs.isLocal[i])
+		}
+	}
+	if res == nil {
+		return txs
+	}
+	return *res
+}
+
+func onNewTxs(tx kv.Tx, senders *sendersBatch, newTxs TxSlots, protocolBaseFee, currentBaseFee, currentBlobFee uint64, pending *PendingPool, baseFee, queued *SubPool, byNonce *ByNonce, byHash map[string]*metaTx, now time.Time, discard func(*metaTx, DiscardReason)) error {
 	for i := range newTxs.txs {
 		if newTxs.txs[i].senderID == 0 {
 			return fmt.Errorf("senderID can't be zero")
 		}
 	}
 
-	changedSenders := unsafeAddToPendingPool(byNonce, newTxs, pending, baseFee, queued, byHash, discard)
+	changedSenders := unsafeAddToPendingPool(byNonce, newTxs, pending, baseFee, queued, byHash, now, discard)
 	for id := range changedSenders {
 		sender, err := senders.info(id, tx, false)
 		if err != nil {
 			return err
 		}
-		onSenderChange(id, sender, byNonce, protocolBaseFee, currentBaseFee)
+		onSenderChange(id, sender, byNonce, protocolBaseFee, currentBaseFee, currentBlobFee)
 	}
 
 	pending.EnforceInvariants()
@@ -921,8 +1625,10 @@ func (p *TxPool) setBaseFee(baseFee uint64) (uint64, uint64) {
 	return p.protocolBaseFee.Load(), p.currentBaseFee.Load()
 }
 
-func (p *TxPool) OnNewBlock(stateChanges map[string]senderInfo, unwindTxs, minedTxs TxSlots, baseFee, blockHeight uint64, blockHash [32]byte) error {
+func (p *TxPool) OnNewBlock(stateChanges map[string]senderInfo, unwindTxs, minedTxs TxSlots, baseFee, blobFee, blockHeight uint64, blockHash common.Hash) (err error) {
 	defer newBlockTimer.UpdateDuration(time.Now())
+	_, span := tracing.Start(context.Background(), "txpool.OnNewBlock", "block", blockHeight, "mined", len(minedTxs.txs), "unwound", len(unwindTxs.txs))
+	defer func() { tracing.End(span, err) }()
 	p.lock.Lock()
 	defer p.lock.Unlock()
 
@@ -933,6 +1639,8 @@ func (p *TxPool) OnNewBlock(stateChanges map[string]senderInfo, unwindTxs, mined
 	}
 	defer tx.Rollback()
 	protocolBaseFee, baseFee := p.setBaseFee(baseFee)
+	p.currentBlobFee.Store(blobFee)
+	unwindTxs = p.filterBlobTxs(unwindTxs)
 	if err := p.senders.onNewBlock(tx, stateChanges, unwindTxs, minedTxs, blockHeight, blockHash); err != nil {
 		return err
 	}
@@ -943,17 +1651,37 @@ func (p *TxPool) OnNewBlock(stateChanges map[string]senderInfo, unwindTxs, mined
 	if err := minedTxs.Valid(); err != nil {
 		return err
 	}
+	unwindTxs = skipReincluded(unwindTxs, minedTxs)
+	for i := range unwindTxs.txs {
+		if p.rejected != nil {
+			p.rejected.Remove(string(unwindTxs.txs[i].idHash[:])) // was mined
+		}
+		if _, ok := p.localsHistory.Get(string(unwindTxs.txs[i].idHash[:])); ok {
+			unwindTxs.isLocal[i] = true
+		}
+		if _, ok := p.privateHistory.Get(string(unwindTxs.txs[i].idHash[:])); ok {
+			p.private[string(unwindTxs.txs[i].idHash[:])] = struct{}{}
+		}
+	}
 
-	if err := onNewBlock(tx, p.senders, unwindTxs, minedTxs.txs, protocolBaseFee, baseFee, p.pending, p.baseFee, p.queued, p.txNonce2Tx, p.byHash, p.discardLocked); err != nil {
+	if err := onNewBlock(tx, p.senders, unwindTxs, minedTxs.txs, protocolBaseFee, baseFee, blobFee, p.pending, p.baseFee, p.queued, p.txNonce2Tx, p.byHash, p.clock.Now(), p.discardLocked); err != nil {
 		return err
 	}
+	p.tips.refresh(p.pending, baseFee)
+	p.updateSizeMetrics()
 
 	notifyNewTxs := make(Hashes, 0, 32*len(unwindTxs.txs))
 	for i := range unwindTxs.txs {
 		_, ok := p.byHash[string(unwindTxs.txs[i].idHash[:])]
 		if !ok {
+			delete(p.private, string(unwindTxs.txs[i].idHash[:]))
+			continue
+		}
+		if _, ok := p.private[string(unwindTxs.txs[i].idHash[:])]; ok {
+			p.privateHistory.Remove(string(unwindTxs.txs[i].idHash[:]))
 			continue
 		}
+		p.events.added(unwindTxs.txs[i].idHash[:], true)
 		notifyNewTxs = append(notifyNewTxs, unwindTxs.txs[i].idHash[:]...)
 	}
 	if len(notifyNewTxs) > 0 {
@@ -963,18 +1691,56 @@ func (p *TxPool) OnNewBlock(stateChanges map[string]senderInfo, unwindTxs, mined
 		}
 	}
 
-	log.Info("new block", "number", blockHeight, "in", time.Since(t))
+	p.logger.Info("new block", "number", blockHeight, "in", time.Since(t))
 	return nil
 }
-func (p *TxPool) discardLocked(mt *metaTx) {
+
+// OnNewChain - reorg: transactions of unwound blocks (ordered from highest to lowest) are re-validated and returned
+// to pool, except those which applied blocks (ordered from lowest to highest) include - or replace by transaction
+// with same sender and nonce. Transactions of applied blocks are removed from pool.
+// stateChanges, baseFee, blobFee, blockHeight, blockHash - of new head
+func (p *TxPool) OnNewChain(stateChanges map[string]senderInfo, unwound, applied []TxSlots, baseFee, blobFee, blockHeight uint64, blockHash common.Hash) error {
+	var unwindTxs, minedTxs TxSlots
+	for _, txs := range unwound {
+		if err := txs.Valid(); err != nil {
+			return err
+		}
+		for i := range txs.txs {
+			unwindTxs.Append(txs.txs[i], txs.senders.At(i), txs.isLocal[i])
+		}
+	}
+	for _, txs := range applied {
+		if err := txs.Valid(); err != nil {
+			return err
+		}
+		for i := range txs.txs {
+			minedTxs.Append(txs.txs[i], txs.senders.At(i), txs.isLocal[i])
+		}
+	}
+	return p.OnNewBlock(stateChanges, unwindTxs, minedTxs, baseFee, blobFee, blockHeight, blockHash)
+}
+
+func (p *TxPool) discardLocked(mt *metaTx, reason DiscardReason) {
+	p.events.discarded(mt, reason) // before private mark is deleted
+	if p.batchDiscards != nil {
+		p.batchDiscards[string(mt.Tx.idHash[:])] = reason
+	}
+	p.countDiscarded(reason)
+	p.reject(mt.Tx.idHash[:], reason)
 	delete(p.byHash, string(mt.Tx.idHash[:]))
 	p.deletedTxs = append(p.deletedTxs, mt)
 	p.txNonce2Tx.delete(mt)
 	if mt.subPool&IsLocal != 0 {
 		p.localsHistory.Add(string(mt.Tx.idHash[:]), struct{}{})
 	}
+	if _, ok := p.private[string(mt.Tx.idHash[:])]; ok {
+		delete(p.private, string(mt.Tx.idHash[:]))
+		if reason == Mined {
+			p.privateHistory.Add(string(mt.Tx.idHash[:]), struct{}{})
+		}
+	}
 }
-func onNewBlock(tx kv.Tx, senders *sendersBatch, unwindTxs TxSlots, minedTxs []*TxSlot, protocolBaseFee, pendingBaseFee uint64, pending *PendingPool, baseFee, queued *SubPool, byNonce *ByNonce, byHash map[string]*metaTx, discard func(*metaTx)) error {
+func onNewBlock(tx kv.Tx, senders *sendersBatch, unwindTxs TxSlots, minedTxs []*TxSlot, protocolBaseFee, pendingBaseFee, pendingBlobFee uint64, pending *PendingPool, baseFee, queued *SubPool, byNonce *ByNonce, byHash map[string]*metaTx, now time.Time, discard func(*metaTx, DiscardReason)) error {
 	for i := range unwindTxs.txs {
 		if unwindTxs.txs[i].senderID == 0 {
 			return fmt.Errorf("onNewBlock.unwindTxs: senderID can't be zero")
@@ -999,13 +1765,13 @@ func onNewBlock(tx kv.Tx, senders *sendersBatch, unwindTxs TxSlots, minedTxs []*
 	// they effective lose their priority over the "remote" transactions. In order to prevent that,
 	// somehow the fact that certain transactions were local, needs to be remembered for some
 	// time (up to some "immutability threshold").
-	changedSenders := unsafeAddToPendingPool(byNonce, unwindTxs, pending, baseFee, queued, byHash, discard)
+	changedSenders := unsafeAddToPendingPool(byNonce, unwindTxs, pending, baseFee, queued, byHash, now, discard)
 	for id := range changedSenders {
 		sender, err := senders.info(id, tx, false)
 		if err != nil {
 			return err
 		}
-		onSenderChange(id, sender, byNonce, protocolBaseFee, pendingBaseFee)
+		onSenderChange(id, sender, byNonce, protocolBaseFee, pendingBaseFee, pendingBlobFee)
 	}
 
 	pending.EnforceInvariants()
@@ -1025,7 +1791,7 @@ func onNewBlock(tx kv.Tx, senders *sendersBatch, unwindTxs TxSlots, minedTxs []*
 // modify state_balance and state_nonce, potentially remove some elements (if transaction with some nonce is
 // included into a block), and finally, walk over the transaction records and update SubPool fields depending on
 // the actual presence of nonce gaps and what the balance is.
-func removeMined(byNonce *ByNonce, minedTxs []*TxSlot, pending *PendingPool, baseFee, queued *SubPool, discard func(tx *metaTx)) error {
+func removeMined(byNonce *ByNonce, minedTxs []*TxSlot, pending *PendingPool, baseFee, queued *SubPool, discard func(*metaTx, DiscardReason)) error {
 	noncesToRemove := map[uint64]uint64{}
 	for _, txn := range minedTxs {
 		nonce, ok := noncesToRemove[txn.senderID]
@@ -1061,21 +1827,42 @@ func removeMined(byNonce *ByNonce, minedTxs []*TxSlot, pending *PendingPool, bas
 		})
 
 		for i := range toDel {
-			discard(toDel[i])
+			discard(toDel[i], Mined)
 		}
 		toDel = toDel[:0]
 	}
 	return nil
 }
 
+// skipReincluded - unwinded transactions must not return to pool if new chain has them or other transactions of
+// same sender with same or higher nonce. Sender IDs of both lists must be set.
+func skipReincluded(unwindTxs, minedTxs TxSlots) TxSlots {
+	if len(unwindTxs.txs) == 0 || len(minedTxs.txs) == 0 {
+		return unwindTxs
+	}
+	minedNonces := map[uint64]uint64{}
+	for _, txn := range minedTxs.txs {
+		if nonce, ok := minedNonces[txn.senderID]; !ok || txn.nonce > nonce {
+			minedNonces[txn.senderID] = txn.nonce
+		}
+	}
+	reasons := make([]DiscardReason, len(unwindTxs.txs))
+	for i, txn := range unwindTxs.txs {
+		if nonce, ok := minedNonces[txn.senderID]; ok && txn.nonce <= nonce {
+			reasons[i] = Mined
+		}
+	}
+	return filterTxs(unwindTxs, reasons)
+}
+
 // unwind
-func unsafeAddToPendingPool(byNonce *ByNonce, newTxs TxSlots, pending *PendingPool, baseFee, queued *SubPool, byHash map[string]*metaTx, discard func(tx *metaTx)) (changedSenders map[uint64]struct{}) {
+func unsafeAddToPendingPool(byNonce *ByNonce, newTxs TxSlots, pending *PendingPool, baseFee, queued *SubPool, byHash map[string]*metaTx, now time.Time, discard func(*metaTx, DiscardReason)) (changedSenders map[uint64]struct{}) {
 	changedSenders = map[uint64]struct{}{}
 	for i, txn := range newTxs.txs {
 		if _, ok := byHash[string(txn.idHash[:])]; ok {
 			continue
 		}
-		mt := newMetaTx(txn, newTxs.isLocal[i])
+		mt := newMetaTx(txn, newTxs.isLocal[i], now)
 
 		// Insert to pending pool, if pool doesn't have txn with same Nonce and bigger Tip
 		found := byNonce.get(txn.senderID, txn.nonce)
@@ -1095,7 +1882,7 @@ func unsafeAddToPendingPool(byNonce *ByNonce, newTxs TxSlots, pending *PendingPo
 				//already removed
 			}
 
-			discard(found)
+			discard(found, ReplacedByHigherTip)
 		}
 
 		byHash[string(txn.idHash[:])] = mt
@@ -1111,16 +1898,40 @@ func unsafeAddToPendingPool(byNonce *ByNonce, newTxs TxSlots, pending *PendingPo
 	return changedSenders
 }
 
-func onSenderChange(senderID uint64, sender *senderInfo, byNonce *ByNonce, protocolBaseFee, currentBaseFee uint64) {
+// txSlotSize - transaction occupies 1 slot of pool per started 32Kb of rlp. Blob transaction keeps sidecar in rlp
+const txSlotSize = 32 * 1024
+
+func (tx *TxSlot) slots() uint64 {
+	size := tx.size
+	if tx.withSidecar && tx.netSize > size {
+		size = tx.netSize
+	}
+	if size == 0 {
+		return 1
+	}
+	return (uint64(size) + txSlotSize - 1) / txSlotSize
+}
+
+// cost - sender must have enough balance for: gasLimit x feeCap + transferred_value (+ blobGas x blobFeeCap)
+func (tx *TxSlot) cost() *uint256.Int {
+	res := uint256.NewInt(tx.gas)
+	res.Mul(res, uint256.NewInt(tx.feeCap))
+	res.Add(res, &tx.value)
+	if tx.blobHashes.Len() > 0 {
+		blobCost := uint256.NewInt(tx.blobGas())
+		blobCost.Mul(blobCost, uint256.NewInt(tx.blobFeeCap))
+		res.Add(res, blobCost)
+	}
+	return res
+}
+
+func onSenderChange(senderID uint64, sender *senderInfo, byNonce *ByNonce, protocolBaseFee, currentBaseFee, currentBlobFee uint64) {
 	noGapsNonce := sender.nonce + 1
 	cumulativeRequiredBalance := uint256.NewInt(0)
 	minFeeCap := uint64(math.MaxUint64)
 	minTip := uint64(math.MaxUint64)
 	byNonce.ascend(senderID, func(mt *metaTx) bool {
-		// Sender has enough balance for: gasLimit x feeCap + transferred_value
-		needBalance := uint256.NewInt(mt.Tx.gas)
-		needBalance.Mul(needBalance, uint256.NewInt(mt.Tx.feeCap))
-		needBalance.Add(needBalance, &mt.Tx.value)
+		needBalance := mt.Tx.cost()
 		minFeeCap = min(minFeeCap, mt.Tx.feeCap)
 		minTip = min(minTip, mt.Tx.tip)
 		if currentBaseFee >= minFeeCap {
@@ -1166,8 +1977,9 @@ func onSenderChange(senderID uint64, sender *senderInfo, byNonce *ByNonce, proto
 
 		// 4. Dynamic fee requirement. Set to 1 if feeCap of the transaction is no less than
 		// baseFee of the currently pending block. Set to 0 otherwise.
+		// Blob transactions also must have blobFeeCap no less than blob base fee of pending block.
 		mt.subPool &^= EnoughFeeCapBlock
-		if mt.Tx.feeCap >= currentBaseFee {
+		if mt.Tx.feeCap >= currentBaseFee && (mt.Tx.blobHashes.Len() == 0 || mt.Tx.blobFeeCap >= currentBlobFee) {
 			mt.subPool |= EnoughFeeCapBlock
 		}
 
@@ -1178,7 +1990,7 @@ func onSenderChange(senderID uint64, sender *senderInfo, byNonce *ByNonce, proto
 	})
 }
 
-func promote(pending *PendingPool, baseFee, queued *SubPool, discard func(*metaTx)) {
+func promote(pending *PendingPool, baseFee, queued *SubPool, discard func(*metaTx, DiscardReason)) {
 	//1. If top element in the worst green queue has subPool != 0b1111 (binary), it needs to be removed from the green pool.
 	//   If subPool < 0b1000 (not satisfying minimum fee), discard.
 	//   If subPool == 0b1110, demote to the yellow pool, otherwise demote to the red pool.
@@ -1194,7 +2006,7 @@ func promote(pending *PendingPool, baseFee, queued *SubPool, discard func(*metaT
 			queued.Add(pending.PopWorst())
 			continue
 		}
-		discard(pending.PopWorst())
+		discard(pending.PopWorst(), FeeTooLow)
 	}
 
 	//2. If top element in the worst green queue has subPool == 0b1111, but there is not enough room in the pool, discard.
@@ -1202,7 +2014,7 @@ func promote(pending *PendingPool, baseFee, queued *SubPool, discard func(*metaT
 		if worst.subPool >= 0b11111 { // TODO: here must 'subPool == 0b1111' or 'subPool <= 0b1111' ?
 			break
 		}
-		discard(pending.PopWorst())
+		discard(pending.PopWorst(), PoolOverflow)
 	}
 
 	//3. If the top element in the best yellow queue has subPool == 0b1111, promote to the green pool.
@@ -1210,7 +2022,7 @@ func promote(pending *PendingPool, baseFee, queued *SubPool, discard func(*metaT
 		if best.subPool < 0b11110 {
 			break
 		}
-		pending.UnsafeAdd(baseFee.PopBest())
+		pending.promote(baseFee.PopBest())
 	}
 
 	//4. If the top element in the worst yellow queue has subPool != 0x1110, it needs to be removed from the yellow pool.
@@ -1223,15 +2035,24 @@ func promote(pending *PendingPool, baseFee, queued *SubPool, discard func(*metaT
 			queued.Add(baseFee.PopWorst())
 			continue
 		}
-		discard(baseFee.PopWorst())
+		discard(baseFee.PopWorst(), FeeTooLow)
 	}
 
 	//5. If the top element in the worst yellow queue has subPool == 0x1110, but there is not enough room in the pool, discard.
-	for worst := baseFee.Worst(); baseFee.Len() > BaseFeeSubPoolLimit; worst = baseFee.Worst() {
+	//   Local transactions are not discarded by size limit.
+	var locals []*metaTx
+	for worst := baseFee.Worst(); baseFee.Len() > 0 && baseFee.Len()+len(locals) > BaseFeeSubPoolLimit; worst = baseFee.Worst() {
 		if worst.subPool >= 0b11110 {
 			break
 		}
-		discard(baseFee.PopWorst())
+		if worst.subPool&IsLocal != 0 {
+			locals = append(locals, baseFee.PopWorst())
+			continue
+		}
+		discard(baseFee.PopWorst(), PoolOverflow)
+	}
+	for _, mt := range locals {
+		baseFee.Add(mt)
 	}
 
 	//6. If the top element in the best red queue has subPool == 0x1110, promote to the yellow pool. If subPool == 0x1111, promote to the green pool.
@@ -1244,7 +2065,7 @@ func promote(pending *PendingPool, baseFee, queued *SubPool, discard func(*metaT
 			continue
 		}
 
-		pending.UnsafeAdd(queued.PopBest())
+		pending.promote(queued.PopBest())
 	}
 
 	//7. If the top element in the worst red queue has subPool < 0b1000 (not satisfying minimum fee), discard.
@@ -1253,19 +2074,29 @@ func promote(pending *PendingPool, baseFee, queued *SubPool, discard func(*metaT
 			break
 		}
 
-		discard(queued.PopWorst())
+		discard(queued.PopWorst(), FeeTooLow)
 	}
 
 	//8. If the top element in the worst red queue has subPool >= 0b100, but there is not enough room in the pool, discard.
-	for _ = queued.Worst(); queued.Len() > QueuedSubPoolLimit; _ = queued.Worst() {
-		discard(queued.PopWorst())
+	//   Local transactions are not discarded by size limit.
+	locals = locals[:0]
+	for worst := queued.Worst(); queued.Len() > 0 && queued.Len()+len(locals) > QueuedSubPoolLimit; worst = queued.Worst() {
+		if worst.subPool&IsLocal != 0 {
+			locals = append(locals, queued.PopWorst())
+			continue
+		}
+		discard(queued.PopWorst(), PoolOverflow)
+	}
+	for _, mt := range locals {
+		queued.Add(mt)
 	}
 }
 
 type PendingPool struct {
-	t     SubPoolType
-	best  bestSlice
-	worst *WorstQueue
+	t        SubPoolType
+	best     bestSlice
+	worst    *WorstQueue
+	promoted func(*metaTx) // optional, called when transaction moves to pending from other sub-pool
 }
 
 func NewPendingSubPool(t SubPoolType) *PendingPool {
@@ -1336,6 +2167,12 @@ func (p *PendingPool) UnsafeRemove(i *metaTx) {
 	p.best.Swap(i.bestIndex, p.best.Len()-1)
 	p.best = p.best.UnsafeRemove(i)
 }
+func (p *PendingPool) promote(i *metaTx) {
+	p.UnsafeAdd(i)
+	if p.promoted != nil {
+		p.promoted(i)
+	}
+}
 func (p *PendingPool) UnsafeAdd(i *metaTx) {
 	i.currentSubPool = p.t
 	p.worst.Push(i)
@@ -1507,10 +2344,10 @@ func MainLoop(ctx context.Context, db kv.RwDB, coreDB kv.RoDB, p *TxPool, newTxs
 			return p.fromDB(ctx, tx, coreTx)
 		})
 	}); err != nil {
-		log.Error("restore from db", "err", err)
+		p.logger.Error("restore from db", "err", err)
 	}
 	if err := db.View(ctx, func(tx kv.Tx) error { return p.logStats(tx) }); err != nil {
-		log.Error("log stats", "err", err)
+		p.logger.Error("log stats", "err", err)
 	}
 	//if ASSERT {
 	//	go func() {
@@ -1520,14 +2357,29 @@ func MainLoop(ctx context.Context, db kv.RwDB, coreDB kv.RoDB, p *TxPool, newTxs
 	//	}()
 	//}
 
-	syncToNewPeersEvery := time.NewTicker(p.cfg.syncToNewPeersEvery)
+	syncToNewPeersEvery := p.clock.NewTicker(p.cfg.syncToNewPeersEvery)
 	defer syncToNewPeersEvery.Stop()
-	processRemoteTxsEvery := time.NewTicker(p.cfg.processRemoteTxsEvery)
+	processRemoteTxsEvery := p.clock.NewTicker(p.cfg.processRemoteTxsEvery)
 	defer processRemoteTxsEvery.Stop()
-	commitEvery := time.NewTicker(p.cfg.commitEvery)
-	defer commitEvery.Stop()
-	logEvery := time.NewTicker(p.cfg.logEvery)
-	defer logEvery.Stop()
+	jobs := background.New(logging.ToLog(p.logger))
+	jobs.SetClock(p.clock)
+	if err := p.addBackgroundJobs(jobs, db); err != nil {
+		p.logger.Error("background jobs", "err", err)
+		return
+	}
+	if err := jobs.Start(ctx); err != nil {
+		p.logger.Error("background jobs", "err", err)
+		return
+	}
+	defer func() {
+		stopCtx, cancel := context.WithTimeout(context.Background(), time.Minute)
+		defer cancel()
+		if err := jobs.Stop(stopCtx); err != nil {
+			p.logger.Error("stop background jobs", "err", err)
+		}
+	}()
+	rebroadcastLocalsEvery := p.clock.NewTicker(p.cfg.rebroadcastLocalsEvery)
+	defer rebroadcastLocalsEvery.Stop()
 
 	localTxHashes := make([]byte, 0, 128)
 	remoteTxHashes := make([]byte, 0, 128)
@@ -1536,11 +2388,7 @@ func MainLoop(ctx context.Context, db kv.RwDB, coreDB kv.RoDB, p *TxPool, newTxs
 		select {
 		case <-ctx.Done():
 			return
-		case <-logEvery.C:
-			if err := db.View(ctx, func(tx kv.Tx) error { return p.logStats(tx) }); err != nil {
-				log.Error("log stats", "err", err)
-			}
-		case <-processRemoteTxsEvery.C:
+		case <-processRemoteTxsEvery.C():
 			if err := p.processRemoteTxs(ctx); err != nil {
 				if s, ok := status.FromError(err); ok && retryLater(s.Code()) {
 					continue
@@ -1548,19 +2396,7 @@ func MainLoop(ctx context.Context, db kv.RwDB, coreDB kv.RoDB, p *TxPool, newTxs
 				if errors.Is(err, io.EOF) || errors.Is(err, context.Canceled) {
 					continue
 				}
-				log.Error("process batch remote txs", "err", err)
-			}
-		case <-commitEvery.C:
-			if db != nil {
-				t := time.Now()
-				evicted, written, err := p.flush(db)
-				if err != nil {
-					log.Error("flush is local history", "err", err)
-					continue
-				}
-				writeToDbBytesCounter.Set(written)
-				sendersEvictedCounter.Set(evicted)
-				log.Info("flush", "written_kb", written/1024, "evicted", evicted, "in", time.Since(t))
+				p.logger.Error("process batch remote txs", "err", err)
 			}
 		case h := <-newTxs: //TODO: maybe send TxSlots object instead of Hashes?
 			// first broadcast all local txs to all peers, then non-local to random sqrt(peersAmount) peers
@@ -1568,20 +2404,21 @@ func MainLoop(ctx context.Context, db kv.RwDB, coreDB kv.RoDB, p *TxPool, newTxs
 			remoteTxHashes = remoteTxHashes[:0]
 
 			for i := 0; i < h.Len(); i++ {
-				if p.IsLocal(h.At(i)) {
+				if p.IsLocal(h.Hash(i)) {
 					localTxHashes = append(localTxHashes, h.At(i)...)
 				} else {
-					remoteTxHashes = append(localTxHashes, h.At(i)...)
+					remoteTxHashes = append(remoteTxHashes, h.At(i)...)
 				}
 			}
 
 			send.BroadcastLocalPooledTxs(localTxHashes)
 			send.BroadcastRemotePooledTxs(remoteTxHashes)
+			p.observePropagation(h)
 
 			if err := db.View(ctx, func(tx kv.Tx) error {
 				slotsRlp := make([][]byte, 0, h.Len())
 				for i := 0; i < h.Len(); i++ {
-					slotRlp, err := p.GetRlp(tx, h.At(i))
+					slotRlp, err := p.GetRlp(tx, h.Hash(i))
 					if err != nil {
 						return err
 					}
@@ -1590,9 +2427,14 @@ func MainLoop(ctx context.Context, db kv.RwDB, coreDB kv.RoDB, p *TxPool, newTxs
 				newTxSlotsStreams.Broadcast(&proto_txpool.OnAddReply{RplTxs: slotsRlp})
 				return nil
 			}); err != nil {
-				log.Error("send new slots by grpc", "err", err)
+				p.logger.Error("send new slots by grpc", "err", err)
+			}
+		case <-rebroadcastLocalsEvery.C():
+			localTxHashes = p.appendPendingLocalHashes(localTxHashes[:0])
+			if len(localTxHashes) > 0 {
+				send.BroadcastLocalPooledTxs(localTxHashes)
 			}
-		case <-syncToNewPeersEvery.C: // new peer
+		case <-syncToNewPeersEvery.C(): // new peer
 			newPeers := p.recentlyConnectedPeers.GetAndClean()
 			if len(newPeers) == 0 {
 				continue
@@ -1603,6 +2445,37 @@ func MainLoop(ctx context.Context, db kv.RwDB, coreDB kv.RoDB, p *TxPool, newTxs
 	}
 }
 
+// addBackgroundJobs - periodic jobs of MainLoop, which don't need its goroutine: they take p.lock by themselves.
+// Flush is also done once on stop of MainLoop - to not lose last transactions. Pool without db only evicts stale queued transactions
+func (p *TxPool) addBackgroundJobs(jobs *background.Scheduler, db kv.RwDB) error {
+	if db == nil {
+		return jobs.Add(background.Job{Name: "pool_evict_queued", Every: p.cfg.commitEvery, Jitter: 0.1, Run: func(ctx context.Context) error {
+			p.evictStaleQueued(p.clock.Now())
+			return nil
+		}})
+	}
+	if err := jobs.Add(background.Job{Name: "pool_log_stats", Every: p.cfg.logEvery, Jitter: 0.1, Run: func(ctx context.Context) error {
+		return db.View(ctx, func(tx kv.Tx) error { return p.logStats(tx) })
+	}}); err != nil {
+		return err
+	}
+	flush := func(context.Context) error {
+		t := time.Now()
+		evicted, written, err := p.flush(db)
+		if err != nil {
+			return fmt.Errorf("flush is local history: %w", err)
+		}
+		writeToDbBytesCounter.Set(written)
+		sendersEvictedCounter.Set(evicted)
+		p.logger.Info("flush", "written_kb", written/1024, "evicted", evicted, "in", time.Since(t))
+		return nil
+	}
+	return jobs.Add(background.Job{Name: "pool_flush", Every: p.cfg.commitEvery, Jitter: 0.1, Final: flush, Run: func(ctx context.Context) error {
+		p.evictStaleQueued(p.clock.Now())
+		return flush(ctx)
+	}})
+}
+
 //nolint
 func coreProgress(coreTx kv.Tx) (uint64, error) {
 	stageProgress, err := coreTx.GetOne(kv.SyncStageProgress, []byte("Finish"))
@@ -1661,6 +2534,8 @@ func (p *TxPool) flush(db kv.RwDB) (evicted, written uint64, err error) {
 	p.lock.Lock()
 	defer p.lock.Unlock()
 	//it's important that write db tx is done inside lock, to make last writes visible for all read operations
+	start := time.Now()
+	var write time.Duration
 	if err := db.Update(context.Background(), func(tx kv.RwTx) error {
 		evicted, err = p.flushLocked(tx)
 		if err != nil {
@@ -1670,13 +2545,18 @@ func (p *TxPool) flush(db kv.RwDB) (evicted, written uint64, err error) {
 		if err != nil {
 			return err
 		}
+		write = time.Since(start)
 		return nil
 	}); err != nil {
 		return 0, 0, err
 	}
+	p.observeFlush(write, time.Since(start)-write)
 	return evicted, written, nil
 }
 func (p *TxPool) flushLocked(tx kv.RwTx) (evicted uint64, err error) {
+	if p.dbFormat != nil {
+		return 0, fmt.Errorf("not flushed: %w", p.dbFormat)
+	}
 	sendersWithoutTransactions := roaring64.New()
 	for i := 0; i < len(p.deletedTxs); i++ {
 		if p.txNonce2Tx.count(p.deletedTxs[i].Tx.senderID) == 0 {
@@ -1688,14 +2568,34 @@ func (p *TxPool) flushLocked(tx kv.RwTx) (evicted uint64, err error) {
 		p.deletedTxs[i] = nil // for gc
 	}
 
+	// local transactions which are still in pool are stored too - to not lose their IsLocal flag on restart
 	txHashes := p.localsHistory.Keys()
+	for txHash, mt := range p.byHash {
+		if mt.subPool&IsLocal != 0 {
+			txHashes = append(txHashes, txHash)
+		}
+	}
 	encID := make([]byte, 8)
 	if err := tx.ClearBucket(kv.RecentLocalTransaction); err != nil {
 		return evicted, err
 	}
 	for i := range txHashes {
 		binary.BigEndian.PutUint64(encID, uint64(i))
-		if err := tx.Append(kv.RecentLocalTransaction, encID, txHashes[i].([]byte)); err != nil {
+		if err := tx.Append(kv.RecentLocalTransaction, encID, []byte(txHashes[i].(string))); err != nil {
+			return evicted, err
+		}
+	}
+
+	privateHashes := p.privateHistory.Keys()
+	for txHash := range p.private {
+		privateHashes = append(privateHashes, txHash)
+	}
+	if err := tx.ClearBucket(kv.PoolPrivateTransaction); err != nil {
+		return evicted, err
+	}
+	for i := range privateHashes {
+		binary.BigEndian.PutUint64(encID, uint64(i))
+		if err := tx.Append(kv.PoolPrivateTransaction, encID, []byte(privateHashes[i].(string))); err != nil {
 			return evicted, err
 		}
 	}
@@ -1722,6 +2622,10 @@ func (p *TxPool) flushLocked(tx kv.RwTx) (evicted uint64, err error) {
 	if err := tx.Put(kv.PoolInfo, PoolPendingBaseFeeKey, encID); err != nil {
 		return evicted, err
 	}
+	binary.BigEndian.PutUint64(encID, p.currentBlobFee.Load())
+	if err := tx.Put(kv.PoolInfo, PoolPendingBlobFeeKey, encID); err != nil {
+		return evicted, err
+	}
 
 	evicted, err = p.senders.flush(tx, p.txNonce2Tx, sendersWithoutTransactions, p.cfg.evictSendersAfterRounds)
 	if err != nil {
@@ -1732,7 +2636,6 @@ func (p *TxPool) flushLocked(tx kv.RwTx) (evicted uint64, err error) {
 	// DB will stay consitant but some in-memory structures may be alread cleaned, and retry will not work
 	// failed write transaction must not create side-effects
 	p.deletedTxs = p.deletedTxs[:0]
-	p.discardReasons = p.discardReasons[:0]
 	return evicted, nil
 }
 
@@ -1870,7 +2773,7 @@ func (sc *sendersBatch) flush(tx kv.RwTx, byNonce *ByNonce, sendersWithoutTransa
 	if err := tx.Put(kv.PoolInfo, SenderCommitIDKey, encID); err != nil {
 		return evicted, err
 	}
-	lastCommitTime, err := time.Now().MarshalBinary()
+	lastCommitTime, err := sc.clock.Now().MarshalBinary()
 	if err != nil {
 		return evicted, err
 	}
@@ -1887,7 +2790,11 @@ func (p *TxPool) fromDB(ctx context.Context, tx kv.RwTx, coreTx kv.Tx) error {
 	p.lock.Lock()
 	defer p.lock.Unlock()
 
-	if err := p.senders.fromDB(ctx, tx, coreTx); err != nil {
+	if err := migratePoolDB(tx, p.logger, poolMigrations); err != nil {
+		p.dbFormat = err
+		return err
+	}
+	if err := p.senders.fromDB(ctx, p.logger, tx, coreTx); err != nil {
 		return err
 	}
 
@@ -1897,6 +2804,12 @@ func (p *TxPool) fromDB(ctx context.Context, tx kv.RwTx, coreTx kv.Tx) error {
 	}); err != nil {
 		return err
 	}
+	if err := tx.ForEach(kv.PoolPrivateTransaction, nil, func(k, v []byte) error {
+		p.private[string(v)] = struct{}{}
+		return nil
+	}); err != nil {
+		return err
+	}
 
 	txs := TxSlots{}
 	parseCtx := NewTxParseContext()
@@ -1930,7 +2843,7 @@ func (p *TxPool) fromDB(ctx context.Context, tx kv.RwTx, coreTx kv.Tx) error {
 		return err
 	}
 
-	var protocolBaseFee, currentBaseFee uint64
+	var protocolBaseFee, currentBaseFee, currentBlobFee uint64
 	{
 		v, err := tx.GetOne(kv.PoolInfo, PoolProtocolBaseFeeKey)
 		if err != nil {
@@ -1949,6 +2862,15 @@ func (p *TxPool) fromDB(ctx context.Context, tx kv.RwTx, coreTx kv.Tx) error {
 			currentBaseFee = binary.BigEndian.Uint64(v)
 		}
 	}
+	{
+		v, err := tx.GetOne(kv.PoolInfo, PoolPendingBlobFeeKey)
+		if err != nil {
+			return err
+		}
+		if len(v) > 0 {
+			currentBlobFee = binary.BigEndian.Uint64(v)
+		}
+	}
 	cacheMisses, err := p.senders.onNewTxs(tx, txs)
 	if err != nil {
 		return err
@@ -1958,16 +2880,25 @@ func (p *TxPool) fromDB(ctx context.Context, tx kv.RwTx, coreTx kv.Tx) error {
 			return err
 		}
 	}
-	if err := onNewTxs(tx, p.senders, txs, protocolBaseFee, currentBaseFee, p.pending, p.baseFee, p.queued, p.txNonce2Tx, p.byHash, p.discardLocked); err != nil {
+	if err := onNewTxs(tx, p.senders, txs, protocolBaseFee, currentBaseFee, currentBlobFee, p.pending, p.baseFee, p.queued, p.txNonce2Tx, p.byHash, p.clock.Now(), p.discardLocked); err != nil {
 		return err
 	}
 	p.currentBaseFee.Store(currentBaseFee)
 	p.protocolBaseFee.Store(protocolBaseFee)
+	p.currentBlobFee.Store(currentBlobFee)
+	p.tips.refresh(p.pending, currentBaseFee)
+	p.updateSizeMetrics()
+	for hash := range p.private { // private transactions which are not in pool anymore - were mined
+		if _, ok := p.byHash[hash]; !ok {
+			delete(p.private, hash)
+			p.privateHistory.Add(hash, struct{}{})
+		}
+	}
 
 	return nil
 }
 
-func (sc *sendersBatch) fromDB(ctx context.Context, tx kv.RwTx, coreTx kv.Tx) error {
+func (sc *sendersBatch) fromDB(ctx context.Context, logger logging.Logger, tx kv.RwTx, coreTx kv.Tx) error {
 	{
 		v, err := tx.GetOne(kv.PoolInfo, SenderCacheHeightKey)
 		if err != nil {
@@ -2005,7 +2936,7 @@ func (sc *sendersBatch) fromDB(ctx context.Context, tx kv.RwTx, coreTx kv.Tx) er
 		}
 	}
 
-	if err := sc.syncMissedStateDiff(ctx, tx, coreTx, 0); err != nil {
+	if err := sc.syncMissedStateDiff(ctx, logger, tx, coreTx, 0); err != nil {
 		return err
 	}
 	return nil
@@ -2022,7 +2953,7 @@ func isCanonical(coreTx kv.Tx, num uint64, hash []byte) (bool, error) {
 	return bytes.Equal(hash, canonical), nil
 }
 
-func changesets(ctx context.Context, from uint64, coreTx kv.Tx) (map[string]senderInfo, error) {
+func changesets(ctx context.Context, logger logging.Logger, from uint64, coreTx kv.Tx) (map[string]senderInfo, error) {
 	encNum := make([]byte, 8)
 	diff := map[string]senderInfo{}
 	binary.BigEndian.PutUint64(encNum, from)
@@ -2030,14 +2961,14 @@ func changesets(ctx context.Context, from uint64, coreTx kv.Tx) (map[string]send
 	defer logEvery.Stop()
 	//TODO: tx.ForEach must be implemented as buffered server-side stream
 	if err := coreTx.ForEach(kv.AccountChangeSet, encNum, func(k, v []byte) error {
-		info, err := loadSender(coreTx, v[:20])
+		info, err := loadSender(coreTx, common.BytesToAddress(v[:20]))
 		if err != nil {
 			return err
 		}
 		diff[string(v[:20])] = *info
 		select {
 		case <-logEvery.C:
-			log.Info("loading changesets", "block", binary.BigEndian.Uint64(k))
+			logger.Info("loading changesets", "block", binary.BigEndian.Uint64(k))
 		case <-ctx.Done():
 			return nil
 		default:
@@ -2056,9 +2987,10 @@ var SenderCacheHeightKey = []byte("sender_cache_block_height")
 var SenderCacheHashKey = []byte("sender_cache_block_hash")
 var PoolPendingBaseFeeKey = []byte("pending_base_fee")
 var PoolProtocolBaseFeeKey = []byte("protocol_base_fee")
+var PoolPendingBlobFeeKey = []byte("pending_blob_fee")
 
-func loadSender(coreTx kv.Tx, addr []byte) (*senderInfo, error) {
-	encoded, err := coreTx.GetOne(kv.PlainState, addr)
+func loadSender(coreTx kv.Tx, addr common.Address) (*senderInfo, error) {
+	encoded, err := coreTx.GetOne(kv.PlainState, addr[:])
 	if err != nil {
 		return nil, err
 	}
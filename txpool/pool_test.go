@@ -17,21 +17,39 @@
 package txpool
 
 import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
 	"fmt"
+	"math/big"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/RoaringBitmap/roaring/roaring64"
 	"github.com/google/btree"
 	"github.com/holiman/uint256"
+	"github.com/ledgerwatch/erigon-lib/chain"
+	"github.com/ledgerwatch/erigon-lib/common"
+	"github.com/ledgerwatch/erigon-lib/common/background"
+	"github.com/ledgerwatch/erigon-lib/common/clock"
+	"github.com/ledgerwatch/erigon-lib/common/logging"
+	"github.com/ledgerwatch/erigon-lib/direct"
+	"github.com/ledgerwatch/erigon-lib/gointerfaces"
+	"github.com/ledgerwatch/erigon-lib/gointerfaces/sentry"
+	txpool_proto "github.com/ledgerwatch/erigon-lib/gointerfaces/txpool"
+	"github.com/ledgerwatch/erigon-lib/gointerfaces/types"
+	"github.com/ledgerwatch/erigon-lib/kv"
 	"github.com/ledgerwatch/erigon-lib/kv/memdb"
 	"github.com/stretchr/testify/require"
 )
 
 func TestSenders(t *testing.T) {
 	t.Run("evict_all_on_next_round", func(t *testing.T) {
-		senders, require := newSendersCache(), require.New(t)
+		senders, require := newSendersCache(clock.Real), require.New(t)
 		_, tx := memdb.NewTestPoolTx(t)
-		byNonce := &ByNonce{btree.New(16)}
+		byNonce := &ByNonce{tree: btree.New(16)}
 		changed := roaring64.New()
 
 		senders.senderIDs[fmt.Sprintf("%020x", 1)] = 1
@@ -51,9 +69,9 @@ func TestSenders(t *testing.T) {
 		require.Equal(2, int(evicted))
 	})
 	t.Run("evict_even_if_used_in_current_round_but_no_txs", func(t *testing.T) {
-		senders, require := newSendersCache(), require.New(t)
+		senders, require := newSendersCache(clock.Real), require.New(t)
 		_, tx := memdb.NewTestPoolTx(t)
-		byNonce := &ByNonce{btree.New(16)}
+		byNonce := &ByNonce{tree: btree.New(16)}
 
 		senders.senderInfo[1] = newSenderInfo(1, *uint256.NewInt(1))
 		senders.senderIDs[fmt.Sprintf("%020x", 1)] = 1
@@ -76,3 +94,1030 @@ func TestSenders(t *testing.T) {
 	})
 
 }
+
+func TestBlobTxs(t *testing.T) {
+	require, ctx := require.New(t), context.Background()
+	db, coreDB := memdb.NewTestPoolDB(t), memdb.NewTestDB(t)
+	cfg := DefaultConfig
+	cfg.BlobSlots = 12
+	pool, err := New(make(chan Hashes, 100), db, coreDB, cfg)
+	require.NoError(err)
+
+	newTx := func(i byte, blobs int, feeCap, blobFeeCap uint64, withSidecar bool) *TxSlot {
+		txn := &TxSlot{nonce: 1, tip: 1, feeCap: feeCap, gas: 21000, blobFeeCap: blobFeeCap, withSidecar: withSidecar}
+		txn.idHash[0] = i
+		for j := 0; j < blobs; j++ {
+			h := [32]byte{blobHashVersion, i, byte(j)}
+			txn.blobHashes = append(txn.blobHashes, h[:]...)
+		}
+		return txn
+	}
+	stateChanges := map[string]senderInfo{}
+	txs := TxSlots{}
+	for i, txn := range []*TxSlot{
+		newTx(1, 4, 100, 10, true),  // best
+		newTx(2, 4, 50, 10, true),   // doesn't fit into block with 1st
+		newTx(3, 0, 20, 0, false),   // not blob tx
+		newTx(4, 1, 100, 10, false), // without sidecar
+		newTx(5, 1, 100, 1, true),   // blob fee cap is too low
+		newTx(6, 4, 100, 10, true),  // no blob slots left in pool
+	} {
+		sender := make([]byte, 20)
+		sender[0] = byte(i + 1)
+		stateChanges[string(sender)] = *newSenderInfo(0, *uint256.NewInt(1 << 62))
+		txs.Append(txn, sender, false)
+	}
+	require.NoError(pool.OnNewBlock(stateChanges, TxSlots{}, TxSlots{}, 10, 5, 1, [32]byte{}))
+
+	tx, err := db.BeginRo(ctx)
+	require.NoError(err)
+	defer tx.Rollback()
+	reasons, err := pool.AddLocals(ctx, txs, tx)
+	require.NoError(err)
+	require.Equal([]DiscardReason{Success, Success, Success, BlobsRejected, Success, BlobsRejected}, reasons)
+
+	has := func(i byte) bool { _, ok := pool.byHash[string([]byte{i})+string(make([]byte, 31))]; return ok }
+	require.True(has(1) && has(2) && has(3) && has(5))
+	require.False(has(4) || has(6))
+	require.Equal(uint64(4+4+1), pool.txNonce2Tx.blobs)
+
+	best := &TxSlots{}
+	require.NoError(pool.Best(10, best, tx))
+	require.Equal(2, len(best.txs))
+	require.Equal(byte(1), best.txs[0].idHash[0])
+	require.Equal(byte(3), best.txs[1].idHash[0])
+
+	// mined blob transaction frees its blobs
+	mined := TxSlots{}
+	mined.Append(txs.txs[0], txs.senders.At(0), false)
+	require.NoError(pool.OnNewBlock(map[string]senderInfo{string(txs.senders.At(0)): *newSenderInfo(2, *uint256.NewInt(1 << 62))}, TxSlots{}, mined, 10, 5, 2, [32]byte{}))
+	require.Equal(uint64(4+1), pool.txNonce2Tx.blobs)
+
+	// sidecar is part of transaction in pool
+	sidecarTx, sender := &TxSlot{}, make([]byte, 20)
+	_, err = NewTxParseContext().ParseTransaction(blobTx(t, 1, 2, true), 0, sidecarTx, sender)
+	require.NoError(err)
+	require.Equal(uint64(2*BlobSize/txSlotSize+1), sidecarTx.slots())
+}
+
+func TestLocalsSurviveRestart(t *testing.T) {
+	require, ctx := require.New(t), context.Background()
+	db, coreDB := memdb.NewTestPoolDB(t), memdb.NewTestDB(t)
+	pool, err := New(make(chan Hashes, 100), db, coreDB, DefaultConfig)
+	require.NoError(err)
+
+	sender := testKeyAddr()
+	stateChanges := map[string]senderInfo{string(sender): *newSenderInfo(0, *uint256.NewInt(1 << 62))}
+	require.NoError(pool.OnNewBlock(stateChanges, TxSlots{}, TxSlots{}, 10, 5, 1, [32]byte{}))
+
+	txs := TxSlots{}
+	for nonce := uint64(1); nonce <= 2; nonce++ {
+		txn, senderOfTx := &TxSlot{}, make([]byte, 20)
+		_, err = NewTxParseContext().ParseTransaction(blobTx(t, nonce, 1, true), 0, txn, senderOfTx)
+		require.NoError(err)
+		txs.Append(txn, senderOfTx, false)
+	}
+	tx, err := db.BeginRo(ctx)
+	require.NoError(err)
+	_, err = pool.AddLocals(ctx, txs, tx)
+	tx.Rollback()
+	require.NoError(err)
+	require.Equal(2*32, len(pool.appendPendingLocalHashes(nil)))
+	_, _, err = pool.flush(db)
+	require.NoError(err)
+
+	restarted, err := New(make(chan Hashes, 100), db, coreDB, DefaultConfig)
+	require.NoError(err)
+	require.NoError(db.Update(ctx, func(tx kv.RwTx) error {
+		return coreDB.View(ctx, func(coreTx kv.Tx) error { return restarted.fromDB(ctx, tx, coreTx) })
+	}))
+	for i := range txs.txs {
+		require.True(restarted.IsLocal(txs.txs[i].idHash))
+		mt, ok := restarted.byHash[string(txs.txs[i].idHash[:])]
+		require.True(ok)
+		require.NotZero(mt.subPool & IsLocal)
+	}
+}
+
+func TestReplacementPriceBump(t *testing.T) {
+	require, ctx := require.New(t), context.Background()
+	db, coreDB := memdb.NewTestPoolDB(t), memdb.NewTestDB(t)
+	sender, overridden := make([]byte, 20), make([]byte, 20)
+	sender[0], overridden[0] = 1, 2
+	cfg := DefaultConfig
+	cfg.LocalPriceBumps = map[string]PriceBump{string(overridden): {}}
+	pool, err := New(make(chan Hashes, 100), db, coreDB, cfg)
+	require.NoError(err)
+	stateChanges := map[string]senderInfo{
+		string(sender):     *newSenderInfo(0, *uint256.NewInt(1 << 62)),
+		string(overridden): *newSenderInfo(0, *uint256.NewInt(1 << 62)),
+	}
+	require.NoError(pool.OnNewBlock(stateChanges, TxSlots{}, TxSlots{}, 10, 0, 1, [32]byte{}))
+	tx, err := db.BeginRo(ctx)
+	require.NoError(err)
+	defer tx.Rollback()
+
+	var id byte
+	add := func(sender []byte, tip, feeCap uint64) DiscardReason {
+		id++
+		txn := &TxSlot{nonce: 1, tip: tip, feeCap: feeCap, gas: 21000}
+		txn.idHash[0] = id
+		reasons, err := pool.AddLocals(ctx, TxSlots{txs: []*TxSlot{txn}, senders: sender, isLocal: []bool{true}}, tx)
+		require.NoError(err)
+		return reasons[0]
+	}
+	require.Equal(Success, add(sender, 100, 100))
+	require.Equal(ReplaceUnderpriced, add(sender, 109, 200))
+	require.Equal(ReplaceUnderpriced, add(sender, 200, 109))
+	require.Equal(Success, add(sender, 110, 110))
+
+	require.Equal(Success, add(overridden, 100, 100))
+	require.Equal(ReplaceUnderpriced, add(overridden, 100, 100)) // tip must grow anyway
+	require.Equal(Success, add(overridden, 101, 100))
+
+	// already known
+	reasons, err := pool.AddLocals(ctx, TxSlots{txs: []*TxSlot{{nonce: 1, tip: 200, feeCap: 200, gas: 21000, idHash: [32]byte{id}}}, senders: overridden, isLocal: []bool{true}}, tx)
+	require.NoError(err)
+	require.Equal(AlreadyKnown, reasons[0])
+
+	// passes validation, but dropped by promote
+	reasons, err = pool.AddLocals(ctx, TxSlots{txs: []*TxSlot{{nonce: 2, tip: 1, feeCap: 1, gas: 21000, idHash: [32]byte{100}}}, senders: sender, isLocal: []bool{true}}, tx)
+	require.NoError(err)
+	require.Equal(FeeTooLow, reasons[0])
+	require.Equal("replacement transaction underpriced", ReplaceUnderpriced.String())
+}
+
+func TestContent(t *testing.T) {
+	require, ctx := require.New(t), context.Background()
+	db, coreDB := memdb.NewTestPoolDB(t), memdb.NewTestDB(t)
+	pool, err := New(make(chan Hashes, 100), db, coreDB, DefaultConfig)
+	require.NoError(err)
+	var sender [20]byte
+	copy(sender[:], testKeyAddr())
+	stateChanges := map[string]senderInfo{string(sender[:]): *newSenderInfo(0, *uint256.NewInt(1 << 62))}
+	require.NoError(pool.OnNewBlock(stateChanges, TxSlots{}, TxSlots{}, 10, 5, 1, [32]byte{}))
+
+	txs := TxSlots{}
+	for _, nonce := range []uint64{1, 3} { // nonce gap
+		txn, senderOfTx := &TxSlot{}, make([]byte, 20)
+		_, err = NewTxParseContext().ParseTransaction(blobTx(t, nonce, 1, true), 0, txn, senderOfTx)
+		require.NoError(err)
+		txs.Append(txn, senderOfTx, false)
+	}
+	require.NoError(db.View(ctx, func(tx kv.Tx) error {
+		_, err := pool.AddLocals(ctx, txs, tx)
+		return err
+	}))
+	_, _, err = pool.flush(db) // rlp must be read from db
+	require.NoError(err)
+
+	tx, err := db.BeginRo(ctx)
+	require.NoError(err)
+	defer tx.Rollback()
+	content, err := pool.Content(tx, true)
+	require.NoError(err)
+	require.Equal(1, len(content))
+	require.Equal(common.Address(sender), content[0].Sender)
+	require.Equal(1, len(content[0].Pending))
+	require.Equal(1, len(content[0].Queued))
+	require.Equal(uint64(1), content[0].Pending[0].Nonce)
+	require.Equal(common.Hash(txs.txs[0].idHash), content[0].Pending[0].IdHash)
+	require.Equal(blobTx(t, 1, 1, true), content[0].Pending[0].Rlp)
+	require.Equal(uint64(3), content[0].Queued[0].Nonce)
+
+	s := NewGrpcServer(ctx, pool, db)
+	reply, err := s.Inspect(ctx, &txpool_proto.InspectRequest{})
+	require.NoError(err)
+	require.Equal(1, len(reply.Senders))
+	require.Equal(sender, gointerfaces.ConvertH160toAddress(reply.Senders[0].Address))
+	require.Equal(txs.txs[1].idHash, gointerfaces.ConvertH256ToHash(reply.Senders[0].Queued[0].Hash))
+	require.Equal(uint64(100), reply.Senders[0].Pending[0].FeeCap)
+	contentReply, err := s.Content(ctx, &txpool_proto.ContentRequest{})
+	require.NoError(err)
+	require.Equal(blobTx(t, 3, 1, true), contentReply.Senders[0].Queued[0].RlpTx)
+
+	unknown := [32]byte{9}
+	unknownReply, err := s.FindUnknown(ctx, &txpool_proto.TxHashes{Hashes: gointerfaces.ConvertHashesToH256s(append(txs.txs[0].idHash[:], unknown[:]...))})
+	require.NoError(err)
+	require.Equal(1, len(unknownReply.Hashes))
+	require.Equal(unknown, gointerfaces.ConvertH256ToHash(unknownReply.Hashes[0]))
+}
+
+func TestNonceFromPool(t *testing.T) {
+	require, ctx := require.New(t), context.Background()
+	db, coreDB := memdb.NewTestPoolDB(t), memdb.NewTestDB(t)
+	pool, err := New(make(chan Hashes, 100), db, coreDB, DefaultConfig)
+	require.NoError(err)
+	sender, unknown := [20]byte{1}, [20]byte{2}
+	stateChanges := map[string]senderInfo{string(sender[:]): *newSenderInfo(0, *uint256.NewInt(1 << 62))}
+	require.NoError(pool.OnNewBlock(stateChanges, TxSlots{}, TxSlots{}, 10, 0, 1, [32]byte{}))
+
+	txs := TxSlots{}
+	for _, nonce := range []uint64{1, 2, 4} {
+		txn := &TxSlot{nonce: nonce, tip: 1, feeCap: 8, gas: 21000, idHash: [32]byte{byte(nonce)}}
+		txn.value.SetUint64(nonce)
+		txs.Append(txn, sender[:], true)
+	}
+	require.NoError(db.View(ctx, func(tx kv.Tx) error {
+		_, err := pool.AddLocals(ctx, txs, tx)
+		return err
+	}))
+	_, _, err = pool.flush(db) // senders must be read from db
+	require.NoError(err)
+
+	tx, err := db.BeginRo(ctx)
+	require.NoError(err)
+	defer tx.Rollback()
+	nonce, inPool, err := pool.NonceFromPool(tx, sender)
+	require.NoError(err)
+	require.True(inPool)
+	require.Equal(uint64(3), nonce)
+	_, inPool, err = pool.NonceFromPool(tx, unknown)
+	require.NoError(err)
+	require.False(inPool)
+
+	stats, err := pool.SenderStats(tx, sender)
+	require.NoError(err)
+	require.Equal(SenderStats{BaseFee: 2, Queued: 1, Cost: *uint256.NewInt(3*21000*8 + 1 + 2 + 4)}, stats)
+	stats, err = pool.SenderStats(tx, unknown)
+	require.NoError(err)
+	require.Equal(SenderStats{}, stats)
+}
+
+func TestSlotLimits(t *testing.T) {
+	require, ctx := require.New(t), context.Background()
+	db, coreDB := memdb.NewTestPoolDB(t), memdb.NewTestDB(t)
+	cfg := DefaultConfig
+	cfg.AccountSlots, cfg.GlobalSlots, cfg.QueuedLifetime = 2, 4, time.Hour
+	pool, err := New(make(chan Hashes, 100), db, coreDB, cfg)
+	require.NoError(err)
+	a, b, c, d, e := [20]byte{1}, [20]byte{2}, [20]byte{3}, [20]byte{4}, [20]byte{5}
+	stateChanges := map[string]senderInfo{}
+	for _, addr := range [][20]byte{a, b, c, d, e} {
+		stateChanges[string(addr[:])] = *newSenderInfo(0, *uint256.NewInt(1 << 62))
+	}
+	require.NoError(pool.OnNewBlock(stateChanges, TxSlots{}, TxSlots{}, 10, 0, 1, [32]byte{}))
+
+	var id byte
+	newTx := func(nonce, feeCap uint64, size uint32) *TxSlot {
+		id++
+		return &TxSlot{nonce: nonce, tip: 1, feeCap: feeCap, gas: 21000, size: size, idHash: [32]byte{id}}
+	}
+	has := func(id byte) bool { _, ok := pool.byHash[string([]byte{id})+string(make([]byte, 31))]; return ok }
+	addRemote := func(sender [20]byte, txs ...*TxSlot) {
+		slots := TxSlots{}
+		for _, txn := range txs {
+			slots.Append(txn, sender[:], false)
+		}
+		pool.AddRemoteTxs(ctx, slots)
+		require.NoError(pool.processRemoteTxs(ctx))
+	}
+
+	addRemote(a, newTx(1, 15, 100), newTx(2, 15, 100), newTx(3, 15, 100)) // 1,2,3
+	require.True(has(1) && has(2))
+	require.False(has(3))              // no free slots of sender
+	addRemote(b, newTx(1, 30, 40_000)) // 4 - takes 2 slots
+	require.True(has(4))
+	addRemote(c, newTx(1, 20, 100)) // 5 - evicts worst: 1 and next nonce 2
+	require.False(has(1) || has(2))
+	require.True(has(4) && has(5))
+	require.Equal(uint64(3), pool.txNonce2Tx.slots) // running total of added and discarded
+	require.Equal(uint64(3), slotsGauge.Get())
+
+	// locals are not limited and not evicted
+	txs := TxSlots{}
+	for nonce := uint64(1); nonce <= 3; nonce++ {
+		txs.Append(newTx(nonce, 11, 100), d[:], true) // 6,7,8
+	}
+	require.NoError(db.View(ctx, func(tx kv.Tx) error {
+		reasons, err := pool.AddLocals(ctx, txs, tx)
+		require.Equal([]DiscardReason{Success, Success, Success}, reasons)
+		return err
+	}))
+	require.True(has(6) && has(7) && has(8))
+	require.False(has(4) || has(5))
+
+	pool.cfg.GlobalSlots = 0
+	addRemote(e, newTx(5, 20, 100)) // 9 - queued: nonce gap
+	require.True(has(9))
+	pool.evictStaleQueued(time.Now())
+	require.True(has(9))
+	pool.evictStaleQueued(time.Now().Add(2 * time.Hour))
+	require.False(has(9))
+	require.Equal(uint64(3), pool.txNonce2Tx.slots)
+}
+
+func TestEvents(t *testing.T) {
+	require, ctx := require.New(t), context.Background()
+	db, coreDB := memdb.NewTestPoolDB(t), memdb.NewTestDB(t)
+	pool, err := New(make(chan Hashes, 100), db, coreDB, DefaultConfig)
+	require.NoError(err)
+	sender := [20]byte{1}
+	stateChanges := map[string]senderInfo{string(sender[:]): *newSenderInfo(0, *uint256.NewInt(1 << 62))}
+	require.NoError(pool.OnNewBlock(stateChanges, TxSlots{}, TxSlots{}, 10, 0, 1, [32]byte{}))
+
+	events := make(chan Event, 100)
+	unsubscribe := pool.SubscribeEvents(events)
+	defer unsubscribe()
+	var seq uint64
+	expect := func(expected ...Event) {
+		for _, ev := range expected {
+			select {
+			case got := <-events:
+				seq++
+				ev.Seq = seq
+				require.Equal(ev, got)
+			default:
+				require.Fail("no event", "expected: %v", ev)
+			}
+		}
+		require.Zero(len(events))
+	}
+	slots := func(txs ...*TxSlot) TxSlots {
+		res := TxSlots{}
+		for _, txn := range txs {
+			res.Append(txn, sender[:], true)
+		}
+		return res
+	}
+	add := func(txs ...*TxSlot) {
+		require.NoError(db.View(ctx, func(tx kv.Tx) error {
+			_, err := pool.AddLocals(ctx, slots(txs...), tx)
+			return err
+		}))
+	}
+
+	tx1 := &TxSlot{nonce: 2, tip: 1, feeCap: 20, gas: 21000, idHash: [32]byte{1}}
+	add(tx1)
+	expect(Event{Type: EventAdded, IdHash: tx1.idHash}) // queued: nonce gap
+	tx2 := &TxSlot{nonce: 1, tip: 1, feeCap: 20, gas: 21000, idHash: [32]byte{2}}
+	add(tx2)
+	expect(Event{Type: EventPromoted, IdHash: tx1.idHash}, Event{Type: EventAdded, IdHash: tx2.idHash})
+	tx3 := &TxSlot{nonce: 1, tip: 2, feeCap: 30, gas: 21000, idHash: [32]byte{3}}
+	add(tx3)
+	expect(Event{Type: EventReplaced, IdHash: tx2.idHash, Reason: ReplacedByHigherTip}, Event{Type: EventAdded, IdHash: tx3.idHash})
+	add(&TxSlot{nonce: 3, tip: 1, feeCap: 1, gas: 21000, idHash: [32]byte{4}})
+	expect(Event{Type: EventDropped, IdHash: [32]byte{4}, Reason: FeeTooLow})
+
+	minedState := map[string]senderInfo{string(sender[:]): *newSenderInfo(1, *uint256.NewInt(1 << 62))}
+	require.NoError(pool.OnNewBlock(minedState, TxSlots{}, slots(tx3), 10, 0, 2, [32]byte{}))
+	expect(Event{Type: EventMined, IdHash: tx3.idHash, Reason: Mined})
+	require.NoError(pool.OnNewBlock(stateChanges, slots(tx3), TxSlots{}, 10, 0, 1, [32]byte{}))
+	expect(Event{Type: EventReorged, IdHash: tx3.idHash})
+
+	// slow subscriber sees gap in sequence of events
+	slow := make(chan Event, 1)
+	defer pool.SubscribeEvents(slow)()
+	add(&TxSlot{nonce: 3, tip: 1, feeCap: 1, gas: 21000, idHash: [32]byte{5}}, &TxSlot{nonce: 4, tip: 1, feeCap: 1, gas: 21000, idHash: [32]byte{6}})
+	require.Equal(uint64(1), (<-slow).Seq)
+	add(&TxSlot{nonce: 3, tip: 1, feeCap: 1, gas: 21000, idHash: [32]byte{7}})
+	require.Equal(Event{Type: EventDropped, IdHash: [32]byte{7}, Reason: FeeTooLow, Seq: 3}, <-slow)
+	expect(Event{Type: EventDropped, IdHash: [32]byte{5}, Reason: FeeTooLow}, Event{Type: EventDropped, IdHash: [32]byte{6}, Reason: FeeTooLow},
+		Event{Type: EventDropped, IdHash: [32]byte{7}, Reason: FeeTooLow})
+
+	unsubscribe()
+	require.NoError(pool.OnNewBlock(minedState, TxSlots{}, slots(tx3), 10, 0, 2, [32]byte{}))
+	expect()
+}
+
+func TestOnNewChain(t *testing.T) {
+	require := require.New(t)
+	db, coreDB := memdb.NewTestPoolDB(t), memdb.NewTestDB(t)
+	pool, err := New(make(chan Hashes, 100), db, coreDB, DefaultConfig)
+	require.NoError(err)
+	addr1, addr2 := [20]byte{1}, [20]byte{2}
+	balance := *uint256.NewInt(1 << 62)
+	block := func(sender [20]byte, txs ...*TxSlot) TxSlots {
+		res := TxSlots{}
+		for _, txn := range txs {
+			res.Append(txn, sender[:], false)
+		}
+		return res
+	}
+	newTx := func(nonce uint64, id byte) *TxSlot {
+		return &TxSlot{nonce: nonce, tip: 1, feeCap: 20, gas: 21000, idHash: [32]byte{id}}
+	}
+	has := func(id byte) bool {
+		_, ok := pool.byHash[string([]byte{id, 31: 0})]
+		return ok
+	}
+
+	// canonical chain: blocks 1..4, each has 1 transaction of addr1
+	tx1, tx2, tx3, tx4 := newTx(1, 1), newTx(2, 2), newTx(3, 3), newTx(4, 4)
+	for i, txn := range []*TxSlot{tx1, tx2, tx3, tx4} {
+		stateChanges := map[string]senderInfo{string(addr1[:]): *newSenderInfo(txn.nonce, balance)}
+		require.NoError(pool.OnNewBlock(stateChanges, TxSlots{}, block(addr1, txn), 10, 0, uint64(i+1), [32]byte{byte(i + 1)}))
+	}
+	require.Zero(len(pool.byHash))
+
+	events := make(chan Event, 100)
+	defer pool.SubscribeEvents(events)()
+
+	// reorg of depth 3: new chain has tx2, other transaction of addr1 with nonce 3 and transaction of addr2.
+	// tx2 and tx3 must not return to pool, tx4 must.
+	tx3b, tx5 := newTx(3, 5), newTx(1, 6)
+	stateChanges := map[string]senderInfo{
+		string(addr1[:]): *newSenderInfo(3, balance),
+		string(addr2[:]): *newSenderInfo(1, balance),
+	}
+	unwound := []TxSlots{block(addr1, tx4), block(addr1, tx3), block(addr1, tx2)}
+	applied := []TxSlots{block(addr1, tx2), block(addr1, tx3b), block(addr2, tx5)}
+	require.NoError(pool.OnNewChain(stateChanges, unwound, applied, 10, 0, 4, [32]byte{5}))
+	require.False(has(2))
+	require.False(has(3))
+	require.False(has(5))
+	require.False(has(6))
+	require.True(has(4))
+	require.Equal(PendingSubPool, pool.byHash[string(tx4.idHash[:])].currentSubPool)
+	require.Equal(1, len(events))
+	require.Equal(Event{Type: EventReorged, IdHash: tx4.idHash, Seq: 1}, <-events)
+
+	// unwound transaction which became invalid is not returned
+	tx7 := &TxSlot{nonce: 4, tip: 1, feeCap: 1, gas: 21000, idHash: [32]byte{7}}
+	require.NoError(pool.OnNewChain(stateChanges, []TxSlots{block(addr2, tx7)}, nil, 10, 0, 4, [32]byte{6}))
+	require.False(has(7))
+}
+
+func TestRejectedCache(t *testing.T) {
+	require, ctx := require.New(t), context.Background()
+	db, coreDB := memdb.NewTestPoolDB(t), memdb.NewTestDB(t)
+	pool, err := New(make(chan Hashes, 100), db, coreDB, DefaultConfig)
+	require.NoError(err)
+	sender := [20]byte{1}
+	stateChanges := map[string]senderInfo{string(sender[:]): *newSenderInfo(2, *uint256.NewInt(1 << 62))}
+	require.NoError(pool.OnNewBlock(stateChanges, TxSlots{}, TxSlots{}, 10, 0, 1, [32]byte{}))
+	slots := func(txs ...*TxSlot) TxSlots {
+		res := TxSlots{}
+		for _, txn := range txs {
+			res.Append(txn, sender[:], false)
+		}
+		return res
+	}
+	known := func(txn *TxSlot) bool {
+		var ok bool
+		require.NoError(db.View(ctx, func(tx kv.Tx) (err error) {
+			ok, err = pool.IdHashKnown(tx, txn.idHash)
+			return err
+		}))
+		return ok
+	}
+
+	lowNonce := &TxSlot{nonce: 2, tip: 1, feeCap: 20, gas: 21000, idHash: [32]byte{1}}
+	lowFee := &TxSlot{nonce: 3, tip: 1, feeCap: 1, gas: 21000, idHash: [32]byte{2}}
+	ok := &TxSlot{nonce: 3, tip: 1, feeCap: 20, gas: 21000, idHash: [32]byte{3}}
+	var reasons []DiscardReason
+	require.NoError(db.View(ctx, func(tx kv.Tx) (err error) {
+		reasons, err = pool.AddLocals(ctx, slots(lowNonce, lowFee), tx)
+		return err
+	}))
+	require.Equal(NonceTooLow, reasons[0])
+	require.True(known(lowNonce))
+	require.False(known(lowFee)) // fee-related rejections depend on base fee, they are not remembered
+	require.False(known(ok))
+	require.NoError(db.View(ctx, func(tx kv.Tx) error {
+		pooled, err := pool.IdHashPooled(tx, lowNonce.idHash) // local transactions are validated again
+		require.False(pooled)
+		return err
+	}))
+
+	// rejected transactions are not fetched and not validated again
+	pool.AddRemoteTxs(ctx, slots(lowNonce, lowFee, ok))
+	require.Equal(2, len(pool.unprocessedRemoteTxs.txs))
+
+	// unwinded transactions are not rejected anymore
+	require.NoError(pool.OnNewBlock(stateChanges, slots(lowNonce), TxSlots{}, 10, 0, 1, [32]byte{}))
+	require.False(pool.isRejected(lowNonce.idHash[:]))
+
+	// rejection is forgotten after RejectedLifetime
+	pool.cfg.RejectedLifetime = 0
+	pool.reject(ok.idHash[:], Mined)
+	require.False(known(ok))
+}
+
+// timers of pool run on Config.Clock: rejected cache aging and rebroadcast of locals are tested without sleeps
+func TestPoolFakeClock(t *testing.T) {
+	require := require.New(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	db, coreDB := memdb.NewTestPoolDB(t), memdb.NewTestDB(t)
+	clk := clock.NewFake(time.Unix(1_000_000, 0))
+	cfg := DefaultConfig
+	cfg.Clock = clk
+	newTxs := make(chan Hashes, 100)
+	pool, err := New(newTxs, db, coreDB, cfg)
+	require.NoError(err)
+
+	rejected := [32]byte{9}
+	pool.reject(rejected[:], NonceTooLow)
+	clk.Advance(cfg.RejectedLifetime - time.Second)
+	require.True(pool.isRejected(rejected[:]))
+	clk.Advance(time.Second)
+	require.False(pool.isRejected(rejected[:]))
+
+	m := NewMockSentry(ctx)
+	broadcasts := make(chan []byte, 10)
+	m.SendMessageToAllFunc = func(_ context.Context, req *sentry.OutboundMessageData) (*sentry.SentPeers, error) {
+		broadcasts <- req.Data
+		return &sentry.SentPeers{}, nil
+	}
+	send := NewSend(ctx, []SentryClient{direct.NewSentryClientDirect(direct.ETH66, m)}, pool)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		MainLoop(ctx, db, coreDB, pool, newTxs, send, &NewSlotsStreams{})
+	}()
+	defer func() {
+		cancel()
+		<-done
+	}()
+	clk.BlockUntil(5) // 3 tickers of MainLoop and 2 background jobs: pool is restored from db
+	received := func() []byte {
+		select {
+		case data := <-broadcasts:
+			return data
+		case <-time.After(time.Minute):
+			require.FailNow("no broadcast")
+			return nil
+		}
+	}
+
+	sender := [20]byte{1}
+	stateChanges := map[string]senderInfo{string(sender[:]): *newSenderInfo(2, *uint256.NewInt(1 << 62))}
+	require.NoError(pool.OnNewBlock(stateChanges, TxSlots{}, TxSlots{}, 10, 0, 1, [32]byte{}))
+	local := &TxSlot{nonce: 3, tip: 1, feeCap: 20, gas: 21000, idHash: [32]byte{1}}
+	txs := TxSlots{}
+	txs.Append(local, sender[:], true)
+	require.NoError(db.View(ctx, func(tx kv.Tx) error {
+		reasons, err := pool.AddLocals(ctx, txs, tx)
+		require.Equal([]DiscardReason{Success}, reasons)
+		return err
+	}))
+	require.Equal(EncodeHashes(local.idHash[:], nil), received()) // broadcast of new transaction
+
+	clk.Advance(cfg.rebroadcastLocalsEvery)
+	require.Equal(EncodeHashes(local.idHash[:], nil), received()) // still pending: broadcast again
+}
+
+func TestBackgroundJobsWithoutDB(t *testing.T) {
+	require, ctx := require.New(t), context.Background()
+	pool, err := New(make(chan Hashes, 100), nil, memdb.NewTestDB(t), DefaultConfig)
+	require.NoError(err)
+	jobs := background.New(nil)
+	require.NoError(pool.addBackgroundJobs(jobs, nil))
+	require.Equal(1, len(jobs.Status()))
+	require.NoError(jobs.Start(ctx))
+	require.NoError(jobs.Stop(ctx)) // no final flush
+}
+
+func TestAdmission(t *testing.T) {
+	require, ctx := require.New(t), context.Background()
+	db, coreDB := memdb.NewTestPoolDB(t), memdb.NewTestDB(t)
+	cfg := DefaultConfig
+	denied, allowed := [20]byte{1}, [20]byte{2}
+	var states []SenderState
+	cfg.Admission = AllOf(DenySenders(denied), MaxDataLen(100), func(tx *TxSlot, sender common.Address, state SenderState) Decision {
+		states = append(states, state)
+		return Admit
+	})
+	pool, err := New(make(chan Hashes, 100), db, coreDB, cfg)
+	require.NoError(err)
+	stateChanges := map[string]senderInfo{
+		string(denied[:]):  *newSenderInfo(0, *uint256.NewInt(1 << 62)),
+		string(allowed[:]): *newSenderInfo(0, *uint256.NewInt(1 << 62)),
+	}
+	require.NoError(pool.OnNewBlock(stateChanges, TxSlots{}, TxSlots{}, 10, 0, 1, [32]byte{}))
+
+	txs := TxSlots{}
+	txs.Append(&TxSlot{nonce: 1, tip: 1, feeCap: 20, gas: 21000, idHash: [32]byte{1}}, denied[:], false)
+	txs.Append(&TxSlot{nonce: 1, tip: 1, feeCap: 20, gas: 100000, dataLen: 101, idHash: [32]byte{2}}, allowed[:], false)
+	txs.Append(&TxSlot{nonce: 1, tip: 1, feeCap: 20, gas: 100000, dataLen: 100, idHash: [32]byte{3}}, allowed[:], false)
+	var reasons []DiscardReason
+	require.NoError(db.View(ctx, func(tx kv.Tx) (err error) {
+		reasons, err = pool.AddLocals(ctx, txs, tx)
+		return err
+	}))
+	require.Equal(NotAdmitted, reasons[0])
+	require.Equal(NotAdmitted, reasons[1])
+	require.Equal(Success, reasons[2])
+	require.Equal([]SenderState{{Nonce: 0, Balance: *uint256.NewInt(1 << 62)}}, states)
+	_, ok := pool.byHash[string(txs.txs[2].idHash[:])]
+	require.True(ok)
+	require.False(pool.isRejected(txs.txs[0].idHash[:])) // policy can change, transaction can be admitted later
+}
+
+func TestExportImport(t *testing.T) {
+	require, ctx := require.New(t), context.Background()
+	var sender [20]byte
+	copy(sender[:], testKeyAddr())
+	stateChanges := map[string]senderInfo{string(sender[:]): *newSenderInfo(0, *uint256.NewInt(1 << 62))}
+	newPool := func() (*TxPool, kv.RwDB) {
+		db, coreDB := memdb.NewTestPoolDB(t), memdb.NewTestDB(t)
+		pool, err := New(make(chan Hashes, 100), db, coreDB, DefaultConfig)
+		require.NoError(err)
+		require.NoError(pool.OnNewBlock(stateChanges, TxSlots{}, TxSlots{}, 10, 5, 1, [32]byte{}))
+		return pool, db
+	}
+	parse := func(nonce uint64) TxSlots {
+		txs, txn, senderOfTx := TxSlots{}, &TxSlot{}, make([]byte, 20)
+		_, err := NewTxParseContext().ParseTransaction(blobTx(t, nonce, 1, true), 0, txn, senderOfTx)
+		require.NoError(err)
+		txs.Append(txn, senderOfTx, false)
+		return txs
+	}
+
+	from, fromDB := newPool()
+	require.NoError(fromDB.View(ctx, func(tx kv.Tx) error {
+		_, err := from.AddLocals(ctx, parse(1), tx)
+		return err
+	}))
+	from.AddRemoteTxs(ctx, parse(2))
+	require.NoError(from.processRemoteTxs(ctx))
+	from.byHash[string(parse(2).txs[0].idHash[:])].added = time.Now().Add(-time.Hour)
+
+	var buf bytes.Buffer
+	require.NoError(fromDB.View(ctx, func(tx kv.Tx) error {
+		exported, err := from.Export(tx, &buf)
+		require.Equal(2, exported)
+		return err
+	}))
+	require.True(strings.HasPrefix(buf.String(), exportHeader+"\n"))
+
+	to, toDB := newPool()
+	require.NoError(toDB.View(ctx, func(tx kv.Tx) error {
+		imported, err := to.Import(ctx, bytes.NewReader(buf.Bytes()), tx)
+		require.Equal(2, imported)
+		return err
+	}))
+	for hash, mt := range from.byHash {
+		imported, ok := to.byHash[hash]
+		require.True(ok)
+		require.Equal(mt.subPool&IsLocal, imported.subPool&IsLocal)
+		require.True(mt.added.Equal(imported.added))
+	}
+	require.Equal(IsLocal, int(to.byHash[string(parse(1).txs[0].idHash[:])].subPool&IsLocal))
+
+	// sender must match recovered one
+	broken := strings.Replace(buf.String(), fmt.Sprintf("sender=0x%x", sender), fmt.Sprintf("sender=0x%x", [20]byte{1}), 1)
+	require.NoError(toDB.View(ctx, func(tx kv.Tx) error {
+		_, err := to.Import(ctx, strings.NewReader(broken), tx)
+		require.Error(err)
+		_, err = to.Import(ctx, strings.NewReader("sender=0x01"), tx)
+		require.Error(err)
+		return nil
+	}))
+}
+
+func TestSuggestTip(t *testing.T) {
+	require, ctx := require.New(t), context.Background()
+	db, coreDB := memdb.NewTestPoolDB(t), memdb.NewTestDB(t)
+	pool, err := New(make(chan Hashes, 100), db, coreDB, DefaultConfig)
+	require.NoError(err)
+	require.Zero(pool.SuggestTip(50))
+
+	stateChanges, txs := map[string]senderInfo{}, TxSlots{}
+	for i := 1; i <= 10; i++ {
+		sender := [20]byte{byte(i)}
+		stateChanges[string(sender[:])] = *newSenderInfo(0, *uint256.NewInt(1 << 62))
+		txs.Append(&TxSlot{nonce: 1, tip: uint64(i), feeCap: 100, gas: 21000, idHash: [32]byte{byte(i)}}, sender[:], false)
+	}
+	require.NoError(pool.OnNewBlock(stateChanges, TxSlots{}, TxSlots{}, 10, 0, 1, [32]byte{}))
+	require.NoError(db.View(ctx, func(tx kv.Tx) error {
+		_, err := pool.AddLocals(ctx, txs, tx)
+		return err
+	}))
+	require.Equal(uint64(1), pool.SuggestTip(0))
+	require.Equal(uint64(5), pool.SuggestTip(50))
+	require.Equal(uint64(10), pool.SuggestTip(100))
+	require.Equal(uint64(2*10+10), pool.SuggestFeeCap(100))
+
+	// base fee grows: effective tips are limited by feeCap
+	require.NoError(pool.OnNewBlock(map[string]senderInfo{}, TxSlots{}, TxSlots{}, 95, 0, 2, [32]byte{}))
+	require.Equal(uint64(5), pool.SuggestTip(100))
+	require.Equal(uint64(2*95+5), pool.SuggestFeeCap(100))
+}
+
+func TestPrivateEvents(t *testing.T) {
+	require, ctx := require.New(t), context.Background()
+	db, coreDB := memdb.NewTestPoolDB(t), memdb.NewTestDB(t)
+	pool, err := New(make(chan Hashes, 100), db, coreDB, DefaultConfig)
+	require.NoError(err)
+	sender := [20]byte{1}
+	stateChanges := map[string]senderInfo{string(sender[:]): *newSenderInfo(0, *uint256.NewInt(1 << 62))}
+	require.NoError(pool.OnNewBlock(stateChanges, TxSlots{}, TxSlots{}, 10, 0, 1, [32]byte{}))
+
+	events := make(chan Event, 100)
+	defer pool.SubscribeEvents(events)()
+	slots := func(txs ...*TxSlot) TxSlots {
+		res := TxSlots{}
+		for _, txn := range txs {
+			res.Append(txn, sender[:], true)
+		}
+		return res
+	}
+	add := func(private bool, txs ...*TxSlot) {
+		require.NoError(db.View(ctx, func(tx kv.Tx) (err error) {
+			if private {
+				_, err = pool.AddPrivate(ctx, slots(txs...), tx)
+			} else {
+				_, err = pool.AddLocals(ctx, slots(txs...), tx)
+			}
+			return err
+		}))
+	}
+
+	tx1 := &TxSlot{nonce: 2, tip: 1, feeCap: 20, gas: 21000, idHash: [32]byte{1}}
+	add(true, tx1)
+	tx2 := &TxSlot{nonce: 1, tip: 1, feeCap: 20, gas: 21000, idHash: [32]byte{2}}
+	add(true, tx2)
+	require.Equal(PendingSubPool, pool.byHash[string(tx1.idHash[:])].currentSubPool) // promoted
+	tx3 := &TxSlot{nonce: 1, tip: 2, feeCap: 30, gas: 21000, idHash: [32]byte{3}}
+	add(true, tx3)                                                                   // replaces tx2
+	add(true, &TxSlot{nonce: 3, tip: 1, feeCap: 1, gas: 21000, idHash: [32]byte{4}}) // dropped: fee too low
+	minedState := map[string]senderInfo{string(sender[:]): *newSenderInfo(1, *uint256.NewInt(1 << 62))}
+	require.NoError(pool.OnNewBlock(minedState, TxSlots{}, slots(tx3), 10, 0, 2, [32]byte{}))
+	require.NoError(pool.OnNewBlock(stateChanges, slots(tx3), TxSlots{}, 10, 0, 1, [32]byte{}))
+	require.Zero(len(events))
+
+	tx5 := &TxSlot{nonce: 3, tip: 1, feeCap: 20, gas: 21000, idHash: [32]byte{5}}
+	add(false, tx5)
+	require.Equal(Event{Type: EventAdded, IdHash: tx5.idHash, Seq: 1}, <-events)
+	require.Zero(len(events))
+}
+
+func TestPrivate(t *testing.T) {
+	require, ctx := require.New(t), context.Background()
+	db, coreDB := memdb.NewTestPoolDB(t), memdb.NewTestDB(t)
+	newTxs := make(chan Hashes, 100)
+	pool, err := New(newTxs, db, coreDB, DefaultConfig)
+	require.NoError(err)
+	sender := testKeyAddr()
+	stateChanges := map[string]senderInfo{string(sender): *newSenderInfo(0, *uint256.NewInt(1 << 62))}
+	require.NoError(pool.OnNewBlock(stateChanges, TxSlots{}, TxSlots{}, 10, 5, 1, [32]byte{}))
+	parse := func(nonce uint64) TxSlots {
+		txs, txn, senderOfTx := TxSlots{}, &TxSlot{}, make([]byte, 20)
+		_, err := NewTxParseContext().ParseTransaction(blobTx(t, nonce, 1, true), 0, txn, senderOfTx)
+		require.NoError(err)
+		txs.Append(txn, senderOfTx, false)
+		return txs
+	}
+	private, public := parse(1), parse(2)
+	privateHash, publicHash := private.txs[0].idHash, public.txs[0].idHash
+	events := make(chan Event, 100)
+	defer pool.SubscribeEvents(events)()
+	require.NoError(db.View(ctx, func(tx kv.Tx) error {
+		reasons, err := pool.AddPrivate(ctx, private, tx)
+		require.Equal([]DiscardReason{Success}, reasons)
+		if err != nil {
+			return err
+		}
+		_, err = pool.AddLocals(ctx, public, tx)
+		return err
+	}))
+	require.True(pool.IsPrivate(privateHash))
+	require.False(pool.IsPrivate(publicHash))
+	require.Equal(Hashes(publicHash[:]), <-newTxs)
+	require.Equal(0, len(newTxs))
+	require.Equal(Hashes(publicHash[:]), Hashes(pool.AppendLocalHashes(nil)))
+	require.Equal(Hashes(publicHash[:]), Hashes(pool.appendPendingLocalHashes(nil)))
+	_, _, known := pool.Announcements(append(append(Hashes{}, privateHash[:]...), publicHash[:]...))
+	require.Equal(Hashes(publicHash[:]), known)
+
+	s := NewGrpcServer(ctx, pool, db)
+	reply, err := s.Inspect(ctx, &txpool_proto.InspectRequest{})
+	require.NoError(err)
+	require.Equal(1, len(reply.Senders))
+	inspected := append(reply.Senders[0].Pending, reply.Senders[0].Queued...)
+	require.Equal(1, len(inspected))
+	require.Equal(public.txs[0].idHash, gointerfaces.ConvertH256ToHash(inspected[0].Hash))
+	txsReply, err := s.Transactions(ctx, &txpool_proto.TransactionsRequest{Hashes: []*types.H256{gointerfaces.ConvertHashToH256(private.txs[0].idHash), gointerfaces.ConvertHashToH256(public.txs[0].idHash)}})
+	require.NoError(err)
+	require.Nil(txsReply.RlpTxs[0])
+	require.NotNil(txsReply.RlpTxs[1])
+	require.Equal(1, len(events))
+	require.Equal(Event{Type: EventAdded, IdHash: public.txs[0].idHash, Seq: 1}, <-events)
+
+	// private flag survives restart
+	_, _, err = pool.flush(db)
+	require.NoError(err)
+	restarted, err := New(make(chan Hashes, 100), db, coreDB, DefaultConfig)
+	require.NoError(err)
+	require.NoError(db.Update(ctx, func(tx kv.RwTx) error {
+		return coreDB.View(ctx, func(coreTx kv.Tx) error { return restarted.fromDB(ctx, tx, coreTx) })
+	}))
+	require.True(restarted.IsPrivate(privateHash))
+	require.False(restarted.IsPrivate(publicHash))
+
+	// and mining with unwind
+	minedState := map[string]senderInfo{string(sender): *newSenderInfo(1, *uint256.NewInt(1 << 62))}
+	require.NoError(pool.OnNewBlock(minedState, TxSlots{}, private, 10, 5, 2, [32]byte{}))
+	_, ok := pool.private[string(privateHash[:])]
+	require.False(ok)
+	require.True(pool.IsPrivate(privateHash))
+	require.NoError(pool.OnNewBlock(stateChanges, parse(1), TxSlots{}, 10, 5, 1, [32]byte{}))
+	_, ok = pool.byHash[string(privateHash[:])]
+	require.True(ok)
+	_, ok = pool.private[string(privateHash[:])]
+	require.True(ok)
+	require.Equal(0, len(newTxs))
+}
+
+func TestDigest(t *testing.T) {
+	require, ctx := require.New(t), context.Background()
+	stateChanges, txs := map[string]senderInfo{}, TxSlots{}
+	for i := 1; i <= 4; i++ {
+		sender := [20]byte{byte(i)}
+		stateChanges[string(sender[:])] = *newSenderInfo(0, *uint256.NewInt(1 << 62))
+		nonce := uint64(1)
+		if i == 4 {
+			nonce = 2 // nonce gap - queued
+		}
+		txs.Append(&TxSlot{nonce: nonce, tip: uint64(i), feeCap: 100, gas: 21000, idHash: [32]byte{byte(i)}}, sender[:], false)
+	}
+	newPool := func() (*TxPool, kv.RwDB) {
+		db, coreDB := memdb.NewTestPoolDB(t), memdb.NewTestDB(t)
+		pool, err := New(make(chan Hashes, 100), db, coreDB, DefaultConfig)
+		require.NoError(err)
+		require.NoError(pool.OnNewBlock(stateChanges, TxSlots{}, TxSlots{}, 10, 0, 1, [32]byte{}))
+		return pool, db
+	}
+	add := func(pool *TxPool, db kv.RoDB, private bool, idx ...int) {
+		slots := TxSlots{}
+		for _, i := range idx {
+			txn := *txs.txs[i] // pools set senderID of slot
+			slots.Append(&txn, txs.senders.At(i), false)
+		}
+		require.NoError(db.View(ctx, func(tx kv.Tx) (err error) {
+			if private {
+				_, err = pool.AddPrivate(ctx, slots, tx)
+			} else {
+				_, err = pool.AddLocals(ctx, slots, tx)
+			}
+			return err
+		}))
+	}
+
+	a, aDB := newPool()
+	b, bDB := newPool()
+	add(a, aDB, false, 0, 1, 3)
+	add(b, bDB, false, 3)
+	add(b, bDB, false, 1, 0)
+	d := a.Digest()
+	require.Equal(d, b.Digest())
+	require.Equal(2, d.PendingCount)
+	require.Equal(1, d.QueuedCount)
+
+	add(b, bDB, true, 2) // private transactions are not compared
+	require.Equal(d, b.Digest())
+	add(a, aDB, false, 2)
+	require.NotEqual(d.Pending, a.Digest().Pending)
+	require.Equal(d.Queued, a.Digest().Queued)
+	require.NotEqual(d.All, a.Digest().All)
+
+	reply, err := NewGrpcServer(ctx, b, bDB).Digest(ctx, &txpool_proto.DigestRequest{})
+	require.NoError(err)
+	require.Equal(d.All, common.Hash(gointerfaces.ConvertH256ToHash(reply.All)))
+	require.Equal(uint32(2), reply.PendingCount)
+}
+
+func TestPoolFormatVersion(t *testing.T) {
+	require := require.New(t)
+	version := func(tx kv.Tx) uint64 {
+		v, err := tx.GetOne(kv.PoolInfo, PoolFormatVersionKey)
+		require.NoError(err)
+		require.Len(v, 8)
+		return binary.BigEndian.Uint64(v)
+	}
+
+	// empty db is marked by current version without migrations
+	_, tx := memdb.NewTestPoolTx(t)
+	var applied []int
+	migrations := []func(tx kv.RwTx, logger logging.Logger) error{
+		func(tx kv.RwTx, logger logging.Logger) error { applied = append(applied, 0); return nil },
+		func(tx kv.RwTx, logger logging.Logger) error { applied = append(applied, 1); return nil },
+	}
+	require.NoError(migratePoolDB(tx, logging.Discard(), migrations))
+	require.Empty(applied)
+	require.Equal(uint64(2), version(tx))
+
+	// unversioned db with data goes through all migrations
+	_, tx = memdb.NewTestPoolTx(t)
+	require.NoError(tx.Put(kv.PoolInfo, PoolPendingBaseFeeKey, make([]byte, 8)))
+	require.NoError(migratePoolDB(tx, logging.Discard(), migrations))
+	require.Equal([]int{0, 1}, applied)
+	require.Equal(uint64(2), version(tx))
+	require.NoError(migratePoolDB(tx, logging.Discard(), migrations))
+	require.Equal([]int{0, 1}, applied)
+
+	// db of newer version is not touched
+	require.True(errors.Is(migratePoolDB(tx, logging.Discard(), migrations[:1]), ErrPoolFormatTooNew))
+	require.Equal(uint64(2), version(tx))
+
+	// unversioned pool: unparseable transactions are dropped, others are kept
+	_, tx = memdb.NewTestPoolTx(t)
+	good := append(make([]byte, 8), decodeHex(txParseTests[0].payloadStr)...)
+	require.NoError(tx.Put(kv.PoolTransaction, []byte{1}, good))
+	require.NoError(tx.Put(kv.PoolTransaction, []byte{2}, append(make([]byte, 8), 0xc2, 0xc0, 0xc0)))
+	require.NoError(migratePoolDB(tx, logging.Discard(), poolMigrations))
+	require.Equal(PoolFormatVersion, version(tx))
+	has, err := tx.Has(kv.PoolTransaction, []byte{1})
+	require.NoError(err)
+	require.True(has)
+	has, err = tx.Has(kv.PoolTransaction, []byte{2})
+	require.NoError(err)
+	require.False(has)
+
+	// pool is not loaded from db of newer version and is not flushed over it
+	binary.BigEndian.PutUint64(good[:8], PoolFormatVersion+1)
+	require.NoError(tx.Put(kv.PoolInfo, PoolFormatVersionKey, good[:8]))
+	pool, err := New(make(chan Hashes, 1), nil, nil, DefaultConfig)
+	require.NoError(err)
+	require.True(errors.Is(pool.fromDB(context.Background(), tx, nil), ErrPoolFormatTooNew))
+	_, err = pool.flushLocked(tx)
+	require.True(errors.Is(err, ErrPoolFormatTooNew))
+	require.Equal(PoolFormatVersion+1, version(tx))
+}
+
+// testMetrics - embedder's sink of metrics
+type testMetrics struct {
+	added, flushed int
+	reasons        []DiscardReason // rejected and discarded
+	pending        int
+}
+
+func (m *testMetrics) Added(bool)                                { m.added++ }
+func (m *testMetrics) Rejected(reason DiscardReason)             { m.reasons = append(m.reasons, reason) }
+func (m *testMetrics) Discarded(reason DiscardReason)            { m.reasons = append(m.reasons, reason) }
+func (m *testMetrics) SubPoolSizes(pending, baseFee, queued int) { m.pending = pending }
+func (m *testMetrics) Validated(time.Duration)                   {}
+func (m *testMetrics) Propagated(time.Duration)                  {}
+func (m *testMetrics) Flushed(write, commit time.Duration)       { m.flushed++ }
+
+func TestMetrics(t *testing.T) {
+	require, ctx := require.New(t), context.Background()
+	db, coreDB := memdb.NewTestPoolDB(t), memdb.NewTestDB(t)
+	cfg, sink := DefaultConfig, &testMetrics{}
+	cfg.Metrics = sink
+	pool, err := New(make(chan Hashes, 100), db, coreDB, cfg)
+	require.NoError(err)
+	sender := [20]byte{1}
+	stateChanges := map[string]senderInfo{string(sender[:]): *newSenderInfo(0, *uint256.NewInt(1 << 62))}
+	require.NoError(pool.OnNewBlock(stateChanges, TxSlots{}, TxSlots{}, 10, 0, 1, [32]byte{}))
+
+	rejected, added := rejectedByReason[IntrinsicGasTooLow].Get(), addedLocalCounter.Get()
+	replaced := discardedByReason[ReplacedByHigherTip].Get()
+	txs := TxSlots{}
+	txs.Append(&TxSlot{nonce: 1, tip: 1, feeCap: 20, gas: 21000, idHash: [32]byte{1}}, sender[:], false)
+	txs.Append(&TxSlot{nonce: 2, tip: 1, feeCap: 20, gas: 21000, dataLen: 1, dataNonZero: 1, idHash: [32]byte{2}}, sender[:], false)
+	require.NoError(db.View(ctx, func(tx kv.Tx) error {
+		_, err := pool.AddLocals(ctx, txs, tx)
+		return err
+	}))
+	require.Equal(rejected+1, rejectedByReason[IntrinsicGasTooLow].Get())
+	require.Equal(added+1, addedLocalCounter.Get())
+	require.Equal(uint64(1), pendingSizeGauge.Get())
+	require.Equal(uint64(0), queuedSizeGauge.Get())
+
+	txs = TxSlots{}
+	txs.Append(&TxSlot{nonce: 1, tip: 10, feeCap: 30, gas: 21000, idHash: [32]byte{3}}, sender[:], false)
+	require.NoError(db.View(ctx, func(tx kv.Tx) error {
+		_, err := pool.AddLocals(ctx, txs, tx)
+		return err
+	}))
+	require.Equal(replaced+1, discardedByReason[ReplacedByHigherTip].Get())
+	require.Equal(uint64(1), pendingSizeGauge.Get())
+	require.Nil(rejectedByReason[0])
+	require.Nil(discardedByReason[IntrinsicGasTooLow+1])
+
+	_, _, err = pool.flush(db)
+	require.NoError(err)
+	require.Equal(&testMetrics{added: 2, flushed: 1, reasons: []DiscardReason{IntrinsicGasTooLow, ReplacedByHigherTip}, pending: 1}, sink)
+}
+
+func TestIntrinsicGasRules(t *testing.T) {
+	require, ctx := require.New(t), context.Background()
+	db, coreDB := memdb.NewTestPoolDB(t), memdb.NewTestDB(t)
+	clk := clock.NewFake(time.Unix(1_000_000, 0))
+	cfg := DefaultConfig
+	cfg.Clock = clk
+	cfg.Chain = &chain.Config{HomesteadBlock: big.NewInt(0), IstanbulBlock: big.NewInt(2), ShanghaiTime: big.NewInt(1_000_100)}
+	pool, err := New(make(chan Hashes, 100), db, coreDB, cfg)
+	require.NoError(err)
+	sender := [20]byte{1}
+	stateChanges := map[string]senderInfo{string(sender[:]): *newSenderInfo(0, *uint256.NewInt(1 << 62))}
+	require.NoError(pool.OnNewBlock(stateChanges, TxSlots{}, TxSlots{}, 10, 0, 1, [32]byte{}))
+
+	add := func(nonce uint64, gas uint64) DiscardReason {
+		txs := TxSlots{}
+		txs.Append(&TxSlot{nonce: nonce, tip: 1, feeCap: 20, gas: gas, creation: true, dataLen: 64, dataNonZero: 1, idHash: [32]byte{byte(nonce)}}, sender[:], true)
+		var reasons []DiscardReason
+		require.NoError(db.View(ctx, func(tx kv.Tx) error {
+			reasons, err = pool.AddLocals(ctx, txs, tx)
+			return err
+		}))
+		return reasons[0]
+	}
+	// pending block 2 is Istanbul, but not Shanghai yet
+	require.Equal(Success, add(1, TxGasContractCreation+63*TxDataZeroGas+TxDataNonZeroGas))
+	clk.Advance(100 * time.Second)
+	require.Equal(IntrinsicGasTooLow, add(2, TxGasContractCreation+63*TxDataZeroGas+TxDataNonZeroGas))
+	require.Equal(Success, add(2, TxGasContractCreation+63*TxDataZeroGas+TxDataNonZeroGas+2*InitCodeWordGas))
+}
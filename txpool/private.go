@@ -0,0 +1,80 @@
+/*
+   Copyright 2021 Erigon contributors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package txpool
+
+import (
+	"context"
+
+	"github.com/ledgerwatch/erigon-lib/common"
+	"github.com/ledgerwatch/erigon-lib/kv"
+)
+
+// AddPrivate - adds local transactions which are never propagated: not announced, not sent to peers (even by request)
+// and not returned by Content, Transactions or events stream. They are returned only by Best - to block builders.
+// Transaction which is already in pool stays as is - it could be propagated already
+func (p *TxPool) AddPrivate(ctx context.Context, newTxs TxSlots, tx kv.Tx) ([]DiscardReason, error) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	private := make([]bool, len(newTxs.txs))
+	for i := range newTxs.isLocal {
+		newTxs.isLocal[i] = true
+		private[i] = true
+	}
+	marked := p.markPrivate(newTxs, private)
+	defer p.unmarkNotAdded(marked)
+	return p.addTxsLocked(ctx, newTxs, tx)
+}
+
+// IsPrivate - transaction is pooled private transaction, or it was mined recently
+func (p *TxPool) IsPrivate(idHash common.Hash) bool {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+	if _, ok := p.private[string(idHash[:])]; ok {
+		return true
+	}
+	return p.privateHistory.Contains(string(idHash[:])) // Get would reorder LRU under read lock
+}
+
+// markPrivate - marks not pooled transactions as private before they are added, to not notify about them.
+// Returns hashes of marked transactions
+func (p *TxPool) markPrivate(txs TxSlots, private []bool) (marked []string) {
+	for i := range txs.txs {
+		if !private[i] {
+			continue
+		}
+		hash := string(txs.txs[i].idHash[:])
+		if _, ok := p.byHash[hash]; ok {
+			continue
+		}
+		if _, ok := p.private[hash]; ok {
+			continue
+		}
+		p.private[hash] = struct{}{}
+		marked = append(marked, hash)
+	}
+	return marked
+}
+
+// unmarkNotAdded - forgets marks of transactions which were rejected
+func (p *TxPool) unmarkNotAdded(marked []string) {
+	for _, hash := range marked {
+		if _, ok := p.byHash[hash]; !ok {
+			delete(p.private, hash)
+		}
+	}
+}
@@ -0,0 +1,163 @@
+/*
+   Copyright 2021 Erigon contributors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package txpool
+
+import (
+	"sync"
+	"time"
+
+	"github.com/VictoriaMetrics/metrics"
+	"github.com/hashicorp/golang-lru/simplelru"
+	"github.com/ledgerwatch/erigon-lib/gointerfaces"
+)
+
+var (
+	peerInvalidCounter     = metrics.GetOrCreateCounter(`pool_peer_misbehaviour{kind="invalid"}`)
+	peerUnderpricedCounter = metrics.GetOrCreateCounter(`pool_peer_misbehaviour{kind="underpriced"}`)
+	peerDuplicateCounter   = metrics.GetOrCreateCounter(`pool_peer_misbehaviour{kind="duplicate"}`)
+	peerThrottledCounter   = metrics.GetOrCreateCounter(`pool_peer_announces_throttled`)
+	peerKickedCounter      = metrics.GetOrCreateCounter(`pool_peer_kicked`)
+)
+
+// PeerScoreConfig - how Fetch treats peers which gossip transactions
+type PeerScoreConfig struct {
+	Window      time.Duration // scores and announce limits are counted per window
+	MaxAnnounce int           // amount of announced hashes per window, hashes above limit are ignored. 0 - no limit
+	KickScore   int           // peer is disconnected by sentry when its score in window reaches it. 0 - never
+
+	// weights of misbehaviour in score
+	Invalid     int // malformed message or transaction
+	Underpriced int // transaction with feeCap below base fee of pending block
+	Duplicate   int // transaction which is already known and was not requested. Requested are not scored: they may arrive from other peer before reply
+}
+
+var DefaultPeerScoreConfig = PeerScoreConfig{
+	Window:      time.Minute,
+	MaxAnnounce: 64 * 1024,
+	KickScore:   100,
+	Invalid:     100,
+	Underpriced: 1,
+	Duplicate:   1,
+}
+
+const requestedHashesLimit = 64 * 1024 // hashes of recently requested transactions, see peerScores.requesting
+
+type peerScore struct {
+	windowStart time.Time
+	score       int
+	announced   int
+}
+
+// peerScores - per-peer counters of misbehaviour, for peers which sent something to Fetch
+type peerScores struct {
+	cfg       PeerScoreConfig
+	lock      sync.Mutex
+	peers     map[string]*peerScore
+	requested *simplelru.LRU // hashes recently requested from any peer: known transactions in replies to them are not duplicates
+}
+
+func newPeerScores(cfg PeerScoreConfig) *peerScores {
+	requested, err := simplelru.NewLRU(requestedHashesLimit, nil)
+	if err != nil {
+		panic(err)
+	}
+	return &peerScores{cfg: cfg, peers: map[string]*peerScore{}, requested: requested}
+}
+
+// requesting - remembers hashes which are requested from peer
+func (s *peerScores) requesting(hashes Hashes) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	for i := 0; i < len(hashes); i += 32 {
+		s.requested.Add(string(hashes[i:i+32]), struct{}{})
+	}
+}
+
+// wasRequested - known transaction in reply is duplicate only if nobody requested it recently
+func (s *peerScores) wasRequested(hash []byte) bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.requested.Contains(string(hash))
+}
+
+func (s *peerScores) get(peerID PeerID, now time.Time) *peerScore {
+	key := gointerfaces.ConvertH512ToArray(peerID)
+	p, ok := s.peers[string(key[:])] // lookup by converted key doesn't allocate
+	if !ok {
+		p = &peerScore{windowStart: now}
+		s.peers[string(key[:])] = p
+	}
+	if now.Sub(p.windowStart) >= s.cfg.Window {
+		p.windowStart, p.score, p.announced = now, 0, 0
+	}
+	return p
+}
+
+// announce - returns how many of n announced hashes can be requested from peer
+func (s *peerScores) announce(peerID PeerID, n int, now time.Time) int {
+	if s.cfg.MaxAnnounce <= 0 {
+		return n
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	p := s.get(peerID, now)
+	allowed := s.cfg.MaxAnnounce - p.announced
+	if allowed < 0 {
+		allowed = 0
+	}
+	if allowed > n {
+		allowed = n
+	}
+	p.announced += n
+	if allowed < n {
+		peerThrottledCounter.Add(n - allowed)
+	}
+	return allowed
+}
+
+// misbehave - adds to peer's score invalid, underpriced and duplicate transactions (or messages).
+// Returns true if peer must be kicked, then peer is forgotten
+func (s *peerScores) misbehave(peerID PeerID, invalid, underpriced, duplicate int, now time.Time) (kick bool) {
+	if invalid+underpriced+duplicate == 0 {
+		return false
+	}
+	peerInvalidCounter.Add(invalid)
+	peerUnderpricedCounter.Add(underpriced)
+	peerDuplicateCounter.Add(duplicate)
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	p := s.get(peerID, now)
+	p.score += invalid*s.cfg.Invalid + underpriced*s.cfg.Underpriced + duplicate*s.cfg.Duplicate
+	if s.cfg.KickScore <= 0 || p.score < s.cfg.KickScore {
+		return false
+	}
+	peerKickedCounter.Inc()
+	s.forget(peerID)
+	return true
+}
+
+func (s *peerScores) forget(peerID PeerID) {
+	key := gointerfaces.ConvertH512ToArray(peerID)
+	delete(s.peers, string(key[:]))
+}
+
+func (s *peerScores) disconnected(peerID PeerID) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.forget(peerID)
+}
@@ -20,9 +20,9 @@ import (
 	"context"
 	"sync"
 
+	"github.com/ledgerwatch/erigon-lib/common/logging"
 	"github.com/ledgerwatch/erigon-lib/direct"
 	"github.com/ledgerwatch/erigon-lib/gointerfaces/sentry"
-	"github.com/ledgerwatch/log/v3"
 	"google.golang.org/grpc"
 )
 
@@ -37,6 +37,7 @@ type Send struct {
 	ctx           context.Context
 	sentryClients []SentryClient // sentry clients that will be used for accessing the network
 	pool          Pool
+	logger        logging.Logger
 
 	wg *sync.WaitGroup
 }
@@ -46,6 +47,7 @@ func NewSend(ctx context.Context, sentryClients []SentryClient, pool Pool) *Send
 		ctx:           ctx,
 		pool:          pool,
 		sentryClients: sentryClients,
+		logger:        logging.Root(),
 	}
 }
 
@@ -53,12 +55,46 @@ func (f *Send) SetWaitGroup(wg *sync.WaitGroup) {
 	f.wg = wg
 }
 
+func (f *Send) SetLogger(logger logging.Logger) {
+	f.logger = logging.OrRoot(logger)
+}
+
 const (
 	// This is the target size for the packs of transactions or announcements. A
 	// pack can get larger than this if a single transactions exceeds this size.
 	p2pTxPacketLimit = 100 * 1024
 )
 
+// announcements68 - eth/68 announcement of hashes, with types and sizes of transactions. Empty if pool doesn't
+// know any of hashes
+func (f *Send) announcements68(hashes Hashes) []byte {
+	if f.pool == nil {
+		return []byte{}
+	}
+	types, sizes, known := f.pool.Announcements(hashes)
+	if len(known) == 0 {
+		return []byte{}
+	}
+	return EncodeAnnouncements68(types, sizes, known, nil)
+}
+
+// legacyAnnouncements - hashes for peers of eth/65-67: blob transactions (EIP-4844) are known since eth/68 only,
+// they are announced to eth/68 peers and never sent in full by broadcast
+func (f *Send) legacyAnnouncements(hashes Hashes) Hashes {
+	if f.pool == nil {
+		return hashes
+	}
+	types, _, known := f.pool.Announcements(hashes)
+	var legacy Hashes
+	for i, t := range types {
+		if int(t) == BlobTxType {
+			continue
+		}
+		legacy = append(legacy, known[i*32:(i+1)*32]...)
+	}
+	return legacy
+}
+
 func (f *Send) notifyTests() {
 	if f.wg != nil {
 		f.wg.Done()
@@ -73,6 +109,7 @@ func (f *Send) BroadcastLocalPooledTxs(txs Hashes) (sentToPeers int) {
 
 	avgPeersPerSent65 := 0
 	avgPeersPerSent66 := 0
+	avgPeersPerSent68 := 0
 	for len(txs) > 0 {
 		var pending Hashes
 		if len(txs) > p2pTxPacketLimit {
@@ -83,12 +120,16 @@ func (f *Send) BroadcastLocalPooledTxs(txs Hashes) (sentToPeers int) {
 			txs = txs[:0]
 		}
 
-		data := EncodeHashes(pending, nil)
-		var req66, req65 *sentry.OutboundMessageData
+		legacy := f.legacyAnnouncements(pending)
+		data := EncodeHashes(legacy, nil)
+		var req66, req65, req68 *sentry.OutboundMessageData
 		for _, sentryClient := range f.sentryClients {
 			//if !sentryClient.Ready() {
 			//	continue
 			//}
+			if len(legacy) == 0 && sentryClient.Protocol() < direct.ETH68 {
+				continue
+			}
 			switch sentryClient.Protocol() {
 			case direct.ETH65:
 				if req65 == nil {
@@ -100,11 +141,11 @@ func (f *Send) BroadcastLocalPooledTxs(txs Hashes) (sentToPeers int) {
 
 				peers, err := sentryClient.SendMessageToAll(f.ctx, req65, &grpc.EmptyCallOption{})
 				if err != nil {
-					log.Warn("[txpool.send] BroadcastLocalPooledTxs", "err", err)
+					f.logger.Warn("[txpool.send] BroadcastLocalPooledTxs", "err", err)
 				}
 				avgPeersPerSent65 += len(peers.Peers)
 
-			case direct.ETH66:
+			case direct.ETH66, direct.ETH67:
 				if req66 == nil {
 					req66 = &sentry.OutboundMessageData{
 						Id:   sentry.MessageId_NEW_POOLED_TRANSACTION_HASHES_66,
@@ -113,13 +154,30 @@ func (f *Send) BroadcastLocalPooledTxs(txs Hashes) (sentToPeers int) {
 				}
 				peers, err := sentryClient.SendMessageToAll(f.ctx, req66, &grpc.EmptyCallOption{})
 				if err != nil {
-					log.Warn("[txpool.send] BroadcastLocalPooledTxs", "err", err)
+					f.logger.Warn("[txpool.send] BroadcastLocalPooledTxs", "err", err)
 				}
 				avgPeersPerSent66 += len(peers.Peers)
+
+			case direct.ETH68:
+				if req68 == nil {
+					req68 = &sentry.OutboundMessageData{
+						Id:   sentry.MessageId_NEW_POOLED_TRANSACTION_HASHES_68,
+						Data: f.announcements68(pending),
+					}
+				}
+				if len(req68.Data) == 0 {
+					continue
+				}
+				peers, err := sentryClient.SendMessageToAll(f.ctx, req68, &grpc.EmptyCallOption{})
+				if err != nil {
+					f.logger.Warn("[txpool.send] BroadcastLocalPooledTxs", "err", err)
+					continue
+				}
+				avgPeersPerSent68 += len(peers.Peers)
 			}
 		}
 	}
-	return avgPeersPerSent65 + avgPeersPerSent66
+	return avgPeersPerSent65 + avgPeersPerSent66 + avgPeersPerSent68
 }
 
 func (f *Send) BroadcastRemotePooledTxs(txs Hashes) {
@@ -139,12 +197,16 @@ func (f *Send) BroadcastRemotePooledTxs(txs Hashes) {
 			txs = txs[:0]
 		}
 
-		data := EncodeHashes(pending, nil)
-		var req66, req65 *sentry.SendMessageToRandomPeersRequest
+		legacy := f.legacyAnnouncements(pending)
+		data := EncodeHashes(legacy, nil)
+		var req66, req65, req68 *sentry.SendMessageToRandomPeersRequest
 		for _, sentryClient := range f.sentryClients {
 			//if !sentryClient.Ready() {
 			//	continue
 			//}
+			if len(legacy) == 0 && sentryClient.Protocol() < direct.ETH68 {
+				continue
+			}
 
 			switch sentryClient.Protocol() {
 			case direct.ETH65:
@@ -159,10 +221,10 @@ func (f *Send) BroadcastRemotePooledTxs(txs Hashes) {
 				}
 
 				if _, err := sentryClient.SendMessageToRandomPeers(f.ctx, req65, &grpc.EmptyCallOption{}); err != nil {
-					log.Warn("[txpool.send] BroadcastRemotePooledTxs", "err", err)
+					f.logger.Warn("[txpool.send] BroadcastRemotePooledTxs", "err", err)
 				}
 
-			case direct.ETH66:
+			case direct.ETH66, direct.ETH67:
 				if req66 == nil {
 					req66 = &sentry.SendMessageToRandomPeersRequest{
 						MaxPeers: 1024,
@@ -173,7 +235,24 @@ func (f *Send) BroadcastRemotePooledTxs(txs Hashes) {
 					}
 				}
 				if _, err := sentryClient.SendMessageToRandomPeers(f.ctx, req66, &grpc.EmptyCallOption{}); err != nil {
-					log.Warn("[txpool.send] BroadcastRemotePooledTxs", "err", err)
+					f.logger.Warn("[txpool.send] BroadcastRemotePooledTxs", "err", err)
+				}
+
+			case direct.ETH68:
+				if req68 == nil {
+					req68 = &sentry.SendMessageToRandomPeersRequest{
+						MaxPeers: 1024,
+						Data: &sentry.OutboundMessageData{
+							Id:   sentry.MessageId_NEW_POOLED_TRANSACTION_HASHES_68,
+							Data: f.announcements68(pending),
+						},
+					}
+				}
+				if len(req68.Data.Data) == 0 {
+					continue
+				}
+				if _, err := sentryClient.SendMessageToRandomPeers(f.ctx, req68, &grpc.EmptyCallOption{}); err != nil {
+					f.logger.Warn("[txpool.send] BroadcastRemotePooledTxs", "err", err)
 				}
 			}
 		}
@@ -197,11 +276,16 @@ func (f *Send) PropagatePooledTxsToPeersList(peers []PeerID, txs []byte) {
 			txs = txs[:0]
 		}
 
-		data := EncodeHashes(pending, nil)
+		legacy := f.legacyAnnouncements(pending)
+		data := EncodeHashes(legacy, nil)
+		var data68 []byte
 		for _, sentryClient := range f.sentryClients {
 			//if !sentryClient.Ready() {
 			//	continue
 			//}
+			if len(legacy) == 0 && sentryClient.Protocol() < direct.ETH68 {
+				continue
+			}
 
 			for _, peer := range peers {
 				switch sentryClient.Protocol() {
@@ -215,10 +299,10 @@ func (f *Send) PropagatePooledTxsToPeersList(peers []PeerID, txs []byte) {
 					}
 
 					if _, err := sentryClient.SendMessageById(f.ctx, req65, &grpc.EmptyCallOption{}); err != nil {
-						log.Warn("[txpool.send] PropagatePooledTxsToPeersList", "err", err)
+						f.logger.Warn("[txpool.send] PropagatePooledTxsToPeersList", "err", err)
 					}
 
-				case direct.ETH66:
+				case direct.ETH66, direct.ETH67:
 					req66 := &sentry.SendMessageByIdRequest{
 						PeerId: peer,
 						Data: &sentry.OutboundMessageData{
@@ -227,7 +311,25 @@ func (f *Send) PropagatePooledTxsToPeersList(peers []PeerID, txs []byte) {
 						},
 					}
 					if _, err := sentryClient.SendMessageById(f.ctx, req66, &grpc.EmptyCallOption{}); err != nil {
-						log.Warn("[txpool.send] PropagatePooledTxsToPeersList", "err", err)
+						f.logger.Warn("[txpool.send] PropagatePooledTxsToPeersList", "err", err)
+					}
+
+				case direct.ETH68:
+					if data68 == nil {
+						data68 = f.announcements68(pending)
+					}
+					if len(data68) == 0 {
+						continue
+					}
+					req68 := &sentry.SendMessageByIdRequest{
+						PeerId: peer,
+						Data: &sentry.OutboundMessageData{
+							Id:   sentry.MessageId_NEW_POOLED_TRANSACTION_HASHES_68,
+							Data: data68,
+						},
+					}
+					if _, err := sentryClient.SendMessageById(f.ctx, req68, &grpc.EmptyCallOption{}); err != nil {
+						f.logger.Warn("[txpool.send] PropagatePooledTxsToPeersList", "err", err)
 					}
 				}
 			}
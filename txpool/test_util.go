@@ -54,6 +54,17 @@ func (ms *MockSentry) Send(req *sentry.InboundMessage) (errs []error) {
 	return errs
 }
 
+func (ms *MockSentry) SendPeerEvent(req *sentry.PeersReply) (errs []error) {
+	ms.lock.RLock()
+	defer ms.lock.RUnlock()
+	for _, stream := range ms.peersStreams {
+		if err := stream.Send(req); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errs
+}
+
 func (ms *MockSentry) SetStatus(context.Context, *sentry.StatusData) (*sentry.SetStatusReply, error) {
 	return &sentry.SetStatusReply{}, nil
 }
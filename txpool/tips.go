@@ -0,0 +1,79 @@
+/*
+   Copyright 2021 Erigon contributors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package txpool
+
+import (
+	"sort"
+	"sync"
+)
+
+// tipStats - sorted paid tips of pending transactions, taken after each recalculation of best transactions.
+// Has own lock - fee suggestions don't wait for pool's lock
+type tipStats struct {
+	lock    sync.RWMutex
+	tips    []uint64 // ascending
+	baseFee uint64   // of pending block
+}
+
+func (s *tipStats) refresh(pending *PendingPool, baseFee uint64) {
+	tips := make([]uint64, len(pending.best))
+	for i, mt := range pending.best {
+		tips[i] = paidTip(mt.Tx, baseFee)
+	}
+	sort.Slice(tips, func(i, j int) bool { return tips[i] < tips[j] })
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.tips, s.baseFee = tips, baseFee
+}
+
+// paidTip - tip which transaction pays to miner with given base fee: min(tip, feeCap - baseFee)
+func paidTip(tx *TxSlot, baseFee uint64) uint64 {
+	if tx.feeCap <= baseFee {
+		return 0
+	}
+	return min(tx.tip, tx.feeCap-baseFee)
+}
+
+func (s *tipStats) percentile(percentile int) uint64 {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	if len(s.tips) == 0 {
+		return 0
+	}
+	if percentile < 0 {
+		percentile = 0
+	}
+	if percentile > 100 {
+		percentile = 100
+	}
+	return s.tips[(len(s.tips)-1)*percentile/100]
+}
+
+// SuggestTip - tip which pays given percentile (0..100) of pending transactions: with 100 transaction pays no less than
+// any pending one. Reflects current pressure on pool, unlike suggestions by history of blocks. 0 - pool has no pending transactions
+func (p *TxPool) SuggestTip(percentile int) uint64 {
+	return p.tips.percentile(percentile)
+}
+
+// SuggestFeeCap - feeCap for SuggestTip(percentile), which stays enough if base fee grows up to 2x of pending block's
+func (p *TxPool) SuggestFeeCap(percentile int) uint64 {
+	tip := p.tips.percentile(percentile)
+	p.tips.lock.RLock()
+	defer p.tips.lock.RUnlock()
+	return 2*p.tips.baseFee + tip
+}
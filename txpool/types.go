@@ -17,14 +17,20 @@
 package txpool
 
 import (
+	"bytes"
+	"crypto/sha256"
 	"encoding/binary"
 	"errors"
 	"fmt"
 	"hash"
 	"io"
+	"math/big"
 	"math/bits"
 
 	"github.com/holiman/uint256"
+	"github.com/ledgerwatch/erigon-lib/chain"
+	"github.com/ledgerwatch/erigon-lib/common"
+	"github.com/ledgerwatch/erigon-lib/common/errkind"
 	"github.com/ledgerwatch/erigon-lib/gointerfaces/types"
 	"github.com/ledgerwatch/erigon-lib/rlp"
 	"github.com/ledgerwatch/secp256k1"
@@ -38,12 +44,15 @@ type TxParseContext struct {
 	keccak1       hash.Hash
 	keccak2       hash.Hash
 	chainId, r, s uint256.Int // Signature values
+	v             uint256.Int // V of signature as in payload: of legacy transaction it includes chainId (EIP-155)
 	n27, n28, n35 uint256.Int
 	buf           [65]byte // buffer needs to be enough for hashes (32 bytes) and for public key (65 bytes)
 	sighash       [32]byte
 	sig           [65]byte
 	withSender    bool
 	reject        func([]byte) bool
+	blobProofs    func(blobs, commitments, proofs [][]byte) error
+	validChainID  func(chainID *uint256.Int) bool
 }
 
 func NewTxParseContext() *TxParseContext {
@@ -72,9 +81,18 @@ type TxSlot struct {
 	idHash      [32]byte    // Transaction hash for the purposes of using it as a transaction Id
 	senderID    uint64      // SenderID - require external mapping to it's address
 	creation    bool        // Set to true if "To" field of the transation is not set
+	to          [20]byte    // Destination address, zero for contract creation
 	dataLen     int         // Length of transaction's data (for calculation of intrinsic gas)
+	dataNonZero int         // Number of non-zero bytes of transaction's data
 	alAddrCount int         // Number of addresses in the access list
 	alStorCount int         // Number of storage keys in the access list
+	intrinsic   uint64      // Gas which transaction spends before execution, see IntrinsicGas
+	blobFeeCap  uint64      // Maximum fee per blob gas (EIP-4844), only for blob transactions
+	blobHashes  Hashes      // Versioned hashes of blobs (EIP-4844), only for blob transactions
+	withSidecar bool        // Blob transaction in network form: rlp contains blobs, commitments and proofs
+	size        uint32      // Size of rlp, without blobs sidecar
+	netSize     uint32      // Size of network encoding, with blobs sidecar - as announced by eth/68
+	txType      byte        // Type of transaction, as announced by eth/68
 	//bestIdx     int         // Index of the transaction in the best priority queue (of whatever pool it currently belongs to)
 	//worstIdx    int         // Index of the transaction in the worst priority queue (of whatever pook it currently belongs to)
 	//local       bool        // Whether transaction has been injected locally (and hence needs priority when mining or proposing a block)
@@ -86,14 +104,117 @@ const (
 	LegacyTxType     int = 0
 	AccessListTxType int = 1
 	DynamicFeeTxType int = 2
+	BlobTxType       int = 3
 )
 
+// EIP-4844
+const (
+	BlobSize           = 4096 * 32
+	BlobGasPerBlob     = 1 << 17
+	MaxBlobsPerTx      = 6
+	blobCommitmentSize = 48
+	blobProofSize      = 48
+	blobHashVersion    = 0x01 // first byte of versioned hash: KZG commitment
+)
+
+// Intrinsic gas
+const (
+	TxGas                     = 21000 // of transaction which is not contract creation
+	TxGasContractCreation     = 53000 // since Homestead, TxGas before
+	TxDataZeroGas             = 4     // per zero byte of data
+	TxDataNonZeroGasFrontier  = 68    // per non-zero byte of data, before Istanbul
+	TxDataNonZeroGas          = 16    // per non-zero byte of data, since Istanbul (EIP-2028)
+	TxAccessListAddressGas    = 2400  // access lists exist since Berlin (EIP-2930)
+	TxAccessListStorageKeyGas = 1900
+	InitCodeWordGas           = 2 // per 32-bytes word of data of contract creation, since Shanghai (EIP-3860)
+)
+
+// latestRules - all forks are active
+var latestRules = chain.Rules{ChainID: new(big.Int), IsHomestead: true, IsTangerineWhistle: true, IsSpuriousDragon: true,
+	IsByzantium: true, IsConstantinople: true, IsPetersburg: true, IsIstanbul: true,
+	IsBerlin: true, IsLondon: true, IsShanghai: true, IsCancun: true, IsPrague: true}
+
+// IntrinsicGas - gas which transaction spends before execution by given rules: transaction with lower gas limit is invalid
+func IntrinsicGas(dataLen, dataNonZero, alAddrCount, alStorCount int, creation bool, rules *chain.Rules) uint64 {
+	gas := uint64(TxGas)
+	if creation && rules.IsHomestead {
+		gas = TxGasContractCreation
+	}
+	if creation && rules.IsShanghai {
+		gas += InitCodeWordGas * uint64((dataLen+31)/32)
+	}
+	nonZeroGas := uint64(TxDataNonZeroGasFrontier)
+	if rules.IsIstanbul {
+		nonZeroGas = TxDataNonZeroGas
+	}
+	gas += TxDataZeroGas*uint64(dataLen-dataNonZero) + nonZeroGas*uint64(dataNonZero)
+	gas += TxAccessListAddressGas*uint64(alAddrCount) + TxAccessListStorageKeyGas*uint64(alStorCount)
+	return gas
+}
+
 const ParseTransactionErrorPrefix = "parse transaction payload"
 
 var ErrRejected = errors.New("rejected")
 
 func (ctx *TxParseContext) Reject(f func(hash []byte) bool) { ctx.reject = f }
-func (ctx *TxParseContext) WithSender(v bool)               { ctx.withSender = v }
+
+// WithSender - false: parse-only mode, for transactions of trusted sources - signature is not checked and sender is not
+// recovered (it's the most expensive part of parsing), sender argument of ParseTransaction may be nil. Reject is not called
+func (ctx *TxParseContext) WithSender(v bool) { ctx.withSender = v }
+
+// ChainIDs - only transactions signed for one of given chains are accepted, parsing of others fails with ChainIDError.
+// Legacy transactions without EIP-155 replay protection are not bound to any chain and are accepted
+func (ctx *TxParseContext) ChainIDs(ids ...uint64) {
+	if len(ids) == 0 {
+		ctx.validChainID = nil
+		return
+	}
+	valid := make(map[uint256.Int]struct{}, len(ids))
+	for _, id := range ids {
+		valid[*uint256.NewInt(id)] = struct{}{}
+	}
+	ctx.validChainID = func(chainID *uint256.Int) bool {
+		_, ok := valid[*chainID]
+		return ok
+	}
+}
+
+// ValidateChainID - the same as ChainIDs, but set of chains is decided by callback. It's called concurrently by ParallelParser
+func (ctx *TxParseContext) ValidateChainID(f func(chainID *uint256.Int) bool) { ctx.validChainID = f }
+
+// ChainIDError - transaction is signed for the chain, which is not accepted by TxParseContext
+type ChainIDError struct {
+	ChainID uint256.Int
+}
+
+func (e *ChainIDError) Error() string {
+	return fmt.Sprintf("unexpected chain id: %d", e.ChainID.ToBig())
+}
+
+// withKind - errors of ParseTransaction are errkind.InvalidEncoding, except oversized payload, rejected transaction and
+// transaction of other chain
+func withKind(err error) error {
+	var chainIDErr *ChainIDError
+	if err == nil || errkind.Of(err) != nil || errors.Is(err, ErrRejected) || errors.As(err, &chainIDErr) {
+		return err
+	}
+	return errkind.Wrap(errkind.InvalidEncoding, err)
+}
+
+func (ctx *TxParseContext) checkChainID() error {
+	if ctx.validChainID == nil || ctx.validChainID(&ctx.chainId) {
+		return nil
+	}
+	return fmt.Errorf("%s: %w", ParseTransactionErrorPrefix, &ChainIDError{ChainID: ctx.chainId})
+}
+
+// Signature - raw V, R, S of last parsed transaction, available also in parse-only mode
+func (ctx *TxParseContext) Signature() (v, r, s uint256.Int) { return ctx.v, ctx.r, ctx.s }
+
+// BlobProofs - verifier of KZG proofs of blob transactions sidecars. Without it only versioned hashes of commitments are checked
+func (ctx *TxParseContext) BlobProofs(f func(blobs, commitments, proofs [][]byte) error) {
+	ctx.blobProofs = f
+}
 
 // ParseTransaction extracts all the information from the transactions's payload (RLP) necessary to build TxSlot
 // it also performs syntactic validation of the transactions
@@ -110,7 +231,11 @@ func (ctx *TxParseContext) ParseTransaction(payload []byte, pos int, slot *TxSlo
 		// more expensive to propagate; larger transactions also take more resources
 		// to validate whether they fit into the pool or not.
 		txMaxSize = 4 * txSlotSize // 128KB
+
+		// blobTxMaxSize - blob transaction in network form also carries sidecar: blobs, commitments and proofs
+		blobTxMaxSize = txMaxSize + MaxBlobsPerTx*(BlobSize+blobCommitmentSize+blobProofSize+16)
 	)
+	defer func() { err = withKind(err) }()
 	if len(payload) == 0 {
 		return 0, fmt.Errorf("%s: empty rlp", ParseTransactionErrorPrefix)
 	}
@@ -126,8 +251,16 @@ func (ctx *TxParseContext) ParseTransaction(payload []byte, pos int, slot *TxSlo
 	if err != nil {
 		return 0, fmt.Errorf("%s: size Prefix: %v", ParseTransactionErrorPrefix, err)
 	}
-	if dataLen > txMaxSize {
-		return 0, fmt.Errorf("%s: too large tx.size=%dKb", ParseTransactionErrorPrefix, len(payload)/1024)
+	slot.netSize = uint32(dataLen) // typed transaction: type byte and payload, without wrapping rlp string
+	if legacy {
+		slot.netSize = uint32(dataPos + dataLen - pos)
+	}
+	maxSize := txMaxSize
+	if !legacy && dataLen > 0 && payload[dataPos] == byte(BlobTxType) {
+		maxSize = blobTxMaxSize
+	}
+	if dataLen > maxSize {
+		return 0, errkind.Errorf(errkind.TooBig, "%s: too large tx.size=%dKb", ParseTransactionErrorPrefix, len(payload)/1024)
 	}
 
 	//if dataPos+dataLen != len(payload) {
@@ -136,6 +269,7 @@ func (ctx *TxParseContext) ParseTransaction(payload []byte, pos int, slot *TxSlo
 	p = dataPos
 
 	var txType int
+	var wrapperEnd int // end of network form of blob transaction
 	// If it is non-legacy transaction, the transaction type follows, and then the the list
 	if !legacy {
 		txType = int(payload[p])
@@ -153,6 +287,21 @@ func (ctx *TxParseContext) ParseTransaction(payload []byte, pos int, slot *TxSlo
 		if err != nil {
 			return 0, fmt.Errorf("%s: envelope Prefix: %v", ParseTransactionErrorPrefix, err)
 		}
+		// Blob transaction in network form: rlp([tx_payload_body, blobs, commitments, proofs]), hash only the body
+		if txType == BlobTxType && dataLen > 0 {
+			_, _, isList, err := rlp.Prefix(payload, dataPos)
+			if err != nil {
+				return 0, fmt.Errorf("%s: blob tx body Prefix: %v", ParseTransactionErrorPrefix, err)
+			}
+			if isList {
+				wrapperEnd = dataPos + dataLen
+				p = dataPos
+				dataPos, dataLen, err = rlp.List(payload, p)
+				if err != nil {
+					return 0, fmt.Errorf("%s: blob tx body Prefix: %v", ParseTransactionErrorPrefix, err)
+				}
+			}
+		}
 		// Hash the envelope, not the full payload
 		if _, err = ctx.keccak1.Write(payload[p : dataPos+dataLen]); err != nil {
 			return 0, fmt.Errorf("%s: computing idHash (hashing the envelope): %w", ParseTransactionErrorPrefix, err)
@@ -160,16 +309,25 @@ func (ctx *TxParseContext) ParseTransaction(payload []byte, pos int, slot *TxSlo
 		p = dataPos
 	}
 	slot.rlp = payload[pos : dataPos+dataLen]
+	slot.size = uint32(len(slot.rlp))
+	slot.withSidecar = wrapperEnd > 0
+	slot.txType = byte(txType)
+	if slot.withSidecar {
+		slot.rlp = payload[pos:wrapperEnd]
+	}
+	slot.blobFeeCap, slot.blobHashes = 0, slot.blobHashes[:0]
 
 	// Remember where signing hash data begins (it will need to be wrapped in an RLP list)
 	sigHashPos := p
-	// If it is non-legacy tx, chainId follows, but we skip it
+	// If it is non-legacy tx, chainId follows
 	if !legacy {
-		dataPos, dataLen, err = rlp.String(payload, p)
+		p, err = rlp.U256(payload, p, &ctx.chainId)
 		if err != nil {
 			return 0, fmt.Errorf("%s: chainId len: %w", ParseTransactionErrorPrefix, err)
 		}
-		p = dataPos + dataLen
+		if err = ctx.checkChainID(); err != nil {
+			return 0, err
+		}
 	}
 	// Next follows the nonce, which we need to parse
 	p, slot.nonce, err = rlp.U64(payload, p)
@@ -206,22 +364,32 @@ func (ctx *TxParseContext) ParseTransaction(payload []byte, pos int, slot *TxSlo
 	if dataLen != 0 && dataLen != 20 {
 		return 0, fmt.Errorf("%s: unexpected length of to field: %d", ParseTransactionErrorPrefix, dataLen)
 	}
-	// Only note if To field is empty or not
 	slot.creation = dataLen == 0
+	slot.to = [20]byte{}
+	copy(slot.to[:], payload[dataPos:dataPos+dataLen])
+	if slot.creation && txType == BlobTxType {
+		return 0, fmt.Errorf("%s: blob transaction can't create contract", ParseTransactionErrorPrefix)
+	}
 	p = dataPos + dataLen
 	// Next follows value
 	p, err = rlp.U256(payload, p, &slot.value)
 	if err != nil {
 		return 0, fmt.Errorf("%s: value: %w", ParseTransactionErrorPrefix, err)
 	}
-	// Next goes data, but we are only interesting in its length
+	// Next goes data, but we are only interesting in its length and amount of non-zero bytes
 	dataPos, dataLen, err = rlp.String(payload, p)
 	if err != nil {
 		return 0, fmt.Errorf("%s: data len: %w", ParseTransactionErrorPrefix, err)
 	}
-	slot.dataLen = dataLen
+	slot.dataLen, slot.dataNonZero = dataLen, 0
+	for _, b := range payload[dataPos : dataPos+dataLen] {
+		if b != 0 {
+			slot.dataNonZero++
+		}
+	}
 	p = dataPos + dataLen
 	// Next follows access list for non-legacy transactions, we are only interesting in number of addresses and storage keys
+	slot.alAddrCount, slot.alStorCount = 0, 0
 	if !legacy {
 		dataPos, dataLen, err = rlp.List(payload, p)
 		if err != nil {
@@ -255,6 +423,9 @@ func (ctx *TxParseContext) ParseTransaction(payload []byte, pos int, slot *TxSlo
 				skeyPos += 32
 			}
 			if skeyPos != storagePos+storageLen {
+				return 0, fmt.Errorf("%s: extraneous space in the storage key list", ParseTransactionErrorPrefix)
+			}
+			if storagePos+storageLen != tuplePos+tupleLen {
 				return 0, fmt.Errorf("%s: extraneous space in the tuple after storage key list", ParseTransactionErrorPrefix)
 			}
 			tuplePos += tupleLen
@@ -264,6 +435,36 @@ func (ctx *TxParseContext) ParseTransaction(payload []byte, pos int, slot *TxSlo
 		}
 		p = dataPos + dataLen
 	}
+	// Next follows fee cap of blob gas and versioned hashes of blobs, for blob transactions
+	if txType == BlobTxType {
+		p, slot.blobFeeCap, err = rlp.U64(payload, p)
+		if err != nil {
+			return 0, fmt.Errorf("%s: blob feeCap: %w", ParseTransactionErrorPrefix, err)
+		}
+		dataPos, dataLen, err = rlp.List(payload, p)
+		if err != nil {
+			return 0, fmt.Errorf("%s: blob hashes len: %w", ParseTransactionErrorPrefix, err)
+		}
+		hashPos := dataPos
+		for hashPos < dataPos+dataLen {
+			hashPos, err = rlp.StringOfLen(payload, hashPos, 32)
+			if err != nil {
+				return 0, fmt.Errorf("%s: blob hash len: %w", ParseTransactionErrorPrefix, err)
+			}
+			if payload[hashPos] != blobHashVersion {
+				return 0, fmt.Errorf("%s: unsupported version of blob hash: %d", ParseTransactionErrorPrefix, payload[hashPos])
+			}
+			slot.blobHashes = append(slot.blobHashes, payload[hashPos:hashPos+32]...)
+			hashPos += 32
+		}
+		if hashPos != dataPos+dataLen {
+			return 0, fmt.Errorf("%s: extraneous space in the blob hashes", ParseTransactionErrorPrefix)
+		}
+		if n := slot.blobHashes.Len(); n == 0 || n > MaxBlobsPerTx {
+			return 0, fmt.Errorf("%s: blob transaction must have from 1 to %d blobs, got %d", ParseTransactionErrorPrefix, MaxBlobsPerTx, n)
+		}
+		p = dataPos + dataLen
+	}
 	// This is where the data for sighash ends
 	// Next follows V of the signature
 	var vByte byte
@@ -275,6 +476,7 @@ func (ctx *TxParseContext) ParseTransaction(payload []byte, pos int, slot *TxSlo
 		if err != nil {
 			return 0, fmt.Errorf("%s: V: %w", ParseTransactionErrorPrefix, err)
 		}
+		ctx.v.Set(&ctx.chainId)
 		// Compute chainId from V
 		if ctx.chainId.Eq(&ctx.n27) || ctx.chainId.Eq(&ctx.n28) {
 			// Do not add chain id and two extra zeros
@@ -283,6 +485,9 @@ func (ctx *TxParseContext) ParseTransaction(payload []byte, pos int, slot *TxSlo
 			ctx.chainId.Sub(&ctx.chainId, &ctx.n35)
 			vByte = byte(1 - (ctx.chainId.Uint64() & 1))
 			ctx.chainId.Rsh(&ctx.chainId, 1)
+			if err = ctx.checkChainID(); err != nil {
+				return 0, err
+			}
 			chainIdBits = ctx.chainId.BitLen()
 			if chainIdBits <= 7 {
 				chainIdLen = 1
@@ -303,6 +508,7 @@ func (ctx *TxParseContext) ParseTransaction(payload []byte, pos int, slot *TxSlo
 			return 0, fmt.Errorf("%s: V is loo large: %d", ParseTransactionErrorPrefix, v)
 		}
 		vByte = byte(v)
+		ctx.v.SetUint64(v)
 	}
 	// Next follows R of the signature
 	p, err = rlp.U256(payload, p, &ctx.r)
@@ -314,6 +520,12 @@ func (ctx *TxParseContext) ParseTransaction(payload []byte, pos int, slot *TxSlo
 	if err != nil {
 		return 0, fmt.Errorf("%s: S: %w", ParseTransactionErrorPrefix, err)
 	}
+	// Sidecar of blob transaction in network form
+	if slot.withSidecar {
+		if p, err = ctx.parseBlobSidecar(payload, p, wrapperEnd, slot.blobHashes); err != nil {
+			return 0, err
+		}
+	}
 	// For legacy transactions, hash the full payload
 	if legacy {
 		if _, err = ctx.keccak1.Write(payload[pos:p]); err != nil {
@@ -401,6 +613,52 @@ func (ctx *TxParseContext) ParseTransaction(payload []byte, pos int, slot *TxSlo
 	return p, nil
 }
 
+// parseBlobSidecar - parses blobs, commitments and proofs, checks that commitments match versioned hashes
+func (ctx *TxParseContext) parseBlobSidecar(payload []byte, pos, end int, blobHashes Hashes) (int, error) {
+	var lists [3][][]byte
+	sizes := [3]int{BlobSize, blobCommitmentSize, blobProofSize}
+	names := [3]string{"blobs", "commitments", "proofs"}
+	for i := range lists {
+		if pos >= end {
+			return 0, fmt.Errorf("%s: unexpected end of blob sidecar, expected %s", ParseTransactionErrorPrefix, names[i])
+		}
+		dataPos, dataLen, err := rlp.List(payload, pos)
+		if err != nil {
+			return 0, fmt.Errorf("%s: %s len: %w", ParseTransactionErrorPrefix, names[i], err)
+		}
+		for itemPos := dataPos; itemPos < dataPos+dataLen; itemPos += sizes[i] {
+			itemPos, err = rlp.StringOfLen(payload, itemPos, sizes[i])
+			if err != nil {
+				return 0, fmt.Errorf("%s: %s item len: %w", ParseTransactionErrorPrefix, names[i], err)
+			}
+			lists[i] = append(lists[i], payload[itemPos:itemPos+sizes[i]])
+		}
+		if len(lists[i]) != blobHashes.Len() {
+			return 0, fmt.Errorf("%s: amount of %s %d doesn't match amount of blob hashes %d", ParseTransactionErrorPrefix, names[i], len(lists[i]), blobHashes.Len())
+		}
+		pos = dataPos + dataLen
+	}
+	if pos != end {
+		return 0, fmt.Errorf("%s: extraneous space in blob sidecar", ParseTransactionErrorPrefix)
+	}
+	for i, commitment := range lists[1] {
+		h := sha256.Sum256(commitment)
+		h[0] = blobHashVersion
+		if !bytes.Equal(h[:], blobHashes.At(i)) {
+			return 0, fmt.Errorf("%s: commitment %d doesn't match blob hash %x", ParseTransactionErrorPrefix, i, blobHashes.At(i))
+		}
+	}
+	if ctx.blobProofs != nil {
+		if err := ctx.blobProofs(lists[0], lists[1], lists[2]); err != nil {
+			return 0, fmt.Errorf("%s: blob proofs: %w", ParseTransactionErrorPrefix, err)
+		}
+	}
+	return end, nil
+}
+
+// blobGas - amount of blob gas used by transaction (EIP-4844)
+func (tx *TxSlot) blobGas() uint64 { return uint64(tx.blobHashes.Len()) * BlobGasPerBlob }
+
 type PeerID *types.H512
 
 type Hashes []byte // flatten list of 32-byte hashes
@@ -408,6 +666,9 @@ type Hashes []byte // flatten list of 32-byte hashes
 func (h Hashes) At(i int) []byte { return h[i*32 : (i+1)*32] }
 func (h Hashes) Len() int        { return len(h) / 32 }
 
+// Hash - i-th hash as value
+func (h Hashes) Hash(i int) common.Hash { return common.BytesToHash(h.At(i)) }
+
 type Addresses []byte // flatten list of 20-byte addresses
 
 func (h Addresses) At(i int) []byte { return h[i*20 : (i+1)*20] }
@@ -18,11 +18,21 @@ package txpool
 
 import (
 	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
 	"fmt"
+	"strings"
 	"testing"
 
+	"github.com/holiman/uint256"
+	"github.com/ledgerwatch/erigon-lib/chain"
+	"github.com/ledgerwatch/erigon-lib/common/errkind"
+	"github.com/ledgerwatch/erigon-lib/rlp"
+	"github.com/ledgerwatch/secp256k1"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/sha3"
 )
 
 var txParseTests = []struct {
@@ -113,3 +123,271 @@ func TestTxSlotsGrowth(t *testing.T) {
 	assert.Equal(2, len(s.txs))
 	assert.Equal(2, s.senders.Len())
 }
+
+func rlpPrefix(dataLen int, short byte) []byte {
+	if dataLen < 56 {
+		return []byte{short + byte(dataLen)}
+	}
+	var be [8]byte
+	binary.BigEndian.PutUint64(be[:], uint64(dataLen))
+	i := 0
+	for be[i] == 0 {
+		i++
+	}
+	return append([]byte{short + 55 + byte(8-i)}, be[i:]...)
+}
+func rlpString(b []byte) []byte {
+	if len(b) == 1 && b[0] < 128 {
+		return b
+	}
+	return append(rlpPrefix(len(b), 128), b...)
+}
+func rlpU64(v uint64) []byte {
+	var be [8]byte
+	binary.BigEndian.PutUint64(be[:], v)
+	i := 0
+	for i < 8 && be[i] == 0 {
+		i++
+	}
+	return rlpString(be[i:])
+}
+func rlpList(items ...[]byte) []byte {
+	var data []byte
+	for _, item := range items {
+		data = append(data, item...)
+	}
+	return append(rlpPrefix(len(data), 192), data...)
+}
+func keccak(data ...[]byte) []byte {
+	h := sha3.NewLegacyKeccak256()
+	for _, d := range data {
+		h.Write(d)
+	}
+	return h.Sum(nil)
+}
+
+var testKey = decodeHex("b71c71a67e1177ad4e901695e1b4b9ee17ae16c6668d313eac2f96dbcda3f291")
+
+func testKeyAddr() []byte {
+	x, y := secp256k1.S256().ScalarBaseMult(testKey)
+	pub := make([]byte, 64)
+	x.FillBytes(pub[:32])
+	y.FillBytes(pub[32:])
+	return keccak(pub)[12:]
+}
+
+// blobTx - signed by testKey blob transaction, in network form (with sidecar) if withSidecar.
+// Returns payload as in p2p messages (rlp string) and commitments
+func blobTx(t *testing.T, nonce uint64, blobs int, withSidecar bool) []byte {
+	var hashes, blobList, commitments, proofs [][]byte
+	for i := 0; i < blobs; i++ {
+		commitment := bytes.Repeat([]byte{byte(nonce), byte(i + 1)}, blobCommitmentSize/2)
+		h := sha256.Sum256(commitment)
+		h[0] = blobHashVersion
+		hashes = append(hashes, rlpString(h[:]))
+		blobList = append(blobList, rlpString(make([]byte, BlobSize)))
+		commitments = append(commitments, rlpString(commitment))
+		proofs = append(proofs, rlpString(make([]byte, blobProofSize)))
+	}
+	fields := [][]byte{rlpU64(1), rlpU64(nonce), rlpU64(10), rlpU64(100), rlpU64(21000), rlpString(bytes.Repeat([]byte{0xaa}, 20)),
+		rlpU64(0), rlpString(nil), rlpList(), rlpU64(7), rlpList(hashes...)}
+	sig, err := secp256k1.Sign(keccak([]byte{byte(BlobTxType)}, rlpList(fields...)), testKey)
+	require.NoError(t, err)
+	fields = append(fields, rlpU64(uint64(sig[64])), rlpString(bytes.TrimLeft(sig[:32], "\x00")), rlpString(bytes.TrimLeft(sig[32:64], "\x00")))
+	envelope := rlpList(fields...)
+	if withSidecar {
+		envelope = rlpList(envelope, rlpList(blobList...), rlpList(commitments...), rlpList(proofs...))
+	}
+	return rlpString(append([]byte{byte(BlobTxType)}, envelope...))
+}
+
+func TestParseBlobTransaction(t *testing.T) {
+	require := require.New(t)
+	ctx := NewTxParseContext()
+	tx, sender := &TxSlot{}, [20]byte{}
+
+	canonical := blobTx(t, 1, 2, false)
+	p, err := ctx.ParseTransaction(canonical, 0, tx, sender[:])
+	require.NoError(err)
+	require.Equal(len(canonical), p)
+	require.Equal(testKeyAddr(), sender[:])
+	require.False(tx.withSidecar)
+	require.Equal(2, tx.blobHashes.Len())
+	require.Equal(uint64(7), tx.blobFeeCap)
+	require.Equal(uint64(2*BlobGasPerBlob), tx.blobGas())
+	require.Equal(bytes.Repeat([]byte{0xaa}, 20), tx.to[:])
+	idHash := tx.idHash
+
+	network := blobTx(t, 1, 2, true)
+	var proofsChecked int
+	ctx.BlobProofs(func(blobs, commitments, proofs [][]byte) error {
+		proofsChecked = len(proofs)
+		return nil
+	})
+	p, err = ctx.ParseTransaction(network, 0, tx, sender[:])
+	require.NoError(err)
+	require.Equal(len(network), p)
+	require.Equal(testKeyAddr(), sender[:])
+	require.True(tx.withSidecar)
+	require.Equal(idHash, tx.idHash) // sidecar is not part of transaction
+	require.Equal(network, tx.rlp)
+	require.Equal(2, proofsChecked)
+	require.Equal(byte(BlobTxType), tx.txType)
+	_, dataLen, err := rlp.String(network, 0)
+	require.NoError(err)
+	require.Equal(uint32(dataLen), tx.netSize) // announced size has no rlp string prefix
+
+	ctx.BlobProofs(func(blobs, commitments, proofs [][]byte) error { return fmt.Errorf("invalid proof") })
+	_, err = ctx.ParseTransaction(network, 0, tx, sender[:])
+	require.Error(err)
+	ctx.BlobProofs(nil)
+
+	// commitment doesn't match versioned hash
+	broken := append([]byte{}, network...)
+	broken[len(broken)-2*(blobProofSize+1)-3] ^= 1
+	_, err = ctx.ParseTransaction(broken, 0, tx, sender[:])
+	require.Error(err)
+
+	_, err = ctx.ParseTransaction(blobTx(t, 1, 0, false), 0, tx, sender[:])
+	require.Error(err)
+	_, err = ctx.ParseTransaction(blobTx(t, 1, MaxBlobsPerTx+1, false), 0, tx, sender[:])
+	require.Error(err)
+
+	// slot reused by other type of transaction
+	_, err = ctx.ParseTransaction(decodeHex(txParseTests[2].payloadStr), 0, tx, sender[:])
+	require.NoError(err)
+	require.False(tx.withSidecar)
+	require.Zero(tx.blobHashes.Len())
+}
+
+func TestIntrinsicGas(t *testing.T) {
+	require := require.New(t)
+	ctx := NewTxParseContext()
+	tx, sender := &TxSlot{}, [20]byte{}
+	_, err := ctx.ParseTransaction(decodeHex(txParseTests[6].payloadStr), 0, tx, sender[:])
+	require.NoError(err)
+	require.Equal([]int{1, 2}, []int{tx.alAddrCount, tx.alStorCount})
+	require.Equal(uint64(TxGas+TxAccessListAddressGas+2*TxAccessListStorageKeyGas),
+		IntrinsicGas(tx.dataLen, tx.dataNonZero, tx.alAddrCount, tx.alStorCount, tx.creation, &latestRules))
+
+	// slot is reused by transaction without access list
+	_, err = ctx.ParseTransaction(decodeHex(txParseTests[0].payloadStr), 0, tx, sender[:])
+	require.NoError(err)
+	require.Zero(tx.alAddrCount + tx.alStorCount)
+
+	require.Equal(uint64(TxGas+3*TxDataZeroGas+2*TxDataNonZeroGas), IntrinsicGas(5, 2, 0, 0, false, &latestRules))
+	require.Equal(uint64(TxGasContractCreation+2*InitCodeWordGas+33*TxDataNonZeroGas), IntrinsicGas(33, 33, 0, 0, true, &latestRules))
+	// forks of intrinsic gas
+	frontier, istanbul := chain.Rules{}, chain.Rules{IsHomestead: true, IsIstanbul: true}
+	require.Equal(uint64(TxGas+33*TxDataNonZeroGasFrontier), IntrinsicGas(33, 33, 0, 0, true, &frontier))
+	require.Equal(uint64(TxGasContractCreation+33*TxDataNonZeroGas), IntrinsicGas(33, 33, 0, 0, true, &istanbul))
+
+	txs, reasons := TxSlots{}, make([]DiscardReason, 2)
+	txs.Append(&TxSlot{gas: 21000}, sender[:], false)
+	txs.Append(&TxSlot{gas: 21000, dataLen: 1, dataNonZero: 1}, sender[:], false)
+	checkIntrinsicGas(txs, reasons, &latestRules)
+	require.Equal([]DiscardReason{0, IntrinsicGasTooLow}, reasons)
+	require.Equal(uint64(21016), txs.txs[1].intrinsic)
+}
+
+func TestParseAccessListTuple(t *testing.T) {
+	ctx := NewTxParseContext()
+	ctx.WithSender(false)
+	// access list of txParseTests[6] with extra element in the tuple after storage keys
+	payload := strings.Replace(txParseTests[6].payloadStr, "b8d202f8cf", "b8d302f8d0", 1)
+	payload = strings.Replace(payload, "f85bf859", "f85cf85a", 1)
+	payload = strings.Replace(payload, "0780a0f73d", "078080a0f73d", 1)
+	_, err := ctx.ParseTransaction(decodeHex(payload), 0, &TxSlot{}, nil)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "extraneous space in the tuple after storage key list")
+}
+
+func TestParseWithoutSender(t *testing.T) {
+	require := require.New(t)
+	ctx, parseOnly := NewTxParseContext(), NewTxParseContext()
+	parseOnly.WithSender(false)
+	for i, tt := range txParseTests {
+		payload := decodeHex(tt.payloadStr)
+		tx, sender := &TxSlot{}, [20]byte{}
+		_, err := ctx.ParseTransaction(payload, 0, tx, sender[:])
+		require.NoError(err, i)
+		v, r, s := ctx.Signature()
+
+		tx2 := &TxSlot{}
+		_, err = parseOnly.ParseTransaction(payload, 0, tx2, nil)
+		require.NoError(err, i)
+		require.Equal(tx.idHash, tx2.idHash, i)
+		v2, r2, s2 := parseOnly.Signature()
+		require.Equal(v, v2, i)
+		require.Equal(r, r2, i)
+		require.Equal(s, s2, i)
+		require.False(r2.IsZero(), i)
+	}
+
+	// V of legacy transaction is returned as in payload
+	_, err := parseOnly.ParseTransaction(decodeHex(txParseTests[0].payloadStr), 0, &TxSlot{}, nil)
+	require.NoError(err)
+	v, _, _ := parseOnly.Signature()
+	require.True(v.Uint64() == 27 || v.Uint64() == 28 || v.Uint64() >= 35)
+}
+
+func TestChainIDs(t *testing.T) {
+	require := require.New(t)
+	ctx := NewTxParseContext()
+	parse := func(i int) error {
+		tx, sender := &TxSlot{}, [20]byte{}
+		_, err := ctx.ParseTransaction(decodeHex(txParseTests[i].payloadStr), 0, tx, sender[:])
+		return err
+	}
+
+	ctx.ChainIDs(123)
+	for _, i := range []int{0, 1, 2, 3, 4, 6} { // unprotected legacy transactions are accepted by any chain
+		require.NoError(parse(i), i)
+	}
+	var chainErr *ChainIDError
+	require.True(errors.As(parse(5), &chainErr))
+	require.Equal(uint64(1), chainErr.ChainID.Uint64())
+
+	ctx.ChainIDs(1, 5)
+	require.NoError(parse(5))
+	require.True(errors.As(parse(1), &chainErr)) // EIP-155 legacy
+	require.Equal(uint64(123), chainErr.ChainID.Uint64())
+	require.True(errors.As(parse(2), &chainErr))
+
+	// parse-only mode validates chain id too
+	ctx.WithSender(false)
+	require.True(errors.As(parse(6), &chainErr))
+	ctx.WithSender(true)
+
+	ctx.ValidateChainID(func(chainID *uint256.Int) bool { return chainID.Uint64() > 100 })
+	require.NoError(parse(6))
+	require.Error(parse(5))
+
+	ctx.ChainIDs()
+	for i := range txParseTests {
+		require.NoError(parse(i), i)
+	}
+}
+
+func TestParseErrorKinds(t *testing.T) {
+	require := require.New(t)
+	ctx := NewTxParseContext()
+	parse := func(payload []byte) error {
+		tx, sender := &TxSlot{}, [20]byte{}
+		_, err := ctx.ParseTransaction(payload, 0, tx, sender[:])
+		return err
+	}
+	for _, payload := range [][]byte{{}, {0xc2, 0xc0, 0xc0}, {0x02, 0x80}} {
+		require.True(errors.Is(parse(payload), errkind.InvalidEncoding), "%x", payload)
+	}
+	tooLarge := append([]byte{0xfa, 0x03, 0x00, 0x00}, make([]byte, 0x030000)...)
+	err := parse(tooLarge)
+	require.True(errors.Is(err, errkind.TooBig), "%v", err)
+	require.False(errors.Is(err, errkind.InvalidEncoding))
+
+	ctx.ChainIDs(123)
+	err = parse(decodeHex(txParseTests[5].payloadStr))
+	var chainErr *ChainIDError
+	require.True(errors.As(err, &chainErr))
+	require.Nil(errkind.Of(err))
+}
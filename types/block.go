@@ -0,0 +1,271 @@
+/*
+   Copyright 2021 Erigon contributors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+// Package types contains zero-allocation parsers of RLP-encoded chain data: they don't decode objects,
+// but find positions of the parts in payload - for indexing and re-serialization without copying
+package types
+
+import (
+	"fmt"
+
+	"github.com/ledgerwatch/erigon-lib/rlp"
+)
+
+const (
+	ParseBodyErrorPrefix     = "parse block body"
+	ParseReceiptsErrorPrefix = "parse receipts"
+)
+
+// Span - position and length of an item in payload
+type Span struct {
+	Pos, Len int
+}
+
+// Of - bytes of the item in payload
+func (s Span) Of(payload []byte) []byte { return payload[s.Pos : s.Pos+s.Len] }
+
+// TxSpan - canonical encoding of transaction in payload: rlp list for legacy transactions, type byte followed
+// by rlp list for typed ones (without string prefix of block body). Transaction hash is keccak256 of it
+type TxSpan struct {
+	Span
+	Type byte
+}
+
+// Body - positions of block body parts, slices are reused by subsequent ParseBody calls
+type Body struct {
+	Txs            []TxSpan
+	Uncles         []Span // encoded headers, including list prefix
+	Withdrawals    []Span // encoded withdrawals, including list prefix
+	HasWithdrawals bool   // false for pre-Shanghai bodies, which have no withdrawals list
+}
+
+func (b *Body) Reset() {
+	b.Txs, b.Uncles, b.Withdrawals, b.HasWithdrawals = b.Txs[:0], b.Uncles[:0], b.Withdrawals[:0], false
+}
+
+// Receipt - positions and consensus fields of a receipt
+type Receipt struct {
+	Span                     // canonical encoding, the same way as TxSpan
+	Type              byte   // 0 for legacy receipts
+	Status            uint64 // 0 for pre-Byzantium receipts, which have PostState instead
+	PostState         Span   // zero for post-Byzantium receipts
+	CumulativeGasUsed uint64
+	Bloom             Span
+	Logs              Span // list of logs, including list prefix
+	LogsCount         int
+}
+
+// item - parses prefix of rlp item and checks that it fits in payload
+func item(payload []byte, pos int) (dataPos, dataLen int, isList bool, err error) {
+	if pos >= len(payload) {
+		return 0, 0, false, fmt.Errorf("unexpected end of payload")
+	}
+	// length of long items must fit in payload too
+	if first := int(payload[pos]); (first >= 0xb8 && first < 0xc0 && pos+first-0xb7 >= len(payload)) ||
+		(first >= 0xf8 && pos+first-0xf7 >= len(payload)) {
+		return 0, 0, false, fmt.Errorf("unexpected end of payload")
+	}
+	dataPos, dataLen, isList, err = rlp.Prefix(payload, pos)
+	if err != nil {
+		return 0, 0, false, err
+	}
+	if dataLen < 0 || dataPos+dataLen > len(payload) {
+		return 0, 0, false, fmt.Errorf("unexpected end of payload")
+	}
+	return dataPos, dataLen, isList, nil
+}
+
+// typed - parses either legacy (list) or typed (string with type byte and list) encoding
+func typed(payload []byte, pos int) (s Span, txType byte, end int, err error) {
+	dataPos, dataLen, isList, err := item(payload, pos)
+	if err != nil {
+		return Span{}, 0, 0, err
+	}
+	end = dataPos + dataLen
+	if isList {
+		return Span{Pos: pos, Len: end - pos}, 0, end, nil
+	}
+	if dataLen == 0 || payload[dataPos] > 0x7f {
+		return Span{}, 0, 0, fmt.Errorf("expected type byte of typed envelope")
+	}
+	if listEnd, err := skipList(payload[:end], dataPos+1); err != nil || listEnd != end {
+		return Span{}, 0, 0, fmt.Errorf("expected list after type byte of typed envelope")
+	}
+	return Span{Pos: dataPos, Len: dataLen}, payload[dataPos], end, nil
+}
+
+// ParseBody - parses block body [transactions, uncles, withdrawals?] at given position, returns position after it
+func ParseBody(payload []byte, pos int, body *Body) (int, error) {
+	body.Reset()
+	dataPos, dataLen, err := list(payload, pos)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", ParseBodyErrorPrefix, err)
+	}
+	end := dataPos + dataLen
+
+	p, txsLen, err := list(payload, dataPos)
+	if err != nil {
+		return 0, fmt.Errorf("%s: transactions: %w", ParseBodyErrorPrefix, err)
+	}
+	for txsEnd := p + txsLen; p < txsEnd; {
+		var tx TxSpan
+		if tx.Span, tx.Type, p, err = typed(payload[:txsEnd], p); err != nil {
+			return 0, fmt.Errorf("%s: transaction %d: %w", ParseBodyErrorPrefix, len(body.Txs), err)
+		}
+		body.Txs = append(body.Txs, tx)
+	}
+
+	if body.Uncles, p, err = lists(payload[:end], p, body.Uncles); err != nil {
+		return 0, fmt.Errorf("%s: uncles: %w", ParseBodyErrorPrefix, err)
+	}
+	if p < end {
+		body.HasWithdrawals = true
+		if body.Withdrawals, p, err = lists(payload[:end], p, body.Withdrawals); err != nil {
+			return 0, fmt.Errorf("%s: withdrawals: %w", ParseBodyErrorPrefix, err)
+		}
+	}
+	if p != end {
+		return 0, fmt.Errorf("%s: unexpected items after withdrawals", ParseBodyErrorPrefix)
+	}
+	return end, nil
+}
+
+// ParseReceipts - parses list of receipts of one block at given position, returns position after it
+func ParseReceipts(payload []byte, pos int, receipts *[]Receipt) (int, error) {
+	*receipts = (*receipts)[:0]
+	dataPos, dataLen, err := list(payload, pos)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", ParseReceiptsErrorPrefix, err)
+	}
+	end := dataPos + dataLen
+	for p := dataPos; p < end; {
+		var r Receipt
+		if p, err = parseReceipt(payload[:end], p, &r); err != nil {
+			return 0, fmt.Errorf("%s: receipt %d: %w", ParseReceiptsErrorPrefix, len(*receipts), err)
+		}
+		*receipts = append(*receipts, r)
+	}
+	return end, nil
+}
+
+func parseReceipt(payload []byte, pos int, r *Receipt) (int, error) {
+	var end int
+	var err error
+	if r.Span, r.Type, end, err = typed(payload, pos); err != nil {
+		return 0, err
+	}
+	p := r.Pos
+	if r.Type != 0 {
+		p++
+	}
+	dataPos, dataLen, err := list(payload[:end], p)
+	if err != nil {
+		return 0, err
+	}
+	if dataPos+dataLen != end {
+		return 0, fmt.Errorf("unexpected data after receipt")
+	}
+
+	payload = payload[:end]
+	statusPos, statusLen, err := str(payload, dataPos)
+	if err != nil {
+		return 0, fmt.Errorf("status: %w", err)
+	}
+	if statusLen == 32 {
+		r.PostState = Span{Pos: statusPos, Len: statusLen}
+		p = statusPos + statusLen
+	} else if p, r.Status, err = rlp.U64(payload, dataPos); err != nil {
+		return 0, fmt.Errorf("status: %w", err)
+	}
+	if _, _, err = str(payload, p); err != nil {
+		return 0, fmt.Errorf("cumulative gas used: %w", err)
+	}
+	if p, r.CumulativeGasUsed, err = rlp.U64(payload, p); err != nil {
+		return 0, fmt.Errorf("cumulative gas used: %w", err)
+	}
+	bloomPos, bloomLen, err := str(payload, p)
+	if err != nil {
+		return 0, fmt.Errorf("bloom: %w", err)
+	}
+	if bloomLen != 256 {
+		return 0, fmt.Errorf("bloom: expected string of len 256, got %d", bloomLen)
+	}
+	r.Bloom = Span{Pos: bloomPos, Len: bloomLen}
+	p = bloomPos + bloomLen
+
+	logsPos, logsLen, err := list(payload, p)
+	if err != nil {
+		return 0, fmt.Errorf("logs: %w", err)
+	}
+	r.Logs = Span{Pos: p, Len: logsPos + logsLen - p}
+	for p = logsPos; p < logsPos+logsLen; r.LogsCount++ {
+		if p, err = skipList(payload[:logsPos+logsLen], p); err != nil {
+			return 0, fmt.Errorf("log %d: %w", r.LogsCount, err)
+		}
+	}
+	if p != end {
+		return 0, fmt.Errorf("unexpected items after logs")
+	}
+	return end, nil
+}
+
+func list(payload []byte, pos int) (dataPos, dataLen int, err error) {
+	dataPos, dataLen, isList, err := item(payload, pos)
+	if err != nil {
+		return 0, 0, err
+	}
+	if !isList {
+		return 0, 0, fmt.Errorf("must be a list")
+	}
+	return dataPos, dataLen, nil
+}
+
+func str(payload []byte, pos int) (dataPos, dataLen int, err error) {
+	dataPos, dataLen, isList, err := item(payload, pos)
+	if err != nil {
+		return 0, 0, err
+	}
+	if isList {
+		return 0, 0, fmt.Errorf("must be a string, instead of a list")
+	}
+	return dataPos, dataLen, nil
+}
+
+func skipList(payload []byte, pos int) (int, error) {
+	dataPos, dataLen, err := list(payload, pos)
+	if err != nil {
+		return 0, err
+	}
+	return dataPos + dataLen, nil
+}
+
+// lists - appends spans of items of the list of lists at given position
+func lists(payload []byte, pos int, to []Span) ([]Span, int, error) {
+	dataPos, dataLen, err := list(payload, pos)
+	if err != nil {
+		return to, 0, err
+	}
+	end := dataPos + dataLen
+	for p := dataPos; p < end; {
+		next, err := skipList(payload[:end], p)
+		if err != nil {
+			return to, 0, fmt.Errorf("item %d: %w", len(to), err)
+		}
+		to = append(to, Span{Pos: p, Len: next - p})
+		p = next
+	}
+	return to, end, nil
+}
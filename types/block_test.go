@@ -0,0 +1,132 @@
+/*
+   Copyright 2021 Erigon contributors
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package types
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/ledgerwatch/erigon-lib/rlp"
+	"github.com/stretchr/testify/require"
+)
+
+func rlpString(s []byte) []byte {
+	if len(s) == 1 && s[0] < 128 {
+		return s
+	}
+	buf := make([]byte, 9+len(s))
+	n := rlp.EncodeString(s, buf)
+	return buf[:n]
+}
+
+func rlpU64(i uint64) []byte {
+	buf := make([]byte, 9)
+	return buf[:rlp.EncodeU64(i, buf)]
+}
+
+func rlpList(items ...[]byte) []byte {
+	data := bytes.Join(items, nil)
+	buf := make([]byte, 9+len(data))
+	n := rlp.EncodeListPrefix(len(data), buf)
+	return append(buf[:n], data...)
+}
+
+func TestParseBody(t *testing.T) {
+	require := require.New(t)
+	legacyTx := rlpList(rlpU64(1), rlpU64(2), rlpString(make([]byte, 20)))
+	typedTx := append([]byte{2}, rlpList(rlpU64(1), rlpU64(3), rlpString(bytes.Repeat([]byte{1}, 100)))...)
+	uncle := rlpList(rlpString(make([]byte, 32)), rlpU64(7))
+	withdrawal := rlpList(rlpU64(1), rlpU64(2), rlpString(make([]byte, 20)), rlpU64(1000))
+
+	var body Body
+	payload := rlpList(rlpList(legacyTx, rlpString(typedTx)), rlpList(uncle))
+	pos, err := ParseBody(payload, 0, &body)
+	require.NoError(err)
+	require.Equal(len(payload), pos)
+	require.Len(body.Txs, 2)
+	require.Equal(legacyTx, body.Txs[0].Of(payload))
+	require.Equal(byte(0), body.Txs[0].Type)
+	require.Equal(typedTx, body.Txs[1].Of(payload))
+	require.Equal(byte(2), body.Txs[1].Type)
+	require.Len(body.Uncles, 1)
+	require.Equal(uncle, body.Uncles[0].Of(payload))
+	require.False(body.HasWithdrawals)
+
+	// body is reused
+	payload = rlpList(rlpList(), rlpList(), rlpList(withdrawal, withdrawal))
+	_, err = ParseBody(payload, 0, &body)
+	require.NoError(err)
+	require.Empty(body.Txs)
+	require.Empty(body.Uncles)
+	require.True(body.HasWithdrawals)
+	require.Len(body.Withdrawals, 2)
+	require.Equal(withdrawal, body.Withdrawals[1].Of(payload))
+
+	for _, bad := range [][]byte{
+		payload[:len(payload)-1],
+		rlpList(rlpList(rlpU64(1)), rlpList()),
+		rlpList(rlpList(), rlpList(), rlpList(), rlpList()),
+		{0xf9, 0x01},
+	} {
+		_, err = ParseBody(bad, 0, &body)
+		require.Error(err)
+	}
+}
+
+func TestParseReceipts(t *testing.T) {
+	require := require.New(t)
+	bloom := rlpString(make([]byte, 256))
+	log := rlpList(rlpString(make([]byte, 20)), rlpList(), rlpString(nil))
+	legacy := rlpList(rlpU64(1), rlpU64(21000), bloom, rlpList(log, log))
+	typed := append([]byte{2}, rlpList(rlpU64(0), rlpU64(42000), bloom, rlpList())...)
+	root := bytes.Repeat([]byte{0xab}, 32)
+	preByzantium := rlpList(rlpString(root), rlpU64(63000), bloom, rlpList(log))
+
+	var receipts []Receipt
+	payload := rlpList(legacy, rlpString(typed), preByzantium)
+	pos, err := ParseReceipts(payload, 0, &receipts)
+	require.NoError(err)
+	require.Equal(len(payload), pos)
+	require.Len(receipts, 3)
+
+	require.Equal(legacy, receipts[0].Of(payload))
+	require.Equal(uint64(1), receipts[0].Status)
+	require.Equal(uint64(21000), receipts[0].CumulativeGasUsed)
+	require.Equal(2, receipts[0].LogsCount)
+	require.Equal(rlpList(log, log), receipts[0].Logs.Of(payload))
+	require.Equal(make([]byte, 256), receipts[0].Bloom.Of(payload))
+
+	require.Equal(typed, receipts[1].Of(payload))
+	require.Equal(byte(2), receipts[1].Type)
+	require.Equal(uint64(0), receipts[1].Status)
+	require.Equal(uint64(42000), receipts[1].CumulativeGasUsed)
+	require.Zero(receipts[1].LogsCount)
+
+	require.Equal(root, receipts[2].PostState.Of(payload))
+	require.Equal(uint64(63000), receipts[2].CumulativeGasUsed)
+	require.Equal(1, receipts[2].LogsCount)
+
+	for _, bad := range [][]byte{
+		payload[:len(payload)-1],
+		rlpList(rlpList(rlpU64(1), rlpU64(21000), rlpString(make([]byte, 255)), rlpList())),
+		rlpList(rlpList(rlpU64(1), rlpU64(21000), bloom, rlpList(), rlpU64(1))),
+		rlpList(rlpString([]byte{0x80})),
+	} {
+		_, err = ParseReceipts(bad, 0, &receipts)
+		require.Error(err)
+	}
+}